@@ -0,0 +1,112 @@
+// Package checkpointstore persists the progress of consumers, e.g. change log consumers,
+// replicators, and migrators, as named offsets, so a restarted consumer resumes where it stopped.
+//
+// Offsets are opaque strings, e.g. change log IDs or pagination cursors. CompareAndSet updates an
+// offset only if it wasn't changed concurrently, e.g. by another instance of the consumer, so
+// competing instances can detect that they lost ownership of the consumer's progress.
+//
+// Example:
+//
+//	checkpoints, _ := checkpointstore.New(dsClient, "checkpoints")
+//	afterID, _ := checkpoints.Get(ctx, "search-indexer")
+//	_ = userStore.ReplayChangeLog(ctx, afterID, func(ctx context.Context, e entitystore.ChangeLogEntry) error {
+//		...
+//		return checkpoints.Set(ctx, "search-indexer", e.ID)
+//	})
+package checkpointstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+const keyPrefix = "checkpoint" // Key prefix of consumer offsets.
+
+// Store stores the offsets of consumers in a namespace.
+// The store is safe for concurrent use.
+type Store struct {
+	dsClient  *datastore.Client
+	namespace string
+}
+
+// New creates a new instance of a Store storing offsets in the namespace, e.g. shared by the
+// consumers of an application.
+func New(dsClient *datastore.Client, namespace string) (*Store, error) {
+	if dsClient == nil {
+		return nil, errors.New("checkpointstore: datastore client must not be nil")
+	}
+	if namespace != "" {
+		if err := keyfactory.ValidateKeyFragment(namespace); err != nil {
+			return nil, err
+		}
+	}
+	return &Store{dsClient: dsClient, namespace: namespace}, nil
+}
+
+// key returns the key of the offset of the consumer.
+func (s *Store) key(consumer string) (*keyfactory.Key, error) {
+	if err := keyfactory.ValidateKeyFragment(consumer); err != nil {
+		return nil, fmt.Errorf("checkpointstore: invalid consumer name: %w", err)
+	}
+	return keyfactory.NewKey(keyfactory.BuildRedisKey(keyPrefix, consumer), s.namespace), nil
+}
+
+// Get returns the offset of the consumer, or an empty offset if the consumer has none.
+func (s *Store) Get(ctx context.Context, consumer string) (string, error) {
+	key, err := s.key(consumer)
+	if err != nil {
+		return "", err
+	}
+	data, err := s.dsClient.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, datastore.ErrKeyNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Set sets the offset of the consumer.
+func (s *Store) Set(ctx context.Context, consumer string, offset string) error {
+	if offset == "" {
+		return errors.New("checkpointstore: offset must not be empty")
+	}
+	key, err := s.key(consumer)
+	if err != nil {
+		return err
+	}
+	return s.dsClient.Put(ctx, key, []byte(offset), 0)
+}
+
+// CompareAndSet atomically sets the offset of the consumer if its current offset equals the
+// expected offset, where an empty expected offset matches a consumer without an offset.
+// It returns whether the offset was set.
+func (s *Store) CompareAndSet(ctx context.Context, consumer string, expected string, offset string) (bool, error) {
+	if offset == "" {
+		return false, errors.New("checkpointstore: offset must not be empty")
+	}
+	key, err := s.key(consumer)
+	if err != nil {
+		return false, err
+	}
+	var exp []byte
+	if expected != "" {
+		exp = []byte(expected)
+	}
+	return s.dsClient.CompareAndSwap(ctx, key, exp, []byte(offset))
+}
+
+// Delete removes the offset of the consumer, e.g. to restart it from the beginning.
+// It's a no-op if the consumer has no offset.
+func (s *Store) Delete(ctx context.Context, consumer string) error {
+	key, err := s.key(consumer)
+	if err != nil {
+		return err
+	}
+	return s.dsClient.Delete(ctx, key)
+}
@@ -0,0 +1,89 @@
+package checkpointstore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupStore(t *testing.T, namespace string) *Store {
+	t.Helper()
+	rsClient, _ := testutil.NewRedisClientWithCleanup(t)
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	s, err := New(dsClient, namespace)
+	require.NoError(t, err)
+	return s
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Validate", func(t *testing.T) {
+		_, err := New(nil, "checkpoints")
+		assert.Error(t, err)
+		s := setupStore(t, "checkpoints")
+		_, err = s.Get(ctx, "")
+		assert.Error(t, err, "should require a consumer name")
+		assert.Error(t, s.Set(ctx, "indexer", ""), "should require an offset")
+	})
+
+	t.Run("Get, set, and delete", func(t *testing.T) {
+		s := setupStore(t, "checkpoints")
+		offset, err := s.Get(ctx, "indexer")
+		require.NoError(t, err)
+		assert.Empty(t, offset)
+
+		require.NoError(t, s.Set(ctx, "indexer", "1-0"))
+		require.NoError(t, s.Set(ctx, "replicator", "42"))
+		offset, err = s.Get(ctx, "indexer")
+		require.NoError(t, err)
+		assert.Equal(t, "1-0", offset)
+
+		require.NoError(t, s.Delete(ctx, "indexer"))
+		offset, err = s.Get(ctx, "indexer")
+		require.NoError(t, err)
+		assert.Empty(t, offset)
+		offset, err = s.Get(ctx, "replicator")
+		require.NoError(t, err)
+		assert.Equal(t, "42", offset)
+	})
+
+	t.Run("Compare and set", func(t *testing.T) {
+		s := setupStore(t, "checkpoints")
+		ok, err := s.CompareAndSet(ctx, "indexer", "", "1-0")
+		require.NoError(t, err)
+		assert.True(t, ok, "should set missing offset")
+		ok, err = s.CompareAndSet(ctx, "indexer", "", "2-0")
+		require.NoError(t, err)
+		assert.False(t, ok, "should not set existing offset")
+		ok, err = s.CompareAndSet(ctx, "indexer", "1-0", "2-0")
+		require.NoError(t, err)
+		assert.True(t, ok)
+		ok, err = s.CompareAndSet(ctx, "indexer", "1-0", "3-0")
+		require.NoError(t, err)
+		assert.False(t, ok, "should not set changed offset")
+		offset, err := s.Get(ctx, "indexer")
+		require.NoError(t, err)
+		assert.Equal(t, "2-0", offset)
+	})
+
+	t.Run("Namespaces", func(t *testing.T) {
+		rsClient, _ := testutil.NewRedisClientWithCleanup(t)
+		dsClient, err := datastore.NewClient(rsClient)
+		require.NoError(t, err)
+		a, err := New(dsClient, "app-a")
+		require.NoError(t, err)
+		b, err := New(dsClient, "app-b")
+		require.NoError(t, err)
+
+		require.NoError(t, a.Set(ctx, "indexer", "1-0"))
+		offset, err := b.Get(ctx, "indexer")
+		require.NoError(t, err)
+		assert.Empty(t, offset, "should isolate namespaces")
+	})
+}
@@ -0,0 +1,198 @@
+// Package cloudevents wraps entity change events in CloudEvents 1.0 envelopes, using either the
+// JSON event format or the protobuf event format.
+//
+// The encoder is used by the change event integrations (see webhook.WithCloudEvents and
+// natspub.WithCloudEvents) so downstream consumers get a standard event schema.
+//
+// See https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/spec.md.
+package cloudevents
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/holmberd/go-entitystore/encoder"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	SpecVersion = "1.0"
+
+	ContentTypeJSON     = "application/cloudevents+json"     // Content type of the JSON event format.
+	ContentTypeProtobuf = "application/cloudevents+protobuf" // Content type of the protobuf event format.
+
+	DefaultTypePrefix = "entitystore" // Default prefix of the event type attribute.
+)
+
+// Format is an event format.
+type Format int
+
+const (
+	FormatJSON Format = iota
+	FormatProtobuf
+)
+
+// Envelope is a CloudEvents 1.0 event in the JSON event format.
+type Envelope struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      []byte          `json:"data_base64,omitempty"` // Data of non-JSON content types.
+}
+
+// Encoder encodes change events as CloudEvents.
+type Encoder struct {
+	source     string
+	typePrefix string
+	format     Format
+	dataCodec  encoder.Codec
+}
+
+// NewEncoder creates a new instance of an Encoder.
+// The source identifies the producer of the events, e.g. "/services/users", and is required.
+// The event type attribute is "<typePrefix>.<eventType>", where an empty type prefix defaults to
+// DefaultTypePrefix.
+func NewEncoder(source string, typePrefix string, format Format) (*Encoder, error) {
+	if source == "" {
+		return nil, errors.New("cloudevents: source must not be empty")
+	}
+	if format != FormatJSON && format != FormatProtobuf {
+		return nil, fmt.Errorf("cloudevents: invalid format %d", format)
+	}
+	if typePrefix == "" {
+		typePrefix = DefaultTypePrefix
+	}
+	return &Encoder{source: source, typePrefix: typePrefix, format: format, dataCodec: encoder.JSONEncoder{}}, nil
+}
+
+// WithDataCodec returns a copy of the encoder marshaling the event data with the codec, e.g.
+// encoder.ProtoEncoder, instead of as JSON. The data content type attribute is the content type
+// of the codec (see encoder.ContentType), and non-JSON data is base64 encoded in the JSON format.
+func (e *Encoder) WithDataCodec(c encoder.Codec) *Encoder {
+	enc := *e
+	enc.dataCodec = c
+	return &enc
+}
+
+// Encode encodes the event data, marshaled by the data codec, in a CloudEvent of the event type.
+// It returns the encoded event and its content type.
+func (e *Encoder) Encode(eventType string, subject string, t time.Time, data any) ([]byte, string, error) {
+	payload, err := e.dataCodec.Marshal(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("cloudevents: %w", err)
+	}
+	id, err := newID()
+	if err != nil {
+		return nil, "", fmt.Errorf("cloudevents: %w", err)
+	}
+	env := Envelope{
+		SpecVersion:     SpecVersion,
+		ID:              id,
+		Source:          e.source,
+		Type:            e.typePrefix + "." + eventType,
+		Subject:         subject,
+		Time:            t.UTC(),
+		DataContentType: encoder.ContentType(e.dataCodec),
+	}
+	if e.format == FormatProtobuf {
+		env.Data = payload
+		return marshalProto(env), ContentTypeProtobuf, nil
+	}
+	if isJSON(env.DataContentType) {
+		env.Data = payload
+	} else {
+		env.DataBase64 = payload
+	}
+	b, err := json.Marshal(env)
+	if err != nil {
+		return nil, "", fmt.Errorf("cloudevents: %w", err)
+	}
+	return b, ContentTypeJSON, nil
+}
+
+// isJSON returns whether the media type is JSON, i.e. "application/json" or a "+json" suffix.
+func isJSON(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(mediaType)
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// newID returns a new random event ID.
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Field numbers of the io.cloudevents.v1.CloudEvent protobuf message.
+const (
+	fieldID          = 1
+	fieldSource      = 2
+	fieldSpecVersion = 3
+	fieldType        = 4
+	fieldAttributes  = 5
+	fieldBinaryData  = 6
+
+	fieldAttrString    = 3 // CloudEventAttributeValue.ce_string.
+	fieldAttrTimestamp = 7 // CloudEventAttributeValue.ce_timestamp.
+)
+
+// marshalProto marshals the envelope in the protobuf event format, without depending on
+// generated code for the CloudEvents protobuf schema.
+func marshalProto(env Envelope) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, fieldID, protowire.BytesType)
+	b = protowire.AppendString(b, env.ID)
+	b = protowire.AppendTag(b, fieldSource, protowire.BytesType)
+	b = protowire.AppendString(b, env.Source)
+	b = protowire.AppendTag(b, fieldSpecVersion, protowire.BytesType)
+	b = protowire.AppendString(b, env.SpecVersion)
+	b = protowire.AppendTag(b, fieldType, protowire.BytesType)
+	b = protowire.AppendString(b, env.Type)
+
+	// Timestamp message: seconds = 1, nanos = 2.
+	var ts []byte
+	ts = protowire.AppendTag(ts, 1, protowire.VarintType)
+	ts = protowire.AppendVarint(ts, uint64(env.Time.Unix()))
+	if nanos := env.Time.Nanosecond(); nanos != 0 {
+		ts = protowire.AppendTag(ts, 2, protowire.VarintType)
+		ts = protowire.AppendVarint(ts, uint64(nanos))
+	}
+	b = appendAttribute(b, "time", fieldAttrTimestamp, ts)
+	b = appendAttribute(b, "datacontenttype", fieldAttrString, []byte(env.DataContentType))
+	if env.Subject != "" {
+		b = appendAttribute(b, "subject", fieldAttrString, []byte(env.Subject))
+	}
+
+	b = protowire.AppendTag(b, fieldBinaryData, protowire.BytesType)
+	b = protowire.AppendBytes(b, env.Data)
+	return b
+}
+
+// appendAttribute appends an attributes map entry with the attribute value field.
+func appendAttribute(b []byte, name string, valueField protowire.Number, value []byte) []byte {
+	var attr []byte
+	attr = protowire.AppendTag(attr, valueField, protowire.BytesType)
+	attr = protowire.AppendBytes(attr, value)
+
+	var entry []byte
+	entry = protowire.AppendTag(entry, 1, protowire.BytesType) // Map entry key.
+	entry = protowire.AppendString(entry, name)
+	entry = protowire.AppendTag(entry, 2, protowire.BytesType) // Map entry value.
+	entry = protowire.AppendBytes(entry, attr)
+
+	b = protowire.AppendTag(b, fieldAttributes, protowire.BytesType)
+	return protowire.AppendBytes(b, entry)
+}
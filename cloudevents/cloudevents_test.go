@@ -0,0 +1,93 @@
+package cloudevents
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type testData struct {
+	Keys []string `json:"keys"`
+}
+
+// rawCodec marshals byte slices as is.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v any) ([]byte, error) { return v.([]byte), nil }
+
+func (rawCodec) Unmarshal(data []byte, out any) error {
+	*out.(*[]byte) = data
+	return nil
+}
+
+func TestEncoder(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+	data := testData{Keys: []string{"key"}}
+
+	t.Run("JSON format", func(t *testing.T) {
+		enc, err := NewEncoder("/services/test", "", FormatJSON)
+		require.NoError(t, err)
+		b, contentType, err := enc.Encode("EntitiesAdded", "subject", now, data)
+		require.NoError(t, err)
+		assert.Equal(t, ContentTypeJSON, contentType)
+
+		var env Envelope
+		require.NoError(t, json.Unmarshal(b, &env))
+		assert.Equal(t, SpecVersion, env.SpecVersion)
+		assert.NotEmpty(t, env.ID)
+		assert.Equal(t, "/services/test", env.Source)
+		assert.Equal(t, "entitystore.EntitiesAdded", env.Type)
+		assert.Equal(t, "subject", env.Subject)
+		assert.True(t, now.Equal(env.Time))
+		assert.JSONEq(t, `{"keys":["key"]}`, string(env.Data))
+	})
+
+	t.Run("JSON format with data codec", func(t *testing.T) {
+		enc, err := NewEncoder("/services/test", "", FormatJSON)
+		require.NoError(t, err)
+		b, _, err := enc.WithDataCodec(rawCodec{}).Encode("EntitiesAdded", "", now, []byte{0xff})
+		require.NoError(t, err)
+
+		var env Envelope
+		require.NoError(t, json.Unmarshal(b, &env))
+		assert.Equal(t, "application/octet-stream", env.DataContentType)
+		assert.Nil(t, env.Data)
+		assert.Equal(t, []byte{0xff}, env.DataBase64)
+	})
+
+	t.Run("Protobuf format", func(t *testing.T) {
+		enc, err := NewEncoder("/services/test", "com.example", FormatProtobuf)
+		require.NoError(t, err)
+		b, contentType, err := enc.Encode("EntitiesAdded", "", now, data)
+		require.NoError(t, err)
+		assert.Equal(t, ContentTypeProtobuf, contentType)
+
+		fields := make(map[protowire.Number][][]byte)
+		for len(b) > 0 {
+			num, typ, n := protowire.ConsumeTag(b)
+			require.GreaterOrEqual(t, n, 0)
+			require.Equal(t, protowire.BytesType, typ)
+			b = b[n:]
+			v, n := protowire.ConsumeBytes(b)
+			require.GreaterOrEqual(t, n, 0)
+			fields[num] = append(fields[num], v)
+			b = b[n:]
+		}
+		assert.Equal(t, "/services/test", string(fields[fieldSource][0]))
+		assert.Equal(t, SpecVersion, string(fields[fieldSpecVersion][0]))
+		assert.Equal(t, "com.example.EntitiesAdded", string(fields[fieldType][0]))
+		assert.Len(t, fields[fieldAttributes], 2, "should encode time and content type attributes")
+		assert.JSONEq(t, `{"keys":["key"]}`, string(fields[fieldBinaryData][0]))
+	})
+
+	t.Run("Invalid encoder", func(t *testing.T) {
+		_, err := NewEncoder("", "", FormatJSON)
+		assert.Error(t, err)
+		_, err = NewEncoder("/source", "", Format(9))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,274 @@
+// Package config builds datastore clients and store options from a YAML file or environment
+// variables, with validation, so services don't hand-roll Redis configuration parsing.
+//
+// Example YAML file:
+//
+//	redis:
+//	  mode: sentinel
+//	  addrs: [sentinel-1:26379, sentinel-2:26379]
+//	  master_name: mymaster
+//	  password: secret
+//	  pool_size: 20
+//	  tls:
+//	    enabled: true
+//	    ca_file: /etc/redis/ca.pem
+//	store:
+//	  namespace: prod
+//	  ttl: 24h
+//
+// The same settings are read from environment variables by FromEnv, e.g. APP_REDIS_ADDRS and
+// APP_STORE_TTL with the prefix "APP" (see FromEnv).
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/entitystore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"gopkg.in/yaml.v3"
+)
+
+// Redis deployment modes.
+const (
+	ModeStandalone = "standalone" // A single Redis server (default).
+	ModeSentinel   = "sentinel"   // A Redis primary discovered through Sentinel.
+	ModeCluster    = "cluster"    // Redis Cluster, see datastore.NewClient for its constraints.
+)
+
+// Config is the configuration of a datastore client and its stores.
+type Config struct {
+	Redis RedisConfig `yaml:"redis"`
+	Store StoreConfig `yaml:"store"`
+}
+
+// RedisConfig is the configuration of the Redis client and datastore client.
+type RedisConfig struct {
+	Mode         string        `yaml:"mode"`           // Deployment mode, see the Mode constants.
+	Addrs        []string      `yaml:"addrs"`          // Server addresses, Sentinel addresses in sentinel mode, or seed node addresses in cluster mode.
+	MasterName   string        `yaml:"master_name"`    // Sentinel master name, required in sentinel mode.
+	DB           int           `yaml:"db"`             // Logical database; must be 0 in cluster mode.
+	Username     string        `yaml:"username"`       // ACL username.
+	Password     string        `yaml:"password"`       // Password.
+	PoolSize     int           `yaml:"pool_size"`      // Max number of connections; 0 uses the Redis client default.
+	MinIdleConns int           `yaml:"min_idle_conns"` // Min number of idle connections.
+	DialTimeout  time.Duration `yaml:"dial_timeout"`   // 0 uses the Redis client default.
+	ReadTimeout  time.Duration `yaml:"read_timeout"`   // 0 uses the Redis client default.
+	WriteTimeout time.Duration `yaml:"write_timeout"`  // 0 uses the Redis client default.
+	TLS          TLSConfig     `yaml:"tls"`
+	KeyPrefix    string        `yaml:"key_prefix"`    // Optional global key prefix (see datastore.WithKeyPrefix).
+	MaxPageSize  int           `yaml:"max_page_size"` // 0 uses datastore.DefaultMaxPageSize.
+}
+
+// TLSConfig is the TLS configuration of the Redis connections.
+type TLSConfig struct {
+	Enabled            bool   `yaml:"enabled"`
+	CAFile             string `yaml:"ca_file"`              // PEM CA certificates; the system pool is used if empty.
+	CertFile           string `yaml:"cert_file"`            // PEM client certificate for mutual TLS.
+	KeyFile            string `yaml:"key_file"`             // PEM client key for mutual TLS.
+	ServerName         string `yaml:"server_name"`          // Server name to verify, if not the address host.
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"` // Disables server verification; only for testing.
+}
+
+// StoreConfig is the configuration of the entity stores.
+type StoreConfig struct {
+	Namespace string        `yaml:"namespace"` // Key namespace of the stores.
+	TTL       time.Duration `yaml:"ttl"`       // Expiration of written entities; 0 for no expiration.
+	Checksum  bool          `yaml:"checksum"`  // Whether stored values carry a checksum (see entitystore.WithChecksum).
+}
+
+// Load reads and validates the configuration from the YAML file.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse parses and validates the YAML configuration.
+func Parse(data []byte) (*Config, error) {
+	var c Config
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Validate validates the configuration.
+func (c *Config) Validate() error {
+	return errors.Join(c.Redis.Validate(), c.Store.Validate())
+}
+
+// Validate validates the Redis configuration.
+func (c *RedisConfig) Validate() error {
+	var errs []error
+	switch c.Mode {
+	case "", ModeStandalone:
+		if len(c.Addrs) != 1 {
+			errs = append(errs, fmt.Errorf("config: standalone mode requires exactly one address, got %d", len(c.Addrs)))
+		}
+	case ModeSentinel:
+		if len(c.Addrs) == 0 {
+			errs = append(errs, errors.New("config: sentinel mode requires at least one sentinel address"))
+		}
+		if c.MasterName == "" {
+			errs = append(errs, errors.New("config: sentinel mode requires a master name"))
+		}
+	case ModeCluster:
+		if len(c.Addrs) == 0 {
+			errs = append(errs, errors.New("config: cluster mode requires at least one node address"))
+		}
+		if c.DB != 0 {
+			errs = append(errs, errors.New("config: cluster mode doesn't support logical databases"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("config: invalid redis mode '%s'", c.Mode))
+	}
+	if c.DB < 0 {
+		errs = append(errs, fmt.Errorf("config: invalid redis database %d", c.DB))
+	}
+	if c.PoolSize < 0 || c.MinIdleConns < 0 || c.MaxPageSize < 0 {
+		errs = append(errs, errors.New("config: pool size, min idle connections, and max page size must not be negative"))
+	}
+	if c.Username != "" && c.Password == "" {
+		errs = append(errs, errors.New("config: username requires a password"))
+	}
+	if c.KeyPrefix != "" {
+		if err := keyfactory.ValidateKeyFragment(c.KeyPrefix); err != nil {
+			errs = append(errs, fmt.Errorf("config: invalid key prefix: %w", err))
+		}
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		errs = append(errs, errors.New("config: tls cert file and key file must be set together"))
+	}
+	if !c.TLS.Enabled && (c.TLS.CAFile != "" || c.TLS.CertFile != "") {
+		errs = append(errs, errors.New("config: tls files are set but tls is not enabled"))
+	}
+	return errors.Join(errs...)
+}
+
+// Validate validates the store configuration.
+func (c *StoreConfig) Validate() error {
+	var errs []error
+	if c.Namespace != "" {
+		if err := keyfactory.ValidateKeyFragment(c.Namespace); err != nil {
+			errs = append(errs, fmt.Errorf("config: invalid store namespace: %w", err))
+		}
+	}
+	if c.TTL < 0 {
+		errs = append(errs, fmt.Errorf("config: invalid store ttl %s", c.TTL))
+	}
+	return errors.Join(errs...)
+}
+
+// RedisClient creates a new Redis client from the configuration, a *redis.ClusterClient in cluster
+// mode, otherwise a *redis.Client. The client is owned and closed by the caller.
+func (c *RedisConfig) RedisClient() (redis.UniversalClient, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	tlsConfig, err := c.TLS.build()
+	if err != nil {
+		return nil, err
+	}
+	switch c.Mode {
+	case ModeCluster:
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        c.Addrs,
+			Username:     c.Username,
+			Password:     c.Password,
+			PoolSize:     c.PoolSize,
+			MinIdleConns: c.MinIdleConns,
+			DialTimeout:  c.DialTimeout,
+			ReadTimeout:  c.ReadTimeout,
+			WriteTimeout: c.WriteTimeout,
+			TLSConfig:    tlsConfig,
+		}), nil
+	case ModeSentinel:
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:    c.MasterName,
+			SentinelAddrs: c.Addrs,
+			DB:            c.DB,
+			Username:      c.Username,
+			Password:      c.Password,
+			PoolSize:      c.PoolSize,
+			MinIdleConns:  c.MinIdleConns,
+			DialTimeout:   c.DialTimeout,
+			ReadTimeout:   c.ReadTimeout,
+			WriteTimeout:  c.WriteTimeout,
+			TLSConfig:     tlsConfig,
+		}), nil
+	}
+	return redis.NewClient(&redis.Options{
+		Addr:         c.Addrs[0],
+		DB:           c.DB,
+		Username:     c.Username,
+		Password:     c.Password,
+		PoolSize:     c.PoolSize,
+		MinIdleConns: c.MinIdleConns,
+		DialTimeout:  c.DialTimeout,
+		ReadTimeout:  c.ReadTimeout,
+		WriteTimeout: c.WriteTimeout,
+		TLSConfig:    tlsConfig,
+	}), nil
+}
+
+// DatastoreOptions returns the datastore client options of the configuration.
+func (c *RedisConfig) DatastoreOptions() []datastore.ClientOption {
+	var opts []datastore.ClientOption
+	if c.KeyPrefix != "" {
+		opts = append(opts, datastore.WithKeyPrefix(c.KeyPrefix))
+	}
+	if c.MaxPageSize > 0 {
+		opts = append(opts, datastore.WithMaxPageSize(c.MaxPageSize))
+	}
+	return opts
+}
+
+// DatastoreClient creates a new datastore client and its Redis client from the configuration.
+// The Redis client is owned and closed by the caller.
+func (c *RedisConfig) DatastoreClient() (*datastore.Client, redis.UniversalClient, error) {
+	rsClient, err := c.RedisClient()
+	if err != nil {
+		return nil, nil, err
+	}
+	ds, err := datastore.NewClient(rsClient, c.DatastoreOptions()...)
+	if err != nil {
+		rsClient.Close()
+		return nil, nil, err
+	}
+	return ds, rsClient, nil
+}
+
+// StoreOptions returns the entity store options of the configuration.
+// The namespace and TTL are passed to entitystore.New and the store writes by the caller.
+func (c *StoreConfig) StoreOptions() []entitystore.Option {
+	var opts []entitystore.Option
+	if c.Checksum {
+		opts = append(opts, entitystore.WithChecksum())
+	}
+	return opts
+}
+
+// build returns the TLS client configuration, or nil if TLS is disabled.
+func (c *TLSConfig) build() (*tls.Config, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+	return datastore.TLSConfig{
+		CAFile:             c.CAFile,
+		CertFile:           c.CertFile,
+		KeyFile:            c.KeyFile,
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}.Build()
+}
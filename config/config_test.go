@@ -0,0 +1,128 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigParse(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		c, err := Parse([]byte(`
+redis:
+  addrs: [localhost:6379]
+  pool_size: 20
+  read_timeout: 2s
+  key_prefix: app
+store:
+  namespace: prod
+  ttl: 24h
+  checksum: true
+`))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"localhost:6379"}, c.Redis.Addrs)
+		assert.Equal(t, 20, c.Redis.PoolSize)
+		assert.Equal(t, 2*time.Second, c.Redis.ReadTimeout)
+		assert.Equal(t, "prod", c.Store.Namespace)
+		assert.Equal(t, 24*time.Hour, c.Store.TTL)
+		assert.Len(t, c.Redis.DatastoreOptions(), 1)
+		assert.Len(t, c.Store.StoreOptions(), 1)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		tests := map[string]string{
+			"No address":        "redis: {}",
+			"Sentinel master":   "redis: {mode: sentinel, addrs: [a:26379]}",
+			"Cluster database":  "redis: {mode: cluster, addrs: [a:6379], db: 1}",
+			"Cluster address":   "redis: {mode: cluster}",
+			"Unknown mode":      "redis: {mode: foo, addrs: [a:6379]}",
+			"Negative ttl":      "redis: {addrs: [a:6379]}\nstore: {ttl: -1s}",
+			"Username only":     "redis: {addrs: [a:6379], username: u}",
+			"Cert without key":  "redis: {addrs: [a:6379], tls: {enabled: true, cert_file: c.pem}}",
+			"TLS files, no TLS": "redis: {addrs: [a:6379], tls: {ca_file: ca.pem}}",
+			"Bad duration":      "redis: {addrs: [a:6379], read_timeout: soon}",
+		}
+		for name, data := range tests {
+			t.Run(name, func(t *testing.T) {
+				_, err := Parse([]byte(data))
+				assert.Error(t, err)
+			})
+		}
+	})
+
+	t.Run("Load", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		require.NoError(t, os.WriteFile(path, []byte("redis: {addrs: [a:6379]}"), 0o600))
+		c, err := Load(path)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a:6379"}, c.Redis.Addrs)
+
+		_, err = Load(filepath.Join(t.TempDir(), "missing.yaml"))
+		assert.Error(t, err)
+	})
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		t.Setenv("APP_REDIS_MODE", "sentinel")
+		t.Setenv("APP_REDIS_ADDRS", "s1:26379, s2:26379")
+		t.Setenv("APP_REDIS_MASTER_NAME", "mymaster")
+		t.Setenv("APP_REDIS_DB", "2")
+		t.Setenv("APP_STORE_TTL", "1h")
+		t.Setenv("APP_STORE_CHECKSUM", "true")
+		c, err := FromEnv("APP")
+		require.NoError(t, err)
+		assert.Equal(t, ModeSentinel, c.Redis.Mode)
+		assert.Equal(t, []string{"s1:26379", "s2:26379"}, c.Redis.Addrs)
+		assert.Equal(t, "mymaster", c.Redis.MasterName)
+		assert.Equal(t, 2, c.Redis.DB)
+		assert.Equal(t, time.Hour, c.Store.TTL)
+		assert.True(t, c.Store.Checksum)
+	})
+
+	t.Run("Invalid values", func(t *testing.T) {
+		t.Setenv("APP_REDIS_ADDRS", "a:6379")
+		t.Setenv("APP_REDIS_POOL_SIZE", "many")
+		t.Setenv("APP_STORE_TTL", "forever")
+		_, err := FromEnv("APP")
+		assert.ErrorContains(t, err, "APP_REDIS_POOL_SIZE")
+		assert.ErrorContains(t, err, "APP_STORE_TTL")
+	})
+}
+
+func TestConfigDatastoreClient(t *testing.T) {
+	t.Run("Standalone", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		c := RedisConfig{Addrs: []string{server.Addr()}, KeyPrefix: "app"}
+		ds, rsClient, err := c.DatastoreClient()
+		require.NoError(t, err)
+		defer rsClient.Close()
+		require.NotNil(t, ds)
+		assert.NoError(t, rsClient.Ping(t.Context()).Err())
+	})
+
+	t.Run("Cluster", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		c := RedisConfig{Mode: ModeCluster, Addrs: []string{server.Addr()}}
+		ds, rsClient, err := c.DatastoreClient()
+		require.NoError(t, err)
+		defer rsClient.Close()
+		require.NotNil(t, ds)
+		assert.IsType(t, &redis.ClusterClient{}, rsClient)
+		assert.Equal(t, rsClient, ds.GetUniversalClient())
+	})
+
+	t.Run("Invalid TLS CA file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "ca.pem")
+		require.NoError(t, os.WriteFile(path, []byte("not a certificate"), 0o600))
+		c := RedisConfig{Addrs: []string{"a:6379"}, TLS: TLSConfig{Enabled: true, CAFile: path}}
+		_, err := c.RedisClient()
+		assert.ErrorContains(t, err, "no PEM certificates")
+	})
+}
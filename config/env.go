@@ -0,0 +1,109 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FromEnv reads and validates the configuration from environment variables named
+// "<prefix>_<SECTION>_<FIELD>", where the field is the upper-cased YAML field name, e.g.
+// APP_REDIS_ADDRS, APP_REDIS_TLS_CA_FILE, and APP_STORE_TTL with the prefix "APP".
+// List values are comma-separated, and durations use time.ParseDuration syntax.
+func FromEnv(prefix string) (*Config, error) {
+	e := envReader{prefix: prefix}
+	var c Config
+	c.Redis.Mode = e.string("REDIS_MODE")
+	c.Redis.Addrs = e.list("REDIS_ADDRS")
+	c.Redis.MasterName = e.string("REDIS_MASTER_NAME")
+	c.Redis.DB = e.int("REDIS_DB")
+	c.Redis.Username = e.string("REDIS_USERNAME")
+	c.Redis.Password = e.string("REDIS_PASSWORD")
+	c.Redis.PoolSize = e.int("REDIS_POOL_SIZE")
+	c.Redis.MinIdleConns = e.int("REDIS_MIN_IDLE_CONNS")
+	c.Redis.DialTimeout = e.duration("REDIS_DIAL_TIMEOUT")
+	c.Redis.ReadTimeout = e.duration("REDIS_READ_TIMEOUT")
+	c.Redis.WriteTimeout = e.duration("REDIS_WRITE_TIMEOUT")
+	c.Redis.KeyPrefix = e.string("REDIS_KEY_PREFIX")
+	c.Redis.MaxPageSize = e.int("REDIS_MAX_PAGE_SIZE")
+	c.Redis.TLS.Enabled = e.bool("REDIS_TLS_ENABLED")
+	c.Redis.TLS.CAFile = e.string("REDIS_TLS_CA_FILE")
+	c.Redis.TLS.CertFile = e.string("REDIS_TLS_CERT_FILE")
+	c.Redis.TLS.KeyFile = e.string("REDIS_TLS_KEY_FILE")
+	c.Redis.TLS.ServerName = e.string("REDIS_TLS_SERVER_NAME")
+	c.Redis.TLS.InsecureSkipVerify = e.bool("REDIS_TLS_INSECURE_SKIP_VERIFY")
+	c.Store.Namespace = e.string("STORE_NAMESPACE")
+	c.Store.TTL = e.duration("STORE_TTL")
+	c.Store.Checksum = e.bool("STORE_CHECKSUM")
+	if err := errors.Join(e.errs...); err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// envReader reads environment variables, collecting parse errors.
+type envReader struct {
+	prefix string
+	errs   []error
+}
+
+func (e *envReader) string(name string) string {
+	if e.prefix != "" {
+		name = e.prefix + "_" + name
+	}
+	return strings.TrimSpace(os.Getenv(name))
+}
+
+func (e *envReader) list(name string) []string {
+	v := e.string(name)
+	if v == "" {
+		return nil
+	}
+	items := strings.Split(v, ",")
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+	return items
+}
+
+func (e *envReader) int(name string) int {
+	v := e.string(name)
+	if v == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("config: invalid integer in %s_%s: %w", e.prefix, name, err))
+	}
+	return n
+}
+
+func (e *envReader) bool(name string) bool {
+	v := e.string(name)
+	if v == "" {
+		return false
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("config: invalid boolean in %s_%s: %w", e.prefix, name, err))
+	}
+	return b
+}
+
+func (e *envReader) duration(name string) time.Duration {
+	v := e.string(name)
+	if v == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("config: invalid duration in %s_%s: %w", e.prefix, name, err))
+	}
+	return d
+}
@@ -0,0 +1,96 @@
+package datastore
+
+import (
+	"context"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+// KeyData is a key and its associated data.
+type KeyData struct {
+	Key  *keyfactory.Key
+	Data []byte
+}
+
+// GetAcrossNamespaces retrieves the data of all keys matching the key pattern in any namespace,
+// including keys without a namespace. The namespace of the key pattern is ignored.
+// The result is grouped by key namespace (see keyfactory.Key.Namespace), where keys without
+// a namespace are grouped under the empty string.
+//
+// Intended for operational tooling, e.g. to find an entity regardless of which environment
+// namespace it was written under.
+//
+// NOTE: This operation scans the entire keyspace.
+func (c *Client) GetAcrossNamespaces(ctx context.Context, keyMatch *keyfactory.Key) (map[string][]KeyData, error) {
+	if keyMatch == nil {
+		return nil, nil // No-op for empty key.
+	}
+	patterns := []string{
+		c.prefixRedisKey(keyMatch.Key()), // Keys without namespace.
+		c.prefixRedisKey(keyfactory.BuildRedisKey(
+			keyfactory.ReservedNamespaceDelimiter+string(keyfactory.WildcardAnyString)+keyfactory.ReservedNamespaceDelimiter,
+			keyMatch.Key(),
+		)),
+	}
+	seen := make(map[string]struct{})
+	var keys []*keyfactory.Key
+	for _, pattern := range patterns {
+		rsKeys, err := c.scanPattern(ctx, pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, rsKey := range rsKeys {
+			if _, ok := seen[rsKey]; ok {
+				continue // Skip duplicate keys returned during the scan.
+			}
+			seen[rsKey] = struct{}{}
+			key, err := c.parseRedisKey(rsKey)
+			if err != nil {
+				return nil, newOpError("scan", rsKey, err)
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	result := make(map[string][]KeyData)
+	for start := 0; start < len(keys); start += c.maxPageSize {
+		batch := keys[start:min(start+c.maxPageSize, len(keys))]
+		data, err := c.GetMultiAligned(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		for i, d := range data {
+			if d == nil {
+				continue // Key removed since the scan; skip it.
+			}
+			ns := batch[i].Namespace()
+			result[ns] = append(result[ns], KeyData{Key: batch[i], Data: d})
+		}
+	}
+	return result, nil
+}
+
+// scanPattern retrieves all Redis keys matching the raw Redis glob pattern using SCAN.
+// The returned keys may contain duplicates.
+func (c *Client) scanPattern(ctx context.Context, pattern string) ([]string, error) {
+	var rsKeys []string
+	err := c.forEachNode(ctx, pattern, func(ctx context.Context, rs redis.Cmdable) error {
+		cursor := uint64(0)
+		for {
+			keys, nextCursor, err := rs.Scan(ctx, cursor, pattern, int64(c.scanCount)).Result()
+			if err != nil {
+				return err
+			}
+			rsKeys = append(rsKeys, keys...)
+			if nextCursor == 0 {
+				return nil
+			}
+			cursor = nextCursor
+		}
+	})
+	if err != nil {
+		return nil, newOpError("scan", pattern, err)
+	}
+	return rsKeys, nil
+}
@@ -0,0 +1,113 @@
+package datastore
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// TLSConfig is the TLS configuration of the Redis connections.
+// Set CertFile and KeyFile to authenticate the client with mutual TLS.
+type TLSConfig struct {
+	CAFile             string // PEM CA certificates verifying the server; the system pool is used if empty.
+	CertFile           string // PEM client certificate for mutual TLS.
+	KeyFile            string // PEM client key for mutual TLS.
+	ServerName         string // Server name to verify, if not the host of the address.
+	InsecureSkipVerify bool   // Disables server verification; only for testing.
+}
+
+// Build validates the configuration and returns the TLS client configuration.
+func (t TLSConfig) Build() (*tls.Config, error) {
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return nil, errors.New("datastore: tls cert file and key file must be set together")
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("datastore: tls ca file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("datastore: tls ca file '%s' contains no PEM certificates", t.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("datastore: tls client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// WithTLS enables TLS for the Redis connections of the client.
+// Like WithDB, the client creates and owns a new Redis client; call Close to release it.
+func WithTLS(cfg TLSConfig) ClientOption {
+	return func(c *Client) error {
+		tlsConfig, err := cfg.Build()
+		if err != nil {
+			return err
+		}
+		return c.reconfigure(func(opts *redis.Options) {
+			opts.TLSConfig = tlsConfig
+		})
+	}
+}
+
+// WithCredentials authenticates the Redis connections of the client with the password, as the
+// Redis ACL user if the username is set, or with the legacy requirepass password otherwise.
+// Like WithDB, the client creates and owns a new Redis client; call Close to release it.
+func WithCredentials(username, password string) ClientOption {
+	return func(c *Client) error {
+		if password == "" {
+			return errors.New("datastore: credentials require a password")
+		}
+		if strings.ContainsAny(username, " \t\r\n") {
+			return fmt.Errorf("datastore: invalid acl username '%s'", username)
+		}
+		return c.reconfigure(func(opts *redis.Options) {
+			opts.Username = username
+			opts.Password = password
+		})
+	}
+}
+
+// Dial creates a new instance of a Client connected to the Redis server at the address,
+// configured by the options, e.g. WithTLS, WithCredentials, and WithDB.
+// The client owns the Redis client; call Close to release it.
+func Dial(addr string, opts ...ClientOption) (*Client, error) {
+	if addr == "" {
+		return nil, errors.New("datastore: redis address must not be empty")
+	}
+	return newClient(redis.NewClient(&redis.Options{Addr: addr}), true, opts)
+}
+
+// reconfigure replaces the Redis client with a new client owned by the client, with the same
+// options as the current one except for the changes applied by fn.
+// A previously owned Redis client is closed.
+func (c *Client) reconfigure(fn func(*redis.Options)) error {
+	rs, ok := c.rsClient.(*redis.Client)
+	if !ok {
+		return fmt.Errorf("datastore: option not supported for Redis client %T", c.rsClient)
+	}
+	opts := *rs.Options()
+	fn(&opts)
+	if c.ownsRSClient {
+		_ = c.rsClient.Close()
+	}
+	c.rsClient = redis.NewClient(&opts)
+	c.ownsRSClient = true
+	return nil
+}
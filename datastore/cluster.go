@@ -0,0 +1,130 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+// errUntaggedClusterScan is returned by cursor scans of a cluster with a key pattern matching
+// keys in more than one hash slot.
+var errUntaggedClusterScan = errors.New("datastore: cursor scans of a cluster require a hash-tagged key pattern")
+
+// isCluster returns whether the client is connected to a Redis Cluster.
+func (c *Client) isCluster() bool {
+	_, ok := c.rsClient.(*redis.ClusterClient)
+	return ok
+}
+
+// sameHashTag returns whether all Redis keys have the same non-empty hash tag, so they're in the
+// same hash slot.
+func sameHashTag(rsKeys map[string]interface{}) bool {
+	tag := ""
+	for rsKey := range rsKeys {
+		t := keyfactory.HashTag(rsKey)
+		if t == "" || (tag != "" && t != tag) {
+			return false
+		}
+		tag = t
+	}
+	return true
+}
+
+// isSlotPattern returns whether all keys matching the Redis glob pattern have the same hash tag,
+// i.e. the pattern has a hash tag not preceded by or containing glob characters.
+func isSlotPattern(pattern string) bool {
+	tag := keyfactory.HashTag(pattern)
+	if tag == "" {
+		return false
+	}
+	end := strings.IndexByte(pattern, '{') + len(tag) + 1
+	return !strings.ContainsAny(pattern[:end], `*?[\`)
+}
+
+// scanNode returns the Redis client to scan the keys matching the pattern with a cursor.
+// In a cluster, the pattern must be hash-tagged, so all matching keys are on the same master.
+func (c *Client) scanNode(ctx context.Context, pattern string) (redis.Cmdable, error) {
+	cluster, ok := c.rsClient.(*redis.ClusterClient)
+	if !ok {
+		return c.rsClient, nil
+	}
+	if !isSlotPattern(pattern) {
+		return nil, errUntaggedClusterScan
+	}
+	return cluster.MasterForKey(ctx, pattern)
+}
+
+// forEachNode calls fn with each Redis client storing keys matching the pattern, i.e. with each
+// master of a cluster unless the pattern is hash-tagged. Calls may be concurrent, but fn is never
+// called concurrently with itself.
+func (c *Client) forEachNode(ctx context.Context, pattern string, fn func(ctx context.Context, rs redis.Cmdable) error) error {
+	cluster, ok := c.rsClient.(*redis.ClusterClient)
+	if !ok {
+		return fn(ctx, c.rsClient)
+	}
+	if isSlotPattern(pattern) {
+		node, err := cluster.MasterForKey(ctx, pattern)
+		if err != nil {
+			return err
+		}
+		return fn(ctx, node)
+	}
+	var mu sync.Mutex
+	return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return fn(ctx, node)
+	})
+}
+
+// scanClusterKeys retrieves the keys matching the key pattern on all masters of the cluster.
+// The returned keys may contain duplicates.
+func (c *Client) scanClusterKeys(ctx context.Context, keyMatch *keyfactory.Key) ([]*keyfactory.Key, error) {
+	rsKeys, err := c.scanPattern(ctx, c.redisKey(keyMatch))
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*keyfactory.Key, len(rsKeys))
+	for i, rsKey := range rsKeys {
+		key, err := c.parseRedisKey(rsKey)
+		if err != nil {
+			return nil, newOpError("scan", rsKey, err)
+		}
+		keys[i] = key
+	}
+	return keys, nil
+}
+
+// mget returns the values of the keys as MGET. In a cluster, where MGET fails across hash slots,
+// the keys are read with pipelined GETs instead.
+func mget(ctx context.Context, rs redis.UniversalClient, rsKeys []string) ([]interface{}, error) {
+	if _, ok := rs.(*redis.ClusterClient); !ok {
+		return rs.MGet(ctx, rsKeys...).Result()
+	}
+	cmds := make([]*redis.StringCmd, len(rsKeys))
+	_, err := rs.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, rsKey := range rsKeys {
+			cmds[i] = pipe.Get(ctx, rsKey)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	results := make([]interface{}, len(cmds))
+	for i, cmd := range cmds {
+		val, err := cmd.Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		results[i] = val
+	}
+	return results, nil
+}
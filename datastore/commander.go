@@ -0,0 +1,44 @@
+package datastore
+
+import (
+	"context"
+	"time"
+)
+
+// commander is the set of Redis commands issued by the client outside of pipelines, transactions,
+// and scripts. Its replies are plain Go values rather than the command types of a go-redis major
+// version, so the client only depends on a go-redis version through the adapter implementing it
+// (see v8Commander), e.g. to support go-redis v9 with another adapter.
+//
+// A reply of redis.Nil isn't an error of the commander, but a result, e.g. a SET with a mode that
+// didn't write, or an XREAD that timed out.
+type commander interface {
+	// set issues SET with the arguments, and returns whether the key was written, and the
+	// previous data of the key if args.get is true, or nil if the key didn't exist.
+	set(ctx context.Context, key string, value []byte, args setArgs) (bool, []byte, error)
+	// del issues DEL with the keys.
+	del(ctx context.Context, keys ...string) error
+	// exists returns whether the key exists.
+	exists(ctx context.Context, key string) (bool, error)
+	// pexpire issues PEXPIRE with the expiration, and the mode unless ExpireAlways, and returns
+	// whether the expiration was set.
+	pexpire(ctx context.Context, key string, expiration time.Duration, mode ExpireMode) (bool, error)
+	// zcard returns the number of members of the sorted set.
+	zcard(ctx context.Context, key string) (int64, error)
+	// zlexcount returns the number of members of the sorted set in the lexicographical range.
+	zlexcount(ctx context.Context, key, min, max string) (int64, error)
+	// zrangeByLex returns the members of the sorted set in the lexicographical range.
+	zrangeByLex(ctx context.Context, key, min, max string) ([]string, error)
+	// zrange returns all members of the sorted set ordered by score, reversed if reverse is true.
+	zrange(ctx context.Context, key string, reverse bool) ([]string, error)
+	// xread reads up to count entries of the stream after the entry ID, blocking for the block
+	// duration if non-negative. It returns no entries if the block duration expired.
+	xread(ctx context.Context, key, afterID string, count int64, block time.Duration) ([]LogEntry, error)
+}
+
+// setArgs are the arguments of a SET command.
+type setArgs struct {
+	ttl  time.Duration // Expiration, or 0 for none.
+	mode string        // Optional mode, "NX" or "XX".
+	get  bool          // Whether to return the previous data.
+}
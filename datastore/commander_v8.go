@@ -0,0 +1,101 @@
+package datastore
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// v8Commander is the commander of a go-redis v8 client.
+type v8Commander struct {
+	rs redis.UniversalClient
+}
+
+var _ commander = v8Commander{}
+
+func (c v8Commander) set(ctx context.Context, key string, value []byte, args setArgs) (bool, []byte, error) {
+	return setReply(c.rs.SetArgs(ctx, key, value, args.v8()), args)
+}
+
+func (c v8Commander) del(ctx context.Context, keys ...string) error {
+	return c.rs.Del(ctx, keys...).Err()
+}
+
+func (c v8Commander) exists(ctx context.Context, key string) (bool, error) {
+	n, err := c.rs.Exists(ctx, key).Result()
+	return n > 0, err
+}
+
+func (c v8Commander) pexpire(ctx context.Context, key string, expiration time.Duration, mode ExpireMode) (bool, error) {
+	return c.rs.Do(ctx, pexpireArgs(key, expiration, mode)...).Bool()
+}
+
+func (c v8Commander) zcard(ctx context.Context, key string) (int64, error) {
+	return c.rs.ZCard(ctx, key).Result()
+}
+
+func (c v8Commander) zlexcount(ctx context.Context, key, min, max string) (int64, error) {
+	return c.rs.ZLexCount(ctx, key, min, max).Result()
+}
+
+func (c v8Commander) zrangeByLex(ctx context.Context, key, min, max string) ([]string, error) {
+	return c.rs.ZRangeByLex(ctx, key, &redis.ZRangeBy{Min: min, Max: max}).Result()
+}
+
+func (c v8Commander) zrange(ctx context.Context, key string, reverse bool) ([]string, error) {
+	if reverse {
+		return c.rs.ZRevRange(ctx, key, 0, -1).Result()
+	}
+	return c.rs.ZRange(ctx, key, 0, -1).Result()
+}
+
+func (c v8Commander) xread(ctx context.Context, key, afterID string, count int64, block time.Duration) ([]LogEntry, error) {
+	args := &redis.XReadArgs{Streams: []string{key, afterID}, Count: count, Block: -1}
+	if block >= 0 {
+		args.Block = block
+	}
+	streams, err := c.rs.XRead(ctx, args).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil // No entries within the block duration.
+		}
+		return nil, err
+	}
+	var entries []LogEntry
+	for _, s := range streams {
+		for _, m := range s.Messages {
+			entries = append(entries, LogEntry{ID: m.ID, Values: m.Values})
+		}
+	}
+	return entries, nil
+}
+
+// v8 returns the go-redis v8 arguments of the SET command.
+func (a setArgs) v8() redis.SetArgs {
+	return redis.SetArgs{TTL: a.ttl, Mode: a.mode, Get: a.get}
+}
+
+// setReply returns the reply of a SET command issued with the arguments (see commander).
+func setReply(cmd *redis.StatusCmd, args setArgs) (bool, []byte, error) {
+	prev, err := cmd.Result()
+	if err != nil {
+		if err == redis.Nil {
+			return args.get, nil, nil // With GET, a key without previous data was written.
+		}
+		return false, nil, err
+	}
+	if !args.get {
+		return true, nil, nil // The reply is OK.
+	}
+	return true, []byte(prev), nil
+}
+
+// pexpireArgs returns the arguments of the PEXPIRE command with the expiration and mode.
+func pexpireArgs(key string, expiration time.Duration, mode ExpireMode) []interface{} {
+	args := []interface{}{"pexpire", key, expiration.Milliseconds()}
+	if mode != ExpireAlways {
+		args = append(args, string(mode))
+	}
+	return args
+}
@@ -0,0 +1,214 @@
+package datastore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+const (
+	ContentKeyPrefix     = "content"      // Key prefix of content blobs, followed by the content hash.
+	contentPointerPrefix = "\x00content:" // Prefix of content pointers, followed by the blob Redis key.
+)
+
+var (
+	errContentCluster    = errors.New("datastore: content-addressed storage isn't supported for clusters")
+	errContentExpiration = errors.New("datastore: content-addressed keys can't expire")
+)
+
+// releaseContent is the Lua function decrementing the reference count of the blob of a content
+// pointer, and deleting the blob when it's no longer referenced. Values that aren't content
+// pointers are ignored.
+const releaseContent = `
+local prefix = ARGV[1]
+local function release(ptr)
+	if ptr and string.sub(ptr, 1, #prefix) == prefix then
+		local blob = string.sub(ptr, #prefix + 1)
+		if redis.call("HINCRBY", blob, "refs", -1) <= 0 then
+			redis.call("DEL", blob)
+		end
+	end
+end
+`
+
+// putContentScript sets each entity key KEYS[2i-1] to a content pointer to its blob KEYS[2i],
+// storing the blob with the data ARGV[1+i] and a reference count, and releasing the blob the key
+// pointed to.
+var putContentScript = redis.NewScript(releaseContent + `
+for i = 1, #KEYS / 2 do
+	local key, blob = KEYS[2*i-1], KEYS[2*i]
+	local ptr = prefix .. blob
+	local existed = redis.call("EXISTS", blob) == 1
+	local old = redis.call("GET", key)
+	if old ~= ptr or not existed then
+		if not existed then
+			redis.call("HSET", blob, "data", ARGV[1+i])
+		end
+		redis.call("HINCRBY", blob, "refs", 1)
+		if old ~= ptr then
+			release(old)
+		end
+	end
+	redis.call("SET", key, ptr)
+end
+return 1
+`)
+
+// getContentScript returns the value of each key, where content pointers are resolved to the data
+// of their blobs. A pointer to a missing blob is returned as is.
+var getContentScript = redis.NewScript(`
+local prefix = ARGV[1]
+local values = {}
+for i, key in ipairs(KEYS) do
+	local v = redis.call("GET", key)
+	if v and string.sub(v, 1, #prefix) == prefix then
+		v = redis.call("HGET", string.sub(v, #prefix + 1), "data") or v
+	end
+	values[i] = v
+end
+return values
+`)
+
+// deleteContentScript deletes each key, releasing the blob of content pointers.
+// It returns 1 for each deleted key, otherwise 0.
+var deleteContentScript = redis.NewScript(releaseContent + `
+local deleted = {}
+for i, key in ipairs(KEYS) do
+	local old = redis.call("GET", key)
+	if old then
+		redis.call("DEL", key)
+		release(old)
+		deleted[i] = 1
+	else
+		deleted[i] = 0
+	end
+end
+return deleted
+`)
+
+// contentKey returns the Redis key of the blob of the data, in the namespace of the key.
+func (c *Client) contentKey(key *keyfactory.Key, data []byte) string {
+	sum := sha256.Sum256(data)
+	return c.redisKey(keyfactory.NewKey(ContentKeyPrefix+":"+hex.EncodeToString(sum[:]), key.Namespace()))
+}
+
+// PutContent is like Put, but stores the data content-addressed (see PutContentMulti).
+func (c *Client) PutContent(ctx context.Context, key *keyfactory.Key, data []byte, expiration time.Duration) error {
+	if key == nil {
+		return nil // No-op for empty key.
+	}
+	return c.PutContentMulti(ctx, []*keyfactory.Key{key}, [][]byte{data}, expiration)
+}
+
+// PutContentMulti is like PutMulti, but stores the data content-addressed, i.e. each distinct data
+// is stored once under its SHA-256 hash in the namespace of its key, with a reference count, and
+// the keys are set to pointers to the data. Data no longer referenced by any key is deleted when
+// its last key is overwritten by PutContentMulti, or deleted by DeleteContentAligned.
+//
+// Content-addressed keys can't expire, since an expired key can't release its reference, so the
+// expiration must be 0. They must be read with GetContentMultiAligned, and written, deleted, and
+// expired with the content methods only, otherwise the references of the replaced keys and their
+// data are leaked. Values written without the content methods are read as is.
+//
+// NOTE: Content-addressed storage isn't supported for clusters, since a key and its data are in
+// different hash slots.
+func (c *Client) PutContentMulti(
+	ctx context.Context,
+	keys []*keyfactory.Key,
+	data [][]byte,
+	expiration time.Duration,
+) error {
+	if len(keys) != len(data) {
+		return errors.New("datastore: key and data slices have different length")
+	}
+	if len(keys) == 0 {
+		return nil // No-op for empty batch.
+	}
+	if c.isCluster() {
+		return newOpError("put content", "", errContentCluster)
+	}
+	if expiration != 0 {
+		return newOpError("put content", "", errContentExpiration)
+	}
+	rsKeys := make([]string, 0, 2*len(keys))
+	args := make([]interface{}, 0, 1+len(keys))
+	args = append(args, contentPointerPrefix)
+	for i, key := range keys {
+		rsKeys = append(rsKeys, c.redisKey(key), c.contentKey(key, data[i]))
+		args = append(args, data[i])
+	}
+	if err := c.runScript(ctx, putContentScript, rsKeys, args...).Err(); err != nil {
+		return newOpError("put content", "", err)
+	}
+	return nil
+}
+
+// GetContentMultiAligned is like GetMultiAligned, but resolves content-addressed keys written by
+// PutContentMulti to their data. If a key is not found in the store its data is nil.
+// An error wrapping ErrCorruptedData is returned if the data of a key is missing.
+func (c *Client) GetContentMultiAligned(ctx context.Context, keys []*keyfactory.Key) ([][]byte, error) {
+	if len(keys) == 0 {
+		return nil, nil // No-op for empty slice of keys.
+	}
+	if c.isCluster() {
+		return nil, newOpError("get content", "", errContentCluster)
+	}
+	rsKeys := make([]string, len(keys))
+	for i, key := range keys {
+		rsKeys[i] = c.redisKey(key)
+	}
+	results, err := getContentScript.Run(ctx, c.rsClient, rsKeys, contentPointerPrefix).Slice()
+	if err != nil {
+		return nil, newOpError("get content", "", err)
+	}
+	dataSlice := make([][]byte, len(results))
+	for i, res := range results {
+		if res == nil {
+			continue // Key not found.
+		}
+		data, ok := res.(string)
+		if !ok || isContentPointer(data) {
+			err := newOpError("get content", rsKeys[i], fmt.Errorf("%w: missing or invalid content", ErrCorruptedData))
+			c.corruptionHandler(err)
+			return nil, err
+		}
+		dataSlice[i] = []byte(data)
+	}
+	return dataSlice, nil
+}
+
+// DeleteContentAligned is like DeleteAligned, but releases the data of content-addressed keys
+// written by PutContentMulti, deleting data no longer referenced.
+func (c *Client) DeleteContentAligned(ctx context.Context, keys []*keyfactory.Key) ([]bool, error) {
+	if len(keys) == 0 {
+		return nil, nil // No-op for empty keys.
+	}
+	if c.isCluster() {
+		return nil, newOpError("delete content", "", errContentCluster)
+	}
+	rsKeys := make([]string, len(keys))
+	for i, key := range keys {
+		rsKeys[i] = c.redisKey(key)
+	}
+	res, err := c.runScript(ctx, deleteContentScript, rsKeys, contentPointerPrefix).Int64Slice()
+	if err != nil {
+		return nil, newOpError("delete content", "", err)
+	}
+	deleted := make([]bool, len(res))
+	for i, r := range res {
+		deleted[i] = r == 1
+	}
+	return deleted, nil
+}
+
+// isContentPointer returns whether the value is a content pointer written by PutContentMulti.
+func isContentPointer(value string) bool {
+	return strings.HasPrefix(value, contentPointerPrefix)
+}
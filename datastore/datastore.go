@@ -12,27 +12,93 @@ import (
 	"github.com/holmberd/go-entitystore/keyfactory"
 )
 
-var (
-	ErrKeyNotFound = errors.New("datastore: key not found")
+const (
+	DefaultMaxPageSize = 1000 // Default max number of keys returned per page by GetKeysWithCursor.
+	DefaultScanCount   = 1000 // Default number of keys requested per SCAN iteration by full scans.
 )
 
 // Client represents a datastore client for interacting with a datastore.
 // The client is safe for concurrent use.
+//
+// Reads and writes are served by the Redis client's server, and writes are applied synchronously,
+// so a read observes the client's own completed writes. Hedged reads (see WithHedgedReads) may be
+// served by a lagging replica, unless the context is a session that wrote (see WithSession).
 type Client struct {
-	rsClient *redis.Client
+	rsClient          redis.UniversalClient
+	ownsRSClient      bool   // Whether the Redis client was created by and must be closed by the client.
+	keyPrefix         string // Optional global key prefix applied to all keys.
+	namespace         string // Optional namespace applied to keys without a namespace.
+	maxPageSize       int    // Max number of keys returned per page.
+	scanCount         int    // SCAN COUNT hint used by full scans.
+	corruptionHandler CorruptionHandler
+	hedgeClient       *redis.Client // Optional replica client for hedged reads.
+	hedgeDelay        time.Duration // Delay before a read is hedged.
+	qos               *qosHook      // Optional prioritization of foreground traffic.
+	commands          commander     // Commands of the Redis client issued outside of pipelines, transactions, and scripts.
+}
+
+// NewClient creates a new instance of a Client with a Redis client, e.g. a *redis.Client, or a
+// *redis.ClusterClient for Redis Cluster.
+//
+// In Redis Cluster, multi-key commands fail unless all keys are in the same hash slot. Multi-key
+// reads and writes, e.g. GetMulti, PutMulti, and Delete, are split into single-key commands, but
+// transactions and scripts, e.g. DeleteAlignedTx and CompareAndSwapMulti, require keys of the same
+// slot, e.g. entity keys of one parent laid out by keyfactory.HashTaggedKeyStrategy. Cursor scans,
+// e.g. GetKeysWithCursor, require a hash-tagged key pattern, while full scans scan all masters.
+// Options replacing the Redis client, e.g. WithDB and WithTLS, aren't supported for clusters.
+func NewClient(rsClient redis.UniversalClient, opts ...ClientOption) (*Client, error) {
+	return newClient(rsClient, false, opts)
+}
+
+// newClient creates a new instance of a Client, which closes the Redis client if it owns it.
+// If an option fails, any Redis client owned by the client is closed.
+func newClient(rsClient redis.UniversalClient, owned bool, opts []ClientOption) (*Client, error) {
+	c := &Client{
+		rsClient:          rsClient,
+		ownsRSClient:      owned,
+		maxPageSize:       DefaultMaxPageSize,
+		scanCount:         DefaultScanCount,
+		corruptionHandler: logCorruption,
+	}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+	}
+	// After all options, since options may replace the Redis client.
+	c.commands = v8Commander{rs: c.rsClient}
+	if c.qos != nil {
+		c.rsClient.AddHook(c.qos)
+	}
+	if c.hedgeClient != nil {
+		c.rsClient.AddHook(sessionHook{})
+	}
+	return c, nil
 }
 
-// NewClient creates a new instance of a Client.
-func NewClient(rsClient *redis.Client) (*Client, error) {
-	return &Client{
-		rsClient: rsClient,
-	}, nil
+// Close closes the underlying Redis client if it was created by the client, e.g. by WithDB.
+// A Redis client provided to NewClient is owned and closed by the caller.
+func (c *Client) Close() error {
+	if !c.ownsRSClient {
+		return nil
+	}
+	return c.rsClient.Close()
 }
 
-// GetRSClient returns the underlying Redis client.
+// GetRSClient returns the underlying Redis client, or nil if the client is connected to a cluster
+// (see GetUniversalClient).
 //
 // NOTE: This is an escape mechanism and should not be abused.
 func (c *Client) GetRSClient() *redis.Client {
+	rs, _ := c.rsClient.(*redis.Client)
+	return rs
+}
+
+// GetUniversalClient returns the underlying Redis client, e.g. a *redis.ClusterClient.
+//
+// NOTE: This is an escape mechanism and should not be abused.
+func (c *Client) GetUniversalClient() redis.UniversalClient {
 	return c.rsClient
 }
 
@@ -47,13 +113,97 @@ func (c *Client) Put(
 	if key == nil {
 		return nil // No-op for empty key.
 	}
-	err := c.rsClient.Set(ctx, key.RedisKey(), data, expiration).Err()
+	rsKey := c.redisKey(key)
+	if _, ok := syncReplicationFromContext(ctx); ok {
+		return c.execWrite(ctx, "put", rsKey, func(pipe redis.Pipeliner) {
+			pipe.Set(ctx, rsKey, data, expiration)
+		})
+	}
+	_, _, err := c.commands.set(ctx, rsKey, data, setArgs{ttl: expiration})
 	if err != nil {
-		return fmt.Errorf("datastore: failed to write key '%s': %w", key, err)
+		return newOpError("put", rsKey, err)
 	}
 	return nil
 }
 
+// PutIfExists is like Put, but only updates the data of an existing key.
+// It returns whether the key existed and was updated.
+func (c *Client) PutIfExists(
+	ctx context.Context,
+	key *keyfactory.Key,
+	data []byte,
+	expiration time.Duration,
+) (bool, error) {
+	return c.putMode(ctx, "put if exists", key, data, expiration, "XX")
+}
+
+// PutIfAbsent is like Put, but only adds the data of a key that doesn't exist.
+// It returns whether the key didn't exist and was added.
+func (c *Client) PutIfAbsent(
+	ctx context.Context,
+	key *keyfactory.Key,
+	data []byte,
+	expiration time.Duration,
+) (bool, error) {
+	return c.putMode(ctx, "put if absent", key, data, expiration, "NX")
+}
+
+// putMode writes the data with the key with the SET mode (NX or XX), and returns whether it was written.
+func (c *Client) putMode(
+	ctx context.Context,
+	op string,
+	key *keyfactory.Key,
+	data []byte,
+	expiration time.Duration,
+	mode string,
+) (bool, error) {
+	if key == nil {
+		return false, nil // No-op for empty key.
+	}
+	rsKey := c.redisKey(key)
+	written, _, err := c.set(ctx, op, rsKey, data, setArgs{ttl: expiration, mode: mode})
+	return written, err
+}
+
+// PutAndGet is like Put, but atomically returns the data previously associated with the key.
+// If the key didn't exist the returned data is nil.
+func (c *Client) PutAndGet(
+	ctx context.Context,
+	key *keyfactory.Key,
+	data []byte,
+	expiration time.Duration,
+) ([]byte, error) {
+	if key == nil {
+		return nil, nil // No-op for empty key.
+	}
+	_, prev, err := c.set(ctx, "put and get", c.redisKey(key), data, setArgs{ttl: expiration, get: true})
+	return prev, err
+}
+
+// set issues SET with the arguments, replicated synchronously if requested by the context,
+// and returns the reply (see commander).
+func (c *Client) set(ctx context.Context, op string, rsKey string, data []byte, args setArgs) (bool, []byte, error) {
+	if _, ok := syncReplicationFromContext(ctx); !ok {
+		written, prev, err := c.commands.set(ctx, rsKey, data, args)
+		if err != nil {
+			return false, nil, newOpError(op, rsKey, err)
+		}
+		return written, prev, nil
+	}
+	var cmd *redis.StatusCmd
+	err := c.execWrite(ctx, op, rsKey, func(pipe redis.Pipeliner) {
+		cmd = pipe.SetArgs(ctx, rsKey, data, args.v8())
+	})
+	if err != nil {
+		return false, nil, err
+	}
+	written, prev, err := setReply(cmd, args)
+	if err != nil {
+		return false, nil, newOpError(op, rsKey, err)
+	}
+	return written, prev, nil
+}
+
 // PutMulti is a batch version of Put.
 func (c *Client) PutMulti(
 	ctx context.Context,
@@ -71,23 +221,63 @@ func (c *Client) PutMulti(
 	// Use a map to store key-value pairs as expected by redis MSet.
 	kvPairs := make(map[string]interface{}, len(keys))
 	for i, key := range keys {
-		kvPairs[key.RedisKey()] = data[i]
+		kvPairs[c.redisKey(key)] = data[i]
 	}
 
-	pipe := c.rsClient.Pipeline()
-	if err := pipe.MSet(ctx, kvPairs).Err(); err != nil {
-		return fmt.Errorf("datastore: %w", err)
-	}
-	if expiration != 0 {
-		// Set TTL per key.
-		for key := range kvPairs {
-			if err := pipe.Expire(ctx, key, expiration).Err(); err != nil {
-				return fmt.Errorf("datastore: %w", err)
+	return c.execWrite(ctx, "put multi", "", func(pipe redis.Pipeliner) {
+		if c.isCluster() {
+			for key, value := range kvPairs {
+				pipe.Set(ctx, key, value, expiration) // MSET fails across hash slots.
+			}
+			return
+		}
+		pipe.MSet(ctx, kvPairs)
+		if expiration != 0 {
+			// Set TTL per key.
+			for key := range kvPairs {
+				pipe.Expire(ctx, key, expiration)
 			}
 		}
+	})
+}
+
+// PutMultiAtomic is like PutMulti, but writes the keys atomically with a single MSET, so readers
+// never see some of the keys written without the others. In Redis Cluster, all keys must have the
+// same hash tag, e.g. entity keys of one parent laid out by keyfactory.HashTaggedKeyStrategy,
+// otherwise an error wrapping ErrInvalidKey is returned.
+func (c *Client) PutMultiAtomic(
+	ctx context.Context,
+	keys []*keyfactory.Key,
+	data [][]byte,
+	expiration time.Duration,
+) error {
+	if len(keys) != len(data) {
+		return errors.New("datastore: key and data slices have different length")
 	}
-	if _, err := pipe.Exec(ctx); err != nil {
-		return fmt.Errorf("datastore: failed to write keys: %w", err)
+	if len(keys) == 0 {
+		return nil // No-op for empty batch.
+	}
+	kvPairs := make(map[string]interface{}, len(keys))
+	for i, key := range keys {
+		kvPairs[c.redisKey(key)] = data[i]
+	}
+	if c.isCluster() && !sameHashTag(kvPairs) {
+		return newOpError("put multi atomic", "", fmt.Errorf("%w: keys of an atomic write must have the same hash tag in a cluster", ErrInvalidKey))
+	}
+	if expiration == 0 {
+		return c.execWrite(ctx, "put multi atomic", "", func(pipe redis.Pipeliner) {
+			pipe.MSet(ctx, kvPairs)
+		})
+	}
+	_, err := c.txPipelined(ctx, c.redisKey(keys[0]), func(pipe redis.Pipeliner) error {
+		pipe.MSet(ctx, kvPairs)
+		for key := range kvPairs {
+			pipe.PExpire(ctx, key, expiration) // Expire in the same transaction as the MSET.
+		}
+		return nil
+	})
+	if err != nil {
+		return newOpError("put multi atomic", "", err)
 	}
 	return nil
 }
@@ -99,14 +289,72 @@ func (c *Client) Delete(ctx context.Context, keys ...*keyfactory.Key) error {
 	}
 	rsKeys := make([]string, len(keys))
 	for i, key := range keys {
-		rsKeys[i] = key.RedisKey()
+		rsKeys[i] = c.redisKey(key)
 	}
-	if err := c.rsClient.Del(ctx, rsKeys...).Err(); err != nil {
-		return fmt.Errorf("datastore: failed to delete keys from redis: %w", err)
+	if _, ok := syncReplicationFromContext(ctx); ok || (c.isCluster() && len(rsKeys) > 1) {
+		return c.execWrite(ctx, "delete", "", func(pipe redis.Pipeliner) {
+			if !c.isCluster() {
+				pipe.Del(ctx, rsKeys...)
+				return
+			}
+			for _, rsKey := range rsKeys {
+				pipe.Del(ctx, rsKey) // DEL fails across hash slots.
+			}
+		})
+	}
+	if err := c.commands.del(ctx, rsKeys...); err != nil {
+		return newOpError("delete", "", err)
 	}
 	return nil
 }
 
+// DeleteAligned is like Delete, but returns whether each key was deleted, aligned with the keys.
+// A key not found in the store isn't deleted.
+func (c *Client) DeleteAligned(ctx context.Context, keys []*keyfactory.Key) ([]bool, error) {
+	if len(keys) == 0 {
+		return nil, nil // No-op for empty keys.
+	}
+	cmds := make([]*redis.IntCmd, len(keys))
+	err := c.execWrite(ctx, "delete", "", func(pipe redis.Pipeliner) {
+		for i, key := range keys {
+			cmds[i] = pipe.Del(ctx, c.redisKey(key))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	deleted := make([]bool, len(keys))
+	for i, cmd := range cmds {
+		deleted[i] = cmd.Val() > 0
+	}
+	return deleted, nil
+}
+
+// DeleteAlignedTx is like DeleteAligned, but deletes the keys atomically in a transaction.
+func (c *Client) DeleteAlignedTx(ctx context.Context, keys []*keyfactory.Key) ([]bool, error) {
+	if len(keys) == 0 {
+		return nil, nil // No-op for empty keys.
+	}
+	cmds := make([]*redis.IntCmd, len(keys))
+	applied, err := c.txPipelined(ctx, c.redisKey(keys[0]), func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.Del(ctx, c.redisKey(key))
+		}
+		return nil
+	})
+	if !applied {
+		return nil, newOpError("delete tx", "", err)
+	}
+	if err != nil {
+		err = newOpError("delete tx", "", err) // Deleted if only the replication failed.
+	}
+	deleted := make([]bool, len(keys))
+	for i, cmd := range cmds {
+		deleted[i] = cmd.Val() > 0
+	}
+	return deleted, err
+}
+
 // DeleteMatch deletes all keys matching the key pattern.
 //
 // NOTE: This is a blocking operation.
@@ -125,17 +373,20 @@ func (c *Client) DeleteMatch(ctx context.Context, keyMatch *keyfactory.Key) erro
 }
 
 // Get retrieves the data associated with the key from the store.
-// ErrKeyNotFound is returned if the key is not found in the store.
+// An error wrapping ErrKeyNotFound is returned if the key is not found in the store.
 func (c *Client) Get(ctx context.Context, key *keyfactory.Key) ([]byte, error) {
 	if key == nil {
 		return nil, nil // No-op for empty key.
 	}
-	data, err := c.rsClient.Get(ctx, key.RedisKey()).Bytes()
+	rsKey := c.redisKey(key)
+	data, err := hedgedRead(ctx, c, func(ctx context.Context, rs redis.UniversalClient) ([]byte, error) {
+		return rs.Get(ctx, rsKey).Bytes()
+	})
 	if err != nil {
 		if err == redis.Nil {
-			return nil, ErrKeyNotFound
+			return nil, newOpError("get", rsKey, ErrKeyNotFound)
 		}
-		return nil, fmt.Errorf("datastore: %w", err)
+		return nil, newOpError("get", rsKey, err)
 	}
 	return data, nil
 }
@@ -143,32 +394,57 @@ func (c *Client) Get(ctx context.Context, key *keyfactory.Key) ([]byte, error) {
 // GetMulti retrieves data by their associated keys from the store.
 // If the key is not found in the store it is ignored and not included in the returned data slice.
 func (c *Client) GetMulti(ctx context.Context, keys []*keyfactory.Key) ([][]byte, error) {
+	return c.getMulti(ctx, keys, false)
+}
+
+// GetMultiAligned is like GetMulti, but the returned data slice is aligned with the keys.
+// If a key is not found in the store its data is nil.
+func (c *Client) GetMultiAligned(ctx context.Context, keys []*keyfactory.Key) ([][]byte, error) {
+	return c.getMulti(ctx, keys, true)
+}
+
+func (c *Client) getMulti(ctx context.Context, keys []*keyfactory.Key, aligned bool) ([][]byte, error) {
 	if len(keys) == 0 {
 		return nil, nil // No-op for empty slice of keys.
 	}
 	rsKeys := make([]string, len(keys))
 	for i, key := range keys {
-		rsKeys[i] = key.RedisKey()
+		rsKeys[i] = c.redisKey(key)
 	}
-	results, err := c.rsClient.MGet(ctx, rsKeys...).Result()
+	results, err := hedgedRead(ctx, c, func(ctx context.Context, rs redis.UniversalClient) ([]interface{}, error) {
+		return mget(ctx, rs, rsKeys)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("datastore: failed to retrieve keys: %w", err)
+		return nil, newOpError("get multi", "", err)
 	}
 	dataSlice := make([][]byte, 0, len(results))
-	for _, res := range results {
+	for i, res := range results {
 		if res == nil {
+			if aligned {
+				dataSlice = append(dataSlice, nil)
+			}
 			continue // Key not found; skip it.
 		}
 		// Convert result to expected redis string before converting to byte array.
 		data, ok := res.(string)
 		if !ok {
 			// This should never occur since MGET should fail and return a command-level error.
-			panic(fmt.Sprintf("datastore: unexpected type %T in redis MGET result", res))
+			err := newOpError(
+				"get multi",
+				rsKeys[i],
+				fmt.Errorf("%w: unexpected type %T in redis MGET result", ErrCorruptedData, res),
+			)
+			c.corruptionHandler(err)
+			return nil, err
 		}
 		// Optimzation: Since '[]byte(data)' result in copying the data string.
 		// Instead we unsafe convert the string to []byte without copying.
 		// Only safe if the caller does not modify the byte slice which now points to
 		// an immutable string memory address.
+		if aligned && len(data) == 0 {
+			dataSlice = append(dataSlice, []byte{}) // Distinguish empty values from missing keys.
+			continue
+		}
 		dataSlice = append(dataSlice, unsafe.Slice(unsafe.StringData(data), len(data)))
 	}
 	return dataSlice, nil
@@ -184,29 +460,43 @@ func (c *Client) GetKeysWithCursor(
 	limit int,
 	keyMatch *keyfactory.Key,
 ) (keys []*keyfactory.Key, nextCursor uint64, err error) {
-	if limit <= 0 || limit > 1000 {
-		limit = 1000
+	if limit <= 0 || limit > c.maxPageSize {
+		limit = c.maxPageSize
 	}
+	return c.scanKeys(ctx, cursor, limit, keyMatch)
+}
 
+// scanKeys retrieves matching keys for a single SCAN iteration with the COUNT hint.
+func (c *Client) scanKeys(
+	ctx context.Context,
+	cursor uint64,
+	count int,
+	keyMatch *keyfactory.Key,
+) (keys []*keyfactory.Key, nextCursor uint64, err error) {
 	// The Redis SCAN command only offer limited guarantees about the exact number of keys per call.
 	// As a result, the exact batch size in each iteration is not guranteed.
-	rsKeys, nextCursor, err := c.rsClient.Scan(
+	pattern := c.redisKey(keyMatch)
+	node, err := c.scanNode(ctx, pattern)
+	if err != nil {
+		return nil, 0, newOpError("scan", pattern, err)
+	}
+	rsKeys, nextCursor, err := node.Scan(
 		ctx,
 		cursor,
-		keyMatch.RedisKey(),
-		int64(limit),
+		pattern,
+		int64(count),
 	).Result()
 	if err != nil {
-		return nil, 0, fmt.Errorf("datastore: failed scanning redis for keys: %w", err)
+		return nil, 0, newOpError("scan", pattern, err)
 	}
 
 	// Parse and convert redis keys to keys.
 	keys = make([]*keyfactory.Key, len(rsKeys))
 	var key *keyfactory.Key
 	for i, rsKey := range rsKeys {
-		key, err = keyfactory.ParseRedisKey(rsKey)
+		key, err = c.parseRedisKey(rsKey)
 		if err != nil {
-			return nil, 0, fmt.Errorf("datastore: failed to parse redis key: %w", err)
+			return nil, 0, newOpError("scan", rsKey, err)
 		}
 		keys[i] = key
 	}
@@ -216,19 +506,9 @@ func (c *Client) GetKeysWithCursor(
 // ScanKeys retrieves all matching keys as a non-blocking operation.
 // Safe for production use, but may miss keys added/removed during iteration.
 func (c *Client) ScanKeys(ctx context.Context, keyMatch *keyfactory.Key) ([]*keyfactory.Key, error) {
-	cursor := uint64(0)
-	limit := 1000 // Max limit.
-	var allKeys []*keyfactory.Key
-	for {
-		keys, nextCursor, err := c.GetKeysWithCursor(ctx, cursor, limit, keyMatch)
-		if err != nil {
-			return nil, fmt.Errorf("datastore: %w", err)
-		}
-		allKeys = append(allKeys, keys...)
-		if nextCursor == 0 {
-			break
-		}
-		cursor = nextCursor
+	allKeys, err := c.scanAllKeys(ctx, keyMatch)
+	if err != nil {
+		return nil, err
 	}
 
 	// Remove any potential duplicate keys returned during the scan.
@@ -243,37 +523,284 @@ func (c *Client) ScanKeys(ctx context.Context, keyMatch *keyfactory.Key) ([]*key
 	return keys, nil
 }
 
+// scanAllKeys retrieves all matching keys using SCAN, where the keys may contain duplicates.
+func (c *Client) scanAllKeys(ctx context.Context, keyMatch *keyfactory.Key) ([]*keyfactory.Key, error) {
+	if c.isCluster() && !isSlotPattern(c.redisKey(keyMatch)) {
+		return c.scanClusterKeys(ctx, keyMatch)
+	}
+	cursor := uint64(0)
+	var allKeys []*keyfactory.Key
+	for {
+		keys, nextCursor, err := c.scanKeys(ctx, cursor, c.scanCount, keyMatch)
+		if err != nil {
+			return nil, err
+		}
+		allKeys = append(allKeys, keys...)
+		if nextCursor == 0 {
+			return allKeys, nil
+		}
+		cursor = nextCursor
+	}
+}
+
 // GetKeys retrieves all matching keys.
 //
 // NOTE: This is a blocking operation.
 func (c *Client) GetKeys(ctx context.Context, keyMatch *keyfactory.Key) ([]*keyfactory.Key, error) {
-	rsKeys, err := c.rsClient.Keys(ctx, keyMatch.RedisKey()).Result()
+	pattern := c.redisKey(keyMatch)
+	var rsKeys []string
+	err := c.forEachNode(ctx, pattern, func(ctx context.Context, rs redis.Cmdable) error {
+		nodeKeys, err := rs.Keys(ctx, pattern).Result()
+		rsKeys = append(rsKeys, nodeKeys...)
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("datastore: failed to retrieve keys from redis: %w", err)
+		return nil, newOpError("keys", pattern, err)
 	}
 
 	// Parse and convert redis keys to keys.
 	keys := make([]*keyfactory.Key, len(rsKeys))
 	var key *keyfactory.Key
 	for i, rsKey := range rsKeys {
-		key, err = keyfactory.ParseRedisKey(rsKey)
+		key, err = c.parseRedisKey(rsKey)
 		if err != nil {
-			return nil, fmt.Errorf("datastore: failed to parse redis key: %w", err)
+			return nil, newOpError("keys", rsKey, err)
 		}
 		keys[i] = key
 	}
 	return keys, nil
 }
 
+// Rename renames the key to the new key, overwriting any existing value of the new key.
+// An error wrapping ErrKeyNotFound is returned if the key is not found in the store.
+func (c *Client) Rename(ctx context.Context, key *keyfactory.Key, newKey *keyfactory.Key) error {
+	if key == nil || newKey == nil {
+		return nil // No-op for empty keys.
+	}
+	rsKey := c.redisKey(key)
+	var cmd *redis.StatusCmd
+	err := c.pipelineWrite(ctx, func(pipe redis.Pipeliner) {
+		cmd = pipe.Rename(ctx, rsKey, c.redisKey(newKey))
+	})
+	if err := cmd.Err(); err != nil {
+		if err.Error() == "ERR no such key" {
+			return newOpError("rename", rsKey, ErrKeyNotFound)
+		}
+		return newOpError("rename", rsKey, err)
+	}
+	if err != nil {
+		return newOpError("rename", rsKey, err)
+	}
+	return nil
+}
+
 // Exists checks whether the key exist in the store.
 func (c *Client) Exists(ctx context.Context, key *keyfactory.Key) (bool, error) {
 	if key == nil {
 		return false, nil // No-op for empty key.
 	}
-	exists, err := c.rsClient.Exists(ctx, key.RedisKey()).Result()
+	rsKey := c.redisKey(key)
+	exists, err := c.commands.exists(ctx, rsKey)
+	if err != nil {
+		return false, newOpError("exists", rsKey, err)
+	}
+	return exists, nil
+}
+
+// maxTxRetries is the max number of attempts of an optimistic transaction on conflicting writes.
+const maxTxRetries = 3
+
+// DeleteIf atomically deletes the key if the condition returns true for its current data.
+// The key is watched while the condition is evaluated, and the check is retried if the key is
+// modified concurrently. An error wrapping ErrVersionConflict is returned if the key keeps changing.
+// It returns whether the key was deleted; a key not found in the store isn't deleted. A deleted key
+// is also reported if the delete then failed sync replication (see WithSyncReplication).
+func (c *Client) DeleteIf(
+	ctx context.Context,
+	key *keyfactory.Key,
+	cond func(data []byte) (bool, error),
+) (bool, error) {
+	if key == nil {
+		return false, nil // No-op for empty key.
+	}
+	rsKey := c.redisKey(key)
+	var deleted bool
+	txf := func(tx *redis.Tx) error {
+		deleted = false
+		data, err := tx.Get(ctx, rsKey).Bytes()
+		if err != nil {
+			if err == redis.Nil {
+				return nil // Nothing to delete.
+			}
+			return err
+		}
+		ok, err := cond(data)
+		if err != nil || !ok {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, rsKey)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		deleted = true
+		return awaitReplicas(ctx, tx)
+	}
+	var err error
+	for attempt := 0; attempt < maxTxRetries; attempt++ {
+		if err = c.rsClient.Watch(ctx, txf, rsKey); err != redis.TxFailedErr {
+			break
+		}
+	}
+	if err != nil {
+		return deleted, newOpError("delete if", rsKey, err) // Deleted if only the replication failed.
+	}
+	return deleted, nil
+}
+
+// Modify atomically replaces the data of the key with the data returned by fn for its current data,
+// keeping the key's expiration. The key is watched while fn runs, and fn is run again with the
+// current data if the key is modified concurrently, up to attempts times in total. An error wrapping
+// ErrVersionConflict is returned if the key keeps changing, and an error wrapping ErrKeyNotFound
+// if the key doesn't exist. If fn returns nil data, the key is left unchanged.
+// It returns the data written, or nil if the key was left unchanged. The written data is also
+// returned if the write then failed sync replication (see WithSyncReplication).
+func (c *Client) Modify(
+	ctx context.Context,
+	key *keyfactory.Key,
+	attempts int,
+	fn func(data []byte) ([]byte, error),
+) ([]byte, error) {
+	if key == nil {
+		return nil, nil // No-op for empty key.
+	}
+	rsKey := c.redisKey(key)
+	var written []byte
+	txf := func(tx *redis.Tx) error {
+		written = nil
+		data, err := tx.Get(ctx, rsKey).Bytes()
+		if err != nil {
+			if err == redis.Nil {
+				return ErrKeyNotFound
+			}
+			return err
+		}
+		modified, err := fn(data)
+		if err != nil || modified == nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.SetArgs(ctx, rsKey, modified, redis.SetArgs{KeepTTL: true})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		written = modified
+		return awaitReplicas(ctx, tx)
+	}
+	var err error
+	for attempt := 0; attempt < max(attempts, 1); attempt++ {
+		if err = c.rsClient.Watch(ctx, txf, rsKey); err != redis.TxFailedErr {
+			break
+		}
+	}
+	if err != nil {
+		return written, newOpError("modify", rsKey, err) // Written if only the replication failed.
+	}
+	return written, nil
+}
+
+// compareAndSwapScript sets each key to its new value, keeping its TTL, if the current value
+// equals the expected value. ARGV holds the expected and new value of each key in turn, where
+// an unconditional set of existing keys is flagged by ARGV[1] == "0". It returns 1 for each
+// swapped key, otherwise 0.
+var compareAndSwapScript = redis.NewScript(`
+local conditional = ARGV[1] == "1"
+local swapped = {}
+for i, key in ipairs(KEYS) do
+	local expected, value = ARGV[2*i], ARGV[2*i+1]
+	local current = redis.call("GET", key)
+	if current and (not conditional or current == expected) then
+		redis.call("SET", key, value, "KEEPTTL")
+		swapped[i] = 1
+	else
+		swapped[i] = 0
+	end
+end
+return swapped
+`)
+
+// CompareAndSwapMulti atomically sets each key to its data if the key's current data equals its
+// expected data, keeping the key's expiration. If expected is nil, all existing keys are set
+// unconditionally. It returns which keys were swapped; a key not found in the store is never
+// swapped, so keys deleted concurrently aren't recreated.
+func (c *Client) CompareAndSwapMulti(
+	ctx context.Context,
+	keys []*keyfactory.Key,
+	expected [][]byte,
+	data [][]byte,
+) ([]bool, error) {
+	if len(keys) != len(data) || (expected != nil && len(keys) != len(expected)) {
+		return nil, errors.New("datastore: key and data slices have different length")
+	}
+	if len(keys) == 0 {
+		return nil, nil // No-op for empty batch.
+	}
+	rsKeys := make([]string, len(keys))
+	args := make([]interface{}, 0, 1+2*len(keys))
+	if expected != nil {
+		args = append(args, "1")
+	} else {
+		args = append(args, "0")
+	}
+	for i, key := range keys {
+		rsKeys[i] = c.redisKey(key)
+		var exp []byte
+		if expected != nil {
+			exp = expected[i]
+		}
+		args = append(args, exp, data[i])
+	}
+	res, err := c.runScript(ctx, compareAndSwapScript, rsKeys, args...).Int64Slice()
+	if err != nil {
+		return nil, newOpError("compare and swap", "", err)
+	}
+	swapped := make([]bool, len(res))
+	for i, r := range res {
+		swapped[i] = r == 1
+	}
+	return swapped, nil
+}
+
+// compareAndSwapOneScript sets KEYS[1] to ARGV[3], keeping its TTL, if its current value equals
+// ARGV[2], or if it doesn't exist when flagged by ARGV[1] == "0". It returns 1 if swapped, otherwise 0.
+var compareAndSwapOneScript = redis.NewScript(`
+local v = redis.call("GET", KEYS[1])
+if (ARGV[1] == "0" and not v) or (ARGV[1] == "1" and v == ARGV[2]) then
+	redis.call("SET", KEYS[1], ARGV[3], "KEEPTTL")
+	return 1
+end
+return 0
+`)
+
+// CompareAndSwap atomically sets the key to the data if the key's current data equals the expected
+// data, keeping the key's expiration. If expected is nil, the key is only set if it doesn't exist.
+// It returns whether the key was swapped.
+func (c *Client) CompareAndSwap(ctx context.Context, key *keyfactory.Key, expected []byte, data []byte) (bool, error) {
+	if key == nil {
+		return false, nil // No-op for empty key.
+	}
+	rsKey := c.redisKey(key)
+	conditional := "0"
+	if expected != nil {
+		conditional = "1"
+	}
+	res, err := c.runScript(ctx, compareAndSwapOneScript, []string{rsKey}, conditional, expected, data).Int64()
 	if err != nil {
-		return false, fmt.Errorf("datastore: %w", err)
+		return false, newOpError("compare and swap", rsKey, err)
 	}
-	// Convert int64 to bool (1 = true, 0 = false).
-	return exists > 0, nil
+	return res == 1, nil
 }
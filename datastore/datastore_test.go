@@ -2,9 +2,21 @@ package datastore
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/go-redis/redis/v8"
 	"github.com/holmberd/go-entitystore/keyfactory"
 	"github.com/holmberd/go-entitystore/testutil"
@@ -62,6 +74,20 @@ func TestDatastoreClient(t *testing.T) {
 		assert.Equal(t, data, got)
 	})
 
+	t.Run("Get non-existent key", func(t *testing.T) {
+		ds, ctx, kb := setupDSClient(t, rsClient)
+		kb.WithKey("missing")
+		key, err := kb.Build()
+		require.NoError(t, err)
+
+		_, err = ds.Get(ctx, key)
+		assert.ErrorIs(t, err, ErrKeyNotFound)
+		var opErr *OpError
+		require.ErrorAs(t, err, &opErr)
+		assert.Equal(t, "get", opErr.Op)
+		assert.Equal(t, key.RedisKey(), opErr.Key)
+	})
+
 	t.Run("PutMulti and GetMulti", func(t *testing.T) {
 		keyPrefix := "item"
 		numKeys := 3
@@ -86,6 +112,23 @@ func TestDatastoreClient(t *testing.T) {
 		assert.Equal(t, data[2], got[2])
 	})
 
+	t.Run("GetMultiAligned", func(t *testing.T) {
+		ds, ctx, kb := setupDSClient(t, rsClient)
+		kb.WithKey("found")
+		found, err := kb.BuildAndReset()
+		require.NoError(t, err)
+		kb.WithKey("missing")
+		missing, err := kb.BuildAndReset()
+		require.NoError(t, err)
+		require.NoError(t, ds.Put(ctx, found, []byte("value"), 0))
+
+		got, err := ds.GetMultiAligned(ctx, []*keyfactory.Key{missing, found})
+		assert.NoError(t, err)
+		require.Len(t, got, 2)
+		assert.Nil(t, got[0], "should return nil data for missing key")
+		assert.Equal(t, []byte("value"), got[1])
+	})
+
 	t.Run("Delete and Exists", func(t *testing.T) {
 		ds, ctx, kb := setupDSClient(t, rsClient)
 		kb.WithKey("to-delete")
@@ -103,6 +146,26 @@ func TestDatastoreClient(t *testing.T) {
 		assert.False(t, exists)
 	})
 
+	t.Run("Rename", func(t *testing.T) {
+		ds, ctx, kb := setupDSClient(t, rsClient)
+		kb.WithKey("from")
+		from, err := kb.BuildAndReset()
+		require.NoError(t, err)
+		kb.WithKey("to")
+		to, err := kb.BuildAndReset()
+		require.NoError(t, err)
+
+		assert.ErrorIs(t, ds.Rename(ctx, from, to), ErrKeyNotFound)
+		require.NoError(t, ds.Put(ctx, from, []byte("value"), 0))
+		assert.NoError(t, ds.Rename(ctx, from, to))
+		got, err := ds.Get(ctx, to)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("value"), got)
+		exists, err := ds.Exists(ctx, from)
+		assert.NoError(t, err)
+		assert.False(t, exists)
+	})
+
 	t.Run("DeleteMulti", func(t *testing.T) {
 		parentKey := "delete"
 		numKeys := 3
@@ -262,3 +325,1300 @@ func TestDatastoreClient(t *testing.T) {
 		require.Len(t, foundKeys, numKeys)
 	})
 }
+
+func TestDatastoreClientErrors(t *testing.T) {
+	t.Run("Backend unavailable", func(t *testing.T) {
+		rsClient, server := testutil.NewRedisClientWithCleanup(t)
+		ds, ctx, kb := setupDSClient(t, rsClient)
+		kb.WithKey("unavailable")
+		key, err := kb.Build()
+		require.NoError(t, err)
+		server.Close()
+
+		err = ds.Put(ctx, key, []byte("value"), 0)
+		assert.ErrorIs(t, err, ErrBackendUnavailable)
+		var opErr *OpError
+		require.ErrorAs(t, err, &opErr)
+		assert.Equal(t, "put", opErr.Op)
+
+		// Restart the server so the registered cleanup can flush the namespace.
+		require.NoError(t, server.Restart())
+	})
+
+	t.Run("Sync replication issues WAIT", func(t *testing.T) {
+		rsClient, _ := testutil.NewRedisClientWithCleanup(t)
+		ds, ctx, kb := setupDSClient(t, rsClient)
+		kb.WithKey("replicated")
+		key, err := kb.Build()
+		require.NoError(t, err)
+
+		// Zero replicas doesn't require acknowledgment.
+		assert.NoError(t, ds.Put(WithSyncReplication(ctx, 0, time.Second), key, []byte("value"), 0))
+
+		// The in-memory server doesn't support WAIT, so the command error surfaces after the write.
+		err = ds.Put(WithSyncReplication(ctx, 1, time.Second), key, []byte("value"), 0)
+		var opErr *OpError
+		require.ErrorAs(t, err, &opErr)
+		assert.Equal(t, "put", opErr.Op)
+		assert.ErrorContains(t, err, "wait")
+	})
+
+	t.Run("Sync replication covers all writes", func(t *testing.T) {
+		rsClient, _ := testutil.NewRedisClientWithCleanup(t)
+		ds, ctx, kb := setupDSClient(t, rsClient)
+		syncCtx := WithSyncReplication(ctx, 1, time.Second)
+		newKey := func(name string) *keyfactory.Key {
+			kb.WithKey(name)
+			key, err := kb.BuildAndReset()
+			require.NoError(t, err)
+			return key
+		}
+		// The in-memory server doesn't support WAIT, so each write fails with the WAIT error after
+		// the write is applied.
+		assertWaited := func(t *testing.T, err error) {
+			assert.ErrorContains(t, err, "wait")
+		}
+
+		t.Run("Rename", func(t *testing.T) {
+			key, renamed := newKey("rename"), newKey("renamed")
+			require.NoError(t, ds.Put(ctx, key, []byte("value"), 0))
+			assertWaited(t, ds.Rename(syncCtx, key, renamed))
+			exists, err := ds.Exists(ctx, renamed)
+			require.NoError(t, err)
+			assert.True(t, exists)
+		})
+
+		t.Run("Index", func(t *testing.T) {
+			key := newKey("index")
+			assertWaited(t, ds.IndexAdd(syncCtx, key, IndexMember{Member: "a"}, IndexMember{Member: "b"}))
+			assertWaited(t, ds.IndexRemove(syncCtx, key, "a"))
+			_, err := ds.IndexPopByScore(syncCtx, key, 0, 1)
+			assertWaited(t, err)
+			members, err := ds.IndexRange(ctx, key, false)
+			require.NoError(t, err)
+			assert.Empty(t, members)
+		})
+
+		t.Run("DeleteIf", func(t *testing.T) {
+			key := newKey("delete-if")
+			require.NoError(t, ds.Put(ctx, key, []byte("value"), 0))
+			deleted, err := ds.DeleteIf(syncCtx, key, func([]byte) (bool, error) { return true, nil })
+			assertWaited(t, err)
+			assert.True(t, deleted, "should report the applied delete")
+		})
+
+		t.Run("CompareAndSwapMulti", func(t *testing.T) {
+			key := newKey("cas-multi")
+			require.NoError(t, ds.Put(ctx, key, []byte("one"), 0))
+			_, err := ds.CompareAndSwapMulti(syncCtx, []*keyfactory.Key{key}, [][]byte{[]byte("one")}, [][]byte{[]byte("two")})
+			assertWaited(t, err)
+			data, err := ds.Get(ctx, key)
+			require.NoError(t, err)
+			assert.Equal(t, []byte("two"), data)
+		})
+
+		t.Run("CompareAndSwap", func(t *testing.T) {
+			key := newKey("cas")
+			_, err := ds.CompareAndSwap(syncCtx, key, nil, []byte("one"))
+			assertWaited(t, err)
+			data, err := ds.Get(ctx, key)
+			require.NoError(t, err)
+			assert.Equal(t, []byte("one"), data)
+		})
+
+		t.Run("Modify", func(t *testing.T) {
+			key := newKey("modify")
+			require.NoError(t, ds.Put(ctx, key, []byte("one"), 0))
+			written, err := ds.Modify(syncCtx, key, 1, func([]byte) ([]byte, error) { return []byte("two"), nil })
+			assertWaited(t, err)
+			assert.Equal(t, []byte("two"), written, "should report the applied write")
+		})
+
+		t.Run("DeleteAlignedTx", func(t *testing.T) {
+			key := newKey("delete-tx")
+			require.NoError(t, ds.Put(ctx, key, []byte("value"), 0))
+			_, err := ds.DeleteAlignedTx(syncCtx, []*keyfactory.Key{key})
+			assertWaited(t, err)
+			exists, err := ds.Exists(ctx, key)
+			require.NoError(t, err)
+			assert.False(t, exists)
+		})
+
+		t.Run("LogAppend", func(t *testing.T) {
+			key := newKey("log")
+			_, err := ds.LogAppend(syncCtx, key, 0, map[string]any{"k": "v"})
+			assertWaited(t, err)
+			entries, err := ds.LogRead(ctx, key, "0", 10, -1)
+			require.NoError(t, err)
+			assert.Len(t, entries, 1)
+		})
+
+		t.Run("Reservation", func(t *testing.T) {
+			key := newKey("reservation")
+			_, _, err := ds.Reserve(syncCtx, key, "holder", time.Minute)
+			assertWaited(t, err)
+			_, err = ds.ConfirmReservation(syncCtx, key, "holder")
+			assertWaited(t, err)
+			r, err := ds.GetReservation(ctx, key)
+			require.NoError(t, err)
+			require.NotNil(t, r)
+			assert.True(t, r.Confirmed)
+			_, err = ds.ReleaseReservation(syncCtx, key, "holder")
+			assertWaited(t, err)
+			r, err = ds.GetReservation(ctx, key)
+			require.NoError(t, err)
+			assert.Nil(t, r)
+		})
+
+		t.Run("Content", func(t *testing.T) {
+			key := newKey("content")
+			assertWaited(t, ds.PutContent(syncCtx, key, []byte("value"), 0))
+			data, err := ds.GetContentMultiAligned(ctx, []*keyfactory.Key{key})
+			require.NoError(t, err)
+			assert.Equal(t, [][]byte{[]byte("value")}, data)
+			_, err = ds.DeleteContentAligned(syncCtx, []*keyfactory.Key{key})
+			assertWaited(t, err)
+			exists, err := ds.Exists(ctx, key)
+			require.NoError(t, err)
+			assert.False(t, exists)
+		})
+
+		t.Run("Txn", func(t *testing.T) {
+			key := newKey("txn")
+			txn := ds.NewTxn()
+			committed := false
+			require.NoError(t, txn.OnCommit(func(context.Context) error { committed = true; return nil }))
+			_, err := txn.Put(key, []byte("value"), 0)
+			require.NoError(t, err)
+			assertWaited(t, txn.Commit(syncCtx))
+			assert.True(t, committed, "should call the commit functions of the applied writes")
+			data, err := ds.Get(ctx, key)
+			require.NoError(t, err)
+			assert.Equal(t, []byte("value"), data)
+		})
+	})
+
+	t.Run("Classify errors", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			err    error
+			expect error
+		}{
+			{name: "Transaction failed", err: redis.TxFailedErr, expect: ErrVersionConflict},
+			{name: "Out of memory", err: errors.New("OOM command not allowed when used memory > 'maxmemory'"), expect: ErrQuotaExceeded},
+			{name: "Client closed", err: redis.ErrClosed, expect: ErrBackendUnavailable},
+			{name: "Key not found", err: ErrKeyNotFound, expect: ErrKeyNotFound},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				err := newOpError("op", "key", tt.err)
+				assert.ErrorIs(t, err, tt.expect)
+				assert.ErrorIs(t, err, tt.err)
+			})
+		}
+	})
+}
+
+func TestDatastoreClientAdmin(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+
+	t.Run("GetAcrossNamespaces", func(t *testing.T) {
+		ds1, ctx, kb1 := setupDSClient(t, rsClient)
+		_, _, kb2 := setupDSClient(t, rsClient)
+		entityKey := "entity:" + keyfactory.GenerateRandomKey()
+		kb1.WithKey(entityKey)
+		key1, err := kb1.BuildAndReset()
+		require.NoError(t, err)
+		kb2.WithKey(entityKey)
+		key2, err := kb2.BuildAndReset()
+		require.NoError(t, err)
+		key3 := keyfactory.NewKey(entityKey, "") // Without namespace.
+		require.NoError(t, ds1.Put(ctx, key1, []byte("one"), 0))
+		require.NoError(t, ds1.Put(ctx, key2, []byte("two"), 0))
+		require.NoError(t, ds1.Put(ctx, key3, []byte("three"), 0))
+		defer ds1.Delete(ctx, key3)
+
+		result, err := ds1.GetAcrossNamespaces(ctx, keyfactory.NewKey(entityKey, "ignored"))
+		assert.NoError(t, err)
+		require.Len(t, result, 3, "should group keys by namespace")
+		require.Len(t, result[key1.Namespace()], 1)
+		assert.Equal(t, []byte("one"), result[key1.Namespace()][0].Data)
+		require.Len(t, result[key2.Namespace()], 1)
+		assert.Equal(t, []byte("two"), result[key2.Namespace()][0].Data)
+		require.Len(t, result[""], 1)
+		assert.Equal(t, entityKey, result[""][0].Key.Key())
+	})
+}
+
+func TestDatastoreClientIsolation(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	ctx := context.Background()
+
+	t.Run("Key prefix", func(t *testing.T) {
+		ds1, err := NewClient(rsClient, WithKeyPrefix("app1"))
+		require.NoError(t, err)
+		ds2, err := NewClient(rsClient, WithKeyPrefix("app2"))
+		require.NoError(t, err)
+		key := keyfactory.NewKey("entity:"+keyfactory.GenerateRandomKey(), "ns")
+		require.NoError(t, ds1.Put(ctx, key, []byte("one"), 0))
+		defer ds1.Delete(ctx, key)
+
+		assert.True(t, server.Exists("app1:"+key.RedisKey()), "should prefix redis key")
+		data, err := ds1.Get(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("one"), data)
+		_, err = ds2.Get(ctx, key)
+		assert.ErrorIs(t, err, ErrKeyNotFound, "should not see keys of other prefix")
+
+		keys, err := ds1.GetKeys(ctx, keyfactory.NewKey(string(keyfactory.WildcardAnyString), "ns"))
+		require.NoError(t, err)
+		require.Len(t, keys, 1)
+		assert.Equal(t, key.RedisKey(), keys[0].RedisKey(), "should strip prefix from returned keys")
+		keys, err = ds2.ScanKeys(ctx, keyfactory.NewKey(string(keyfactory.WildcardAnyString), "ns"))
+		require.NoError(t, err)
+		assert.Empty(t, keys)
+	})
+
+	t.Run("Invalid key prefix", func(t *testing.T) {
+		_, err := NewClient(rsClient, WithKeyPrefix(":app"))
+		assert.ErrorIs(t, err, ErrInvalidKey)
+	})
+
+	t.Run("Logical DB", func(t *testing.T) {
+		ds0, err := NewClient(rsClient)
+		require.NoError(t, err)
+		ds1, err := NewClient(rsClient, WithDB(1))
+		require.NoError(t, err)
+		defer ds1.Close()
+		key := keyfactory.NewKey("entity:"+keyfactory.GenerateRandomKey(), "")
+		require.NoError(t, ds1.Put(ctx, key, []byte("one"), 0))
+		defer ds1.Delete(ctx, key)
+
+		assert.True(t, server.DB(1).Exists(key.RedisKey()), "should write to selected db")
+		exists, err := ds0.Exists(ctx, key)
+		require.NoError(t, err)
+		assert.False(t, exists, "should not see keys of other db")
+	})
+}
+
+func TestDatastoreClientWithNamespace(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	ctx := context.Background()
+
+	ds, err := NewClient(rsClient)
+	require.NoError(t, err)
+	tenant1, err := ds.WithNamespace("tenant1")
+	require.NoError(t, err)
+	tenant2, err := ds.WithNamespace("tenant2")
+	require.NoError(t, err)
+
+	t.Run("Applies namespace", func(t *testing.T) {
+		key := keyfactory.NewKey("entity:"+keyfactory.GenerateRandomKey(), "")
+		require.NoError(t, tenant1.Put(ctx, key, []byte("one"), 0))
+		defer tenant1.Delete(ctx, key)
+
+		assert.True(t, server.Exists(keyfactory.NewKey(key.Key(), "tenant1").RedisKey()))
+		data, err := tenant1.Get(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("one"), data)
+		_, err = tenant2.Get(ctx, key)
+		assert.ErrorIs(t, err, ErrKeyNotFound, "should not see keys of other namespace")
+		_, err = ds.Get(ctx, key)
+		assert.ErrorIs(t, err, ErrKeyNotFound, "should not see keys of child namespace")
+
+		keys, err := tenant1.GetKeys(ctx, keyfactory.NewKey(string(keyfactory.WildcardAnyString), ""))
+		require.NoError(t, err)
+		require.Len(t, keys, 1)
+		exists, err := tenant1.Exists(ctx, keys[0])
+		require.NoError(t, err)
+		assert.True(t, exists, "should accept returned keys")
+	})
+
+	t.Run("Explicit namespace", func(t *testing.T) {
+		key := keyfactory.NewKey("entity:"+keyfactory.GenerateRandomKey(), "other")
+		require.NoError(t, tenant1.Put(ctx, key, []byte("one"), 0))
+		defer ds.Delete(ctx, key)
+
+		data, err := ds.Get(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("one"), data)
+	})
+
+	t.Run("Invalid namespace", func(t *testing.T) {
+		_, err := ds.WithNamespace("")
+		assert.ErrorIs(t, err, ErrInvalidKey)
+	})
+}
+
+func TestDatastoreClientLimits(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+
+	t.Run("Max page size", func(t *testing.T) {
+		ds, err := NewClient(rsClient, WithMaxPageSize(2), WithScanCount(1))
+		require.NoError(t, err)
+		_, ctx, kb := setupDSClient(t, rsClient)
+		for i := 0; i < 5; i++ {
+			kb.WithKey(fmt.Sprintf("key:%d", i))
+			key, err := kb.BuildAndReset()
+			require.NoError(t, err)
+			require.NoError(t, ds.Put(ctx, key, []byte("data"), 0))
+		}
+		kb.WithWildcard(keyfactory.WildcardAnyString)
+		keyMatch, err := kb.BuildAndReset()
+		require.NoError(t, err)
+
+		keys, _, err := ds.GetKeysWithCursor(ctx, 0, 100, keyMatch)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(keys), 2, "should cap page size")
+		keys, err = ds.ScanKeys(ctx, keyMatch)
+		require.NoError(t, err)
+		assert.Len(t, keys, 5, "should scan all keys")
+	})
+
+	t.Run("Invalid limits", func(t *testing.T) {
+		_, err := NewClient(rsClient, WithMaxPageSize(0))
+		assert.Error(t, err)
+		_, err = NewClient(rsClient, WithScanCount(-1))
+		assert.Error(t, err)
+	})
+}
+
+func TestDatastoreClientIndex(t *testing.T) {
+	rsClient, _ := testutil.NewRedisClientWithCleanup(t)
+	ds, ctx, kb := setupDSClient(t, rsClient)
+
+	kb.WithKey("index")
+	key, err := kb.BuildAndReset()
+	require.NoError(t, err)
+	require.NoError(t, ds.IndexAdd(ctx, key,
+		IndexMember{Member: "a:1"},
+		IndexMember{Member: "a:2"},
+		IndexMember{Member: "b:1"},
+	))
+
+	n, err := ds.IndexCountPrefix(ctx, key, "a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	n, err = ds.IndexCountPrefix(ctx, key, "")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	members, err := ds.IndexRangePrefix(ctx, key, "a")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a:1", "a:2"}, members)
+	members, err = ds.IndexRangePrefix(ctx, key, "")
+	require.NoError(t, err)
+	assert.Len(t, members, 3)
+
+	require.NoError(t, ds.IndexRemove(ctx, key, "a:1", "c:1"))
+	n, err = ds.IndexCountPrefix(ctx, key, "a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	kb.WithKey("due")
+	dueKey, err := kb.BuildAndReset()
+	require.NoError(t, err)
+	require.NoError(t, ds.IndexAdd(ctx, dueKey,
+		IndexMember{Member: "x", Score: 3},
+		IndexMember{Member: "y", Score: 1},
+		IndexMember{Member: "z", Score: 2},
+		IndexMember{Member: "later", Score: 10},
+	))
+	popped, err := ds.IndexPopByScore(ctx, dueKey, 5, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []IndexMember{{Member: "y", Score: 1}, {Member: "z", Score: 2}}, popped)
+	popped, err = ds.IndexPopByScore(ctx, dueKey, 5, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []IndexMember{{Member: "x", Score: 3}}, popped, "should not pop members twice")
+	members, err = ds.IndexRange(ctx, dueKey, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"later"}, members)
+}
+
+func TestDatastoreClientPutAndGet(t *testing.T) {
+	rsClient, _ := testutil.NewRedisClientWithCleanup(t)
+	ds, ctx, kb := setupDSClient(t, rsClient)
+	kb.WithKey("key")
+	key, err := kb.BuildAndReset()
+	require.NoError(t, err)
+
+	prev, err := ds.PutAndGet(ctx, key, []byte("one"), 0)
+	require.NoError(t, err)
+	assert.Nil(t, prev)
+	prev, err = ds.PutAndGet(ctx, key, []byte("two"), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("one"), prev)
+	data, err := ds.Get(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("two"), data)
+}
+
+// recordingCommander records the commands issued through the commander.
+type recordingCommander struct {
+	commander
+	cmds []string
+}
+
+func (r *recordingCommander) set(ctx context.Context, key string, value []byte, args setArgs) (bool, []byte, error) {
+	r.cmds = append(r.cmds, "set")
+	return r.commander.set(ctx, key, value, args)
+}
+
+func (r *recordingCommander) exists(ctx context.Context, key string) (bool, error) {
+	r.cmds = append(r.cmds, "exists")
+	return r.commander.exists(ctx, key)
+}
+
+func (r *recordingCommander) zrange(ctx context.Context, key string, reverse bool) ([]string, error) {
+	r.cmds = append(r.cmds, "zrange")
+	return r.commander.zrange(ctx, key, reverse)
+}
+
+func TestDatastoreClientCommander(t *testing.T) {
+	rsClient, _ := testutil.NewRedisClientWithCleanup(t)
+	ds, ctx, kb := setupDSClient(t, rsClient)
+	commands := &recordingCommander{commander: ds.commands}
+	ds.commands = commands
+	kb.WithKey("key")
+	key, err := kb.BuildAndReset()
+	require.NoError(t, err)
+
+	written, err := ds.PutIfAbsent(ctx, key, []byte("one"), 0)
+	require.NoError(t, err)
+	assert.True(t, written)
+	written, err = ds.PutIfAbsent(ctx, key, []byte("two"), 0)
+	require.NoError(t, err)
+	assert.False(t, written, "should report a SET that didn't write")
+	exists, err := ds.Exists(ctx, key)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	members, err := ds.IndexRange(ctx, key, false)
+	assert.Error(t, err, "should fail on a key of another type")
+	assert.Empty(t, members)
+	assert.Equal(t, []string{"set", "set", "exists", "zrange"}, commands.cmds, "should issue commands through the commander")
+}
+
+func TestDatastoreClientPutIfExists(t *testing.T) {
+	rsClient, _ := testutil.NewRedisClientWithCleanup(t)
+	ds, ctx, kb := setupDSClient(t, rsClient)
+	kb.WithKey("key")
+	key, err := kb.BuildAndReset()
+	require.NoError(t, err)
+
+	updated, err := ds.PutIfExists(ctx, key, []byte("one"), 0)
+	require.NoError(t, err)
+	assert.False(t, updated)
+	_, err = ds.Get(ctx, key)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	require.NoError(t, ds.Put(ctx, key, []byte("one"), 0))
+	updated, err = ds.PutIfExists(ctx, key, []byte("two"), 0)
+	require.NoError(t, err)
+	assert.True(t, updated)
+	data, err := ds.Get(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("two"), data)
+}
+
+func TestDatastoreClientPutMultiAtomic(t *testing.T) {
+	rsClient, _ := testutil.NewRedisClientWithCleanup(t)
+	ds, ctx, kb := setupDSClient(t, rsClient)
+	keys := make([]*keyfactory.Key, 2)
+	for i := range keys {
+		kb.WithKey(fmt.Sprintf("key-%d", i))
+		key, err := kb.BuildAndReset()
+		require.NoError(t, err)
+		keys[i] = key
+	}
+
+	require.NoError(t, ds.PutMultiAtomic(ctx, keys, [][]byte{[]byte("a"), []byte("b")}, time.Minute))
+	data, err := ds.GetMultiAligned(ctx, keys)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("a"), []byte("b")}, data)
+	ttl, err := rsClient.TTL(ctx, keys[1].RedisKey()).Result()
+	require.NoError(t, err)
+	assert.Greater(t, ttl, time.Duration(0))
+
+	assert.Error(t, ds.PutMultiAtomic(ctx, keys, [][]byte{[]byte("a")}, 0))
+}
+
+func TestDatastoreClientPutIfAbsent(t *testing.T) {
+	rsClient, _ := testutil.NewRedisClientWithCleanup(t)
+	ds, ctx, kb := setupDSClient(t, rsClient)
+	kb.WithKey("key")
+	key, err := kb.BuildAndReset()
+	require.NoError(t, err)
+
+	added, err := ds.PutIfAbsent(ctx, key, []byte("one"), 0)
+	require.NoError(t, err)
+	assert.True(t, added)
+	added, err = ds.PutIfAbsent(ctx, key, []byte("two"), 0)
+	require.NoError(t, err)
+	assert.False(t, added)
+	data, err := ds.Get(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("one"), data)
+}
+
+func TestDatastoreClientDeleteIf(t *testing.T) {
+	rsClient, _ := testutil.NewRedisClientWithCleanup(t)
+	ds, ctx, kb := setupDSClient(t, rsClient)
+	kb.WithKey("key")
+	key, err := kb.BuildAndReset()
+	require.NoError(t, err)
+
+	t.Run("Condition", func(t *testing.T) {
+		require.NoError(t, ds.Put(ctx, key, []byte("active"), 0))
+		deleted, err := ds.DeleteIf(ctx, key, func(data []byte) (bool, error) {
+			return string(data) == "pending", nil
+		})
+		require.NoError(t, err)
+		assert.False(t, deleted)
+		deleted, err = ds.DeleteIf(ctx, key, func(data []byte) (bool, error) {
+			return string(data) == "active", nil
+		})
+		require.NoError(t, err)
+		assert.True(t, deleted)
+		exists, err := ds.Exists(ctx, key)
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("Key not found", func(t *testing.T) {
+		deleted, err := ds.DeleteIf(ctx, key, func(data []byte) (bool, error) {
+			return true, nil
+		})
+		require.NoError(t, err)
+		assert.False(t, deleted)
+	})
+
+	t.Run("Concurrent modification", func(t *testing.T) {
+		require.NoError(t, ds.Put(ctx, key, []byte("pending"), 0))
+		var seen []string
+		deleted, err := ds.DeleteIf(ctx, key, func(data []byte) (bool, error) {
+			seen = append(seen, string(data))
+			if len(seen) == 1 {
+				require.NoError(t, ds.Put(ctx, key, []byte("active"), 0)) // Modify the watched key.
+			}
+			return string(data) == "pending", nil
+		})
+		require.NoError(t, err)
+		assert.False(t, deleted, "should re-evaluate condition with modified data")
+		assert.Equal(t, []string{"pending", "active"}, seen)
+	})
+}
+
+func TestDatastoreClientContent(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	ds, ctx, kb := setupDSClient(t, rsClient)
+	keys := make([]*keyfactory.Key, 3)
+	for i := range keys {
+		kb.WithKey(fmt.Sprintf("key-%d", i))
+		key, err := kb.BuildAndReset()
+		require.NoError(t, err)
+		keys[i] = key
+	}
+	shared, other := []byte("shared"), []byte("other")
+	blobKey := func(data []byte) string {
+		return ds.contentKey(keys[0], data)
+	}
+	refs := func(data []byte) string {
+		return server.HGet(blobKey(data), "refs")
+	}
+
+	t.Run("Store identical data once", func(t *testing.T) {
+		require.NoError(t, ds.PutContentMulti(ctx, keys, [][]byte{shared, shared, other}, 0))
+		assert.Equal(t, "2", refs(shared))
+		assert.Equal(t, "1", refs(other))
+		data, err := ds.GetContentMultiAligned(ctx, keys)
+		require.NoError(t, err)
+		assert.Equal(t, [][]byte{shared, shared, other}, data)
+
+		require.NoError(t, ds.PutContent(ctx, keys[0], shared, 0))
+		assert.Equal(t, "2", refs(shared), "should not count rewrite of same data")
+	})
+
+	t.Run("Release replaced data", func(t *testing.T) {
+		require.NoError(t, ds.PutContent(ctx, keys[2], shared, 0))
+		assert.Equal(t, "3", refs(shared))
+		assert.False(t, server.Exists(blobKey(other)), "should delete unreferenced data")
+	})
+
+	t.Run("Release deleted data", func(t *testing.T) {
+		kb.WithKey("missing")
+		missing, err := kb.BuildAndReset()
+		require.NoError(t, err)
+		deleted, err := ds.DeleteContentAligned(ctx, []*keyfactory.Key{keys[0], missing, keys[1]})
+		require.NoError(t, err)
+		assert.Equal(t, []bool{true, false, true}, deleted)
+		assert.Equal(t, "1", refs(shared))
+
+		data, err := ds.GetContentMultiAligned(ctx, keys)
+		require.NoError(t, err)
+		assert.Equal(t, [][]byte{nil, nil, shared}, data)
+
+		_, err = ds.DeleteContentAligned(ctx, keys[2:])
+		require.NoError(t, err)
+		assert.False(t, server.Exists(blobKey(shared)))
+	})
+
+	t.Run("Reject expiration", func(t *testing.T) {
+		err := ds.PutContent(ctx, keys[1], shared, time.Minute)
+		assert.ErrorIs(t, err, errContentExpiration)
+		assert.False(t, server.Exists(blobKey(shared)))
+
+		require.NoError(t, ds.PutContent(ctx, keys[1], shared, 0))
+		assert.Zero(t, server.TTL(blobKey(shared)))
+	})
+
+	t.Run("Read plain values as is", func(t *testing.T) {
+		require.NoError(t, ds.Put(ctx, keys[0], []byte("plain"), 0))
+		data, err := ds.GetContentMultiAligned(ctx, keys[:1])
+		require.NoError(t, err)
+		assert.Equal(t, [][]byte{[]byte("plain")}, data)
+	})
+
+	t.Run("Missing data", func(t *testing.T) {
+		server.Del(blobKey(shared))
+		_, err := ds.GetContentMultiAligned(ctx, keys[1:2])
+		assert.ErrorIs(t, err, ErrCorruptedData)
+	})
+}
+
+func TestDatastoreClientTxn(t *testing.T) {
+	rsClient, _ := testutil.NewRedisClientWithCleanup(t)
+	ds, ctx, kb := setupDSClient(t, rsClient)
+	keys := make([]*keyfactory.Key, 4)
+	for i := range keys {
+		kb.WithKey(fmt.Sprintf("key-%d", i))
+		key, err := kb.BuildAndReset()
+		require.NoError(t, err)
+		keys[i] = key
+	}
+	require.NoError(t, ds.Put(ctx, keys[2], []byte("c"), 0))
+
+	t.Run("Commit staged writes", func(t *testing.T) {
+		txn := ds.NewTxn()
+		_, err := txn.Put(keys[0], []byte("a"), time.Minute)
+		require.NoError(t, err)
+		_, err = txn.Put(keys[1], []byte("b"), 0)
+		require.NoError(t, err)
+		delExisting, err := txn.Delete(keys[2])
+		require.NoError(t, err)
+		delMissing, err := txn.Delete(keys[3])
+		require.NoError(t, err)
+		_, err = txn.Put(nil, []byte("x"), 0)
+		assert.ErrorIs(t, err, ErrInvalidKey)
+		committed := false
+		require.NoError(t, txn.OnCommit(func(ctx context.Context) error {
+			committed = true
+			assert.True(t, delExisting.Deleted())
+			return nil
+		}))
+		assert.Equal(t, 4, txn.Len())
+
+		exists, err := ds.Exists(ctx, keys[0])
+		require.NoError(t, err)
+		assert.False(t, exists, "should not write before commit")
+
+		require.NoError(t, txn.Commit(ctx))
+		assert.True(t, committed)
+		assert.False(t, delMissing.Deleted())
+		data, err := ds.GetMultiAligned(ctx, keys)
+		require.NoError(t, err)
+		assert.Equal(t, [][]byte{[]byte("a"), []byte("b"), nil, nil}, data)
+		ttl, err := rsClient.TTL(ctx, keys[0].RedisKey()).Result()
+		require.NoError(t, err)
+		assert.Equal(t, time.Minute, ttl)
+
+		assert.Error(t, txn.Commit(ctx), "should not commit twice")
+		_, err = txn.Put(keys[3], []byte("d"), 0)
+		assert.Error(t, err, "should not stage after commit")
+	})
+
+	t.Run("Failed commit", func(t *testing.T) {
+		closedClient := redis.NewClient(rsClient.Options())
+		require.NoError(t, closedClient.Close())
+		closedDS, err := NewClient(closedClient)
+		require.NoError(t, err)
+		txn := closedDS.NewTxn()
+		_, err = txn.Put(keys[3], []byte("d"), 0)
+		require.NoError(t, err)
+		committed := false
+		require.NoError(t, txn.OnCommit(func(ctx context.Context) error {
+			committed = true
+			return nil
+		}))
+		assert.Error(t, txn.Commit(ctx))
+		assert.False(t, committed, "should not call OnCommit functions")
+	})
+}
+
+func TestDatastoreClientModify(t *testing.T) {
+	rsClient, _ := testutil.NewRedisClientWithCleanup(t)
+	ds, ctx, kb := setupDSClient(t, rsClient)
+	kb.WithKey("key")
+	key, err := kb.BuildAndReset()
+	require.NoError(t, err)
+	appendByte := func(data []byte) ([]byte, error) {
+		return append(data, '+'), nil
+	}
+
+	t.Run("Key not found", func(t *testing.T) {
+		_, err := ds.Modify(ctx, key, 3, appendByte)
+		assert.ErrorIs(t, err, ErrKeyNotFound)
+	})
+
+	t.Run("Modify keeping expiration", func(t *testing.T) {
+		require.NoError(t, ds.Put(ctx, key, []byte("a"), time.Minute))
+		written, err := ds.Modify(ctx, key, 3, appendByte)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("a+"), written)
+		ttl, err := rsClient.TTL(ctx, key.RedisKey()).Result()
+		require.NoError(t, err)
+		assert.Equal(t, time.Minute, ttl)
+
+		written, err = ds.Modify(ctx, key, 3, func(data []byte) ([]byte, error) { return nil, nil })
+		require.NoError(t, err)
+		assert.Nil(t, written, "should leave key unchanged")
+	})
+
+	t.Run("Concurrent modification", func(t *testing.T) {
+		require.NoError(t, ds.Put(ctx, key, []byte("a"), 0))
+		var seen []string
+		written, err := ds.Modify(ctx, key, 3, func(data []byte) ([]byte, error) {
+			seen = append(seen, string(data))
+			if len(seen) == 1 {
+				require.NoError(t, ds.Put(ctx, key, []byte("b"), 0)) // Modify the watched key.
+			}
+			return appendByte(data)
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []byte("b+"), written)
+		assert.Equal(t, []string{"a", "b"}, seen)
+
+		_, err = ds.Modify(ctx, key, 2, func(data []byte) ([]byte, error) {
+			require.NoError(t, ds.Put(ctx, key, []byte("c"), 0))
+			return appendByte(data)
+		})
+		assert.ErrorIs(t, err, ErrVersionConflict, "should give up after attempts")
+	})
+}
+
+func TestDatastoreClientCompareAndSwapMulti(t *testing.T) {
+	rsClient, _ := testutil.NewRedisClientWithCleanup(t)
+	ds, ctx, kb := setupDSClient(t, rsClient)
+	kb.WithKey("key1")
+	key1, err := kb.BuildAndReset()
+	require.NoError(t, err)
+	kb.WithKey("key2")
+	key2, err := kb.BuildAndReset()
+	require.NoError(t, err)
+	keys := []*keyfactory.Key{key1, key2}
+
+	t.Run("Conditional", func(t *testing.T) {
+		require.NoError(t, ds.Put(ctx, key1, []byte("a"), time.Hour))
+		require.NoError(t, ds.Put(ctx, key2, []byte("changed"), 0))
+		swapped, err := ds.CompareAndSwapMulti(ctx, keys, [][]byte{[]byte("a"), []byte("b")}, [][]byte{[]byte("a2"), []byte("b2")})
+		require.NoError(t, err)
+		assert.Equal(t, []bool{true, false}, swapped)
+		data, err := ds.GetMultiAligned(ctx, keys)
+		require.NoError(t, err)
+		assert.Equal(t, [][]byte{[]byte("a2"), []byte("changed")}, data)
+		ttl, err := rsClient.TTL(ctx, key1.RedisKey()).Result()
+		require.NoError(t, err)
+		assert.Greater(t, ttl, time.Duration(0), "should keep expiration")
+	})
+
+	t.Run("Unconditional", func(t *testing.T) {
+		swapped, err := ds.CompareAndSwapMulti(ctx, keys, nil, [][]byte{[]byte("a3"), []byte("b3")})
+		require.NoError(t, err)
+		assert.Equal(t, []bool{true, true}, swapped)
+	})
+
+	t.Run("Unconditional missing key", func(t *testing.T) {
+		require.NoError(t, ds.Delete(ctx, key2))
+		swapped, err := ds.CompareAndSwapMulti(ctx, keys, nil, [][]byte{[]byte("a4"), []byte("b4")})
+		require.NoError(t, err)
+		assert.Equal(t, []bool{true, false}, swapped)
+		exists, err := ds.Exists(ctx, key2)
+		require.NoError(t, err)
+		assert.False(t, exists, "should not recreate deleted key")
+	})
+
+	t.Run("Mismatched lengths", func(t *testing.T) {
+		_, err := ds.CompareAndSwapMulti(ctx, keys, nil, [][]byte{[]byte("a")})
+		assert.Error(t, err)
+	})
+}
+
+func TestDatastoreClientCompareAndSwap(t *testing.T) {
+	rsClient, _ := testutil.NewRedisClientWithCleanup(t)
+	ds, ctx, kb := setupDSClient(t, rsClient)
+	kb.WithKey("key")
+	key, err := kb.BuildAndReset()
+	require.NoError(t, err)
+
+	swapped, err := ds.CompareAndSwap(ctx, key, nil, []byte("a"))
+	require.NoError(t, err)
+	assert.True(t, swapped, "should set missing key")
+	swapped, err = ds.CompareAndSwap(ctx, key, nil, []byte("b"))
+	require.NoError(t, err)
+	assert.False(t, swapped, "should not set existing key")
+	swapped, err = ds.CompareAndSwap(ctx, key, []byte("b"), []byte("c"))
+	require.NoError(t, err)
+	assert.False(t, swapped)
+	swapped, err = ds.CompareAndSwap(ctx, key, []byte("a"), []byte("c"))
+	require.NoError(t, err)
+	assert.True(t, swapped)
+	data, err := ds.Get(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("c"), data)
+}
+
+func TestDatastoreClientCopyTo(t *testing.T) {
+	rsClient, _ := testutil.NewRedisClientWithCleanup(t)
+	ds, ctx, kb := setupDSClient(t, rsClient)
+	dst, err := ds.WithNamespace("copy")
+	require.NoError(t, err)
+	kb.WithKey("expiring")
+	expiring, err := kb.BuildAndReset()
+	require.NoError(t, err)
+	kb.WithKey("persistent")
+	persistent, err := kb.BuildAndReset()
+	require.NoError(t, err)
+	kb.WithKey("missing")
+	missing, err := kb.BuildAndReset()
+	require.NoError(t, err)
+	require.NoError(t, ds.Put(ctx, expiring, []byte("a"), time.Hour))
+	require.NoError(t, ds.Put(ctx, persistent, []byte("b"), 0))
+	keys := []*keyfactory.Key{expiring, persistent, missing}
+
+	t.Run("Get with TTL", func(t *testing.T) {
+		records, err := ds.GetMultiWithTTL(ctx, keys)
+		require.NoError(t, err)
+		require.Len(t, records, 2)
+		assert.Equal(t, []byte("a"), records[0].Data)
+		assert.InDelta(t, time.Hour, records[0].TTL, float64(time.Second))
+		assert.Equal(t, []byte("b"), records[1].Data)
+		assert.Zero(t, records[1].TTL)
+	})
+
+	t.Run("Copy", func(t *testing.T) {
+		require.NoError(t, ds.CopyTo(ctx, dst, keys))
+		records, err := dst.GetMultiWithTTL(ctx, keys)
+		require.NoError(t, err)
+		require.Len(t, records, 2)
+		assert.Equal(t, []byte("a"), records[0].Data)
+		assert.InDelta(t, time.Hour, records[0].TTL, float64(time.Second), "should preserve expiration")
+		assert.Zero(t, records[1].TTL)
+	})
+}
+
+func TestDatastoreClientExpire(t *testing.T) {
+	rsClient, _ := testutil.NewRedisClientWithCleanup(t)
+	ds, ctx, kb := setupDSClient(t, rsClient)
+	kb.WithKey("key")
+	key, err := kb.BuildAndReset()
+	require.NoError(t, err)
+	ttl := func(t *testing.T) time.Duration {
+		t.Helper()
+		d, err := rsClient.PTTL(ctx, key.RedisKey()).Result()
+		require.NoError(t, err)
+		return d
+	}
+
+	for _, tc := range []struct {
+		name       string
+		current    time.Duration // Current expiration, or 0 for none.
+		expiration time.Duration
+		mode       ExpireMode
+		wantSet    bool
+	}{
+		{name: "Always", current: time.Hour, expiration: time.Minute, mode: ExpireAlways, wantSet: true},
+		{name: "NX without expiration", current: 0, expiration: time.Minute, mode: ExpireNX, wantSet: true},
+		{name: "NX with expiration", current: time.Hour, expiration: time.Minute, mode: ExpireNX, wantSet: false},
+		{name: "XX without expiration", current: 0, expiration: time.Minute, mode: ExpireXX, wantSet: false},
+		{name: "XX with expiration", current: time.Hour, expiration: time.Minute, mode: ExpireXX, wantSet: true},
+		{name: "GT longer", current: time.Minute, expiration: time.Hour, mode: ExpireGT, wantSet: true},
+		{name: "GT shorter", current: time.Hour, expiration: time.Minute, mode: ExpireGT, wantSet: false},
+		{name: "GT without expiration", current: 0, expiration: time.Hour, mode: ExpireGT, wantSet: false},
+		{name: "LT shorter", current: time.Hour, expiration: time.Minute, mode: ExpireLT, wantSet: true},
+		{name: "LT longer", current: time.Minute, expiration: time.Hour, mode: ExpireLT, wantSet: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.NoError(t, ds.Put(ctx, key, []byte("data"), tc.current))
+			set, err := ds.Expire(ctx, key, tc.expiration, tc.mode)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantSet, set)
+			if tc.wantSet {
+				assert.InDelta(t, tc.expiration, ttl(t), float64(time.Second))
+			}
+		})
+	}
+
+	t.Run("Key not found", func(t *testing.T) {
+		require.NoError(t, ds.Delete(ctx, key))
+		set, err := ds.Expire(ctx, key, time.Minute, ExpireAlways)
+		require.NoError(t, err)
+		assert.False(t, set)
+	})
+}
+
+// slowHook delays every command processed by a Redis client.
+type slowHook struct {
+	delay time.Duration
+}
+
+func (h slowHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	time.Sleep(h.delay)
+	return ctx, nil
+}
+
+func (h slowHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error { return nil }
+
+func (h slowHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h slowHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error { return nil }
+
+func TestDatastoreClientHedgedReads(t *testing.T) {
+	primary, _ := testutil.NewRedisClientWithCleanup(t)
+	replica, _ := testutil.NewRedisClientWithCleanup(t)
+	ctx := context.Background()
+	kb := keyfactory.NewKeyBuilder()
+	kb.WithKey("key")
+	key, err := kb.BuildAndReset()
+	require.NoError(t, err)
+	require.NoError(t, primary.Set(ctx, key.RedisKey(), "primary", 0).Err())
+	require.NoError(t, replica.Set(ctx, key.RedisKey(), "replica", 0).Err())
+
+	t.Run("Invalid options", func(t *testing.T) {
+		_, err := NewClient(primary, WithHedgedReads(nil, time.Millisecond))
+		assert.Error(t, err)
+		_, err = NewClient(primary, WithHedgedReads(replica, 0))
+		assert.Error(t, err)
+	})
+
+	t.Run("Fast primary", func(t *testing.T) {
+		ds, err := NewClient(primary, WithHedgedReads(replica, time.Second))
+		require.NoError(t, err)
+		data, err := ds.Get(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, "primary", string(data))
+	})
+
+	t.Run("Slow primary", func(t *testing.T) {
+		slow := redis.NewClient(primary.Options())
+		defer slow.Close()
+		slow.AddHook(slowHook{delay: 500 * time.Millisecond})
+		ds, err := NewClient(slow, WithHedgedReads(replica, 10*time.Millisecond))
+		require.NoError(t, err)
+		start := time.Now()
+		data, err := ds.Get(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, "replica", string(data))
+		multi, err := ds.GetMulti(ctx, []*keyfactory.Key{key})
+		require.NoError(t, err)
+		assert.Equal(t, [][]byte{[]byte("replica")}, multi)
+		assert.Less(t, time.Since(start), 500*time.Millisecond, "should not wait for the slow primary")
+	})
+
+	t.Run("Session reads its writes", func(t *testing.T) {
+		slow := redis.NewClient(primary.Options())
+		defer slow.Close()
+		slow.AddHook(slowHook{delay: 50 * time.Millisecond})
+		ds, err := NewClient(slow, WithHedgedReads(replica, time.Millisecond))
+		require.NoError(t, err)
+		session := WithSession(ctx)
+		data, err := ds.Get(session, key)
+		require.NoError(t, err)
+		assert.Equal(t, "replica", string(data), "should hedge reads before a write")
+		require.NoError(t, ds.Put(session, key, []byte("written"), 0))
+		data, err = ds.Get(session, key)
+		require.NoError(t, err)
+		assert.Equal(t, "written", string(data))
+		multi, err := ds.GetMulti(session, []*keyfactory.Key{key})
+		require.NoError(t, err)
+		assert.Equal(t, [][]byte{[]byte("written")}, multi)
+		data, err = ds.Get(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, "replica", string(data), "should hedge reads of other contexts")
+	})
+
+	t.Run("Primary reads", func(t *testing.T) {
+		slow := redis.NewClient(primary.Options())
+		defer slow.Close()
+		slow.AddHook(slowHook{delay: 20 * time.Millisecond})
+		ds, err := NewClient(slow, WithHedgedReads(replica, time.Millisecond))
+		require.NoError(t, err)
+		data, err := ds.Get(WithPrimaryReads(ctx), key)
+		require.NoError(t, err)
+		assert.Equal(t, "written", string(data), "should not hedge primary reads")
+	})
+
+	t.Run("Failed primary", func(t *testing.T) {
+		down := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+		defer down.Close()
+		ds, err := NewClient(down, WithHedgedReads(replica, time.Second))
+		require.NoError(t, err)
+		data, err := ds.Get(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, "replica", string(data))
+	})
+}
+
+func TestDatastoreClientDeleteAligned(t *testing.T) {
+	rsClient, _ := testutil.NewRedisClientWithCleanup(t)
+	ds, ctx, kb := setupDSClient(t, rsClient)
+
+	keys := make([]*keyfactory.Key, 3)
+	for i := range keys {
+		kb.WithKey(fmt.Sprintf("entity:%d", i))
+		key, err := kb.BuildAndReset()
+		require.NoError(t, err)
+		keys[i] = key
+	}
+	require.NoError(t, ds.Put(ctx, keys[0], []byte("a"), 0))
+	require.NoError(t, ds.Put(ctx, keys[2], []byte("c"), 0))
+
+	deleted, err := ds.DeleteAligned(ctx, keys)
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true, false, true}, deleted)
+	deleted, err = ds.DeleteAligned(ctx, keys)
+	require.NoError(t, err)
+	assert.Equal(t, []bool{false, false, false}, deleted, "should not delete missing keys")
+}
+
+func TestDatastoreClientAuth(t *testing.T) {
+	server := miniredis.RunT(t)
+	server.RequireUserAuth("alice", "secret")
+	ctx := context.Background()
+
+	t.Run("Credentials", func(t *testing.T) {
+		ds, err := Dial(server.Addr(), WithCredentials("alice", "secret"), WithDB(1))
+		require.NoError(t, err)
+		defer ds.Close()
+		key := keyfactory.NewKey("entity:"+keyfactory.GenerateRandomKey(), "")
+		require.NoError(t, ds.Put(ctx, key, []byte("one"), 0))
+		assert.True(t, server.DB(1).Exists(key.RedisKey()))
+	})
+
+	t.Run("Wrong credentials", func(t *testing.T) {
+		ds, err := Dial(server.Addr(), WithCredentials("alice", "wrong"))
+		require.NoError(t, err)
+		defer ds.Close()
+		_, err = ds.Exists(ctx, keyfactory.NewKey("entity:1", ""))
+		assert.Error(t, err)
+	})
+
+	t.Run("Invalid credentials", func(t *testing.T) {
+		_, err := Dial(server.Addr(), WithCredentials("alice", ""))
+		assert.Error(t, err)
+		_, err = Dial(server.Addr(), WithCredentials("al ice", "secret"))
+		assert.Error(t, err)
+		_, err = Dial("")
+		assert.Error(t, err)
+	})
+
+	t.Run("TLS", func(t *testing.T) {
+		certFile, keyFile := writeTestCert(t)
+		tlsConfig, err := TLSConfig{CAFile: certFile, CertFile: certFile, KeyFile: keyFile}.Build()
+		require.NoError(t, err)
+		assert.NotNil(t, tlsConfig.RootCAs)
+		assert.Len(t, tlsConfig.Certificates, 1)
+
+		ds, err := Dial(server.Addr(), WithTLS(TLSConfig{CAFile: certFile}))
+		require.NoError(t, err)
+		defer ds.Close()
+		assert.NotNil(t, ds.GetRSClient().Options().TLSConfig)
+	})
+
+	t.Run("Invalid TLS", func(t *testing.T) {
+		certFile, keyFile := writeTestCert(t)
+		_, err := TLSConfig{CertFile: certFile}.Build()
+		assert.ErrorContains(t, err, "must be set together")
+		_, err = TLSConfig{CAFile: keyFile}.Build()
+		assert.ErrorContains(t, err, "no PEM certificates")
+		_, err = TLSConfig{CertFile: keyFile, KeyFile: certFile}.Build()
+		assert.ErrorContains(t, err, "client certificate")
+		_, err = Dial(server.Addr(), WithTLS(TLSConfig{CAFile: filepath.Join(t.TempDir(), "missing.pem")}))
+		assert.ErrorContains(t, err, "ca file")
+	})
+}
+
+// writeTestCert writes a self-signed PEM certificate and its key, and returns their paths.
+func writeTestCert(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+func TestDatastoreClientQoS(t *testing.T) {
+	rsClient, _ := testutil.NewRedisClientWithCleanup(t)
+	ctx := context.Background()
+	bgCtx := WithBackgroundPriority(ctx)
+	kb := keyfactory.NewKeyBuilder()
+	kb.WithKey("key")
+	key, err := kb.BuildAndReset()
+	require.NoError(t, err)
+	require.NoError(t, rsClient.Set(ctx, key.RedisKey(), "value", 0).Err())
+	const delay = 100 * time.Millisecond
+
+	t.Run("Invalid options", func(t *testing.T) {
+		_, err := NewClient(rsClient, WithQoS(QoSConfig{Threshold: time.Millisecond}))
+		assert.Error(t, err)
+		_, err = NewClient(rsClient, WithQoS(QoSConfig{Threshold: time.Millisecond, Delay: delay, Percentile: 2}))
+		assert.Error(t, err)
+	})
+
+	t.Run("Fast foreground traffic", func(t *testing.T) {
+		ds, err := NewClient(redis.NewClient(rsClient.Options()), WithQoS(QoSConfig{Threshold: 10 * time.Millisecond, Delay: delay}))
+		require.NoError(t, err)
+		defer ds.GetRSClient().Close()
+		_, err = ds.Get(ctx, key)
+		require.NoError(t, err)
+		start := time.Now()
+		_, err = ds.Get(bgCtx, key)
+		require.NoError(t, err)
+		assert.Less(t, time.Since(start), delay, "should not delay background traffic")
+	})
+
+	t.Run("Slow foreground traffic", func(t *testing.T) {
+		slow := redis.NewClient(rsClient.Options())
+		defer slow.Close()
+		ds, err := NewClient(slow, WithQoS(QoSConfig{
+			Threshold: 10 * time.Millisecond,
+			Delay:     delay,
+			MaxAge:    200 * time.Millisecond,
+		}))
+		require.NoError(t, err)
+		slow.AddHook(slowHook{delay: 20 * time.Millisecond}) // Measured by the QoS hook.
+
+		_, err = ds.Get(ctx, key)
+		require.NoError(t, err)
+		start := time.Now()
+		_, err = ds.Get(bgCtx, key)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, time.Since(start), delay, "should delay background traffic")
+
+		time.Sleep(200 * time.Millisecond)
+		start = time.Now()
+		_, err = ds.Get(bgCtx, key)
+		require.NoError(t, err)
+		assert.Less(t, time.Since(start), delay, "should ignore expired latency samples")
+
+		cancelled, cancel := context.WithCancel(bgCtx)
+		cancel()
+		_, err = ds.Get(ctx, key)
+		require.NoError(t, err)
+		_, err = ds.Get(cancelled, key)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestDatastoreClientCluster(t *testing.T) {
+	server := miniredis.RunT(t)
+	rsClient := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{server.Addr()}})
+	t.Cleanup(func() { _ = rsClient.Close() })
+	ds, err := NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+	assert.Nil(t, ds.GetRSClient())
+	assert.Equal(t, redis.UniversalClient(rsClient), ds.GetUniversalClient())
+
+	kb := keyfactory.NewKeyBuilderWithNamespace(keyfactory.GenerateRandomKey())
+	kb.WithKeyStrategy(keyfactory.HashTaggedKeyStrategy{})
+	var keys []*keyfactory.Key
+	for _, id := range []string{"a", "b"} {
+		kb.WithParentKey("tenant:t1")
+		kb.WithKey(id)
+		key, err := kb.BuildAndReset()
+		require.NoError(t, err)
+		keys = append(keys, key)
+	}
+	kb.WithParentKey("tenant:t1")
+	kb.WithWildcard(keyfactory.WildcardAnyString)
+	tenantMatch, err := kb.BuildAndReset()
+	require.NoError(t, err)
+	kb.WithWildcard(keyfactory.WildcardAnyString)
+	allMatch, err := kb.BuildAndReset()
+	require.NoError(t, err)
+
+	t.Run("Should read and write multiple keys", func(t *testing.T) {
+		require.NoError(t, ds.PutMulti(ctx, keys, [][]byte{[]byte("1"), []byte("2")}, 0))
+		data, err := ds.GetMulti(ctx, keys)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, [][]byte{[]byte("1"), []byte("2")}, data)
+	})
+
+	t.Run("Should scan keys", func(t *testing.T) {
+		found, err := ds.ScanKeys(ctx, allMatch)
+		require.NoError(t, err)
+		assert.Len(t, found, 2)
+		found, _, err = ds.GetKeysWithCursor(ctx, 0, 10, tenantMatch)
+		require.NoError(t, err)
+		assert.Len(t, found, 2)
+		_, _, err = ds.GetKeysWithCursor(ctx, 0, 10, allMatch)
+		assert.Error(t, err, "should require hash-tagged pattern for cursor scans")
+		found, err = ds.GetKeys(ctx, allMatch)
+		require.NoError(t, err)
+		assert.Len(t, found, 2)
+	})
+
+	t.Run("Should write hash-tagged keys atomically", func(t *testing.T) {
+		require.NoError(t, ds.PutMultiAtomic(ctx, keys, [][]byte{[]byte("3"), []byte("4")}, 0))
+		data, err := ds.GetMultiAligned(ctx, keys)
+		require.NoError(t, err)
+		assert.Equal(t, [][]byte{[]byte("3"), []byte("4")}, data)
+
+		kb.WithParentKey("tenant:t2")
+		kb.WithKey("c")
+		other, err := kb.BuildAndReset()
+		require.NoError(t, err)
+		err = ds.PutMultiAtomic(ctx, []*keyfactory.Key{keys[0], other}, [][]byte{[]byte("5"), []byte("6")}, 0)
+		assert.ErrorIs(t, err, ErrInvalidKey, "should reject keys of different hash tags")
+	})
+
+	t.Run("Should reject sync replication of pipelined writes", func(t *testing.T) {
+		syncCtx := WithSyncReplication(ctx, 1, time.Second)
+		err := ds.PutMulti(syncCtx, keys, [][]byte{[]byte("5"), []byte("6")}, 0)
+		assert.ErrorIs(t, err, errClusterSyncReplication)
+		data, err := ds.GetMultiAligned(ctx, keys)
+		require.NoError(t, err)
+		assert.Equal(t, [][]byte{[]byte("3"), []byte("4")}, data, "should not apply the write")
+	})
+
+	t.Run("Should delete multiple keys", func(t *testing.T) {
+		require.NoError(t, ds.Delete(ctx, keys...))
+		found, err := ds.GetKeys(ctx, allMatch)
+		require.NoError(t, err)
+		assert.Empty(t, found)
+	})
+
+	t.Run("Should reject options replacing the Redis client", func(t *testing.T) {
+		_, err := NewClient(rsClient, WithDB(1))
+		assert.Error(t, err)
+	})
+}
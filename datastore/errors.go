@@ -0,0 +1,85 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/holmberd/go-entitystore/encoder"
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+var (
+	ErrKeyNotFound        = errors.New("datastore: key not found")
+	ErrInvalidKey         = keyfactory.ErrInvalidKey
+	ErrEncoding           = encoder.ErrEncoding
+	ErrBackendUnavailable = errors.New("datastore: backend unavailable")
+	ErrVersionConflict    = errors.New("datastore: version conflict")
+	ErrQuotaExceeded      = errors.New("datastore: quota exceeded")
+	ErrCorruptedData      = errors.New("datastore: corrupted data")
+)
+
+// OpError is the error type returned by datastore operations.
+// It records the failed operation and, when applicable, the key it was applied to.
+//
+// Use errors.Is with the package sentinels (e.g. ErrBackendUnavailable) to branch on the cause.
+type OpError struct {
+	Op  string // Operation name, e.g. "get" or "put".
+	Key string // Redis key the operation was applied to, if any.
+	Err error
+}
+
+func (e *OpError) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("datastore: %s: %v", e.Op, e.Err)
+	}
+	return fmt.Sprintf("datastore: %s '%s': %v", e.Op, e.Key, e.Err)
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// newOpError returns a new OpError with the error classified against the package sentinels.
+func newOpError(op string, key string, err error) error {
+	return &OpError{Op: op, Key: key, Err: classifyError(err)}
+}
+
+// classifyError wraps well-known Redis failures with the matching package sentinel.
+func classifyError(err error) error {
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrKeyNotFound),
+		errors.Is(err, ErrInvalidKey),
+		errors.Is(err, ErrEncoding),
+		errors.Is(err, ErrBackendUnavailable),
+		errors.Is(err, ErrVersionConflict),
+		errors.Is(err, ErrQuotaExceeded),
+		errors.Is(err, ErrCorruptedData),
+		errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded):
+		return err // Already classified or caller initiated.
+	case errors.Is(err, redis.TxFailedErr):
+		return fmt.Errorf("%w: %w", ErrVersionConflict, err)
+	case strings.HasPrefix(err.Error(), "OOM "):
+		// Redis rejects writes with an OOM error once maxmemory is reached.
+		return fmt.Errorf("%w: %w", ErrQuotaExceeded, err)
+	case errors.Is(err, redis.ErrClosed),
+		errors.Is(err, io.EOF),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.As(err, &netErr),
+		strings.HasPrefix(err.Error(), "LOADING "),
+		strings.HasPrefix(err.Error(), "MASTERDOWN "):
+		return fmt.Errorf("%w: %w", ErrBackendUnavailable, err)
+	default:
+		return err
+	}
+}
@@ -0,0 +1,164 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// WithHedgedReads enables hedged reads for Get and GetMulti: if the primary hasn't replied
+// within the delay, the read is also issued to the replica, and the first reply is used.
+// Use to cut tail latency caused by occasional slow replies.
+//
+// NOTE: A reply from the replica may not reflect the latest writes, due to replication lag.
+// Use WithSession for read-your-writes consistency within a request.
+// The replica client is owned and closed by the caller.
+func WithHedgedReads(replica *redis.Client, delay time.Duration) ClientOption {
+	return func(c *Client) error {
+		if replica == nil {
+			return errors.New("datastore: hedged reads require a replica client")
+		}
+		if delay <= 0 {
+			return errors.New("datastore: hedged read delay must be positive")
+		}
+		c.hedgeClient = replica
+		c.hedgeDelay = delay
+		return nil
+	}
+}
+
+type sessionKey struct{}
+
+// session tracks whether a write was issued with a session context.
+type session struct {
+	wrote atomic.Bool
+}
+
+// WithSession returns a copy of the context that starts a session with read-your-writes
+// consistency, e.g. for the datastore operations of one request: once a write was issued with
+// the session context, its reads are only served by the primary, never by a lagging replica
+// (see WithHedgedReads). Contexts derived from the session context share the session.
+func WithSession(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sessionKey{}, &session{})
+}
+
+type primaryReadsKey struct{}
+
+// WithPrimaryReads returns a copy of the context whose reads are only served by the primary,
+// never by the replica (see WithHedgedReads), e.g. for reads that must reflect the latest writes
+// of other clients.
+func WithPrimaryReads(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryReadsKey{}, true)
+}
+
+func isPrimaryRead(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryReadsKey{}).(bool)
+	return primary
+}
+
+// sessionWrote returns whether a write was issued with the session of the context.
+func sessionWrote(ctx context.Context) bool {
+	s, ok := ctx.Value(sessionKey{}).(*session)
+	return ok && s.wrote.Load()
+}
+
+// readCommands are the read-only commands issued by the client. Any other command is tracked as a
+// write of the session, which at worst serves the session's reads by the primary needlessly.
+var readCommands = map[string]bool{
+	"get": true, "mget": true, "exists": true, "ttl": true, "pttl": true, "type": true, "strlen": true,
+	"scan": true, "sscan": true, "zscan": true, "hscan": true, "smembers": true, "sismember": true,
+	"scard": true, "zrange": true, "zrangebyscore": true, "zrevrange": true, "zrevrangebyscore": true,
+	"zcard": true, "zcount": true, "zscore": true, "hget": true, "hmget": true, "hgetall": true,
+	"xrange": true, "xrevrange": true, "xlen": true, "dbsize": true, "ping": true, "info": true,
+	"wait": true, "watch": true, "unwatch": true, "multi": true, "exec": true,
+}
+
+// sessionHook is a Redis hook marking the session of the context as written before a write
+// command is issued, so a concurrent read of the session doesn't hedge to the replica.
+type sessionHook struct{}
+
+func (sessionHook) mark(ctx context.Context, cmds ...redis.Cmder) {
+	s, ok := ctx.Value(sessionKey{}).(*session)
+	if !ok || s.wrote.Load() {
+		return
+	}
+	for _, cmd := range cmds {
+		if !readCommands[strings.ToLower(cmd.Name())] {
+			s.wrote.Store(true)
+			return
+		}
+	}
+}
+
+func (h sessionHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	h.mark(ctx, cmd)
+	return ctx, nil
+}
+
+func (sessionHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error { return nil }
+
+func (h sessionHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	h.mark(ctx, cmds...)
+	return ctx, nil
+}
+
+func (sessionHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error { return nil }
+
+type hedgeResult[V any] struct {
+	val     V
+	err     error
+	primary bool
+}
+
+// hedgedRead runs the read on the primary, and if hedged reads are enabled and the primary
+// hasn't replied within the hedge delay or failed, also on the replica, unless the context's
+// session wrote or its reads are primary reads. It returns the first successful reply, where redis.Nil is a successful reply.
+// If both reads fail the primary error is returned.
+func hedgedRead[V any](ctx context.Context, c *Client, read func(ctx context.Context, rs redis.UniversalClient) (V, error)) (V, error) {
+	if c.hedgeClient == nil || sessionWrote(ctx) || isPrimaryRead(ctx) {
+		return read(ctx, c.rsClient)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // Abandon the slower read.
+	results := make(chan hedgeResult[V], 2)
+	run := func(rs redis.UniversalClient, primary bool) {
+		val, err := read(ctx, rs)
+		results <- hedgeResult[V]{val: val, err: err, primary: primary}
+	}
+	go run(c.rsClient, true)
+
+	timer := time.NewTimer(c.hedgeDelay)
+	defer timer.Stop()
+	hedged := false
+	var primaryErr error
+	for received := 0; ; {
+		select {
+		case <-timer.C:
+			if !hedged {
+				hedged = true
+				go run(c.hedgeClient, false)
+			}
+		case res := <-results:
+			received++
+			if res.err == nil || res.err == redis.Nil {
+				return res.val, res.err
+			}
+			if res.primary {
+				primaryErr = res.err
+			}
+			if !hedged {
+				hedged = true // The primary failed before the hedge delay; try the replica.
+				go run(c.hedgeClient, false)
+				continue
+			}
+			if received == 2 {
+				var zero V
+				return zero, primaryErr
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+// IndexMember is a member of a sorted set index.
+type IndexMember struct {
+	Member string
+	Score  float64
+}
+
+// IndexAdd adds the members to the sorted set index with the key.
+// The score of existing members is updated.
+func (c *Client) IndexAdd(ctx context.Context, key *keyfactory.Key, members ...IndexMember) error {
+	if key == nil || len(members) == 0 {
+		return nil // No-op for empty key or members.
+	}
+	zMembers := make([]*redis.Z, len(members))
+	for i, m := range members {
+		zMembers[i] = &redis.Z{Score: m.Score, Member: m.Member}
+	}
+	rsKey := c.redisKey(key)
+	return c.execWrite(ctx, "index add", rsKey, func(pipe redis.Pipeliner) {
+		pipe.ZAdd(ctx, rsKey, zMembers...)
+	})
+}
+
+// IndexRemove removes the members from the sorted set index with the key.
+// Members not in the index are ignored.
+func (c *Client) IndexRemove(ctx context.Context, key *keyfactory.Key, members ...string) error {
+	if key == nil || len(members) == 0 {
+		return nil // No-op for empty key or members.
+	}
+	zMembers := make([]interface{}, len(members))
+	for i, m := range members {
+		zMembers[i] = m
+	}
+	rsKey := c.redisKey(key)
+	return c.execWrite(ctx, "index remove", rsKey, func(pipe redis.Pipeliner) {
+		pipe.ZRem(ctx, rsKey, zMembers...)
+	})
+}
+
+// IndexCountPrefix returns the number of members with the prefix in the sorted set index with the key.
+// All members of the index must have the same score for the prefix to match lexicographically.
+// An empty prefix counts all members.
+func (c *Client) IndexCountPrefix(ctx context.Context, key *keyfactory.Key, prefix string) (int64, error) {
+	if key == nil {
+		return 0, nil // No-op for empty key.
+	}
+	rsKey := c.redisKey(key)
+	var n int64
+	var err error
+	if prefix == "" {
+		n, err = c.commands.zcard(ctx, rsKey)
+	} else {
+		min, max := lexPrefixRange(prefix)
+		n, err = c.commands.zlexcount(ctx, rsKey, min, max)
+	}
+	if err != nil {
+		return 0, newOpError("index count", rsKey, err)
+	}
+	return n, nil
+}
+
+// lexPrefixRange returns the lexicographical range of all members with the prefix.
+func lexPrefixRange(prefix string) (min string, max string) {
+	return "[" + prefix, "[" + prefix + "\xff"
+}
+
+// IndexRangePrefix returns the members with the prefix in the sorted set index with the key,
+// ordered lexicographically. All members of the index must have the same score for the prefix to
+// match lexicographically. An empty prefix returns all members.
+func (c *Client) IndexRangePrefix(ctx context.Context, key *keyfactory.Key, prefix string) ([]string, error) {
+	if key == nil {
+		return nil, nil // No-op for empty key.
+	}
+	rsKey := c.redisKey(key)
+	min, max := "-", "+"
+	if prefix != "" {
+		min, max = lexPrefixRange(prefix)
+	}
+	members, err := c.commands.zrangeByLex(ctx, rsKey, min, max)
+	if err != nil {
+		return nil, newOpError("index range", rsKey, err)
+	}
+	return members, nil
+}
+
+// IndexRange returns all members of the sorted set index with the key, ordered by score.
+// Members with the same score are ordered lexicographically. If reverse is true, the order is reversed.
+func (c *Client) IndexRange(ctx context.Context, key *keyfactory.Key, reverse bool) ([]string, error) {
+	if key == nil {
+		return nil, nil // No-op for empty key.
+	}
+	rsKey := c.redisKey(key)
+	members, err := c.commands.zrange(ctx, rsKey, reverse)
+	if err != nil {
+		return nil, newOpError("index range", rsKey, err)
+	}
+	return members, nil
+}
+
+// indexPopByScoreScript removes and returns up to ARGV[2] members of the sorted set KEYS[1] with a
+// score up to ARGV[1], with their scores, ordered by score.
+var indexPopByScoreScript = redis.NewScript(`
+local m = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "WITHSCORES", "LIMIT", 0, ARGV[2])
+for i = 1, #m, 2 do
+	redis.call("ZREM", KEYS[1], m[i])
+end
+return m
+`)
+
+// IndexPopByScore atomically removes and returns up to count members of the sorted set index with
+// the key with a score up to max, ordered by score. Concurrent callers never pop the same member.
+func (c *Client) IndexPopByScore(ctx context.Context, key *keyfactory.Key, max float64, count int64) ([]IndexMember, error) {
+	if key == nil || count <= 0 {
+		return nil, nil // No-op for empty key or count.
+	}
+	rsKey := c.redisKey(key)
+	res, err := c.runScript(
+		ctx,
+		indexPopByScoreScript,
+		[]string{rsKey},
+		strconv.FormatFloat(max, 'f', -1, 64),
+		count,
+	).StringSlice()
+	if err != nil {
+		return nil, newOpError("index pop", rsKey, err)
+	}
+	members := make([]IndexMember, 0, len(res)/2)
+	for i := 0; i+1 < len(res); i += 2 {
+		score, err := strconv.ParseFloat(res[i+1], 64)
+		if err != nil {
+			return nil, newOpError("index pop", rsKey, fmt.Errorf("invalid score %q: %w", res[i+1], err))
+		}
+		members = append(members, IndexMember{Member: res[i], Score: score})
+	}
+	return members, nil
+}
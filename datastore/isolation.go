@@ -0,0 +1,52 @@
+package datastore
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+// WithNamespace returns a derived client that applies the namespace to all keys without a namespace.
+// Keys with an explicit namespace are used unchanged, so keys returned by the derived client can be
+// passed back to it as is.
+//
+// The derived client shares the underlying Redis client and options with the parent client,
+// and closing it is a no-op.
+func (c *Client) WithNamespace(ns string) (*Client, error) {
+	if err := keyfactory.ValidateKeyFragment(ns); err != nil {
+		return nil, fmt.Errorf("datastore: invalid namespace: %w", err)
+	}
+	child := *c
+	child.ownsRSClient = false
+	child.namespace = ns
+	return &child, nil
+}
+
+// redisKey returns the Redis key of the key with the client namespace and key prefix applied.
+func (c *Client) redisKey(key *keyfactory.Key) string {
+	if c.namespace != "" && key.Namespace() == "" {
+		key = keyfactory.NewKey(key.Key(), c.namespace)
+	}
+	return c.prefixRedisKey(key.RedisKey())
+}
+
+// prefixRedisKey applies the client key prefix to the Redis key or pattern.
+func (c *Client) prefixRedisKey(rsKey string) string {
+	if c.keyPrefix == "" {
+		return rsKey
+	}
+	return keyfactory.BuildRedisKey(c.keyPrefix, rsKey)
+}
+
+// parseRedisKey parses a Redis key with the client key prefix applied into a Key.
+func (c *Client) parseRedisKey(rsKey string) (*keyfactory.Key, error) {
+	if c.keyPrefix != "" {
+		prefix := c.keyPrefix + ":"
+		if !strings.HasPrefix(rsKey, prefix) {
+			return nil, fmt.Errorf("%w: key '%s' missing key prefix '%s'", ErrInvalidKey, rsKey, c.keyPrefix)
+		}
+		rsKey = strings.TrimPrefix(rsKey, prefix)
+	}
+	return keyfactory.ParseRedisKey(rsKey)
+}
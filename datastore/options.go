@@ -0,0 +1,88 @@
+package datastore
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+// ClientOption configures a Client.
+type ClientOption func(*Client) error
+
+// CorruptionHandler is called with the error whenever the client encounters unexpected or corrupted
+// data, before the error is returned to the caller.
+type CorruptionHandler func(err error)
+
+// logCorruption is the default CorruptionHandler.
+func logCorruption(err error) {
+	log.Printf("datastore: %v", err)
+}
+
+// WithCorruptionHandler sets the handler called when unexpected or corrupted data is encountered.
+// By default the error is logged.
+func WithCorruptionHandler(h CorruptionHandler) ClientOption {
+	return func(c *Client) error {
+		if h != nil {
+			c.corruptionHandler = h
+		}
+		return nil
+	}
+}
+
+// WithDB selects the Redis logical database used by the client.
+// The client creates and owns a new Redis client with the same options as the provided Redis
+// client, except for the database; call Close to release it.
+func WithDB(db int) ClientOption {
+	return func(c *Client) error {
+		if db < 0 {
+			return fmt.Errorf("datastore: invalid redis database %d", db)
+		}
+		if rs, ok := c.rsClient.(*redis.Client); ok && rs.Options().DB == db {
+			return nil
+		}
+		return c.reconfigure(func(opts *redis.Options) {
+			opts.DB = db
+		})
+	}
+}
+
+// WithKeyPrefix sets a global key prefix applied to all keys written and read by the client,
+// in addition to any key namespace. Keys returned by the client don't include the prefix.
+//
+// Use to isolate multiple applications sharing one Redis without changing any key construction.
+func WithKeyPrefix(prefix string) ClientOption {
+	return func(c *Client) error {
+		if err := keyfactory.ValidateKeyFragment(prefix); err != nil {
+			return fmt.Errorf("datastore: invalid key prefix: %w", err)
+		}
+		c.keyPrefix = prefix
+		return nil
+	}
+}
+
+// WithMaxPageSize sets the max number of keys returned per page by GetKeysWithCursor,
+// and the max number of keys read per MGET by multi-key admin reads. Defaults to DefaultMaxPageSize.
+func WithMaxPageSize(size int) ClientOption {
+	return func(c *Client) error {
+		if size <= 0 {
+			return fmt.Errorf("datastore: invalid max page size %d", size)
+		}
+		c.maxPageSize = size
+		return nil
+	}
+}
+
+// WithScanCount sets the SCAN COUNT hint used by full keyspace scans, e.g. ScanKeys.
+// Larger counts mean fewer round trips at the cost of longer blocking SCAN calls.
+// Defaults to DefaultScanCount.
+func WithScanCount(count int) ClientOption {
+	return func(c *Client) error {
+		if count <= 0 {
+			return fmt.Errorf("datastore: invalid scan count %d", count)
+		}
+		c.scanCount = count
+		return nil
+	}
+}
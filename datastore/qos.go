@@ -0,0 +1,161 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	DefaultQoSPercentile = 0.99             // Default foreground latency percentile compared to the QoS threshold.
+	DefaultQoSWindow     = 256              // Default number of foreground latency samples tracked by QoS.
+	DefaultQoSMaxAge     = 10 * time.Second // Default age after which foreground latency samples are ignored.
+)
+
+type backgroundKey struct{}
+
+// WithBackgroundPriority returns a copy of the context that tags the datastore operations using it
+// as background traffic, e.g. migrations and exports, which is delayed by QoS (see WithQoS) while
+// foreground traffic is slow.
+func WithBackgroundPriority(ctx context.Context) context.Context {
+	return context.WithValue(ctx, backgroundKey{}, true)
+}
+
+func isBackground(ctx context.Context) bool {
+	background, _ := ctx.Value(backgroundKey{}).(bool)
+	return background
+}
+
+// QoSConfig configures the prioritization of foreground over background traffic, see WithQoS.
+type QoSConfig struct {
+	Threshold  time.Duration // Foreground latency above which background commands are delayed.
+	Delay      time.Duration // Delay of each background command while foreground latency is above the threshold.
+	Percentile float64       // Foreground latency percentile compared to the threshold, in (0, 1]. Defaults to DefaultQoSPercentile.
+	Window     int           // Number of latest foreground latency samples tracked. Defaults to DefaultQoSWindow.
+	MaxAge     time.Duration // Age after which a latency sample is ignored. Defaults to DefaultQoSMaxAge.
+}
+
+// WithQoS protects foreground traffic during bulk jobs by delaying commands of contexts tagged with
+// WithBackgroundPriority while the moving percentile of foreground command latency exceeds the
+// threshold. Foreground latency is tracked over the latest samples within the max age, so background
+// traffic resumes at full speed once foreground traffic recovers or stops.
+//
+// QoS is applied with a hook on the Redis client, so it also tracks and delays commands issued on
+// the Redis client by other users.
+func WithQoS(cfg QoSConfig) ClientOption {
+	return func(c *Client) error {
+		if cfg.Threshold <= 0 || cfg.Delay <= 0 {
+			return errors.New("datastore: QoS threshold and delay must be positive")
+		}
+		if cfg.Percentile == 0 {
+			cfg.Percentile = DefaultQoSPercentile
+		}
+		if cfg.Percentile < 0 || cfg.Percentile > 1 {
+			return errors.New("datastore: QoS percentile must be in (0, 1]")
+		}
+		if cfg.Window <= 0 {
+			cfg.Window = DefaultQoSWindow
+		}
+		if cfg.MaxAge <= 0 {
+			cfg.MaxAge = DefaultQoSMaxAge
+		}
+		c.qos = &qosHook{cfg: cfg, samples: make([]latencySample, 0, cfg.Window)}
+		return nil
+	}
+}
+
+type latencySample struct {
+	at      time.Time
+	latency time.Duration
+}
+
+type qosStartKey struct{}
+
+// qosHook is a Redis hook tracking the latency of foreground commands and delaying background
+// commands while it exceeds the threshold.
+type qosHook struct {
+	cfg     QoSConfig
+	mu      sync.Mutex
+	samples []latencySample // Ring buffer of the latest foreground latency samples.
+	next    int
+}
+
+// record adds a foreground latency sample.
+func (h *qosHook) record(at time.Time, latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := latencySample{at: at, latency: latency}
+	if len(h.samples) < h.cfg.Window {
+		h.samples = append(h.samples, s)
+		return
+	}
+	h.samples[h.next] = s
+	h.next = (h.next + 1) % h.cfg.Window
+}
+
+// latency returns the foreground latency percentile of the samples within the max age.
+func (h *qosHook) latency(now time.Time) time.Duration {
+	h.mu.Lock()
+	latencies := make([]time.Duration, 0, len(h.samples))
+	for _, s := range h.samples {
+		if now.Sub(s.at) <= h.cfg.MaxAge {
+			latencies = append(latencies, s.latency)
+		}
+	}
+	h.mu.Unlock()
+	if len(latencies) == 0 {
+		return 0
+	}
+	slices.Sort(latencies)
+	i := int(h.cfg.Percentile*float64(len(latencies))+0.5) - 1
+	return latencies[min(max(i, 0), len(latencies)-1)]
+}
+
+// before delays a background command while foreground traffic is slow, or tags a foreground
+// command's context with its start time.
+func (h *qosHook) before(ctx context.Context) (context.Context, error) {
+	if !isBackground(ctx) {
+		return context.WithValue(ctx, qosStartKey{}, time.Now()), nil
+	}
+	if h.latency(time.Now()) <= h.cfg.Threshold {
+		return ctx, nil
+	}
+	timer := time.NewTimer(h.cfg.Delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx, ctx.Err()
+	case <-timer.C:
+		return ctx, nil
+	}
+}
+
+// after records the latency of a foreground command.
+func (h *qosHook) after(ctx context.Context) {
+	if start, ok := ctx.Value(qosStartKey{}).(time.Time); ok {
+		now := time.Now()
+		h.record(now, now.Sub(start))
+	}
+}
+
+func (h *qosHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return h.before(ctx)
+}
+
+func (h *qosHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	h.after(ctx)
+	return nil
+}
+
+func (h *qosHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return h.before(ctx)
+}
+
+func (h *qosHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	h.after(ctx)
+	return nil
+}
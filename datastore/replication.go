@@ -0,0 +1,150 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrReplicationIncomplete is returned when a write was not acknowledged by the required number
+// of replicas within the timeout. The write itself was applied on the primary.
+var ErrReplicationIncomplete = errors.New("datastore: replication incomplete")
+
+// errClusterSyncReplication is returned by pipelined writes of a cluster client that require sync
+// replication, since a keyless WAIT may be sent to a different node than the written keys.
+var errClusterSyncReplication = errors.New("datastore: sync replication of pipelined writes isn't supported by cluster clients")
+
+type syncReplicationKey struct{}
+
+type syncReplication struct {
+	numReplicas int
+	timeout     time.Duration
+}
+
+// WithSyncReplication returns a copy of the context that makes datastore writes wait until they
+// are acknowledged by at least numReplicas replicas, or the timeout expires, using Redis WAIT.
+// A timeout of 0 waits indefinitely.
+//
+// Use for critical writes where a primary failover must not lose the last acknowledged write.
+//
+// All writes of the client wait for replication, including scripted and transactional writes.
+// A write failing with an error wrapping ErrReplicationIncomplete was still applied on the primary.
+//
+// NOTE: With a Redis Cluster client, only the transactional writes of a single key, e.g. DeleteIf
+// and Modify, wait for replication on the node of the key. Other writes fail without being applied.
+func WithSyncReplication(ctx context.Context, numReplicas int, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, syncReplicationKey{}, syncReplication{
+		numReplicas: numReplicas,
+		timeout:     timeout,
+	})
+}
+
+func syncReplicationFromContext(ctx context.Context) (syncReplication, bool) {
+	repl, ok := ctx.Value(syncReplicationKey{}).(syncReplication)
+	return repl, ok && repl.numReplicas > 0
+}
+
+// execWrite executes the write commands queued by fn in a pipeline.
+// If the context requires sync replication, a WAIT command is issued in the same pipeline,
+// since WAIT only applies to writes made on the same connection.
+func (c *Client) execWrite(ctx context.Context, op string, key string, fn func(pipe redis.Pipeliner)) error {
+	if err := c.pipelineWrite(ctx, fn); err != nil {
+		return newOpError(op, key, err)
+	}
+	return nil
+}
+
+// pipelineWrite is like execWrite, but returns the error as is.
+// In a cluster, writes requiring sync replication fail without being applied.
+func (c *Client) pipelineWrite(ctx context.Context, fn func(pipe redis.Pipeliner)) error {
+	repl, ok := syncReplicationFromContext(ctx)
+	if ok && c.isCluster() {
+		return errClusterSyncReplication
+	}
+	pipe := c.rsClient.Pipeline()
+	fn(pipe)
+	var wait *redis.Cmd
+	if ok {
+		wait = pipe.Do(ctx, "wait", repl.numReplicas, repl.timeout.Milliseconds())
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return err // A nil reply is handled by the caller through its command.
+	}
+	if !ok {
+		return nil
+	}
+	return checkReplicas(repl, wait)
+}
+
+// runScript runs the write script, like Script.Run. If the context requires sync replication,
+// the script is run in a pipeline with a WAIT command (see execWrite), and the returned command
+// fails with an error wrapping ErrReplicationIncomplete if the write wasn't acknowledged.
+func (c *Client) runScript(ctx context.Context, script *redis.Script, keys []string, args ...interface{}) *redis.Cmd {
+	if _, ok := syncReplicationFromContext(ctx); !ok {
+		return script.Run(ctx, c.rsClient, keys, args...)
+	}
+	var cmd *redis.Cmd
+	err := c.pipelineWrite(ctx, func(pipe redis.Pipeliner) {
+		cmd = script.Eval(ctx, pipe, keys, args...) // EVALSHA can't fall back to EVAL in a pipeline.
+	})
+	if err != nil && cmd.Err() == nil {
+		return redis.NewCmdResult(cmd.Val(), err)
+	}
+	return cmd
+}
+
+// txPipelined executes the write commands queued by fn atomically in a MULTI/EXEC transaction,
+// like TxPipelined. If the context requires sync replication, a WAIT command is issued after the
+// transaction on the same connection, which is the connection of the node of the key in Redis Cluster.
+// It returns whether the transaction was applied, which it also is if only the replication failed.
+func (c *Client) txPipelined(ctx context.Context, key string, fn func(pipe redis.Pipeliner) error) (bool, error) {
+	if _, ok := syncReplicationFromContext(ctx); !ok {
+		_, err := c.rsClient.TxPipelined(ctx, fn)
+		return err == nil, err
+	}
+	applied := false
+	err := c.rsClient.Watch(ctx, func(tx *redis.Tx) error {
+		if err := tx.Unwatch(ctx).Err(); err != nil { // Only watched to pin the connection.
+			return err
+		}
+		if _, err := tx.TxPipelined(ctx, fn); err != nil {
+			return err
+		}
+		applied = true
+		return awaitReplicas(ctx, tx)
+	}, key)
+	return applied, err
+}
+
+// awaitReplicas issues a WAIT command on the connection of the WATCH transaction if the context
+// requires sync replication, e.g. after its MULTI/EXEC transaction (see txPipelined).
+func awaitReplicas(ctx context.Context, tx *redis.Tx) error {
+	repl, ok := syncReplicationFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	wait := redis.NewCmd(ctx, "wait", repl.numReplicas, repl.timeout.Milliseconds())
+	_ = tx.Process(ctx, wait) // The error is checked through the command.
+	return checkReplicas(repl, wait)
+}
+
+// checkReplicas returns an error wrapping ErrReplicationIncomplete if the WAIT command wasn't
+// acknowledged by the required number of replicas.
+func checkReplicas(repl syncReplication, wait *redis.Cmd) error {
+	acked, err := wait.Int64()
+	if err != nil {
+		return err
+	}
+	if acked < int64(repl.numReplicas) {
+		return fmt.Errorf(
+			"%w: acknowledged by %d of %d replicas",
+			ErrReplicationIncomplete,
+			acked,
+			repl.numReplicas,
+		)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+// Reservation values are the holder prefixed by the reservation state.
+const (
+	reservationPending   = "p:"
+	reservationConfirmed = "c:"
+)
+
+// Reservation is a reservation of a key by a holder (see Reserve).
+type Reservation struct {
+	Holder    string
+	Confirmed bool
+	TTL       time.Duration // Remaining time to live, or 0 if confirmed.
+}
+
+// reserveScript reserves KEYS[1] for the holder ARGV[1] for ARGV[2] milliseconds if it isn't
+// reserved, or extends the pending reservation of the holder. It returns whether the key is
+// reserved by the holder, the reservation value, and its remaining time to live in milliseconds.
+var reserveScript = redis.NewScript(`
+local v = redis.call("GET", KEYS[1])
+if not v then
+	v = "p:" .. ARGV[1]
+	redis.call("SET", KEYS[1], v, "PX", ARGV[2])
+	return {1, v, tonumber(ARGV[2])}
+end
+if v == "p:" .. ARGV[1] then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return {1, v, tonumber(ARGV[2])}
+end
+return {v == "c:" .. ARGV[1] and 1 or 0, v, redis.call("PTTL", KEYS[1])}
+`)
+
+// confirmReservationScript confirms the reservation of KEYS[1] by the holder ARGV[1], removing its
+// expiration. It returns 1 if the key is reserved by the holder, otherwise 0.
+var confirmReservationScript = redis.NewScript(`
+local v = redis.call("GET", KEYS[1])
+if v == "p:" .. ARGV[1] then
+	redis.call("SET", KEYS[1], "c:" .. ARGV[1])
+	return 1
+end
+return v == "c:" .. ARGV[1] and 1 or 0
+`)
+
+// releaseReservationScript removes the reservation of KEYS[1] by the holder ARGV[1].
+// It returns 1 if the key was reserved by the holder, otherwise 0.
+var releaseReservationScript = redis.NewScript(`
+local v = redis.call("GET", KEYS[1])
+if v == "p:" .. ARGV[1] or v == "c:" .. ARGV[1] then
+	redis.call("DEL", KEYS[1])
+	return 1
+end
+return 0
+`)
+
+// Reserve atomically reserves the key for the holder until the TTL expires, unless it's reserved by
+// another holder. Reserving a key already reserved by the holder extends a pending reservation.
+// It returns the reservation of the key, and whether it's reserved by the holder.
+func (c *Client) Reserve(ctx context.Context, key *keyfactory.Key, holder string, ttl time.Duration) (Reservation, bool, error) {
+	rsKey := c.redisKey(key)
+	res, err := c.runScript(ctx, reserveScript, []string{rsKey}, holder, ttl.Milliseconds()).Slice()
+	if err != nil {
+		return Reservation{}, false, newOpError("reserve", rsKey, err)
+	}
+	if len(res) != 3 {
+		return Reservation{}, false, newOpError("reserve", rsKey, fmt.Errorf("unexpected reply %v", res))
+	}
+	ok, _ := res[0].(int64)
+	value, _ := res[1].(string)
+	ttlMs, _ := res[2].(int64)
+	r, err := parseReservation(value)
+	if err != nil {
+		return Reservation{}, false, newOpError("reserve", rsKey, err)
+	}
+	if !r.Confirmed && ttlMs > 0 {
+		r.TTL = time.Duration(ttlMs) * time.Millisecond
+	}
+	return r, ok == 1, nil
+}
+
+// ConfirmReservation atomically confirms the reservation of the key by the holder, so it no longer expires.
+// It returns whether the key is reserved by the holder.
+func (c *Client) ConfirmReservation(ctx context.Context, key *keyfactory.Key, holder string) (bool, error) {
+	rsKey := c.redisKey(key)
+	ok, err := c.runScript(ctx, confirmReservationScript, []string{rsKey}, holder).Int64()
+	if err != nil {
+		return false, newOpError("confirm reservation", rsKey, err)
+	}
+	return ok == 1, nil
+}
+
+// ReleaseReservation atomically removes the reservation of the key by the holder.
+// It returns whether the key was reserved by the holder.
+func (c *Client) ReleaseReservation(ctx context.Context, key *keyfactory.Key, holder string) (bool, error) {
+	rsKey := c.redisKey(key)
+	ok, err := c.runScript(ctx, releaseReservationScript, []string{rsKey}, holder).Int64()
+	if err != nil {
+		return false, newOpError("release reservation", rsKey, err)
+	}
+	return ok == 1, nil
+}
+
+// GetReservation returns the reservation of the key, or nil if it isn't reserved.
+func (c *Client) GetReservation(ctx context.Context, key *keyfactory.Key) (*Reservation, error) {
+	records, err := c.GetMultiWithTTL(ctx, []*keyfactory.Key{key})
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	r, err := parseReservation(string(records[0].Data))
+	if err != nil {
+		return nil, newOpError("get reservation", c.redisKey(key), err)
+	}
+	r.TTL = records[0].TTL
+	return &r, nil
+}
+
+// parseReservation parses the reservation value.
+func parseReservation(value string) (Reservation, error) {
+	if holder, ok := strings.CutPrefix(value, reservationPending); ok {
+		return Reservation{Holder: holder}, nil
+	}
+	if holder, ok := strings.CutPrefix(value, reservationConfirmed); ok {
+		return Reservation{Holder: holder, Confirmed: true}, nil
+	}
+	return Reservation{}, fmt.Errorf("%w: invalid reservation '%s'", ErrCorruptedData, value)
+}
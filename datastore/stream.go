@@ -0,0 +1,50 @@
+package datastore
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+// LogEntry is an entry of an append-only log stored as a Redis Stream.
+type LogEntry struct {
+	ID     string // Stream ID of the entry, ordered by append time.
+	Values map[string]any
+}
+
+// LogAppend appends an entry with the values to the log with the key, trimming the log to about
+// the max length if positive. It returns the ID of the appended entry.
+func (c *Client) LogAppend(ctx context.Context, key *keyfactory.Key, maxLen int64, values map[string]any) (string, error) {
+	rsKey := c.redisKey(key)
+	var cmd *redis.StringCmd
+	err := c.execWrite(ctx, "log append", rsKey, func(pipe redis.Pipeliner) {
+		cmd = pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: rsKey,
+			MaxLen: maxLen,
+			Approx: maxLen > 0,
+			Values: values,
+		})
+	})
+	return cmd.Val(), err // The ID is set if only the replication failed.
+}
+
+// LogRead reads up to count entries of the log with the key after the entry ID, where "0" reads from
+// the start of the log. If there are no entries after the ID, it blocks until an entry is appended or
+// the block duration expires, returning no entries. A block duration of 0 blocks indefinitely,
+// and a negative block duration doesn't block.
+func (c *Client) LogRead(
+	ctx context.Context,
+	key *keyfactory.Key,
+	afterID string,
+	count int64,
+	block time.Duration,
+) ([]LogEntry, error) {
+	rsKey := c.redisKey(key)
+	entries, err := c.commands.xread(ctx, rsKey, afterID, count, block)
+	if err != nil {
+		return nil, newOpError("log read", rsKey, err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,138 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+// Record is a key with its associated data and remaining time to live.
+type Record struct {
+	Key  *keyfactory.Key
+	Data []byte
+	TTL  time.Duration // Remaining time to live, or 0 if the key has no expiration.
+}
+
+// GetMultiWithTTL is like GetMulti, but also captures the remaining time to live of each key.
+// The data and TTL of a key are read atomically. Keys not found in the store are ignored.
+func (c *Client) GetMultiWithTTL(ctx context.Context, keys []*keyfactory.Key) ([]Record, error) {
+	if len(keys) == 0 {
+		return nil, nil // No-op for empty slice of keys.
+	}
+	getCmds := make([]*redis.StringCmd, len(keys))
+	ttlCmds := make([]*redis.DurationCmd, len(keys))
+	_, err := c.rsClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			rsKey := c.redisKey(key)
+			getCmds[i] = pipe.Get(ctx, rsKey)
+			ttlCmds[i] = pipe.PTTL(ctx, rsKey)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, newOpError("get multi with ttl", "", err)
+	}
+	records := make([]Record, 0, len(keys))
+	for i, key := range keys {
+		data, err := getCmds[i].Bytes()
+		if err != nil {
+			if err == redis.Nil {
+				continue // Key not found; skip it.
+			}
+			return nil, newOpError("get multi with ttl", c.redisKey(key), err)
+		}
+		ttl, err := ttlCmds[i].Result()
+		if err != nil {
+			return nil, newOpError("get multi with ttl", c.redisKey(key), err)
+		}
+		if ttl < 0 {
+			ttl = 0 // PTTL replies -1 for keys without expiration.
+		}
+		records = append(records, Record{Key: key, Data: data, TTL: ttl})
+	}
+	return records, nil
+}
+
+// PutMultiWithTTL is like PutMulti, but restores the time to live of each record.
+func (c *Client) PutMultiWithTTL(ctx context.Context, records []Record) error {
+	if len(records) == 0 {
+		return nil // No-op for empty batch.
+	}
+	return c.execWrite(ctx, "put multi with ttl", "", func(pipe redis.Pipeliner) {
+		for _, r := range records {
+			pipe.Set(ctx, c.redisKey(r.Key), r.Data, r.TTL)
+		}
+	})
+}
+
+// CopyTo copies the keys and their remaining time to live to the destination client,
+// e.g. a client of another Redis instance or namespace. Keys not found in the store are ignored.
+// Keys are copied in batches of the max page size.
+func (c *Client) CopyTo(ctx context.Context, dst *Client, keys []*keyfactory.Key) error {
+	if dst == nil {
+		return errors.New("datastore: copy destination must not be nil")
+	}
+	for start := 0; start < len(keys); start += c.maxPageSize {
+		records, err := c.GetMultiWithTTL(ctx, keys[start:min(start+c.maxPageSize, len(keys))])
+		if err != nil {
+			return err
+		}
+		if err := dst.PutMultiWithTTL(ctx, records); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExpireMode is the condition under which Expire sets the expiration of a key.
+type ExpireMode string
+
+const (
+	ExpireAlways ExpireMode = ""   // Always set the expiration.
+	ExpireNX     ExpireMode = "NX" // Set the expiration only if the key has no expiration.
+	ExpireXX     ExpireMode = "XX" // Set the expiration only if the key has an expiration.
+	ExpireGT     ExpireMode = "GT" // Set the expiration only if it's greater than the current one.
+	ExpireLT     ExpireMode = "LT" // Set the expiration only if it's less than the current one.
+)
+
+// Expire atomically sets the expiration of the key if the mode's condition is met, using Redis
+// EXPIRE options. It returns whether the expiration was set; false if the key is not found in the
+// store or the condition wasn't met.
+//
+// A key without expiration is treated as having an infinite expiration, so ExpireGT never sets
+// the expiration of a key without one, and ExpireLT always does.
+//
+// NOTE: Requires Redis 7.0 or later for modes other than ExpireAlways.
+func (c *Client) Expire(
+	ctx context.Context,
+	key *keyfactory.Key,
+	expiration time.Duration,
+	mode ExpireMode,
+) (bool, error) {
+	if key == nil {
+		return false, nil // No-op for empty key.
+	}
+	rsKey := c.redisKey(key)
+	if _, ok := syncReplicationFromContext(ctx); ok {
+		var cmd *redis.Cmd
+		err := c.execWrite(ctx, "expire", rsKey, func(pipe redis.Pipeliner) {
+			cmd = pipe.Do(ctx, pexpireArgs(rsKey, expiration, mode)...)
+		})
+		if err != nil {
+			return false, err
+		}
+		set, err := cmd.Bool()
+		if err != nil {
+			return false, newOpError("expire", rsKey, err)
+		}
+		return set, nil
+	}
+	set, err := c.commands.pexpire(ctx, rsKey, expiration, mode)
+	if err != nil {
+		return false, newOpError("expire", rsKey, err)
+	}
+	return set, nil
+}
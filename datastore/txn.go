@@ -0,0 +1,147 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+var errTxnCommitted = errors.New("datastore: transaction already committed")
+
+// TxnOp is a write staged in a Txn. Its result is available once the transaction is committed.
+type TxnOp struct {
+	key        string // Redis key.
+	data       []byte
+	expiration time.Duration
+	delete     bool
+	cmd        *redis.IntCmd // DEL command of a delete, once committed.
+}
+
+// Deleted returns whether a committed delete deleted its key, i.e. the key existed.
+func (op *TxnOp) Deleted() bool {
+	return op.delete && op.cmd != nil && op.cmd.Val() > 0
+}
+
+// Txn stages writes of multiple keys to commit them atomically in a MULTI/EXEC transaction, e.g.
+// to write the entities of multiple stores sharing the client together. Either all staged writes
+// are applied, or none. A Txn is committed once, and is safe for concurrent use.
+//
+// NOTE: In Redis Cluster, all keys of a transaction must be in the same hash slot.
+type Txn struct {
+	c *Client
+
+	mu        sync.Mutex
+	ops       []*TxnOp
+	onCommit  []func(ctx context.Context) error
+	committed bool
+}
+
+// NewTxn returns a new empty transaction of the client.
+func (c *Client) NewTxn() *Txn {
+	return &Txn{c: c}
+}
+
+// Client returns the client of the transaction.
+func (t *Txn) Client() *Client {
+	return t.c
+}
+
+// Put stages writing the data with the key, like Client.Put.
+func (t *Txn) Put(key *keyfactory.Key, data []byte, expiration time.Duration) (*TxnOp, error) {
+	return t.stage(&TxnOp{key: t.txnKey(key), data: data, expiration: expiration})
+}
+
+// Delete stages deleting the key, like Client.Delete.
+func (t *Txn) Delete(key *keyfactory.Key) (*TxnOp, error) {
+	return t.stage(&TxnOp{key: t.txnKey(key), delete: true})
+}
+
+// txnKey returns the Redis key of the key, or an empty key if nil.
+func (t *Txn) txnKey(key *keyfactory.Key) string {
+	if key == nil {
+		return ""
+	}
+	return t.c.redisKey(key)
+}
+
+func (t *Txn) stage(op *TxnOp) (*TxnOp, error) {
+	if op.key == "" {
+		return nil, fmt.Errorf("%w: empty key", ErrInvalidKey)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.committed {
+		return nil, errTxnCommitted
+	}
+	t.ops = append(t.ops, op)
+	return op, nil
+}
+
+// OnCommit registers the function called after the transaction is committed successfully,
+// e.g. to trigger the events of the staged writes. Functions are called in registration order.
+func (t *Txn) OnCommit(fn func(ctx context.Context) error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.committed {
+		return errTxnCommitted
+	}
+	t.onCommit = append(t.onCommit, fn)
+	return nil
+}
+
+// Len returns the number of staged writes.
+func (t *Txn) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.ops)
+}
+
+// Commit atomically applies the staged writes in staging order, and calls the OnCommit functions.
+// The errors of the functions, and of the sync replication of the writes (see WithSyncReplication),
+// are joined and returned, but the writes are committed regardless.
+// A transaction can't be committed again, or staged to after commit, even if the commit failed.
+func (t *Txn) Commit(ctx context.Context) error {
+	t.mu.Lock()
+	if t.committed {
+		t.mu.Unlock()
+		return errTxnCommitted
+	}
+	t.committed = true
+	ops, onCommit := t.ops, t.onCommit
+	t.mu.Unlock()
+
+	var errs []error
+	if len(ops) > 0 {
+		cmds := make([]*redis.IntCmd, len(ops))
+		applied, err := t.c.txPipelined(ctx, ops[0].key, func(pipe redis.Pipeliner) error {
+			for i, op := range ops {
+				if op.delete {
+					cmds[i] = pipe.Del(ctx, op.key)
+				} else {
+					pipe.Set(ctx, op.key, op.data, op.expiration)
+				}
+			}
+			return nil
+		})
+		if !applied {
+			return newOpError("commit", "", err)
+		}
+		if err != nil {
+			errs = append(errs, newOpError("commit", "", err)) // Committed if only the replication failed.
+		}
+		for i, op := range ops {
+			op.cmd = cmds[i]
+		}
+	}
+	for _, fn := range onCommit {
+		if err := fn(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -1,6 +1,46 @@
 package encoder
 
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Codec marshals and unmarshals values, e.g. the payloads of events sent over the wire.
 type Codec interface {
 	Marshal(v any) ([]byte, error)
 	Unmarshal(data []byte, out any) error
 }
+
+// ContentTyper is optionally implemented by Codecs to report the media type of their encoding.
+type ContentTyper interface {
+	ContentType() string
+}
+
+// ContentType returns the media type of the codec's encoding, or "application/octet-stream" if
+// the codec doesn't implement ContentTyper.
+func ContentType(c Codec) string {
+	if ct, ok := c.(ContentTyper); ok {
+		return ct.ContentType()
+	}
+	return "application/octet-stream"
+}
+
+// Implements Codec interface.
+type JSONEncoder struct{}
+
+func (JSONEncoder) Marshal(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrEncoding, err)
+	}
+	return data, nil
+}
+
+func (JSONEncoder) Unmarshal(data []byte, out any) error {
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("%w: %w", ErrEncoding, err)
+	}
+	return nil
+}
+
+func (JSONEncoder) ContentType() string { return "application/json" }
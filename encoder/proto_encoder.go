@@ -1,12 +1,44 @@
 package encoder
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrEncoding is wrapped by all errors caused by marshaling or unmarshaling a value.
+var ErrEncoding = errors.New("encoder: encoding failed")
 
 // ProtoMarshaler is the interface implemented by types that can marshal themselves into valid Protobuf.
 type ProtoMarshaler interface {
 	MarshalProto() ([]byte, error)
 }
 
+// ProtoAppender is optionally implemented by ProtoMarshalers that can append their Protobuf
+// encoding to a buffer, e.g. using proto.MarshalOptions.MarshalAppend, so callers can reuse buffers.
+type ProtoAppender interface {
+	AppendProto(b []byte) ([]byte, error)
+}
+
+// ProtoDeterministicMarshaler is optionally implemented by ProtoMarshalers that can marshal
+// themselves into a deterministic encoding, e.g. using proto.MarshalOptions{Deterministic: true}
+// so map entries are sorted by key, so equal values always produce equal bytes.
+type ProtoDeterministicMarshaler interface {
+	MarshalProtoDeterministic() ([]byte, error)
+}
+
+// ProtoStreamMarshaler is optionally implemented by ProtoMarshalers that can write their Protobuf
+// encoding to a writer, so very large values don't require a full in-memory copy.
+type ProtoStreamMarshaler interface {
+	MarshalProtoTo(w io.Writer) error
+}
+
+// ProtoStreamUnmarshaler is optionally implemented by ProtoUnmarshalers that can read their
+// Protobuf encoding from a reader, so very large values don't require a full in-memory copy.
+type ProtoStreamUnmarshaler interface {
+	UnmarshalProtoFrom(r io.Reader) error
+}
+
 // Unmarshaler is the interface implemented by types that can unmarshal a Protobuf description of themselves.
 type ProtoUnmarshaler interface {
 	UnmarshalProto([]byte) error
@@ -14,14 +46,91 @@ type ProtoUnmarshaler interface {
 
 // Marshal returns the Protobuf encoding of v.
 func ProtoMarshal(v ProtoMarshaler) ([]byte, error) {
-	return v.MarshalProto()
+	data, err := v.MarshalProto()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrEncoding, err)
+	}
+	return data, nil
+}
+
+// ProtoMarshalAppend appends the Protobuf encoding of v to b, without an intermediate copy if v
+// implements ProtoAppender.
+func ProtoMarshalAppend(b []byte, v ProtoMarshaler) ([]byte, error) {
+	if a, ok := v.(ProtoAppender); ok {
+		data, err := a.AppendProto(b)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrEncoding, err)
+		}
+		return data, nil
+	}
+	data, err := ProtoMarshal(v)
+	if err != nil || len(b) == 0 {
+		return data, err
+	}
+	return append(b, data...), nil
+}
+
+// ProtoMarshalDeterministicAppend is like ProtoMarshalAppend, but appends the deterministic
+// Protobuf encoding of v if v implements ProtoDeterministicMarshaler.
+//
+// NOTE: The encoding of a v not implementing ProtoDeterministicMarshaler is only deterministic
+// if its MarshalProto or AppendProto is.
+func ProtoMarshalDeterministicAppend(b []byte, v ProtoMarshaler) ([]byte, error) {
+	dm, ok := v.(ProtoDeterministicMarshaler)
+	if !ok {
+		return ProtoMarshalAppend(b, v)
+	}
+	data, err := dm.MarshalProtoDeterministic()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrEncoding, err)
+	}
+	if len(b) == 0 {
+		return data, nil
+	}
+	return append(b, data...), nil
 }
 
 // Unmarshal parses the encoded Protobuf data and stores the result in the value pointed to by v.
 //
 // TODO: If v is nil or not a pointer, Unmarshal returns an error.
 func ProtoUnmarshal(data []byte, v ProtoUnmarshaler) error {
-	return v.UnmarshalProto(data)
+	if err := v.UnmarshalProto(data); err != nil {
+		return fmt.Errorf("%w: %w", ErrEncoding, err)
+	}
+	return nil
+}
+
+// ProtoMarshalTo writes the Protobuf encoding of v to w, streaming it if v implements
+// ProtoStreamMarshaler.
+func ProtoMarshalTo(w io.Writer, v ProtoMarshaler) error {
+	if sm, ok := v.(ProtoStreamMarshaler); ok {
+		if err := sm.MarshalProtoTo(w); err != nil {
+			return fmt.Errorf("%w: %w", ErrEncoding, err)
+		}
+		return nil
+	}
+	data, err := ProtoMarshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// ProtoUnmarshalFrom reads the Protobuf encoding from r into v, streaming it if v implements
+// ProtoStreamUnmarshaler. Otherwise r is read until EOF before unmarshaling.
+func ProtoUnmarshalFrom(r io.Reader, v ProtoUnmarshaler) error {
+	if su, ok := v.(ProtoStreamUnmarshaler); ok {
+		if err := su.UnmarshalProtoFrom(r); err != nil {
+			return fmt.Errorf("%w: %w", ErrEncoding, err)
+		}
+		return nil
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return ProtoUnmarshal(data, v)
 }
 
 // Implements Codec interface.
@@ -30,7 +139,7 @@ type ProtoEncoder struct{}
 func (ProtoEncoder) Marshal(v any) ([]byte, error) {
 	m, ok := v.(ProtoMarshaler)
 	if !ok {
-		return nil, fmt.Errorf("encoder: value does not implement ProtoMarshaler")
+		return nil, fmt.Errorf("%w: value does not implement ProtoMarshaler", ErrEncoding)
 	}
 	return ProtoMarshal(m)
 }
@@ -38,7 +147,9 @@ func (ProtoEncoder) Marshal(v any) ([]byte, error) {
 func (ProtoEncoder) Unmarshal(data []byte, out any) error {
 	u, ok := out.(ProtoUnmarshaler)
 	if !ok {
-		return fmt.Errorf("encoder: target does not implement ProtoUnmarshaler")
+		return fmt.Errorf("%w: target does not implement ProtoUnmarshaler", ErrEncoding)
 	}
 	return ProtoUnmarshal(data, u)
 }
+
+func (ProtoEncoder) ContentType() string { return "application/x-protobuf" }
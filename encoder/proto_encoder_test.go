@@ -0,0 +1,104 @@
+package encoder
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bufferValue is a value marshaled as its raw bytes.
+type bufferValue struct {
+	data []byte
+	err  error
+}
+
+func (v bufferValue) MarshalProto() ([]byte, error) { return v.data, v.err }
+
+func (v *bufferValue) UnmarshalProto(data []byte) error {
+	v.data = bytes.Clone(data)
+	return v.err
+}
+
+// streamValue is a bufferValue that also implements the streaming interfaces.
+type streamValue struct {
+	bufferValue
+	streamed bool
+}
+
+func (v *streamValue) MarshalProtoTo(w io.Writer) error {
+	v.streamed = true
+	_, err := w.Write(v.data)
+	return err
+}
+
+func (v *streamValue) UnmarshalProtoFrom(r io.Reader) error {
+	v.streamed = true
+	data, err := io.ReadAll(r)
+	v.data = data
+	return err
+}
+
+// deterministicValue is a bufferValue that also implements ProtoDeterministicMarshaler.
+type deterministicValue struct {
+	bufferValue
+	deterministic []byte
+}
+
+func (v deterministicValue) MarshalProtoDeterministic() ([]byte, error) {
+	return v.deterministic, v.err
+}
+
+func TestProtoMarshalDeterministicAppend(t *testing.T) {
+	t.Run("Should use deterministic encoding if implemented", func(t *testing.T) {
+		v := deterministicValue{bufferValue: bufferValue{data: []byte("b")}, deterministic: []byte("d")}
+		data, err := ProtoMarshalDeterministicAppend([]byte("prefix:"), v)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("prefix:d"), data)
+	})
+
+	t.Run("Should fall back to default encoding", func(t *testing.T) {
+		data, err := ProtoMarshalDeterministicAppend(nil, bufferValue{data: []byte("b")})
+		require.NoError(t, err)
+		assert.Equal(t, []byte("b"), data)
+	})
+
+	t.Run("Should wrap marshal error", func(t *testing.T) {
+		v := deterministicValue{bufferValue: bufferValue{err: errors.New("boom")}}
+		_, err := ProtoMarshalDeterministicAppend(nil, v)
+		assert.ErrorIs(t, err, ErrEncoding)
+	})
+}
+
+func TestProtoStreaming(t *testing.T) {
+	t.Run("Streaming value", func(t *testing.T) {
+		var buf bytes.Buffer
+		v := &streamValue{bufferValue: bufferValue{data: []byte("data")}}
+		require.NoError(t, ProtoMarshalTo(&buf, v))
+		assert.True(t, v.streamed, "should stream")
+		assert.Equal(t, "data", buf.String())
+
+		out := &streamValue{}
+		require.NoError(t, ProtoUnmarshalFrom(&buf, out))
+		assert.True(t, out.streamed, "should stream")
+		assert.Equal(t, []byte("data"), out.data)
+	})
+
+	t.Run("Non-streaming value", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, ProtoMarshalTo(&buf, bufferValue{data: []byte("data")}))
+		out := &bufferValue{}
+		require.NoError(t, ProtoUnmarshalFrom(&buf, out))
+		assert.Equal(t, []byte("data"), out.data)
+	})
+
+	t.Run("Encoding error", func(t *testing.T) {
+		err := ProtoMarshalTo(io.Discard, bufferValue{err: errors.New("invalid")})
+		assert.ErrorIs(t, err, ErrEncoding)
+		err = ProtoUnmarshalFrom(bytes.NewReader(nil), &bufferValue{err: errors.New("invalid")})
+		assert.ErrorIs(t, err, ErrEncoding)
+	})
+}
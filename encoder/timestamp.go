@@ -0,0 +1,56 @@
+package encoder
+
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers of the google.protobuf.Timestamp message.
+const (
+	timestampSeconds = 1
+	timestampNanos   = 2
+)
+
+// AppendProtoTimestamp appends the time as a google.protobuf.Timestamp message field of the
+// number to the buffer, e.g. in a hand-written MarshalProto. The seconds are floored, so the
+// nanoseconds are non-negative, also for times before the Unix epoch.
+func AppendProtoTimestamp(b []byte, num protowire.Number, t time.Time) []byte {
+	var ts []byte
+	ts = protowire.AppendTag(ts, timestampSeconds, protowire.VarintType)
+	ts = protowire.AppendVarint(ts, uint64(t.Unix())) // Two's complement of an int64, as for negative seconds.
+	ts = protowire.AppendTag(ts, timestampNanos, protowire.VarintType)
+	ts = protowire.AppendVarint(ts, uint64(t.Nanosecond()))
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, ts)
+}
+
+// ConsumeProtoTimestamp decodes a google.protobuf.Timestamp message into a UTC time.
+// It returns an error wrapping ErrEncoding if the message is malformed.
+func ConsumeProtoTimestamp(b []byte) (time.Time, error) {
+	var seconds int64
+	var nanos uint64
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 || typ != protowire.VarintType {
+			return time.Time{}, fmt.Errorf("%w: invalid timestamp field", ErrEncoding)
+		}
+		b = b[n:]
+		v, n := protowire.ConsumeVarint(b)
+		if n < 0 {
+			return time.Time{}, fmt.Errorf("%w: invalid timestamp varint", ErrEncoding)
+		}
+		b = b[n:]
+		switch num {
+		case timestampSeconds:
+			seconds = int64(v)
+		case timestampNanos:
+			nanos = v
+		}
+	}
+	if nanos >= uint64(time.Second) {
+		return time.Time{}, fmt.Errorf("%w: timestamp nanos %d out of range", ErrEncoding, int64(nanos))
+	}
+	return time.Unix(seconds, int64(nanos)).UTC(), nil
+}
@@ -0,0 +1,42 @@
+package encoder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestProtoTimestamp(t *testing.T) {
+	t.Run("Should round-trip times", func(t *testing.T) {
+		for _, ts := range []time.Time{
+			time.Unix(1700000000, 123456789).UTC(),
+			time.Unix(0, 0).UTC(),
+			time.Unix(-1, 500000000).UTC(), // Before the Unix epoch.
+			time.Date(1900, 1, 2, 3, 4, 5, 6, time.UTC),
+			{},
+		} {
+			b := AppendProtoTimestamp(nil, 5, ts)
+			num, typ, n := protowire.ConsumeTag(b)
+			require.Greater(t, n, 0)
+			assert.Equal(t, protowire.Number(5), num)
+			assert.Equal(t, protowire.BytesType, typ)
+			msg, m := protowire.ConsumeBytes(b[n:])
+			require.Greater(t, m, 0)
+			got, err := ConsumeProtoTimestamp(msg)
+			require.NoError(t, err)
+			assert.True(t, ts.Equal(got), "expected %v, got %v", ts, got)
+		}
+	})
+
+	t.Run("Should reject malformed timestamps", func(t *testing.T) {
+		_, err := ConsumeProtoTimestamp([]byte{0x0a, 0x00}) // Seconds as bytes.
+		assert.ErrorIs(t, err, ErrEncoding)
+		b := protowire.AppendTag(nil, timestampNanos, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(time.Second))
+		_, err = ConsumeProtoTimestamp(b)
+		assert.ErrorIs(t, err, ErrEncoding)
+	})
+}
@@ -0,0 +1,234 @@
+package entitystore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+const aclKeyPrefix = "acl" // Key prefix of entity ACLs.
+
+// Access is the kind of access to an entity checked by the authorizer (see WithAuthorizer).
+type Access int
+
+const (
+	AccessRead  Access = iota // Keyed reads, e.g. Get, GetByKeys, and Exists.
+	AccessWrite               // Keyed writes, e.g. Add, AddBatch, SetACL, TouchIfLonger, and the removals.
+)
+
+func (a Access) String() string {
+	switch a {
+	case AccessRead:
+		return "read"
+	case AccessWrite:
+		return "write"
+	default:
+		return fmt.Sprintf("access(%d)", a)
+	}
+}
+
+// ACL is the access control metadata of an entity, e.g. to share a document with collaborators.
+type ACL struct {
+	Owner string   `json:"owner"`           // ID of the principal owning the entity.
+	Roles []string `json:"roles,omitempty"` // Roles allowed to access the entity besides the owner.
+}
+
+// Authorizer returns whether the context may access the entity with the ACL,
+// where the ACL is nil for entities without one.
+type Authorizer func(ctx context.Context, access Access, entityKey string, acl *ACL) bool
+
+// Principal is the identity of a request checked against entity ACLs.
+type Principal struct {
+	ID    string
+	Roles []string
+}
+
+// ACLAuthorizer returns an Authorizer allowing access to entities without an ACL, and to entities
+// owned by the principal of the context or allowing any of its roles. Access is denied if the
+// context has no principal and the entity has an ACL.
+func ACLAuthorizer(principal func(ctx context.Context) (Principal, bool)) Authorizer {
+	return func(ctx context.Context, access Access, entityKey string, acl *ACL) bool {
+		if acl == nil {
+			return true
+		}
+		p, ok := principal(ctx)
+		if !ok {
+			return false
+		}
+		if p.ID != "" && p.ID == acl.Owner {
+			return true
+		}
+		return slices.ContainsFunc(p.Roles, func(role string) bool {
+			return slices.Contains(acl.Roles, role)
+		})
+	}
+}
+
+// aclKey returns the key of the ACL of the entity key.
+func (es *EntityStore[T, PT]) aclKey(entityKey string) (*keyfactory.Key, error) {
+	kb := es.NewKeyBuilder()
+	kb.WithKey(entityKey)
+	if _, err := kb.BuildAndReset(); err != nil {
+		return nil, err
+	}
+	return keyfactory.NewKey(keyfactory.BuildRedisKey(aclKeyPrefix, entityKey), es.namespace), nil
+}
+
+// SetACL sets the ACL of the entity key, replacing its current ACL, if the context may write the
+// entity. An entity key can be given an ACL before its entity is added, e.g. to create a private
+// entity, and the ACL is removed with the entity. An existing entity without an ACL can't be given
+// one, since any context may write it, and so claim its ownership.
+//
+// ACLs require an authorizer (see WithAuthorizer).
+func (es *EntityStore[T, PT]) SetACL(ctx context.Context, entityKey string, acl ACL) error {
+	if es.opts.authorizer == nil {
+		return errors.New("entitystore: ACLs require an authorizer")
+	}
+	if acl.Owner == "" {
+		return errors.New("entitystore: ACL requires an owner")
+	}
+	current, err := es.GetACL(ctx, entityKey)
+	if err != nil {
+		return err
+	}
+	if !es.opts.authorizer(ctx, AccessWrite, entityKey, current) {
+		return fmt.Errorf("%w: %s access to entity '%s'", ErrForbidden, AccessWrite, entityKey)
+	}
+	key, err := es.aclKey(entityKey)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(acl)
+	if err != nil {
+		return err
+	}
+	if current != nil {
+		return es.dsClient.Put(ctx, key, data, 0)
+	}
+	kb := es.NewKeyBuilder()
+	kb.WithKey(entityKey)
+	existsKey, err := kb.BuildAndReset()
+	if err != nil {
+		return err
+	}
+	exists, err := es.dsClient.Exists(ctx, existsKey)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("%w: ACL of existing entity '%s' without ACL", ErrForbidden, entityKey)
+	}
+	// The ACL is only added if absent, so concurrent contexts can't both claim the entity key.
+	added, err := es.dsClient.PutIfAbsent(ctx, key, data, 0)
+	if err != nil {
+		return err
+	}
+	if !added {
+		return fmt.Errorf("%w: ACL of entity '%s' set concurrently", ErrForbidden, entityKey)
+	}
+	return nil
+}
+
+// GetACL returns the ACL of the entity key, or nil if it has none.
+func (es *EntityStore[T, PT]) GetACL(ctx context.Context, entityKey string) (*ACL, error) {
+	acls, err := es.getACLs(ctx, []string{entityKey})
+	if err != nil {
+		return nil, err
+	}
+	return acls[0], nil
+}
+
+// getACLs returns the ACLs of the entity keys, with nil for entity keys without an ACL.
+func (es *EntityStore[T, PT]) getACLs(ctx context.Context, entityKeys []string) ([]*ACL, error) {
+	keys, err := es.aclKeys(entityKeys)
+	if err != nil {
+		return nil, err
+	}
+	data, err := es.dsClient.GetMultiAligned(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	acls := make([]*ACL, len(data))
+	for i, d := range data {
+		if d == nil {
+			continue
+		}
+		acls[i] = &ACL{}
+		if err := json.Unmarshal(d, acls[i]); err != nil {
+			return nil, fmt.Errorf("%w: ACL of entity '%s': %w", datastore.ErrCorruptedData, entityKeys[i], err)
+		}
+	}
+	return acls, nil
+}
+
+func (es *EntityStore[T, PT]) aclKeys(entityKeys []string) ([]*keyfactory.Key, error) {
+	keys := make([]*keyfactory.Key, len(entityKeys))
+	for i, entityKey := range entityKeys {
+		key, err := es.aclKey(entityKey)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = key
+	}
+	return keys, nil
+}
+
+// authorize returns an error wrapping ErrForbidden if the context may not access any of the
+// entity keys (see WithAuthorizer).
+func (es *EntityStore[T, PT]) authorize(ctx context.Context, access Access, entityKeys []string) error {
+	errs, err := es.authorizeAligned(ctx, access, entityKeys)
+	if err != nil {
+		return err
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// authorizeAligned is like authorize, but returns an error wrapping ErrForbidden for each entity
+// key the context may not access, aligned with the entity keys, e.g. for partial batches.
+// The returned errors are nil if the store has no authorizer.
+func (es *EntityStore[T, PT]) authorizeAligned(
+	ctx context.Context,
+	access Access,
+	entityKeys []string,
+) ([]error, error) {
+	if es.opts.authorizer == nil || len(entityKeys) == 0 {
+		return nil, nil
+	}
+	acls, err := es.getACLs(ctx, entityKeys)
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	for i, acl := range acls {
+		if es.opts.authorizer(ctx, access, entityKeys[i], acl) {
+			continue
+		}
+		if errs == nil {
+			errs = make([]error, len(entityKeys))
+		}
+		errs[i] = fmt.Errorf("%w: %s access to entity '%s'", ErrForbidden, access, entityKeys[i])
+	}
+	return errs, nil
+}
+
+// removeACLs removes the ACLs of the removed entity keys.
+func (es *EntityStore[T, PT]) removeACLs(ctx context.Context, entityKeys []string) error {
+	if es.opts.authorizer == nil || len(entityKeys) == 0 {
+		return nil
+	}
+	keys, err := es.aclKeys(entityKeys)
+	if err != nil {
+		return err
+	}
+	return es.dsClient.Delete(ctx, keys...)
+}
@@ -0,0 +1,180 @@
+package entitystore
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type principalKey struct{}
+
+func withPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+func principalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+func TestEntityStoreACL(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	store, err := New[testutil.Entity](
+		string(keyfactory.EntityKindTest),
+		keyfactory.GenerateRandomKey(),
+		dsClient,
+		WithAuthorizer(ACLAuthorizer(principalFromContext)),
+	)
+	require.NoError(t, err)
+
+	alice := withPrincipal(ctx, Principal{ID: "alice"})
+	bob := withPrincipal(ctx, Principal{ID: "bob", Roles: []string{"editor"}})
+	carol := withPrincipal(ctx, Principal{ID: "carol", Roles: []string{"viewer"}})
+
+	doc := testutil.NewEntity("doc-1", mockTenantId, 1)
+	public := testutil.NewEntity("doc-2", mockTenantId, 1)
+	require.NoError(t, store.SetACL(alice, doc.Key, ACL{Owner: "alice", Roles: []string{"editor"}}))
+	_, err = store.AddBatch(alice, []testutil.Entity{doc, public}, 0)
+	require.NoError(t, err)
+
+	t.Run("Should require an authorizer and owner", func(t *testing.T) {
+		plain, err := New[testutil.Entity](string(keyfactory.EntityKindTest), keyfactory.GenerateRandomKey(), dsClient)
+		require.NoError(t, err)
+		assert.Error(t, plain.SetACL(ctx, doc.Key, ACL{Owner: "alice"}))
+		assert.Error(t, store.SetACL(alice, doc.Key, ACL{}))
+	})
+
+	t.Run("Should allow owner and roles", func(t *testing.T) {
+		got, err := store.Get(alice, doc.Key)
+		require.NoError(t, err)
+		assert.Equal(t, doc.Key, got.Key)
+		entities, err := store.GetByKeys(bob, []string{doc.Key, public.Key})
+		require.NoError(t, err)
+		assert.Len(t, entities, 2)
+		_, err = store.Add(bob, doc, 0)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Should deny other principals", func(t *testing.T) {
+		_, err := store.Get(carol, doc.Key)
+		assert.ErrorIs(t, err, ErrForbidden)
+		_, err = store.Get(ctx, doc.Key)
+		assert.ErrorIs(t, err, ErrForbidden, "should deny context without principal")
+		_, err = store.GetByKeys(carol, []string{public.Key, doc.Key})
+		assert.ErrorIs(t, err, ErrForbidden)
+		_, err = store.AddBatch(carol, []testutil.Entity{public, doc}, 0)
+		assert.ErrorIs(t, err, ErrForbidden)
+		assert.ErrorIs(t, store.Remove(carol, doc.Key), ErrForbidden)
+		assert.ErrorIs(t, store.SetACL(carol, doc.Key, ACL{Owner: "carol"}), ErrForbidden)
+		exists, err := store.Exists(alice, doc.Key)
+		require.NoError(t, err)
+		assert.True(t, exists)
+	})
+
+	t.Run("Should deny other principals on all keyed entry points", func(t *testing.T) {
+		_, err := store.AddAndGetPrevious(carol, doc, 0)
+		assert.ErrorIs(t, err, ErrForbidden)
+		_, err = store.RemoveIf(carol, doc.Key, func(*testutil.Entity) bool { return true })
+		assert.ErrorIs(t, err, ErrForbidden)
+		_, err = store.Exists(carol, doc.Key)
+		assert.ErrorIs(t, err, ErrForbidden)
+		_, err = store.TouchIfLonger(carol, doc.Key, time.Hour)
+		assert.ErrorIs(t, err, ErrForbidden)
+		_, err = store.RemoveCascade(carol, doc.Key)
+		assert.ErrorIs(t, err, ErrForbidden)
+
+		result, err := store.AddBatchPartial(carol, []testutil.Entity{public, doc}, 0)
+		require.NoError(t, err)
+		assert.NoError(t, result.Items[0].Err)
+		assert.ErrorIs(t, result.Items[1].Err, ErrForbidden)
+		entities, result, err := store.GetByKeysPartial(carol, []string{public.Key, doc.Key})
+		require.NoError(t, err)
+		assert.Len(t, entities, 1)
+		assert.NoError(t, result.Items[0].Err)
+		assert.ErrorIs(t, result.Items[1].Err, ErrForbidden)
+
+		exists, err := store.Exists(alice, doc.Key)
+		require.NoError(t, err)
+		assert.True(t, exists, "should not remove denied entity")
+	})
+
+	t.Run("Should deny other principals on bulk writes", func(t *testing.T) {
+		var buf bytes.Buffer
+		_, err := store.Export(ctx, mockTenantKey, &buf)
+		require.NoError(t, err)
+		_, err = store.Import(carol, &buf)
+		assert.ErrorIs(t, err, ErrForbidden)
+
+		progress, err := store.UpdateWhere(carol, mockTenantKey,
+			func(*testutil.Entity) bool { return true },
+			func(e *testutil.Entity) { e.Data = "carol" },
+		)
+		require.NoError(t, err)
+		assert.Equal(t, 2, progress.Matched)
+		assert.Equal(t, 1, progress.Updated)
+		assert.Equal(t, 1, progress.Denied)
+		got, err := store.Get(alice, doc.Key)
+		require.NoError(t, err)
+		assert.Empty(t, got.Data, "should not update denied entity")
+
+		latestKey, err := store.LatestEntityKey("doc-v", mockTenantKey)
+		require.NoError(t, err)
+		require.NoError(t, store.SetACL(alice, latestKey, ACL{Owner: "alice"}))
+		versionKey, err := store.EntityKey("doc-v", "1", mockTenantKey)
+		require.NoError(t, err)
+		err = store.PublishVersion(carol, testutil.Entity{Key: versionKey, ID: "doc-v"})
+		assert.ErrorIs(t, err, ErrForbidden, "should deny publishing over a denied alias")
+		exists, err := store.Exists(alice, versionKey)
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("Should not claim entities without ACL", func(t *testing.T) {
+		assert.ErrorIs(t, store.SetACL(carol, public.Key, ACL{Owner: "carol"}), ErrForbidden)
+		acl, err := store.GetACL(ctx, public.Key)
+		require.NoError(t, err)
+		assert.Nil(t, acl)
+
+		key := testutil.NewEntity("doc-3", mockTenantId, 1).Key
+		require.NoError(t, store.SetACL(carol, key, ACL{Owner: "carol"}))
+		assert.ErrorIs(t, store.SetACL(bob, key, ACL{Owner: "bob"}), ErrForbidden)
+		require.NoError(t, store.SetACL(carol, key, ACL{Owner: "carol", Roles: []string{"editor"}}))
+		require.NoError(t, store.SetACL(bob, key, ACL{Owner: "bob"}), "should allow roles of the ACL")
+	})
+
+	t.Run("Should allow entities without ACL", func(t *testing.T) {
+		got, err := store.Get(carol, public.Key)
+		require.NoError(t, err)
+		assert.Equal(t, public.Key, got.Key)
+		acl, err := store.GetACL(ctx, public.Key)
+		require.NoError(t, err)
+		assert.Nil(t, acl)
+	})
+
+	t.Run("Should remove ACL with entity", func(t *testing.T) {
+		require.NoError(t, store.Remove(alice, doc.Key))
+		acl, err := store.GetACL(ctx, doc.Key)
+		require.NoError(t, err)
+		assert.Nil(t, acl)
+		_, err = store.Add(carol, doc, 0)
+		assert.NoError(t, err, "should not inherit ACL of removed entity")
+	})
+
+	t.Run("Should not scan ACLs as entities", func(t *testing.T) {
+		entities, err := store.GetAll(ctx, mockTenantKey)
+		require.NoError(t, err)
+		assert.Len(t, entities, 2)
+	})
+}
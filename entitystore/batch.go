@@ -0,0 +1,281 @@
+package entitystore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+// BatchItemResult is the outcome of a single item in a batch operation.
+type BatchItemResult struct {
+	Key string // Entity key of the item.
+	Err error  // Nil if the item was processed successfully.
+}
+
+// BatchResult reports the per-item outcome of a batch operation.
+// Items are in the same order as the batch input.
+type BatchResult struct {
+	Items []BatchItemResult
+}
+
+// Succeeded returns the keys of all items processed successfully.
+func (r *BatchResult) Succeeded() []string {
+	keys := make([]string, 0, len(r.Items))
+	for _, item := range r.Items {
+		if item.Err == nil {
+			keys = append(keys, item.Key)
+		}
+	}
+	return keys
+}
+
+// Failed returns all items that failed.
+func (r *BatchResult) Failed() []BatchItemResult {
+	var failed []BatchItemResult
+	for _, item := range r.Items {
+		if item.Err != nil {
+			failed = append(failed, item)
+		}
+	}
+	return failed
+}
+
+// Err returns the joined errors of all failed items, or nil if all items succeeded.
+func (r *BatchResult) Err() error {
+	var errs []error
+	for _, item := range r.Items {
+		if item.Err != nil {
+			errs = append(errs, fmt.Errorf("entity '%s': %w", item.Key, item.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// AddBatchPartial is like AddBatch, but an invalid entity doesn't abort the batch.
+// Entities that fail key validation, marshaling, or collision detection are reported in the
+// result and skipped, all other entities are written to the store. Duplicates dropped by the
+// dedup policy are reported with an error wrapping ErrDuplicateKey.
+//
+// The returned error is only non-nil if the batch write itself failed.
+func (es *EntityStore[T, PT]) AddBatchPartial(
+	ctx context.Context,
+	entities []T,
+	expiration time.Duration,
+) (*BatchResult, error) {
+	result := &BatchResult{Items: make([]BatchItemResult, len(entities))}
+	if len(entities) == 0 {
+		return result, nil // No-op for empty batch.
+	}
+
+	kb := es.NewKeyBuilder()
+	keys := make([]*keyfactory.Key, 0, len(entities))
+	ptrs := make([]PT, 0, len(entities))
+	items := make([]int, 0, len(entities)) // Result item index of each valid entity.
+	dropped, _ := es.duplicates(entities)
+	for i, entity := range entities {
+		result.Items[i].Key = entity.GetKey()
+		if dropped != nil && dropped[i] {
+			result.Items[i].Err = ErrDuplicateKey
+			continue
+		}
+		if err := es.checkParentKey(ctx, entity.GetKey()); err != nil {
+			result.Items[i].Err = err
+			continue
+		}
+		kb.WithKey(entity.GetKey())
+		key, err := kb.BuildAndReset()
+		if err != nil {
+			result.Items[i].Err = err
+			continue
+		}
+		keys = append(keys, key)
+		ptrs = append(ptrs, PT(&entity))
+		items = append(items, i)
+	}
+	encoded, errs, release := es.encodeBatch(ptrs)
+	defer release()
+	entityKeys := make([]string, 0, len(keys))
+	data := make([][]byte, 0, len(keys))
+	n := 0
+	for j, err := range errs {
+		if err != nil {
+			result.Items[items[j]].Err = err
+			continue
+		}
+		keys[n], ptrs[n], items[n] = keys[j], ptrs[j], items[j]
+		entityKeys = append(entityKeys, ptrs[j].GetKey())
+		data = append(data, encoded[j])
+		n++
+	}
+	keys, ptrs, items = keys[:n], ptrs[:n], items[:n]
+	if len(keys) == 0 {
+		return result, nil // No valid entities.
+	}
+	denied, err := es.authorizeAligned(ctx, AccessWrite, entityKeys)
+	if err != nil {
+		return nil, err
+	}
+	if denied != nil {
+		n = 0
+		for j, err := range denied {
+			if err != nil {
+				result.Items[items[j]].Err = err
+				continue
+			}
+			keys[n], ptrs[n], items[n], entityKeys[n], data[n] = keys[j], ptrs[j], items[j], entityKeys[j], data[j]
+			n++
+		}
+		keys, ptrs, items, entityKeys, data = keys[:n], ptrs[:n], items[:n], entityKeys[:n], data[:n]
+		if len(keys) == 0 {
+			return result, nil // No authorized entities.
+		}
+	}
+	collisions, err := es.collisions(ctx, keys, ptrs)
+	if err != nil {
+		return nil, err
+	}
+	if collisions != nil {
+		n = 0
+		for j, err := range collisions {
+			if err != nil {
+				result.Items[items[j]].Err = err
+				continue
+			}
+			keys[n], ptrs[n], entityKeys[n], data[n] = keys[j], ptrs[j], entityKeys[j], data[j]
+			n++
+		}
+		keys, ptrs, entityKeys, data = keys[:n], ptrs[:n], entityKeys[:n], data[:n]
+		if len(keys) == 0 {
+			return result, nil // No valid entities.
+		}
+	}
+	previous, err := es.loadPrevious(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	if err := es.putMulti(ctx, keys, data, expiration); err != nil {
+		return nil, err
+	}
+	if err := es.indexAdd(ctx, ptrs...); err != nil {
+		return nil, err
+	}
+	es.observeSizes(ctx, entityKeys, data)
+	es.onAdded.emit(ctx, entityKeys)
+	es.emitUpdates(ctx, previous, ptrs)
+	es.checkQuotas(ctx, entityKeys)
+	return result, nil
+}
+
+// GetByKeysPartial is like GetByKeys, but an invalid key or corrupt entity doesn't abort the batch.
+// Keys not found in the store are reported with an error wrapping datastore.ErrKeyNotFound.
+// The returned entities only contain the successfully retrieved entities in key order.
+//
+// The returned error is only non-nil if the batch read itself failed.
+func (es *EntityStore[T, PT]) GetByKeysPartial(
+	ctx context.Context,
+	entityKeys []string,
+) ([]PT, *BatchResult, error) {
+	result := &BatchResult{Items: make([]BatchItemResult, len(entityKeys))}
+	if len(entityKeys) == 0 {
+		return nil, result, nil // No-op for empty slice of keys.
+	}
+
+	kb := es.NewKeyBuilder()
+	keys := make([]*keyfactory.Key, 0, len(entityKeys))
+	indexes := make([]int, 0, len(entityKeys)) // Maps a key to its batch item index.
+	for i, eKey := range entityKeys {
+		result.Items[i].Key = eKey
+		kb.WithKey(eKey)
+		key, err := kb.BuildAndReset()
+		if err != nil {
+			result.Items[i].Err = err
+			continue
+		}
+		keys = append(keys, key)
+		indexes = append(indexes, i)
+	}
+	if len(keys) == 0 {
+		return nil, result, nil // No valid keys.
+	}
+	readKeys := make([]string, len(indexes))
+	for i, idx := range indexes {
+		readKeys[i] = entityKeys[idx]
+	}
+	denied, err := es.authorizeAligned(ctx, AccessRead, readKeys)
+	if err != nil {
+		return nil, nil, err
+	}
+	if denied != nil {
+		n := 0
+		for i, err := range denied {
+			if err != nil {
+				result.Items[indexes[i]].Err = err
+				continue
+			}
+			keys[n], indexes[n] = keys[i], indexes[i]
+			n++
+		}
+		keys, indexes = keys[:n], indexes[:n]
+		if len(keys) == 0 {
+			return nil, result, nil // No authorized keys.
+		}
+	}
+
+	data, err := es.getMultiAligned(ctx, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	es.countReads(data)
+	entities := make([]PT, 0, len(data))
+	for i, d := range data {
+		item := &result.Items[indexes[i]]
+		if d == nil {
+			item.Err = datastore.ErrKeyNotFound
+			continue
+		}
+		entity := PT(new(T))
+		if err := es.decode(item.Key, d, entity); err != nil {
+			item.Err = err
+			continue
+		}
+		entities = append(entities, entity)
+	}
+	return entities, result, nil
+}
+
+// RemoveByKeysPartial is like RemoveByKeys, but an invalid key doesn't abort the batch.
+// Invalid keys are reported in the result and skipped, all other keys are removed from the store.
+//
+// The returned error is only non-nil if the batch delete itself failed.
+func (es *EntityStore[T, PT]) RemoveByKeysPartial(ctx context.Context, entityKeys []string) (*BatchResult, error) {
+	result := &BatchResult{Items: make([]BatchItemResult, len(entityKeys))}
+	if len(entityKeys) == 0 {
+		return result, nil // No-op for empty keys.
+	}
+
+	kb := es.NewKeyBuilder()
+	keys := make([]*keyfactory.Key, 0, len(entityKeys))
+	removedKeys := make([]string, 0, len(entityKeys))
+	for i, eKey := range entityKeys {
+		result.Items[i].Key = eKey
+		kb.WithKey(eKey)
+		key, err := kb.BuildAndReset()
+		if err != nil {
+			result.Items[i].Err = err
+			continue
+		}
+		keys = append(keys, key)
+		removedKeys = append(removedKeys, eKey)
+	}
+	if len(keys) == 0 {
+		return result, nil // No valid keys.
+	}
+	if _, err := es.removeKeys(ctx, removedKeys, keys); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
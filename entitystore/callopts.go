@@ -0,0 +1,114 @@
+package entitystore
+
+import (
+	"context"
+	"time"
+
+	"github.com/holmberd/go-entitystore/datastore"
+)
+
+// CallOption configures a single call of Get, Add, or Remove, so behaviors can be added to
+// the calls without changing the EntityStorer interface. Options not applicable to a call,
+// or to a store implementation, are ignored.
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	numReplicas    int
+	replicaTimeout time.Duration
+	skipCache      bool
+	readPrimary    bool
+	skipEvents     bool
+	ttl            time.Duration
+	hasTTL         bool
+	dryRun         bool
+	retries        int
+	hasRetries     bool
+}
+
+func newCallOptions(opts []CallOption) callOptions {
+	var o callOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithConsistency makes the write wait until it's acknowledged by at least the number of replicas,
+// or the timeout expires (see datastore.WithSyncReplication). Applies to Add and Remove.
+func WithConsistency(numReplicas int, timeout time.Duration) CallOption {
+	return func(o *callOptions) {
+		o.numReplicas = numReplicas
+		o.replicaTimeout = timeout
+	}
+}
+
+// SkipCache bypasses the entities cached by a store decorator, e.g. the stale entities served
+// by DegradingStore during an outage. Applies to Get.
+func SkipCache() CallOption {
+	return func(o *callOptions) {
+		o.skipCache = true
+	}
+}
+
+// ReadPrimary serves the read by the primary only, never by a lagging replica of hedged reads
+// (see datastore.WithPrimaryReads). Applies to Get.
+func ReadPrimary() CallOption {
+	return func(o *callOptions) {
+		o.readPrimary = true
+	}
+}
+
+// SkipEvents doesn't trigger the store events of the call, e.g. for writes made by a replicator
+// that would otherwise be replicated back. Applies to Add and Remove.
+func SkipEvents() CallOption {
+	return func(o *callOptions) {
+		o.skipEvents = true
+	}
+}
+
+// WithTTL overrides the expiration passed to the call, where 0 means no expiration. Applies to Add.
+func WithTTL(expiration time.Duration) CallOption {
+	return func(o *callOptions) {
+		o.ttl = expiration
+		o.hasTTL = true
+	}
+}
+
+// DryRun validates the call without writing to the store, e.g. that the entity key is valid and the
+// entity encodes within the size limit, or that the entity isn't referenced. Applies to Add and Remove.
+func DryRun() CallOption {
+	return func(o *callOptions) {
+		o.dryRun = true
+	}
+}
+
+// WithRetries sets the max number of times the call is retried on conflicting concurrent writes.
+// Applies to UpdateWithRetry.
+func WithRetries(retries int) CallOption {
+	return func(o *callOptions) {
+		o.retries = retries
+		o.hasRetries = true
+	}
+}
+
+type skipEventsKey struct{}
+
+// context returns the context of the call with the options applied.
+func (o callOptions) context(ctx context.Context) context.Context {
+	if o.numReplicas > 0 {
+		ctx = datastore.WithSyncReplication(ctx, o.numReplicas, o.replicaTimeout)
+	}
+	if o.skipEvents {
+		ctx = context.WithValue(ctx, skipEventsKey{}, true)
+	}
+	if o.readPrimary {
+		ctx = datastore.WithPrimaryReads(ctx)
+	}
+	return ctx
+}
+
+// eventsSkipped returns whether the events of the call with the context are skipped (see SkipEvents).
+func eventsSkipped(ctx context.Context) bool {
+	skip, _ := ctx.Value(skipEventsKey{}).(bool)
+	return skip
+}
@@ -0,0 +1,173 @@
+package entitystore
+
+import (
+	"context"
+	"slices"
+
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+// CascadeStep is a removal of entities by RemoveCascade.
+type CascadeStep struct {
+	Reference string   // Name of the reference to the removed entities, or empty for the removed entity.
+	Keys      []string // Keys of the entities.
+}
+
+// CascadeReport is the report of a RemoveCascade call.
+type CascadeReport struct {
+	Steps     []CascadeStep // Removals in dependency order, i.e. dependents before the entities they reference.
+	Nullified []CascadeStep // Entities referencing removed entities by a reference with OnDeleteNullify.
+	Removed   int           // Number of entities removed, or 0 for a dry run.
+}
+
+// CascadeOption configures a RemoveCascade call.
+type CascadeOption func(*cascadeOptions)
+
+type cascadeOptions struct {
+	dryRun bool
+}
+
+// WithDryRun reports the entities RemoveCascade would remove, without removing them.
+func WithDryRun() CascadeOption {
+	return func(o *cascadeOptions) {
+		o.dryRun = true
+	}
+}
+
+// cascadeNode is a planned removal of RemoveCascade.
+type cascadeNode struct {
+	step      CascadeStep
+	authorize func(ctx context.Context, entityKeys []string) error
+	remove    func(ctx context.Context, entityKeys []string) (int, error)
+}
+
+// RemoveCascade removes the entity and all entities depending on it by references with OnDeleteCascade
+// across stores (see AddReference), recursively. All dependents are resolved before any entity is
+// removed, so a dependent referenced by a reference with OnDeleteBlock fails the removal with an error
+// wrapping ErrReferenced without removing any entity. The write access to all entities of the
+// cascade is authorized before any entity is removed (see WithAuthorizer). Entities are then removed
+// in dependency order, i.e. dependents before the entities they reference, in chunks per store.
+// Entities referencing removed entities by a reference with OnDeleteNullify are reported to its
+// OnNullify event once all entities are removed.
+//
+// NOTE: Entities added concurrently may reference removed entities, use Reference.Check to find them.
+func (es *EntityStore[T, PT]) RemoveCascade(
+	ctx context.Context,
+	entityKey string,
+	opts ...CascadeOption,
+) (CascadeReport, error) {
+	var o cascadeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	var report CascadeReport
+	if entityKey == "" {
+		return report, nil // No-op for empty key.
+	}
+
+	nodes := []cascadeNode{{
+		step:      CascadeStep{Keys: []string{entityKey}},
+		authorize: es.authorizeWrite,
+		remove:    es.removeCascaded,
+	}}
+	if err := es.authorizeWrite(ctx, []string{entityKey}); err != nil {
+		return report, err
+	}
+	visited := map[any]map[string]struct{}{any(es): {entityKey: {}}}
+	var nullified []referenceDependents
+	deps, err := es.dependents(ctx, []string{entityKey})
+	if err != nil {
+		return report, err
+	}
+	for len(deps) > 0 {
+		var next []referenceDependents
+		for _, d := range deps {
+			if d.ref.onDelete() == OnDeleteNullify {
+				nullified = append(nullified, d)
+				continue
+			}
+			seen := visited[d.ref.from()]
+			if seen == nil {
+				seen = make(map[string]struct{})
+				visited[d.ref.from()] = seen
+			}
+			keys := slices.DeleteFunc(d.keys, func(key string) bool {
+				_, ok := seen[key]
+				return ok
+			})
+			if len(keys) == 0 {
+				continue // Already removed by the cascade, e.g. a reference cycle.
+			}
+			for _, key := range keys {
+				seen[key] = struct{}{}
+			}
+			nodes = append(nodes, cascadeNode{
+				step:      CascadeStep{Reference: d.ref.referenceName(), Keys: keys},
+				authorize: d.ref.authorizeReferencing,
+				remove:    d.ref.removeReferencingCascaded,
+			})
+			fromDeps, err := d.ref.fromDependents(ctx, keys)
+			if err != nil {
+				return report, err
+			}
+			next = append(next, fromDeps...)
+		}
+		deps = next
+	}
+
+	for _, n := range nodes[1:] { // The removed entity is authorized before resolving its dependents.
+		if err := n.authorize(ctx, n.step.Keys); err != nil {
+			return report, err
+		}
+	}
+	for i := len(nodes) - 1; i >= 0; i-- {
+		report.Steps = append(report.Steps, nodes[i].step)
+	}
+	for _, d := range nullified {
+		report.Nullified = append(report.Nullified, CascadeStep{Reference: d.ref.referenceName(), Keys: d.keys})
+	}
+	if o.dryRun {
+		return report, nil
+	}
+	for i := len(nodes) - 1; i >= 0; i-- {
+		n, err := nodes[i].remove(ctx, nodes[i].step.Keys)
+		report.Removed += n
+		if err != nil {
+			return report, err
+		}
+	}
+	for _, d := range nullified {
+		d.ref.nullify(ctx, d.keys)
+	}
+	return report, nil
+}
+
+// authorizeWrite returns an error wrapping ErrForbidden if the context may not write any of the
+// entity keys, e.g. to authorize a cascading removal.
+func (es *EntityStore[T, PT]) authorizeWrite(ctx context.Context, entityKeys []string) error {
+	return es.authorize(ctx, AccessWrite, entityKeys)
+}
+
+// removeCascaded removes the entities of the keys authorized by RemoveCascade in chunks, without
+// handling their references.
+func (es *EntityStore[T, PT]) removeCascaded(ctx context.Context, entityKeys []string) (int, error) {
+	n := 0
+	for chunk := range slices.Chunk(entityKeys, defaultScanChunkSize) {
+		keys := make([]*keyfactory.Key, len(chunk))
+		kb := es.NewKeyBuilder()
+		for i, eKey := range chunk {
+			kb.WithKey(eKey)
+			key, err := kb.BuildAndReset()
+			if err != nil {
+				return n, err
+			}
+			keys[i] = key
+		}
+		removed, err := es.deleteKeys(ctx, chunk, keys, es.deleteAligned)
+		n += len(removed)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
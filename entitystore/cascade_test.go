@@ -0,0 +1,163 @@
+package entitystore
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntityStoreRemoveCascade(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	type store = EntityStore[testutil.Entity, *testutil.Entity]
+	refs := func(e *testutil.Entity) []string { return []string{e.Data} }
+	newStore := func(t *testing.T) *store {
+		t.Helper()
+		s, err := New[testutil.Entity](string(keyfactory.EntityKindTest), keyfactory.GenerateRandomKey(), dsClient)
+		require.NoError(t, err)
+		return s
+	}
+	add := func(t *testing.T, s *store, id, ref string) string {
+		t.Helper()
+		e := testutil.NewEntity(id, mockTenantId, 1)
+		e.Data = ref
+		_, err := s.Add(ctx, e, 0)
+		require.NoError(t, err)
+		return e.Key
+	}
+	exists := func(t *testing.T, s *store, key string) bool {
+		t.Helper()
+		ok, err := s.Exists(ctx, key)
+		require.NoError(t, err)
+		return ok
+	}
+	// newGraph returns products with orders and invoices referencing them, and shipments referencing orders.
+	newGraph := func(t *testing.T) (products, orders, shipments, invoices *store, nullified *[]string) {
+		t.Helper()
+		products, orders, shipments, invoices = newStore(t), newStore(t), newStore(t), newStore(t)
+		_, err := AddReference("order-product", orders, products, refs, OnDeleteCascade)
+		require.NoError(t, err)
+		_, err = AddReference("shipment-order", shipments, orders, refs, OnDeleteCascade)
+		require.NoError(t, err)
+		ref, err := AddReference("invoice-product", invoices, products, refs, OnDeleteNullify)
+		require.NoError(t, err)
+		nullified = new([]string)
+		ref.OnNullify().AddListener(func(ctx context.Context, keys []string) {
+			*nullified = append(*nullified, keys...)
+		})
+		return products, orders, shipments, invoices, nullified
+	}
+
+	products, orders, shipments, invoices, nullified := newGraph(t)
+	p1 := add(t, products, "p-1", "")
+	p2 := add(t, products, "p-2", "")
+	o1, o2 := add(t, orders, "o-1", p1), add(t, orders, "o-2", p1)
+	o3 := add(t, orders, "o-3", p2)
+	s1 := add(t, shipments, "s-1", o1)
+	i1 := add(t, invoices, "i-1", p1)
+
+	t.Run("Should report the removal without removing in a dry run", func(t *testing.T) {
+		report, err := products.RemoveCascade(ctx, p1, WithDryRun())
+		require.NoError(t, err)
+		assert.Equal(t, []CascadeStep{
+			{Reference: "shipment-order", Keys: []string{s1}},
+			{Reference: "order-product", Keys: []string{o1, o2}},
+			{Keys: []string{p1}},
+		}, sortedSteps(report.Steps))
+		assert.Equal(t, []CascadeStep{{Reference: "invoice-product", Keys: []string{i1}}}, report.Nullified)
+		assert.Zero(t, report.Removed)
+		assert.True(t, exists(t, products, p1))
+		assert.True(t, exists(t, shipments, s1))
+		assert.Empty(t, *nullified)
+	})
+
+	t.Run("Should remove dependents in dependency order", func(t *testing.T) {
+		var order []string
+		for _, s := range []*store{products, orders, shipments} {
+			s.OnRemoved().AddListener(func(ctx context.Context, keys []string) {
+				order = append(order, keys...)
+			})
+		}
+		report, err := products.RemoveCascade(ctx, p1)
+		require.NoError(t, err)
+		assert.Equal(t, 4, report.Removed)
+		require.Len(t, order, 4)
+		assert.Equal(t, s1, order[0])
+		assert.ElementsMatch(t, []string{o1, o2}, order[1:3])
+		assert.Equal(t, p1, order[3])
+		assert.True(t, exists(t, orders, o3), "should keep entities not depending on the removed entity")
+		assert.True(t, exists(t, products, p2))
+		assert.True(t, exists(t, invoices, i1), "should not remove nullified entities")
+		assert.Equal(t, []string{i1}, *nullified)
+	})
+
+	t.Run("Should fail without removing on blocking references", func(t *testing.T) {
+		products, orders, shipments, _, _ := newGraph(t)
+		p1 := add(t, products, "p-1", "")
+		o1 := add(t, orders, "o-1", p1)
+		s1 := add(t, shipments, "s-1", o1)
+		returns := newStore(t)
+		_, err := AddReference("return-order", returns, orders, refs, OnDeleteBlock)
+		require.NoError(t, err)
+		add(t, returns, "r-1", o1)
+
+		_, err = products.RemoveCascade(ctx, p1)
+		assert.ErrorIs(t, err, ErrReferenced)
+		assert.True(t, exists(t, products, p1))
+		assert.True(t, exists(t, orders, o1))
+		assert.True(t, exists(t, shipments, s1))
+	})
+
+	t.Run("Should fail without removing on forbidden dependents", func(t *testing.T) {
+		products := newStore(t)
+		orders, err := New[testutil.Entity](
+			string(keyfactory.EntityKindTest),
+			keyfactory.GenerateRandomKey(),
+			dsClient,
+			WithAuthorizer(ACLAuthorizer(principalFromContext)),
+		)
+		require.NoError(t, err)
+		_, err = AddReference("order-product", orders, products, refs, OnDeleteCascade)
+		require.NoError(t, err)
+		alice := withPrincipal(ctx, Principal{ID: "alice"})
+		bob := withPrincipal(ctx, Principal{ID: "bob"})
+		p1 := add(t, products, "p-1", "")
+		o1 := testutil.NewEntity("o-1", mockTenantId, 1)
+		o1.Data = p1
+		require.NoError(t, orders.SetACL(alice, o1.Key, ACL{Owner: "alice"}))
+		_, err = orders.Add(alice, o1, 0)
+		require.NoError(t, err)
+
+		_, err = products.RemoveCascade(bob, p1, WithDryRun())
+		assert.ErrorIs(t, err, ErrForbidden)
+		report, err := products.RemoveCascade(bob, p1)
+		assert.ErrorIs(t, err, ErrForbidden)
+		assert.Zero(t, report.Removed)
+		assert.True(t, exists(t, products, p1))
+		ok, err := orders.Exists(alice, o1.Key)
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		report, err = products.RemoveCascade(alice, p1)
+		require.NoError(t, err)
+		assert.Equal(t, 2, report.Removed)
+	})
+}
+
+// sortedSteps returns the steps with their keys sorted.
+func sortedSteps(steps []CascadeStep) []CascadeStep {
+	for _, s := range steps {
+		slices.Sort(s.Keys)
+	}
+	return steps
+}
@@ -0,0 +1,141 @@
+package entitystore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+const (
+	changeLogKeyPrefix   = "changelog"            // Key prefix of the store change log.
+	changeLogReadCount   = 100                    // Number of change log entries read per round trip.
+	changeLogBlock       = time.Second            // Max duration of a blocking change log read.
+	changeLogStart       = "0"                    // Change log ID before the first entry.
+	maxChangeLogSequence = "18446744073709551615" // Max sequence number of change log IDs of a millisecond.
+)
+
+// ChangeLogEntry is an entry of the store change log (see WithChangeLog).
+type ChangeLogEntry struct {
+	ID    string   // Change log ID of the entry, ordered by append time.
+	Event Event    // Event of the entry.
+	Keys  []string // Keys of the event.
+}
+
+// ChangeLogListener is called with the change log entries replayed by ReplayChangeLog.
+// Returning an error stops the replay.
+type ChangeLogListener func(ctx context.Context, entry ChangeLogEntry) error
+
+// ChangeLogIDAt returns the change log ID of the time, for replaying the entries appended after it.
+func ChangeLogIDAt(t time.Time) string {
+	ms := t.UnixMilli()
+	if ms <= 0 {
+		return changeLogStart
+	}
+	return strconv.FormatInt(ms-1, 10) + "-" + maxChangeLogSequence
+}
+
+// changeLogKey returns the key of the store change log.
+func (es *EntityStore[T, PT]) changeLogKey() *keyfactory.Key {
+	return keyfactory.NewKey(keyfactory.BuildRedisKey(changeLogKeyPrefix, es.entityKind), es.namespace)
+}
+
+// enableChangeLog appends the store events to the change log.
+func (es *EntityStore[T, PT]) enableChangeLog() {
+	for event, target := range map[Event]*eventTarget{
+		EntitiesAdded:   es.onAdded,
+		EntitiesUpdated: es.onUpdated,
+		EntitiesRemoved: es.onRemoved,
+		EntitiesFlushed: es.onFlushed,
+	} {
+		target.AddListener(func(ctx context.Context, keys []string) {
+			if err := es.appendChangeLog(ctx, event, keys); err != nil {
+				es.opts.corruptionHandler(fmt.Errorf("failed to append %s event to change log: %w", event, err))
+			}
+		})
+	}
+}
+
+// appendChangeLog appends the event to the change log.
+func (es *EntityStore[T, PT]) appendChangeLog(ctx context.Context, event Event, keys []string) error {
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+	_, err = es.dsClient.LogAppend(ctx, es.changeLogKey(), es.opts.changeLogMaxLen, map[string]any{
+		"event": int(event),
+		"keys":  data,
+	})
+	return err
+}
+
+// ReadChangeLog reads up to count entries of the change log appended after the ID,
+// where an empty ID reads from the start of the change log (see ChangeLogIDAt).
+func (es *EntityStore[T, PT]) ReadChangeLog(ctx context.Context, afterID string, count int) ([]ChangeLogEntry, error) {
+	return es.readChangeLog(ctx, afterID, count, -1)
+}
+
+func (es *EntityStore[T, PT]) readChangeLog(
+	ctx context.Context,
+	afterID string,
+	count int,
+	block time.Duration,
+) ([]ChangeLogEntry, error) {
+	if es.opts.changeLogMaxLen == 0 {
+		return nil, errors.New("entitystore: change log not enabled")
+	}
+	if afterID == "" {
+		afterID = changeLogStart
+	}
+	logEntries, err := es.dsClient.LogRead(ctx, es.changeLogKey(), afterID, int64(count), block)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]ChangeLogEntry, len(logEntries))
+	for i, le := range logEntries {
+		eventValue, _ := le.Values["event"].(string)
+		keysValue, _ := le.Values["keys"].(string)
+		event, err := strconv.Atoi(eventValue)
+		if err == nil {
+			entries[i] = ChangeLogEntry{ID: le.ID, Event: Event(event)}
+			err = json.Unmarshal([]byte(keysValue), &entries[i].Keys)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: change log entry '%s': %w", datastore.ErrCorruptedData, le.ID, err)
+		}
+	}
+	return entries, nil
+}
+
+// ReplayChangeLog calls the listener with the change log entries appended after the ID, e.g. to catch
+// up a new search indexer, and then with the entries appended by any store sharing the change log as
+// they are appended, until the context is done or the listener returns an error. Each entry is passed
+// to the listener once, in change log order, so no events are missed or duplicated when switching
+// from the replayed to the live entries. An empty ID replays the whole change log (see ChangeLogIDAt).
+//
+// NOTE: Entries trimmed from the change log (see WithChangeLog) can't be replayed.
+func (es *EntityStore[T, PT]) ReplayChangeLog(ctx context.Context, afterID string, listener ChangeLogListener) error {
+	for {
+		entries, err := es.readChangeLog(ctx, afterID, changeLogReadCount, changeLogBlock)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		for _, entry := range entries {
+			if err := listener(ctx, entry); err != nil {
+				return err
+			}
+			afterID = entry.ID
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package entitystore
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntityStoreChangeLog(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	namespace := keyfactory.GenerateRandomKey()
+	store, err := New[testutil.Entity](string(keyfactory.EntityKindTest), namespace, dsClient, WithChangeLog(100))
+	require.NoError(t, err)
+	e1, e2, e3 := testutil.NewEntity("e-1", mockTenantId, 1), testutil.NewEntity("e-2", mockTenantId, 1), testutil.NewEntity("e-3", mockTenantId, 1)
+	_, err = store.Add(ctx, e1, 0)
+	require.NoError(t, err)
+	require.NoError(t, store.Remove(ctx, e1.Key))
+
+	entries, err := store.ReadChangeLog(ctx, "", 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, EntitiesAdded, entries[0].Event)
+	assert.Equal(t, []string{e1.Key}, entries[0].Keys)
+	assert.Equal(t, EntitiesRemoved, entries[1].Event)
+	entries, err = store.ReadChangeLog(ctx, entries[0].ID, 10)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "should read entries after the ID")
+	all, err := store.GetAll(ctx, mockTenantKey)
+	require.NoError(t, err)
+	assert.Empty(t, all, "should not treat the change log as an entity")
+
+	t.Run("Should replay and switch to live entries", func(t *testing.T) {
+		var mu sync.Mutex
+		var replayed []ChangeLogEntry
+		replayCtx, cancel := context.WithCancel(ctx)
+		done := make(chan error, 1)
+		go func() {
+			done <- store.ReplayChangeLog(replayCtx, "", func(ctx context.Context, entry ChangeLogEntry) error {
+				mu.Lock()
+				defer mu.Unlock()
+				replayed = append(replayed, entry)
+				return nil
+			})
+		}()
+		_, err := store.AddBatch(ctx, []testutil.Entity{e2, e3}, 0)
+		require.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(replayed) == 3
+		}, 5*time.Second, 10*time.Millisecond)
+		cancel()
+		assert.ErrorIs(t, <-done, context.Canceled)
+		assert.Equal(t, []string{e1.Key}, replayed[1].Keys)
+		assert.Equal(t, []string{e2.Key, e3.Key}, replayed[2].Keys)
+		assert.Less(t, replayed[1].ID, replayed[2].ID)
+	})
+
+	t.Run("ChangeLogIDAt", func(t *testing.T) {
+		entries, err := store.ReadChangeLog(ctx, ChangeLogIDAt(time.Now().Add(time.Hour)), 10)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+		entries, err = store.ReadChangeLog(ctx, ChangeLogIDAt(time.Now().Add(-time.Hour)), 10)
+		require.NoError(t, err)
+		assert.Len(t, entries, 3)
+	})
+
+	t.Run("Should require the change log", func(t *testing.T) {
+		plain, err := New[testutil.Entity](string(keyfactory.EntityKindTest), namespace, dsClient)
+		require.NoError(t, err)
+		_, err = plain.ReadChangeLog(ctx, "", 10)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,187 @@
+package entitystore
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/encoder"
+	"github.com/holmberd/go-entitystore/metrics"
+)
+
+const (
+	checksumSize         = 4       // Size in bytes of the CRC32 checksum suffix.
+	DefaultMaxEntitySize = 1 << 20 // Default max size in bytes of a serialized entity (1 MiB).
+
+	MetricEntitySize    = "entitystore_entity_size_bytes"    // Histogram of written entity sizes.
+	MetricLargeEntities = "entitystore_large_entities_total" // Counter of written entities exceeding the large entity threshold.
+)
+
+// ErrEntityTooLarge is matched by every EntityTooLargeError using errors.Is.
+var ErrEntityTooLarge = errors.New("entitystore: entity too large")
+
+// EntityTooLargeError is returned when a serialized entity exceeds the store max entity size.
+type EntityTooLargeError struct {
+	Key     string // Entity key.
+	Size    int    // Serialized size in bytes.
+	MaxSize int    // Max allowed size in bytes.
+}
+
+func (e *EntityTooLargeError) Error() string {
+	return fmt.Sprintf("entitystore: entity '%s' size %d bytes exceeds max size %d bytes", e.Key, e.Size, e.MaxSize)
+}
+
+func (e *EntityTooLargeError) Is(target error) bool { return target == ErrEntityTooLarge }
+
+var crc32Table = crc32.MakeTable(crc32.Castagnoli)
+
+// encode marshals the entity into the value written to the datastore.
+func (es *EntityStore[T, PT]) encode(entity PT) ([]byte, error) {
+	return es.encodeAppend(nil, entity)
+}
+
+// encodeAppend is like encode, but appends the value to the buffer.
+func (es *EntityStore[T, PT]) encodeAppend(buf []byte, entity PT) ([]byte, error) {
+	data, err := es.encodePlaintext(buf, entity)
+	if err != nil {
+		return nil, err
+	}
+	if es.opts.keyring != nil {
+		if data, err = es.opts.keyring.seal(nil, data, []byte(entity.GetKey())); err != nil {
+			return nil, err
+		}
+	}
+	if es.opts.maxEntitySize > 0 && len(data) > es.opts.maxEntitySize {
+		return nil, &EntityTooLargeError{Key: entity.GetKey(), Size: len(data), MaxSize: es.opts.maxEntitySize}
+	}
+	return data, nil
+}
+
+// encodePlaintext appends the value of the entity before encryption to the buffer,
+// i.e. its protobuf wire format with checksum.
+func (es *EntityStore[T, PT]) encodePlaintext(buf []byte, entity PT) ([]byte, error) {
+	var data []byte
+	var err error
+	if es.opts.deterministicEncoding {
+		data, err = encoder.ProtoMarshalDeterministicAppend(buf, entity)
+	} else {
+		data, err = encoder.ProtoMarshalAppend(buf, entity)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if es.opts.checksum {
+		data = binary.BigEndian.AppendUint32(data, crc32.Checksum(data, crc32Table))
+	}
+	return data, nil
+}
+
+// decode unmarshals the value read from the datastore for the entity key into the entity,
+// and applies the read transformations.
+func (es *EntityStore[T, PT]) decode(entityKey string, data []byte, entity PT) error {
+	data, err := es.payload(entityKey, data)
+	if err != nil {
+		return err
+	}
+	if err := encoder.ProtoUnmarshal(data, entity); err != nil {
+		return fmt.Errorf("%w: %w", ErrDecodeFailed, err)
+	}
+	if ks, ok := any(entity).(KeySetter); ok {
+		ks.SetKey(entityKey)
+	}
+	return es.transformOnRead(entityKey, entity)
+}
+
+// payload returns the protobuf wire format of the value read from the datastore for the entity
+// key, i.e. the value decrypted and without checksum.
+func (es *EntityStore[T, PT]) payload(entityKey string, data []byte) ([]byte, error) {
+	if es.opts.keyring != nil {
+		plaintext, err := es.opts.keyring.open(data, []byte(entityKey))
+		if err != nil {
+			return nil, fmt.Errorf("%w: entity '%s': decrypt: %w", datastore.ErrCorruptedData, entityKey, err)
+		}
+		data = plaintext
+	}
+	if es.opts.checksum {
+		if len(data) < checksumSize {
+			return nil, fmt.Errorf("%w: entity '%s': value too short for checksum", datastore.ErrCorruptedData, entityKey)
+		}
+		payload, sum := data[:len(data)-checksumSize], data[len(data)-checksumSize:]
+		if crc32.Checksum(payload, crc32Table) != binary.BigEndian.Uint32(sum) {
+			return nil, fmt.Errorf("%w: entity '%s': checksum mismatch", datastore.ErrCorruptedData, entityKey)
+		}
+		data = payload
+	}
+	return data, nil
+}
+
+// isCurrentEncoding returns whether the data read for the entity key is in the store's encoding,
+// given the decoded entity and the data it encodes to with the store. Encryption isn't
+// deterministic, so encrypted data is current if it's sealed with the current key and decrypts
+// to the plaintext the entity encodes to.
+func (es *EntityStore[T, PT]) isCurrentEncoding(entityKey string, data, encoded []byte, entity PT) bool {
+	if es.opts.keyring == nil {
+		return bytes.Equal(data, encoded)
+	}
+	if !es.opts.keyring.isCurrent(data) {
+		return false
+	}
+	plaintext, err := es.opts.keyring.open(data, []byte(entityKey))
+	if err != nil {
+		return false
+	}
+	current, err := es.encodePlaintext(nil, entity)
+	return err == nil && bytes.Equal(plaintext, current)
+}
+
+// metricLabels returns the labels of the store metrics, followed by the extra labels.
+func (es *EntityStore[T, PT]) metricLabels(extra ...metrics.Label) []metrics.Label {
+	labels := make([]metrics.Label, 0, 2+len(extra))
+	labels = append(labels, metrics.Label{Name: "kind", Value: es.entityKind})
+	if es.opts.namespaceLabel {
+		labels = append(labels, metrics.Label{Name: "namespace", Value: es.namespace})
+	}
+	return append(labels, extra...)
+}
+
+// countReads counts the found and missing entities of the data read by key, so the hit ratio of
+// key reads shows whether the entities' expirations fit their access patterns.
+func (es *EntityStore[T, PT]) countReads(data [][]byte) {
+	hits := 0
+	for _, d := range data {
+		if d != nil {
+			hits++
+		}
+	}
+	labels := es.metricLabels()
+	es.opts.metrics.Count(MetricReadHits, int64(hits), labels...)
+	es.opts.metrics.Count(MetricReadMisses, int64(len(data)-hits), labels...)
+}
+
+// observeSizes records the sizes of written entity data and warns about entities exceeding
+// the large entity threshold by logging and triggering the EntitiesSizeWarning event.
+func (es *EntityStore[T, PT]) observeSizes(ctx context.Context, entityKeys []string, data [][]byte) {
+	labels := es.metricLabels()
+	var largeKeys []string
+	for i, d := range data {
+		es.opts.metrics.Observe(MetricEntitySize, float64(len(d)), labels...)
+		if es.opts.largeEntityThreshold > 0 && len(d) > es.opts.largeEntityThreshold {
+			largeKeys = append(largeKeys, entityKeys[i])
+			log.Printf(
+				"entitystore: entity '%s' size %d bytes exceeds large entity threshold %d bytes",
+				entityKeys[i],
+				len(d),
+				es.opts.largeEntityThreshold,
+			)
+		}
+	}
+	if len(largeKeys) > 0 {
+		es.opts.metrics.Count(MetricLargeEntities, int64(len(largeKeys)), labels...)
+		es.onSizeWarn.emit(ctx, largeKeys)
+	}
+}
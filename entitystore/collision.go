@@ -0,0 +1,83 @@
+package entitystore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+// IdentifiableEntity is an entity with an ID, used by collision detection to tell whether two
+// entities with the same key are the same entity (see WithCollisionDetection).
+type IdentifiableEntity interface {
+	GetID() string
+}
+
+// entityIdentity returns the ID of the entity, or its key if it isn't an IdentifiableEntity.
+func entityIdentity(entity Entity) string {
+	if e, ok := entity.(IdentifiableEntity); ok {
+		return e.GetID()
+	}
+	return entity.GetKey()
+}
+
+// collisions returns the key collisions of the entities to write, aligned with the entities,
+// or nil if collision detection is disabled or there are no collisions.
+// An entity collides if the stored value under its key, or another entity with the same key in
+// the batch, is a different entity. Each collision is reported to the corruption handler.
+func (es *EntityStore[T, PT]) collisions(ctx context.Context, keys []*keyfactory.Key, entities []PT) ([]error, error) {
+	if !es.opts.collisionDetection || len(keys) == 0 {
+		return nil, nil
+	}
+	data, err := es.getMultiAligned(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	collide := func(i int, err error) {
+		if errs == nil {
+			errs = make([]error, len(entities))
+		}
+		errs[i] = err
+		es.opts.corruptionHandler(err)
+	}
+	batch := make(map[string]string, len(entities)) // Identity of the first entity of each key in the batch.
+	for i, entity := range entities {
+		entityKey := entity.GetKey()
+		id := entityIdentity(entity)
+		if other, ok := batch[entityKey]; ok && other != id {
+			collide(i, fmt.Errorf("%w: key '%s' of entity '%s' is also used by entity '%s' in the batch",
+				ErrKeyCollision, entityKey, id, other))
+			continue
+		}
+		batch[entityKey] = id
+		if data[i] == nil {
+			continue
+		}
+		stored := PT(new(T))
+		if err := es.decode(entityKey, data[i], stored); err != nil {
+			collide(i, fmt.Errorf("%w: key '%s' of entity '%s' holds a value that doesn't decode: %w",
+				ErrKeyCollision, entityKey, id, err))
+			continue
+		}
+		if storedID := entityIdentity(stored); storedID != id {
+			collide(i, fmt.Errorf("%w: key '%s' of entity '%s' holds entity '%s'",
+				ErrKeyCollision, entityKey, id, storedID))
+		}
+	}
+	return errs, nil
+}
+
+// firstCollision returns the first key collision of the entities to write, if any.
+func (es *EntityStore[T, PT]) firstCollision(ctx context.Context, keys []*keyfactory.Key, entities []PT) error {
+	errs, err := es.collisions(ctx, keys, entities)
+	if err != nil {
+		return err
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
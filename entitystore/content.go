@@ -0,0 +1,83 @@
+package entitystore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+// ErrContentAddressed is returned by operations not supported by stores with content addressing
+// (see WithContentAddressing).
+var ErrContentAddressed = errors.New("entitystore: operation not supported with content addressing")
+
+// checkContentAddressing returns an error wrapping ErrContentAddressed if the store has content
+// addressing, for operations writing values inline.
+func (es *EntityStore[T, PT]) checkContentAddressing(op string) error {
+	if es.opts.contentAddressing {
+		return fmt.Errorf("%w: %s", ErrContentAddressed, op)
+	}
+	return nil
+}
+
+// get reads the data of the key, resolving content-addressed data.
+func (es *EntityStore[T, PT]) get(ctx context.Context, key *keyfactory.Key) ([]byte, error) {
+	if !es.opts.contentAddressing {
+		return es.dsClient.Get(ctx, key)
+	}
+	data, err := es.dsClient.GetContentMultiAligned(ctx, []*keyfactory.Key{key})
+	if err != nil {
+		return nil, err
+	}
+	if data[0] == nil {
+		return nil, fmt.Errorf("%w: entity '%s'", datastore.ErrKeyNotFound, key.Key())
+	}
+	return data[0], nil
+}
+
+// getMultiAligned reads the data of the keys aligned with the keys, resolving content-addressed data.
+func (es *EntityStore[T, PT]) getMultiAligned(ctx context.Context, keys []*keyfactory.Key) ([][]byte, error) {
+	if es.opts.contentAddressing {
+		return es.dsClient.GetContentMultiAligned(ctx, keys)
+	}
+	return es.dsClient.GetMultiAligned(ctx, keys)
+}
+
+// put writes the data of the key, content-addressed if the store has content addressing.
+func (es *EntityStore[T, PT]) put(ctx context.Context, key *keyfactory.Key, data []byte, expiration time.Duration) error {
+	if es.opts.contentAddressing {
+		if expiration != 0 {
+			return fmt.Errorf("%w: expiration", ErrContentAddressed)
+		}
+		return es.dsClient.PutContent(ctx, key, data, expiration)
+	}
+	return es.dsClient.Put(ctx, key, data, expiration)
+}
+
+// putMulti writes the data of the keys, content-addressed if the store has content addressing.
+func (es *EntityStore[T, PT]) putMulti(
+	ctx context.Context,
+	keys []*keyfactory.Key,
+	data [][]byte,
+	expiration time.Duration,
+) error {
+	if es.opts.contentAddressing {
+		if expiration != 0 {
+			return fmt.Errorf("%w: expiration", ErrContentAddressed)
+		}
+		return es.dsClient.PutContentMulti(ctx, keys, data, expiration)
+	}
+	return es.dsClient.PutMulti(ctx, keys, data, expiration)
+}
+
+// deleteAligned deletes the keys, releasing their content-addressed data if the store has
+// content addressing.
+func (es *EntityStore[T, PT]) deleteAligned(ctx context.Context, keys []*keyfactory.Key) ([]bool, error) {
+	if es.opts.contentAddressing {
+		return es.dsClient.DeleteContentAligned(ctx, keys)
+	}
+	return es.dsClient.DeleteAligned(ctx, keys)
+}
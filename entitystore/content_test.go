@@ -0,0 +1,143 @@
+package entitystore
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// templateEntity is a test entity encoded without its key, so equal templates are encoded equally.
+type templateEntity struct {
+	Key  string `json:"-"`
+	Body string `json:"body"`
+}
+
+func (e templateEntity) GetKey() string {
+	return e.Key
+}
+
+func (e *templateEntity) SetKey(key string) {
+	e.Key = key
+}
+
+func (e templateEntity) MarshalProto() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+func (e *templateEntity) UnmarshalProto(data []byte) error {
+	return json.Unmarshal(data, e)
+}
+
+func TestEntityStoreContentAddressing(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	store, err := New[templateEntity](
+		string(keyfactory.EntityKindTest),
+		keyfactory.GenerateRandomKey(),
+		dsClient,
+		WithContentAddressing(),
+		WithChecksum(),
+	)
+	require.NoError(t, err)
+	entities := make([]templateEntity, 3)
+	keys := make([]string, len(entities))
+	for i, id := range []string{"e-1", "e-2", "e-3"} {
+		key, err := keyfactory.NewEntityKey(keyfactory.EntityKindTest, id, "", mockTenantKey)
+		require.NoError(t, err)
+		entities[i] = templateEntity{Key: key, Body: "shared"}
+		keys[i] = key
+	}
+	entities[2].Body = "other"
+	blobs := func() int {
+		n := 0
+		for _, key := range server.Keys() {
+			if strings.Contains(key, datastore.ContentKeyPrefix+":") {
+				n++
+			}
+		}
+		return n
+	}
+
+	t.Run("Should store equal entities once", func(t *testing.T) {
+		_, err := store.AddBatch(ctx, entities, 0)
+		require.NoError(t, err)
+		assert.Equal(t, 2, blobs())
+
+		stored, err := store.GetByKeys(ctx, keys)
+		require.NoError(t, err)
+		require.Len(t, stored, 3)
+		assert.Equal(t, []string{"shared", "shared", "other"}, []string{stored[0].Body, stored[1].Body, stored[2].Body})
+		assert.Equal(t, keys, []string{stored[0].GetKey(), stored[1].GetKey(), stored[2].GetKey()}, "should restore keys")
+		entity, err := store.Get(ctx, keys[1])
+		require.NoError(t, err)
+		assert.Equal(t, "shared", entity.Body)
+		assert.Equal(t, keys[1], entity.GetKey())
+	})
+
+	t.Run("Should reject expiration", func(t *testing.T) {
+		key, err := keyfactory.NewEntityKey(keyfactory.EntityKindTest, "e-4", "", mockTenantKey)
+		require.NoError(t, err)
+		_, err = store.Add(ctx, templateEntity{Key: key, Body: "shared"}, time.Minute)
+		assert.ErrorIs(t, err, ErrContentAddressed)
+		_, err = store.AddBatch(ctx, []templateEntity{{Key: key, Body: "expiring"}}, time.Minute)
+		assert.ErrorIs(t, err, ErrContentAddressed)
+		exists, err := store.Exists(ctx, key)
+		require.NoError(t, err)
+		assert.False(t, exists)
+		assert.Equal(t, 2, blobs())
+	})
+
+	t.Run("Should release replaced entities", func(t *testing.T) {
+		_, err := store.Add(ctx, templateEntity{Key: keys[2], Body: "shared"}, 0)
+		require.NoError(t, err)
+		assert.Equal(t, 1, blobs())
+	})
+
+	t.Run("Should release removed entities", func(t *testing.T) {
+		require.NoError(t, store.Remove(ctx, keys[0]))
+		assert.Equal(t, 1, blobs())
+		_, err := store.Get(ctx, keys[0])
+		assert.ErrorIs(t, err, datastore.ErrKeyNotFound)
+
+		all, err := store.GetAll(ctx, mockTenantKey)
+		require.NoError(t, err)
+		assert.Len(t, all, 2, "should not list content as entities")
+
+		n, err := store.RemoveAllCount(ctx, mockTenantKey)
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+		assert.Zero(t, blobs())
+	})
+
+	t.Run("Should reject in-place writes", func(t *testing.T) {
+		err := store.Update(ctx, entities[0], 0)
+		assert.ErrorIs(t, err, ErrContentAddressed)
+		_, err = store.UpdateWhere(ctx, mockTenantKey, func(*templateEntity) bool { return true }, func(*templateEntity) {})
+		assert.ErrorIs(t, err, ErrContentAddressed)
+	})
+
+	t.Run("Should reject encryption", func(t *testing.T) {
+		kr, err := NewKeyring(1, map[uint8][]byte{1: make([]byte, 32)})
+		require.NoError(t, err)
+		_, err = New[templateEntity](
+			string(keyfactory.EntityKindTest),
+			keyfactory.GenerateRandomKey(),
+			dsClient,
+			WithContentAddressing(),
+			WithEncryption(kr),
+		)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,65 @@
+package entitystore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+// CorruptEntity describes a stored entity that failed to decode.
+type CorruptEntity struct {
+	Key         string // Entity key.
+	Size        int    // Size in bytes of the raw stored value.
+	Err         error  // Decode error.
+	Quarantined bool   // Whether the value was moved to the quarantine namespace.
+}
+
+// CorruptEntityHandler is called for each corrupt entity skipped by a multi-entity read.
+type CorruptEntityHandler func(ctx context.Context, entity CorruptEntity)
+
+// getMulti retrieves and decodes the entities of the keys.
+// Keys not found in the store are not included in the result.
+func (es *EntityStore[T, PT]) getMulti(ctx context.Context, keys []*keyfactory.Key) ([]PT, error) {
+	data, err := es.getMultiAligned(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	return es.decodeMulti(ctx, keys, data)
+}
+
+// decodeMulti decodes the data read for the keys, skipping keys not found in the store.
+func (es *EntityStore[T, PT]) decodeMulti(ctx context.Context, keys []*keyfactory.Key, data [][]byte) ([]PT, error) {
+	entities := make([]PT, 0, len(data))
+	for i, d := range data {
+		if d == nil {
+			continue // Key not found; skip it.
+		}
+		entity := PT(new(T))
+		if err := es.decode(keys[i].Key(), d, entity); err != nil {
+			err = fmt.Errorf("entitystore: failed to decode entity '%s': %w", keys[i].Key(), err)
+			if es.opts.corruptEntityHandler == nil {
+				return nil, err
+			}
+			es.handleCorruptEntity(ctx, keys[i], len(d), err)
+			continue
+		}
+		entities = append(entities, entity)
+	}
+	return entities, nil
+}
+
+// handleCorruptEntity optionally moves the corrupt entity to the quarantine namespace and
+// reports it to the corrupt entity handler.
+func (es *EntityStore[T, PT]) handleCorruptEntity(ctx context.Context, key *keyfactory.Key, size int, err error) {
+	corrupt := CorruptEntity{Key: key.Key(), Size: size, Err: err}
+	if es.opts.quarantineNamespace != "" {
+		quarantineKey := keyfactory.NewKey(key.Key(), es.opts.quarantineNamespace)
+		if qErr := es.dsClient.Rename(ctx, key, quarantineKey); qErr != nil {
+			es.opts.corruptionHandler(fmt.Errorf("failed to quarantine entity '%s': %w", key.Key(), qErr))
+		} else {
+			corrupt.Quarantined = true
+		}
+	}
+	es.opts.corruptEntityHandler(ctx, corrupt)
+}
@@ -0,0 +1,68 @@
+package entitystore
+
+import "fmt"
+
+const MetricBatchDuplicates = "entitystore_batch_duplicates_total" // Counter of duplicate entities dropped from batches.
+
+// DedupPolicy is the handling of entities with duplicate keys in a batch add.
+type DedupPolicy int
+
+const (
+	DedupNone      DedupPolicy = iota // Duplicates are written in batch order, so the last value wins (default).
+	DedupKeepFirst                    // The first entity of each key is written, later duplicates are dropped.
+	DedupKeepLast                     // The last entity of each key is written, earlier duplicates are dropped.
+	DedupError                        // A batch with duplicate keys is rejected.
+)
+
+// duplicates returns which entities are dropped as duplicates by the dedup policy, and the number
+// of dropped entities. With DedupError all entities of a duplicate key are dropped.
+func (es *EntityStore[T, PT]) duplicates(entities []T) ([]bool, int) {
+	if es.opts.dedup == DedupNone {
+		return nil, 0
+	}
+	positions := make(map[string][]int, len(entities))
+	for i, entity := range entities {
+		positions[entity.GetKey()] = append(positions[entity.GetKey()], i)
+	}
+	if len(positions) == len(entities) {
+		return nil, 0 // No duplicates.
+	}
+	dropped := make([]bool, len(entities))
+	n := 0
+	for _, pos := range positions {
+		if len(pos) < 2 {
+			continue
+		}
+		for j, i := range pos {
+			switch {
+			case es.opts.dedup == DedupKeepFirst && j == 0,
+				es.opts.dedup == DedupKeepLast && j == len(pos)-1:
+				continue
+			}
+			dropped[i] = true
+			n++
+		}
+	}
+	es.opts.metrics.Count(MetricBatchDuplicates, int64(n), es.metricLabels()...)
+	return dropped, n
+}
+
+// dedupBatch returns the entities without the duplicates dropped by the dedup policy.
+// With DedupError an error wrapping ErrDuplicateKey is returned if the batch has duplicate keys.
+func (es *EntityStore[T, PT]) dedupBatch(entities []T) ([]T, error) {
+	dropped, n := es.duplicates(entities)
+	if n == 0 {
+		return entities, nil
+	}
+	kept := make([]T, 0, len(entities)-n)
+	for i, entity := range entities {
+		if !dropped[i] {
+			kept = append(kept, entity)
+			continue
+		}
+		if es.opts.dedup == DedupError {
+			return nil, fmt.Errorf("%w: '%s'", ErrDuplicateKey, entity.GetKey())
+		}
+	}
+	return kept, nil
+}
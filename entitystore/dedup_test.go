@@ -0,0 +1,96 @@
+package entitystore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/metrics"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntityStoreBatchDedup(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	first := testutil.NewEntity("e-1", mockTenantId, 1)
+	first.Data = "first"
+	last := first
+	last.Data = "last"
+	other := testutil.NewEntity("e-2", mockTenantId, 1)
+	batch := []testutil.Entity{first, other, last}
+
+	setup := func(t *testing.T, policy DedupPolicy) (*EntityStore[testutil.Entity, *testutil.Entity], *metrics.MemoryRecorder, *[]string) {
+		t.Helper()
+		recorder := metrics.NewMemoryRecorder()
+		store, err := New[testutil.Entity](
+			string(keyfactory.EntityKindTest),
+			keyfactory.GenerateRandomKey(),
+			dsClient,
+			WithBatchDedup(policy),
+			WithMetrics(recorder),
+		)
+		require.NoError(t, err)
+		var added []string
+		store.OnAdded().AddListener(func(ctx context.Context, keys []string) {
+			added = append(added, keys...)
+		})
+		return store, recorder, &added
+	}
+
+	for _, tc := range []struct {
+		name     string
+		policy   DedupPolicy
+		wantData string
+	}{
+		{name: "Keep first", policy: DedupKeepFirst, wantData: "first"},
+		{name: "Keep last", policy: DedupKeepLast, wantData: "last"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store, recorder, added := setup(t, tc.policy)
+			keys, err := store.AddBatch(ctx, batch, 0)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []string{first.Key, other.Key}, keys)
+			assert.ElementsMatch(t, []string{first.Key, other.Key}, *added, "should not emit duplicate keys")
+			e, err := store.Get(ctx, first.Key)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantData, e.Data)
+			kindLabel := metrics.Label{Name: "kind", Value: string(keyfactory.EntityKindTest)}
+			assert.Equal(t, int64(1), recorder.Counter(MetricBatchDuplicates, kindLabel))
+		})
+	}
+
+	t.Run("Error", func(t *testing.T) {
+		store, _, added := setup(t, DedupError)
+		_, err := store.AddBatch(ctx, batch, 0)
+		assert.ErrorIs(t, err, ErrDuplicateKey)
+		assert.Empty(t, *added)
+		exists, err := store.Exists(ctx, other.Key)
+		require.NoError(t, err)
+		assert.False(t, exists, "should not write rejected batch")
+	})
+
+	t.Run("Partial reports duplicates", func(t *testing.T) {
+		store, _, _ := setup(t, DedupKeepLast)
+		result, err := store.AddBatchPartial(ctx, batch, 0)
+		require.NoError(t, err)
+		require.Len(t, result.Failed(), 1)
+		assert.Equal(t, first.Key, result.Failed()[0].Key)
+		assert.ErrorIs(t, result.Failed()[0].Err, ErrDuplicateKey)
+		assert.Equal(t, []string{other.Key, last.Key}, result.Succeeded())
+	})
+
+	t.Run("None", func(t *testing.T) {
+		store, _, added := setup(t, DedupNone)
+		keys, err := store.AddBatch(ctx, batch, 0)
+		require.NoError(t, err)
+		assert.Len(t, keys, 3)
+		assert.Len(t, *added, 3)
+	})
+}
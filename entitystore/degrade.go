@@ -0,0 +1,306 @@
+package entitystore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/holmberd/go-entitystore/datastore"
+)
+
+const (
+	DefaultStaleCacheSize = 10000 // Default max number of entities kept for stale reads by a DegradingStore.
+	DefaultWriteQueueSize = 1000  // Default max number of writes queued by a DegradingStore.
+)
+
+// ErrWriteQueueFull is returned by a DegradingStore when a write can't be queued during an outage.
+var ErrWriteQueueFull = errors.New("entitystore: write queue full")
+
+// ReadFallback is the handling of reads while the datastore is unavailable.
+type ReadFallback int
+
+const (
+	ReadFailFast   ReadFallback = iota // Reads fail with the datastore error (default).
+	ReadServeStale                     // Reads are served from the entities last read or written, which may be stale.
+)
+
+// WriteFallback is the handling of writes while the datastore is unavailable.
+type WriteFallback int
+
+const (
+	WriteFailFast WriteFallback = iota // Writes fail with the datastore error (default).
+	WriteQueue                         // Writes are queued and replayed in order once the datastore is available.
+)
+
+// DegradedEvent describes an operation that failed since the datastore was unavailable.
+type DegradedEvent struct {
+	Op       string   // Operation, e.g. "get" or "add".
+	Keys     []string // Keys of the operation's entities.
+	Err      error    // Datastore error.
+	Fallback bool     // Whether the operation was served by the fallback instead of failing.
+}
+
+// DegradationPolicy configures the fallbacks of a DegradingStore.
+type DegradationPolicy struct {
+	Reads          ReadFallback
+	Writes         WriteFallback
+	StaleCacheSize int                                            // Max number of entities kept for stale reads. Defaults to DefaultStaleCacheSize.
+	WriteQueueSize int                                            // Max number of queued writes. Defaults to DefaultWriteQueueSize.
+	OnDegraded     func(ctx context.Context, event DegradedEvent) // Optional, called for each degraded operation.
+}
+
+// queuedWrite is a write queued during an outage.
+type queuedWrite struct {
+	op    string
+	keys  []string
+	write func(ctx context.Context) error
+}
+
+// DegradingStore is an EntityStorer decorator that keeps the application running through brief
+// datastore outages, i.e. errors wrapping datastore.ErrBackendUnavailable, by falling back as
+// configured by its policy: Get and GetByKeys can serve the entities last read or written through
+// the store, and Add, AddBatch, Remove, and RemoveByKeys can be queued and replayed in order once
+// the datastore is available. Other operations are passed through to the store.
+//
+// Queued writes are replayed before the next write, or by Drain. The store events of queued
+// writes are emitted when they're replayed.
+//
+// NOTE: Stale reads and queued writes are local to the process, queued writes are lost if the
+// process exits during an outage.
+type DegradingStore[T Entity, PT SerializableEntity[T]] struct {
+	EntityStorer[T, PT]
+	policy DegradationPolicy
+
+	mu         sync.Mutex
+	stale      map[string]PT // Entities last read or written, or nil for removed entities.
+	staleOrder []string      // Keys of the stale entities in insertion order, for eviction.
+	queue      []queuedWrite
+	drainMu    sync.Mutex // Serializes replays, so a queued write is replayed once.
+}
+
+// NewDegradingStore returns a store falling back as configured by the policy while the store's
+// datastore is unavailable.
+func NewDegradingStore[T Entity, PT SerializableEntity[T]](
+	store EntityStorer[T, PT],
+	policy DegradationPolicy,
+) *DegradingStore[T, PT] {
+	if policy.StaleCacheSize <= 0 {
+		policy.StaleCacheSize = DefaultStaleCacheSize
+	}
+	if policy.WriteQueueSize <= 0 {
+		policy.WriteQueueSize = DefaultWriteQueueSize
+	}
+	return &DegradingStore[T, PT]{EntityStorer: store, policy: policy, stale: make(map[string]PT)}
+}
+
+func isUnavailable(err error) bool {
+	return errors.Is(err, datastore.ErrBackendUnavailable)
+}
+
+func (s *DegradingStore[T, PT]) degraded(ctx context.Context, op string, keys []string, err error, fallback bool) {
+	if s.policy.OnDegraded != nil {
+		s.policy.OnDegraded(ctx, DegradedEvent{Op: op, Keys: keys, Err: err, Fallback: fallback})
+	}
+}
+
+// keep keeps the entity of the key for stale reads, or records its removal if the entity is nil.
+func (s *DegradingStore[T, PT]) keep(entityKey string, entity PT) {
+	if s.policy.Reads != ReadServeStale {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.stale[entityKey]; !ok {
+		s.staleOrder = append(s.staleOrder, entityKey)
+		for len(s.staleOrder) > s.policy.StaleCacheSize {
+			delete(s.stale, s.staleOrder[0])
+			s.staleOrder = s.staleOrder[1:]
+		}
+	}
+	s.stale[entityKey] = entity
+}
+
+// staleEntity returns the stale entity of the key, and whether it's known.
+func (s *DegradingStore[T, PT]) staleEntity(entityKey string) (PT, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entity, ok := s.stale[entityKey]
+	return entity, ok
+}
+
+func (s *DegradingStore[T, PT]) Get(ctx context.Context, entityKey string, opts ...CallOption) (PT, error) {
+	entity, err := s.EntityStorer.Get(ctx, entityKey, opts...)
+	if err == nil {
+		s.keep(entityKey, entity)
+		return entity, nil
+	}
+	if !isUnavailable(err) || s.policy.Reads != ReadServeStale || newCallOptions(opts).skipCache {
+		if isUnavailable(err) {
+			s.degraded(ctx, "get", []string{entityKey}, err, false)
+		}
+		return nil, err
+	}
+	stale, ok := s.staleEntity(entityKey)
+	s.degraded(ctx, "get", []string{entityKey}, err, ok)
+	if !ok {
+		return nil, err
+	}
+	if stale == nil {
+		return nil, datastore.ErrKeyNotFound // Removed through the store.
+	}
+	return stale, nil
+}
+
+func (s *DegradingStore[T, PT]) GetByKeys(ctx context.Context, entityKeys []string) ([]PT, error) {
+	entities, err := s.EntityStorer.GetByKeys(ctx, entityKeys)
+	if err == nil {
+		for _, entity := range entities {
+			s.keep(entity.GetKey(), entity)
+		}
+		return entities, nil
+	}
+	if !isUnavailable(err) || s.policy.Reads != ReadServeStale {
+		if isUnavailable(err) {
+			s.degraded(ctx, "get_by_keys", entityKeys, err, false)
+		}
+		return nil, err
+	}
+	stale := make([]PT, 0, len(entityKeys))
+	for _, eKey := range entityKeys {
+		if entity, ok := s.staleEntity(eKey); ok && entity != nil {
+			stale = append(stale, entity)
+		}
+	}
+	s.degraded(ctx, "get_by_keys", entityKeys, err, true)
+	return stale, nil
+}
+
+// write runs the write, or queues it if the datastore is unavailable and the policy queues writes.
+// Queued writes are replayed first, so writes are applied in order.
+func (s *DegradingStore[T, PT]) write(ctx context.Context, op string, keys []string, fn func(ctx context.Context) error) error {
+	_, err := s.Drain(ctx)
+	if err != nil && !isUnavailable(err) {
+		return err
+	}
+	s.mu.Lock()
+	queued := len(s.queue) > 0
+	s.mu.Unlock()
+	if !queued {
+		if err = fn(ctx); err == nil || !isUnavailable(err) {
+			return err
+		}
+	}
+	if s.policy.Writes != WriteQueue {
+		s.degraded(ctx, op, keys, err, false)
+		return err
+	}
+	s.mu.Lock()
+	if len(s.queue) >= s.policy.WriteQueueSize {
+		s.mu.Unlock()
+		s.degraded(ctx, op, keys, err, false)
+		return ErrWriteQueueFull
+	}
+	s.queue = append(s.queue, queuedWrite{op: op, keys: keys, write: fn})
+	s.mu.Unlock()
+	s.degraded(ctx, op, keys, err, true)
+	return nil
+}
+
+// Drain replays the queued writes in order until the queue is empty, or a write fails.
+// It returns the number of replayed writes. A write failing for another reason than the
+// datastore being unavailable is dropped, and its error is returned. Concurrent calls are
+// serialized, so each queued write is replayed by one of them.
+func (s *DegradingStore[T, PT]) Drain(ctx context.Context) (int, error) {
+	s.drainMu.Lock()
+	defer s.drainMu.Unlock()
+	n := 0
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			return n, nil
+		}
+		w := s.queue[0]
+		s.mu.Unlock()
+		err := w.write(ctx)
+		if isUnavailable(err) {
+			return n, err
+		}
+		s.mu.Lock()
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// Queued returns the number of queued writes.
+func (s *DegradingStore[T, PT]) Queued() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queue)
+}
+
+func (s *DegradingStore[T, PT]) Add(ctx context.Context, entity T, expiration time.Duration, opts ...CallOption) (string, error) {
+	if newCallOptions(opts).dryRun {
+		return s.EntityStorer.Add(ctx, entity, expiration, opts...)
+	}
+	key := entity.GetKey()
+	err := s.write(ctx, "add", []string{key}, func(ctx context.Context) error {
+		_, err := s.EntityStorer.Add(ctx, entity, expiration, opts...)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	s.keep(key, &entity)
+	return key, nil
+}
+
+func (s *DegradingStore[T, PT]) AddBatch(ctx context.Context, entities []T, expiration time.Duration) ([]string, error) {
+	keys := make([]string, len(entities))
+	for i, entity := range entities {
+		keys[i] = entity.GetKey()
+	}
+	err := s.write(ctx, "add_batch", keys, func(ctx context.Context) error {
+		_, err := s.EntityStorer.AddBatch(ctx, entities, expiration)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range entities {
+		s.keep(keys[i], &entities[i])
+	}
+	return keys, nil
+}
+
+func (s *DegradingStore[T, PT]) Remove(ctx context.Context, entityKey string, opts ...CallOption) error {
+	if newCallOptions(opts).dryRun {
+		return s.EntityStorer.Remove(ctx, entityKey, opts...)
+	}
+	err := s.write(ctx, "remove", []string{entityKey}, func(ctx context.Context) error {
+		return s.EntityStorer.Remove(ctx, entityKey, opts...)
+	})
+	if err != nil {
+		return err
+	}
+	s.keep(entityKey, nil)
+	return nil
+}
+
+func (s *DegradingStore[T, PT]) RemoveByKeys(ctx context.Context, entityKeys []string) error {
+	err := s.write(ctx, "remove_by_keys", entityKeys, func(ctx context.Context) error {
+		return s.EntityStorer.RemoveByKeys(ctx, entityKeys)
+	})
+	if err != nil {
+		return err
+	}
+	for _, eKey := range entityKeys {
+		s.keep(eKey, nil)
+	}
+	return nil
+}
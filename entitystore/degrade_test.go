@@ -0,0 +1,161 @@
+package entitystore
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDegradingStore(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	store, err := New[testutil.Entity](string(keyfactory.EntityKindTest), keyfactory.GenerateRandomKey(), dsClient)
+	require.NoError(t, err)
+	e1, e2 := testutil.NewEntity("e-1", mockTenantId, 1), testutil.NewEntity("e-2", mockTenantId, 1)
+	_, err = store.AddBatch(ctx, []testutil.Entity{e1, e2}, 0)
+	require.NoError(t, err)
+
+	t.Run("Fail fast", func(t *testing.T) {
+		var events []DegradedEvent
+		degrading := NewDegradingStore[testutil.Entity](store, DegradationPolicy{
+			OnDegraded: func(ctx context.Context, event DegradedEvent) { events = append(events, event) },
+		})
+		_, err := degrading.Get(ctx, e1.Key)
+		require.NoError(t, err)
+
+		server.Close()
+		defer func() { require.NoError(t, server.Restart()) }()
+		_, err = degrading.Get(ctx, e1.Key)
+		assert.ErrorIs(t, err, datastore.ErrBackendUnavailable)
+		_, err = degrading.Add(ctx, e1, 0)
+		assert.ErrorIs(t, err, datastore.ErrBackendUnavailable)
+		require.Len(t, events, 2)
+		assert.Equal(t, "get", events[0].Op)
+		assert.False(t, events[0].Fallback)
+	})
+
+	t.Run("Serve stale reads and queue writes", func(t *testing.T) {
+		var events []DegradedEvent
+		degrading := NewDegradingStore[testutil.Entity](store, DegradationPolicy{
+			Reads:          ReadServeStale,
+			Writes:         WriteQueue,
+			WriteQueueSize: 2,
+			OnDegraded:     func(ctx context.Context, event DegradedEvent) { events = append(events, event) },
+		})
+		_, err := degrading.GetByKeys(ctx, []string{e1.Key, e2.Key})
+		require.NoError(t, err)
+
+		server.Close()
+		got, err := degrading.Get(ctx, e1.Key)
+		require.NoError(t, err, "should serve the stale entity")
+		assert.Equal(t, e1.Key, got.Key)
+		updated := e1
+		updated.UpdatedAt = 2
+		_, err = degrading.Add(ctx, updated, 0)
+		require.NoError(t, err, "should queue the write")
+		require.NoError(t, degrading.Remove(ctx, e2.Key))
+		_, err = degrading.Add(ctx, e1, 0)
+		assert.ErrorIs(t, err, ErrWriteQueueFull)
+		assert.Equal(t, 2, degrading.Queued())
+
+		got, err = degrading.Get(ctx, e1.Key)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), got.UpdatedAt, "should serve queued writes")
+		_, err = degrading.Get(ctx, e1.Key, SkipCache())
+		assert.ErrorIs(t, err, datastore.ErrBackendUnavailable, "should not serve stale entities skipping the cache")
+		_, err = degrading.Get(ctx, e2.Key)
+		assert.ErrorIs(t, err, datastore.ErrKeyNotFound, "should serve queued removals")
+		all, err := degrading.GetByKeys(ctx, []string{e1.Key, e2.Key})
+		require.NoError(t, err)
+		assert.Len(t, all, 1)
+		assert.True(t, events[0].Fallback)
+
+		require.NoError(t, server.Restart())
+		replayed := 0
+		require.Eventually(t, func() bool { // The Redis client redials in the background.
+			n, err := degrading.Drain(ctx)
+			replayed += n
+			return err == nil
+		}, 5*time.Second, 50*time.Millisecond)
+		assert.Equal(t, 2, replayed, "should replay the queued writes")
+		stored, err := store.Get(ctx, e1.Key)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), stored.UpdatedAt)
+		exists, err := store.Exists(ctx, e2.Key)
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+}
+
+// flakyStore is a store whose adds fail as unavailable until it's available, counting the adds of each key.
+type flakyStore struct {
+	EntityStorer[testutil.Entity, *testutil.Entity]
+	available atomic.Bool
+
+	mu   sync.Mutex
+	adds map[string]int
+}
+
+func (s *flakyStore) Add(ctx context.Context, entity testutil.Entity, expiration time.Duration, opts ...CallOption) (string, error) {
+	if !s.available.Load() {
+		return "", fmt.Errorf("%w: down", datastore.ErrBackendUnavailable)
+	}
+	time.Sleep(100 * time.Microsecond) // Widens the window of concurrent replays.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.adds[entity.Key]++
+	return entity.Key, nil
+}
+
+func TestDegradingStoreConcurrentDrain(t *testing.T) {
+	ctx := context.Background()
+	store := &flakyStore{adds: make(map[string]int)}
+	degrading := NewDegradingStore[testutil.Entity](store, DegradationPolicy{Writes: WriteQueue})
+	const queued = 100
+	for i := range queued {
+		_, err := degrading.Add(ctx, testutil.NewEntity(fmt.Sprintf("q-%d", i), mockTenantId, 1), 0)
+		require.NoError(t, err)
+	}
+	require.Equal(t, queued, degrading.Queued())
+
+	store.available.Store(true)
+	var wg sync.WaitGroup
+	var replayed atomic.Int64
+	for i := range 8 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			n, err := degrading.Drain(ctx)
+			assert.NoError(t, err)
+			replayed.Add(int64(n))
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := degrading.Add(ctx, testutil.NewEntity(fmt.Sprintf("w-%d", i), mockTenantId, 1), 0)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.Zero(t, degrading.Queued())
+	assert.LessOrEqual(t, replayed.Load(), int64(queued))
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	assert.Len(t, store.adds, queued+8)
+	for key, n := range store.adds {
+		assert.Equal(t, 1, n, "should replay queued write '%s' once", key)
+	}
+}
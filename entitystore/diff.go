@@ -0,0 +1,180 @@
+package entitystore
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/holmberd/go-entitystore/eventemitter"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// FieldChange is a changed field of an entity.
+type FieldChange struct {
+	Field string // Field name, or the proto field name for proto messages.
+	Old   any    // Nil if the field was unset in the old entity.
+	New   any    // Nil if the field is unset in the new entity.
+}
+
+// EntityUpdate is an updated entity and its changed fields.
+type EntityUpdate struct {
+	Key     string
+	Changes []FieldChange
+}
+
+// Diff returns the field-level changes between the old and new entity.
+//   - Proto messages are compared field by field using proto reflection.
+//   - Structs, or pointers to structs, are compared by their exported fields.
+//   - Any other values are compared as a whole and reported as a single change with an empty field name.
+func Diff(old any, new any) []FieldChange {
+	oldMsg, oldOk := old.(proto.Message)
+	newMsg, newOk := new.(proto.Message)
+	if oldOk && newOk {
+		return diffProto(oldMsg.ProtoReflect(), newMsg.ProtoReflect())
+	}
+	oldVal := reflect.Indirect(reflect.ValueOf(old))
+	newVal := reflect.Indirect(reflect.ValueOf(new))
+	if oldVal.Kind() == reflect.Struct && oldVal.Type() == newVal.Type() {
+		return diffStruct(oldVal, newVal)
+	}
+	if reflect.DeepEqual(old, new) {
+		return nil
+	}
+	return []FieldChange{{Old: old, New: new}}
+}
+
+func diffProto(old protoreflect.Message, new protoreflect.Message) []FieldChange {
+	if old.Descriptor().FullName() != new.Descriptor().FullName() {
+		return []FieldChange{{Old: old.Interface(), New: new.Interface()}}
+	}
+	var changes []FieldChange
+	fields := old.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if old.Has(fd) == new.Has(fd) && old.Get(fd).Equal(new.Get(fd)) {
+			continue
+		}
+		change := FieldChange{Field: string(fd.Name())}
+		if old.Has(fd) {
+			change.Old = old.Get(fd).Interface()
+		}
+		if new.Has(fd) {
+			change.New = new.Get(fd).Interface()
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+func diffStruct(old reflect.Value, new reflect.Value) []FieldChange {
+	var changes []FieldChange
+	for i := 0; i < old.NumField(); i++ {
+		field := old.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		oldField, newField := old.Field(i).Interface(), new.Field(i).Interface()
+		if reflect.DeepEqual(oldField, newField) {
+			continue
+		}
+		changes = append(changes, FieldChange{Field: field.Name, Old: oldField, New: newField})
+	}
+	return changes
+}
+
+// EntityUpdateListener is called with the updated entities and their changes.
+type EntityUpdateListener func(ctx context.Context, updates []EntityUpdate)
+
+// updateEventTarget is the event target of entity updates with diffs.
+type updateEventTarget struct {
+	t         *eventemitter.EventTarget
+	onInvalid func(err error)   // Called instead of the listener on malformed event arguments.
+	onSkipped func(skipped int) // If set, listeners are skipped once the context is done (see WithCancelableEvents).
+}
+
+func newUpdateEventTarget(event Event, onInvalid func(err error)) *updateEventTarget {
+	return &updateEventTarget{
+		t:         eventemitter.NewEventTarget(event.String()),
+		onInvalid: onInvalid,
+	}
+}
+
+func (e *updateEventTarget) AddListener(listener EntityUpdateListener) eventemitter.ListenerToken {
+	return e.t.AddListener(func(args ...any) {
+		if len(args) < 2 {
+			e.onInvalid(fmt.Errorf("missing arguments in %s event listener", e.t.EventName()))
+			return
+		}
+		ctx, ok := args[0].(context.Context)
+		if !ok {
+			e.onInvalid(fmt.Errorf("argument is not of expected type %T (got %T)", context.Background(), args[0]))
+			return
+		}
+		updates, ok := args[1].([]EntityUpdate)
+		if !ok {
+			e.onInvalid(fmt.Errorf("argument is not of expected type %T (got %T)", []EntityUpdate{}, args[1]))
+			return
+		}
+		listener(ctx, updates)
+	})
+}
+
+func (e *updateEventTarget) RemoveListener(token eventemitter.ListenerToken) bool {
+	return e.t.RemoveListener(token)
+}
+
+func (e *updateEventTarget) emit(ctx context.Context, updates []EntityUpdate) bool {
+	if eventsSkipped(ctx) {
+		return false
+	}
+	if e.onSkipped != nil {
+		return emitCancelable(ctx, e.t, e.onSkipped, ctx, updates)
+	}
+	return e.t.Emit(ctx, updates)
+}
+
+// loadPrevious retrieves the stored entities of the keys before they are overwritten, if update
+// diffs are enabled. The returned entities are aligned with the keys, where missing or undecodable
+// entities are nil.
+func (es *EntityStore[T, PT]) loadPrevious(ctx context.Context, keys []*keyfactory.Key) ([]PT, error) {
+	if !es.opts.updateDiffs || len(keys) == 0 {
+		return nil, nil
+	}
+	data, err := es.getMultiAligned(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	previous := make([]PT, len(data))
+	for i, d := range data {
+		if d == nil {
+			continue
+		}
+		entity := PT(new(T))
+		if err := es.decode(keys[i].Key(), d, entity); err != nil {
+			continue // Treat an undecodable entity as added.
+		}
+		previous[i] = entity
+	}
+	return previous, nil
+}
+
+// emitUpdates emits the EntitiesUpdated events for the entities that replaced a previous entity.
+// The entities are aligned with the previous entities returned by loadPrevious.
+func (es *EntityStore[T, PT]) emitUpdates(ctx context.Context, previous []PT, entities []PT) {
+	var keys []string
+	var updates []EntityUpdate
+	for i, prev := range previous {
+		if prev == nil {
+			continue
+		}
+		keys = append(keys, entities[i].GetKey())
+		updates = append(updates, EntityUpdate{Key: entities[i].GetKey(), Changes: Diff(prev, entities[i])})
+	}
+	if len(updates) == 0 {
+		return
+	}
+	es.onUpdated.emit(ctx, keys)
+	es.onUpdatedDiff.emit(ctx, updates)
+}
@@ -0,0 +1,76 @@
+package entitystore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/entitystore/pb"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	t.Run("Proto messages", func(t *testing.T) {
+		old := &pb.TestEntity{Id: "e-1", TenantId: "t-1", UpdatedAt: 1}
+		new := &pb.TestEntity{Id: "e-1", UpdatedAt: 2}
+		assert.Equal(t, []FieldChange{
+			{Field: "tenant_id", Old: "t-1", New: nil},
+			{Field: "updated_at", Old: int64(1), New: int64(2)},
+		}, Diff(old, new))
+	})
+
+	t.Run("Structs", func(t *testing.T) {
+		old := testutil.NewEntity("e-1", "t-1", 1)
+		new := old
+		new.Data = "data"
+		assert.Equal(t, []FieldChange{{Field: "Data", Old: "", New: "data"}}, Diff(&old, &new))
+		assert.Empty(t, Diff(old, old))
+	})
+
+	t.Run("Other values", func(t *testing.T) {
+		assert.Equal(t, []FieldChange{{Old: 1, New: 2}}, Diff(1, 2))
+		assert.Empty(t, Diff("a", "a"))
+	})
+}
+
+func TestEntityStoreUpdateDiffs(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	store, err := New[testutil.Entity](
+		string(keyfactory.EntityKindTest),
+		keyfactory.GenerateRandomKey(),
+		dsClient,
+		WithUpdateDiffs(),
+	)
+	require.NoError(t, err)
+	var updatedKeys []string
+	var updates []EntityUpdate
+	store.OnUpdated().AddListener(func(ctx context.Context, keys []string) {
+		updatedKeys = keys
+	})
+	store.OnUpdatedDiff().AddListener(func(ctx context.Context, u []EntityUpdate) {
+		updates = u
+	})
+
+	e1 := testutil.NewEntity("e-1", mockTenantId, 1)
+	e2 := testutil.NewEntity("e-2", mockTenantId, 1)
+	_, err = store.Add(ctx, e1, 0)
+	require.NoError(t, err)
+	assert.Nil(t, updates, "should not emit update for added entity")
+
+	e1.UpdatedAt = 2
+	_, err = store.AddBatch(ctx, []testutil.Entity{e1, e2}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{e1.Key}, updatedKeys)
+	assert.Equal(t, []EntityUpdate{{
+		Key:     e1.Key,
+		Changes: []FieldChange{{Field: "UpdatedAt", Old: int64(1), New: int64(2)}},
+	}}, updates)
+}
@@ -0,0 +1,122 @@
+package entitystore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrMirrorFailed is returned by a DualWriteStore when a write was applied to the source store,
+// but failed to be mirrored to the target store.
+var ErrMirrorFailed = errors.New("entitystore: mirror write failed")
+
+// DualWriteStore is an EntityStorer decorator for the dual-write migration of a store to a target
+// store, e.g. of another datastore or namespace: writes are applied to the source store, and then
+// mirrored to the target store with the same expiration, so mirrored entities expire with their
+// source entities. Reads and other operations are served by the source store.
+//
+// Add, AddBatch, AddBatchPartial, Remove, RemoveByKeys, RemoveByKeysPartial, and RemoveAll are
+// mirrored; dry runs and Flush aren't. Entities written before the dual writes started are
+// backfilled with CopyTo, which preserves their remaining time to live, after which reads can be
+// switched to the target store.
+//
+// A write failing with an error wrapping ErrMirrorFailed was still applied to the source store.
+type DualWriteStore[T Entity, PT SerializableEntity[T]] struct {
+	EntityStorer[T, PT]
+	target EntityStorer[T, PT]
+}
+
+// NewDualWriteStore returns a store mirroring the writes of the source store to the target store.
+func NewDualWriteStore[T Entity, PT SerializableEntity[T]](
+	source EntityStorer[T, PT],
+	target EntityStorer[T, PT],
+) *DualWriteStore[T, PT] {
+	return &DualWriteStore[T, PT]{EntityStorer: source, target: target}
+}
+
+// Target returns the target store of the mirrored writes.
+func (s *DualWriteStore[T, PT]) Target() EntityStorer[T, PT] {
+	return s.target
+}
+
+// mirror wraps the error of a write mirrored to the target store with ErrMirrorFailed.
+func mirror(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%w: %s: %w", ErrMirrorFailed, op, err)
+}
+
+func (s *DualWriteStore[T, PT]) Add(ctx context.Context, entity T, expiration time.Duration, opts ...CallOption) (string, error) {
+	key, err := s.EntityStorer.Add(ctx, entity, expiration, opts...)
+	if err != nil || newCallOptions(opts).dryRun {
+		return key, err
+	}
+	_, err = s.target.Add(ctx, entity, expiration, opts...)
+	return key, mirror("add", err)
+}
+
+func (s *DualWriteStore[T, PT]) AddBatch(ctx context.Context, entities []T, expiration time.Duration) ([]string, error) {
+	keys, err := s.EntityStorer.AddBatch(ctx, entities, expiration)
+	if err != nil {
+		return keys, err
+	}
+	_, err = s.target.AddBatch(ctx, entities, expiration)
+	return keys, mirror("add_batch", err)
+}
+
+// AddBatchPartial adds the entities to the source store like EntityStore.AddBatchPartial, and
+// mirrors the entities added successfully.
+func (s *DualWriteStore[T, PT]) AddBatchPartial(ctx context.Context, entities []T, expiration time.Duration) (*BatchResult, error) {
+	result, err := s.EntityStorer.AddBatchPartial(ctx, entities, expiration)
+	if err != nil {
+		return result, err
+	}
+	added := make([]T, 0, len(entities))
+	for i, item := range result.Items {
+		if item.Err == nil {
+			added = append(added, entities[i])
+		}
+	}
+	if len(added) == 0 {
+		return result, nil
+	}
+	_, err = s.target.AddBatch(ctx, added, expiration)
+	return result, mirror("add_batch_partial", err)
+}
+
+func (s *DualWriteStore[T, PT]) Remove(ctx context.Context, entityKey string, opts ...CallOption) error {
+	if err := s.EntityStorer.Remove(ctx, entityKey, opts...); err != nil || newCallOptions(opts).dryRun {
+		return err
+	}
+	return mirror("remove", s.target.Remove(ctx, entityKey, opts...))
+}
+
+func (s *DualWriteStore[T, PT]) RemoveByKeys(ctx context.Context, entityKeys []string) error {
+	if err := s.EntityStorer.RemoveByKeys(ctx, entityKeys); err != nil {
+		return err
+	}
+	return mirror("remove_by_keys", s.target.RemoveByKeys(ctx, entityKeys))
+}
+
+// RemoveByKeysPartial removes the entities from the source store like
+// EntityStore.RemoveByKeysPartial, and mirrors the removals processed successfully.
+func (s *DualWriteStore[T, PT]) RemoveByKeysPartial(ctx context.Context, entityKeys []string) (*BatchResult, error) {
+	result, err := s.EntityStorer.RemoveByKeysPartial(ctx, entityKeys)
+	if err != nil {
+		return result, err
+	}
+	removed := result.Succeeded()
+	if len(removed) == 0 {
+		return result, nil
+	}
+	return result, mirror("remove_by_keys_partial", s.target.RemoveByKeys(ctx, removed))
+}
+
+func (s *DualWriteStore[T, PT]) RemoveAll(ctx context.Context, parentKey string) error {
+	if err := s.EntityStorer.RemoveAll(ctx, parentKey); err != nil {
+		return err
+	}
+	return mirror("remove_all", s.target.RemoveAll(ctx, parentKey))
+}
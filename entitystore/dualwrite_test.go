@@ -0,0 +1,79 @@
+package entitystore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDualWriteStore(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	newStore := func(t *testing.T, namespace string) *EntityStore[testutil.Entity, *testutil.Entity] {
+		t.Helper()
+		s, err := New[testutil.Entity](string(keyfactory.EntityKindTest), namespace, dsClient)
+		require.NoError(t, err)
+		return s
+	}
+	targetNamespace := keyfactory.GenerateRandomKey()
+	source, target := newStore(t, keyfactory.GenerateRandomKey()), newStore(t, targetNamespace)
+	dual := NewDualWriteStore[testutil.Entity](source, target)
+	e1, e2, e3 := testutil.NewEntity("e-1", mockTenantId, 1), testutil.NewEntity("e-2", mockTenantId, 1), testutil.NewEntity("e-3", mockTenantId, 1)
+
+	t.Run("Should mirror writes with their expiration", func(t *testing.T) {
+		_, err := dual.Add(ctx, e1, time.Minute)
+		require.NoError(t, err)
+		_, err = dual.AddBatch(ctx, []testutil.Entity{e2, e3}, 0)
+		require.NoError(t, err)
+		for _, s := range []*EntityStore[testutil.Entity, *testutil.Entity]{source, target} {
+			entities, err := s.GetByKeys(ctx, []string{e1.Key, e2.Key, e3.Key})
+			require.NoError(t, err)
+			assert.Len(t, entities, 3)
+		}
+		records, err := dsClient.GetMultiWithTTL(ctx, []*keyfactory.Key{keyfactory.NewKey(e1.Key, targetNamespace)})
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+		assert.InDelta(t, time.Minute, records[0].TTL, float64(time.Second), "should mirror the expiration")
+
+		require.NoError(t, dual.Remove(ctx, e1.Key))
+		require.NoError(t, dual.RemoveByKeys(ctx, []string{e2.Key}))
+		ok, err := target.Exists(ctx, e1.Key)
+		require.NoError(t, err)
+		assert.False(t, ok)
+		ok, err = target.Exists(ctx, e2.Key)
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("Should not mirror dry runs", func(t *testing.T) {
+		_, err := dual.Add(ctx, e1, 0, DryRun())
+		require.NoError(t, err)
+		ok, err := target.Exists(ctx, e1.Key)
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("Should report mirror failures", func(t *testing.T) {
+		failingTarget, err := New[testutil.Entity](
+			string(keyfactory.EntityKindTest), targetNamespace, dsClient, WithMaxEntitySize(1),
+		)
+		require.NoError(t, err)
+		failing := NewDualWriteStore[testutil.Entity](source, failingTarget)
+		_, err = failing.Add(ctx, e1, 0)
+		assert.ErrorIs(t, err, ErrMirrorFailed)
+		assert.ErrorIs(t, err, ErrEntityTooLarge)
+		ok, err := source.Exists(ctx, e1.Key)
+		require.NoError(t, err)
+		assert.True(t, ok, "should apply the write to the source store")
+	})
+}
@@ -0,0 +1,90 @@
+package entitystore
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/holmberd/go-entitystore/encoder"
+)
+
+const (
+	parallelEncodeThreshold = 256     // Min number of entities in a batch encoded in parallel.
+	encodeChunkSize         = 64      // Number of entities claimed at a time by an encode worker.
+	maxPooledBufferSize     = 1 << 16 // Max capacity in bytes of an encode buffer returned to the pool.
+)
+
+var encodeBufferPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, 512)
+		return &b
+	},
+}
+
+// encodeBatch encodes the entities for a batch write, in parallel on a bounded number of
+// goroutines for large batches. The returned data and errors are aligned with the entities.
+//
+// If the entities implement encoder.ProtoAppender, the data is encoded into pooled buffers.
+// The release function returns the buffers to the pool, and must only be called once the data
+// is no longer used.
+func (es *EntityStore[T, PT]) encodeBatch(entities []PT) (data [][]byte, errs []error, release func()) {
+	workers := 1
+	if len(entities) >= parallelEncodeThreshold {
+		workers = min(runtime.GOMAXPROCS(0), (len(entities)+encodeChunkSize-1)/encodeChunkSize)
+	}
+	return es.encodeBatchWorkers(entities, workers)
+}
+
+func (es *EntityStore[T, PT]) encodeBatchWorkers(entities []PT, workers int) ([][]byte, []error, func()) {
+	data := make([][]byte, len(entities))
+	errs := make([]error, len(entities))
+	_, pooled := any(PT(new(T))).(encoder.ProtoAppender)
+	var bufs []*[]byte
+	if pooled {
+		bufs = make([]*[]byte, len(entities))
+	}
+	encodeRange := func(start, end int) {
+		for i := start; i < end; i++ {
+			if !pooled {
+				data[i], errs[i] = es.encode(entities[i])
+				continue
+			}
+			buf := encodeBufferPool.Get().(*[]byte)
+			d, err := es.encodeAppend((*buf)[:0], entities[i])
+			if err == nil {
+				*buf = d // Keep a grown buffer.
+			}
+			data[i], errs[i] = d, err
+			bufs[i] = buf
+		}
+	}
+	if workers <= 1 {
+		encodeRange(0, len(entities))
+	} else {
+		var next atomic.Int64 // Start index of the next unclaimed chunk.
+		var wg sync.WaitGroup
+		for range workers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					start := int(next.Add(encodeChunkSize)) - encodeChunkSize
+					if start >= len(entities) {
+						return
+					}
+					encodeRange(start, min(start+encodeChunkSize, len(entities)))
+				}
+			}()
+		}
+		wg.Wait()
+	}
+	release := func() {
+		for _, buf := range bufs {
+			if buf != nil && cap(*buf) <= maxPooledBufferSize {
+				*buf = (*buf)[:0]
+				encodeBufferPool.Put(buf)
+			}
+		}
+	}
+	return data, errs, release
+}
@@ -0,0 +1,110 @@
+package entitystore
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"testing"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBenchEntities(b testing.TB, n int) []TestEntity {
+	b.Helper()
+	entities := make([]TestEntity, n)
+	for i := range entities {
+		e, err := NewTestEntity(fmt.Sprintf("e-%d", i), mockTenantId)
+		require.NoError(b, err)
+		entities[i] = *e
+	}
+	return entities
+}
+
+func toPtrs[T any](entities []T) []*T {
+	ptrs := make([]*T, len(entities))
+	for i := range entities {
+		ptrs[i] = &entities[i]
+	}
+	return ptrs
+}
+
+func TestEntityStoreEncodeBatch(t *testing.T) {
+	store, err := New[TestEntity](string(keyfactory.EntityKindTest), "", nil, WithChecksum())
+	require.NoError(t, err)
+	ptrs := toPtrs(newBenchEntities(t, 1000))
+
+	t.Run("Parallel matches sequential", func(t *testing.T) {
+		want, _, releaseWant := store.encodeBatchWorkers(ptrs, 1)
+		defer releaseWant()
+		got, errs, release := store.encodeBatchWorkers(ptrs, 4)
+		defer release()
+		for i := range ptrs {
+			require.NoError(t, errs[i])
+			assert.Equal(t, want[i], got[i])
+			var decoded TestEntity
+			require.NoError(t, store.decode(ptrs[i].Key, got[i], &decoded))
+			assert.Equal(t, *ptrs[i], decoded)
+		}
+	})
+
+	t.Run("Aligned errors", func(t *testing.T) {
+		store, err := New[testutil.Entity](string(keyfactory.EntityKindTest), "", nil, WithMaxEntitySize(200))
+		require.NoError(t, err)
+		entities := make([]testutil.Entity, parallelEncodeThreshold)
+		for i := range entities {
+			entities[i] = testutil.NewEntity(fmt.Sprintf("e-%d", i), mockTenantId, 1)
+		}
+		entities[100].Data = string(make([]byte, 200))
+		data, errs, release := store.encodeBatch(toPtrs(entities))
+		defer release()
+		for i := range entities {
+			if i == 100 {
+				assert.ErrorIs(t, errs[i], ErrEntityTooLarge)
+				continue
+			}
+			assert.NoError(t, errs[i])
+			assert.NotEmpty(t, data[i])
+		}
+	})
+}
+
+func BenchmarkEncodeBatch(b *testing.B) {
+	store, err := New[TestEntity](string(keyfactory.EntityKindTest), "", nil)
+	require.NoError(b, err)
+	ptrs := toPtrs(newBenchEntities(b, 50000))
+	for _, bc := range []struct {
+		name    string
+		workers int
+	}{
+		{name: "Sequential", workers: 1},
+		{name: "Parallel", workers: runtime.GOMAXPROCS(0)},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				_, _, release := store.encodeBatchWorkers(ptrs, bc.workers)
+				release()
+			}
+		})
+	}
+}
+
+func BenchmarkAddBatch(b *testing.B) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(b)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(b, err)
+	store, err := New[TestEntity](string(keyfactory.EntityKindTest), keyfactory.GenerateRandomKey(), dsClient)
+	require.NoError(b, err)
+	entities := newBenchEntities(b, 10000)
+	ctx := context.Background()
+	b.ReportAllocs()
+	for b.Loop() {
+		_, err := store.AddBatch(ctx, entities, 0)
+		require.NoError(b, err)
+	}
+}
@@ -0,0 +1,89 @@
+package entitystore
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// Keyring holds the versioned AES keys of an encrypted store (see WithEncryption).
+// Values are encrypted with the current key, and decrypted with the key of the version they
+// were encrypted with, so values encrypted with previous keys are readable during a rotation.
+type Keyring struct {
+	current uint8
+	aeads   map[uint8]cipher.AEAD
+}
+
+// NewKeyring returns a keyring of the AES-128, AES-192, or AES-256 keys by version, encrypting
+// with the key of the current version.
+func NewKeyring(current uint8, keys map[uint8][]byte) (*Keyring, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("entitystore: keyring has no key of current version %d", current)
+	}
+	kr := &Keyring{current: current, aeads: make(map[uint8]cipher.AEAD, len(keys))}
+	for version, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("entitystore: invalid key of version %d: %w", version, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		kr.aeads[version] = aead
+	}
+	return kr, nil
+}
+
+// seal appends the key version, nonce, and the plaintext encrypted with the current key to the buffer.
+// The additional data is authenticated, but not encrypted.
+func (kr *Keyring) seal(buf, plaintext, additionalData []byte) ([]byte, error) {
+	aead := kr.aeads[kr.current]
+	buf = append(buf, kr.current)
+	nonceStart := len(buf)
+	buf = append(buf, make([]byte, aead.NonceSize())...)
+	if _, err := rand.Read(buf[nonceStart:]); err != nil {
+		return nil, err
+	}
+	return aead.Seal(buf, buf[nonceStart:], plaintext, additionalData), nil
+}
+
+// open decrypts the data sealed with a key of the keyring.
+func (kr *Keyring) open(data, additionalData []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, errors.New("value too short for key version")
+	}
+	aead, ok := kr.aeads[data[0]]
+	if !ok {
+		return nil, fmt.Errorf("unknown key version %d", data[0])
+	}
+	data = data[1:]
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("value too short for nonce")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], additionalData)
+}
+
+// isCurrent returns whether the data is sealed with the current key.
+func (kr *Keyring) isCurrent(data []byte) bool {
+	return len(data) > 0 && data[0] == kr.current
+}
+
+// RotateEncryptionKey re-encrypts all entities under the parent key encrypted with a previous key
+// of the store's keyring with its current key, so the previous keys can be retired once it
+// completes. It's a Reencode of the entities that aren't encrypted with the current key, and
+// accepts the same scan options, e.g. WithCheckpoint to make the rotation resumable and
+// WithProgress to track it.
+func (es *EntityStore[T, PT]) RotateEncryptionKey(
+	ctx context.Context,
+	parentKey string,
+	opts ...ScanOption,
+) (UpdateProgress, error) {
+	if es.opts.keyring == nil {
+		return UpdateProgress{}, errors.New("entitystore: key rotation requires encryption")
+	}
+	return es.Reencode(ctx, parentKey, nil, opts...)
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/holmberd/go-entitystore/datastore"
@@ -13,27 +15,68 @@ import (
 	"github.com/holmberd/go-entitystore/keyfactory"
 )
 
-const Nil = EntityStoreError("entitystore: nil")
+const (
+	Nil                  = EntityStoreError("entitystore: nil")
+	ErrFlushNotAllowed   = EntityStoreError("entitystore: flush not allowed")
+	ErrTooManyEntities   = EntityStoreError("entitystore: too many entities")
+	ErrDuplicateKey      = EntityStoreError("entitystore: duplicate key")
+	ErrUnscopedRemove    = EntityStoreError("entitystore: unscoped remove not allowed")
+	ErrParentKeyMismatch = EntityStoreError("entitystore: parent key mismatch")
+	ErrKeyCollision      = EntityStoreError("entitystore: key collision")
+	ErrDecodeFailed      = EntityStoreError("entitystore: decode failed")
+	ErrVerifyFailed      = EntityStoreError("entitystore: verify failed")
+	ErrReferenced        = EntityStoreError("entitystore: entity is referenced")
+	ErrReserved          = EntityStoreError("entitystore: entity is reserved")
+	ErrNotReserved       = EntityStoreError("entitystore: entity not reserved")
+	ErrForbidden         = EntityStoreError("entitystore: access forbidden")
+)
+
+// Errors of the datastore returned by the store, e.g. Get returns an error wrapping
+// ErrEntityNotFound if the entity doesn't exist. They're the datastore's errors, so they match
+// with errors.Is regardless of whether callers check the store's or the datastore's error, and
+// errors.As can be used to get the failed operation (see datastore.OpError).
+var (
+	ErrEntityNotFound     = datastore.ErrKeyNotFound
+	ErrInvalidKey         = datastore.ErrInvalidKey
+	ErrEncoding           = datastore.ErrEncoding
+	ErrCorruptedData      = datastore.ErrCorruptedData
+	ErrBackendUnavailable = datastore.ErrBackendUnavailable
+)
+
+const DefaultMaxPageSize = 1000 // Default max number of keys scanned per page.
+
+const DefaultUpdateRetries = 3 // Default max number of retries of UpdateWithRetry on conflicting writes.
+
+const (
+	MetricRemoved      = "entitystore_removed_total"       // Counter of entities removed.
+	MetricRemoveMisses = "entitystore_remove_misses_total" // Counter of removals of entities that didn't exist.
+	MetricReadHits     = "entitystore_read_hits_total"     // Counter of entities found by key reads.
+	MetricReadMisses   = "entitystore_read_misses_total"   // Counter of entities not found by key reads.
+)
 
 type EntityStoreError string
 
 func (e EntityStoreError) Error() string { return string(e) }
 
 type EntityStorer[T Entity, PT SerializableEntity[T]] interface {
-	flush(ctx context.Context) error
-	Add(ctx context.Context, entity T, expiration time.Duration) (string, error)
+	Flush(ctx context.Context) error
+	Add(ctx context.Context, entity T, expiration time.Duration, opts ...CallOption) (string, error)
 	AddBatch(ctx context.Context, entities []T, expiration time.Duration) ([]string, error)
-	Remove(ctx context.Context, entityKey string) error
+	AddBatchPartial(ctx context.Context, entities []T, expiration time.Duration) (*BatchResult, error)
+	Remove(ctx context.Context, entityKey string, opts ...CallOption) error
 	RemoveByKeys(ctx context.Context, entityKeys []string) error
+	RemoveByKeysPartial(ctx context.Context, entityKeys []string) (*BatchResult, error)
 	RemoveAll(ctx context.Context, parentKey string) error
-	Get(ctx context.Context, entityKey string) (PT, error)
+	Get(ctx context.Context, entityKey string, opts ...CallOption) (PT, error)
 	GetByKeys(ctx context.Context, entityKeys []string) ([]PT, error)
+	GetByKeysPartial(ctx context.Context, entityKeys []string) ([]PT, *BatchResult, error)
 	GetWithPagination(ctx context.Context, cursor uint64, limit int, parentKey string) (*EntityCursor[T, PT], error)
 	GetAll(ctx context.Context, parentKey string) ([]PT, error)
 	Exists(ctx context.Context, entityKey string) (bool, error)
 	OnAdded() *eventTarget
 	OnUpdated() *eventTarget
 	OnRemoved() *eventTarget
+	OnFlushed() *eventTarget
 }
 
 type Event int
@@ -43,6 +86,9 @@ const (
 	EntitiesRemoved
 	EntitiesUpdated
 	EntitiesFlushed
+	EntitiesSizeWarning
+	EntitiesDue
+	EntitiesQuotaThreshold
 )
 
 func (e Event) String() string {
@@ -55,6 +101,12 @@ func (e Event) String() string {
 		return "EntitiesUpdated"
 	case EntitiesFlushed:
 		return "EntitiesFlushed"
+	case EntitiesSizeWarning:
+		return "EntitiesSizeWarning"
+	case EntitiesDue:
+		return "EntitiesDue"
+	case EntitiesQuotaThreshold:
+		return "EntitiesQuotaThreshold"
 	default:
 		return fmt.Sprintf("event(%d)", e)
 	}
@@ -64,6 +116,12 @@ type Entity interface {
 	GetKey() string // Entity structured unique datastore key.
 }
 
+// KeySetter is implemented by entities whose encoding excludes their key, e.g. with content
+// addressing (see WithContentAddressing), so the key is set on the entity when it's decoded.
+type KeySetter interface {
+	SetKey(key string)
+}
+
 // SerializableEntity represents an entity that can be serialized/deserialized.
 type SerializableEntity[T Entity] interface {
 	*T // Ensures T is a value type and *T is a pointer.
@@ -76,48 +134,102 @@ type SerializableEntity[T Entity] interface {
 type EntityCursor[T Entity, PT SerializableEntity[T]] struct {
 	Cursor   uint64
 	Entities []PT
+	HasMore  bool  // Whether more pages can be retrieved with the cursor.
+	Total    int64 // Approximate total number of entities, or -1 if unknown (see WithIndex).
 }
 
 type EntityStoreListener func(ctx context.Context, keys []string)
 
 type eventTarget struct {
-	t *eventemitter.EventTarget
+	t         *eventemitter.EventTarget
+	onInvalid func(err error)   // Called instead of the listener on malformed event arguments.
+	onSkipped func(skipped int) // If set, listeners are skipped once the context is done (see WithCancelableEvents).
+}
+
+func newEventTarget(event Event, onInvalid func(err error)) *eventTarget {
+	return &eventTarget{
+		t:         eventemitter.NewEventTarget(event.String()),
+		onInvalid: onInvalid,
+	}
 }
 
 func (e *eventTarget) AddListener(listener EntityStoreListener) eventemitter.ListenerToken {
 	return e.t.AddListener(func(args ...any) {
 		if len(args) < 2 {
-			log.Panicf("missing arguments in %s event listener", EntitiesAdded)
+			e.onInvalid(fmt.Errorf("missing arguments in %s event listener", e.t.EventName()))
+			return
 		}
 		ctx, ok := args[0].(context.Context)
 		if !ok {
-			log.Panicf("argument is not of expected type %T (got %T)", context.Background(), args[0])
+			e.onInvalid(fmt.Errorf("argument is not of expected type %T (got %T)", context.Background(), args[0]))
+			return
 		}
 		keys, ok := args[1].([]string)
 		if !ok {
-			log.Panicf("argument is not of expected type %T (got %T)", []string{}, args[1])
+			e.onInvalid(fmt.Errorf("argument is not of expected type %T (got %T)", []string{}, args[1]))
+			return
 		}
 		listener(ctx, keys)
 	})
 }
 
+// AddListenerFiltered is like AddListener, but only calls the listener with the event keys matching
+// the predicate, e.g. the keys of one tenant, and doesn't call it if no key matches.
+// The listener isn't called for events without keys, e.g. EntitiesFlushed.
+func (e *eventTarget) AddListenerFiltered(predicate func(key string) bool, listener EntityStoreListener) eventemitter.ListenerToken {
+	return e.AddListener(func(ctx context.Context, keys []string) {
+		var matched []string
+		for _, key := range keys {
+			if predicate(key) {
+				matched = append(matched, key)
+			}
+		}
+		if len(matched) > 0 {
+			listener(ctx, matched)
+		}
+	})
+}
+
 func (e *eventTarget) RemoveListener(token eventemitter.ListenerToken) bool {
 	return e.t.RemoveListener(token)
 }
 
 func (e *eventTarget) emit(ctx context.Context, keys []string) bool {
+	if eventsSkipped(ctx) {
+		return false
+	}
+	if e.onSkipped != nil {
+		return emitCancelable(ctx, e.t, e.onSkipped, ctx, keys)
+	}
 	return e.t.Emit(ctx, keys)
 }
 
 // EntityStore provides a reusable datastore implementation for an entity kind/type.
 type EntityStore[T Entity, PT SerializableEntity[T]] struct {
-	entityKind string // Required logical entity identifier.
-	namespace  string // Optional key namespace.
-	dsClient   *datastore.Client
-	onAdded    *eventTarget
-	onRemoved  *eventTarget
-	onUpdated  *eventTarget
-	onFlushed  *eventTarget
+	entityKind    string // Required logical entity identifier.
+	namespace     string // Optional key namespace.
+	dsClient      *datastore.Client
+	onAdded       *eventTarget
+	onRemoved     *eventTarget
+	onUpdated     *eventTarget
+	onFlushed     *eventTarget
+	onUpdatedDiff *updateEventTarget
+	onSizeWarn    *eventTarget
+	onQuota       *quotaEventTarget
+	opts          options
+
+	readMu         sync.RWMutex
+	readTransforms []func(PT) error // See TransformOnRead.
+
+	refMu     sync.RWMutex
+	referrers []referrer // See AddReference.
+
+	dueMu sync.Mutex
+	onDue map[string]*eventTarget // See ScheduleAt.
+
+	quotaMu     sync.Mutex
+	quotaLevels map[string]int // Last reached quota threshold per parent key, see WithQuotaWarnings.
+	quotaOrder  []string       // Parent keys of the quota levels in insertion order, for eviction.
 }
 
 // NewEntityStore creates a new instance of a store.
@@ -125,6 +237,7 @@ func New[T Entity, PT SerializableEntity[T]](
 	entityKind string,
 	namespace string,
 	dsClient *datastore.Client,
+	opts ...Option,
 ) (*EntityStore[T, PT], error) {
 	if entityKind == "" {
 		return nil, errors.New("entity kind must not be empty")
@@ -134,15 +247,54 @@ func New[T Entity, PT SerializableEntity[T]](
 			return nil, err
 		}
 	}
-	return &EntityStore[T, PT]{
-		entityKind: entityKind,
-		namespace:  namespace,
-		dsClient:   dsClient,
-		onAdded:    &eventTarget{eventemitter.NewEventTarget(EntitiesAdded.String())},
-		onRemoved:  &eventTarget{eventemitter.NewEventTarget(EntitiesRemoved.String())},
-		onUpdated:  &eventTarget{eventemitter.NewEventTarget(EntitiesUpdated.String())},
-		onFlushed:  &eventTarget{eventemitter.NewEventTarget(EntitiesFlushed.String())},
-	}, nil
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.quotaLimit > 0 && !o.index {
+		return nil, errors.New("entitystore: quota warnings require the index")
+	}
+	if o.contentAddressing && o.keyring != nil {
+		return nil, errors.New("entitystore: content addressing can't be combined with encryption")
+	}
+	if o.quarantineNamespace != "" {
+		if err := keyfactory.ValidateKeyFragment(o.quarantineNamespace); err != nil {
+			return nil, err
+		}
+		if o.corruptEntityHandler == nil {
+			return nil, errors.New("entitystore: quarantine namespace requires a corrupt entity handler")
+		}
+	}
+	es := &EntityStore[T, PT]{
+		entityKind:    entityKind,
+		namespace:     namespace,
+		dsClient:      dsClient,
+		onAdded:       newEventTarget(EntitiesAdded, o.corruptionHandler),
+		onRemoved:     newEventTarget(EntitiesRemoved, o.corruptionHandler),
+		onUpdated:     newEventTarget(EntitiesUpdated, o.corruptionHandler),
+		onUpdatedDiff: newUpdateEventTarget(EntitiesUpdated, o.corruptionHandler),
+		onFlushed:     newEventTarget(EntitiesFlushed, o.corruptionHandler),
+		onSizeWarn:    newEventTarget(EntitiesSizeWarning, o.corruptionHandler),
+		onQuota:       newQuotaEventTarget(EntitiesQuotaThreshold, o.corruptionHandler),
+		opts:          o,
+		quotaLevels:   make(map[string]int),
+	}
+	if o.cancelableEvents {
+		es.enableCancelableEvents()
+	}
+	if o.changeLogMaxLen > 0 {
+		es.enableChangeLog()
+	}
+	if o.onAdded != nil {
+		es.onAdded.AddListener(o.onAdded)
+	}
+	if o.onUpdated != nil {
+		es.onUpdated.AddListener(o.onUpdated)
+	}
+	if o.onRemoved != nil {
+		es.onRemoved.AddListener(o.onRemoved)
+	}
+	return es, nil
 }
 
 func (es *EntityStore[T, PT]) EntityKind() string {
@@ -150,7 +302,15 @@ func (es *EntityStore[T, PT]) EntityKind() string {
 }
 
 func (es *EntityStore[T, PT]) NewKeyBuilder() *keyfactory.KeyBuilderWithNamespace {
-	return keyfactory.NewKeyBuilderWithNamespace(es.namespace)
+	kb := keyfactory.NewKeyBuilderWithNamespace(es.namespace)
+	kb.WithKeyStrategy(es.opts.keyStrategy)
+	return kb
+}
+
+// EntityKey returns the key of the entity of the store's entity kind with the ID, laid out by the
+// store's key strategy (see WithKeyStrategy). Entities should return it from GetKey.
+func (es *EntityStore[T, PT]) EntityKey(entityId, entityVersionId, parentKey string) (string, error) {
+	return es.opts.keyStrategy.EntityKey(keyfactory.EntityKind(es.entityKind), entityId, entityVersionId, parentKey)
 }
 
 func (es *EntityStore[T, PT]) OnAdded() *eventTarget {
@@ -161,6 +321,12 @@ func (es *EntityStore[T, PT]) OnUpdated() *eventTarget {
 	return es.onUpdated
 }
 
+// OnUpdatedDiff returns the event target of updated entities with their field-level changes.
+// Requires the WithUpdateDiffs option.
+func (es *EntityStore[T, PT]) OnUpdatedDiff() *updateEventTarget {
+	return es.onUpdatedDiff
+}
+
 func (es *EntityStore[T, PT]) OnRemoved() *eventTarget {
 	return es.onRemoved
 }
@@ -169,11 +335,23 @@ func (es *EntityStore[T, PT]) OnFlushed() *eventTarget {
 	return es.onFlushed
 }
 
-// flush deletes all keys in the key namespace, used in e.g. tests.
+// OnSizeWarning returns the event target triggered with the keys of written entities
+// exceeding the large entity threshold.
+func (es *EntityStore[T, PT]) OnSizeWarning() *eventTarget {
+	return es.onSizeWarn
+}
+
+// Flush deletes all keys in the key namespace, used in e.g. tests and admin tooling.
 // It triggers the EntitiesFlushed event.
-func (es *EntityStore[T, PT]) flush(ctx context.Context) error {
+//
+// ErrFlushNotAllowed is returned unless the store was created with the WithAllowFlush option
+// and a key namespace.
+func (es *EntityStore[T, PT]) Flush(ctx context.Context) error {
+	if !es.opts.allowFlush {
+		return fmt.Errorf("%w: store created without allow flush option", ErrFlushNotAllowed)
+	}
 	if es.namespace == "" {
-		log.Panic("flush store called without key namespace set")
+		return fmt.Errorf("%w: store created without key namespace", ErrFlushNotAllowed)
 	}
 	kb := es.NewKeyBuilder()
 	kb.WithWildcard(keyfactory.WildcardAnyString)
@@ -191,25 +369,229 @@ func (es *EntityStore[T, PT]) flush(ctx context.Context) error {
 
 // Add adds an entity to the store.
 // If the entity doesn't exist it's added, otherwise it's updated.
-func (es *EntityStore[T, PT]) Add(ctx context.Context, entity T, expiration time.Duration) (string, error) {
+func (es *EntityStore[T, PT]) Add(ctx context.Context, entity T, expiration time.Duration, opts ...CallOption) (string, error) {
+	o := newCallOptions(opts)
+	ctx = o.context(ctx)
+	if o.hasTTL {
+		expiration = o.ttl
+	}
+	if err := es.checkParentKey(ctx, entity.GetKey()); err != nil {
+		return "", err
+	}
+	if err := es.authorize(ctx, AccessWrite, []string{entity.GetKey()}); err != nil {
+		return "", err
+	}
 	kb := es.NewKeyBuilder()
 	kb.WithKey(entity.GetKey())
 	key, err := kb.BuildAndReset()
 	if err != nil {
 		return "", err
 	}
-	data, err := encoder.ProtoMarshal(PT(&entity))
+	data, err := es.encode(PT(&entity))
+	if err != nil {
+		return "", err
+	}
+	if err := es.firstCollision(ctx, []*keyfactory.Key{key}, []PT{&entity}); err != nil {
+		return "", err
+	}
+	if o.dryRun {
+		return entity.GetKey(), nil
+	}
+	previous, err := es.loadPrevious(ctx, []*keyfactory.Key{key})
 	if err != nil {
 		return "", err
 	}
-	if err = es.dsClient.Put(ctx, key, data, expiration); err != nil {
+	if err = es.put(ctx, key, data, expiration); err != nil {
 		return "", err
 	}
+	if err = es.indexAdd(ctx, &entity); err != nil {
+		return "", err
+	}
+	es.observeSizes(ctx, []string{entity.GetKey()}, [][]byte{data})
 	es.onAdded.emit(ctx, []string{entity.GetKey()})
+	es.emitUpdates(ctx, previous, []PT{&entity})
+	es.checkQuotas(ctx, []string{entity.GetKey()})
 	return entity.GetKey(), nil
 }
 
+// Update is like Add, but only replaces an existing entity, and returns an error wrapping
+// ErrEntityNotFound if the entity doesn't exist. It triggers the OnUpdated event instead of the
+// OnAdded event.
+func (es *EntityStore[T, PT]) Update(ctx context.Context, entity T, expiration time.Duration, opts ...CallOption) error {
+	if err := es.checkContentAddressing("update"); err != nil {
+		return err
+	}
+	o := newCallOptions(opts)
+	ctx = o.context(ctx)
+	if o.hasTTL {
+		expiration = o.ttl
+	}
+	if err := es.checkParentKey(ctx, entity.GetKey()); err != nil {
+		return err
+	}
+	if err := es.authorize(ctx, AccessWrite, []string{entity.GetKey()}); err != nil {
+		return err
+	}
+	kb := es.NewKeyBuilder()
+	kb.WithKey(entity.GetKey())
+	key, err := kb.BuildAndReset()
+	if err != nil {
+		return err
+	}
+	data, err := es.encode(PT(&entity))
+	if err != nil {
+		return err
+	}
+	if err := es.firstCollision(ctx, []*keyfactory.Key{key}, []PT{&entity}); err != nil {
+		return err
+	}
+	if o.dryRun {
+		return nil
+	}
+	previous, err := es.loadPrevious(ctx, []*keyfactory.Key{key})
+	if err != nil {
+		return err
+	}
+	updated, err := es.dsClient.PutIfExists(ctx, key, data, expiration)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return fmt.Errorf("entitystore: update of entity '%s': %w", entity.GetKey(), ErrEntityNotFound)
+	}
+	if err = es.indexAdd(ctx, &entity); err != nil {
+		return err
+	}
+	es.observeSizes(ctx, []string{entity.GetKey()}, [][]byte{data})
+	if len(previous) > 0 && previous[0] != nil {
+		es.emitUpdates(ctx, previous, []PT{&entity})
+	} else {
+		es.onUpdated.emit(ctx, []string{entity.GetKey()}) // Diffs disabled, or undecodable previous entity.
+	}
+	return nil
+}
+
+// UpdateWithRetry atomically updates the stored entity of the key with the entity returned by fn
+// for it, keeping the entity's expiration. If the entity is modified concurrently, fn is called
+// again with the modified entity, up to DefaultUpdateRetries times (see WithRetries), and an error
+// wrapping datastore.ErrVersionConflict is returned if the entity keeps changing. An error wrapping
+// ErrEntityNotFound is returned if the entity doesn't exist. If fn returns a nil entity, the entity
+// is left unchanged.
+//
+// It returns the updated entity, or the stored entity if left unchanged, and triggers the
+// OnUpdated event if the entity is updated.
+func (es *EntityStore[T, PT]) UpdateWithRetry(
+	ctx context.Context,
+	entityKey string,
+	fn func(*T) (*T, error),
+	opts ...CallOption,
+) (PT, error) {
+	if err := es.checkContentAddressing("update with retry"); err != nil {
+		return nil, err
+	}
+	o := newCallOptions(opts)
+	ctx = o.context(ctx)
+	retries := DefaultUpdateRetries
+	if o.hasRetries {
+		retries = max(o.retries, 0)
+	}
+	kb := es.NewKeyBuilder()
+	kb.WithKey(entityKey)
+	key, err := kb.BuildAndReset()
+	if err != nil {
+		return nil, err
+	}
+	if err := es.authorize(ctx, AccessWrite, []string{entityKey}); err != nil {
+		return nil, err
+	}
+	var current, updated PT
+	written, err := es.dsClient.Modify(ctx, key, retries+1, func(data []byte) ([]byte, error) {
+		current, updated = PT(new(T)), nil
+		if err := es.decode(entityKey, data, current); err != nil {
+			return nil, err
+		}
+		entity, err := fn((*T)(current))
+		if err != nil || entity == nil {
+			return nil, err
+		}
+		if PT(entity).GetKey() != entityKey {
+			return nil, fmt.Errorf("entitystore: update of entity '%s' changed its key to '%s'", entityKey, PT(entity).GetKey())
+		}
+		updated = PT(entity)
+		return es.encode(updated)
+	})
+	if written == nil {
+		if err != nil {
+			return nil, err
+		}
+		return current, nil
+	}
+	// The entity is updated even if its replication failed (see datastore.WithSyncReplication).
+	if indexErr := es.indexAdd(ctx, updated); indexErr != nil {
+		return nil, errors.Join(err, indexErr)
+	}
+	es.observeSizes(ctx, []string{entityKey}, [][]byte{written})
+	if es.opts.updateDiffs {
+		es.emitUpdates(ctx, []PT{current}, []PT{updated})
+	} else {
+		es.onUpdated.emit(ctx, []string{entityKey})
+	}
+	return updated, err
+}
+
+// AddAndGetPrevious is like Add, but atomically replaces the stored entity and returns it.
+// If the entity didn't exist the returned entity is nil.
+//
+// If the previous entity fails to decode, the entity is still written and the decode error is returned.
+func (es *EntityStore[T, PT]) AddAndGetPrevious(ctx context.Context, entity T, expiration time.Duration) (PT, error) {
+	if err := es.checkContentAddressing("add and get previous"); err != nil {
+		return nil, err
+	}
+	if err := es.checkParentKey(ctx, entity.GetKey()); err != nil {
+		return nil, err
+	}
+	if err := es.authorize(ctx, AccessWrite, []string{entity.GetKey()}); err != nil {
+		return nil, err
+	}
+	kb := es.NewKeyBuilder()
+	kb.WithKey(entity.GetKey())
+	key, err := kb.BuildAndReset()
+	if err != nil {
+		return nil, err
+	}
+	data, err := es.encode(PT(&entity))
+	if err != nil {
+		return nil, err
+	}
+	if err := es.firstCollision(ctx, []*keyfactory.Key{key}, []PT{&entity}); err != nil {
+		return nil, err
+	}
+	prevData, err := es.dsClient.PutAndGet(ctx, key, data, expiration)
+	if err != nil {
+		return nil, err
+	}
+	if err = es.indexAdd(ctx, &entity); err != nil {
+		return nil, err
+	}
+	var previous PT
+	var decodeErr error
+	if prevData != nil {
+		previous = PT(new(T))
+		if decodeErr = es.decode(entity.GetKey(), prevData, previous); decodeErr != nil {
+			previous = nil
+		}
+	}
+	es.observeSizes(ctx, []string{entity.GetKey()}, [][]byte{data})
+	es.onAdded.emit(ctx, []string{entity.GetKey()})
+	if es.opts.updateDiffs {
+		es.emitUpdates(ctx, []PT{previous}, []PT{&entity})
+	}
+	return previous, decodeErr
+}
+
 // AddBatch adds multiple entities in a batch operation to the store.
+// Entities with duplicate keys are handled by the dedup policy (see WithBatchDedup), and the
+// returned keys only include the written entities.
 func (es *EntityStore[T, PT]) AddBatch(
 	ctx context.Context,
 	entities []T,
@@ -218,54 +600,209 @@ func (es *EntityStore[T, PT]) AddBatch(
 	if len(entities) == 0 {
 		return nil, nil // No-op for empty batch.
 	}
+	entities, err := es.dedupBatch(entities)
+	if err != nil {
+		return nil, err
+	}
 
 	kb := es.NewKeyBuilder()
 	keys := make([]*keyfactory.Key, len(entities))
 	entityKeys := make([]string, len(keys))
-	data := make([][]byte, len(keys))
+	ptrs := make([]PT, len(keys))
 	for i, entity := range entities {
+		if err := es.checkParentKey(ctx, entity.GetKey()); err != nil {
+			return nil, err
+		}
 		kb.WithKey(entity.GetKey())
 		key, err := kb.BuildAndReset()
 		if err != nil {
 			return nil, err
 		}
-		d, err := encoder.ProtoMarshal(PT(&entity))
-		if err != nil {
-			return nil, fmt.Errorf("failed to marshal entity with key '%s': %w", entity.GetKey(), err)
-		}
-		data[i] = d
+		ptrs[i] = PT(&entity)
 		entityKeys[i] = entity.GetKey()
 		keys[i] = key
 	}
-	if err := es.dsClient.PutMulti(ctx, keys, data, expiration); err != nil {
+	if err := es.authorize(ctx, AccessWrite, entityKeys); err != nil {
+		return nil, err
+	}
+	data, errs, release := es.encodeBatch(ptrs)
+	defer release()
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal entity with key '%s': %w", entityKeys[i], err)
+		}
+	}
+	if err := es.firstCollision(ctx, keys, ptrs); err != nil {
+		return nil, err
+	}
+	previous, err := es.loadPrevious(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	if err := es.putMulti(ctx, keys, data, expiration); err != nil {
+		return nil, err
+	}
+	if err := es.indexAdd(ctx, ptrs...); err != nil {
 		return nil, err
 	}
+	es.observeSizes(ctx, entityKeys, data)
 	es.onAdded.emit(ctx, entityKeys)
+	es.emitUpdates(ctx, previous, ptrs)
+	es.checkQuotas(ctx, entityKeys)
 	return entityKeys, nil
 }
 
 // Remove removes an entity by key from the store.
-func (es *EntityStore[T, PT]) Remove(ctx context.Context, entityKey string) error {
+// The EntitiesRemoved event is only triggered if the entity existed.
+func (es *EntityStore[T, PT]) Remove(ctx context.Context, entityKey string, opts ...CallOption) error {
+	o := newCallOptions(opts)
+	if o.dryRun {
+		if entityKey == "" {
+			return nil // No-op for empty key.
+		}
+		kb := es.NewKeyBuilder()
+		kb.WithKey(entityKey)
+		if _, err := kb.BuildAndReset(); err != nil {
+			return err
+		}
+		if err := es.authorize(ctx, AccessWrite, []string{entityKey}); err != nil {
+			return err
+		}
+		_, err := es.dependents(ctx, []string{entityKey})
+		return err
+	}
+	_, err := es.RemoveCount(o.context(ctx), entityKey)
+	return err
+}
+
+// RemoveCount is like Remove, but returns the number of removed entities,
+// i.e. 0 if the entity didn't exist.
+func (es *EntityStore[T, PT]) RemoveCount(ctx context.Context, entityKey string) (int, error) {
 	if entityKey == "" {
-		return nil // No-op for empty key.
+		return 0, nil // No-op for empty key.
 	}
 	kb := es.NewKeyBuilder()
 	kb.WithKey(entityKey)
 	key, err := kb.BuildAndReset()
 	if err != nil {
-		return err
+		return 0, err
 	}
-	if err = es.dsClient.Delete(ctx, key); err != nil {
-		return err
+	removed, err := es.removeKeys(ctx, []string{entityKey}, []*keyfactory.Key{key})
+	return len(removed), err
+}
+
+// removeKeys deletes the entities of the keys, removes them from the index, and triggers the
+// EntitiesRemoved event with the keys of the entities actually removed, or all keys with
+// WithRemovedEventsForMissingKeys. The references to the entities are handled by their on delete
+// behavior (see AddReference). It returns the keys of the entities actually removed.
+func (es *EntityStore[T, PT]) removeKeys(
+	ctx context.Context,
+	entityKeys []string,
+	keys []*keyfactory.Key,
+) ([]string, error) {
+	if err := es.authorize(ctx, AccessWrite, entityKeys); err != nil {
+		return nil, err
+	}
+	deps, err := es.dependents(ctx, entityKeys)
+	if err != nil {
+		return nil, err
+	}
+	removed, err := es.deleteKeys(ctx, entityKeys, keys, es.deleteAligned)
+	if err != nil {
+		return removed, err
+	}
+	return removed, es.removeDependents(ctx, deps)
+}
+
+// deleteKeys deletes the entities of the keys with the delete function, and triggers the
+// EntitiesRemoved event like removeKeys, without handling their references.
+func (es *EntityStore[T, PT]) deleteKeys(
+	ctx context.Context,
+	entityKeys []string,
+	keys []*keyfactory.Key,
+	deleteFn func(ctx context.Context, keys []*keyfactory.Key) ([]bool, error),
+) ([]string, error) {
+	deleted, err := deleteFn(ctx, keys)
+	if deleted == nil && err != nil {
+		return nil, err
+	}
+	// The entities are removed even if their replication failed (see datastore.WithSyncReplication).
+	deleteErr := err
+	removed := make([]string, 0, len(entityKeys))
+	for i, ok := range deleted {
+		if ok {
+			removed = append(removed, entityKeys[i])
+		}
+	}
+	es.opts.metrics.Count(MetricRemoved, int64(len(removed)), es.metricLabels()...)
+	es.opts.metrics.Count(MetricRemoveMisses, int64(len(entityKeys)-len(removed)), es.metricLabels()...)
+	if err := es.indexRemove(ctx, entityKeys); err != nil {
+		return removed, errors.Join(deleteErr, err)
+	}
+	if err := es.removeACLs(ctx, removed); err != nil {
+		return removed, errors.Join(deleteErr, err)
+	}
+	es.checkQuotas(ctx, removed) // Lowers the reached thresholds.
+	emitted := removed
+	if es.opts.removedEventsForMissing {
+		emitted = entityKeys
+	}
+	if len(emitted) > 0 {
+		es.onRemoved.emit(ctx, emitted)
+	}
+	return removed, deleteErr
+}
+
+// RemoveIf atomically removes an entity by key if the predicate returns true for the stored entity,
+// e.g. to remove a reservation only if it's still pending. If the entity is modified concurrently the
+// predicate is evaluated again with the modified entity.
+// It returns whether the entity was removed; an entity not found in the store isn't removed.
+func (es *EntityStore[T, PT]) RemoveIf(ctx context.Context, entityKey string, predicate func(PT) bool) (bool, error) {
+	if err := es.checkContentAddressing("remove if"); err != nil {
+		return false, err
+	}
+	if entityKey == "" {
+		return false, nil // No-op for empty key.
+	}
+	kb := es.NewKeyBuilder()
+	kb.WithKey(entityKey)
+	key, err := kb.BuildAndReset()
+	if err != nil {
+		return false, err
+	}
+	if err := es.authorize(ctx, AccessWrite, []string{entityKey}); err != nil {
+		return false, err
+	}
+	removed, err := es.dsClient.DeleteIf(ctx, key, func(data []byte) (bool, error) {
+		entity := PT(new(T))
+		if err := es.decode(entityKey, data, entity); err != nil {
+			return false, err
+		}
+		return predicate(entity), nil
+	})
+	if !removed {
+		return false, err
+	}
+	// The entity is removed even if its replication failed (see datastore.WithSyncReplication).
+	if indexErr := es.indexRemove(ctx, []string{entityKey}); indexErr != nil {
+		return true, errors.Join(err, indexErr)
 	}
 	es.onRemoved.emit(ctx, []string{entityKey})
-	return nil
+	return true, err
 }
 
 // RemoveByKeys removes multiple entities by their keys from the store.
+// The EntitiesRemoved event is triggered with the keys of the entities that existed.
 func (es *EntityStore[T, PT]) RemoveByKeys(ctx context.Context, entityKeys []string) error {
+	_, err := es.RemoveByKeysCount(ctx, entityKeys)
+	return err
+}
+
+// RemoveByKeysCount is like RemoveByKeys, but returns the number of removed entities,
+// excluding entities that didn't exist.
+func (es *EntityStore[T, PT]) RemoveByKeysCount(ctx context.Context, entityKeys []string) (int, error) {
 	if len(entityKeys) == 0 {
-		return nil // No-op for empty key.
+		return 0, nil // No-op for empty key.
 	}
 	keys := make([]*keyfactory.Key, len(entityKeys))
 	kb := es.NewKeyBuilder()
@@ -273,66 +810,164 @@ func (es *EntityStore[T, PT]) RemoveByKeys(ctx context.Context, entityKeys []str
 		kb.WithKey(eKey)
 		key, err := kb.BuildAndReset()
 		if err != nil {
-			return err
+			return 0, err
 		}
 		keys[i] = key
 	}
-	if err := es.dsClient.Delete(ctx, keys...); err != nil {
-		return err
-	}
-	es.onRemoved.emit(ctx, entityKeys)
-	return nil
+	removed, err := es.removeKeys(ctx, entityKeys, keys)
+	return len(removed), err
 }
 
-// RemoveAll removes all entities from the store.
+// RemoveAll removes all entities under the parent key from the store.
+// An error wrapping ErrUnscopedRemove is returned if the parent key is empty, unless the store was
+// created with WithUnscopedRemoveAll, in which case all entities without a parent key are removed.
+// Use RemoveAllUnscoped to remove the entities of all parents.
 //
 // NOTE: This is a blocking operation.
 func (es *EntityStore[T, PT]) RemoveAll(ctx context.Context, parentKey string) error {
+	_, err := es.RemoveAllCount(ctx, parentKey)
+	return err
+}
+
+// RemoveAllCount is like RemoveAll, but returns the number of removed entities.
+// Entities removed concurrently after the scan aren't counted.
+//
+// NOTE: This is a blocking operation.
+func (es *EntityStore[T, PT]) RemoveAllCount(ctx context.Context, parentKey string) (int, error) {
+	if parentKey == "" && !es.opts.unscopedRemoveAll {
+		return 0, fmt.Errorf("%w: parent key must not be empty, use RemoveAllUnscoped", ErrUnscopedRemove)
+	}
+	return es.removeAll(ctx, parentKey)
+}
+
+// RemoveAllUnscoped removes all entities of the store's entity kind in the key namespace,
+// regardless of their parent key, e.g. of all tenants, and returns the number of removed entities.
+// Entities of other kinds nested under entities of the kind aren't removed.
+//
+// NOTE: This is a blocking operation.
+func (es *EntityStore[T, PT]) RemoveAllUnscoped(ctx context.Context) (int, error) {
+	keys, err := es.dsClient.GetKeys(ctx, es.unscopedKeyMatch())
+	if err != nil {
+		return 0, err
+	}
+	keys = slices.DeleteFunc(keys, func(key *keyfactory.Key) bool {
+		return !es.isUnscopedEntityKey(key.Key())
+	})
+	return es.removeAllKeys(ctx, keys)
+}
+
+// auxiliaryKeyPrefixes are the key prefixes of keys stored in entity namespaces that aren't
+// entity keys, including keys of other packages, e.g. checkpointstore.
+var auxiliaryKeyPrefixes = []string{
+	indexKeyPrefix,
+	checkpointKeyPrefix,
+	reservationKeyPrefix,
+	changeLogKeyPrefix,
+	scheduleKeyPrefix,
+	aclKeyPrefix,
+	datastore.ContentKeyPrefix,
+	"checkpoint", // See checkpointstore.
+}
+
+// unscopedKeyMatch returns the key pattern matching the keys with the store's entity kind as a
+// key fragment, regardless of their parent key. Matched keys must be filtered by isUnscopedEntityKey.
+func (es *EntityStore[T, PT]) unscopedKeyMatch() *keyfactory.Key {
+	wildcard := string(keyfactory.WildcardAnyString)
+	return keyfactory.NewKey(wildcard+es.entityKind+keyfactory.KeyFragmentDelimiter+wildcard, es.namespace)
+}
+
+// isEntityKey returns whether the key is a key of an entity of the store's entity kind directly
+// under the parent key, or without a parent key if it's empty, rather than e.g. a key of an entity
+// nested under an entity of the kind.
+//
+// Entity keys are laid out as "[<parentKey>:]<entityKind>:<entityId>[:<entityVersionId>]", where
+// the parent key is laid out by the key strategy, so the kind is matched after the parent key.
+func (es *EntityStore[T, PT]) isEntityKey(parentKey, key string) bool {
+	if parentKey != "" {
+		var ok bool
+		key, ok = strings.CutPrefix(key, es.opts.keyStrategy.ParentKey(parentKey)+keyfactory.KeyFragmentDelimiter)
+		if !ok {
+			return false
+		}
+	}
+	fragments := strings.Split(key, keyfactory.KeyFragmentDelimiter)
+	return (len(fragments) == 2 || len(fragments) == 3) && fragments[0] == es.entityKind
+}
+
+// isUnscopedEntityKey is like isEntityKey, but for entity keys under any parent key, rather than
+// e.g. an index key. The fragments of an unknown parent key, e.g. of a versioned parent entity,
+// can't be told apart from the entity's, so the kind is matched followed by an entity ID and an
+// optional version ID.
+func (es *EntityStore[T, PT]) isUnscopedEntityKey(key string) bool {
+	for _, prefix := range auxiliaryKeyPrefixes {
+		if strings.HasPrefix(key, prefix+keyfactory.KeyFragmentDelimiter) {
+			return false
+		}
+	}
+	fragments := strings.Split(key, keyfactory.KeyFragmentDelimiter)
+	n := len(fragments)
+	return (n >= 2 && fragments[n-2] == es.entityKind) || (n >= 3 && fragments[n-3] == es.entityKind)
+}
+
+// removeAll removes all entities under the parent key, or all entities without a parent key
+// if the parent key is empty.
+func (es *EntityStore[T, PT]) removeAll(ctx context.Context, parentKey string) (int, error) {
 	kb := es.NewKeyBuilder()
 	kb.WithParentKey(parentKey)
 	kb.WithKey(es.entityKind)
 	kb.WithWildcard(keyfactory.WildcardAnyString)
 	keyMatch, err := kb.BuildAndReset()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	keys, err := es.dsClient.GetKeys(ctx, keyMatch)
 	if err != nil {
-		return err
+		return 0, err
 	}
+	return es.removeAllKeys(ctx, keys)
+}
+
+// removeAllKeys removes the entities of the scanned keys.
+func (es *EntityStore[T, PT]) removeAllKeys(ctx context.Context, keys []*keyfactory.Key) (int, error) {
 	if len(keys) == 0 {
-		return nil // No-op.
+		return 0, nil // No-op.
 	}
-	if err := es.dsClient.Delete(ctx, keys...); err != nil {
-		return err
-	}
-
 	entityKeys := make([]string, len(keys))
 	for i, key := range keys {
 		entityKeys[i] = key.Key()
 	}
-	es.onRemoved.emit(ctx, entityKeys)
-	return nil
+	removed, err := es.removeKeys(ctx, entityKeys, keys)
+	return len(removed), err
 }
 
 // Get retrieves an entity by key from the store.
-// datastore.ErrKeyNotFound is returned if key is not found in the store.
-func (es *EntityStore[T, PT]) Get(ctx context.Context, entityKey string) (PT, error) {
+// An error wrapping datastore.ErrKeyNotFound is returned if key is not found in the store.
+// The read is configured by the ReadPrimary call option. The store has no cache, so SkipCache only
+// applies to caching decorators, e.g. DegradingStore.
+func (es *EntityStore[T, PT]) Get(ctx context.Context, entityKey string, opts ...CallOption) (PT, error) {
 	if entityKey == "" {
 		return nil, nil // No-op for empty key.
 	}
+	ctx = newCallOptions(opts).context(ctx)
 	kb := es.NewKeyBuilder()
 	kb.WithKey(entityKey)
 	key, err := kb.BuildAndReset()
 	if err != nil {
 		return nil, err
 	}
-	data, err := es.dsClient.Get(ctx, key)
+	if err := es.authorize(ctx, AccessRead, []string{entityKey}); err != nil {
+		return nil, err
+	}
+	data, err := es.get(ctx, key)
+	if errors.Is(err, datastore.ErrKeyNotFound) {
+		es.opts.metrics.Count(MetricReadMisses, 1, es.metricLabels()...)
+	}
 	if err != nil {
 		return nil, err
 	}
+	es.opts.metrics.Count(MetricReadHits, 1, es.metricLabels()...)
 	entityPtr := PT(new(T))
-	err = encoder.ProtoUnmarshal(data, entityPtr)
+	err = es.decode(entityKey, data, entityPtr)
 	if err != nil {
 		return nil, err
 	}
@@ -346,8 +981,8 @@ func (es *EntityStore[T, PT]) GetByKeys(ctx context.Context, entityKeys []string
 		return nil, nil // No-op for empty slice of keys.
 	}
 	kb := es.NewKeyBuilder()
-	keys := make([]*keyfactory.Key, len(entityKeys))
-	for i, eKey := range entityKeys {
+	keys := make([]*keyfactory.Key, 0, len(entityKeys))
+	for _, eKey := range entityKeys {
 		if eKey == "" {
 			continue // Skip empty keys.
 		}
@@ -356,36 +991,39 @@ func (es *EntityStore[T, PT]) GetByKeys(ctx context.Context, entityKeys []string
 		if err != nil {
 			return nil, err
 		}
-		keys[i] = key
-	}
-
-	data, err := es.dsClient.GetMulti(ctx, keys)
-	if err != nil {
-		return nil, err
+		keys = append(keys, key)
 	}
-	entities := make([]PT, len(data))
-	for i, d := range data {
-		entities[i] = PT(new(T))
-		err = encoder.ProtoUnmarshal(d, entities[i])
-		if err != nil {
+	if es.opts.authorizer != nil {
+		readKeys := make([]string, len(keys))
+		for i, key := range keys {
+			readKeys[i] = key.Key()
+		}
+		if err := es.authorize(ctx, AccessRead, readKeys); err != nil {
 			return nil, err
 		}
 	}
-	return entities, nil
+	data, err := es.getMultiAligned(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	es.countReads(data)
+	return es.decodeMulti(ctx, keys, data)
 }
 
 // GetWithPagination retrieves entities from the store with cursor pagination.
 //   - Does not gurantee an exact number of entities returned per page.
 //   - A given entity may be returned multiple times.
 //   - Entities that were not constantly present in the collection during a full iteration, may be returned or not.
+//   - Entities that were constantly present in the collection during a full iteration are returned,
+//     even if the collection is modified during the iteration.
 func (es *EntityStore[T, PT]) GetWithPagination(
 	ctx context.Context,
 	cursor uint64,
 	limit int,
 	parentKey string,
 ) (*EntityCursor[T, PT], error) {
-	if limit <= 0 || limit >= 1000 {
-		limit = 1000 // Enforce max-limit.
+	if limit <= 0 || limit >= es.opts.maxPageSize {
+		limit = es.opts.maxPageSize // Enforce max-limit.
 	}
 	kb := es.NewKeyBuilder()
 	kb.WithParentKey(parentKey)
@@ -396,43 +1034,69 @@ func (es *EntityStore[T, PT]) GetWithPagination(
 		return nil, err
 	}
 
-	// Get page keys.
-	keys, nextCursor, err := es.dsClient.GetKeysWithCursor(ctx, cursor, limit, keyMatch)
-	if err != nil {
-		return nil, err
-	}
-	cursor = nextCursor
+	minFill := min(es.opts.minPageFill, limit)
+	var entities []PT
+	seen := make(map[string]struct{}) // Deduplicates keys across scans of a filled page.
+	for {
+		// Get page keys.
+		keys, nextCursor, err := es.dsClient.GetKeysWithCursor(ctx, cursor, limit, keyMatch)
+		if err != nil {
+			return nil, err
+		}
+		cursor = nextCursor
 
-	if len(keys) == 0 {
-		return &EntityCursor[T, PT]{Cursor: cursor, Entities: nil}, nil
-	}
+		if minFill > 0 {
+			keys = slices.DeleteFunc(keys, func(key *keyfactory.Key) bool {
+				if _, ok := seen[key.RedisKey()]; ok {
+					return true
+				}
+				seen[key.RedisKey()] = struct{}{}
+				return false
+			})
+		}
 
-	// Get page entities.
-	data, err := es.dsClient.GetMulti(ctx, keys)
+		// Get page entities.
+		if len(keys) > 0 {
+			pageEntities, err := es.getMulti(ctx, keys)
+			if err != nil {
+				return nil, err
+			}
+			entities = append(entities, pageEntities...)
+		}
+		if cursor == 0 || len(entities) >= minFill {
+			break
+		}
+	}
+	total, err := es.indexCount(ctx, parentKey)
 	if err != nil {
 		return nil, err
 	}
-	entities := make([]PT, len(data))
-	for i, d := range data {
-		entities[i] = PT(new(T))
-		err = encoder.ProtoUnmarshal(d, entities[i])
-		if err != nil {
-			return nil, err
-		}
-	}
 	return &EntityCursor[T, PT]{
 		Cursor:   cursor,
 		Entities: entities,
+		HasMore:  cursor != 0,
+		Total:    total,
 	}, nil
 }
 
 // GetAll retrieves all entities from the store.
 // If a key doesn't exist in the store it is not included in the result.
+// Fails with an error wrapping ErrTooManyEntities if more entities match than the GetAll limit.
 //
 // NOTE: This is a blocking operation.
 //
 // TODO: Consider adding alternative implementation using SCAN if needed.
 func (es *EntityStore[T, PT]) GetAll(ctx context.Context, parentKey string) ([]PT, error) {
+	keys, err := es.getAllKeys(ctx, parentKey)
+	if err != nil {
+		return nil, err
+	}
+	return es.getMulti(ctx, keys)
+}
+
+// getAllKeys returns the keys of all entities under the parent key, or an error wrapping
+// ErrTooManyEntities if more entities match than the GetAll limit.
+func (es *EntityStore[T, PT]) getAllKeys(ctx context.Context, parentKey string) ([]*keyfactory.Key, error) {
 	kb := es.NewKeyBuilder()
 	kb.WithParentKey(parentKey)
 	kb.WithKey(es.entityKind)
@@ -445,19 +1109,10 @@ func (es *EntityStore[T, PT]) GetAll(ctx context.Context, parentKey string) ([]P
 	if err != nil {
 		return nil, err
 	}
-	data, err := es.dsClient.GetMulti(ctx, keys)
-	if err != nil {
-		return nil, err
-	}
-	entities := make([]PT, len(data))
-	for i, d := range data {
-		entities[i] = PT(new(T))
-		err = encoder.ProtoUnmarshal(d, entities[i])
-		if err != nil {
-			return nil, err
-		}
+	if es.opts.getAllLimit > 0 && len(keys) > es.opts.getAllLimit {
+		return nil, fmt.Errorf("%w: %d entities exceed limit %d", ErrTooManyEntities, len(keys), es.opts.getAllLimit)
 	}
-	return entities, nil
+	return keys, nil
 }
 
 // Exists checks whether an entity exist in the store.
@@ -471,9 +1126,34 @@ func (es *EntityStore[T, PT]) Exists(ctx context.Context, entityKey string) (boo
 	if err != nil {
 		return false, err
 	}
+	if err := es.authorize(ctx, AccessRead, []string{entityKey}); err != nil {
+		return false, err
+	}
 	exists, err := es.dsClient.Exists(ctx, key)
 	if err != nil {
 		return false, err
 	}
 	return exists, nil
 }
+
+// TouchIfLonger extends the expiration of an entity if the new expiration is longer than its
+// remaining time to live, without a racy read-modify-write. An entity without expiration is never
+// given one. It returns whether the expiration was extended.
+func (es *EntityStore[T, PT]) TouchIfLonger(ctx context.Context, entityKey string, expiration time.Duration) (bool, error) {
+	if err := es.checkContentAddressing("touch if longer"); err != nil {
+		return false, err
+	}
+	if entityKey == "" {
+		return false, nil // No-op for empty key.
+	}
+	kb := es.NewKeyBuilder()
+	kb.WithKey(entityKey)
+	key, err := kb.BuildAndReset()
+	if err != nil {
+		return false, err
+	}
+	if err := es.authorize(ctx, AccessWrite, []string{entityKey}); err != nil {
+		return false, err
+	}
+	return es.dsClient.Expire(ctx, key, expiration, datastore.ExpireGT)
+}
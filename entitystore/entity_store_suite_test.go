@@ -50,6 +50,10 @@ func (e TestEntity) GetKey() string {
 	return e.Key
 }
 
+func (e TestEntity) GetUpdatedAt() int64 {
+	return e.UpdatedAt
+}
+
 func (e TestEntity) ToProto() (*pb.TestEntity, error) {
 	return &pb.TestEntity{
 		Id:        e.Id,
@@ -90,6 +94,15 @@ func (e TestEntity) MarshalProto() ([]byte, error) {
 	return proto.Marshal(pbe)
 }
 
+// AppendProto appends the entity protobuf bytes to the buffer (implements ProtoAppender).
+func (e TestEntity) AppendProto(b []byte) ([]byte, error) {
+	pbe, err := e.ToProto()
+	if err != nil {
+		return nil, err
+	}
+	return proto.MarshalOptions{}.MarshalAppend(b, pbe)
+}
+
 // UnmarshalProto unmarshals protobuf bytes into an entity (implements ProtoUnmarshaler).
 func (e *TestEntity) UnmarshalProto(data []byte) error {
 	pbe := &pb.TestEntity{}
@@ -103,11 +116,12 @@ type TEntityStore struct {
 	*EntityStore[TestEntity, *TestEntity]
 }
 
-func NewTEntityStore(namespace string, dsClient *datastore.Client) (*TEntityStore, error) {
+func NewTEntityStore(namespace string, dsClient *datastore.Client, opts ...Option) (*TEntityStore, error) {
 	entityStore, err := New[TestEntity](
 		string(keyfactory.EntityKindTest),
 		namespace,
 		dsClient,
+		opts...,
 	)
 	if err != nil {
 		return nil, err
@@ -125,7 +139,7 @@ func setupTEntityStore(
 	dsClient *datastore.Client,
 ) EntityStorer[TestEntity, *TestEntity] {
 	t.Helper()
-	store, err := NewTEntityStore(namespace, dsClient)
+	store, err := NewTEntityStore(namespace, dsClient, WithAllowFlush())
 	if err != nil {
 		t.Fatalf("failed to setup entity store: %v", err)
 	}
@@ -154,6 +168,12 @@ func TestTEntityStore(t *testing.T) {
 		t.Fatalf("failed to create datastore client: %v", err)
 	}
 
+	faultyClient, faults := testutil.WithFaults(t, rsClient, 1, 0)
+	chaosDSClient, err := datastore.NewClient(faultyClient)
+	if err != nil {
+		t.Fatalf("failed to create datastore client: %v", err)
+	}
+
 	suite := NewEntityStoreTestSuite(
 		t,
 		string(keyfactory.EntityKindTest),
@@ -161,5 +181,5 @@ func TestTEntityStore(t *testing.T) {
 		setupTEntityStore,
 		generateTestEntities,
 	)
-	suite.Run(t)
+	suite.WithChaos(chaosDSClient, faults, 0.2).Run(t)
 }
@@ -1,14 +1,25 @@
 package entitystore
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/encoder"
 	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/metrics"
 	"github.com/holmberd/go-entitystore/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type mockEntity struct {
@@ -55,6 +66,7 @@ func setupMockEntityStore(
 		string(keyfactory.EntityKindTest),
 		keyfactory.GenerateRandomKey(),
 		dsClient,
+		WithAllowFlush(),
 	)
 	if err != nil {
 		t.Fatalf("failed to create mock entity store: %v", err)
@@ -63,7 +75,7 @@ func setupMockEntityStore(
 	t.Cleanup(func() {
 		// Flush the store data after each test.
 		// TODO: Not necessary when using testutil.NewRedisClientWithCleanup.
-		err := store.flush(ctx)
+		err := store.Flush(ctx)
 		if err != nil {
 			t.Fatalf("failed to flush mock entity store: %v", err)
 		}
@@ -89,7 +101,7 @@ func TestEntityStore(t *testing.T) {
 		assert.NoError(t, err)
 
 		// Flush store1.
-		err = store1.flush(ctx)
+		err = store1.Flush(ctx)
 		assert.NoError(t, err)
 
 		// Assert entity exist in store2.
@@ -98,6 +110,43 @@ func TestEntityStore(t *testing.T) {
 		assert.Len(t, entities, 1)
 	})
 
+	t.Run("Flush store without namespace", func(t *testing.T) {
+		dsClient, err := datastore.NewClient(rsClient)
+		assert.NoError(t, err)
+		store, err := New[mockEntity](string(keyfactory.EntityKindTest), "", dsClient, WithAllowFlush())
+		assert.NoError(t, err)
+		err = store.Flush(context.Background())
+		assert.ErrorIs(t, err, ErrFlushNotAllowed, "should not flush a store without namespace")
+	})
+
+	t.Run("Flush store without allow flush option", func(t *testing.T) {
+		dsClient, err := datastore.NewClient(rsClient)
+		assert.NoError(t, err)
+		store, err := New[mockEntity](string(keyfactory.EntityKindTest), keyfactory.GenerateRandomKey(), dsClient)
+		assert.NoError(t, err)
+		err = store.Flush(context.Background())
+		assert.ErrorIs(t, err, ErrFlushNotAllowed, "should not flush a store without allow flush option")
+	})
+
+	t.Run("Malformed event arguments call corruption handler", func(t *testing.T) {
+		dsClient, err := datastore.NewClient(rsClient)
+		assert.NoError(t, err)
+		var handled error
+		store, err := New[mockEntity](
+			string(keyfactory.EntityKindTest),
+			keyfactory.GenerateRandomKey(),
+			dsClient,
+			WithCorruptionHandler(func(err error) { handled = err }),
+		)
+		assert.NoError(t, err)
+		called := false
+		store.OnAdded().AddListener(func(ctx context.Context, keys []string) { called = true })
+
+		assert.NotPanics(t, func() { store.onAdded.t.Emit("not-a-context") })
+		assert.False(t, called, "should not call listener with malformed arguments")
+		assert.Error(t, handled, "should call corruption handler with malformed arguments")
+	})
+
 	t.Run("Add entity with invalid key", func(t *testing.T) {
 		store, ctx := setupMockEntityStore(t, rsClient)
 		_, err := store.Add(ctx, mockEntity{}, 0)
@@ -190,3 +239,1548 @@ func TestEntityStore(t *testing.T) {
 		assert.NoError(t, err, "should not error when checking if an entity exists with an empty key")
 	})
 }
+
+func TestEntityStoreCorruptEntities(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+
+	// setupCorruptStore adds entities to a new store and overwrites the first with corrupt data.
+	setupCorruptStore := func(t *testing.T, opts ...Option) (*EntityStore[TestEntity, *TestEntity], string) {
+		t.Helper()
+		store, err := New[TestEntity](string(keyfactory.EntityKindTest), keyfactory.GenerateRandomKey(), dsClient, opts...)
+		require.NoError(t, err)
+		entities, keys := generateTestEntities(t, 3, mockTenantId)
+		_, err = store.AddBatch(context.Background(), entities, 0)
+		require.NoError(t, err)
+		kb := store.NewKeyBuilder()
+		kb.WithKey(keys[0])
+		key, err := kb.BuildAndReset()
+		require.NoError(t, err)
+		require.NoError(t, dsClient.Put(context.Background(), key, []byte{0xff, 0xff}, 0))
+		return store, keys[0]
+	}
+
+	t.Run("Corrupt entity fails read by default", func(t *testing.T) {
+		store, corruptKey := setupCorruptStore(t)
+		_, err := store.GetAll(context.Background(), mockTenantKey)
+		assert.ErrorIs(t, err, encoder.ErrEncoding)
+		assert.ErrorContains(t, err, corruptKey, "should identify the corrupt key")
+	})
+
+	t.Run("Skip and report corrupt entity", func(t *testing.T) {
+		var reported []CorruptEntity
+		store, corruptKey := setupCorruptStore(t, WithCorruptEntityHandler(func(ctx context.Context, e CorruptEntity) {
+			reported = append(reported, e)
+		}))
+		entities, err := store.GetAll(context.Background(), mockTenantKey)
+		assert.NoError(t, err)
+		assert.Len(t, entities, 2, "should skip the corrupt entity")
+		require.Len(t, reported, 1)
+		assert.Equal(t, corruptKey, reported[0].Key)
+		assert.Equal(t, 2, reported[0].Size)
+		assert.False(t, reported[0].Quarantined)
+	})
+
+	t.Run("Quarantine corrupt entity", func(t *testing.T) {
+		var reported []CorruptEntity
+		quarantineNamespace := keyfactory.GenerateRandomKey()
+		store, corruptKey := setupCorruptStore(
+			t,
+			WithCorruptEntityHandler(func(ctx context.Context, e CorruptEntity) {
+				reported = append(reported, e)
+			}),
+			WithQuarantineNamespace(quarantineNamespace),
+		)
+		_, err := store.GetByKeys(context.Background(), []string{corruptKey})
+		assert.NoError(t, err)
+		require.Len(t, reported, 1)
+		assert.True(t, reported[0].Quarantined)
+
+		exists, err := store.Exists(context.Background(), corruptKey)
+		assert.NoError(t, err)
+		assert.False(t, exists, "should have moved the corrupt entity out of the store")
+		exists, err = dsClient.Exists(context.Background(), keyfactory.NewKey(corruptKey, quarantineNamespace))
+		assert.NoError(t, err)
+		assert.True(t, exists, "should have moved the corrupt entity to the quarantine namespace")
+	})
+}
+
+func TestEntityStoreChecksum(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	store, err := New[TestEntity](
+		string(keyfactory.EntityKindTest),
+		keyfactory.GenerateRandomKey(),
+		dsClient,
+		WithChecksum(),
+	)
+	require.NoError(t, err)
+	entities, keys := generateTestEntities(t, 1, mockTenantId)
+	_, err = store.Add(ctx, entities[0], 0)
+	require.NoError(t, err)
+
+	t.Run("Verify checksum on read", func(t *testing.T) {
+		entity, err := store.Get(ctx, keys[0])
+		assert.NoError(t, err)
+		assert.Equal(t, entities[0], *entity)
+	})
+
+	t.Run("Detect corrupted value", func(t *testing.T) {
+		kb := store.NewKeyBuilder()
+		kb.WithKey(keys[0])
+		key, err := kb.BuildAndReset()
+		require.NoError(t, err)
+		data, err := dsClient.Get(ctx, key)
+		require.NoError(t, err)
+		corrupted := append([]byte{}, data...)
+		corrupted[0] ^= 0xff
+		require.NoError(t, dsClient.Put(ctx, key, corrupted, 0))
+
+		_, err = store.Get(ctx, keys[0])
+		assert.ErrorIs(t, err, datastore.ErrCorruptedData)
+		assert.ErrorContains(t, err, keys[0])
+	})
+}
+
+// taggedEntity is a test entity with a map, encoded in map iteration order like Protobuf map
+// fields unless encoded deterministically.
+type taggedEntity struct {
+	testutil.Entity
+	Tags map[string]string
+}
+
+type taggedEntityTag struct {
+	Name, Value string
+}
+
+func (e taggedEntity) marshal(names []string) ([]byte, error) {
+	tags := make([]taggedEntityTag, 0, len(names))
+	for _, name := range names {
+		tags = append(tags, taggedEntityTag{Name: name, Value: e.Tags[name]})
+	}
+	return json.Marshal(struct {
+		testutil.Entity
+		Tags []taggedEntityTag
+	}{e.Entity, tags})
+}
+
+func (e taggedEntity) MarshalProto() ([]byte, error) {
+	names := make([]string, 0, len(e.Tags))
+	for name := range e.Tags {
+		names = append(names, name)
+	}
+	return e.marshal(names)
+}
+
+func (e taggedEntity) MarshalProtoDeterministic() ([]byte, error) {
+	names := slices.Sorted(maps.Keys(e.Tags))
+	return e.marshal(names)
+}
+
+func (e *taggedEntity) UnmarshalProto(data []byte) error {
+	var v struct {
+		testutil.Entity
+		Tags []taggedEntityTag
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	e.Entity, e.Tags = v.Entity, make(map[string]string, len(v.Tags))
+	for _, tag := range v.Tags {
+		e.Tags[tag.Name] = tag.Value
+	}
+	return nil
+}
+
+func TestEntityStoreDeterministicEncoding(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	store, err := New[taggedEntity](
+		string(keyfactory.EntityKindTest),
+		keyfactory.GenerateRandomKey(),
+		dsClient,
+		WithChecksum(),
+		WithDeterministicEncoding(),
+	)
+	require.NoError(t, err)
+	e := taggedEntity{Entity: testutil.NewEntity("e-1", mockTenantId, 1), Tags: make(map[string]string)}
+	for i := range 16 {
+		e.Tags["tag-"+strconv.Itoa(i)] = strconv.Itoa(i)
+	}
+	_, err = store.Add(ctx, e, 0)
+	require.NoError(t, err)
+
+	t.Run("Should encode equal entities to equal values", func(t *testing.T) {
+		data, err := store.encode(&e)
+		require.NoError(t, err)
+		for range 10 {
+			encoded, err := store.encode(&e)
+			require.NoError(t, err)
+			require.Equal(t, data, encoded)
+		}
+	})
+
+	t.Run("Should skip unchanged entities", func(t *testing.T) {
+		var updated []string
+		store.OnUpdated().AddListener(func(ctx context.Context, keys []string) { updated = append(updated, keys...) })
+		for range 10 {
+			progress, err := store.UpdateWhere(ctx, mockTenantKey, func(*taggedEntity) bool { return true }, func(*taggedEntity) {})
+			require.NoError(t, err)
+			assert.Equal(t, 1, progress.Matched)
+			assert.Zero(t, progress.Updated)
+		}
+		assert.Empty(t, updated)
+		stored, err := store.Get(ctx, e.Key)
+		require.NoError(t, err)
+		assert.Equal(t, e, *stored)
+	})
+}
+
+func TestEntityStoreMaxEntitySize(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	store, err := New[TestEntity](
+		string(keyfactory.EntityKindTest),
+		keyfactory.GenerateRandomKey(),
+		dsClient,
+		WithMaxEntitySize(8),
+	)
+	require.NoError(t, err)
+	entities, keys := generateTestEntities(t, 2, mockTenantId)
+
+	t.Run("Add entity exceeding max size", func(t *testing.T) {
+		_, err := store.Add(ctx, entities[0], 0)
+		assert.ErrorIs(t, err, ErrEntityTooLarge)
+		var sizeErr *EntityTooLargeError
+		require.ErrorAs(t, err, &sizeErr)
+		assert.Equal(t, keys[0], sizeErr.Key)
+		assert.Equal(t, 8, sizeErr.MaxSize)
+		exists, err := store.Exists(ctx, keys[0])
+		assert.NoError(t, err)
+		assert.False(t, exists, "should not write entity exceeding max size")
+	})
+
+	t.Run("Add batch with entity exceeding max size", func(t *testing.T) {
+		_, err := store.AddBatch(ctx, entities, 0)
+		assert.ErrorIs(t, err, ErrEntityTooLarge)
+	})
+}
+
+func TestEntityStoreSizeMetrics(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	recorder := metrics.NewMemoryRecorder()
+	store, err := New[TestEntity](
+		string(keyfactory.EntityKindTest),
+		keyfactory.GenerateRandomKey(),
+		dsClient,
+		WithMetrics(recorder),
+		WithLargeEntityThreshold(1),
+	)
+	require.NoError(t, err)
+	var warnedKeys []string
+	store.OnSizeWarning().AddListener(func(ctx context.Context, keys []string) {
+		warnedKeys = keys
+	})
+
+	entities, keys := generateTestEntities(t, 3, mockTenantId)
+	_, err = store.AddBatch(ctx, entities, 0)
+	require.NoError(t, err)
+
+	kindLabel := metrics.Label{Name: "kind", Value: string(keyfactory.EntityKindTest)}
+	size := recorder.Histogram(MetricEntitySize, kindLabel)
+	assert.Equal(t, int64(3), size.Count, "should record the size of each written entity")
+	assert.Greater(t, size.Sum, float64(0))
+	assert.Equal(t, int64(3), recorder.Counter(MetricLargeEntities, kindLabel))
+	assert.ElementsMatch(t, keys, warnedKeys, "should emit size warning with large entity keys")
+
+	t.Run("Namespace label", func(t *testing.T) {
+		recorder := metrics.NewMemoryRecorder()
+		store, err := New[TestEntity](
+			string(keyfactory.EntityKindTest),
+			"tenant-ns",
+			dsClient,
+			WithMetrics(recorder),
+			WithNamespaceMetricLabel(),
+		)
+		require.NoError(t, err)
+		_, err = store.AddBatch(ctx, entities, 0)
+		require.NoError(t, err)
+		nsLabel := metrics.Label{Name: "namespace", Value: "tenant-ns"}
+		assert.Equal(t, int64(3), recorder.Histogram(MetricEntitySize, kindLabel, nsLabel).Count)
+	})
+
+	t.Run("Read hits and misses", func(t *testing.T) {
+		_, err := store.Get(ctx, keys[0])
+		require.NoError(t, err)
+		_, err = store.Get(ctx, "test_entity:missing")
+		assert.ErrorIs(t, err, datastore.ErrKeyNotFound)
+		_, err = store.GetByKeys(ctx, []string{keys[1], keys[2], "test_entity:missing"})
+		require.NoError(t, err)
+		_, _, err = store.GetByKeysPartial(ctx, []string{keys[0], "test_entity:missing"})
+		require.NoError(t, err)
+		assert.Equal(t, int64(4), recorder.Counter(MetricReadHits, kindLabel))
+		assert.Equal(t, int64(3), recorder.Counter(MetricReadMisses, kindLabel))
+	})
+}
+
+func TestEntityStoreMinPageFill(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	store, err := New[TestEntity](
+		string(keyfactory.EntityKindTest),
+		keyfactory.GenerateRandomKey(),
+		dsClient,
+		WithMinPageFill(5),
+	)
+	require.NoError(t, err)
+	entities, keys := generateTestEntities(t, 12, mockTenantId)
+	_, err = store.AddBatch(ctx, entities, 0)
+	require.NoError(t, err)
+
+	var pageKeys []string
+	cursor := uint64(0)
+	for {
+		page, err := store.GetWithPagination(ctx, cursor, 10, mockTenantKey)
+		require.NoError(t, err)
+		for _, e := range page.Entities {
+			pageKeys = append(pageKeys, e.GetKey())
+		}
+		if page.Cursor == 0 {
+			break
+		}
+		assert.GreaterOrEqual(t, len(page.Entities), 5, "should fill page before returning")
+		cursor = page.Cursor
+	}
+	assert.ElementsMatch(t, keys, pageKeys)
+}
+
+func TestEntityStoreLimits(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	store, err := New[TestEntity](
+		string(keyfactory.EntityKindTest),
+		keyfactory.GenerateRandomKey(),
+		dsClient,
+		WithMaxPageSize(2),
+		WithGetAllLimit(3),
+	)
+	require.NoError(t, err)
+
+	entities, _ := generateTestEntities(t, 3, mockTenantId)
+	_, err = store.AddBatch(ctx, entities, 0)
+	require.NoError(t, err)
+
+	page, err := store.GetWithPagination(ctx, 0, 100, mockTenantKey)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(page.Entities), 2, "should cap page size")
+	all, err := store.GetAll(ctx, mockTenantKey)
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	more, _ := generateTestEntities(t, 4, mockTenantId)
+	_, err = store.AddBatch(ctx, more[3:], 0)
+	require.NoError(t, err)
+	_, err = store.GetAll(ctx, mockTenantKey)
+	assert.ErrorIs(t, err, ErrTooManyEntities, "should enforce GetAll limit")
+}
+
+func TestEntityStoreIndex(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	t.Run("Pagination metadata", func(t *testing.T) {
+		store, err := New[TestEntity](
+			string(keyfactory.EntityKindTest),
+			keyfactory.GenerateRandomKey(),
+			dsClient,
+			WithIndex(),
+		)
+		require.NoError(t, err)
+		entities, keys := generateTestEntities(t, 5, mockTenantId)
+		other := entities[0]
+		other.Key = keyfactory.BuildRedisKey(mockTenantKey, string(keyfactory.EntityKindTest)+"_archived", "e-1")
+		_, err = store.AddBatch(ctx, append(entities, other), 0)
+		require.NoError(t, err)
+		require.NoError(t, store.Remove(ctx, keys[0]))
+
+		page, err := store.GetWithPagination(ctx, 0, 2, mockTenantKey)
+		require.NoError(t, err)
+		assert.Equal(t, int64(4), page.Total, "should report total from index")
+		sorted, err := store.GetAllSorted(ctx, mockTenantKey, OrderByUpdatedAt, Ascending)
+		require.NoError(t, err)
+		assert.Len(t, sorted, 4, "should not match keys sharing the kind prefix")
+		assert.Equal(t, page.Cursor != 0, page.HasMore)
+
+		require.NoError(t, store.RemoveAll(ctx, mockTenantKey))
+		page, err = store.GetWithPagination(ctx, 0, 2, mockTenantKey)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), page.Total)
+		assert.False(t, page.HasMore)
+	})
+
+	t.Run("Pagination metadata under a versioned parent", func(t *testing.T) {
+		store, err := New[TestEntity](
+			string(keyfactory.EntityKindTest),
+			keyfactory.GenerateRandomKey(),
+			dsClient,
+			WithIndex(),
+		)
+		require.NoError(t, err)
+		parentKey := keyfactory.BuildRedisKey(mockTenantKey, "doc", "d1", "v1")
+		entities, _ := generateTestEntities(t, 3, mockTenantId)
+		for i := range entities {
+			entities[i].Key, err = store.EntityKey(entities[i].Id, "", parentKey)
+			require.NoError(t, err)
+		}
+		nested := entities[0]
+		nested.Key, err = store.EntityKey("e-4", "", entities[0].Key)
+		require.NoError(t, err)
+		_, err = store.AddBatch(ctx, append(entities, nested), 0)
+		require.NoError(t, err)
+
+		page, err := store.GetWithPagination(ctx, 0, 10, parentKey)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), page.Total, "should not count entities nested under the entities")
+		sorted, err := store.GetAllSorted(ctx, parentKey, OrderByUpdatedAt, Ascending)
+		require.NoError(t, err)
+		assert.Len(t, sorted, 3)
+	})
+
+	t.Run("Without index", func(t *testing.T) {
+		store, err := New[TestEntity](
+			string(keyfactory.EntityKindTest),
+			keyfactory.GenerateRandomKey(),
+			dsClient,
+		)
+		require.NoError(t, err)
+		page, err := store.GetWithPagination(ctx, 0, 2, mockTenantKey)
+		require.NoError(t, err)
+		assert.Equal(t, int64(-1), page.Total, "should report unknown total")
+	})
+}
+
+func TestEntityStoreGetReadPrimary(t *testing.T) {
+	primary, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	replica, replicaServer := testutil.NewRedisClientWithCleanup(t)
+	defer replicaServer.Close()
+	replica, rec := testutil.RecordCommands(t, replica)
+	slow := testutil.WithLatency(t, primary, testutil.ConstantLatency(20*time.Millisecond))
+	dsClient, err := datastore.NewClient(slow, datastore.WithHedgedReads(replica, time.Millisecond))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	store, err := New[testutil.Entity](string(keyfactory.EntityKindTest), keyfactory.GenerateRandomKey(), dsClient)
+	require.NoError(t, err)
+	entity := testutil.NewEntity("e-1", mockTenantId, 1)
+	_, err = store.Add(ctx, entity, 0)
+	require.NoError(t, err)
+
+	got, err := store.Get(ctx, entity.Key, ReadPrimary())
+	require.NoError(t, err)
+	assert.Equal(t, entity.Key, got.Key)
+	assert.Empty(t, rec.Filter("get"), "should not read from the replica")
+	_, err = store.Get(ctx, entity.Key)
+	assert.ErrorIs(t, err, datastore.ErrKeyNotFound, "should hedge reads to the empty replica")
+	assert.Len(t, rec.Filter("get"), 1)
+}
+
+func TestEntityStoreAddAndGetPrevious(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	store, err := New[testutil.Entity](
+		string(keyfactory.EntityKindTest),
+		keyfactory.GenerateRandomKey(),
+		dsClient,
+		WithUpdateDiffs(),
+	)
+	require.NoError(t, err)
+	var updates []EntityUpdate
+	store.OnUpdatedDiff().AddListener(func(ctx context.Context, u []EntityUpdate) {
+		updates = u
+	})
+
+	e := testutil.NewEntity("e-1", mockTenantId, 1)
+	previous, err := store.AddAndGetPrevious(ctx, e, 0)
+	require.NoError(t, err)
+	assert.Nil(t, previous, "should return nil for new entity")
+
+	updated := e
+	updated.UpdatedAt = 2
+	previous, err = store.AddAndGetPrevious(ctx, updated, 0)
+	require.NoError(t, err)
+	require.NotNil(t, previous)
+	assert.Equal(t, e, *previous)
+	require.Len(t, updates, 1, "should emit update with diff")
+
+	stored, err := store.Get(ctx, e.Key)
+	require.NoError(t, err)
+	assert.Equal(t, updated, *stored)
+}
+
+func TestEntityStoreUpdate(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	store, err := New[testutil.Entity](string(keyfactory.EntityKindTest), keyfactory.GenerateRandomKey(), dsClient)
+	require.NoError(t, err)
+	var added, updated []string
+	store.OnAdded().AddListener(func(ctx context.Context, keys []string) { added = append(added, keys...) })
+	store.OnUpdated().AddListener(func(ctx context.Context, keys []string) { updated = append(updated, keys...) })
+
+	e := testutil.NewEntity("e-1", mockTenantId, 1)
+	t.Run("Should fail for missing entity", func(t *testing.T) {
+		assert.ErrorIs(t, store.Update(ctx, e, 0), ErrEntityNotFound)
+		exists, err := store.Exists(ctx, e.Key)
+		require.NoError(t, err)
+		assert.False(t, exists)
+		assert.Empty(t, updated)
+	})
+
+	t.Run("Should update existing entity", func(t *testing.T) {
+		_, err := store.Add(ctx, e, 0)
+		require.NoError(t, err)
+		added = nil
+		e.UpdatedAt = 2
+		require.NoError(t, store.Update(ctx, e, 0))
+		assert.Empty(t, added)
+		assert.Equal(t, []string{e.Key}, updated)
+		stored, err := store.Get(ctx, e.Key)
+		require.NoError(t, err)
+		assert.Equal(t, e, *stored)
+	})
+}
+
+func TestEntityStoreUpdateWithRetry(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	store, err := New[testutil.Entity](string(keyfactory.EntityKindTest), keyfactory.GenerateRandomKey(), dsClient)
+	require.NoError(t, err)
+	var updated []string
+	store.OnUpdated().AddListener(func(ctx context.Context, keys []string) { updated = append(updated, keys...) })
+
+	e := testutil.NewEntity("e-1", mockTenantId, 1)
+	increment := func(e *testutil.Entity) (*testutil.Entity, error) {
+		e.UpdatedAt++
+		return e, nil
+	}
+	t.Run("Should fail for missing entity", func(t *testing.T) {
+		_, err := store.UpdateWithRetry(ctx, e.Key, increment)
+		assert.ErrorIs(t, err, ErrEntityNotFound)
+		assert.Empty(t, updated)
+	})
+
+	_, err = store.Add(ctx, e, time.Hour)
+	require.NoError(t, err)
+
+	t.Run("Should update entity and keep expiration", func(t *testing.T) {
+		result, err := store.UpdateWithRetry(ctx, e.Key, increment)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), result.UpdatedAt)
+		assert.Equal(t, []string{e.Key}, updated)
+		stored, err := store.Get(ctx, e.Key)
+		require.NoError(t, err)
+		assert.Equal(t, *result, *stored)
+		kb := store.NewKeyBuilder()
+		kb.WithKey(e.Key)
+		key, err := kb.BuildAndReset()
+		require.NoError(t, err)
+		ttl, err := rsClient.TTL(ctx, key.RedisKey()).Result()
+		require.NoError(t, err)
+		assert.Greater(t, ttl, time.Duration(0))
+	})
+
+	t.Run("Should leave entity unchanged if fn returns nil", func(t *testing.T) {
+		updated = nil
+		result, err := store.UpdateWithRetry(ctx, e.Key, func(*testutil.Entity) (*testutil.Entity, error) {
+			return nil, nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), result.UpdatedAt)
+		assert.Empty(t, updated)
+	})
+
+	t.Run("Should retry on concurrent modification", func(t *testing.T) {
+		calls := 0
+		result, err := store.UpdateWithRetry(ctx, e.Key, func(current *testutil.Entity) (*testutil.Entity, error) {
+			calls++
+			if calls == 1 {
+				concurrent := *current
+				concurrent.Data = "concurrent"
+				require.NoError(t, store.Update(ctx, concurrent, time.Hour))
+			}
+			return increment(current)
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, calls)
+		assert.Equal(t, "concurrent", result.Data)
+		assert.Equal(t, int64(3), result.UpdatedAt)
+	})
+
+	t.Run("Should fail when retries are exhausted", func(t *testing.T) {
+		calls := 0
+		_, err := store.UpdateWithRetry(ctx, e.Key, func(current *testutil.Entity) (*testutil.Entity, error) {
+			calls++
+			concurrent := *current
+			concurrent.Data = "concurrent-" + strconv.Itoa(calls)
+			require.NoError(t, store.Update(ctx, concurrent, time.Hour))
+			return increment(current)
+		}, WithRetries(1))
+		assert.ErrorIs(t, err, datastore.ErrVersionConflict)
+		assert.Equal(t, 2, calls)
+	})
+}
+
+func TestEntityStoreRemoveIf(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	store, err := New[testutil.Entity](string(keyfactory.EntityKindTest), keyfactory.GenerateRandomKey(), dsClient)
+	require.NoError(t, err)
+	var removedKeys []string
+	store.OnRemoved().AddListener(func(ctx context.Context, keys []string) {
+		removedKeys = append(removedKeys, keys...)
+	})
+	e := testutil.NewEntity("e-1", mockTenantId, 1)
+	e.Data = "active"
+	_, err = store.Add(ctx, e, 0)
+	require.NoError(t, err)
+
+	isPending := func(e *testutil.Entity) bool { return e.Data == "pending" }
+	removed, err := store.RemoveIf(ctx, e.Key, isPending)
+	require.NoError(t, err)
+	assert.False(t, removed)
+	assert.Empty(t, removedKeys)
+
+	e.Data = "pending"
+	_, err = store.Add(ctx, e, 0)
+	require.NoError(t, err)
+	removed, err = store.RemoveIf(ctx, e.Key, isPending)
+	require.NoError(t, err)
+	assert.True(t, removed)
+	assert.Equal(t, []string{e.Key}, removedKeys)
+
+	removed, err = store.RemoveIf(ctx, e.Key, isPending)
+	require.NoError(t, err)
+	assert.False(t, removed, "should not remove entity not found")
+}
+
+func TestEntityStoreTouchIfLonger(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+	store, err := New[testutil.Entity](string(keyfactory.EntityKindTest), keyfactory.GenerateRandomKey(), dsClient)
+	require.NoError(t, err)
+	e := testutil.NewEntity("e-1", mockTenantId, 1)
+	_, err = store.Add(ctx, e, time.Minute)
+	require.NoError(t, err)
+
+	touched, err := store.TouchIfLonger(ctx, e.Key, time.Second)
+	require.NoError(t, err)
+	assert.False(t, touched, "should not shorten expiration")
+	touched, err = store.TouchIfLonger(ctx, e.Key, time.Hour)
+	require.NoError(t, err)
+	assert.True(t, touched)
+
+	_, err = store.Add(ctx, e, 0)
+	require.NoError(t, err)
+	touched, err = store.TouchIfLonger(ctx, e.Key, time.Hour)
+	require.NoError(t, err)
+	assert.False(t, touched, "should not expire entity without expiration")
+}
+
+func TestEntityStoreWithListeners(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	var added, removed []string
+	store, err := New[testutil.Entity](
+		string(keyfactory.EntityKindTest),
+		keyfactory.GenerateRandomKey(),
+		dsClient,
+		WithListeners(
+			func(ctx context.Context, keys []string) { added = append(added, keys...) },
+			nil,
+			func(ctx context.Context, keys []string) { removed = append(removed, keys...) },
+		),
+	)
+	require.NoError(t, err)
+	e := testutil.NewEntity("e-1", mockTenantId, 1)
+	_, err = store.Add(ctx, e, 0)
+	require.NoError(t, err)
+	require.NoError(t, store.Remove(ctx, e.Key))
+	assert.Equal(t, []string{e.Key}, added)
+	assert.Equal(t, []string{e.Key}, removed)
+}
+
+func TestEntityStoreCancelableEvents(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	recorder := metrics.NewMemoryRecorder()
+	store, err := New[testutil.Entity](
+		string(keyfactory.EntityKindTest),
+		keyfactory.GenerateRandomKey(),
+		dsClient,
+		WithCancelableEvents(),
+		WithMetrics(recorder),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	called := 0
+	store.OnAdded().AddListener(func(ctx context.Context, keys []string) {
+		called++
+		cancel()
+	})
+	store.OnAdded().AddListener(func(ctx context.Context, keys []string) { called++ })
+	_, err = store.Add(ctx, testutil.NewEntity("e-1", mockTenantId, 1), 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, called, "should skip listeners after cancellation")
+	assert.Equal(t, int64(1), recorder.Counter(
+		MetricSkippedListeners,
+		metrics.Label{Name: "kind", Value: string(keyfactory.EntityKindTest)},
+		metrics.Label{Name: "event", Value: EntitiesAdded.String()},
+	))
+}
+
+func TestEntityStoreRemovedEventsForMissingKeys(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	var removed [][]string
+	store, err := New[testutil.Entity](
+		string(keyfactory.EntityKindTest),
+		keyfactory.GenerateRandomKey(),
+		dsClient,
+		WithRemovedEventsForMissingKeys(),
+		WithListeners(nil, nil, func(ctx context.Context, keys []string) { removed = append(removed, keys) }),
+	)
+	require.NoError(t, err)
+	e1 := testutil.NewEntity("e-1", mockTenantId, 1)
+	e2 := testutil.NewEntity("e-2", mockTenantId, 1)
+	_, err = store.Add(ctx, e1, 0)
+	require.NoError(t, err)
+
+	require.NoError(t, store.Remove(ctx, e2.Key))
+	require.NoError(t, store.RemoveByKeys(ctx, []string{e1.Key, e2.Key}))
+	assert.Equal(t, [][]string{{e2.Key}, {e1.Key, e2.Key}}, removed, "should emit keys of missing entities")
+}
+
+func TestEntityStoreFilteredListeners(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	store, err := New[testutil.Entity](string(keyfactory.EntityKindTest), keyfactory.GenerateRandomKey(), dsClient)
+	require.NoError(t, err)
+	tenant1, tenant2 := testutil.NewEntity("e-1", mockTenantId, 1), testutil.NewEntity("e-1", "mock_tenant2", 1)
+	var added [][]string
+	token := store.OnAdded().AddListenerFiltered(
+		func(key string) bool { return strings.HasPrefix(key, mockTenantKey+":") },
+		func(ctx context.Context, keys []string) { added = append(added, keys) },
+	)
+
+	_, err = store.AddBatch(ctx, []testutil.Entity{tenant1, tenant2}, 0)
+	require.NoError(t, err)
+	_, err = store.Add(ctx, tenant2, 0)
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{tenant1.Key}}, added, "should only call the listener with matching keys")
+
+	assert.True(t, store.OnAdded().RemoveListener(token))
+	_, err = store.Add(ctx, tenant1, 0)
+	require.NoError(t, err)
+	assert.Len(t, added, 1)
+}
+
+func TestEntityStoreRemoveCount(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+	recorder := metrics.NewMemoryRecorder()
+	store, err := New[testutil.Entity](
+		string(keyfactory.EntityKindTest),
+		keyfactory.GenerateRandomKey(),
+		dsClient,
+		WithMetrics(recorder),
+	)
+	require.NoError(t, err)
+	entities := []testutil.Entity{
+		testutil.NewEntity("e-1", mockTenantId, 1),
+		testutil.NewEntity("e-2", mockTenantId, 1),
+		testutil.NewEntity("e-3", mockTenantId, 1),
+	}
+	_, err = store.AddBatch(ctx, entities, 0)
+	require.NoError(t, err)
+
+	n, err := store.RemoveCount(ctx, entities[0].Key)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = store.RemoveCount(ctx, entities[0].Key)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n, "should not count already removed entity")
+
+	n, err = store.RemoveByKeysCount(ctx, []string{entities[0].Key, entities[1].Key})
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	n, err = store.RemoveAllCount(ctx, mockTenantKey)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = store.RemoveAllCount(ctx, mockTenantKey)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	kind := metrics.Label{Name: "kind", Value: string(keyfactory.EntityKindTest)}
+	assert.Equal(t, int64(3), recorder.Counter(MetricRemoved, kind))
+	assert.Equal(t, int64(2), recorder.Counter(MetricRemoveMisses, kind))
+}
+
+func TestEntityStoreRemoveAllUnscoped(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+	newStore := func(opts ...Option) *EntityStore[testutil.Entity, *testutil.Entity] {
+		store, err := New[testutil.Entity](
+			string(keyfactory.EntityKindTest),
+			keyfactory.GenerateRandomKey(),
+			dsClient,
+			opts...,
+		)
+		require.NoError(t, err)
+		_, err = store.AddBatch(ctx, []testutil.Entity{
+			testutil.NewEntity("e-1", "tenant1", 1),
+			testutil.NewEntity("e-2", "tenant2", 1),
+		}, 0)
+		require.NoError(t, err)
+		return store
+	}
+
+	t.Run("Empty parent key", func(t *testing.T) {
+		store := newStore(WithIndex())
+		err := store.RemoveAll(ctx, "")
+		assert.ErrorIs(t, err, ErrUnscopedRemove)
+		_, err = store.RemoveAllCount(ctx, "")
+		assert.ErrorIs(t, err, ErrUnscopedRemove)
+
+		n, err := store.RemoveAllUnscoped(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, n, "should remove entities of all parents, but not index keys")
+		count, err := store.indexCount(ctx, "")
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), count)
+	})
+
+	t.Run("Entities of other kinds", func(t *testing.T) {
+		store := newStore()
+		parent := testutil.NewEntity("p1", "tenant1", 1)
+		_, err := store.Add(ctx, parent, 0)
+		require.NoError(t, err)
+		others := []*keyfactory.Key{
+			keyfactory.NewKey(parent.Key+":child:c1", store.namespace),    // Nested under an entity of the kind.
+			keyfactory.NewKey(parent.Key+":child:c1:v1", store.namespace), // Versioned, nested.
+			keyfactory.NewKey("checkpoint:"+parent.ID, store.namespace),
+		}
+		for _, key := range others {
+			require.NoError(t, dsClient.Put(ctx, key, []byte("other"), 0))
+		}
+		require.NoError(t, dsClient.Put(ctx, keyfactory.NewKey(parent.Key+":v1", store.namespace), []byte("{}"), 0))
+
+		n, err := store.RemoveAllUnscoped(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 4, n, "should remove entities and versions of the kind only")
+		for _, key := range others {
+			exists, err := dsClient.Exists(ctx, key)
+			require.NoError(t, err)
+			assert.True(t, exists, "should not remove '%s'", key.Key())
+		}
+	})
+
+	t.Run("Entities under a versioned parent", func(t *testing.T) {
+		store, err := New[testutil.Entity](string(keyfactory.EntityKindTest), keyfactory.GenerateRandomKey(), dsClient)
+		require.NoError(t, err)
+		parentKey := keyfactory.BuildRedisKey(mockTenantKey, "doc", "d1", "v1")
+		key, err := store.EntityKey("e-3", "", parentKey)
+		require.NoError(t, err)
+		versionKey, err := store.EntityKey("e-3", "v2", parentKey)
+		require.NoError(t, err)
+		_, err = store.AddBatch(ctx, []testutil.Entity{{Key: key, ID: "e-3"}, {Key: versionKey, ID: "e-3"}}, 0)
+		require.NoError(t, err)
+		require.NoError(t, store.Verify(ctx, RequireEntities()), "should sample entities under a versioned parent")
+
+		n, err := store.RemoveAllUnscoped(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, n, "should remove entities and versions under a versioned parent")
+	})
+
+	t.Run("With unscoped remove all", func(t *testing.T) {
+		store := newStore(WithUnscopedRemoveAll())
+		_, err := store.Add(ctx, testutil.Entity{Key: "test_entity:e-3"}, 0)
+		require.NoError(t, err)
+		n, err := store.RemoveAllCount(ctx, "")
+		require.NoError(t, err)
+		assert.Equal(t, 1, n, "should remove entities without a parent key")
+	})
+}
+
+func TestEntityStoreParentKeyCheck(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+
+	type tenantCtxKey struct{}
+	store, err := New[testutil.Entity](
+		string(keyfactory.EntityKindTest),
+		keyfactory.GenerateRandomKey(),
+		dsClient,
+		WithParentKeyCheck(func(ctx context.Context) string {
+			tenantKey, _ := ctx.Value(tenantCtxKey{}).(string)
+			return tenantKey
+		}),
+	)
+	require.NoError(t, err)
+	tenant1Key, err := keyfactory.NewTenantKey("tenant1")
+	require.NoError(t, err)
+	ctx := context.WithValue(context.Background(), tenantCtxKey{}, tenant1Key)
+	own := testutil.NewEntity("e-1", "tenant1", 1)
+	other := testutil.NewEntity("e-2", "tenant10", 1) // Shares the tenant ID prefix.
+
+	_, err = store.Add(ctx, own, 0)
+	assert.NoError(t, err)
+	_, err = store.Add(ctx, other, 0)
+	assert.ErrorIs(t, err, ErrParentKeyMismatch)
+	_, err = store.AddAndGetPrevious(ctx, other, 0)
+	assert.ErrorIs(t, err, ErrParentKeyMismatch)
+	_, err = store.AddBatch(ctx, []testutil.Entity{own, other}, 0)
+	assert.ErrorIs(t, err, ErrParentKeyMismatch)
+	exists, err := store.Exists(ctx, other.Key)
+	require.NoError(t, err)
+	assert.False(t, exists, "should not write entities of other parents")
+
+	result, err := store.AddBatchPartial(ctx, []testutil.Entity{own, other}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{own.Key}, result.Succeeded())
+	require.Len(t, result.Failed(), 1)
+	assert.ErrorIs(t, result.Failed()[0].Err, ErrParentKeyMismatch)
+
+	_, err = store.Add(context.Background(), other, 0)
+	assert.NoError(t, err, "should skip the check without an expected parent key")
+}
+
+func TestEntityStoreKeyStrategy(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	store, err := New[testutil.Entity](
+		string(keyfactory.EntityKindTest),
+		keyfactory.GenerateRandomKey(),
+		dsClient,
+		WithKeyStrategy(keyfactory.HashTaggedKeyStrategy{}),
+		WithParentKeyCheck(func(context.Context) string { return mockTenantKey }),
+	)
+	require.NoError(t, err)
+	var entities []testutil.Entity
+	for _, id := range []string{"e-1", "e-2"} {
+		key, err := store.EntityKey(id, "", mockTenantKey)
+		require.NoError(t, err)
+		entities = append(entities, testutil.Entity{Key: key, ID: id, TenantID: mockTenantId})
+	}
+	assert.Equal(t, "{"+mockTenantKey+"}:test_entity:e-1", entities[0].Key)
+	_, err = store.AddBatch(ctx, entities, 0)
+	require.NoError(t, err, "should accept tagged keys under the expected parent")
+
+	all, err := store.GetAll(ctx, mockTenantKey)
+	require.NoError(t, err)
+	assert.Len(t, all, 2, "should match entities by the untagged parent key")
+	n, err := store.RemoveAllCount(ctx, mockTenantKey)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
+
+func TestEntityStoreCollisionDetection(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	var handled []error
+	store, err := New[testutil.Entity](
+		string(keyfactory.EntityKindTest),
+		keyfactory.GenerateRandomKey(),
+		dsClient,
+		WithCollisionDetection(),
+		WithCorruptionHandler(func(err error) { handled = append(handled, err) }),
+	)
+	require.NoError(t, err)
+	original := testutil.NewEntity("e-1", mockTenantId, 1)
+	_, err = store.Add(ctx, original, 0)
+	require.NoError(t, err)
+
+	updated := original
+	updated.UpdatedAt = 2
+	_, err = store.Add(ctx, updated, 0)
+	assert.NoError(t, err, "should allow updates of the same entity")
+
+	colliding := testutil.NewEntity("e-2", mockTenantId, 1)
+	colliding.Key = original.Key // Faulty key.
+	_, err = store.Add(ctx, colliding, 0)
+	assert.ErrorIs(t, err, ErrKeyCollision)
+	_, err = store.AddAndGetPrevious(ctx, colliding, 0)
+	assert.ErrorIs(t, err, ErrKeyCollision)
+	_, err = store.AddBatch(ctx, []testutil.Entity{colliding}, 0)
+	assert.ErrorIs(t, err, ErrKeyCollision)
+	assert.Len(t, handled, 3, "should report each collision")
+	stored, err := store.Get(ctx, original.Key)
+	require.NoError(t, err)
+	assert.Equal(t, "e-1", stored.ID, "should not overwrite the stored entity")
+
+	other := testutil.NewEntity("e-3", mockTenantId, 1)
+	result, err := store.AddBatchPartial(ctx, []testutil.Entity{other, colliding}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{other.Key}, result.Succeeded())
+	require.Len(t, result.Failed(), 1)
+	assert.ErrorIs(t, result.Failed()[0].Err, ErrKeyCollision)
+
+	fresh := testutil.NewEntity("e-4", mockTenantId, 1)
+	sameKey := testutil.NewEntity("e-5", mockTenantId, 1)
+	sameKey.Key = fresh.Key
+	_, err = store.AddBatch(ctx, []testutil.Entity{fresh, sameKey}, 0)
+	assert.ErrorIs(t, err, ErrKeyCollision, "should detect collisions within the batch")
+}
+
+func TestEntityStorePruneVersions(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	store, err := New[testutil.Entity](string(keyfactory.EntityKindTest), keyfactory.GenerateRandomKey(), dsClient)
+	require.NoError(t, err)
+	addVersions := func(t *testing.T, id string, versions ...string) {
+		t.Helper()
+		for _, v := range versions {
+			key, err := store.EntityKey(id, v, mockTenantKey)
+			require.NoError(t, err)
+			_, err = store.Add(ctx, testutil.Entity{Key: key, ID: id, TenantID: mockTenantId}, 0)
+			require.NoError(t, err)
+		}
+	}
+	storedKeys := func(t *testing.T) []string {
+		t.Helper()
+		entities, err := store.GetAll(ctx, mockTenantKey)
+		require.NoError(t, err)
+		keys := make([]string, len(entities))
+		for i, e := range entities {
+			keys[i] = e.Key
+		}
+		return keys
+	}
+	versionKey := func(t *testing.T, id, version string) string {
+		t.Helper()
+		key, err := store.EntityKey(id, version, mockTenantKey)
+		require.NoError(t, err)
+		return key
+	}
+
+	t.Run("Keep latest versions", func(t *testing.T) {
+		addVersions(t, "e-1", "1", "2", "9", "10")
+		addVersions(t, "e-2", "1")
+		_, err := store.Add(ctx, testutil.NewEntity("e-3", mockTenantId, 1), 0) // Unversioned.
+		require.NoError(t, err)
+
+		n, err := store.PruneVersions(ctx, mockTenantKey, VersionPolicy{KeepLatest: 2}, WithChunkSize(1))
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+		assert.ElementsMatch(t, []string{
+			versionKey(t, "e-1", "9"),
+			versionKey(t, "e-1", "10"),
+			versionKey(t, "e-2", "1"),
+			testutil.NewEntity("e-3", mockTenantId, 1).Key,
+		}, storedKeys(t), "should order versions numerically and ignore unversioned keys")
+		_, err = store.RemoveAllCount(ctx, mockTenantKey)
+		require.NoError(t, err)
+	})
+
+	t.Run("Prune versions by age", func(t *testing.T) {
+		now := time.Now()
+		addVersions(t, "e-1", "1", "2", "3")
+		versionTime := func(v string) (time.Time, bool) {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return time.Time{}, false
+			}
+			return now.Add(-time.Duration(4-n) * time.Hour), true // Versions are 3h, 2h, and 1h old.
+		}
+		n, err := store.PruneVersions(ctx, mockTenantKey, VersionPolicy{MaxAge: 90 * time.Minute, VersionTime: versionTime})
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+
+		addVersions(t, "e-2", "1", "2")
+		n, err = store.PruneVersions(ctx, mockTenantKey, VersionPolicy{MaxAge: time.Minute, VersionTime: versionTime})
+		require.NoError(t, err)
+		assert.Equal(t, 1, n, "should keep the latest version regardless of age")
+		assert.ElementsMatch(t, []string{versionKey(t, "e-1", "3"), versionKey(t, "e-2", "2")}, storedKeys(t))
+	})
+
+	t.Run("Invalid policy", func(t *testing.T) {
+		_, err := store.PruneVersions(ctx, mockTenantKey, VersionPolicy{})
+		assert.Error(t, err)
+		_, err = store.PruneVersions(ctx, mockTenantKey, VersionPolicy{MaxAge: time.Hour})
+		assert.Error(t, err, "should require a version time with a max age")
+	})
+}
+
+func TestEntityStoreGetLatest(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	store, err := New[testutil.Entity](string(keyfactory.EntityKindTest), keyfactory.GenerateRandomKey(), dsClient)
+	require.NoError(t, err)
+	for i, v := range []string{"2", "10", "9"} {
+		key, err := store.EntityKey("e-1", v, mockTenantKey)
+		require.NoError(t, err)
+		_, err = store.Add(ctx, testutil.Entity{Key: key, ID: "e-1", TenantID: mockTenantId, UpdatedAt: int64(i)}, 0)
+		require.NoError(t, err)
+	}
+	_, err = store.Add(ctx, testutil.NewEntity("e-10", mockTenantId, 1), 0) // Shares the ID prefix.
+	require.NoError(t, err)
+
+	latest, err := store.GetLatest(ctx, mockTenantKey, "e-1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), latest.UpdatedAt, "should return the numerically latest version")
+
+	_, err = store.GetLatest(ctx, mockTenantKey, "e-10")
+	assert.ErrorIs(t, err, datastore.ErrKeyNotFound, "should not return unversioned entities")
+	_, err = store.GetLatest(ctx, mockTenantKey, "e-2")
+	assert.ErrorIs(t, err, datastore.ErrKeyNotFound)
+}
+
+func TestEntityStorePublishVersion(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	store, err := New[testutil.Entity](string(keyfactory.EntityKindTest), keyfactory.GenerateRandomKey(), dsClient)
+	require.NoError(t, err)
+	var added [][]string
+	store.OnAdded().AddListener(func(ctx context.Context, keys []string) { added = append(added, keys) })
+	latestKey, err := store.LatestEntityKey("e-1", mockTenantKey)
+	require.NoError(t, err)
+
+	for _, v := range []string{"1", "2"} {
+		key, err := store.EntityKey("e-1", v, mockTenantKey)
+		require.NoError(t, err)
+		require.NoError(t, store.PublishVersion(ctx, testutil.Entity{Key: key, ID: "e-1", Data: v}))
+	}
+	latest, err := store.Get(ctx, latestKey)
+	require.NoError(t, err)
+	assert.Equal(t, "2", latest.Data, "should point the alias to the published version")
+	v1Key, err := store.EntityKey("e-1", "1", mockTenantKey)
+	require.NoError(t, err)
+	v1, err := store.Get(ctx, v1Key)
+	require.NoError(t, err)
+	assert.Equal(t, "1", v1.Data, "should keep previous versions")
+	require.Len(t, added, 2)
+	assert.Equal(t, latestKey, added[1][1])
+
+	latest, err = store.GetLatest(ctx, mockTenantKey, "e-1")
+	require.NoError(t, err)
+	assert.Equal(t, "2", latest.Data)
+	n, err := store.PruneVersions(ctx, mockTenantKey, VersionPolicy{KeepLatest: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 1, n, "should not prune the alias")
+	exists, err := store.Exists(ctx, latestKey)
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	err = store.PublishVersion(ctx, testutil.Entity{Key: latestKey, ID: "e-1"})
+	assert.ErrorIs(t, err, keyfactory.ErrInvalidKey, "should not publish the alias as a version")
+	unversioned := testutil.NewEntity("e-2", mockTenantId, 1)
+	err = store.PublishVersion(ctx, unversioned)
+	assert.ErrorIs(t, err, keyfactory.ErrInvalidKey, "should not publish an unversioned key")
+	nested := testutil.NewEntity("e-3", mockTenantId, 1)
+	nested.Key = keyfactory.BuildRedisKey(v1Key, "child")
+	err = store.PublishVersion(ctx, nested)
+	assert.ErrorIs(t, err, keyfactory.ErrInvalidKey, "should not publish a key with a multi-fragment version")
+	exists, err = store.Exists(ctx, keyfactory.BuildRedisKey(mockTenantKey, string(keyfactory.EntityKindTest), LatestVersionId))
+	require.NoError(t, err)
+	assert.False(t, exists, "should not write an alias of unversioned keys")
+}
+
+func TestEntityStoreTransformOnRead(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	store, err := New[testutil.Entity](string(keyfactory.EntityKindTest), keyfactory.GenerateRandomKey(), dsClient)
+	require.NoError(t, err)
+	legacy := testutil.NewEntity("e-1", mockTenantId, 1)
+	legacy.Data = "legacy"
+	_, err = store.Add(ctx, legacy, 0)
+	require.NoError(t, err)
+
+	store.TransformOnRead(func(e *testutil.Entity) error {
+		if e.Data == "legacy" {
+			e.Data = "current"
+		}
+		return nil
+	})
+	store.TransformOnRead(func(e *testutil.Entity) error {
+		e.Data += "!"
+		return nil
+	})
+	entity, err := store.Get(ctx, legacy.Key)
+	require.NoError(t, err)
+	assert.Equal(t, "current!", entity.Data, "should apply the transformations in order")
+	all, err := store.GetAll(ctx, mockTenantKey)
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	assert.Equal(t, "current!", all[0].Data)
+
+	errTransform := errors.New("transform failed")
+	store.TransformOnRead(func(e *testutil.Entity) error { return errTransform })
+	_, err = store.Get(ctx, legacy.Key)
+	assert.ErrorIs(t, err, errTransform)
+}
+
+func TestEntityStoreReencode(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	namespace := keyfactory.GenerateRandomKey()
+	legacy, err := New[testutil.Entity](string(keyfactory.EntityKindTest), namespace, dsClient)
+	require.NoError(t, err)
+	store, err := New[testutil.Entity](string(keyfactory.EntityKindTest), namespace, dsClient, WithChecksum())
+	require.NoError(t, err)
+	var entities []testutil.Entity
+	for _, id := range []string{"e-1", "e-2", "e-3", "e-4"} {
+		entities = append(entities, testutil.NewEntity(id, mockTenantId, 1))
+	}
+	_, err = legacy.AddBatch(ctx, entities, 0)
+	require.NoError(t, err)
+	_, err = store.Get(ctx, entities[0].Key)
+	require.Error(t, err, "should not decode entities in the legacy encoding")
+
+	start := time.Now()
+	progress, err := store.Reencode(ctx, mockTenantKey, legacy, WithChunkSize(2), WithRateLimit(40))
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond, "should pace the chunks")
+	assert.Equal(t, UpdateProgress{Scanned: 4, Matched: 4, Updated: 4}, progress)
+	all, err := store.GetAll(ctx, mockTenantKey)
+	require.NoError(t, err)
+	assert.Len(t, all, 4, "should decode the re-encoded entities")
+
+	progress, err = store.Reencode(ctx, mockTenantKey, legacy)
+	require.NoError(t, err)
+	assert.Equal(t, UpdateProgress{Scanned: 4}, progress, "should skip entities in the store's encoding")
+
+	corrupt := keyfactory.NewKey(testutil.NewEntity("e-5", mockTenantId, 1).Key, namespace)
+	require.NoError(t, dsClient.Put(ctx, corrupt, []byte("x"), 0))
+	_, err = store.Reencode(ctx, mockTenantKey, legacy)
+	assert.Error(t, err, "should fail on entities neither store decodes")
+}
+
+func TestEntityStoreRotateEncryptionKey(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	keyV1, keyV2 := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+	krV1, err := NewKeyring(1, map[uint8][]byte{1: keyV1})
+	require.NoError(t, err)
+	krV2, err := NewKeyring(2, map[uint8][]byte{1: keyV1, 2: keyV2})
+	require.NoError(t, err)
+	_, err = NewKeyring(3, map[uint8][]byte{1: keyV1})
+	assert.Error(t, err, "should require the key of the current version")
+
+	namespace := keyfactory.GenerateRandomKey()
+	oldStore, err := New[testutil.Entity](string(keyfactory.EntityKindTest), namespace, dsClient, WithEncryption(krV1))
+	require.NoError(t, err)
+	store, err := New[testutil.Entity](string(keyfactory.EntityKindTest), namespace, dsClient, WithEncryption(krV2))
+	require.NoError(t, err)
+	var entities []testutil.Entity
+	for _, id := range []string{"e-1", "e-2", "e-3"} {
+		entities = append(entities, testutil.NewEntity(id, mockTenantId, 1))
+	}
+	_, err = oldStore.AddBatch(ctx, entities, 0)
+	require.NoError(t, err)
+	_, err = store.Get(ctx, entities[0].Key)
+	require.NoError(t, err, "should read values encrypted with a previous key")
+
+	progress, err := store.RotateEncryptionKey(ctx, mockTenantKey, WithChunkSize(2))
+	require.NoError(t, err)
+	assert.Equal(t, UpdateProgress{Scanned: 3, Matched: 3, Updated: 3}, progress)
+	progress, err = store.RotateEncryptionKey(ctx, mockTenantKey)
+	require.NoError(t, err)
+	assert.Equal(t, UpdateProgress{Scanned: 3}, progress, "should skip values encrypted with the current key")
+	_, err = oldStore.Get(ctx, entities[0].Key)
+	assert.ErrorIs(t, err, datastore.ErrCorruptedData, "should not read values encrypted with an unknown key")
+	all, err := store.GetAll(ctx, mockTenantKey)
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	t.Run("Should re-encode values of another format encrypted with the current key", func(t *testing.T) {
+		checked, err := New[testutil.Entity](
+			string(keyfactory.EntityKindTest), namespace, dsClient, WithEncryption(krV2), WithChecksum(),
+		)
+		require.NoError(t, err)
+		progress, err := checked.Reencode(ctx, mockTenantKey, store)
+		require.NoError(t, err)
+		assert.Equal(t, 3, progress.Updated)
+		progress, err = checked.Reencode(ctx, mockTenantKey, store)
+		require.NoError(t, err)
+		assert.Zero(t, progress.Matched)
+	})
+
+	t.Run("Should bind values to their entity key", func(t *testing.T) {
+		data, err := dsClient.Get(ctx, keyfactory.NewKey(entities[0].Key, namespace))
+		require.NoError(t, err)
+		require.NoError(t, dsClient.Put(ctx, keyfactory.NewKey(entities[1].Key, namespace), data, 0))
+		_, err = store.Get(ctx, entities[1].Key)
+		assert.ErrorIs(t, err, datastore.ErrCorruptedData)
+	})
+
+	t.Run("Should require encryption", func(t *testing.T) {
+		plain, err := New[testutil.Entity](string(keyfactory.EntityKindTest), namespace, dsClient)
+		require.NoError(t, err)
+		_, err = plain.RotateEncryptionKey(ctx, mockTenantKey)
+		assert.Error(t, err)
+	})
+}
+
+func TestEntityStoreSample(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	store, err := New[testutil.Entity](string(keyfactory.EntityKindTest), keyfactory.GenerateRandomKey(), dsClient)
+	require.NoError(t, err)
+	var entities []testutil.Entity
+	for i := range 200 {
+		entities = append(entities, testutil.NewEntity("e-"+strconv.Itoa(i), mockTenantId, 1))
+	}
+	_, err = store.AddBatch(ctx, entities, 0)
+	require.NoError(t, err)
+
+	sampleKeys := func(t *testing.T, fraction float64) []string {
+		t.Helper()
+		sample, err := store.Sample(ctx, mockTenantKey, fraction, WithChunkSize(50))
+		require.NoError(t, err)
+		keys := make([]string, len(sample))
+		for i, e := range sample {
+			keys[i] = e.GetKey()
+		}
+		slices.Sort(keys)
+		return keys
+	}
+
+	small, large := sampleKeys(t, 0.1), sampleKeys(t, 0.5)
+	assert.InDelta(t, 20, len(small), 15)
+	assert.InDelta(t, 100, len(large), 30)
+	assert.Equal(t, small, sampleKeys(t, 0.1), "should sample the same entities on each call")
+	assert.Subset(t, large, small, "should include the sample of a smaller fraction")
+	assert.Len(t, sampleKeys(t, 1), 200)
+
+	for _, fraction := range []float64{0, -0.5, 1.5} {
+		_, err := store.Sample(ctx, mockTenantKey, fraction)
+		assert.Error(t, err, "fraction %v", fraction)
+	}
+}
+
+func TestEntityStoreCallOptions(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	namespace := keyfactory.GenerateRandomKey()
+	store, err := New[testutil.Entity](string(keyfactory.EntityKindTest), namespace, dsClient)
+	require.NoError(t, err)
+	var events []string
+	store.OnAdded().AddListener(func(ctx context.Context, keys []string) { events = append(events, keys...) })
+	store.OnRemoved().AddListener(func(ctx context.Context, keys []string) { events = append(events, keys...) })
+	e1 := testutil.NewEntity("e-1", mockTenantId, 1)
+
+	t.Run("DryRun", func(t *testing.T) {
+		key, err := store.Add(ctx, e1, 0, DryRun())
+		require.NoError(t, err)
+		assert.Equal(t, e1.Key, key)
+		exists, err := store.Exists(ctx, e1.Key)
+		require.NoError(t, err)
+		assert.False(t, exists, "should not add the entity")
+		_, err = store.Add(ctx, testutil.Entity{Key: "invalid key"}, 0, DryRun())
+		assert.Error(t, err)
+
+		_, err = store.Add(ctx, e1, 0)
+		require.NoError(t, err)
+		require.NoError(t, store.Remove(ctx, e1.Key, DryRun()))
+		exists, err = store.Exists(ctx, e1.Key)
+		require.NoError(t, err)
+		assert.True(t, exists, "should not remove the entity")
+		assert.Equal(t, []string{e1.Key}, events)
+	})
+
+	t.Run("SkipEvents", func(t *testing.T) {
+		events = nil
+		_, err := store.Add(ctx, e1, 0, SkipEvents())
+		require.NoError(t, err)
+		require.NoError(t, store.Remove(ctx, e1.Key, SkipEvents()))
+		assert.Empty(t, events)
+	})
+
+	t.Run("WithTTL", func(t *testing.T) {
+		_, err := store.Add(ctx, e1, 0, WithTTL(time.Minute))
+		require.NoError(t, err)
+		records, err := dsClient.GetMultiWithTTL(ctx, []*keyfactory.Key{keyfactory.NewKey(e1.Key, namespace)})
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+		assert.Equal(t, time.Minute, records[0].TTL)
+	})
+}
+
+func TestEntityStoreVerify(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	namespace := keyfactory.GenerateRandomKey()
+	newStore := func(t *testing.T, namespace string, opts ...Option) *EntityStore[testutil.Entity, *testutil.Entity] {
+		t.Helper()
+		store, err := New[testutil.Entity](string(keyfactory.EntityKindTest), namespace, dsClient, opts...)
+		require.NoError(t, err)
+		return store
+	}
+	store := newStore(t, namespace)
+	entities, _ := generateTestEntities(t, 3, mockTenantId)
+	for _, e := range entities {
+		_, err := store.Add(ctx, testutil.Entity{Key: e.GetKey(), ID: e.Id}, 0)
+		require.NoError(t, err)
+	}
+
+	assert.NoError(t, store.Verify(ctx))
+	nested := keyfactory.NewKey(entities[0].GetKey()+":child:c1", namespace)
+	require.NoError(t, dsClient.Put(ctx, nested, []byte("not an entity"), 0))
+	assert.NoError(t, store.Verify(ctx), "should not verify entities of other kinds")
+	err = newStore(t, namespace, WithChecksum()).Verify(ctx)
+	assert.ErrorIs(t, err, ErrVerifyFailed, "should detect the wrong codec")
+	err = newStore(t, namespace, WithKeyStrategy(keyfactory.HashTaggedKeyStrategy{})).Verify(ctx)
+	assert.ErrorIs(t, err, ErrVerifyFailed, "should detect the wrong key strategy")
+
+	empty := newStore(t, keyfactory.GenerateRandomKey())
+	assert.NoError(t, empty.Verify(ctx))
+	assert.ErrorIs(t, empty.Verify(ctx, RequireEntities()), ErrVerifyFailed)
+}
+
+func TestEntityStoreErrors(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+	store, err := New[testutil.Entity](string(keyfactory.EntityKindTest), keyfactory.GenerateRandomKey(), dsClient)
+	require.NoError(t, err)
+
+	t.Run("Should return typed not found error", func(t *testing.T) {
+		_, err := store.Get(ctx, testutil.NewEntity("missing", mockTenantId, 1).Key)
+		assert.ErrorIs(t, err, ErrEntityNotFound)
+		assert.ErrorIs(t, err, datastore.ErrKeyNotFound)
+		var opErr *datastore.OpError
+		require.ErrorAs(t, err, &opErr)
+		assert.Equal(t, "get", opErr.Op)
+	})
+
+	t.Run("Should return typed invalid key error", func(t *testing.T) {
+		_, err := store.Get(ctx, "invalid key")
+		assert.ErrorIs(t, err, ErrInvalidKey)
+	})
+
+	t.Run("Should return typed unavailable error", func(t *testing.T) {
+		server.Close()
+		defer func() { require.NoError(t, server.Restart()) }()
+		_, err := store.Get(ctx, testutil.NewEntity("e-1", mockTenantId, 1).Key)
+		assert.ErrorIs(t, err, ErrBackendUnavailable)
+	})
+}
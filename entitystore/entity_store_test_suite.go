@@ -2,7 +2,10 @@ package entitystore
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -27,6 +30,13 @@ type EntityStoreTestSuite[T Entity, PT SerializableEntity[T]] struct {
 	// SetupStore initializes a new store with test data isolation and cleanup.
 	SetupStore       func(t *testing.T) (EntityStorer[T, PT], context.Context)
 	GenerateEntities func(t *testing.T, num int, tenantId string) ([]T, []string)
+
+	setupStore func(t *testing.T, ctx context.Context, entityKind string, namespace string, dsClient *datastore.Client) EntityStorer[T, PT]
+
+	// Chaos phase, enabled by WithChaos.
+	chaosDSClient *datastore.Client
+	chaosFaults   *testutil.FaultInjector
+	chaosRate     float64
 }
 
 func NewEntityStoreTestSuite[T Entity, PT SerializableEntity[T]](
@@ -56,7 +66,7 @@ func NewEntityStoreTestSuite[T Entity, PT SerializableEntity[T]](
 			t.Cleanup(func() {
 				// Flush the store data after each test.
 				// TODO: Not necessary when using testutil.NewRedisClientWithCleanup.
-				err := store.flush(ctx)
+				err := store.Flush(ctx)
 				if err != nil {
 					t.Fatalf("failed to flush store data after test: %v", err)
 				}
@@ -66,21 +76,46 @@ func NewEntityStoreTestSuite[T Entity, PT SerializableEntity[T]](
 		GenerateEntities: func(t *testing.T, num int, tenantId string) ([]T, []string) {
 			return generateEntities(t, num, tenantId)
 		},
+		setupStore: setupStore,
 	}
 }
 
+// WithChaos enables the chaos phase of the suite, which runs random operations on a store using
+// the datastore client while the fault injector fails commands with the probability rate, and
+// asserts that faults are surfaced as errors, that no corrupt entities are read, and that events
+// are only emitted for successful writes. The datastore client must share the suite's datastore,
+// and its faults must be disabled, i.e. created by testutil.WithFaults with rate 0.
+//
+// Use to validate new drivers against transient failures.
+func (s *EntityStoreTestSuite[T, PT]) WithChaos(
+	dsClient *datastore.Client,
+	faults *testutil.FaultInjector,
+	rate float64,
+) *EntityStoreTestSuite[T, PT] {
+	s.chaosDSClient = dsClient
+	s.chaosFaults = faults
+	s.chaosRate = rate
+	return s
+}
+
 func (s *EntityStoreTestSuite[T, PT]) Run(t *testing.T) {
 	t.Run(fmt.Sprintf("Test %s GenerateEntites", s.EntityKind), s.TestGenerateEntities)
 	t.Run(fmt.Sprintf("Test %s Add", s.EntityKind), s.TestAdd)
 	t.Run(fmt.Sprintf("Test %s AddBatch", s.EntityKind), s.TestAddBatch)
+	t.Run(fmt.Sprintf("Test %s AddBatchPartial", s.EntityKind), s.TestAddBatchPartial)
 	t.Run(fmt.Sprintf("Test %s Get", s.EntityKind), s.TestGet)
 	t.Run(fmt.Sprintf("Test %s GetByKeys", s.EntityKind), s.TestGetByKeys)
+	t.Run(fmt.Sprintf("Test %s GetByKeysPartial", s.EntityKind), s.TestGetByKeysPartial)
 	t.Run(fmt.Sprintf("Test %s GetWithPagination", s.EntityKind), s.TestGetWithPagination)
 	t.Run(fmt.Sprintf("Test %s GetAll", s.EntityKind), s.TestGetAll)
 	t.Run(fmt.Sprintf("Test %s Exists", s.EntityKind), s.TestExists)
 	t.Run(fmt.Sprintf("Test %s RemoveAll", s.EntityKind), s.TestRemoveAll)
 	t.Run(fmt.Sprintf("Test %s Remove", s.EntityKind), s.TestRemove)
 	t.Run(fmt.Sprintf("Test %s RemoveByKeys", s.EntityKind), s.TestRemoveByKeys)
+	t.Run(fmt.Sprintf("Test %s RemoveByKeysPartial", s.EntityKind), s.TestRemoveByKeysPartial)
+	t.Run(fmt.Sprintf("Test %s Flush", s.EntityKind), s.TestFlush)
+	t.Run(fmt.Sprintf("Test %s EventOrdering", s.EntityKind), s.TestEventOrdering)
+	t.Run(fmt.Sprintf("Test %s Chaos", s.EntityKind), s.TestChaos)
 }
 
 func (s *EntityStoreTestSuite[T, PT]) TestGenerateEntities(t *testing.T) {
@@ -178,6 +213,30 @@ func (s *EntityStoreTestSuite[T, PT]) TestAddBatch(t *testing.T) {
 	})
 }
 
+func (s *EntityStoreTestSuite[T, PT]) TestAddBatchPartial(t *testing.T) {
+	t.Run("Add entities with an invalid entity", func(t *testing.T) {
+		store, ctx := s.SetupStore(t)
+		entities, keys := s.GenerateEntities(t, 3, mockTenantId)
+		var invalidEntity T // Zero value entity has an empty key.
+		var receivedKeys []string
+		listenerToken := store.OnAdded().AddListener(func(ctx context.Context, keys []string) {
+			receivedKeys = keys
+		})
+		defer store.OnAdded().RemoveListener(listenerToken)
+
+		result, err := store.AddBatchPartial(ctx, append(entities, invalidEntity), 0)
+		require.NoError(t, err, "should not error when a single entity is invalid")
+		assert.ElementsMatch(t, keys, result.Succeeded(), "should report valid entities as succeeded")
+		require.Len(t, result.Failed(), 1, "should report the invalid entity as failed")
+		assert.Error(t, result.Err())
+		assert.ElementsMatch(t, keys, receivedKeys, "should only emit keys of added entities")
+
+		retrieved, err := store.GetByKeys(ctx, keys)
+		assert.NoError(t, err)
+		assert.Len(t, retrieved, len(keys), "should have added all valid entities")
+	})
+}
+
 func (s *EntityStoreTestSuite[T, PT]) TestGet(t *testing.T) {
 	t.Run("Retrieve existing entity", func(t *testing.T) {
 		store, ctx := s.SetupStore(t)
@@ -208,6 +267,25 @@ func (s *EntityStoreTestSuite[T, PT]) TestGetByKeys(t *testing.T) {
 	})
 }
 
+func (s *EntityStoreTestSuite[T, PT]) TestGetByKeysPartial(t *testing.T) {
+	t.Run("Retrieve a mix of existing, non-existent and invalid keys", func(t *testing.T) {
+		store, ctx := s.SetupStore(t)
+		entities, keys := s.GenerateEntities(t, 3, mockTenantId)
+		_, err := store.AddBatch(ctx, entities, 0)
+		require.NoError(t, err)
+
+		retrieved, result, err := store.GetByKeysPartial(ctx, append([]string{"non-existent", ""}, keys...))
+		require.NoError(t, err)
+		assert.Len(t, retrieved, len(keys), "should retrieve all existing entities")
+		assert.ElementsMatch(t, keys, result.Succeeded())
+		failed := result.Failed()
+		require.Len(t, failed, 2)
+		assert.Equal(t, "non-existent", failed[0].Key)
+		assert.ErrorIs(t, failed[0].Err, datastore.ErrKeyNotFound)
+		assert.ErrorIs(t, failed[1].Err, keyfactory.ErrInvalidKey)
+	})
+}
+
 func (s *EntityStoreTestSuite[T, PT]) TestGetWithPagination(t *testing.T) {
 	t.Run("Fetch paginated entities", func(t *testing.T) {
 		numEntities := 25
@@ -243,6 +321,60 @@ func (s *EntityStoreTestSuite[T, PT]) TestGetWithPagination(t *testing.T) {
 		}
 		assert.Len(t, retrievedEntities, numEntities, fmt.Sprintf("should retrive all %d entities", numEntities))
 	})
+
+	t.Run("Paginate while writers are active", func(t *testing.T) {
+		store, ctx := s.SetupStore(t)
+		entities, keys := s.GenerateEntities(t, 60, mockTenantId)
+		byKey := make(map[string]T, len(entities))
+		for i, key := range keys {
+			byKey[key] = entities[i]
+		}
+		slices.Sort(keys)
+
+		// Stable entities are present during the full iteration, inserted entities are interleaved
+		// with them mid-iteration, and removed entities are removed mid-iteration.
+		var stable, inserted, removed []T
+		for i, key := range keys {
+			switch {
+			case i >= 40:
+				removed = append(removed, byKey[key])
+			case i%2 == 0:
+				stable = append(stable, byKey[key])
+			default:
+				inserted = append(inserted, byKey[key])
+			}
+		}
+		_, err := store.AddBatch(ctx, append(slices.Clone(stable), removed...), 0)
+		require.NoError(t, err)
+
+		seen := make(map[string]int)
+		cursor := uint64(0)
+		for page := 0; ; page++ {
+			require.Less(t, page, 100, "should complete the iteration")
+			resp, err := store.GetWithPagination(ctx, cursor, 5, mockTenantKey)
+			require.NoError(t, err, "should not error when the store is modified mid-iteration")
+			for _, entity := range resp.Entities {
+				seen[entity.GetKey()]++
+			}
+			if page < len(inserted)/5 {
+				// Writers add and remove entities between pages.
+				_, err = store.AddBatch(ctx, inserted[page*5:(page+1)*5], 0)
+				require.NoError(t, err)
+				require.NoError(t, store.Remove(ctx, removed[page].GetKey()))
+			}
+			if resp.Cursor == 0 {
+				break
+			}
+			cursor = resp.Cursor
+		}
+		for _, entity := range stable {
+			assert.Positive(t, seen[entity.GetKey()], "should return entities present during the full iteration")
+		}
+		for key := range seen {
+			assert.Contains(t, byKey, key, "should only return entities of the store")
+		}
+		// Entities may be returned more than once; consumers must tolerate duplicates.
+	})
 }
 
 func (s *EntityStoreTestSuite[T, PT]) TestGetAll(t *testing.T) {
@@ -409,3 +541,231 @@ func (s *EntityStoreTestSuite[T, PT]) TestRemoveByKeys(t *testing.T) {
 		assert.Equal(t, ctx, receivedCtx, "should match the received context")
 	})
 }
+
+func (s *EntityStoreTestSuite[T, PT]) TestRemoveByKeysPartial(t *testing.T) {
+	t.Run("Remove entities with an invalid key", func(t *testing.T) {
+		store, ctx := s.SetupStore(t)
+		entities, keys := s.GenerateEntities(t, 3, mockTenantId)
+		_, err := store.AddBatch(ctx, entities, 0)
+		require.NoError(t, err)
+
+		result, err := store.RemoveByKeysPartial(ctx, append(keys, ""))
+		require.NoError(t, err, "should not error when a single key is invalid")
+		assert.ElementsMatch(t, keys, result.Succeeded())
+		assert.Len(t, result.Failed(), 1)
+		for _, key := range keys {
+			exists, err := store.Exists(ctx, key)
+			assert.NoError(t, err)
+			assert.False(t, exists, "entity shouldn't exist after being removed")
+		}
+	})
+}
+
+func (s *EntityStoreTestSuite[T, PT]) TestFlush(t *testing.T) {
+	t.Run("Flush store triggers event listeners", func(t *testing.T) {
+		store, ctx := s.SetupStore(t)
+		entities, keys := s.GenerateEntities(t, 3, mockTenantId)
+		_, err := store.AddBatch(ctx, entities, 0)
+		require.NoError(t, err)
+
+		var receivedCtx context.Context
+		called := false
+		listenerToken := store.OnFlushed().AddListener(func(ctx context.Context, keys []string) {
+			receivedCtx = ctx
+			called = true
+		})
+		defer store.OnFlushed().RemoveListener(listenerToken)
+
+		err = store.Flush(ctx)
+		assert.NoError(t, err)
+		assert.True(t, called, "should call flushed event listener")
+		assert.Equal(t, ctx, receivedCtx, "should match the received context")
+		for _, key := range keys {
+			exists, err := store.Exists(ctx, key)
+			assert.NoError(t, err)
+			assert.False(t, exists, "entity shouldn't exist after store flush")
+		}
+	})
+}
+
+func (s *EntityStoreTestSuite[T, PT]) TestEventOrdering(t *testing.T) {
+	t.Run("AddBatch emits one event with all keys", func(t *testing.T) {
+		store, ctx := s.SetupStore(t)
+		entities, keys := s.GenerateEntities(t, 10, mockTenantId)
+		var calls [][]string
+		listenerToken := store.OnAdded().AddListener(func(ctx context.Context, keys []string) {
+			calls = append(calls, keys)
+		})
+		defer store.OnAdded().RemoveListener(listenerToken)
+
+		_, err := store.AddBatch(ctx, entities, 0)
+		require.NoError(t, err)
+		require.Len(t, calls, 1, "should emit exactly one event")
+		assert.ElementsMatch(t, keys, calls[0], "should emit all keys")
+	})
+
+	t.Run("Added event fires after data is visible to a concurrent reader", func(t *testing.T) {
+		store, ctx := s.SetupStore(t)
+		entities, keys := s.GenerateEntities(t, 5, mockTenantId)
+		var retrieved []PT
+		var readErr error
+		listenerToken := store.OnAdded().AddListener(func(ctx context.Context, keys []string) {
+			done := make(chan struct{})
+			go func() { // Read from another goroutine, as a concurrent reader would.
+				defer close(done)
+				retrieved, readErr = store.GetByKeys(ctx, keys)
+			}()
+			<-done
+		})
+		defer store.OnAdded().RemoveListener(listenerToken)
+
+		_, err := store.AddBatch(ctx, entities, 0)
+		require.NoError(t, err)
+		require.NoError(t, readErr)
+		assert.Len(t, retrieved, len(keys), "should read all entities of the event")
+	})
+
+	t.Run("Removed event fires after data is removed", func(t *testing.T) {
+		store, ctx := s.SetupStore(t)
+		entities, keys := s.GenerateEntities(t, 3, mockTenantId)
+		_, err := store.AddBatch(ctx, entities, 0)
+		require.NoError(t, err)
+		var existing []string
+		listenerToken := store.OnRemoved().AddListener(func(ctx context.Context, keys []string) {
+			for _, key := range keys {
+				if exists, _ := store.Exists(ctx, key); exists {
+					existing = append(existing, key)
+				}
+			}
+		})
+		defer store.OnRemoved().RemoveListener(listenerToken)
+
+		require.NoError(t, store.RemoveByKeys(ctx, keys))
+		assert.Empty(t, existing, "should not observe removed entities in the event")
+	})
+
+	t.Run("RemoveAll emits one event with all keys", func(t *testing.T) {
+		store, ctx := s.SetupStore(t)
+		entities, keys := s.GenerateEntities(t, 10, mockTenantId)
+		_, err := store.AddBatch(ctx, entities, 0)
+		require.NoError(t, err)
+		var calls [][]string
+		listenerToken := store.OnRemoved().AddListener(func(ctx context.Context, keys []string) {
+			calls = append(calls, keys)
+		})
+		defer store.OnRemoved().RemoveListener(listenerToken)
+
+		require.NoError(t, store.RemoveAll(ctx, mockTenantKey))
+		require.Len(t, calls, 1, "should emit exactly one event")
+		assert.ElementsMatch(t, keys, calls[0], "should emit all keys")
+
+		require.NoError(t, store.RemoveAll(ctx, mockTenantKey))
+		assert.Len(t, calls, 1, "should not emit an event when no entities are removed")
+	})
+
+	t.Run("Remove of non-existent entities doesn't emit event", func(t *testing.T) {
+		store, ctx := s.SetupStore(t)
+		entities, keys := s.GenerateEntities(t, 2, mockTenantId)
+		var calls [][]string
+		listenerToken := store.OnRemoved().AddListener(func(ctx context.Context, keys []string) {
+			calls = append(calls, keys)
+		})
+		defer store.OnRemoved().RemoveListener(listenerToken)
+
+		require.NoError(t, store.Remove(ctx, keys[0]))
+		require.NoError(t, store.RemoveByKeys(ctx, keys))
+		assert.Empty(t, calls, "should not emit events when no entities are removed")
+
+		_, err := store.Add(ctx, entities[1], 0)
+		require.NoError(t, err)
+		require.NoError(t, store.RemoveByKeys(ctx, keys))
+		require.Len(t, calls, 1)
+		assert.Equal(t, []string{keys[1]}, calls[0], "should only emit keys of removed entities")
+	})
+}
+
+func (s *EntityStoreTestSuite[T, PT]) TestChaos(t *testing.T) {
+	if s.chaosDSClient == nil {
+		t.Skip("chaos phase not enabled (see WithChaos)")
+	}
+	ctx := context.Background()
+	namespace := keyfactory.GenerateRandomKey()
+	store := s.setupStore(t, ctx, s.EntityKind, namespace, s.chaosDSClient)
+	verifier := s.setupStore(t, ctx, s.EntityKind, namespace, s.DSClient) // Same entities, without faults.
+	t.Cleanup(func() {
+		if err := verifier.Flush(ctx); err != nil {
+			t.Fatalf("failed to flush store data after test: %v", err)
+		}
+	})
+	entities, keys := s.GenerateEntities(t, 20, mockTenantId)
+
+	var mu sync.Mutex
+	events := make(map[string]int) // Number of added events by key.
+	store.OnAdded().AddListener(func(ctx context.Context, keys []string) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, key := range keys {
+			events[key]++
+		}
+	})
+	addedEvents := func(key string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return events[key]
+	}
+
+	exists := make(map[string]bool)    // Expected state of the keys, if known.
+	uncertain := make(map[string]bool) // Keys of failed writes, which may be partially applied.
+	s.chaosFaults.SetRate(s.chaosRate)
+	rng := rand.New(rand.NewSource(1))
+	for range 500 {
+		i := rng.Intn(len(entities))
+		key := keys[i]
+		switch rng.Intn(3) {
+		case 0:
+			before := addedEvents(key)
+			_, err := store.Add(ctx, entities[i], 0)
+			if err != nil {
+				require.ErrorIs(t, err, datastore.ErrBackendUnavailable, "should surface fault")
+				assert.Equal(t, before, addedEvents(key), "should not emit event for failed add")
+				uncertain[key] = true
+				continue
+			}
+			assert.Equal(t, before+1, addedEvents(key), "should emit event for add")
+			exists[key], uncertain[key] = true, false
+		case 1:
+			if err := store.Remove(ctx, key); err != nil {
+				require.ErrorIs(t, err, datastore.ErrBackendUnavailable, "should surface fault")
+				uncertain[key] = true
+				continue
+			}
+			exists[key], uncertain[key] = false, false
+		case 2:
+			entity, err := store.Get(ctx, key)
+			switch {
+			case err == nil:
+				assert.Equal(t, key, entity.GetKey())
+				if !uncertain[key] {
+					assert.True(t, exists[key], "should not read removed entity")
+				}
+			case errors.Is(err, ErrEntityNotFound):
+				if !uncertain[key] {
+					assert.False(t, exists[key], "should read added entity")
+				}
+			default:
+				require.ErrorIs(t, err, datastore.ErrBackendUnavailable, "should surface fault")
+			}
+		}
+	}
+	s.chaosFaults.SetRate(0)
+	t.Logf("chaos: %d injected faults", s.chaosFaults.Faults())
+
+	for _, key := range keys {
+		if uncertain[key] {
+			continue
+		}
+		found, err := verifier.Exists(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, exists[key], found, "should match state of successful writes for '%s'", key)
+	}
+}
@@ -0,0 +1,45 @@
+package entitystore
+
+import (
+	"context"
+
+	"github.com/holmberd/go-entitystore/eventemitter"
+	"github.com/holmberd/go-entitystore/metrics"
+)
+
+const MetricSkippedListeners = "entitystore_skipped_listeners_total" // Counter of event listeners skipped due to a done context.
+
+// enableCancelableEvents makes the store's event targets skip listeners once the context is done.
+func (es *EntityStore[T, PT]) enableCancelableEvents() {
+	onSkipped := func(event Event) func(skipped int) {
+		return func(skipped int) {
+			es.opts.metrics.Count(
+				MetricSkippedListeners,
+				int64(skipped),
+				es.metricLabels(metrics.Label{Name: "event", Value: event.String()})...,
+			)
+		}
+	}
+	es.onAdded.onSkipped = onSkipped(EntitiesAdded)
+	es.onRemoved.onSkipped = onSkipped(EntitiesRemoved)
+	es.onUpdated.onSkipped = onSkipped(EntitiesUpdated)
+	es.onUpdatedDiff.onSkipped = onSkipped(EntitiesUpdated)
+	es.onFlushed.onSkipped = onSkipped(EntitiesFlushed)
+	es.onSizeWarn.onSkipped = onSkipped(EntitiesSizeWarning)
+	es.onQuota.onSkipped = onSkipped(EntitiesQuotaThreshold)
+}
+
+// emitCancelable emits the event with the args until the context is done, reporting the number
+// of skipped listeners. It returns whether any listener was called.
+func emitCancelable(
+	ctx context.Context,
+	t *eventemitter.EventTarget,
+	onSkipped func(skipped int),
+	args ...any,
+) bool {
+	report, err := t.EmitContext(ctx, args...)
+	if err != nil {
+		onSkipped(report.Skipped)
+	}
+	return report.Called > 0
+}
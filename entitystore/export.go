@@ -0,0 +1,292 @@
+package entitystore
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/encoder"
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+const importChunkSize = 100 // Number of entities written per import chunk.
+
+// ExportRecord is the header of an exported entity, written as a JSON line by Export.
+// It's followed by the protobuf encoding of the entity in frames, each prefixed with its
+// length as an unsigned varint, and ended by a frame of length 0.
+type ExportRecord struct {
+	Key   string `json:"key"`              // Entity key.
+	TTLMs int64  `json:"ttl_ms,omitempty"` // Remaining time to live in milliseconds at export time, or 0 if none.
+}
+
+// Export writes all entities under the parent key to the writer as ExportRecords, including the
+// remaining time to live of each entity. Entities are written with encoder.ProtoMarshalTo, so
+// entities implementing encoder.ProtoStreamMarshaler are streamed to the writer rather than
+// copied to an intermediate buffer. It returns the number of exported entities.
+//
+// The scan is configured by the ScanOptions WithChunkSize, WithCheckpoint, and WithLimiter.
+func (es *EntityStore[T, PT]) Export(ctx context.Context, parentKey string, w io.Writer, opts ...ScanOption) (int, error) {
+	if err := es.checkContentAddressing("export"); err != nil {
+		return 0, err
+	}
+	ctx = background(ctx)
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	o := newScanOptions(opts)
+	n := 0
+	err := es.scanChunks(ctx, parentKey, o, func(keys []*keyfactory.Key) error {
+		records, err := es.dsClient.GetMultiWithTTL(ctx, keys)
+		if err != nil {
+			return err
+		}
+		if err := o.limiter.Wait(ctx, 0, recordsSize(records)); err != nil {
+			return err
+		}
+		for _, r := range records {
+			entity := PT(new(T))
+			if err := es.decode(r.Key.Key(), r.Data, entity); err != nil {
+				return err
+			}
+			if err := enc.Encode(ExportRecord{Key: r.Key.Key(), TTLMs: ttlMillis(r.TTL)}); err != nil {
+				return err
+			}
+			fw := frameWriter{w: bw}
+			if err := encoder.ProtoMarshalTo(&fw, entity); err != nil {
+				return err
+			}
+			if err := fw.Close(); err != nil {
+				return err
+			}
+			n++
+		}
+		return bw.Flush() // Before the checkpoint of the chunk is saved.
+	})
+	return n, err
+}
+
+// Import adds the entities exported by Export from the reader, restoring their time to live.
+// The time to live is restored relative to the time of import.
+// It triggers the EntitiesAdded event for each written chunk, and returns the number of imported entities.
+//
+// Entities are read with encoder.ProtoUnmarshalFrom, so entities implementing
+// encoder.ProtoStreamUnmarshaler are streamed from the reader, and encoded with the store's codec.
+// An entity whose key differs from the key of its record, e.g. of another entity kind, is rejected.
+// With an authorizer, a chunk with an entity the context may not write fails the import with an
+// error wrapping ErrForbidden. Like exports, imports are tagged as background traffic (see ScanOption).
+func (es *EntityStore[T, PT]) Import(ctx context.Context, r io.Reader) (int, error) {
+	if err := es.checkContentAddressing("import"); err != nil {
+		return 0, err
+	}
+	ctx = background(ctx)
+	br := bufio.NewReader(r)
+	kb := es.NewKeyBuilder()
+	n := 0
+	records := make([]datastore.Record, 0, importChunkSize)
+	entities := make([]PT, 0, importChunkSize)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return n, err
+		}
+		if len(line) > 0 {
+			record, entity, err := es.readExportRecord(line, br)
+			if err != nil {
+				return n, fmt.Errorf("entitystore: invalid export record: %w", err)
+			}
+			kb.WithKey(record.Key)
+			key, err := kb.BuildAndReset()
+			if err != nil {
+				return n, err
+			}
+			data, err := es.encode(entity)
+			if err != nil {
+				return n, err
+			}
+			records = append(records, datastore.Record{Key: key, Data: data, TTL: time.Duration(record.TTLMs) * time.Millisecond})
+			entities = append(entities, entity)
+		}
+		if len(records) == importChunkSize || (errors.Is(err, io.EOF) && len(records) > 0) {
+			if err := es.putImported(ctx, records, entities); err != nil {
+				return n, err
+			}
+			n += len(records)
+			records, entities = records[:0], entities[:0]
+		}
+		if errors.Is(err, io.EOF) {
+			return n, nil
+		}
+	}
+}
+
+// readExportRecord parses the JSON line of an ExportRecord, and reads the framed entity that
+// follows it from the reader.
+func (es *EntityStore[T, PT]) readExportRecord(line []byte, br *bufio.Reader) (ExportRecord, PT, error) {
+	var record ExportRecord
+	if err := json.Unmarshal(line, &record); err != nil {
+		return record, nil, err
+	}
+	fr := frameReader{r: br}
+	entity := PT(new(T))
+	if err := encoder.ProtoUnmarshalFrom(&fr, entity); err != nil {
+		return record, nil, err
+	}
+	if _, err := io.Copy(io.Discard, &fr); err != nil { // Frames not read by the unmarshaler.
+		return record, nil, err
+	}
+	if entity.GetKey() != record.Key {
+		return record, nil, fmt.Errorf("entity key '%s' doesn't match record key '%s'", entity.GetKey(), record.Key)
+	}
+	return record, entity, nil
+}
+
+// putImported writes the records of the imported entities, restoring their time to live.
+func (es *EntityStore[T, PT]) putImported(ctx context.Context, records []datastore.Record, entities []PT) error {
+	entityKeys := make([]string, len(records))
+	for i, r := range records {
+		entityKeys[i] = r.Key.Key()
+	}
+	if err := es.authorize(ctx, AccessWrite, entityKeys); err != nil {
+		return err
+	}
+	if err := es.dsClient.PutMultiWithTTL(ctx, records); err != nil {
+		return err
+	}
+	if err := es.indexAdd(ctx, entities...); err != nil {
+		return err
+	}
+	es.onAdded.emit(ctx, entityKeys)
+	return nil
+}
+
+// CopyTo copies all entities under the parent key to the destination store, preserving their
+// remaining time to live. Entities are copied in their encoded form, so both stores must use
+// the same codec. It triggers the EntitiesAdded event of the destination store for each written
+// chunk, and returns the number of copied entities. Writes are authorized by the destination store
+// like imports.
+//
+// The scan is configured by the ScanOptions WithChunkSize, WithCheckpoint, and WithLimiter.
+func (es *EntityStore[T, PT]) CopyTo(
+	ctx context.Context,
+	dst *EntityStore[T, PT],
+	parentKey string,
+	opts ...ScanOption,
+) (int, error) {
+	if dst == nil {
+		return 0, errors.New("entitystore: copy destination must not be nil")
+	}
+	if es.opts.contentAddressing || dst.opts.contentAddressing {
+		return 0, fmt.Errorf("%w: copy", ErrContentAddressed)
+	}
+	ctx = background(ctx)
+	o := newScanOptions(opts)
+	n := 0
+	err := es.scanChunks(ctx, parentKey, o, func(keys []*keyfactory.Key) error {
+		records, err := es.dsClient.GetMultiWithTTL(ctx, keys)
+		if err != nil {
+			return err
+		}
+		if err := o.limiter.Wait(ctx, 0, recordsSize(records)); err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			return nil
+		}
+		kb := dst.NewKeyBuilder()
+		copied := make([]datastore.Record, len(records))
+		entities := make([]PT, len(records))
+		for i, r := range records {
+			kb.WithKey(r.Key.Key())
+			key, err := kb.BuildAndReset()
+			if err != nil {
+				return err
+			}
+			entities[i] = PT(new(T))
+			if err := dst.decode(r.Key.Key(), r.Data, entities[i]); err != nil {
+				return err
+			}
+			copied[i] = datastore.Record{Key: key, Data: r.Data, TTL: time.Duration(ttlMillis(r.TTL)) * time.Millisecond}
+		}
+		if err := dst.putImported(ctx, copied, entities); err != nil {
+			return err
+		}
+		n += len(records)
+		return nil
+	})
+	return n, err
+}
+
+// recordsSize returns the total size in bytes of the records' data.
+func recordsSize(records []datastore.Record) int {
+	n := 0
+	for _, r := range records {
+		n += len(r.Data)
+	}
+	return n
+}
+
+// ttlMillis returns the time to live in milliseconds, rounding up so a key about to expire
+// isn't restored without expiration.
+func ttlMillis(ttl time.Duration) int64 {
+	return int64((ttl + time.Millisecond - 1) / time.Millisecond)
+}
+
+// frameWriter writes each write as a frame prefixed with its length as an unsigned varint.
+// Close writes the frame of length 0 ending the frames.
+type frameWriter struct {
+	w   io.Writer
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (f *frameWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil // A frame of length 0 ends the frames.
+	}
+	n := binary.PutUvarint(f.buf[:], uint64(len(p)))
+	if _, err := f.w.Write(f.buf[:n]); err != nil {
+		return 0, err
+	}
+	return f.w.Write(p)
+}
+
+func (f *frameWriter) Close() error {
+	_, err := f.w.Write([]byte{0})
+	return err
+}
+
+// frameReader reads the frames written by a frameWriter, returning io.EOF at the frame of length 0.
+type frameReader struct {
+	r         *bufio.Reader
+	remaining uint64 // Bytes remaining in the current frame.
+	done      bool
+}
+
+func (f *frameReader) Read(p []byte) (int, error) {
+	for f.remaining == 0 {
+		if f.done {
+			return 0, io.EOF
+		}
+		n, err := binary.ReadUvarint(f.r)
+		if errors.Is(err, io.EOF) {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		f.remaining, f.done = n, n == 0
+	}
+	if uint64(len(p)) > f.remaining {
+		p = p[:f.remaining]
+	}
+	n, err := f.r.Read(p)
+	f.remaining -= uint64(n)
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
@@ -0,0 +1,224 @@
+package entitystore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/encoder"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/ratelimit"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntityStoreExportImport(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	newStore := func(t *testing.T) *EntityStore[testutil.Entity, *testutil.Entity] {
+		t.Helper()
+		store, err := New[testutil.Entity](string(keyfactory.EntityKindTest), keyfactory.GenerateRandomKey(), dsClient)
+		require.NoError(t, err)
+		return store
+	}
+	expiring := testutil.NewEntity("e-1", mockTenantId, 1)
+	persistent := testutil.NewEntity("e-2", mockTenantId, 2)
+	src := newStore(t)
+	_, err = src.Add(ctx, expiring, time.Hour)
+	require.NoError(t, err)
+	_, err = src.Add(ctx, persistent, 0)
+	require.NoError(t, err)
+
+	assertCopied := func(t *testing.T, dst *EntityStore[testutil.Entity, *testutil.Entity]) {
+		t.Helper()
+		entities, err := dst.GetAll(ctx, mockTenantKey)
+		require.NoError(t, err)
+		assert.Len(t, entities, 2)
+		kb := dst.NewKeyBuilder()
+		kb.WithKey(expiring.Key)
+		key, err := kb.BuildAndReset()
+		require.NoError(t, err)
+		assert.InDelta(t, time.Hour, server.TTL(key.RedisKey()), float64(time.Second), "should restore expiration")
+		kb.WithKey(persistent.Key)
+		key, err = kb.BuildAndReset()
+		require.NoError(t, err)
+		assert.Zero(t, server.TTL(key.RedisKey()))
+	}
+
+	t.Run("Export and import", func(t *testing.T) {
+		var buf bytes.Buffer
+		n, err := src.Export(ctx, mockTenantKey, &buf)
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+
+		dst := newStore(t)
+		var added []string
+		dst.OnAdded().AddListener(func(ctx context.Context, keys []string) {
+			added = append(added, keys...)
+		})
+		n, err = dst.Import(ctx, &buf)
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+		assert.ElementsMatch(t, []string{expiring.Key, persistent.Key}, added)
+		assertCopied(t, dst)
+	})
+
+	t.Run("Import invalid record", func(t *testing.T) {
+		_, err := newStore(t).Import(ctx, bytes.NewBufferString("{invalid"))
+		assert.Error(t, err)
+	})
+
+	t.Run("Import truncated record", func(t *testing.T) {
+		var buf bytes.Buffer
+		_, err := src.Export(ctx, mockTenantKey, &buf)
+		require.NoError(t, err)
+		_, err = newStore(t).Import(ctx, bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+
+	t.Run("Import record of another key", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, json.NewEncoder(&buf).Encode(ExportRecord{Key: persistent.Key}))
+		fw := frameWriter{w: &buf}
+		require.NoError(t, encoder.ProtoMarshalTo(&fw, &expiring))
+		require.NoError(t, fw.Close())
+		_, err := newStore(t).Import(ctx, &buf)
+		assert.ErrorContains(t, err, "doesn't match record key")
+	})
+
+	t.Run("Copy", func(t *testing.T) {
+		dst := newStore(t)
+		n, err := src.CopyTo(ctx, dst, mockTenantKey)
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+		assertCopied(t, dst)
+	})
+
+	t.Run("Export with a bandwidth limit", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		limiter := ratelimit.New(0, 10) // Less than the size of an entity per second.
+		_, err := src.Export(ctx, mockTenantKey, &bytes.Buffer{}, WithLimiter(limiter))
+		assert.ErrorIs(t, err, context.DeadlineExceeded, "should wait for the bandwidth limit")
+	})
+}
+
+// failingWriter fails all writes after the limit of writes.
+type failingWriter struct {
+	limit int
+	buf   bytes.Buffer
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.limit == 0 {
+		return 0, errors.New("disk full")
+	}
+	w.limit--
+	return w.buf.Write(p)
+}
+
+func TestEntityStoreScanCheckpoint(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+	store, err := New[testutil.Entity](string(keyfactory.EntityKindTest), keyfactory.GenerateRandomKey(), dsClient)
+	require.NoError(t, err)
+	entities := make([]testutil.Entity, 10)
+	for i := range entities {
+		entities[i] = testutil.NewEntity(fmt.Sprintf("e-%d", i), mockTenantId, 1)
+	}
+	_, err = store.AddBatch(ctx, entities, 0)
+	require.NoError(t, err)
+
+	w := &failingWriter{limit: 1} // A chunk is flushed to the writer in one write.
+	_, err = store.Export(ctx, mockTenantKey, w, WithChunkSize(3), WithCheckpoint("backup"))
+	require.Error(t, err)
+	cp, err := store.GetCheckpoint(ctx, "backup")
+	require.NoError(t, err)
+	require.NotNil(t, cp, "should persist checkpoint")
+	assert.Equal(t, 3, cp.Processed)
+	assert.Equal(t, mockTenantKey, cp.ParentKey)
+
+	t.Run("Other parent key", func(t *testing.T) {
+		_, err := store.Export(ctx, "tenant:other", &bytes.Buffer{}, WithCheckpoint("backup"))
+		assert.Error(t, err)
+	})
+
+	t.Run("Resume", func(t *testing.T) {
+		w.limit = -1 // No limit.
+		_, err = store.Export(ctx, mockTenantKey, w, WithChunkSize(3), WithCheckpoint("backup"))
+		require.NoError(t, err)
+		dst, err := New[testutil.Entity](string(keyfactory.EntityKindTest), keyfactory.GenerateRandomKey(), dsClient)
+		require.NoError(t, err)
+		_, err = dst.Import(ctx, &w.buf)
+		require.NoError(t, err)
+		imported, err := dst.GetAll(ctx, mockTenantKey)
+		require.NoError(t, err)
+		assert.Len(t, imported, len(entities), "should export all entities across runs")
+		cp, err := store.GetCheckpoint(ctx, "backup")
+		require.NoError(t, err)
+		assert.Nil(t, cp, "should remove checkpoint on completion")
+	})
+}
+
+func TestEntityStoreBackgroundPriority(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	const delay = 30 * time.Millisecond
+	dsClient, err := datastore.NewClient(rsClient, datastore.WithQoS(datastore.QoSConfig{
+		Threshold: time.Nanosecond, // Foreground traffic is always slow.
+		Delay:     delay,
+	}))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	store, err := New[testutil.Entity](string(keyfactory.EntityKindTest), keyfactory.GenerateRandomKey(), dsClient)
+	require.NoError(t, err)
+	e := testutil.NewEntity("e-1", mockTenantId, 1)
+	_, err = store.Add(ctx, e, 0)
+	require.NoError(t, err)
+	start := time.Now()
+	_, err = store.Get(ctx, e.Key)
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), delay, "should not delay foreground traffic")
+
+	jobs := map[string]func() error{
+		"Export": func() error {
+			_, err := store.Export(ctx, mockTenantKey, &bytes.Buffer{})
+			return err
+		},
+		"UpdateWhere": func() error {
+			_, err := store.UpdateWhere(ctx, mockTenantKey, func(*testutil.Entity) bool { return false }, func(*testutil.Entity) {})
+			return err
+		},
+		"Reencode": func() error {
+			_, err := store.Reencode(ctx, mockTenantKey, nil)
+			return err
+		},
+		"CheckQuality": func() error {
+			_, err := store.CheckQuality(ctx, mockTenantKey, nil)
+			return err
+		},
+		"Verify": func() error { return store.Verify(ctx) },
+	}
+	for name, job := range jobs {
+		t.Run(name, func(t *testing.T) {
+			start := time.Now()
+			require.NoError(t, job())
+			assert.GreaterOrEqual(t, time.Since(start), delay, "should delay background traffic")
+		})
+	}
+}
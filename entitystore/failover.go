@@ -0,0 +1,245 @@
+package entitystore
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultFailoverThreshold = 3                // Default number of consecutive primary outage errors that open the circuit.
+	DefaultFailoverCooldown  = 10 * time.Second // Default time the circuit stays open before the primary is probed.
+)
+
+// FailoverPolicy configures the circuit breaker of a FailoverStore.
+type FailoverPolicy struct {
+	Threshold int           // Consecutive primary outage errors that open the circuit. Defaults to DefaultFailoverThreshold.
+	Cooldown  time.Duration // Time the circuit stays open before the primary is probed. Defaults to DefaultFailoverCooldown.
+}
+
+// FailoverStore is an EntityStorer decorator that switches to a secondary store, e.g. a store of
+// another Redis, while the primary store's datastore is unavailable.
+//
+// A circuit breaker opens once the primary fails with consecutive errors wrapping
+// datastore.ErrBackendUnavailable, after which operations are served by the secondary. After the
+// cooldown the next operation probes the primary by resyncing it: the entities written to the
+// secondary while the circuit was open are copied to the primary, and entities removed from it are
+// removed from the primary. The circuit closes once the resync succeeds.
+//
+// Add, AddBatch, Remove, RemoveByKeys, Get, GetByKeys, GetAll, and Exists fail over; other
+// operations and the store events are served by the primary.
+//
+// NOTE: Resynced entities are written without expiration, and entities written to the primary by
+// other processes while the circuit was open may be overwritten by the resync.
+type FailoverStore[T Entity, PT SerializableEntity[T]] struct {
+	EntityStorer[T, PT]
+	secondary EntityStorer[T, PT]
+	policy    FailoverPolicy
+
+	mu       sync.Mutex
+	failures int                 // Consecutive primary outage errors.
+	openedAt time.Time           // Time the circuit opened, or zero if it's closed.
+	dirty    map[string]struct{} // Keys written to the secondary since the circuit opened.
+}
+
+// NewFailoverStore returns a store failing over from the primary to the secondary store.
+func NewFailoverStore[T Entity, PT SerializableEntity[T]](
+	primary EntityStorer[T, PT],
+	secondary EntityStorer[T, PT],
+	policy FailoverPolicy,
+) *FailoverStore[T, PT] {
+	if policy.Threshold <= 0 {
+		policy.Threshold = DefaultFailoverThreshold
+	}
+	if policy.Cooldown <= 0 {
+		policy.Cooldown = DefaultFailoverCooldown
+	}
+	return &FailoverStore[T, PT]{
+		EntityStorer: primary,
+		secondary:    secondary,
+		policy:       policy,
+		dirty:        make(map[string]struct{}),
+	}
+}
+
+// FailedOver reports whether the circuit is open, i.e. operations are served by the secondary.
+func (s *FailoverStore[T, PT]) FailedOver() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.openedAt.IsZero()
+}
+
+// route returns whether the operation is served by the secondary, and whether it probes the
+// primary. The primary is probed by resyncing it once the cooldown has passed.
+func (s *FailoverStore[T, PT]) route(ctx context.Context) (secondary bool, probe bool) {
+	s.mu.Lock()
+	if s.openedAt.IsZero() {
+		s.mu.Unlock()
+		return false, false
+	}
+	if time.Since(s.openedAt) < s.policy.Cooldown {
+		s.mu.Unlock()
+		return true, false
+	}
+	s.openedAt = time.Now() // Other operations keep using the secondary while probing.
+	s.mu.Unlock()
+	if err := s.Resync(ctx); err != nil {
+		return true, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.openedAt = time.Time{}
+	s.failures = 0
+	return false, true
+}
+
+// failed records the result of a primary operation, and returns whether it opened the circuit.
+// A probing operation failing with an outage error opens the circuit again.
+func (s *FailoverStore[T, PT]) failed(err error, probe bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !isUnavailable(err) {
+		s.failures = 0
+		return false
+	}
+	s.failures++
+	if (s.failures < s.policy.Threshold && !probe) || !s.openedAt.IsZero() {
+		return false
+	}
+	s.openedAt = time.Now()
+	return true
+}
+
+// markDirty records keys written to the secondary.
+func (s *FailoverStore[T, PT]) markDirty(keys ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		s.dirty[key] = struct{}{}
+	}
+}
+
+// failover runs the operation on the primary, or on the secondary while the circuit is open.
+// The keys of write operations served by the secondary are resynced to the primary.
+func failover[T Entity, PT SerializableEntity[T], V any](
+	ctx context.Context,
+	s *FailoverStore[T, PT],
+	writeKeys []string,
+	op func(store EntityStorer[T, PT]) (V, error),
+) (V, error) {
+	if secondary, probe := s.route(ctx); !secondary {
+		v, err := op(s.EntityStorer)
+		if !s.failed(err, probe) {
+			return v, err
+		}
+	}
+	v, err := op(s.secondary)
+	if err == nil && len(writeKeys) > 0 {
+		s.markDirty(writeKeys...)
+	}
+	return v, err
+}
+
+// Resync copies the entities written to the secondary while the circuit was open to the primary,
+// and removes the entities removed from the secondary from the primary.
+func (s *FailoverStore[T, PT]) Resync(ctx context.Context) error {
+	s.mu.Lock()
+	keys := make([]string, 0, len(s.dirty))
+	for key := range s.dirty {
+		keys = append(keys, key)
+	}
+	s.mu.Unlock()
+	if len(keys) == 0 {
+		return nil
+	}
+	entities, err := s.secondary.GetByKeys(ctx, keys)
+	if err != nil {
+		return err
+	}
+	found := make(map[string]struct{}, len(entities))
+	values := make([]T, len(entities))
+	for i, entity := range entities {
+		found[entity.GetKey()] = struct{}{}
+		values[i] = *entity
+	}
+	var removed []string
+	for _, key := range keys {
+		if _, ok := found[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+	if _, err := s.EntityStorer.AddBatch(ctx, values, 0); err != nil {
+		return err
+	}
+	if err := s.EntityStorer.RemoveByKeys(ctx, removed); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		delete(s.dirty, key) // Keys written during the resync stay dirty.
+	}
+	return nil
+}
+
+func (s *FailoverStore[T, PT]) Add(ctx context.Context, entity T, expiration time.Duration, opts ...CallOption) (string, error) {
+	return failover(ctx, s, writtenKeys(opts, entity.GetKey()), func(store EntityStorer[T, PT]) (string, error) {
+		return store.Add(ctx, entity, expiration, opts...)
+	})
+}
+
+func (s *FailoverStore[T, PT]) AddBatch(ctx context.Context, entities []T, expiration time.Duration) ([]string, error) {
+	keys := make([]string, len(entities))
+	for i, entity := range entities {
+		keys[i] = entity.GetKey()
+	}
+	return failover(ctx, s, keys, func(store EntityStorer[T, PT]) ([]string, error) {
+		return store.AddBatch(ctx, entities, expiration)
+	})
+}
+
+func (s *FailoverStore[T, PT]) Remove(ctx context.Context, entityKey string, opts ...CallOption) error {
+	_, err := failover(ctx, s, writtenKeys(opts, entityKey), func(store EntityStorer[T, PT]) (struct{}, error) {
+		return struct{}{}, store.Remove(ctx, entityKey, opts...)
+	})
+	return err
+}
+
+// writtenKeys returns the keys written by a call with the options, i.e. none for a dry run.
+func writtenKeys(opts []CallOption, entityKeys ...string) []string {
+	if newCallOptions(opts).dryRun {
+		return nil
+	}
+	return entityKeys
+}
+
+func (s *FailoverStore[T, PT]) RemoveByKeys(ctx context.Context, entityKeys []string) error {
+	_, err := failover(ctx, s, entityKeys, func(store EntityStorer[T, PT]) (struct{}, error) {
+		return struct{}{}, store.RemoveByKeys(ctx, entityKeys)
+	})
+	return err
+}
+
+func (s *FailoverStore[T, PT]) Get(ctx context.Context, entityKey string, opts ...CallOption) (PT, error) {
+	return failover(ctx, s, nil, func(store EntityStorer[T, PT]) (PT, error) {
+		return store.Get(ctx, entityKey, opts...)
+	})
+}
+
+func (s *FailoverStore[T, PT]) GetByKeys(ctx context.Context, entityKeys []string) ([]PT, error) {
+	return failover(ctx, s, nil, func(store EntityStorer[T, PT]) ([]PT, error) {
+		return store.GetByKeys(ctx, entityKeys)
+	})
+}
+
+func (s *FailoverStore[T, PT]) GetAll(ctx context.Context, parentKey string) ([]PT, error) {
+	return failover(ctx, s, nil, func(store EntityStorer[T, PT]) ([]PT, error) {
+		return store.GetAll(ctx, parentKey)
+	})
+}
+
+func (s *FailoverStore[T, PT]) Exists(ctx context.Context, entityKey string) (bool, error) {
+	return failover(ctx, s, nil, func(store EntityStorer[T, PT]) (bool, error) {
+		return store.Exists(ctx, entityKey)
+	})
+}
@@ -0,0 +1,58 @@
+package entitystore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailoverStore(t *testing.T) {
+	ctx := context.Background()
+	namespace := keyfactory.GenerateRandomKey()
+	newStore := func(t *testing.T) (*EntityStore[testutil.Entity, *testutil.Entity], func(), func() error) {
+		t.Helper()
+		rsClient, server := testutil.NewRedisClientWithCleanup(t)
+		dsClient, err := datastore.NewClient(rsClient)
+		require.NoError(t, err)
+		store, err := New[testutil.Entity](string(keyfactory.EntityKindTest), namespace, dsClient)
+		require.NoError(t, err)
+		return store, server.Close, server.Restart
+	}
+	primary, stopPrimary, restartPrimary := newStore(t)
+	secondary, _, _ := newStore(t)
+	store := NewFailoverStore[testutil.Entity](primary, secondary, FailoverPolicy{Threshold: 1, Cooldown: 50 * time.Millisecond})
+	e1, e2 := testutil.NewEntity("e-1", mockTenantId, 1), testutil.NewEntity("e-2", mockTenantId, 1)
+
+	_, err := store.Add(ctx, e1, 0)
+	require.NoError(t, err)
+	exists, err := primary.Exists(ctx, e1.Key)
+	require.NoError(t, err)
+	assert.True(t, exists, "should write to the primary")
+
+	stopPrimary()
+	_, err = store.Add(ctx, e2, 0)
+	require.NoError(t, err, "should fail over to the secondary")
+	assert.True(t, store.FailedOver())
+	got, err := store.Get(ctx, e2.Key)
+	require.NoError(t, err)
+	assert.Equal(t, e2.Key, got.Key)
+	require.NoError(t, store.Remove(ctx, e1.Key))
+
+	require.NoError(t, restartPrimary())
+	require.Eventually(t, func() bool { // The Redis client redials in the background.
+		_, _ = store.Exists(ctx, e2.Key)
+		return !store.FailedOver()
+	}, 5*time.Second, 50*time.Millisecond, "should switch back to the primary")
+	exists, err = primary.Exists(ctx, e2.Key)
+	require.NoError(t, err)
+	assert.True(t, exists, "should resync entities added to the secondary")
+	exists, err = primary.Exists(ctx, e1.Key)
+	require.NoError(t, err)
+	assert.False(t, exists, "should resync entities removed from the secondary")
+}
@@ -0,0 +1,62 @@
+package entitystore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+// FindKeys returns the keys of all entities under the parent key with an ID starting with the ID prefix,
+// e.g. for autocomplete-style lookups. The ID prefix may contain glob wildcards (see keyfactory.WildcardAnyChar).
+// An empty ID prefix matches all entities under the parent key.
+//
+// Entity IDs are stored in lowercase, so the prefix is matched case-insensitively.
+// Keys are scanned without blocking the datastore, but keys added or removed during the scan
+// may be missed.
+func (es *EntityStore[T, PT]) FindKeys(ctx context.Context, parentKey string, idPrefix string) ([]string, error) {
+	keyMatch, err := es.findKeyMatch(parentKey, idPrefix)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := es.dsClient.ScanKeys(ctx, keyMatch)
+	if err != nil {
+		return nil, err
+	}
+	entityKeys := make([]string, len(keys))
+	for i, key := range keys {
+		entityKeys[i] = key.Key()
+	}
+	return entityKeys, nil
+}
+
+// Find is like FindKeys, but returns the decoded entities.
+// If an entity is removed during the scan it is not included in the result.
+func (es *EntityStore[T, PT]) Find(ctx context.Context, parentKey string, idPrefix string) ([]PT, error) {
+	keyMatch, err := es.findKeyMatch(parentKey, idPrefix)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := es.dsClient.ScanKeys(ctx, keyMatch)
+	if err != nil {
+		return nil, err
+	}
+	return es.getMulti(ctx, keys)
+}
+
+// findKeyMatch returns the key pattern matching all entity IDs with the prefix under the parent key.
+func (es *EntityStore[T, PT]) findKeyMatch(parentKey string, idPrefix string) (*keyfactory.Key, error) {
+	if strings.Contains(idPrefix, keyfactory.KeyFragmentDelimiter) {
+		return nil, fmt.Errorf(
+			"entitystore: %w: id prefix '%s' must not contain delimiter '%s'",
+			keyfactory.ErrInvalidKey,
+			idPrefix,
+			keyfactory.KeyFragmentDelimiter,
+		)
+	}
+	kb := es.NewKeyBuilder()
+	kb.WithParentKey(parentKey)
+	kb.WithKey(keyfactory.BuildRedisKey(es.entityKind, strings.ToLower(idPrefix)+string(keyfactory.WildcardAnyString)))
+	return kb.BuildAndReset()
+}
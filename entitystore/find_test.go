@@ -0,0 +1,55 @@
+package entitystore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntityStoreFind(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	store, err := New[TestEntity](string(keyfactory.EntityKindTest), keyfactory.GenerateRandomKey(), dsClient)
+	require.NoError(t, err)
+	entities, keys := generateTestEntities(t, 12, mockTenantId)
+	_, err = store.AddBatch(ctx, entities, 0)
+	require.NoError(t, err)
+
+	t.Run("FindKeys", func(t *testing.T) {
+		found, err := store.FindKeys(ctx, mockTenantKey, "E-1")
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{keys[0], keys[9], keys[10], keys[11]}, found)
+
+		found, err = store.FindKeys(ctx, mockTenantKey, "")
+		require.NoError(t, err)
+		assert.ElementsMatch(t, keys, found, "should match all entities with empty prefix")
+
+		found, err = store.FindKeys(ctx, mockTenantKey, "x")
+		require.NoError(t, err)
+		assert.Empty(t, found)
+	})
+
+	t.Run("Find", func(t *testing.T) {
+		found, err := store.Find(ctx, mockTenantKey, "e-1[0-9]")
+		require.NoError(t, err)
+		ids := make([]string, len(found))
+		for i, e := range found {
+			ids[i] = e.Id
+		}
+		assert.ElementsMatch(t, []string{"e-10", "e-11", "e-12"}, ids)
+	})
+
+	t.Run("Invalid prefix", func(t *testing.T) {
+		_, err := store.FindKeys(ctx, mockTenantKey, "e-1:1")
+		assert.ErrorIs(t, err, keyfactory.ErrInvalidKey)
+	})
+}
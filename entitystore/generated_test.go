@@ -0,0 +1,69 @@
+package entitystore
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntityStoreGenerated(t *testing.T) {
+	rsClient, _ := testutil.NewRedisClientWithCleanup(t)
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	tests := map[string][]testutil.GeneratorOption{
+		"Small entities": {testutil.WithValueBytes(8)},
+		"Large values":   {testutil.WithValueBytes(1<<20 - 1024)}, // Near the default max entity size.
+		"Long IDs":       {testutil.WithIDLength(200), testutil.WithValueBytes(64)},
+		"Deep parents":   {testutil.WithParentDepth(8), testutil.WithValueBytes(64)},
+	}
+	for name, opts := range tests {
+		t.Run(name, func(t *testing.T) {
+			g := testutil.NewTestGenerator(t, opts...)
+			store, err := New[testutil.Entity](
+				string(keyfactory.EntityKindTest),
+				keyfactory.GenerateRandomKey(),
+				dsClient,
+				WithAllowFlush(),
+			)
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				require.NoError(t, store.Flush(ctx))
+			})
+			parentKey := g.ParentKey()
+			entities := g.Entities(parentKey, 20)
+			_, err = store.AddBatch(ctx, entities, 0)
+			require.NoError(t, err)
+
+			got, err := store.Get(ctx, entities[0].GetKey())
+			require.NoError(t, err)
+			assert.Equal(t, entities[0], *got)
+
+			all, err := store.GetAll(ctx, parentKey)
+			require.NoError(t, err)
+			require.Len(t, all, len(entities))
+			gotAll := make([]testutil.Entity, len(all))
+			for i, e := range all {
+				gotAll[i] = *e
+			}
+			sortByKey := func(entities []testutil.Entity) {
+				sort.Slice(entities, func(i, j int) bool { return entities[i].Key < entities[j].Key })
+			}
+			sortByKey(entities)
+			sortByKey(gotAll)
+			assert.Equal(t, entities, gotAll)
+
+			require.NoError(t, store.RemoveAll(ctx, parentKey))
+			all, err = store.GetAll(ctx, parentKey)
+			require.NoError(t, err)
+			assert.Empty(t, all)
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package entitystore
+
+import (
+	"context"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+const indexKeyPrefix = "entityindex" // Key prefix of the store entity indexes.
+
+// UpdatedAtGetter is implemented by entities with an update time, e.g. generated proto messages
+// with an updated_at field. The update time is used by the updated at index (see WithIndex).
+type UpdatedAtGetter interface {
+	GetUpdatedAt() int64
+}
+
+// keysIndexKey returns the key of the lexicographically sorted entity key index.
+func (es *EntityStore[T, PT]) keysIndexKey() *keyfactory.Key {
+	return keyfactory.NewKey(keyfactory.BuildRedisKey(indexKeyPrefix, es.entityKind, "keys"), es.namespace)
+}
+
+// updatedAtIndexKey returns the key of the entity key index sorted by update time.
+func (es *EntityStore[T, PT]) updatedAtIndexKey() *keyfactory.Key {
+	return keyfactory.NewKey(keyfactory.BuildRedisKey(indexKeyPrefix, es.entityKind, "updated"), es.namespace)
+}
+
+// hasUpdatedAt returns whether the store entities implement UpdatedAtGetter.
+func (es *EntityStore[T, PT]) hasUpdatedAt() bool {
+	_, ok := any(PT(new(T))).(UpdatedAtGetter)
+	return ok
+}
+
+// indexAdd adds the entities to the store indexes if enabled.
+func (es *EntityStore[T, PT]) indexAdd(ctx context.Context, entities ...PT) error {
+	if !es.opts.index || len(entities) == 0 {
+		return nil
+	}
+	keyMembers := make([]datastore.IndexMember, len(entities))
+	for i, e := range entities {
+		keyMembers[i] = datastore.IndexMember{Member: e.GetKey()}
+	}
+	if err := es.dsClient.IndexAdd(ctx, es.keysIndexKey(), keyMembers...); err != nil {
+		return err
+	}
+	if !es.hasUpdatedAt() {
+		return nil
+	}
+	updatedMembers := make([]datastore.IndexMember, len(entities))
+	for i, e := range entities {
+		updatedMembers[i] = datastore.IndexMember{
+			Member: e.GetKey(),
+			Score:  float64(any(e).(UpdatedAtGetter).GetUpdatedAt()),
+		}
+	}
+	return es.dsClient.IndexAdd(ctx, es.updatedAtIndexKey(), updatedMembers...)
+}
+
+// indexRemove removes the entity keys from the store indexes if enabled.
+func (es *EntityStore[T, PT]) indexRemove(ctx context.Context, entityKeys []string) error {
+	if !es.opts.index || len(entityKeys) == 0 {
+		return nil
+	}
+	if err := es.dsClient.IndexRemove(ctx, es.keysIndexKey(), entityKeys...); err != nil {
+		return err
+	}
+	if !es.hasUpdatedAt() {
+		return nil
+	}
+	return es.dsClient.IndexRemove(ctx, es.updatedAtIndexKey(), entityKeys...)
+}
+
+// indexCount returns the approximate number of entities under the parent key,
+// or -1 if the index isn't enabled. Entities nested under the entities aren't counted.
+func (es *EntityStore[T, PT]) indexCount(ctx context.Context, parentKey string) (int64, error) {
+	if !es.opts.index {
+		return -1, nil
+	}
+	prefix := keyfactory.BuildRedisKey(es.opts.keyStrategy.ParentKey(parentKey), es.entityKind) + ":"
+	if parentKey == "" {
+		prefix = es.entityKind + ":"
+	}
+	members, err := es.dsClient.IndexRangePrefix(ctx, es.keysIndexKey(), prefix)
+	if err != nil {
+		return 0, err
+	}
+	n := int64(0)
+	for _, m := range members {
+		if es.isEntityKey(parentKey, m) {
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,102 @@
+package entitystore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+const MetricLoaded = "entitystore_loaded_total" // Counter of entities loaded by GetByKeysOrLoad.
+
+// BulkLoader loads the entities of the keys, e.g. from the system of record.
+// Entities not found by the loader are omitted from the result.
+type BulkLoader[T Entity] func(ctx context.Context, entityKeys []string) ([]T, error)
+
+// GetByKeysOrLoad retrieves multiple entities by their keys from the store, and loads the entities
+// not found in the store with a single call to the loader, adding them to the store with the expiration.
+// Entities are returned in the order of the keys, omitting entities not found by the loader.
+//
+// Entities failing to decode are loaded if the store has a corrupt entity handler, otherwise their
+// decode error is returned (see WithCorruptEntityHandler).
+func (es *EntityStore[T, PT]) GetByKeysOrLoad(
+	ctx context.Context,
+	entityKeys []string,
+	loader BulkLoader[T],
+	expiration time.Duration,
+) ([]PT, error) {
+	kb := es.NewKeyBuilder()
+	keys := make([]*keyfactory.Key, 0, len(entityKeys))
+	for _, eKey := range entityKeys {
+		if eKey == "" {
+			continue // Skip empty keys.
+		}
+		kb.WithKey(eKey)
+		key, err := kb.BuildAndReset()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, nil // No-op for empty slice of keys.
+	}
+	data, err := es.getMultiAligned(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	es.countReads(data)
+
+	found := make(map[string]PT, len(keys))
+	var missing []string
+	for i, d := range data {
+		entityKey := keys[i].Key()
+		if _, ok := found[entityKey]; ok {
+			continue // Duplicate key.
+		}
+		if d != nil {
+			entity := PT(new(T))
+			err := es.decode(entityKey, d, entity)
+			if err == nil {
+				found[entityKey] = entity
+				continue
+			}
+			err = fmt.Errorf("entitystore: failed to decode entity '%s': %w", entityKey, err)
+			if es.opts.corruptEntityHandler == nil {
+				return nil, err
+			}
+			es.handleCorruptEntity(ctx, keys[i], len(d), err)
+		}
+		found[entityKey] = nil
+		missing = append(missing, entityKey)
+	}
+
+	if len(missing) > 0 {
+		loaded, err := loader(ctx, missing)
+		if err != nil {
+			return nil, fmt.Errorf("entitystore: load entities: %w", err)
+		}
+		for i := range loaded {
+			entityKey := loaded[i].GetKey()
+			if e, ok := found[entityKey]; !ok || e != nil {
+				return nil, fmt.Errorf("entitystore: loader returned unrequested or duplicate entity '%s'", entityKey)
+			}
+			found[entityKey] = PT(&loaded[i])
+		}
+		if len(loaded) > 0 {
+			if _, err := es.AddBatch(ctx, loaded, expiration); err != nil {
+				return nil, err
+			}
+		}
+		es.opts.metrics.Count(MetricLoaded, int64(len(loaded)), es.metricLabels()...)
+	}
+
+	entities := make([]PT, 0, len(keys))
+	for _, key := range keys {
+		if e := found[key.Key()]; e != nil {
+			entities = append(entities, e)
+		}
+	}
+	return entities, nil
+}
@@ -0,0 +1,68 @@
+package entitystore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/metrics"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntityStoreGetByKeysOrLoad(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	recorder := metrics.NewMemoryRecorder()
+	store, err := New[testutil.Entity](
+		string(keyfactory.EntityKindTest),
+		keyfactory.GenerateRandomKey(),
+		dsClient,
+		WithMetrics(recorder),
+	)
+	require.NoError(t, err)
+	e1, e2, e3 := testutil.NewEntity("e-1", mockTenantId, 1), testutil.NewEntity("e-2", mockTenantId, 1), testutil.NewEntity("e-3", mockTenantId, 1)
+	_, err = store.Add(ctx, e1, 0)
+	require.NoError(t, err)
+
+	var calls [][]string
+	loader := func(ctx context.Context, entityKeys []string) ([]testutil.Entity, error) {
+		calls = append(calls, entityKeys)
+		return []testutil.Entity{e2}, nil // e-3 isn't found.
+	}
+	entities, err := store.GetByKeysOrLoad(ctx, []string{e3.Key, e2.Key, e1.Key}, loader, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []*testutil.Entity{&e2, &e1}, entities, "should return entities in key order")
+	assert.Equal(t, [][]string{{e3.Key, e2.Key}}, calls, "should load all misses at once")
+	assert.Equal(t, int64(1), recorder.Counter(MetricLoaded, metrics.Label{Name: "kind", Value: string(keyfactory.EntityKindTest)}))
+
+	exists, err := store.Exists(ctx, e2.Key)
+	require.NoError(t, err)
+	assert.True(t, exists, "should write back loaded entities")
+	calls = nil
+	_, err = store.GetByKeysOrLoad(ctx, []string{e1.Key, e2.Key}, loader, 0)
+	require.NoError(t, err)
+	assert.Empty(t, calls, "should not load entities found in the store")
+
+	t.Run("Should fail on loader errors", func(t *testing.T) {
+		errLoad := errors.New("load failed")
+		_, err := store.GetByKeysOrLoad(ctx, []string{e3.Key}, func(context.Context, []string) ([]testutil.Entity, error) {
+			return nil, errLoad
+		}, 0)
+		assert.ErrorIs(t, err, errLoad)
+	})
+
+	t.Run("Should fail on unrequested entities", func(t *testing.T) {
+		_, err := store.GetByKeysOrLoad(ctx, []string{e3.Key}, func(context.Context, []string) ([]testutil.Entity, error) {
+			return []testutil.Entity{testutil.NewEntity("e-4", mockTenantId, 1)}, nil
+		}, 0)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,189 @@
+package entitystore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/holmberd/go-entitystore/eventemitter"
+)
+
+const DefaultMemoSize = 1000 // Default max number of key sets memoized by a MemoizingStore.
+
+// memoEntry is the result of a memoized GetByKeys call.
+type memoEntry[PT any] struct {
+	keys      []string      // Sorted unique entity keys of the call.
+	entities  map[string]PT // Entities of the call by key, without the keys not found.
+	expiresAt time.Time
+}
+
+// MemoizingStore is an EntityStorer decorator memoizing GetByKeys results for a short time, e.g. for
+// hot dashboards repeatedly reading the same entities. Results are memoized by the hash of the
+// sorted set of keys, and invalidated by any added, updated, or removed event of one of the keys,
+// or a flushed event. Other operations are passed through to the store.
+//
+// NOTE: Memoized results are local to the process, and writes by other processes aren't observed
+// until the results expire. Memoized entities are shared between calls, and must not be modified.
+type MemoizingStore[T Entity, PT SerializableEntity[T]] struct {
+	EntityStorer[T, PT]
+	ttl     time.Duration
+	maxSize int
+
+	mu         sync.Mutex
+	entries    map[string]*memoEntry[PT]      // By key set hash.
+	byKey      map[string]map[string]struct{} // Key set hashes by entity key.
+	generation uint64                         // Incremented on each invalidation.
+	tokens     map[*eventTarget]eventemitter.ListenerToken
+}
+
+// NewMemoizingStore returns a store memoizing the GetByKeys results of the store for the TTL,
+// keeping at most DefaultMemoSize results. Close must be called to stop observing the store events.
+func NewMemoizingStore[T Entity, PT SerializableEntity[T]](
+	store EntityStorer[T, PT],
+	ttl time.Duration,
+) *MemoizingStore[T, PT] {
+	s := &MemoizingStore[T, PT]{
+		EntityStorer: store,
+		ttl:          ttl,
+		maxSize:      DefaultMemoSize,
+		entries:      make(map[string]*memoEntry[PT]),
+		byKey:        make(map[string]map[string]struct{}),
+		tokens:       make(map[*eventTarget]eventemitter.ListenerToken),
+	}
+	for _, target := range []*eventTarget{store.OnAdded(), store.OnUpdated(), store.OnRemoved()} {
+		s.tokens[target] = target.AddListener(func(ctx context.Context, keys []string) {
+			s.invalidate(keys)
+		})
+	}
+	flushed := store.OnFlushed()
+	s.tokens[flushed] = flushed.AddListener(func(ctx context.Context, keys []string) {
+		s.Reset()
+	})
+	return s
+}
+
+// Close stops observing the store events and drops the memoized results.
+func (s *MemoizingStore[T, PT]) Close() {
+	s.mu.Lock()
+	tokens := s.tokens
+	s.tokens = nil
+	s.mu.Unlock()
+	for target, token := range tokens {
+		target.RemoveListener(token)
+	}
+	s.Reset()
+}
+
+// Reset drops the memoized results.
+func (s *MemoizingStore[T, PT]) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = make(map[string]*memoEntry[PT])
+	s.byKey = make(map[string]map[string]struct{})
+	s.generation++
+}
+
+// keySetHash returns the sorted unique non-empty entity keys, and the hash of the key set.
+func keySetHash(entityKeys []string) ([]string, string) {
+	keys := make([]string, 0, len(entityKeys))
+	for _, key := range entityKeys {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	keys = slices.Compact(keys)
+	h := sha256.New()
+	for _, key := range keys {
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+	}
+	return keys, hex.EncodeToString(h.Sum(nil))
+}
+
+func (s *MemoizingStore[T, PT]) GetByKeys(ctx context.Context, entityKeys []string) ([]PT, error) {
+	keys, hash := keySetHash(entityKeys)
+	if len(keys) == 0 {
+		return s.EntityStorer.GetByKeys(ctx, entityKeys)
+	}
+	now := time.Now()
+	s.mu.Lock()
+	entry, ok := s.entries[hash]
+	if ok && now.After(entry.expiresAt) {
+		s.remove(hash, entry)
+		ok = false
+	}
+	generation := s.generation
+	s.mu.Unlock()
+	if ok {
+		entities := make([]PT, 0, len(entityKeys))
+		for _, key := range entityKeys {
+			if entity, found := entry.entities[key]; found {
+				entities = append(entities, entity)
+			}
+		}
+		return entities, nil
+	}
+
+	entities, err := s.EntityStorer.GetByKeys(ctx, entityKeys)
+	if err != nil {
+		return nil, err
+	}
+	entry = &memoEntry[PT]{keys: keys, entities: make(map[string]PT, len(entities)), expiresAt: now.Add(s.ttl)}
+	for _, entity := range entities {
+		entry.entities[entity.GetKey()] = entity
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.generation != generation || s.tokens == nil {
+		return entities, nil // Invalidated during the read, or closed; the result may be stale.
+	}
+	if len(s.entries) >= s.maxSize {
+		s.removeExpired(now)
+	}
+	if len(s.entries) < s.maxSize {
+		s.entries[hash] = entry
+		for _, key := range keys {
+			if s.byKey[key] == nil {
+				s.byKey[key] = make(map[string]struct{})
+			}
+			s.byKey[key][hash] = struct{}{}
+		}
+	}
+	return entities, nil
+}
+
+// invalidate drops the memoized results of key sets overlapping the entity keys.
+func (s *MemoizingStore[T, PT]) invalidate(entityKeys []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generation++
+	for _, key := range entityKeys {
+		for hash := range s.byKey[key] {
+			s.remove(hash, s.entries[hash])
+		}
+	}
+}
+
+// removeExpired drops the expired memoized results.
+func (s *MemoizingStore[T, PT]) removeExpired(now time.Time) {
+	for hash, entry := range s.entries {
+		if now.After(entry.expiresAt) {
+			s.remove(hash, entry)
+		}
+	}
+}
+
+// remove drops the memoized result of the key set hash. Must be called with the lock held.
+func (s *MemoizingStore[T, PT]) remove(hash string, entry *memoEntry[PT]) {
+	delete(s.entries, hash)
+	for _, key := range entry.keys {
+		delete(s.byKey[key], hash)
+		if len(s.byKey[key]) == 0 {
+			delete(s.byKey, key)
+		}
+	}
+}
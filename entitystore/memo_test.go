@@ -0,0 +1,74 @@
+package entitystore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoizingStore(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	store, err := New[testutil.Entity](string(keyfactory.EntityKindTest), keyfactory.GenerateRandomKey(), dsClient)
+	require.NoError(t, err)
+	e1, e2, e3 := testutil.NewEntity("e-1", mockTenantId, 1), testutil.NewEntity("e-2", mockTenantId, 1), testutil.NewEntity("e-3", mockTenantId, 1)
+	_, err = store.AddBatch(ctx, []testutil.Entity{e1, e2, e3}, 0)
+	require.NoError(t, err)
+
+	memo := NewMemoizingStore[testutil.Entity](store, time.Minute)
+	defer memo.Close()
+	keys := func(entities []*testutil.Entity) []string {
+		var keys []string
+		for _, e := range entities {
+			keys = append(keys, e.Key)
+		}
+		return keys
+	}
+
+	t.Run("Should memoize results by key set", func(t *testing.T) {
+		entities, err := memo.GetByKeys(ctx, []string{e1.Key, e2.Key})
+		require.NoError(t, err)
+		assert.Equal(t, []string{e1.Key, e2.Key}, keys(entities))
+		_, err = memo.GetByKeys(ctx, []string{e3.Key})
+		require.NoError(t, err)
+
+		server.FlushAll() // Not observed by the store events.
+		entities, err = memo.GetByKeys(ctx, []string{e2.Key, e1.Key, e2.Key})
+		require.NoError(t, err)
+		assert.Equal(t, []string{e2.Key, e1.Key, e2.Key}, keys(entities), "should keep order of keys")
+	})
+
+	t.Run("Should invalidate overlapping key sets", func(t *testing.T) {
+		_, err := store.Add(ctx, e1, 0)
+		require.NoError(t, err)
+		entities, err := memo.GetByKeys(ctx, []string{e1.Key, e2.Key})
+		require.NoError(t, err)
+		assert.Equal(t, []string{e1.Key}, keys(entities))
+		entities, err = memo.GetByKeys(ctx, []string{e3.Key})
+		require.NoError(t, err)
+		assert.Len(t, entities, 1, "should keep non-overlapping key sets")
+	})
+
+	t.Run("Should expire results", func(t *testing.T) {
+		short := NewMemoizingStore[testutil.Entity](store, time.Millisecond)
+		defer short.Close()
+		entities, err := short.GetByKeys(ctx, []string{e1.Key})
+		require.NoError(t, err)
+		require.Len(t, entities, 1)
+		server.FlushAll()
+		time.Sleep(5 * time.Millisecond)
+		entities, err = short.GetByKeys(ctx, []string{e1.Key})
+		require.NoError(t, err)
+		assert.Empty(t, entities)
+	})
+}
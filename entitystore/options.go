@@ -0,0 +1,375 @@
+package entitystore
+
+import (
+	"log"
+	"slices"
+
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/metrics"
+)
+
+// Option configures an EntityStore.
+type Option func(*options)
+
+type options struct {
+	corruptionHandler       func(err error)
+	corruptEntityHandler    CorruptEntityHandler
+	quarantineNamespace     string
+	checksum                bool
+	deterministicEncoding   bool
+	contentAddressing       bool
+	maxEntitySize           int
+	largeEntityThreshold    int
+	metrics                 metrics.Recorder
+	namespaceLabel          bool
+	allowFlush              bool
+	minPageFill             int
+	maxPageSize             int
+	getAllLimit             int
+	index                   bool
+	updateDiffs             bool
+	dedup                   DedupPolicy
+	cancelableEvents        bool
+	removedEventsForMissing bool
+	unscopedRemoveAll       bool
+	parentKeyFunc           ParentKeyFunc
+	collisionDetection      bool
+	keyStrategy             keyfactory.KeyStrategy
+	keyring                 *Keyring
+	changeLogMaxLen         int64
+	authorizer              Authorizer
+	quotaLimit              int64
+	quotaThresholds         []int
+	onAdded                 EntityStoreListener
+	onUpdated               EntityStoreListener
+	onRemoved               EntityStoreListener
+}
+
+func defaultOptions() options {
+	return options{
+		corruptionHandler: logCorruption,
+		maxEntitySize:     DefaultMaxEntitySize,
+		maxPageSize:       DefaultMaxPageSize,
+		metrics:           metrics.NopRecorder{},
+		keyStrategy:       keyfactory.PlainKeyStrategy{},
+	}
+}
+
+// logCorruption is the default corruption handler.
+func logCorruption(err error) {
+	log.Printf("entitystore: %v", err)
+}
+
+// WithCorruptionHandler sets the handler called when the store encounters an unexpected state,
+// e.g. malformed event arguments. By default the error is logged.
+func WithCorruptionHandler(h func(err error)) Option {
+	return func(o *options) {
+		if h != nil {
+			o.corruptionHandler = h
+		}
+	}
+}
+
+// WithCorruptEntityHandler enables skipping entities that fail to decode in multi-entity reads
+// (GetByKeys, GetWithPagination, GetAll). Each skipped entity is reported to the handler.
+// By default a corrupt entity fails the whole read.
+func WithCorruptEntityHandler(h CorruptEntityHandler) Option {
+	return func(o *options) {
+		o.corruptEntityHandler = h
+	}
+}
+
+// WithQuarantineNamespace moves entities skipped by the corrupt entity handler to the
+// namespace for offline inspection. Requires WithCorruptEntityHandler.
+func WithQuarantineNamespace(namespace string) Option {
+	return func(o *options) {
+		o.quarantineNamespace = namespace
+	}
+}
+
+// WithChecksum appends a CRC32 checksum to stored values and verifies it on read.
+// A value failing verification returns an error wrapping datastore.ErrCorruptedData.
+//
+// NOTE: Values written without checksum can't be read by a store with checksum enabled, and vice versa.
+func WithChecksum() Option {
+	return func(o *options) {
+		o.checksum = true
+	}
+}
+
+// WithDeterministicEncoding marshals entities implementing encoder.ProtoDeterministicMarshaler
+// with their deterministic encoding, so equal entities always produce equal values across
+// processes, e.g. for stable checksums and so UpdateWhere and Reencode skip unchanged entities.
+func WithDeterministicEncoding() Option {
+	return func(o *options) {
+		o.deterministicEncoding = true
+	}
+}
+
+// WithContentAddressing stores each distinct encoded entity once under its content hash, with the
+// entity keys pointing to it and a reference count releasing it when its last entity is removed,
+// e.g. for kinds with many identical entities like shared templates. Only entities with equal
+// encodings share storage, so the encoding of such kinds should exclude per-entity fields, e.g. the
+// key. Use WithDeterministicEncoding so equal entities are stored once regardless of the process
+// encoding them. Reads resolve entities stored without content addressing as is.
+//
+// Entities are decoded without their key if their encoding excludes it, so such entities should
+// implement KeySetter to have their key restored on reads.
+//
+// Operations rewriting stored values in place, e.g. Update, UpdateWhere, Reencode, RemoveIf,
+// TouchIfLonger, Export, Import, and CopyTo, and writes with an expiration, fail with an error
+// wrapping ErrContentAddressed. Expiring entity keys would leak the references of their shared data.
+//
+// NOTE: Content addressing can't be combined with encryption, since encryption isn't
+// deterministic, and isn't supported for Redis Cluster.
+func WithContentAddressing() Option {
+	return func(o *options) {
+		o.contentAddressing = true
+	}
+}
+
+// WithMaxEntitySize sets the max size in bytes of a serialized entity written by the store.
+// Writes of larger entities fail with an EntityTooLargeError. A size <= 0 disables the limit.
+// Defaults to DefaultMaxEntitySize.
+func WithMaxEntitySize(size int) Option {
+	return func(o *options) {
+		o.maxEntitySize = size
+	}
+}
+
+// WithLargeEntityThreshold sets the size in bytes above which a written entity is logged and
+// reported by the EntitiesSizeWarning event. A threshold <= 0 disables the warning (default).
+func WithLargeEntityThreshold(size int) Option {
+	return func(o *options) {
+		o.largeEntityThreshold = size
+	}
+}
+
+// WithMetrics sets the recorder for store metrics. By default metrics are discarded.
+func WithMetrics(r metrics.Recorder) Option {
+	return func(o *options) {
+		if r != nil {
+			o.metrics = r
+		}
+	}
+}
+
+// WithNamespaceMetricLabel adds the store namespace as the "namespace" label of store metrics,
+// in addition to the "kind" label. Namespaces can be unbounded, e.g. per tenant, so consider
+// bounding the label values with metrics.LimitCardinality.
+func WithNamespaceMetricLabel() Option {
+	return func(o *options) {
+		o.namespaceLabel = true
+	}
+}
+
+// WithAllowFlush allows the store to be flushed with Flush.
+// Flushing deletes all keys in the store key namespace and requires the namespace to be set.
+func WithAllowFlush() Option {
+	return func(o *options) {
+		o.allowFlush = true
+	}
+}
+
+// WithMinPageFill makes GetWithPagination keep scanning until a page has at least n entities
+// or the cursor is exhausted, instead of returning the possibly near-empty result of a single scan.
+// The fill is capped at the page limit. A value <= 0 disables page filling (default).
+func WithMinPageFill(n int) Option {
+	return func(o *options) {
+		o.minPageFill = n
+	}
+}
+
+// WithMaxPageSize sets the max number of keys scanned per GetWithPagination page.
+// Larger limits requested by callers are capped to the size. Defaults to DefaultMaxPageSize.
+//
+// NOTE: The datastore client caps pages to its own max page size (see datastore.WithMaxPageSize).
+func WithMaxPageSize(size int) Option {
+	return func(o *options) {
+		if size > 0 {
+			o.maxPageSize = size
+		}
+	}
+}
+
+// WithGetAllLimit sets the max number of entities GetAll retrieves. GetAll fails with
+// ErrTooManyEntities if more entities match, guarding against unbounded reads.
+// A limit <= 0 disables the cap (default).
+func WithGetAllLimit(limit int) Option {
+	return func(o *options) {
+		o.getAllLimit = limit
+	}
+}
+
+// WithIndex maintains a sorted set index of the entity keys in the store, used to report the
+// approximate total number of entities in GetWithPagination results.
+//
+// The index is updated after each write, so it's not atomic with the write, and expired entities
+// remain in the index until removed through the store.
+func WithIndex() Option {
+	return func(o *options) {
+		o.index = true
+	}
+}
+
+// WithUpdateDiffs makes the store read the stored entity before each write, and emit the
+// EntitiesUpdated events when a write replaces an existing entity, including the field-level
+// changes to OnUpdatedDiff listeners (see Diff).
+//
+// NOTE: This adds a read to every write, and the read isn't atomic with the write.
+func WithUpdateDiffs() Option {
+	return func(o *options) {
+		o.updateDiffs = true
+	}
+}
+
+// WithBatchDedup sets the handling of entities with duplicate keys in batch adds.
+// Dropped duplicates are counted by the MetricBatchDuplicates metric. Defaults to DedupNone.
+func WithBatchDedup(p DedupPolicy) Option {
+	return func(o *options) {
+		o.dedup = p
+	}
+}
+
+// WithListeners registers the added, updated, and removed event listeners when the store is
+// created, so no mutation can happen before the listeners are registered. A nil listener is ignored.
+func WithListeners(onAdded, onUpdated, onRemoved EntityStoreListener) Option {
+	return func(o *options) {
+		o.onAdded = onAdded
+		o.onUpdated = onUpdated
+		o.onRemoved = onRemoved
+	}
+}
+
+// WithCancelableEvents makes the store skip the remaining event listeners once the context of
+// the mutation is done, so cancelled requests don't keep running listeners. Skipped listeners are
+// counted by the MetricSkippedListeners metric.
+//
+// NOTE: Listeners relied on for consistency, e.g. cache invalidation, may miss events.
+func WithCancelableEvents() Option {
+	return func(o *options) {
+		o.cancelableEvents = true
+	}
+}
+
+// WithRemovedEventsForMissingKeys makes removals trigger the EntitiesRemoved event with all
+// requested keys, including keys of entities that didn't exist, as in earlier versions.
+// By default the event only includes the keys of entities actually removed, and isn't triggered
+// if none were.
+func WithRemovedEventsForMissingKeys() Option {
+	return func(o *options) {
+		o.removedEventsForMissing = true
+	}
+}
+
+// WithUnscopedRemoveAll allows RemoveAll with an empty parent key, removing all entities without
+// a parent key, as in earlier versions.
+func WithUnscopedRemoveAll() Option {
+	return func(o *options) {
+		o.unscopedRemoveAll = true
+	}
+}
+
+// WithParentKeyCheck makes Add, AddAndGetPrevious, AddBatch, and AddBatchPartial verify that each
+// entity key is under the parent key returned by the function for the write's context, catching
+// keys constructed for the wrong parent, e.g. another tenant, at write time.
+// Writes of entities under another parent fail with an error wrapping ErrParentKeyMismatch.
+//
+// Example, for a store used by a single tenant:
+//
+//	entitystore.WithParentKeyCheck(func(context.Context) string { return tenantKey })
+func WithParentKeyCheck(fn ParentKeyFunc) Option {
+	return func(o *options) {
+		o.parentKeyFunc = fn
+	}
+}
+
+// WithKeyStrategy sets the layout of entity keys, e.g. keyfactory.HashedKeyStrategy.
+// Keys returned by EntityKey are laid out by the strategy, and parent keys passed to the store
+// are laid out by the strategy when matching the keys of their entities.
+// Defaults to keyfactory.PlainKeyStrategy.
+//
+// NOTE: Changing the strategy of a store with existing entities requires migrating their keys.
+func WithKeyStrategy(s keyfactory.KeyStrategy) Option {
+	return func(o *options) {
+		if s != nil {
+			o.keyStrategy = s
+		}
+	}
+}
+
+// WithCollisionDetection makes Add, AddAndGetPrevious, AddBatch, and AddBatchPartial check that
+// the value stored under each entity key is the same entity, catching faulty GetKey
+// implementations before they silently overwrite unrelated entities.
+// Entities are the same if their IDs match, see IdentifiableEntity, or else their keys.
+// Writes that would overwrite another entity fail with an error wrapping ErrKeyCollision,
+// which is also reported to the corruption handler.
+//
+// NOTE: Each write reads the stored values first, use it as a debug or strict mode.
+func WithCollisionDetection() Option {
+	return func(o *options) {
+		o.collisionDetection = true
+	}
+}
+
+// WithEncryption encrypts stored values with the current key of the keyring using AES-GCM, and
+// decrypts them with the key they were encrypted with. Values are bound to their entity key, so a
+// value copied to another entity key fails to decrypt with an error wrapping
+// datastore.ErrCorruptedData. Use RotateEncryptionKey to re-encrypt values after a key rotation.
+//
+// NOTE: Values written without encryption can't be read by a store with encryption enabled,
+// migrate them with Reencode.
+func WithEncryption(kr *Keyring) Option {
+	return func(o *options) {
+		o.keyring = kr
+	}
+}
+
+// WithChangeLog appends the store events to a change log stored as a Redis Stream in the key
+// namespace, trimmed to about the max number of entries, so consumers can read and replay the
+// events of all stores sharing the change log (see ReadChangeLog and ReplayChangeLog).
+//
+// NOTE: Events skipped by the call options (see SkipEvents) aren't appended to the change log.
+func WithChangeLog(maxLen int64) Option {
+	return func(o *options) {
+		if maxLen > 0 {
+			o.changeLogMaxLen = maxLen
+		}
+	}
+}
+
+// WithAuthorizer checks the access of each keyed read, e.g. by Get, GetByKeys, and Exists, and each
+// write, e.g. by Add, AddBatch, PublishVersion, SetACL, TouchIfLonger, the removals, Import, and
+// the writes of UpdateWhere and Reencode, against the ACLs of the entities with the authorizer, e.g.
+// ACLAuthorizer, so per-entity sharing is enforced at the store layer. Accesses denied by the
+// authorizer fail with an error wrapping ErrForbidden, or are reported per entity by the partial
+// batches and as denied by UpdateWhere and Reencode. Entity ACLs are set with SetACL.
+//
+// NOTE: Reads of scans, e.g. GetAll, GetWithPagination, and Export, aren't checked, and ACLs of
+// expired entities aren't removed.
+func WithAuthorizer(a Authorizer) Option {
+	return func(o *options) {
+		o.authorizer = a
+	}
+}
+
+// WithQuotaWarnings sets a soft quota of the max number of entities under each parent key, e.g.
+// per tenant, and triggers the OnQuotaThreshold event when a write makes the entities under a
+// parent key reach a threshold percentage of the quota, so customers can be warned before the
+// quota is enforced. Defaults to DefaultQuotaThresholds. Writes aren't limited by the quota.
+//
+// Entities are counted by the index, so the store requires WithIndex. Each threshold triggers the
+// event once per store instance, until removals through the store make the entities under the
+// parent key drop below it again, or the parent key is evicted (see MaxQuotaTrackedParents).
+func WithQuotaWarnings(limit int64, thresholds ...int) Option {
+	return func(o *options) {
+		if limit <= 0 {
+			return
+		}
+		if len(thresholds) == 0 {
+			thresholds = DefaultQuotaThresholds
+		}
+		o.quotaLimit = limit
+		o.quotaThresholds = slices.Sorted(slices.Values(thresholds))
+	}
+}
@@ -0,0 +1,28 @@
+package entitystore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ParentKeyFunc returns the parent key that entities written with the context must be under,
+// e.g. the key of the tenant of the request, or an empty key to skip the check.
+type ParentKeyFunc func(ctx context.Context) string
+
+// checkParentKey returns an error wrapping ErrParentKeyMismatch if the entity key isn't under
+// the parent key expected for the context (see WithParentKeyCheck).
+func (es *EntityStore[T, PT]) checkParentKey(ctx context.Context, entityKey string) error {
+	if es.opts.parentKeyFunc == nil {
+		return nil
+	}
+	parentKey := es.opts.parentKeyFunc(ctx)
+	if parentKey == "" {
+		return nil
+	}
+	parentKey = es.opts.keyStrategy.ParentKey(parentKey)
+	if strings.HasPrefix(entityKey, parentKey+":") {
+		return nil
+	}
+	return fmt.Errorf("%w: entity '%s' isn't under parent '%s'", ErrParentKeyMismatch, entityKey, parentKey)
+}
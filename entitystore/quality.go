@@ -0,0 +1,145 @@
+package entitystore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+// RuleDecode is the name of the rule reported for entities that fail to decode by CheckQuality.
+const RuleDecode = "decode"
+
+const defaultMaxQualityExamples = 10 // Default number of example violations reported per rule.
+
+// QualityRule is a named data quality rule checked by CheckQuality, e.g. for missing fields or
+// invalid references. Check returns an error describing the violation if the entity violates the rule.
+type QualityRule[PT any] struct {
+	Name  string
+	Check func(ctx context.Context, entity PT) error
+}
+
+// UpdatedBefore returns a rule violated by entities with an update time before the cutoff,
+// in the unit of the entity update time (see UpdatedAtGetter). Entities without an update time
+// violate the rule.
+func UpdatedBefore[PT any](name string, cutoff int64) QualityRule[PT] {
+	return QualityRule[PT]{
+		Name: name,
+		Check: func(_ context.Context, entity PT) error {
+			getter, ok := any(entity).(UpdatedAtGetter)
+			if !ok {
+				return fmt.Errorf("entity %T doesn't implement UpdatedAtGetter", entity)
+			}
+			if updatedAt := getter.GetUpdatedAt(); updatedAt < cutoff {
+				return fmt.Errorf("updated at %d before %d", updatedAt, cutoff)
+			}
+			return nil
+		},
+	}
+}
+
+// QualityViolation is an entity violating a quality rule.
+type QualityViolation struct {
+	Key  string // Entity key.
+	Rule string // Name of the violated rule.
+	Err  error  // Violation returned by the rule.
+}
+
+// QualityReport is the data quality report of the entities under a parent key, e.g. a tenant.
+type QualityReport struct {
+	ParentKey  string             // Parent key of the checked entities.
+	Scanned    int                // Number of entities scanned.
+	Failed     int                // Number of entities violating at least one rule.
+	Violations map[string]int     // Number of entities violating each rule by rule name.
+	Examples   []QualityViolation // The first violations of each rule, see WithMaxExamples.
+}
+
+// QualityOption configures a CheckQuality call.
+type QualityOption func(*qualityOptions)
+
+type qualityOptions struct {
+	maxExamples int
+	scanOpts    []ScanOption
+}
+
+// WithMaxExamples sets the number of example violations reported per rule.
+func WithMaxExamples(n int) QualityOption {
+	return func(o *qualityOptions) {
+		if n >= 0 {
+			o.maxExamples = n
+		}
+	}
+}
+
+// WithQualityScan sets the options of the scan of the checked entities, e.g. WithRateLimit.
+func WithQualityScan(opts ...ScanOption) QualityOption {
+	return func(o *qualityOptions) {
+		o.scanOpts = append(o.scanOpts, opts...)
+	}
+}
+
+// CheckQuality scans all entities under the parent key in chunks and checks each entity against
+// the rules, returning a report of the violations. Entities that fail to decode are reported as
+// violations of the RuleDecode rule, instead of failing the scan.
+//
+// Entities are scanned without blocking the datastore, but entities added or removed during the
+// scan may be missed. The scan is tagged as background traffic (see ScanOption).
+func (es *EntityStore[T, PT]) CheckQuality(
+	ctx context.Context,
+	parentKey string,
+	rules []QualityRule[PT],
+	opts ...QualityOption,
+) (QualityReport, error) {
+	ctx = background(ctx)
+	o := qualityOptions{maxExamples: defaultMaxQualityExamples}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	for _, rule := range rules {
+		if rule.Name == "" || rule.Name == RuleDecode || rule.Check == nil {
+			return QualityReport{}, fmt.Errorf("entitystore: invalid quality rule '%s'", rule.Name)
+		}
+	}
+	report := QualityReport{ParentKey: parentKey, Violations: make(map[string]int)}
+	violate := func(v QualityViolation) {
+		report.Violations[v.Rule]++
+		if report.Violations[v.Rule] <= o.maxExamples {
+			report.Examples = append(report.Examples, v)
+		}
+	}
+	so := newScanOptions(o.scanOpts)
+	err := es.scanChunks(ctx, parentKey, so, func(keys []*keyfactory.Key) error {
+		data, err := es.getMultiAligned(ctx, keys)
+		if err != nil {
+			return err
+		}
+		if err := so.limiter.Wait(ctx, 0, dataSize(data)); err != nil {
+			return err
+		}
+		for i, d := range data {
+			if d == nil {
+				continue // Removed since the scan.
+			}
+			report.Scanned++
+			entityKey := keys[i].Key()
+			entity := PT(new(T))
+			if err := es.decode(entityKey, d, entity); err != nil {
+				report.Failed++
+				violate(QualityViolation{Key: entityKey, Rule: RuleDecode, Err: err})
+				continue
+			}
+			failed := false
+			for _, rule := range rules {
+				if err := rule.Check(ctx, entity); err != nil {
+					failed = true
+					violate(QualityViolation{Key: entityKey, Rule: rule.Name, Err: err})
+				}
+			}
+			if failed {
+				report.Failed++
+			}
+		}
+		return nil
+	})
+	return report, err
+}
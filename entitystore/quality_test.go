@@ -0,0 +1,71 @@
+package entitystore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntityStoreCheckQuality(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	namespace := keyfactory.GenerateRandomKey()
+	store, err := New[TestEntity](string(keyfactory.EntityKindTest), namespace, dsClient)
+	require.NoError(t, err)
+	entities, keys := generateTestEntities(t, 4, mockTenantId)
+	entities[1].UpdatedAt = 1
+	entities[3].UpdatedAt = 1
+	_, err = store.AddBatch(ctx, entities, 0)
+	require.NoError(t, err)
+	corruptKey, err := keyfactory.NewEntityKey(keyfactory.EntityKindTest, "e-5", "1", mockTenantKey)
+	require.NoError(t, err)
+	require.NoError(t, dsClient.Put(ctx, keyfactory.NewKey(corruptKey, namespace), []byte{0xff}, 0))
+
+	known := map[string]bool{"e-1": true, "e-2": true}
+	rules := []QualityRule[*TestEntity]{
+		UpdatedBefore[*TestEntity]("stale", 10),
+		{
+			Name: "unknown-reference",
+			Check: func(_ context.Context, e *TestEntity) error {
+				if !known[e.Id] {
+					return errors.New("unknown id")
+				}
+				return nil
+			},
+		},
+	}
+	report, err := store.CheckQuality(ctx, mockTenantKey, rules, WithQualityScan(WithChunkSize(2)))
+	require.NoError(t, err)
+	assert.Equal(t, mockTenantKey, report.ParentKey)
+	assert.Equal(t, 5, report.Scanned)
+	assert.Equal(t, 4, report.Failed)
+	assert.Equal(t, map[string]int{"stale": 2, "unknown-reference": 2, RuleDecode: 1}, report.Violations)
+	assert.Len(t, report.Examples, 5)
+	assert.Equal(t, keys[1], report.Examples[0].Key)
+	assert.Equal(t, "stale", report.Examples[0].Rule)
+	assert.EqualError(t, report.Examples[0].Err, "updated at 1 before 10")
+
+	t.Run("Should limit the examples per rule", func(t *testing.T) {
+		report, err := store.CheckQuality(ctx, mockTenantKey, rules, WithMaxExamples(1))
+		require.NoError(t, err)
+		assert.Len(t, report.Examples, 3)
+		assert.Equal(t, 2, report.Violations["stale"])
+	})
+
+	t.Run("Should reject invalid rules", func(t *testing.T) {
+		_, err := store.CheckQuality(ctx, mockTenantKey, []QualityRule[*TestEntity]{{Name: "nil"}})
+		assert.Error(t, err)
+		_, err = store.CheckQuality(ctx, mockTenantKey, []QualityRule[*TestEntity]{{Name: RuleDecode, Check: rules[1].Check}})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,142 @@
+package entitystore
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/holmberd/go-entitystore/eventemitter"
+)
+
+// DefaultQuotaThresholds are the default percentages of the quota triggering OnQuotaThreshold events.
+var DefaultQuotaThresholds = []int{80, 90, 100}
+
+// MaxQuotaTrackedParents is the max number of parent keys whose last reached quota threshold is
+// kept by a store. The oldest parent key is evicted beyond it, and may trigger its last reached
+// threshold again.
+const MaxQuotaTrackedParents = 10000
+
+// QuotaThreshold is a quota threshold reached by the entities under a parent key (see WithQuotaWarnings).
+type QuotaThreshold struct {
+	ParentKey string // Parent key of the entities, e.g. a tenant key.
+	Percent   int    // Reached threshold percentage of the quota.
+	Count     int64  // Approximate number of entities under the parent key.
+	Limit     int64  // Max number of entities under the parent key.
+}
+
+// QuotaListener is called with the quota thresholds reached by a write.
+type QuotaListener func(ctx context.Context, thresholds []QuotaThreshold)
+
+type quotaEventTarget struct {
+	t         *eventemitter.EventTarget
+	onInvalid func(err error)   // Called instead of the listener on malformed event arguments.
+	onSkipped func(skipped int) // If set, listeners are skipped once the context is done (see WithCancelableEvents).
+}
+
+func newQuotaEventTarget(event Event, onInvalid func(err error)) *quotaEventTarget {
+	return &quotaEventTarget{
+		t:         eventemitter.NewEventTarget(event.String()),
+		onInvalid: onInvalid,
+	}
+}
+
+func (e *quotaEventTarget) AddListener(listener QuotaListener) eventemitter.ListenerToken {
+	return e.t.AddListener(func(args ...any) {
+		if len(args) < 2 {
+			e.onInvalid(fmt.Errorf("missing arguments in %s event listener", e.t.EventName()))
+			return
+		}
+		ctx, ok := args[0].(context.Context)
+		if !ok {
+			e.onInvalid(fmt.Errorf("argument is not of expected type %T (got %T)", context.Background(), args[0]))
+			return
+		}
+		thresholds, ok := args[1].([]QuotaThreshold)
+		if !ok {
+			e.onInvalid(fmt.Errorf("argument is not of expected type %T (got %T)", []QuotaThreshold{}, args[1]))
+			return
+		}
+		listener(ctx, thresholds)
+	})
+}
+
+func (e *quotaEventTarget) RemoveListener(token eventemitter.ListenerToken) bool {
+	return e.t.RemoveListener(token)
+}
+
+func (e *quotaEventTarget) emit(ctx context.Context, thresholds []QuotaThreshold) bool {
+	if eventsSkipped(ctx) {
+		return false
+	}
+	if e.onSkipped != nil {
+		return emitCancelable(ctx, e.t, e.onSkipped, ctx, thresholds)
+	}
+	return e.t.Emit(ctx, thresholds)
+}
+
+// OnQuotaThreshold returns the event target triggered with the quota thresholds reached by the
+// entities under a parent key after a write (see WithQuotaWarnings).
+func (es *EntityStore[T, PT]) OnQuotaThreshold() *quotaEventTarget {
+	return es.onQuota
+}
+
+// checkQuotas counts the entities under the parent keys of the written entity keys, and triggers
+// the OnQuotaThreshold event for the parent keys reaching a higher threshold than they last reached.
+// Counting errors are reported to the corruption handler, since quota warnings don't fail writes.
+func (es *EntityStore[T, PT]) checkQuotas(ctx context.Context, entityKeys []string) {
+	if es.opts.quotaLimit <= 0 || len(entityKeys) == 0 {
+		return
+	}
+	var parentKeys []string
+	for _, key := range entityKeys {
+		if parentKey := es.parentKeyOf(key); !slices.Contains(parentKeys, parentKey) {
+			parentKeys = append(parentKeys, parentKey)
+		}
+	}
+	var reached []QuotaThreshold
+	for _, parentKey := range parentKeys {
+		count, err := es.indexCount(ctx, parentKey)
+		if err != nil {
+			es.opts.corruptionHandler(fmt.Errorf("failed to count entities of '%s' for quota: %w", parentKey, err))
+			continue
+		}
+		percent := 0
+		for _, p := range es.opts.quotaThresholds {
+			if count*100 >= es.opts.quotaLimit*int64(p) {
+				percent = p
+			}
+		}
+		last := es.setQuotaLevel(parentKey, percent)
+		if percent > last {
+			reached = append(reached, QuotaThreshold{
+				ParentKey: parentKey,
+				Percent:   percent,
+				Count:     count,
+				Limit:     es.opts.quotaLimit,
+			})
+		}
+	}
+	if len(reached) > 0 {
+		es.onQuota.emit(ctx, reached)
+	}
+}
+
+// setQuotaLevel sets the last reached quota threshold of the parent key, and returns the previous one.
+// Parent keys below all thresholds aren't tracked, so only parent keys near their quota use memory.
+func (es *EntityStore[T, PT]) setQuotaLevel(parentKey string, percent int) int {
+	es.quotaMu.Lock()
+	defer es.quotaMu.Unlock()
+	last, ok := es.quotaLevels[parentKey]
+	if !ok {
+		if percent == 0 {
+			return 0
+		}
+		es.quotaOrder = append(es.quotaOrder, parentKey)
+		for len(es.quotaOrder) > MaxQuotaTrackedParents {
+			delete(es.quotaLevels, es.quotaOrder[0])
+			es.quotaOrder = es.quotaOrder[1:]
+		}
+	}
+	es.quotaLevels[parentKey] = percent
+	return last
+}
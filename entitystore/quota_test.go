@@ -0,0 +1,108 @@
+package entitystore
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntityStoreQuotaWarnings(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	t.Run("Should require index", func(t *testing.T) {
+		_, err := New[testutil.Entity](
+			string(keyfactory.EntityKindTest),
+			keyfactory.GenerateRandomKey(),
+			dsClient,
+			WithQuotaWarnings(10),
+		)
+		assert.Error(t, err)
+	})
+
+	store, err := New[testutil.Entity](
+		string(keyfactory.EntityKindTest),
+		keyfactory.GenerateRandomKey(),
+		dsClient,
+		WithIndex(),
+		WithQuotaWarnings(10),
+	)
+	require.NoError(t, err)
+	var reached []QuotaThreshold
+	store.OnQuotaThreshold().AddListener(func(ctx context.Context, thresholds []QuotaThreshold) {
+		reached = append(reached, thresholds...)
+	})
+	entities := func(from, to int) []testutil.Entity {
+		var batch []testutil.Entity
+		for i := from; i < to; i++ {
+			batch = append(batch, testutil.NewEntity("e-"+strconv.Itoa(i), mockTenantId, 1))
+		}
+		return batch
+	}
+
+	t.Run("Should trigger reached thresholds once", func(t *testing.T) {
+		_, err := store.AddBatch(ctx, entities(0, 7), 0)
+		require.NoError(t, err)
+		assert.Empty(t, reached)
+
+		_, err = store.AddBatch(ctx, entities(7, 8), 0)
+		require.NoError(t, err)
+		require.Len(t, reached, 1)
+		assert.Equal(t, QuotaThreshold{ParentKey: mockTenantKey, Percent: 80, Count: 8, Limit: 10}, reached[0])
+
+		_, err = store.Add(ctx, entities(0, 1)[0], 0)
+		require.NoError(t, err)
+		assert.Len(t, reached, 1, "should not trigger reached threshold again")
+
+		_, err = store.AddBatch(ctx, entities(8, 12), 0)
+		require.NoError(t, err)
+		require.Len(t, reached, 2)
+		assert.Equal(t, 100, reached[1].Percent, "should trigger highest reached threshold")
+		assert.Equal(t, int64(12), reached[1].Count)
+	})
+
+	t.Run("Should trigger again after dropping below threshold", func(t *testing.T) {
+		reached = nil
+		require.NoError(t, store.RemoveByKeys(ctx, []string{
+			entities(0, 1)[0].Key,
+			entities(1, 2)[0].Key,
+			entities(2, 3)[0].Key,
+		}))
+		assert.Empty(t, reached)
+		_, err := store.AddBatch(ctx, entities(0, 1), 0)
+		require.NoError(t, err)
+		require.Len(t, reached, 1)
+		assert.Equal(t, 100, reached[0].Percent)
+	})
+
+	t.Run("Should trigger on partial batches", func(t *testing.T) {
+		reached = nil
+		require.NoError(t, store.RemoveByKeys(ctx, []string{entities(0, 1)[0].Key, entities(1, 2)[0].Key}))
+		invalid := testutil.Entity{ID: "invalid"}
+		result, err := store.AddBatchPartial(ctx, append(entities(0, 2), invalid), 0)
+		require.NoError(t, err)
+		require.Len(t, result.Failed(), 1)
+		require.Len(t, reached, 1)
+		assert.Equal(t, 100, reached[0].Percent)
+	})
+
+	t.Run("Should bound tracked parent keys", func(t *testing.T) {
+		assert.Zero(t, store.setQuotaLevel("tenant:below", 0))
+		assert.NotContains(t, store.quotaLevels, "tenant:below", "should not track parent keys below all thresholds")
+		for i := range MaxQuotaTrackedParents + 1 {
+			store.setQuotaLevel("tenant:"+strconv.Itoa(i), 80)
+		}
+		assert.Len(t, store.quotaLevels, MaxQuotaTrackedParents)
+		assert.NotContains(t, store.quotaLevels, mockTenantKey, "should evict the oldest parent key")
+		assert.Equal(t, 80, store.quotaLevels["tenant:"+strconv.Itoa(MaxQuotaTrackedParents)])
+	})
+}
@@ -0,0 +1,98 @@
+package entitystore
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// RawEntity is a handle to an entity read without decoding it (see GetAllRaw).
+type RawEntity[T Entity, PT SerializableEntity[T]] struct {
+	Key  string // Entity key.
+	Data []byte // Encoded entity as stored, e.g. including the checksum if enabled (see WithChecksum).
+
+	store *EntityStore[T, PT]
+}
+
+// Decode decodes the entity like the store's reads.
+func (r RawEntity[T, PT]) Decode() (PT, error) {
+	entity := PT(new(T))
+	if err := r.store.decode(r.Key, r.Data, entity); err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+// Payload returns the protobuf wire format of the entity, without decoding it, e.g. to write it
+// as a response in the same format. The checksum is verified and stripped if enabled, and the
+// entity is decrypted if encrypted (see WithEncryption), otherwise the payload shares Data.
+//
+// Read transformations (see TransformOnRead) can't be applied to payloads, so Payload fails if
+// the store has any.
+func (r RawEntity[T, PT]) Payload() ([]byte, error) {
+	es := r.store
+	es.readMu.RLock()
+	transformed := len(es.readTransforms) > 0
+	es.readMu.RUnlock()
+	if transformed {
+		return nil, errors.New("entitystore: payloads not supported with read transformations")
+	}
+	return es.payload(r.Key, r.Data)
+}
+
+// GetRaw is like Get, but returns a handle to the entity without decoding it.
+func (es *EntityStore[T, PT]) GetRaw(ctx context.Context, entityKey string) (RawEntity[T, PT], error) {
+	kb := es.NewKeyBuilder()
+	kb.WithKey(entityKey)
+	key, err := kb.BuildAndReset()
+	if err != nil {
+		return RawEntity[T, PT]{}, err
+	}
+	if err := es.authorize(ctx, AccessRead, []string{entityKey}); err != nil {
+		return RawEntity[T, PT]{}, err
+	}
+	data, err := es.get(ctx, key)
+	if err != nil {
+		return RawEntity[T, PT]{}, err
+	}
+	return RawEntity[T, PT]{Key: entityKey, Data: data, store: es}, nil
+}
+
+// WritePayloadTo writes the protobuf wire format of the entity (see RawEntity.Payload) to the
+// writer without decoding and re-encoding it, e.g. for read proxies writing entities to HTTP
+// responses, or to gRPC responses with a codec passing through bytes. It returns the number of
+// bytes written, or an error wrapping datastore.ErrKeyNotFound if the entity doesn't exist.
+func (es *EntityStore[T, PT]) WritePayloadTo(ctx context.Context, w io.Writer, entityKey string) (int64, error) {
+	raw, err := es.GetRaw(ctx, entityKey)
+	if err != nil {
+		return 0, err
+	}
+	payload, err := raw.Payload()
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(payload)
+	return int64(n), err
+}
+
+// GetAllRaw is like GetAll, but returns handles to the entities without decoding them, for callers
+// that only decode some entities or forward the encoded entities, e.g. when proxying HTTP requests.
+// Corrupt entities aren't detected until decoded, so the corrupt entity handler isn't called.
+func (es *EntityStore[T, PT]) GetAllRaw(ctx context.Context, parentKey string) ([]RawEntity[T, PT], error) {
+	keys, err := es.getAllKeys(ctx, parentKey)
+	if err != nil {
+		return nil, err
+	}
+	data, err := es.getMultiAligned(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	entities := make([]RawEntity[T, PT], 0, len(data))
+	for i, d := range data {
+		if d == nil {
+			continue // Key not found; skip it.
+		}
+		entities = append(entities, RawEntity[T, PT]{Key: keys[i].Key(), Data: d, store: es})
+	}
+	return entities, nil
+}
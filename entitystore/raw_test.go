@@ -0,0 +1,110 @@
+package entitystore
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/encoder"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntityStoreGetAllRaw(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	store, err := New[testutil.Entity](
+		string(keyfactory.EntityKindTest),
+		keyfactory.GenerateRandomKey(),
+		dsClient,
+		WithChecksum(),
+		WithGetAllLimit(3),
+	)
+	require.NoError(t, err)
+	e1, e2 := testutil.NewEntity("e-1", mockTenantId, 1), testutil.NewEntity("e-2", mockTenantId, 2)
+	e1.Data = "one"
+	_, err = store.AddBatch(ctx, []testutil.Entity{e1, e2}, 0)
+	require.NoError(t, err)
+
+	t.Run("Should return handles decoding on demand", func(t *testing.T) {
+		raw, err := store.GetAllRaw(ctx, mockTenantKey)
+		require.NoError(t, err)
+		require.Len(t, raw, 2)
+		byKey := map[string]RawEntity[testutil.Entity, *testutil.Entity]{}
+		for _, r := range raw {
+			byKey[r.Key] = r
+			assert.NotEmpty(t, r.Data)
+		}
+		decoded, err := byKey[e1.Key].Decode()
+		require.NoError(t, err)
+		assert.Equal(t, e1, *decoded)
+	})
+
+	t.Run("Should fail to decode corrupt entity", func(t *testing.T) {
+		raw, err := store.GetAllRaw(ctx, mockTenantKey)
+		require.NoError(t, err)
+		require.NotEmpty(t, raw)
+		raw[0].Data = append([]byte{}, raw[0].Data...)
+		raw[0].Data[0] ^= 0xff
+		_, err = raw[0].Decode()
+		assert.ErrorIs(t, err, datastore.ErrCorruptedData)
+	})
+
+	t.Run("Should enforce GetAll limit", func(t *testing.T) {
+		_, err := store.AddBatch(ctx, []testutil.Entity{
+			testutil.NewEntity("e-3", mockTenantId, 1),
+			testutil.NewEntity("e-4", mockTenantId, 1),
+		}, 0)
+		require.NoError(t, err)
+		_, err = store.GetAllRaw(ctx, mockTenantKey)
+		assert.ErrorIs(t, err, ErrTooManyEntities)
+	})
+}
+
+func TestEntityStoreWritePayloadTo(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	store, err := New[testutil.Entity](
+		string(keyfactory.EntityKindTest),
+		keyfactory.GenerateRandomKey(),
+		dsClient,
+		WithChecksum(),
+	)
+	require.NoError(t, err)
+	entity := testutil.NewEntity("e-1", mockTenantId, 1)
+	entity.Data = "payload"
+	_, err = store.Add(ctx, entity, 0)
+	require.NoError(t, err)
+
+	t.Run("Should write protobuf payload", func(t *testing.T) {
+		var buf bytes.Buffer
+		n, err := store.WritePayloadTo(ctx, &buf, entity.Key)
+		require.NoError(t, err)
+		assert.Equal(t, int64(buf.Len()), n)
+		var decoded testutil.Entity
+		require.NoError(t, encoder.ProtoUnmarshal(buf.Bytes(), &decoded))
+		assert.Equal(t, entity, decoded)
+	})
+
+	t.Run("Should fail for missing entity", func(t *testing.T) {
+		_, err := store.WritePayloadTo(ctx, &bytes.Buffer{}, testutil.NewEntity("e-2", mockTenantId, 1).Key)
+		assert.ErrorIs(t, err, datastore.ErrKeyNotFound)
+	})
+
+	t.Run("Should fail with read transformations", func(t *testing.T) {
+		store.TransformOnRead(func(e *testutil.Entity) error { return nil })
+		_, err := store.WritePayloadTo(ctx, &bytes.Buffer{}, entity.Key)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,147 @@
+package entitystore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+// Reencode migrates all entities under the parent key to the store's encoding, e.g. after enabling
+// checksums, by scanning the entities, decoding each with the store, or the legacy store if it
+// doesn't decode, and writing back the re-encoded entities in chunks, keeping their expiration.
+// The legacy store is a store of the same namespace configured with the previous encoding, or nil
+// if only the read transformations of the store are migrated (see TransformOnRead).
+// Entities already in the store's encoding are skipped.
+//
+// Entities are only written if unchanged since they were read, concurrently modified entities are
+// reported as conflicts, and entities the context may not write (see WithAuthorizer) as denied.
+// Entities that neither store decodes fail the migration, unless a corrupt entity handler is set.
+// Progress is reported as by UpdateWhere, where matched entities are the entities needing
+// re-encoding. Use WithCheckpoint to make the migration resumable and WithRateLimit or WithLimiter
+// to pace it.
+func (es *EntityStore[T, PT]) Reencode(
+	ctx context.Context,
+	parentKey string,
+	legacy *EntityStore[T, PT],
+	opts ...ScanOption,
+) (UpdateProgress, error) {
+	if err := es.checkContentAddressing("reencode"); err != nil {
+		return UpdateProgress{}, err
+	}
+	ctx = background(ctx)
+	o := newScanOptions(opts)
+	var progress UpdateProgress
+	err := es.scanChunks(ctx, parentKey, o, func(keys []*keyfactory.Key) error {
+		return es.reencodeChunk(ctx, keys, legacy, o, &progress)
+	})
+	return progress, err
+}
+
+// reencodeChunk re-encodes and writes back the entities of the keys that aren't in the store's encoding.
+func (es *EntityStore[T, PT]) reencodeChunk(
+	ctx context.Context,
+	keys []*keyfactory.Key,
+	legacy *EntityStore[T, PT],
+	o scanOptions,
+	progress *UpdateProgress,
+) error {
+	data, err := es.getMultiAligned(ctx, keys)
+	if err != nil {
+		return err
+	}
+	if err := o.limiter.Wait(ctx, 0, dataSize(data)); err != nil {
+		return err
+	}
+	var (
+		writeKeys []*keyfactory.Key
+		expected  [][]byte
+		newData   [][]byte
+		entities  []PT
+	)
+	for i, d := range data {
+		if d == nil {
+			continue // Removed since the scan.
+		}
+		progress.Scanned++
+		entityKey := keys[i].Key()
+		entity := PT(new(T))
+		err := es.decode(entityKey, d, entity)
+		if err != nil && legacy != nil {
+			entity = PT(new(T))
+			err = legacy.decode(entityKey, d, entity)
+		}
+		if err != nil {
+			if err := es.reencodeFailed(ctx, keys[i], len(d), err); err != nil {
+				return err
+			}
+			continue
+		}
+		nd, err := es.encode(entity)
+		if err != nil {
+			return err
+		}
+		if es.isCurrentEncoding(entityKey, d, nd, entity) {
+			continue // Already in the store's encoding.
+		}
+		progress.Matched++
+		writeKeys = append(writeKeys, keys[i])
+		expected = append(expected, bytes.Clone(d))
+		newData = append(newData, nd)
+		entities = append(entities, entity)
+	}
+	if len(writeKeys) == 0 {
+		return nil
+	}
+	denied, err := es.authorizeKeys(ctx, writeKeys)
+	if err != nil {
+		return err
+	}
+	if denied != nil {
+		progress.Denied += len(writeKeys) - countNil(denied)
+		writeKeys = withoutDenied(writeKeys, denied)
+		expected = withoutDenied(expected, denied)
+		newData = withoutDenied(newData, denied)
+		entities = withoutDenied(entities, denied)
+		if len(writeKeys) == 0 {
+			return nil
+		}
+	}
+	swapped, err := es.dsClient.CompareAndSwapMulti(ctx, writeKeys, expected, newData)
+	if err != nil {
+		return err
+	}
+	var updatedKeys []string
+	var updated []PT
+	for i, ok := range swapped {
+		if !ok {
+			progress.Conflicts++
+			continue
+		}
+		updatedKeys = append(updatedKeys, entities[i].GetKey())
+		updated = append(updated, entities[i])
+	}
+	progress.Updated += len(updated)
+	if err := es.indexAdd(ctx, updated...); err != nil {
+		return err
+	}
+	if len(updatedKeys) > 0 {
+		es.onUpdated.emit(ctx, updatedKeys)
+	}
+	if o.progress != nil {
+		o.progress(*progress)
+	}
+	return nil
+}
+
+// reencodeFailed handles an entity that failed to decode during re-encoding. It returns the
+// decode error, unless a corrupt entity handler is set.
+func (es *EntityStore[T, PT]) reencodeFailed(ctx context.Context, key *keyfactory.Key, size int, err error) error {
+	err = fmt.Errorf("entitystore: failed to decode entity '%s': %w", key.Key(), err)
+	if es.opts.corruptEntityHandler == nil {
+		return err
+	}
+	es.handleCorruptEntity(ctx, key, size, err)
+	return nil
+}
@@ -0,0 +1,314 @@
+package entitystore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+// OnDelete is the behavior of a reference when a referenced entity is removed (see AddReference).
+type OnDelete int
+
+const (
+	OnDeleteBlock   OnDelete = iota // Fail the removal with an error wrapping ErrReferenced.
+	OnDeleteCascade                 // Remove the referencing entities after the referenced entity.
+	OnDeleteNullify                 // Trigger the reference's OnNullify event with the referencing entities.
+)
+
+func (d OnDelete) String() string {
+	switch d {
+	case OnDeleteBlock:
+		return "block"
+	case OnDeleteCascade:
+		return "cascade"
+	case OnDeleteNullify:
+		return "nullify"
+	default:
+		return fmt.Sprintf("ondelete(%d)", d)
+	}
+}
+
+// DanglingReference is a reference to an entity that doesn't exist in the referenced store.
+type DanglingReference struct {
+	Key string // Key of the referencing entity.
+	Ref string // Key of the referenced entity.
+}
+
+// referrer is a reference to the entities of a store, registered with the referenced store.
+type referrer interface {
+	referenceName() string
+	onDelete() OnDelete
+	// referencing returns the keys of the entities under the parent keys referencing the removed
+	// entity keys, excluding removed entities if the reference is to the same store.
+	referencing(ctx context.Context, parentKeys []string, removed map[string]struct{}, self bool) ([]string, error)
+	// removeReferencing removes the referencing entities on a cascading removal.
+	removeReferencing(ctx context.Context, entityKeys []string) error
+	// nullify triggers the OnNullify event with the referencing entities.
+	nullify(ctx context.Context, entityKeys []string)
+	// fromDependents returns the dependents of the referencing entities (see RemoveCascade).
+	fromDependents(ctx context.Context, entityKeys []string) ([]referenceDependents, error)
+	// authorizeReferencing authorizes the removal of the referencing entities (see RemoveCascade).
+	authorizeReferencing(ctx context.Context, entityKeys []string) error
+	// removeReferencingCascaded removes the authorized referencing entities in chunks (see RemoveCascade).
+	removeReferencingCascaded(ctx context.Context, entityKeys []string) (int, error)
+	from() any
+}
+
+// Reference is a declared reference from the entities of a store to the entities of another store,
+// e.g. from orders to their products (see AddReference).
+type Reference[T Entity, PT SerializableEntity[T]] struct {
+	name      string
+	store     *EntityStore[T, PT]
+	refs      func(PT) []string
+	behavior  OnDelete
+	exists    func(ctx context.Context, entityKeys []string) ([]bool, error)
+	onNullify *eventTarget
+}
+
+// AddReference declares a reference from the entities of the store to the entities of the referenced
+// store, where refs returns the keys of the entities referenced by an entity, e.g. an order's product keys.
+// When the referenced store removes entities, the entities of the store referencing them are handled
+// by the on delete behavior.
+//
+// The behavior applies to Remove, RemoveByKeys, RemoveByKeysPartial, and RemoveAll of the referenced
+// store, but not to Flush and expiration. Referencing entities are found by scanning the entities of
+// the store under the parent key of each removed entity, so references must be between entities of
+// the same parent, e.g. a tenant, and removals of referenced entities scan the referencing entities.
+func AddReference[T Entity, PT SerializableEntity[T], U Entity, PU SerializableEntity[U]](
+	name string,
+	store *EntityStore[T, PT],
+	referenced *EntityStore[U, PU],
+	refs func(PT) []string,
+	onDelete OnDelete,
+) (*Reference[T, PT], error) {
+	if name == "" || refs == nil {
+		return nil, errors.New("entitystore: reference requires a name and refs function")
+	}
+	if onDelete < OnDeleteBlock || onDelete > OnDeleteNullify {
+		return nil, fmt.Errorf("entitystore: invalid reference on delete behavior %s", onDelete)
+	}
+	ref := &Reference[T, PT]{
+		name:      name,
+		store:     store,
+		refs:      refs,
+		behavior:  onDelete,
+		exists:    referenced.existing,
+		onNullify: newEventTarget(EntitiesRemoved, store.opts.corruptionHandler),
+	}
+	referenced.refMu.Lock()
+	defer referenced.refMu.Unlock()
+	for _, r := range referenced.referrers {
+		if r.referenceName() == name {
+			return nil, fmt.Errorf("entitystore: reference '%s' already exists", name)
+		}
+	}
+	referenced.referrers = append(referenced.referrers, ref)
+	return ref, nil
+}
+
+// Name returns the name of the reference.
+func (r *Reference[T, PT]) Name() string {
+	return r.name
+}
+
+// OnNullify returns the event target of the OnDeleteNullify behavior, triggered with the keys of the
+// entities referencing removed entities, so the listener can remove the dangling references.
+func (r *Reference[T, PT]) OnNullify() *eventTarget {
+	return r.onNullify
+}
+
+// Check scans all entities under the parent key and returns their references to entities that
+// don't exist in the referenced store, e.g. removed by Flush or expired.
+func (r *Reference[T, PT]) Check(ctx context.Context, parentKey string, opts ...ScanOption) ([]DanglingReference, error) {
+	var dangling []DanglingReference
+	err := r.store.scanChunks(ctx, parentKey, newScanOptions(opts), func(keys []*keyfactory.Key) error {
+		entities, err := r.store.getMulti(ctx, keys)
+		if err != nil {
+			return err
+		}
+		var refs []DanglingReference
+		for _, e := range entities {
+			for _, ref := range r.refs(e) {
+				if ref != "" {
+					refs = append(refs, DanglingReference{Key: e.GetKey(), Ref: ref})
+				}
+			}
+		}
+		if len(refs) == 0 {
+			return nil
+		}
+		refKeys := make([]string, len(refs))
+		for i, ref := range refs {
+			refKeys[i] = ref.Ref
+		}
+		exists, err := r.exists(ctx, refKeys)
+		if err != nil {
+			return err
+		}
+		for i, ok := range exists {
+			if !ok {
+				dangling = append(dangling, refs[i])
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dangling, nil
+}
+
+func (r *Reference[T, PT]) referenceName() string { return r.name }
+
+func (r *Reference[T, PT]) onDelete() OnDelete { return r.behavior }
+
+func (r *Reference[T, PT]) from() any { return r.store }
+
+func (r *Reference[T, PT]) referencing(
+	ctx context.Context,
+	parentKeys []string,
+	removed map[string]struct{},
+	self bool,
+) ([]string, error) {
+	var referencing []string
+	for _, parentKey := range parentKeys {
+		err := r.store.scanChunks(ctx, parentKey, newScanOptions(nil), func(keys []*keyfactory.Key) error {
+			entities, err := r.store.getMulti(ctx, keys)
+			if err != nil {
+				return err
+			}
+			for _, e := range entities {
+				if _, ok := removed[e.GetKey()]; ok && self {
+					continue // Removed with the referenced entities.
+				}
+				if slices.ContainsFunc(r.refs(e), func(ref string) bool {
+					_, ok := removed[ref]
+					return ok
+				}) {
+					referencing = append(referencing, e.GetKey())
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return referencing, nil
+}
+
+func (r *Reference[T, PT]) removeReferencing(ctx context.Context, entityKeys []string) error {
+	return r.store.RemoveByKeys(ctx, entityKeys)
+}
+
+func (r *Reference[T, PT]) nullify(ctx context.Context, entityKeys []string) {
+	r.onNullify.emit(ctx, entityKeys)
+}
+
+func (r *Reference[T, PT]) fromDependents(ctx context.Context, entityKeys []string) ([]referenceDependents, error) {
+	return r.store.dependents(ctx, entityKeys)
+}
+
+func (r *Reference[T, PT]) authorizeReferencing(ctx context.Context, entityKeys []string) error {
+	return r.store.authorizeWrite(ctx, entityKeys)
+}
+
+func (r *Reference[T, PT]) removeReferencingCascaded(ctx context.Context, entityKeys []string) (int, error) {
+	return r.store.removeCascaded(ctx, entityKeys)
+}
+
+// referenceDependents are the entities of a reference referencing removed entities.
+type referenceDependents struct {
+	ref  referrer
+	keys []string
+}
+
+// dependents returns the entities referencing the entity keys by the references to the store,
+// or an error wrapping ErrReferenced if they are referenced by a reference with OnDeleteBlock.
+func (es *EntityStore[T, PT]) dependents(ctx context.Context, entityKeys []string) ([]referenceDependents, error) {
+	es.refMu.RLock()
+	referrers := slices.Clone(es.referrers)
+	es.refMu.RUnlock()
+	if len(referrers) == 0 || len(entityKeys) == 0 {
+		return nil, nil
+	}
+	removed := make(map[string]struct{}, len(entityKeys))
+	var parentKeys []string
+	for _, key := range entityKeys {
+		removed[key] = struct{}{}
+		if parentKey := es.parentKeyOf(key); !slices.Contains(parentKeys, parentKey) {
+			parentKeys = append(parentKeys, parentKey)
+		}
+	}
+	var deps []referenceDependents
+	for _, r := range referrers {
+		keys, err := r.referencing(ctx, parentKeys, removed, r.from() == any(es))
+		if err != nil {
+			return nil, fmt.Errorf("entitystore: reference '%s': %w", r.referenceName(), err)
+		}
+		if len(keys) == 0 {
+			continue
+		}
+		if r.onDelete() == OnDeleteBlock {
+			return nil, fmt.Errorf(
+				"%w: by %d entities of reference '%s', e.g. '%s'",
+				ErrReferenced,
+				len(keys),
+				r.referenceName(),
+				keys[0],
+			)
+		}
+		deps = append(deps, referenceDependents{ref: r, keys: keys})
+	}
+	return deps, nil
+}
+
+// removeDependents applies the on delete behavior of the references to their dependents.
+func (es *EntityStore[T, PT]) removeDependents(ctx context.Context, deps []referenceDependents) error {
+	for _, d := range deps {
+		switch d.ref.onDelete() {
+		case OnDeleteCascade:
+			if err := d.ref.removeReferencing(ctx, d.keys); err != nil {
+				return fmt.Errorf("entitystore: cascade reference '%s': %w", d.ref.referenceName(), err)
+			}
+		case OnDeleteNullify:
+			d.ref.nullify(ctx, d.keys)
+		}
+	}
+	return nil
+}
+
+// parentKeyOf returns the parent key of the entity key, or an empty key for top-level entities.
+func (es *EntityStore[T, PT]) parentKeyOf(entityKey string) string {
+	if i := strings.LastIndex(entityKey, ":"+es.entityKind+":"); i >= 0 {
+		return entityKey[:i]
+	}
+	return ""
+}
+
+// existing returns whether the entities of the keys exist in the store.
+func (es *EntityStore[T, PT]) existing(ctx context.Context, entityKeys []string) ([]bool, error) {
+	keys := make([]*keyfactory.Key, len(entityKeys))
+	kb := es.NewKeyBuilder()
+	for i, eKey := range entityKeys {
+		kb.WithKey(eKey)
+		key, err := kb.BuildAndReset()
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = key
+	}
+	data, err := es.getMultiAligned(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	exists := make([]bool, len(data))
+	for i, d := range data {
+		exists[i] = d != nil
+	}
+	return exists, nil
+}
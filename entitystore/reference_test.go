@@ -0,0 +1,109 @@
+package entitystore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntityStoreReferences(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	type store = EntityStore[testutil.Entity, *testutil.Entity]
+	refs := func(e *testutil.Entity) []string { return []string{e.Data} }
+	// newStores returns a product store with two products, and an order store with an order of the first product.
+	newStores := func(t *testing.T, onDelete OnDelete) (*store, *store, *Reference[testutil.Entity, *testutil.Entity]) {
+		t.Helper()
+		products, err := New[testutil.Entity](string(keyfactory.EntityKindTest), keyfactory.GenerateRandomKey(), dsClient)
+		require.NoError(t, err)
+		orders, err := New[testutil.Entity](string(keyfactory.EntityKindTest), keyfactory.GenerateRandomKey(), dsClient)
+		require.NoError(t, err)
+		ref, err := AddReference("order-product", orders, products, refs, onDelete)
+		require.NoError(t, err)
+		_, err = products.AddBatch(ctx, []testutil.Entity{
+			testutil.NewEntity("p-1", mockTenantId, 1),
+			testutil.NewEntity("p-2", mockTenantId, 1),
+		}, 0)
+		require.NoError(t, err)
+		order := testutil.NewEntity("o-1", mockTenantId, 1)
+		order.Data = testutil.NewEntity("p-1", mockTenantId, 1).Key
+		_, err = orders.Add(ctx, order, 0)
+		require.NoError(t, err)
+		return products, orders, ref
+	}
+	p1, p2 := testutil.NewEntity("p-1", mockTenantId, 1).Key, testutil.NewEntity("p-2", mockTenantId, 1).Key
+	o1 := testutil.NewEntity("o-1", mockTenantId, 1).Key
+
+	t.Run("Should block removal of referenced entities", func(t *testing.T) {
+		products, _, _ := newStores(t, OnDeleteBlock)
+		assert.ErrorIs(t, products.Remove(ctx, p1), ErrReferenced)
+		assert.ErrorIs(t, products.RemoveAll(ctx, mockTenantKey), ErrReferenced)
+		exists, err := products.Exists(ctx, p1)
+		require.NoError(t, err)
+		assert.True(t, exists)
+		assert.NoError(t, products.Remove(ctx, p2), "should remove unreferenced entities")
+	})
+
+	t.Run("Should cascade removal to referencing entities", func(t *testing.T) {
+		products, orders, _ := newStores(t, OnDeleteCascade)
+		require.NoError(t, products.Remove(ctx, p1))
+		exists, err := orders.Exists(ctx, o1)
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("Should trigger nullify event with referencing entities", func(t *testing.T) {
+		products, orders, ref := newStores(t, OnDeleteNullify)
+		var nullified []string
+		ref.OnNullify().AddListener(func(ctx context.Context, keys []string) {
+			nullified = append(nullified, keys...)
+		})
+		require.NoError(t, products.Remove(ctx, p1))
+		assert.Equal(t, []string{o1}, nullified)
+		exists, err := orders.Exists(ctx, o1)
+		require.NoError(t, err)
+		assert.True(t, exists)
+	})
+
+	t.Run("Should report dangling references", func(t *testing.T) {
+		products, _, ref := newStores(t, OnDeleteBlock)
+		dangling, err := ref.Check(ctx, mockTenantKey)
+		require.NoError(t, err)
+		assert.Empty(t, dangling)
+		require.NoError(t, dsClient.Delete(ctx, keyfactory.NewKey(p1, products.namespace)), "should detect entities removed without the store, e.g. expired")
+		dangling, err = ref.Check(ctx, mockTenantKey)
+		require.NoError(t, err)
+		assert.Equal(t, []DanglingReference{{Key: o1, Ref: p1}}, dangling)
+	})
+
+	t.Run("Should allow removing self-referencing entities together", func(t *testing.T) {
+		_, orders, _ := newStores(t, OnDeleteBlock)
+		_, err := AddReference("order-order", orders, orders, refs, OnDeleteBlock)
+		require.NoError(t, err)
+		order := testutil.NewEntity("o-2", mockTenantId, 1)
+		order.Data = o1
+		_, err = orders.Add(ctx, order, 0)
+		require.NoError(t, err)
+		assert.ErrorIs(t, orders.Remove(ctx, o1), ErrReferenced)
+		assert.NoError(t, orders.RemoveByKeys(ctx, []string{o1, order.Key}))
+	})
+
+	t.Run("Should reject invalid references", func(t *testing.T) {
+		products, orders, _ := newStores(t, OnDeleteBlock)
+		_, err := AddReference("order-product", orders, products, refs, OnDeleteBlock)
+		assert.Error(t, err, "should reject duplicate names")
+		_, err = AddReference("", orders, products, refs, OnDeleteBlock)
+		assert.Error(t, err)
+		_, err = AddReference("x", orders, products, refs, OnDelete(7))
+		assert.Error(t, err)
+	})
+}
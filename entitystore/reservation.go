@@ -0,0 +1,92 @@
+package entitystore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+const reservationKeyPrefix = "reservation" // Key prefix of entity reservations.
+
+// reservationKey returns the key of the reservation of the entity key.
+func (es *EntityStore[T, PT]) reservationKey(entityKey string) (*keyfactory.Key, error) {
+	kb := es.NewKeyBuilder()
+	kb.WithKey(entityKey)
+	if _, err := kb.BuildAndReset(); err != nil {
+		return nil, err
+	}
+	return keyfactory.NewKey(keyfactory.BuildRedisKey(reservationKeyPrefix, entityKey), es.namespace), nil
+}
+
+// Reserve atomically reserves the entity key for the holder until the TTL expires, e.g. to hold an
+// inventory item or a booking slot while a checkout completes. An error wrapping ErrReserved is
+// returned if the entity key is reserved by another holder. Reserving an entity key already reserved
+// by the holder extends its pending reservation.
+//
+// Reservations are independent of the stored entities, so an entity key can be reserved before
+// its entity is added, and reservations aren't removed with the entities.
+func (es *EntityStore[T, PT]) Reserve(ctx context.Context, entityKey string, holder string, ttl time.Duration) error {
+	if holder == "" || ttl <= 0 {
+		return errors.New("entitystore: reservation requires a holder and a positive ttl")
+	}
+	key, err := es.reservationKey(entityKey)
+	if err != nil {
+		return err
+	}
+	r, ok, err := es.dsClient.Reserve(ctx, key, holder, ttl)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: entity '%s' is reserved by '%s'", ErrReserved, entityKey, r.Holder)
+	}
+	return nil
+}
+
+// Confirm atomically confirms the reservation of the entity key by the holder, so it no longer expires.
+// An error wrapping ErrNotReserved is returned if the entity key isn't reserved by the holder,
+// e.g. since the reservation expired.
+func (es *EntityStore[T, PT]) Confirm(ctx context.Context, entityKey string, holder string) error {
+	key, err := es.reservationKey(entityKey)
+	if err != nil {
+		return err
+	}
+	ok, err := es.dsClient.ConfirmReservation(ctx, key, holder)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: entity '%s' by '%s'", ErrNotReserved, entityKey, holder)
+	}
+	return nil
+}
+
+// Release atomically removes the pending or confirmed reservation of the entity key by the holder.
+// An error wrapping ErrNotReserved is returned if the entity key isn't reserved by the holder.
+func (es *EntityStore[T, PT]) Release(ctx context.Context, entityKey string, holder string) error {
+	key, err := es.reservationKey(entityKey)
+	if err != nil {
+		return err
+	}
+	ok, err := es.dsClient.ReleaseReservation(ctx, key, holder)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: entity '%s' by '%s'", ErrNotReserved, entityKey, holder)
+	}
+	return nil
+}
+
+// GetReservation returns the reservation of the entity key, or nil if it isn't reserved.
+func (es *EntityStore[T, PT]) GetReservation(ctx context.Context, entityKey string) (*datastore.Reservation, error) {
+	key, err := es.reservationKey(entityKey)
+	if err != nil {
+		return nil, err
+	}
+	return es.dsClient.GetReservation(ctx, key)
+}
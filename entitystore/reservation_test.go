@@ -0,0 +1,95 @@
+package entitystore
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntityStoreReservations(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	store, err := New[testutil.Entity](string(keyfactory.EntityKindTest), keyfactory.GenerateRandomKey(), dsClient)
+	require.NoError(t, err)
+	slot := func(id string) string { return testutil.NewEntity(id, mockTenantId, 1).Key }
+
+	t.Run("Should reserve for a single holder under contention", func(t *testing.T) {
+		var wg sync.WaitGroup
+		var reserved atomic.Int32
+		for i := range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := store.Reserve(ctx, slot("s-1"), "h-"+strconv.Itoa(i), time.Minute)
+				if err == nil {
+					reserved.Add(1)
+				} else {
+					assert.ErrorIs(t, err, ErrReserved)
+				}
+			}()
+		}
+		wg.Wait()
+		assert.EqualValues(t, 1, reserved.Load())
+	})
+
+	t.Run("Should expire pending reservations", func(t *testing.T) {
+		require.NoError(t, store.Reserve(ctx, slot("s-2"), "a", time.Second))
+		require.NoError(t, store.Reserve(ctx, slot("s-2"), "a", time.Minute), "should extend the reservation")
+		r, err := store.GetReservation(ctx, slot("s-2"))
+		require.NoError(t, err)
+		require.NotNil(t, r)
+		assert.Equal(t, "a", r.Holder)
+		assert.False(t, r.Confirmed)
+		assert.Greater(t, r.TTL, time.Second)
+
+		server.FastForward(2 * time.Minute)
+		r, err = store.GetReservation(ctx, slot("s-2"))
+		require.NoError(t, err)
+		assert.Nil(t, r)
+		assert.ErrorIs(t, store.Confirm(ctx, slot("s-2"), "a"), ErrNotReserved)
+		assert.NoError(t, store.Reserve(ctx, slot("s-2"), "b", time.Minute))
+	})
+
+	t.Run("Should keep confirmed reservations", func(t *testing.T) {
+		require.NoError(t, store.Reserve(ctx, slot("s-3"), "a", time.Second))
+		assert.ErrorIs(t, store.Confirm(ctx, slot("s-3"), "b"), ErrNotReserved)
+		require.NoError(t, store.Confirm(ctx, slot("s-3"), "a"))
+		require.NoError(t, store.Confirm(ctx, slot("s-3"), "a"), "should be idempotent")
+		server.FastForward(time.Minute)
+		r, err := store.GetReservation(ctx, slot("s-3"))
+		require.NoError(t, err)
+		require.NotNil(t, r)
+		assert.Equal(t, datastore.Reservation{Holder: "a", Confirmed: true}, *r)
+		assert.ErrorIs(t, store.Reserve(ctx, slot("s-3"), "b", time.Minute), ErrReserved)
+		assert.NoError(t, store.Reserve(ctx, slot("s-3"), "a", time.Minute))
+	})
+
+	t.Run("Should release reservations of the holder", func(t *testing.T) {
+		require.NoError(t, store.Reserve(ctx, slot("s-4"), "a", time.Minute))
+		assert.ErrorIs(t, store.Release(ctx, slot("s-4"), "b"), ErrNotReserved)
+		require.NoError(t, store.Release(ctx, slot("s-4"), "a"))
+		assert.ErrorIs(t, store.Release(ctx, slot("s-4"), "a"), ErrNotReserved)
+		assert.NoError(t, store.Reserve(ctx, slot("s-4"), "b", time.Minute))
+	})
+
+	t.Run("Should not treat reservations as entities", func(t *testing.T) {
+		all, err := store.GetAll(ctx, mockTenantKey)
+		require.NoError(t, err)
+		assert.Empty(t, all)
+		assert.Error(t, store.Reserve(ctx, slot("s-5"), "", time.Minute))
+		assert.Error(t, store.Reserve(ctx, "", "a", time.Minute))
+	})
+}
@@ -0,0 +1,137 @@
+package entitystore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/metrics"
+)
+
+const MetricDecodeRetries = "entitystore_decode_retries_total" // Counter of reads retried after a decode failure, by op and result.
+
+// DecodeRetryStore is an EntityStorer decorator that retries a read once when an entity fails
+// to decode, covering the window of a codec upgrade rolled out across a fleet, where a reader
+// may read a value written with a codec it doesn't know yet, or a value about to be rewritten.
+// The retry reads the entities from the datastore again. Writes are passed through to the store.
+//
+// Retries are counted by the MetricDecodeRetries metric, labeled with the read "op" and the
+// "result" of the retry, "recovered" or "failed".
+type DecodeRetryStore[T Entity, PT SerializableEntity[T]] struct {
+	EntityStorer[T, PT]
+	delay   time.Duration
+	metrics metrics.Recorder
+}
+
+// NewDecodeRetryStore returns a store retrying reads of the store that fail to decode after the delay.
+// The recorder may be nil.
+func NewDecodeRetryStore[T Entity, PT SerializableEntity[T]](
+	store EntityStorer[T, PT],
+	delay time.Duration,
+	recorder metrics.Recorder,
+) *DecodeRetryStore[T, PT] {
+	if recorder == nil {
+		recorder = metrics.NopRecorder{}
+	}
+	return &DecodeRetryStore[T, PT]{EntityStorer: store, delay: delay, metrics: recorder}
+}
+
+// isDecodeError reports whether the error is a failure to decode a stored entity.
+func isDecodeError(err error) bool {
+	return errors.Is(err, ErrDecodeFailed) || errors.Is(err, datastore.ErrCorruptedData)
+}
+
+// retryDecode runs the read, and if it fails to decode an entity, runs it once more after the delay.
+func retryDecode[T Entity, PT SerializableEntity[T], V any](
+	ctx context.Context,
+	s *DecodeRetryStore[T, PT],
+	op string,
+	read func() (V, error),
+) (V, error) {
+	v, err := read()
+	if !isDecodeError(err) {
+		return v, err
+	}
+	if err := s.retryWait(ctx); err != nil {
+		return v, err
+	}
+	v, err = read()
+	s.countRetry(op, !isDecodeError(err))
+	return v, err
+}
+
+func (s *DecodeRetryStore[T, PT]) retryWait(ctx context.Context) error {
+	if s.delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(s.delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (s *DecodeRetryStore[T, PT]) countRetry(op string, recovered bool) {
+	result := "failed"
+	if recovered {
+		result = "recovered"
+	}
+	s.metrics.Count(MetricDecodeRetries, 1, metrics.Label{Name: "op", Value: op}, metrics.Label{Name: "result", Value: result})
+}
+
+func (s *DecodeRetryStore[T, PT]) Get(ctx context.Context, entityKey string, opts ...CallOption) (PT, error) {
+	return retryDecode(ctx, s, "get", func() (PT, error) {
+		return s.EntityStorer.Get(ctx, entityKey, opts...)
+	})
+}
+
+func (s *DecodeRetryStore[T, PT]) GetByKeys(ctx context.Context, entityKeys []string) ([]PT, error) {
+	return retryDecode(ctx, s, "get_by_keys", func() ([]PT, error) {
+		return s.EntityStorer.GetByKeys(ctx, entityKeys)
+	})
+}
+
+// GetByKeysPartial is like the store's GetByKeysPartial, but if any entity fails to decode,
+// all keys are read once more.
+func (s *DecodeRetryStore[T, PT]) GetByKeysPartial(ctx context.Context, entityKeys []string) ([]PT, *BatchResult, error) {
+	type partial struct {
+		entities []PT
+		result   *BatchResult
+	}
+	p, err := retryDecode(ctx, s, "get_by_keys_partial", func() (partial, error) {
+		entities, result, err := s.EntityStorer.GetByKeysPartial(ctx, entityKeys)
+		if err == nil && result != nil {
+			for _, item := range result.Items {
+				if isDecodeError(item.Err) {
+					return partial{entities, result}, item.Err // Retried, but the result is returned as is.
+				}
+			}
+		}
+		return partial{entities, result}, err
+	})
+	if isDecodeError(err) {
+		err = nil // Reported per item.
+	}
+	return p.entities, p.result, err
+}
+
+func (s *DecodeRetryStore[T, PT]) GetWithPagination(
+	ctx context.Context,
+	cursor uint64,
+	limit int,
+	parentKey string,
+) (*EntityCursor[T, PT], error) {
+	return retryDecode(ctx, s, "get_with_pagination", func() (*EntityCursor[T, PT], error) {
+		return s.EntityStorer.GetWithPagination(ctx, cursor, limit, parentKey)
+	})
+}
+
+func (s *DecodeRetryStore[T, PT]) GetAll(ctx context.Context, parentKey string) ([]PT, error) {
+	return retryDecode(ctx, s, "get_all", func() ([]PT, error) {
+		return s.EntityStorer.GetAll(ctx, parentKey)
+	})
+}
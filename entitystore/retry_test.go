@@ -0,0 +1,87 @@
+package entitystore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/metrics"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// corruptOnceStore rewrites the stored entity after the first failed read, as a writer
+// with the new codec would.
+type corruptOnceStore struct {
+	EntityStorer[testutil.Entity, *testutil.Entity]
+	entity testutil.Entity
+	reads  int
+}
+
+func (s *corruptOnceStore) Get(ctx context.Context, entityKey string, opts ...CallOption) (*testutil.Entity, error) {
+	s.reads++
+	entity, err := s.EntityStorer.Get(ctx, entityKey, opts...)
+	if err != nil && s.reads == 1 {
+		_, _ = s.EntityStorer.Add(ctx, s.entity, 0)
+	}
+	return entity, err
+}
+
+func TestDecodeRetryStore(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	namespace := keyfactory.GenerateRandomKey()
+	store, err := New[testutil.Entity](string(keyfactory.EntityKindTest), namespace, dsClient)
+	require.NoError(t, err)
+	entity := testutil.NewEntity("e-1", mockTenantId, 1)
+	corrupt := func(t *testing.T) {
+		t.Helper()
+		require.NoError(t, dsClient.Put(ctx, keyfactory.NewKey(entity.Key, namespace), []byte("{invalid"), 0))
+	}
+
+	t.Run("Recovered", func(t *testing.T) {
+		corrupt(t)
+		recorder := metrics.NewMemoryRecorder()
+		flaky := &corruptOnceStore{EntityStorer: store, entity: entity}
+		retrying := NewDecodeRetryStore[testutil.Entity](flaky, 0, recorder)
+		got, err := retrying.Get(ctx, entity.Key)
+		require.NoError(t, err)
+		assert.Equal(t, "e-1", got.ID)
+		assert.Equal(t, 2, flaky.reads)
+		assert.Equal(t, int64(1), recorder.Counter(
+			MetricDecodeRetries,
+			metrics.Label{Name: "op", Value: "get"},
+			metrics.Label{Name: "result", Value: "recovered"},
+		))
+	})
+
+	t.Run("Failed", func(t *testing.T) {
+		corrupt(t)
+		recorder := metrics.NewMemoryRecorder()
+		retrying := NewDecodeRetryStore[testutil.Entity](store, 0, recorder)
+		_, err := retrying.GetByKeys(ctx, []string{entity.Key})
+		assert.ErrorIs(t, err, ErrDecodeFailed)
+		_, result, err := retrying.GetByKeysPartial(ctx, []string{entity.Key})
+		require.NoError(t, err, "should report decode failures per item")
+		assert.ErrorIs(t, result.Items[0].Err, ErrDecodeFailed)
+		assert.Equal(t, int64(1), recorder.Counter(
+			MetricDecodeRetries,
+			metrics.Label{Name: "op", Value: "get_by_keys"},
+			metrics.Label{Name: "result", Value: "failed"},
+		))
+	})
+
+	t.Run("Other errors aren't retried", func(t *testing.T) {
+		recorder := metrics.NewMemoryRecorder()
+		retrying := NewDecodeRetryStore[testutil.Entity](store, 0, recorder)
+		_, err := retrying.Get(ctx, "test_entity:missing")
+		assert.ErrorIs(t, err, datastore.ErrKeyNotFound)
+		assert.Empty(t, recorder.Counters())
+	})
+}
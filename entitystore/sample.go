@@ -0,0 +1,68 @@
+package entitystore
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+// Sample returns a deterministic pseudo-random subset of about the fraction of entities under
+// the parent key, e.g. for canary validations and data-quality checks without reading all entities.
+// An entity is sampled if the hash of its key is below the fraction of the hash space, so the same
+// entities are sampled on each call, and the sample of a larger fraction includes the sample of a
+// smaller one. The fraction must be in the range (0, 1].
+//
+// The keys under the parent key are scanned, but only the sampled entities are read.
+func (es *EntityStore[T, PT]) Sample(
+	ctx context.Context,
+	parentKey string,
+	fraction float64,
+	opts ...ScanOption,
+) ([]PT, error) {
+	if !(fraction > 0 && fraction <= 1) {
+		return nil, fmt.Errorf("entitystore: sample fraction %v must be in the range (0, 1]", fraction)
+	}
+	threshold := uint64(math.MaxUint64)
+	if fraction < 1 {
+		threshold = uint64(fraction * math.MaxUint64)
+	}
+	var entities []PT
+	err := es.scanChunks(ctx, parentKey, newScanOptions(opts), func(keys []*keyfactory.Key) error {
+		sampled := make([]*keyfactory.Key, 0, len(keys))
+		for _, key := range keys {
+			if sampleHash(key.Key()) <= threshold {
+				sampled = append(sampled, key)
+			}
+		}
+		if len(sampled) == 0 {
+			return nil
+		}
+		chunk, err := es.getMulti(ctx, sampled)
+		if err != nil {
+			return err
+		}
+		entities = append(entities, chunk...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entities, nil
+}
+
+// sampleHash returns the hash of the entity key used to sample it.
+func sampleHash(entityKey string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(entityKey))
+	// Mix the hash, as FNV poorly distributes keys differing in the last bytes across the high bits.
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
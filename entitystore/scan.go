@@ -0,0 +1,219 @@
+package entitystore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/ratelimit"
+)
+
+const (
+	defaultScanChunkSize = 100              // Default number of entities processed per full scan chunk.
+	checkpointKeyPrefix  = "scancheckpoint" // Key prefix of full scan checkpoints.
+)
+
+// ScanOption configures a full scan of the store, e.g. UpdateWhere, Export, and CopyTo.
+// The datastore operations of full scans are tagged as background traffic, which is delayed
+// while foreground traffic is slow if the datastore client has QoS (see datastore.WithQoS).
+type ScanOption func(*scanOptions)
+
+// background returns a copy of the context of a bulk job tagging its datastore operations as
+// background traffic (see datastore.WithBackgroundPriority).
+func background(ctx context.Context) context.Context {
+	return datastore.WithBackgroundPriority(ctx)
+}
+
+type scanOptions struct {
+	chunkSize    int
+	checkpoint   string
+	versionCheck bool
+	limiter      *ratelimit.Limiter
+	progress     func(UpdateProgress)
+}
+
+func newScanOptions(opts []ScanOption) scanOptions {
+	o := scanOptions{chunkSize: defaultScanChunkSize}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithChunkSize sets the number of entities scanned and written per chunk.
+func WithChunkSize(size int) ScanOption {
+	return func(o *scanOptions) {
+		if size > 0 {
+			o.chunkSize = size
+		}
+	}
+}
+
+// WithCheckpoint persists the progress of the scan under the checkpoint name after each chunk,
+// so an interrupted scan resumes from the last checkpoint when run again with the same name,
+// instead of restarting. The checkpoint is removed when the scan completes.
+//
+// Entities of the chunk being processed when the scan was interrupted are processed again on
+// resume, so the scan processing must be idempotent, e.g. an Export must be resumed by appending
+// to the same output.
+func WithCheckpoint(name string) ScanOption {
+	return func(o *scanOptions) {
+		o.checkpoint = name
+	}
+}
+
+// WithRateLimit limits the scan to the number of entities per second, pacing the chunks,
+// so a long-running scan doesn't starve foreground traffic.
+// Use WithLimiter to share a limit between scans.
+func WithRateLimit(entitiesPerSecond int) ScanOption {
+	return func(o *scanOptions) {
+		if entitiesPerSecond > 0 {
+			o.limiter = ratelimit.NewPaced(entitiesPerSecond, 0)
+		}
+	}
+}
+
+// WithLimiter paces the scan with the limiter, which may be shared with other background jobs.
+// Each scanned entity is an operation, and the bytes of the entities read by Export, CopyTo,
+// UpdateWhere, and Reencode are taken from the bandwidth limit.
+func WithLimiter(l *ratelimit.Limiter) ScanOption {
+	return func(o *scanOptions) {
+		o.limiter = l
+	}
+}
+
+// Checkpoint is the persisted progress of an interrupted full scan (see WithCheckpoint).
+type Checkpoint struct {
+	ParentKey string    `json:"parent_key"` // Parent key of the scanned entities.
+	Cursor    uint64    `json:"cursor"`     // Cursor of the next chunk.
+	Processed int       `json:"processed"`  // Number of entity keys processed before the cursor.
+	UpdatedAt time.Time `json:"updated_at"` // Time the checkpoint was saved.
+}
+
+// checkpointKey returns the key of the named scan checkpoint.
+func (es *EntityStore[T, PT]) checkpointKey(name string) (*keyfactory.Key, error) {
+	if err := keyfactory.ValidateKeyFragment(name); err != nil {
+		return nil, fmt.Errorf("entitystore: invalid checkpoint name: %w", err)
+	}
+	return keyfactory.NewKey(keyfactory.BuildRedisKey(checkpointKeyPrefix, es.entityKind, name), es.namespace), nil
+}
+
+// GetCheckpoint retrieves the named scan checkpoint, or nil if there is none.
+func (es *EntityStore[T, PT]) GetCheckpoint(ctx context.Context, name string) (*Checkpoint, error) {
+	key, err := es.checkpointKey(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := es.dsClient.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, datastore.ErrKeyNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("%w: checkpoint '%s': %w", datastore.ErrCorruptedData, name, err)
+	}
+	return &cp, nil
+}
+
+// scanChunks scans the keys of all entities under the parent key, calling fn with each chunk
+// of scanned keys. Keys returned multiple times by the scan are only passed to fn once, unless
+// the scan is resumed from a checkpoint.
+func (es *EntityStore[T, PT]) scanChunks(
+	ctx context.Context,
+	parentKey string,
+	o scanOptions,
+	fn func(keys []*keyfactory.Key) error,
+) error {
+	kb := es.NewKeyBuilder()
+	kb.WithParentKey(parentKey)
+	kb.WithKey(es.entityKind)
+	kb.WithWildcard(keyfactory.WildcardAnyString)
+	keyMatch, err := kb.BuildAndReset()
+	if err != nil {
+		return err
+	}
+
+	var cpKey *keyfactory.Key
+	cp := Checkpoint{ParentKey: parentKey}
+	if o.checkpoint != "" {
+		if cpKey, err = es.checkpointKey(o.checkpoint); err != nil {
+			return err
+		}
+		saved, err := es.GetCheckpoint(ctx, o.checkpoint)
+		if err != nil {
+			return err
+		}
+		if saved != nil {
+			if saved.ParentKey != parentKey {
+				return fmt.Errorf(
+					"entitystore: checkpoint '%s' belongs to a scan of parent key '%s'",
+					o.checkpoint,
+					saved.ParentKey,
+				)
+			}
+			cp = *saved
+		}
+	}
+
+	seen := make(map[string]struct{})
+	for {
+		keys, nextCursor, err := es.dsClient.GetKeysWithCursor(ctx, cp.Cursor, o.chunkSize, keyMatch)
+		if err != nil {
+			return err
+		}
+		unseen := keys[:0]
+		for _, key := range keys {
+			if _, ok := seen[key.RedisKey()]; !ok {
+				seen[key.RedisKey()] = struct{}{}
+				unseen = append(unseen, key)
+			}
+		}
+		if len(unseen) > 0 {
+			if err := o.limiter.Wait(ctx, len(unseen), 0); err != nil {
+				return err
+			}
+			if err := fn(unseen); err != nil {
+				return err
+			}
+		}
+		cp.Cursor = nextCursor
+		cp.Processed += len(unseen)
+		if cpKey != nil {
+			if err := es.saveCheckpoint(ctx, cpKey, cp); err != nil {
+				return err
+			}
+		}
+		if nextCursor == 0 {
+			return nil
+		}
+	}
+}
+
+// dataSize returns the total size in bytes of the data.
+func dataSize(data [][]byte) int {
+	n := 0
+	for _, d := range data {
+		n += len(d)
+	}
+	return n
+}
+
+// saveCheckpoint saves the checkpoint, or removes it if the scan completed.
+func (es *EntityStore[T, PT]) saveCheckpoint(ctx context.Context, key *keyfactory.Key, cp Checkpoint) error {
+	if cp.Cursor == 0 {
+		return es.dsClient.Delete(ctx, key)
+	}
+	cp.UpdatedAt = time.Now().UTC()
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	return es.dsClient.Put(ctx, key, data, 0)
+}
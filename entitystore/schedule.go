@@ -0,0 +1,141 @@
+package entitystore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+const (
+	MetricDueDropped = "entitystore_due_dropped_total" // Counter of due entities without an OnDue listener.
+
+	scheduleKeyPrefix = "schedule" // Key prefix of the store schedule.
+	schedulePopCount  = 100        // Number of due entities popped per round trip.
+)
+
+// scheduleKey returns the key of the store schedule, a sorted set of the scheduled actions scored
+// by their due time.
+func (es *EntityStore[T, PT]) scheduleKey() *keyfactory.Key {
+	return keyfactory.NewKey(keyfactory.BuildRedisKey(scheduleKeyPrefix, es.entityKind), es.namespace)
+}
+
+// scheduleMember returns the schedule member of the action of the entity key.
+func (es *EntityStore[T, PT]) scheduleMember(entityKey string, action string) (string, error) {
+	if action == "" {
+		return "", errors.New("entitystore: scheduled action must not be empty")
+	}
+	kb := es.NewKeyBuilder()
+	kb.WithKey(entityKey)
+	if _, err := kb.BuildAndReset(); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal([2]string{action, entityKey})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// ScheduleAt schedules the action of the entity key at the time, e.g. to archive a draft 7 days
+// after it was created. When the action is due, RunScheduler triggers the OnDue event of the action
+// with the entity key. Scheduling an already scheduled action of the entity key reschedules it.
+//
+// Scheduled actions are independent of the stored entities, so they aren't removed with the entities.
+func (es *EntityStore[T, PT]) ScheduleAt(ctx context.Context, entityKey string, when time.Time, action string) error {
+	member, err := es.scheduleMember(entityKey, action)
+	if err != nil {
+		return err
+	}
+	return es.dsClient.IndexAdd(ctx, es.scheduleKey(), datastore.IndexMember{
+		Member: member,
+		Score:  float64(when.UnixMilli()),
+	})
+}
+
+// Unschedule removes the scheduled action of the entity key. It's a no-op if the action isn't scheduled.
+func (es *EntityStore[T, PT]) Unschedule(ctx context.Context, entityKey string, action string) error {
+	member, err := es.scheduleMember(entityKey, action)
+	if err != nil {
+		return err
+	}
+	return es.dsClient.IndexRemove(ctx, es.scheduleKey(), member)
+}
+
+// OnDue returns the event target of the action, triggered by RunScheduler with the keys of the
+// entities the action is due for.
+func (es *EntityStore[T, PT]) OnDue(action string) *eventTarget {
+	es.dueMu.Lock()
+	defer es.dueMu.Unlock()
+	if es.onDue == nil {
+		es.onDue = make(map[string]*eventTarget)
+	}
+	target, ok := es.onDue[action]
+	if !ok {
+		target = newEventTarget(EntitiesDue, es.opts.corruptionHandler)
+		es.onDue[action] = target
+	}
+	return target
+}
+
+// RunScheduler polls the schedule at the interval and triggers the OnDue events of the due actions,
+// until the context is done. Each due action is removed from the schedule before its event is
+// triggered, so with multiple schedulers running, e.g. one per process, each action is triggered
+// once, and an action isn't triggered again if its listener fails. Due actions without an OnDue
+// listener are dropped, so add the listeners before running the scheduler.
+func (es *EntityStore[T, PT]) RunScheduler(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("entitystore: scheduler interval must be positive")
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := es.triggerDue(ctx, time.Now()); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// triggerDue removes the actions due at the time from the schedule and triggers their OnDue events.
+func (es *EntityStore[T, PT]) triggerDue(ctx context.Context, now time.Time) error {
+	for {
+		members, err := es.dsClient.IndexPopByScore(ctx, es.scheduleKey(), float64(now.UnixMilli()), schedulePopCount)
+		if err != nil {
+			return err
+		}
+		var actions []string
+		due := make(map[string][]string)
+		for _, m := range members {
+			var v [2]string
+			if err := json.Unmarshal([]byte(m.Member), &v); err != nil {
+				es.opts.corruptionHandler(fmt.Errorf("%w: scheduled action '%s': %w", datastore.ErrCorruptedData, m.Member, err))
+				continue
+			}
+			action, entityKey := v[0], v[1]
+			if _, ok := due[action]; !ok {
+				actions = append(actions, action)
+			}
+			due[action] = append(due[action], entityKey)
+		}
+		for _, action := range actions {
+			if !es.OnDue(action).emit(ctx, due[action]) {
+				es.opts.metrics.Count(MetricDueDropped, int64(len(due[action])), es.metricLabels()...)
+			}
+		}
+		if len(members) < schedulePopCount {
+			return nil
+		}
+	}
+}
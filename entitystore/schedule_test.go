@@ -0,0 +1,117 @@
+package entitystore
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/metrics"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntityStoreSchedule(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	recorder := metrics.NewMemoryRecorder()
+	store, err := New[testutil.Entity](
+		string(keyfactory.EntityKindTest),
+		keyfactory.GenerateRandomKey(),
+		dsClient,
+		WithMetrics(recorder),
+	)
+	require.NoError(t, err)
+	draft := func(id string) string { return testutil.NewEntity(id, mockTenantId, 1).Key }
+
+	var mu sync.Mutex
+	var archived []string
+	store.OnDue("archive").AddListener(func(ctx context.Context, keys []string) {
+		mu.Lock()
+		defer mu.Unlock()
+		archived = append(archived, keys...)
+	})
+	takeArchived := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		keys := archived
+		archived = nil
+		return keys
+	}
+
+	t.Run("Should validate scheduled action", func(t *testing.T) {
+		assert.Error(t, store.ScheduleAt(ctx, draft("d-1"), time.Now(), ""))
+		assert.Error(t, store.ScheduleAt(ctx, "", time.Now(), "archive"))
+	})
+
+	t.Run("Should trigger due actions in due order", func(t *testing.T) {
+		now := time.Now()
+		require.NoError(t, store.ScheduleAt(ctx, draft("d-1"), now.Add(-time.Minute), "archive"))
+		require.NoError(t, store.ScheduleAt(ctx, draft("d-2"), now.Add(-time.Hour), "archive"))
+		require.NoError(t, store.ScheduleAt(ctx, draft("d-3"), now.Add(time.Hour), "archive"))
+
+		require.NoError(t, store.triggerDue(ctx, now))
+		assert.Equal(t, []string{draft("d-2"), draft("d-1")}, takeArchived())
+		require.NoError(t, store.triggerDue(ctx, now))
+		assert.Empty(t, takeArchived(), "should trigger due actions once")
+		require.NoError(t, store.triggerDue(ctx, now.Add(2*time.Hour)))
+		assert.Equal(t, []string{draft("d-3")}, takeArchived())
+	})
+
+	t.Run("Should reschedule and unschedule", func(t *testing.T) {
+		now := time.Now()
+		require.NoError(t, store.ScheduleAt(ctx, draft("d-1"), now.Add(-time.Minute), "archive"))
+		require.NoError(t, store.ScheduleAt(ctx, draft("d-1"), now.Add(time.Hour), "archive"))
+		require.NoError(t, store.ScheduleAt(ctx, draft("d-2"), now.Add(-time.Minute), "archive"))
+		require.NoError(t, store.Unschedule(ctx, draft("d-2"), "archive"))
+
+		require.NoError(t, store.triggerDue(ctx, now))
+		assert.Empty(t, takeArchived())
+		require.NoError(t, store.Unschedule(ctx, draft("d-1"), "archive"))
+	})
+
+	t.Run("Should drop due actions without listener", func(t *testing.T) {
+		require.NoError(t, store.ScheduleAt(ctx, draft("d-1"), time.Now().Add(-time.Minute), "publish"))
+		require.NoError(t, store.triggerDue(ctx, time.Now()))
+		assert.Empty(t, takeArchived())
+		assert.Equal(t, int64(1), recorder.Counter(
+			MetricDueDropped,
+			metrics.Label{Name: "kind", Value: string(keyfactory.EntityKindTest)},
+		))
+	})
+
+	t.Run("Should not be removed with entities", func(t *testing.T) {
+		e := testutil.NewEntity("d-1", mockTenantId, 1)
+		_, err := store.Add(ctx, e, 0)
+		require.NoError(t, err)
+		require.NoError(t, store.ScheduleAt(ctx, e.Key, time.Now().Add(-time.Minute), "archive"))
+		require.NoError(t, store.RemoveAll(ctx, mockTenantKey))
+		require.NoError(t, store.triggerDue(ctx, time.Now()))
+		assert.Equal(t, []string{e.Key}, takeArchived())
+	})
+
+	t.Run("Should run scheduler until context is done", func(t *testing.T) {
+		require.NoError(t, store.ScheduleAt(ctx, draft("d-1"), time.Now().Add(20*time.Millisecond), "archive"))
+		runCtx, cancel := context.WithCancel(ctx)
+		done := make(chan error)
+		go func() {
+			done <- store.RunScheduler(runCtx, 5*time.Millisecond)
+		}()
+		assert.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(archived) == 1
+		}, time.Second, 5*time.Millisecond)
+		cancel()
+		assert.ErrorIs(t, <-done, context.Canceled)
+		assert.Equal(t, []string{draft("d-1")}, takeArchived())
+		assert.Error(t, store.RunScheduler(ctx, 0))
+	})
+}
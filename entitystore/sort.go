@@ -0,0 +1,111 @@
+package entitystore
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+// OrderBy is the field entities are ordered by.
+type OrderBy int
+
+const (
+	OrderByKey       OrderBy = iota // Order by entity key.
+	OrderByUpdatedAt                // Order by entity update time, see UpdatedAtGetter.
+)
+
+// Direction is the sort direction.
+type Direction int
+
+const (
+	Ascending Direction = iota
+	Descending
+)
+
+// GetAllSorted is like GetAll, but the entities are returned in a deterministic order.
+//
+// Ordering by update time requires the entities to implement UpdatedAtGetter. If the store
+// maintains an index (see WithIndex) the order is read from the index, otherwise the entities
+// are sorted in memory. Entities with the same update time are ordered by key.
+//
+// NOTE: This is a blocking operation.
+func (es *EntityStore[T, PT]) GetAllSorted(
+	ctx context.Context,
+	parentKey string,
+	orderBy OrderBy,
+	direction Direction,
+) ([]PT, error) {
+	switch orderBy {
+	case OrderByKey:
+		entities, err := es.GetAll(ctx, parentKey)
+		if err != nil {
+			return nil, err
+		}
+		slices.SortFunc(entities, func(a, b PT) int {
+			return direction.apply(strings.Compare(a.GetKey(), b.GetKey()))
+		})
+		return entities, nil
+	case OrderByUpdatedAt:
+		if !es.hasUpdatedAt() {
+			return nil, fmt.Errorf("entitystore: order by updated at: entity %T doesn't implement UpdatedAtGetter", *new(T))
+		}
+		if es.opts.index {
+			return es.getAllByUpdatedAtIndex(ctx, parentKey, direction)
+		}
+		entities, err := es.GetAll(ctx, parentKey)
+		if err != nil {
+			return nil, err
+		}
+		slices.SortFunc(entities, func(a, b PT) int {
+			c := cmp.Compare(any(a).(UpdatedAtGetter).GetUpdatedAt(), any(b).(UpdatedAtGetter).GetUpdatedAt())
+			if c == 0 {
+				c = strings.Compare(a.GetKey(), b.GetKey())
+			}
+			return direction.apply(c)
+		})
+		return entities, nil
+	default:
+		return nil, fmt.Errorf("entitystore: invalid order by %d", orderBy)
+	}
+}
+
+// getAllByUpdatedAtIndex retrieves all entities under the parent key in the order of the updated at index.
+func (es *EntityStore[T, PT]) getAllByUpdatedAtIndex(
+	ctx context.Context,
+	parentKey string,
+	direction Direction,
+) ([]PT, error) {
+	members, err := es.dsClient.IndexRange(ctx, es.updatedAtIndexKey(), direction == Descending)
+	if err != nil {
+		return nil, err
+	}
+	kb := es.NewKeyBuilder()
+	keys := make([]*keyfactory.Key, 0, len(members))
+	for _, m := range members {
+		if !es.isEntityKey(parentKey, m) {
+			continue
+		}
+		kb.WithKey(m)
+		key, err := kb.BuildAndReset()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if es.opts.getAllLimit > 0 && len(keys) > es.opts.getAllLimit {
+		return nil, fmt.Errorf("%w: %d entities exceed limit %d", ErrTooManyEntities, len(keys), es.opts.getAllLimit)
+	}
+	return es.getMulti(ctx, keys)
+}
+
+// apply applies the direction to the result of an ascending comparison.
+func (d Direction) apply(c int) int {
+	if d == Descending {
+		return -c
+	}
+	return c
+}
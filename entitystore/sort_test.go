@@ -0,0 +1,77 @@
+package entitystore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntityStoreGetAllSorted(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	entities, _ := generateTestEntities(t, 3, mockTenantId)
+	// Update times in reverse key order.
+	entities[0].UpdatedAt = 300
+	entities[1].UpdatedAt = 200
+	entities[2].UpdatedAt = 100
+
+	getIDs := func(entities []*TestEntity) []string {
+		ids := make([]string, len(entities))
+		for i, e := range entities {
+			ids[i] = e.Id
+		}
+		return ids
+	}
+
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{name: "In memory"},
+		{name: "With index", opts: []Option{WithIndex()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store, err := New[TestEntity](
+				string(keyfactory.EntityKindTest),
+				keyfactory.GenerateRandomKey(),
+				dsClient,
+				tc.opts...,
+			)
+			require.NoError(t, err)
+			_, err = store.AddBatch(ctx, entities, 0)
+			require.NoError(t, err)
+
+			sorted, err := store.GetAllSorted(ctx, mockTenantKey, OrderByKey, Ascending)
+			require.NoError(t, err)
+			assert.Equal(t, []string{entities[0].Id, entities[1].Id, entities[2].Id}, getIDs(sorted))
+
+			sorted, err = store.GetAllSorted(ctx, mockTenantKey, OrderByKey, Descending)
+			require.NoError(t, err)
+			assert.Equal(t, []string{entities[2].Id, entities[1].Id, entities[0].Id}, getIDs(sorted))
+
+			sorted, err = store.GetAllSorted(ctx, mockTenantKey, OrderByUpdatedAt, Ascending)
+			require.NoError(t, err)
+			assert.Equal(t, []string{entities[2].Id, entities[1].Id, entities[0].Id}, getIDs(sorted))
+
+			sorted, err = store.GetAllSorted(ctx, mockTenantKey, OrderByUpdatedAt, Descending)
+			require.NoError(t, err)
+			assert.Equal(t, []string{entities[0].Id, entities[1].Id, entities[2].Id}, getIDs(sorted))
+		})
+	}
+
+	t.Run("Entity without update time", func(t *testing.T) {
+		store, err := New[mockEntity](string(keyfactory.EntityKindTest), keyfactory.GenerateRandomKey(), dsClient)
+		require.NoError(t, err)
+		_, err = store.GetAllSorted(ctx, mockTenantKey, OrderByUpdatedAt, Ascending)
+		assert.Error(t, err)
+	})
+}
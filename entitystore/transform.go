@@ -0,0 +1,28 @@
+package entitystore
+
+import "fmt"
+
+// TransformOnRead adds a transformation applied to each entity read from the store after it's
+// decoded, e.g. to fix up legacy field values lazily during a migration window instead of
+// rewriting all stored entities. Transformations are applied in the order they were added, and
+// must be idempotent since entities written back keep their transformed values.
+// If a transformation fails, the read of the entity fails with its error.
+//
+// The stored entities are unchanged until they're written back.
+func (es *EntityStore[T, PT]) TransformOnRead(fn func(PT) error) {
+	es.readMu.Lock()
+	defer es.readMu.Unlock()
+	es.readTransforms = append(es.readTransforms, fn)
+}
+
+// transformOnRead applies the read transformations to the decoded entity.
+func (es *EntityStore[T, PT]) transformOnRead(entityKey string, entity PT) error {
+	es.readMu.RLock()
+	defer es.readMu.RUnlock()
+	for _, fn := range es.readTransforms {
+		if err := fn(entity); err != nil {
+			return fmt.Errorf("entitystore: transform of entity '%s' on read: %w", entityKey, err)
+		}
+	}
+	return nil
+}
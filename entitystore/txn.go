@@ -0,0 +1,180 @@
+package entitystore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+// Txn stages adds and removes of entities of a store, and commits them atomically in a datastore
+// transaction, so either all staged writes are applied, or none. The events of the staged writes
+// are only triggered after a successful commit. Use WithTxn to stage the writes of multiple stores
+// sharing a datastore client in one transaction.
+//
+// Removing an entity referenced by a reference with OnDeleteBlock is rejected when it's staged,
+// but other references of removed entities aren't handled (see AddReference). The store index is
+// updated after the commit, like with Add and Remove.
+//
+// NOTE: Transactions aren't supported with content addressing (see WithContentAddressing).
+type Txn[T Entity, PT SerializableEntity[T]] struct {
+	es  *EntityStore[T, PT]
+	txn *datastore.Txn
+
+	mu          sync.Mutex
+	added       []PT
+	addedKeys   []string
+	addedData   [][]byte
+	previous    []PT
+	removedKeys []string
+	removeKeys  []*keyfactory.Key
+	removeOps   []*datastore.TxnOp
+}
+
+// NewTxn returns a new transaction of the store.
+//
+// Example:
+//
+//	txn := store.NewTxn()
+//	if err := txn.Add(ctx, entity, 0); err != nil {...}
+//	if err := txn.Remove(ctx, oldKey); err != nil {...}
+//	err := txn.Commit(ctx)
+func (es *EntityStore[T, PT]) NewTxn() *Txn[T, PT] {
+	tx, _ := es.WithTxn(es.dsClient.NewTxn()) // A new transaction can't be committed yet.
+	return tx
+}
+
+// WithTxn returns a transaction of the store staging its writes in the datastore transaction,
+// e.g. shared by the transactions of multiple stores to commit their writes together with
+// datastore.Txn.Commit. The datastore transaction must be of the store's datastore client.
+//
+// Example:
+//
+//	dsTxn := dsClient.NewTxn()
+//	orders, _ := orderStore.WithTxn(dsTxn)
+//	items, _ := itemStore.WithTxn(dsTxn)
+//	...
+//	err := dsTxn.Commit(ctx)
+func (es *EntityStore[T, PT]) WithTxn(txn *datastore.Txn) (*Txn[T, PT], error) {
+	if txn.Client() != es.dsClient {
+		return nil, errors.New("entitystore: transaction of another datastore client")
+	}
+	tx := &Txn[T, PT]{es: es, txn: txn}
+	if err := txn.OnCommit(tx.committed); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// Add stages adding the entity, like EntityStore.Add.
+func (tx *Txn[T, PT]) Add(ctx context.Context, entity T, expiration time.Duration) error {
+	es := tx.es
+	if err := es.checkContentAddressing("transaction"); err != nil {
+		return err
+	}
+	if err := es.checkParentKey(ctx, entity.GetKey()); err != nil {
+		return err
+	}
+	if err := es.authorize(ctx, AccessWrite, []string{entity.GetKey()}); err != nil {
+		return err
+	}
+	kb := es.NewKeyBuilder()
+	kb.WithKey(entity.GetKey())
+	key, err := kb.BuildAndReset()
+	if err != nil {
+		return err
+	}
+	data, err := es.encode(PT(&entity))
+	if err != nil {
+		return err
+	}
+	if err := es.firstCollision(ctx, []*keyfactory.Key{key}, []PT{&entity}); err != nil {
+		return err
+	}
+	previous, err := es.loadPrevious(ctx, []*keyfactory.Key{key})
+	if err != nil {
+		return err
+	}
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if _, err := tx.txn.Put(key, data, expiration); err != nil {
+		return err
+	}
+	tx.added = append(tx.added, &entity)
+	tx.addedKeys = append(tx.addedKeys, entity.GetKey())
+	tx.addedData = append(tx.addedData, data)
+	tx.previous = append(tx.previous, previous...)
+	return nil
+}
+
+// Remove stages removing the entity by key, like EntityStore.Remove. It returns an error wrapping
+// ErrReferenced if the entity is referenced by a reference with OnDeleteBlock.
+func (tx *Txn[T, PT]) Remove(ctx context.Context, entityKey string) error {
+	if entityKey == "" {
+		return nil // No-op for empty key.
+	}
+	es := tx.es
+	if err := es.checkContentAddressing("transaction"); err != nil {
+		return err
+	}
+	kb := es.NewKeyBuilder()
+	kb.WithKey(entityKey)
+	key, err := kb.BuildAndReset()
+	if err != nil {
+		return err
+	}
+	if err := es.authorize(ctx, AccessWrite, []string{entityKey}); err != nil {
+		return err
+	}
+	if _, err := es.dependents(ctx, []string{entityKey}); err != nil {
+		return err
+	}
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	op, err := tx.txn.Delete(key)
+	if err != nil {
+		return err
+	}
+	tx.removedKeys = append(tx.removedKeys, entityKey)
+	tx.removeKeys = append(tx.removeKeys, key)
+	tx.removeOps = append(tx.removeOps, op)
+	return nil
+}
+
+// Commit commits the datastore transaction, including the writes staged by other stores sharing it.
+func (tx *Txn[T, PT]) Commit(ctx context.Context) error {
+	return tx.txn.Commit(ctx)
+}
+
+// committed updates the store index and triggers the events of the committed writes.
+// The removes are handled even if updating the index of the adds failed, and the errors are joined.
+func (tx *Txn[T, PT]) committed(ctx context.Context) error {
+	es := tx.es
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	var errs []error
+	if len(tx.added) > 0 {
+		if err := es.indexAdd(ctx, tx.added...); err != nil {
+			errs = append(errs, err)
+		} else {
+			es.observeSizes(ctx, tx.addedKeys, tx.addedData)
+			es.onAdded.emit(ctx, tx.addedKeys)
+			es.emitUpdates(ctx, tx.previous, tx.added)
+			es.checkQuotas(ctx, tx.addedKeys)
+		}
+	}
+	if len(tx.removeOps) > 0 {
+		deleted := make([]bool, len(tx.removeOps))
+		for i, op := range tx.removeOps {
+			deleted[i] = op.Deleted()
+		}
+		_, err := es.deleteKeys(ctx, tx.removedKeys, tx.removeKeys, func(context.Context, []*keyfactory.Key) ([]bool, error) {
+			return deleted, nil // Deleted by the transaction.
+		})
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
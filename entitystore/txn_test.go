@@ -0,0 +1,176 @@
+package entitystore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntityStoreTxn(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	newStore := func(t *testing.T, dsClient *datastore.Client, opts ...Option) (*EntityStore[testutil.Entity, *testutil.Entity], *[]string, *[]string) {
+		store, err := New[testutil.Entity](string(keyfactory.EntityKindTest), keyfactory.GenerateRandomKey(), dsClient, opts...)
+		require.NoError(t, err)
+		var added, removed []string
+		store.OnAdded().AddListener(func(ctx context.Context, keys []string) { added = append(added, keys...) })
+		store.OnRemoved().AddListener(func(ctx context.Context, keys []string) { removed = append(removed, keys...) })
+		return store, &added, &removed
+	}
+	e1, e2, e3 := testutil.NewEntity("e-1", mockTenantId, 1), testutil.NewEntity("e-2", mockTenantId, 1), testutil.NewEntity("e-3", mockTenantId, 1)
+
+	t.Run("Should commit writes and trigger events after commit", func(t *testing.T) {
+		store, added, removed := newStore(t, dsClient)
+		_, err := store.Add(ctx, e3, 0)
+		require.NoError(t, err)
+		*added = nil
+
+		txn := store.NewTxn()
+		require.NoError(t, txn.Add(ctx, e1, 0))
+		require.NoError(t, txn.Add(ctx, e2, 0))
+		require.NoError(t, txn.Remove(ctx, e3.Key))
+		require.NoError(t, txn.Remove(ctx, "missing"))
+		exists, err := store.Exists(ctx, e1.Key)
+		require.NoError(t, err)
+		assert.False(t, exists, "should not write before commit")
+		assert.Empty(t, *added)
+		assert.Empty(t, *removed)
+
+		require.NoError(t, txn.Commit(ctx))
+		assert.Equal(t, []string{e1.Key, e2.Key}, *added)
+		assert.Equal(t, []string{e3.Key}, *removed, "should only trigger removed event of existing entities")
+		entities, err := store.GetByKeys(ctx, []string{e1.Key, e2.Key, e3.Key})
+		require.NoError(t, err)
+		assert.Len(t, entities, 2)
+
+		assert.Error(t, txn.Commit(ctx), "should not commit twice")
+		assert.Error(t, txn.Add(ctx, e3, 0), "should not stage after commit")
+	})
+
+	t.Run("Should commit writes of multiple stores together", func(t *testing.T) {
+		store1, added1, _ := newStore(t, dsClient)
+		store2, _, removed2 := newStore(t, dsClient)
+		_, err := store2.Add(ctx, e1, 0)
+		require.NoError(t, err)
+
+		dsTxn := dsClient.NewTxn()
+		txn1, err := store1.WithTxn(dsTxn)
+		require.NoError(t, err)
+		txn2, err := store2.WithTxn(dsTxn)
+		require.NoError(t, err)
+		require.NoError(t, txn1.Add(ctx, e1, 0))
+		require.NoError(t, txn2.Remove(ctx, e1.Key))
+		require.NoError(t, dsTxn.Commit(ctx))
+
+		assert.Equal(t, []string{e1.Key}, *added1)
+		assert.Equal(t, []string{e1.Key}, *removed2)
+		exists, err := store1.Exists(ctx, e1.Key)
+		require.NoError(t, err)
+		assert.True(t, exists)
+		exists, err = store2.Exists(ctx, e1.Key)
+		require.NoError(t, err)
+		assert.False(t, exists)
+
+		otherClient, err := datastore.NewClient(rsClient)
+		require.NoError(t, err)
+		_, err = store1.WithTxn(otherClient.NewTxn())
+		assert.Error(t, err, "should reject transaction of another client")
+	})
+
+	t.Run("Should not trigger events if commit fails", func(t *testing.T) {
+		closedClient := redis.NewClient(rsClient.Options())
+		require.NoError(t, closedClient.Close())
+		closedDS, err := datastore.NewClient(closedClient)
+		require.NoError(t, err)
+		store, added, _ := newStore(t, closedDS)
+		txn := store.NewTxn()
+		require.NoError(t, txn.Add(ctx, e1, 0))
+		assert.Error(t, txn.Commit(ctx))
+		assert.Empty(t, *added)
+	})
+
+	t.Run("Should reject removing blocked references", func(t *testing.T) {
+		products, _, _ := newStore(t, dsClient)
+		orders, _, _ := newStore(t, dsClient)
+		_, err := AddReference("order-product", orders, products, func(e *testutil.Entity) []string {
+			return []string{e.Data}
+		}, OnDeleteBlock)
+		require.NoError(t, err)
+		_, err = products.Add(ctx, e1, 0)
+		require.NoError(t, err)
+		order := e2
+		order.Data = e1.Key
+		_, err = orders.Add(ctx, order, 0)
+		require.NoError(t, err)
+
+		txn := products.NewTxn()
+		assert.ErrorIs(t, txn.Remove(ctx, e1.Key), ErrReferenced)
+		require.NoError(t, txn.Commit(ctx))
+		ok, err := products.Exists(ctx, e1.Key)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("Should handle removes if the index of adds fails", func(t *testing.T) {
+		failing := redis.NewClient(rsClient.Options())
+		defer failing.Close()
+		failing.AddHook(failCommandHook{name: "zadd"})
+		dsClient, err := datastore.NewClient(failing)
+		require.NoError(t, err)
+		store, added, removed := newStore(t, dsClient, WithIndex())
+		_, err = store.Add(ctx, e1, 0)
+		require.Error(t, err, "should fail to index the added entity")
+		*added = nil
+
+		txn := store.NewTxn()
+		require.NoError(t, txn.Add(ctx, e2, 0))
+		require.NoError(t, txn.Remove(ctx, e1.Key))
+		assert.Error(t, txn.Commit(ctx))
+		assert.Empty(t, *added, "should not trigger events of adds missing from the index")
+		assert.Equal(t, []string{e1.Key}, *removed)
+	})
+
+	t.Run("Should reject content addressing", func(t *testing.T) {
+		store, _, _ := newStore(t, dsClient, WithContentAddressing())
+		assert.ErrorIs(t, store.NewTxn().Add(ctx, e1, 0), ErrContentAddressed)
+	})
+}
+
+// failCommandHook is a Redis hook failing the commands of the name.
+type failCommandHook struct {
+	name string
+}
+
+func (h failCommandHook) check(cmds ...redis.Cmder) error {
+	for _, cmd := range cmds {
+		if cmd.Name() == h.name {
+			return errors.New("failed " + h.name)
+		}
+	}
+	return nil
+}
+
+func (h failCommandHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, h.check(cmd)
+}
+
+func (failCommandHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error { return nil }
+
+func (h failCommandHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, h.check(cmds...)
+}
+
+func (failCommandHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
@@ -0,0 +1,193 @@
+package entitystore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+// UpdateProgress reports the progress of an UpdateWhere or Reencode call.
+type UpdateProgress struct {
+	Scanned   int // Number of entities scanned.
+	Matched   int // Number of scanned entities matching the filter.
+	Updated   int // Number of matched entities written.
+	Conflicts int // Number of matched entities skipped since they changed or were removed after being read.
+	Denied    int // Number of matched entities skipped since the context may not write them (see WithAuthorizer).
+}
+
+// WithVersionCheck only writes a mutated entity if the stored entity is unchanged since it was read.
+// Entities modified concurrently are skipped and reported as conflicts.
+// Applies to UpdateWhere.
+func WithVersionCheck() ScanOption {
+	return func(o *scanOptions) {
+		o.versionCheck = true
+	}
+}
+
+// WithProgress sets the function called with the progress after each written chunk.
+// Applies to UpdateWhere and Reencode.
+func WithProgress(fn func(UpdateProgress)) ScanOption {
+	return func(o *scanOptions) {
+		o.progress = fn
+	}
+}
+
+// UpdateWhere scans all entities under the parent key, applies the mutation to the entities matching
+// the filter, and writes the mutated entities back to the store in chunks, keeping their expiration.
+// It triggers the EntitiesUpdated event for each written chunk.
+//
+// The mutation must not change the entity key. Entities are scanned without blocking the datastore,
+// but entities added or removed during the scan may be missed. Use WithCheckpoint to make a
+// long-running update resumable. With an authorizer, matched entities the context may not write
+// are skipped and reported as denied.
+func (es *EntityStore[T, PT]) UpdateWhere(
+	ctx context.Context,
+	parentKey string,
+	filter func(PT) bool,
+	mutate func(PT),
+	opts ...ScanOption,
+) (UpdateProgress, error) {
+	if err := es.checkContentAddressing("update where"); err != nil {
+		return UpdateProgress{}, err
+	}
+	ctx = background(ctx)
+	o := newScanOptions(opts)
+	var progress UpdateProgress
+	err := es.scanChunks(ctx, parentKey, o, func(keys []*keyfactory.Key) error {
+		return es.updateChunk(ctx, keys, filter, mutate, o, &progress)
+	})
+	return progress, err
+}
+
+// updateChunk mutates and writes back the entities of the keys matching the filter.
+func (es *EntityStore[T, PT]) updateChunk(
+	ctx context.Context,
+	keys []*keyfactory.Key,
+	filter func(PT) bool,
+	mutate func(PT),
+	o scanOptions,
+	progress *UpdateProgress,
+) error {
+	data, err := es.getMultiAligned(ctx, keys)
+	if err != nil {
+		return err
+	}
+	if err := o.limiter.Wait(ctx, 0, dataSize(data)); err != nil {
+		return err
+	}
+	var (
+		writeKeys []*keyfactory.Key
+		expected  [][]byte
+		newData   [][]byte
+		entities  []PT
+	)
+	for i, d := range data {
+		if d == nil {
+			continue // Removed since the scan.
+		}
+		progress.Scanned++
+		entityKey := keys[i].Key()
+		entity := PT(new(T))
+		if err := es.decode(entityKey, d, entity); err != nil {
+			return err
+		}
+		if !filter(entity) {
+			continue
+		}
+		progress.Matched++
+		mutate(entity)
+		if entity.GetKey() != entityKey {
+			return fmt.Errorf("entitystore: update of entity '%s' changed its key to '%s'", entityKey, entity.GetKey())
+		}
+		nd, err := es.encode(entity)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(nd, d) {
+			continue // Unchanged by the mutation.
+		}
+		writeKeys = append(writeKeys, keys[i])
+		expected = append(expected, bytes.Clone(d))
+		newData = append(newData, nd)
+		entities = append(entities, entity)
+	}
+	if len(writeKeys) == 0 {
+		return nil
+	}
+	denied, err := es.authorizeKeys(ctx, writeKeys)
+	if err != nil {
+		return err
+	}
+	if denied != nil {
+		progress.Denied += len(writeKeys) - countNil(denied)
+		writeKeys = withoutDenied(writeKeys, denied)
+		expected = withoutDenied(expected, denied)
+		newData = withoutDenied(newData, denied)
+		entities = withoutDenied(entities, denied)
+		if len(writeKeys) == 0 {
+			return nil
+		}
+	}
+	if !o.versionCheck {
+		expected = nil
+	}
+	swapped, err := es.dsClient.CompareAndSwapMulti(ctx, writeKeys, expected, newData)
+	if err != nil {
+		return err
+	}
+	var updatedKeys []string
+	var updated []PT
+	for i, ok := range swapped {
+		if !ok {
+			progress.Conflicts++
+			continue
+		}
+		updatedKeys = append(updatedKeys, entities[i].GetKey())
+		updated = append(updated, entities[i])
+	}
+	progress.Updated += len(updated)
+	if err := es.indexAdd(ctx, updated...); err != nil {
+		return err
+	}
+	if len(updatedKeys) > 0 {
+		es.onUpdated.emit(ctx, updatedKeys)
+	}
+	if o.progress != nil {
+		o.progress(*progress)
+	}
+	return nil
+}
+
+// authorizeKeys authorizes writing the entities of the keys, see authorizeAligned.
+func (es *EntityStore[T, PT]) authorizeKeys(ctx context.Context, keys []*keyfactory.Key) ([]error, error) {
+	entityKeys := make([]string, len(keys))
+	for i, key := range keys {
+		entityKeys[i] = key.Key()
+	}
+	return es.authorizeAligned(ctx, AccessWrite, entityKeys)
+}
+
+// withoutDenied returns the elements of s whose aligned error in denied is nil, reusing s.
+func withoutDenied[E any](s []E, denied []error) []E {
+	n := 0
+	for i, e := range s {
+		if denied[i] == nil {
+			s[n] = e
+			n++
+		}
+	}
+	return s[:n]
+}
+
+// countNil returns the number of nil errors.
+func countNil(errs []error) int {
+	n := 0
+	for _, err := range errs {
+		if err == nil {
+			n++
+		}
+	}
+	return n
+}
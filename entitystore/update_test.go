@@ -0,0 +1,98 @@
+package entitystore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntityStoreUpdateWhere(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	defer server.Close()
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	setup := func(t *testing.T) *EntityStore[testutil.Entity, *testutil.Entity] {
+		t.Helper()
+		store, err := New[testutil.Entity](string(keyfactory.EntityKindTest), keyfactory.GenerateRandomKey(), dsClient)
+		require.NoError(t, err)
+		entities := []testutil.Entity{
+			testutil.NewEntity("e-1", mockTenantId, 1),
+			testutil.NewEntity("e-2", mockTenantId, 2),
+			testutil.NewEntity("e-3", mockTenantId, 3),
+		}
+		_, err = store.AddBatch(ctx, entities, time.Hour)
+		require.NoError(t, err)
+		return store
+	}
+	isOld := func(e *testutil.Entity) bool { return e.UpdatedAt < 3 }
+	markMigrated := func(e *testutil.Entity) { e.Data = "migrated" }
+
+	t.Run("Updates matching entities", func(t *testing.T) {
+		store := setup(t)
+		var updatedKeys []string
+		store.OnUpdated().AddListener(func(ctx context.Context, keys []string) {
+			updatedKeys = append(updatedKeys, keys...)
+		})
+		var reports []UpdateProgress
+		progress, err := store.UpdateWhere(ctx, mockTenantKey, isOld, markMigrated,
+			WithChunkSize(1),
+			WithProgress(func(p UpdateProgress) { reports = append(reports, p) }),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, UpdateProgress{Scanned: 3, Matched: 2, Updated: 2}, progress)
+		assert.NotEmpty(t, reports)
+		assert.Len(t, updatedKeys, 2)
+
+		all, err := store.GetAll(ctx, mockTenantKey)
+		require.NoError(t, err)
+		for _, e := range all {
+			if e.UpdatedAt < 3 {
+				assert.Equal(t, "migrated", e.Data)
+			} else {
+				assert.Empty(t, e.Data)
+			}
+		}
+		for _, key := range server.Keys() {
+			assert.Greater(t, server.TTL(key), time.Duration(0), "should keep expiration")
+		}
+	})
+
+	t.Run("Version check conflicts", func(t *testing.T) {
+		store := setup(t)
+		e1 := testutil.NewEntity("e-1", mockTenantId, 1)
+		progress, err := store.UpdateWhere(ctx, mockTenantKey,
+			func(e *testutil.Entity) bool {
+				if e.Key == e1.Key {
+					// Modify the entity concurrently after it was read.
+					changed := e1
+					changed.Data = "concurrent"
+					_, err := store.Add(ctx, changed, 0)
+					require.NoError(t, err)
+				}
+				return isOld(e)
+			},
+			markMigrated,
+			WithVersionCheck(),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, 1, progress.Conflicts)
+		assert.Equal(t, 1, progress.Updated)
+		e, err := store.Get(ctx, e1.Key)
+		require.NoError(t, err)
+		assert.Equal(t, "concurrent", e.Data, "should not overwrite concurrent change")
+	})
+
+	t.Run("Changed key", func(t *testing.T) {
+		store := setup(t)
+		_, err := store.UpdateWhere(ctx, mockTenantKey, isOld, func(e *testutil.Entity) { e.Key = "other" })
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,123 @@
+package entitystore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+const (
+	DefaultVerifySampleSize = 100 // Default number of keys sampled by Verify.
+	maxVerifyErrors         = 5   // Max number of key errors included in a Verify error.
+)
+
+// VerifyOption configures Verify.
+type VerifyOption func(*verifyOptions)
+
+type verifyOptions struct {
+	sampleSize      int
+	requireEntities bool
+}
+
+// WithSampleSize sets the max number of keys sampled by Verify. Defaults to DefaultVerifySampleSize.
+func WithSampleSize(n int) VerifyOption {
+	return func(o *verifyOptions) {
+		if n > 0 {
+			o.sampleSize = n
+		}
+	}
+}
+
+// RequireEntities makes Verify fail if no entities are found, e.g. since the store is configured
+// with the wrong namespace. Use for stores that are never empty.
+func RequireEntities() VerifyOption {
+	return func(o *verifyOptions) {
+		o.requireEntities = true
+	}
+}
+
+// Verify samples the keys of the store's entity kind in the key namespace and verifies that each
+// key is a valid key laid out by the store's key strategy, and that its entity decodes with the
+// store's codec, so a misconfigured store, e.g. with the wrong codec or key strategy, is caught
+// at startup rather than by the first read in production.
+// An error wrapping ErrVerifyFailed is returned if any sampled key fails verification.
+//
+// Keys are sampled with a partial scan of the namespace, so verification is cheap, but doesn't
+// find every incompatible key. The scan is tagged as background traffic, like full scans.
+func (es *EntityStore[T, PT]) Verify(ctx context.Context, opts ...VerifyOption) error {
+	o := verifyOptions{sampleSize: DefaultVerifySampleSize}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	ctx = background(ctx)
+	keyMatch := es.unscopedKeyMatch()
+	var keys []*keyfactory.Key
+	seen := make(map[string]struct{})
+	cursor := uint64(0)
+	for {
+		page, nextCursor, err := es.dsClient.GetKeysWithCursor(ctx, cursor, o.sampleSize, keyMatch)
+		if err != nil {
+			return err
+		}
+		for _, key := range page {
+			if _, ok := seen[key.Key()]; ok || !es.isUnscopedEntityKey(key.Key()) || len(keys) == o.sampleSize {
+				continue
+			}
+			seen[key.Key()] = struct{}{}
+			keys = append(keys, key)
+		}
+		cursor = nextCursor
+		if cursor == 0 || len(keys) == o.sampleSize {
+			break
+		}
+	}
+	if len(keys) == 0 {
+		if o.requireEntities {
+			return fmt.Errorf("%w: no entities of kind '%s' in namespace '%s'", ErrVerifyFailed, es.entityKind, es.namespace)
+		}
+		return nil
+	}
+
+	data, err := es.getMultiAligned(ctx, keys)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	failed := 0
+	for i, key := range keys {
+		if data[i] == nil {
+			continue // Removed since the scan.
+		}
+		err := es.verifyKey(key.Key())
+		if err == nil {
+			err = es.decode(key.Key(), data[i], PT(new(T)))
+		}
+		if err != nil {
+			failed++
+			if len(errs) < maxVerifyErrors {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%w: %d of %d sampled keys: %w", ErrVerifyFailed, failed, len(keys), errors.Join(errs...))
+	}
+	return nil
+}
+
+// verifyKey verifies that the entity key is a valid key laid out by the store's key strategy.
+func (es *EntityStore[T, PT]) verifyKey(entityKey string) error {
+	kb := es.NewKeyBuilder()
+	kb.WithKey(entityKey)
+	if _, err := kb.BuildAndReset(); err != nil {
+		return err
+	}
+	parentKey, _, ok := strings.Cut(entityKey, ":"+es.entityKind+":")
+	if ok && es.opts.keyStrategy.ParentKey(parentKey) != parentKey {
+		return fmt.Errorf("entitystore: key '%s' isn't laid out by the store's key strategy", entityKey)
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package entitystore
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+const (
+	MetricVersionsPruned = "entitystore_versions_pruned_total" // Counter of entity versions removed by PruneVersions.
+
+	// LatestVersionId is the version ID of the alias key holding the latest published version
+	// of an entity, see PublishVersion. It isn't a version itself.
+	LatestVersionId = "latest"
+)
+
+// VersionPolicy is the retention of entity versions, see PruneVersions.
+// The latest version of an entity is always retained.
+type VersionPolicy struct {
+	KeepLatest int           // Number of latest versions retained per entity, or 0 for no limit.
+	MaxAge     time.Duration // Age after which versions are pruned, or 0 for no limit. Requires VersionTime.
+
+	// VersionTime returns the creation time of a version from its version ID,
+	// or false if it's unknown, in which case the version isn't pruned by age.
+	VersionTime func(entityVersionId string) (time.Time, bool)
+}
+
+func (p VersionPolicy) validate() error {
+	if p.KeepLatest < 0 {
+		return errors.New("entitystore: version policy must not keep a negative number of versions")
+	}
+	if p.MaxAge < 0 {
+		return errors.New("entitystore: version policy must not have a negative max age")
+	}
+	if p.MaxAge > 0 && p.VersionTime == nil {
+		return errors.New("entitystore: version policy with a max age requires a version time")
+	}
+	if p.KeepLatest == 0 && p.MaxAge == 0 {
+		return errors.New("entitystore: version policy must keep a number of versions or have a max age")
+	}
+	return nil
+}
+
+// compareVersions orders version IDs, comparing numeric IDs by value and other IDs lexicographically,
+// so both counters and sortable IDs, e.g. timestamps or ULIDs, order from oldest to newest.
+func compareVersions(a, b string) int {
+	an, aErr := strconv.ParseUint(a, 10, 64)
+	bn, bErr := strconv.ParseUint(b, 10, 64)
+	if aErr == nil && bErr == nil {
+		return cmp.Compare(an, bn)
+	}
+	return strings.Compare(a, b)
+}
+
+// splitVersion splits an entity key under the parent key into its entity ID and version ID.
+// It returns false for keys without a version and keys of nested entities.
+func (es *EntityStore[T, PT]) splitVersion(parentKey, entityKey string) (string, string, bool) {
+	prefix := keyfactory.BuildRedisKey(es.opts.keyStrategy.ParentKey(parentKey), es.entityKind) + ":"
+	if parentKey == "" {
+		prefix = es.entityKind + ":"
+	}
+	rest, ok := strings.CutPrefix(entityKey, prefix)
+	if !ok {
+		return "", "", false
+	}
+	id, version, ok := strings.Cut(rest, ":")
+	if !ok || id == "" || version == "" || version == LatestVersionId || strings.Contains(version, ":") {
+		return "", "", false
+	}
+	return id, version, true
+}
+
+// cutVersion cuts the version ID off a versioned entity key of the store's kind, i.e. a key ending
+// with the entity kind, entity ID, and version ID. It returns false for keys without a version ID,
+// keys of the LatestVersionId alias, and keys of other kinds.
+func (es *EntityStore[T, PT]) cutVersion(entityKey string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(entityKey, es.entityKind+":")
+	if i := strings.LastIndex(entityKey, ":"+es.entityKind+":"); i >= 0 {
+		rest, ok = entityKey[i+len(es.entityKind)+2:], true
+	}
+	if !ok {
+		return "", "", false
+	}
+	id, version, ok := strings.Cut(rest, ":")
+	if !ok || id == "" || version == "" || version == LatestVersionId || strings.Contains(version, ":") {
+		return "", "", false
+	}
+	return entityKey[:len(entityKey)-len(version)-1], version, true
+}
+
+// PruneVersions removes the versions of the versioned entities under the parent key that aren't
+// retained by the policy, and returns the number of removed versions.
+// Versions are keys with an entity version ID (see keyfactory.NewEntityKey), grouped by entity ID
+// and ordered from oldest to newest by version ID, comparing numeric IDs by value. A version is
+// removed if it isn't one of the KeepLatest latest versions, or is older than MaxAge.
+// The latest version of an entity is always retained, and keys without a version are ignored.
+//
+// Versions are discovered with a full scan of the parent key, so it's meant to run as a periodic
+// background job. Removed versions are emitted as OnRemoved events and counted by the
+// MetricVersionsPruned metric. Only WithChunkSize is applied of the scan options.
+func (es *EntityStore[T, PT]) PruneVersions(
+	ctx context.Context,
+	parentKey string,
+	policy VersionPolicy,
+	opts ...ScanOption,
+) (int, error) {
+	if err := policy.validate(); err != nil {
+		return 0, err
+	}
+	ctx = background(ctx)
+	o := newScanOptions(opts)
+	o.checkpoint = "" // Versions are grouped over the full scan.
+
+	type version struct {
+		id  string
+		key *keyfactory.Key
+	}
+	versions := make(map[string][]version) // Versions of each entity ID.
+	err := es.scanChunks(ctx, parentKey, o, func(keys []*keyfactory.Key) error {
+		for _, key := range keys {
+			if id, v, ok := es.splitVersion(parentKey, key.Key()); ok {
+				versions[id] = append(versions[id], version{id: v, key: key})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	var keys []*keyfactory.Key
+	for _, vs := range versions {
+		slices.SortFunc(vs, func(a, b version) int { return compareVersions(b.id, a.id) }) // Newest first.
+		for i, v := range vs[1:] {
+			if policy.KeepLatest > 0 && i+1 >= policy.KeepLatest {
+				keys = append(keys, v.key)
+				continue
+			}
+			if policy.MaxAge > 0 {
+				if t, ok := policy.VersionTime(v.id); ok && now.Sub(t) > policy.MaxAge {
+					keys = append(keys, v.key)
+				}
+			}
+		}
+	}
+
+	pruned := 0
+	for chunk := range slices.Chunk(keys, o.chunkSize) {
+		entityKeys := make([]string, len(chunk))
+		for i, key := range chunk {
+			entityKeys[i] = key.Key()
+		}
+		removed, err := es.removeKeys(ctx, entityKeys, chunk)
+		pruned += len(removed)
+		es.opts.metrics.Count(MetricVersionsPruned, int64(len(removed)), es.metricLabels()...)
+		if err != nil {
+			return pruned, err
+		}
+	}
+	return pruned, nil
+}
+
+// GetLatest retrieves the latest version of the versioned entity with the ID under the parent key.
+// The latest version published with PublishVersion is read from its alias key. Otherwise versions
+// are keys with an entity version ID (see keyfactory.NewEntityKey), ordered by version ID as in
+// PruneVersions. If the latest version is removed while it's retrieved, the next latest version
+// is returned.
+// An error wrapping datastore.ErrKeyNotFound is returned if the entity has no versions in the store.
+//
+// NOTE: Versions are discovered with a scan of the entity's keys, prefer reading a known version
+// with Get on hot paths.
+func (es *EntityStore[T, PT]) GetLatest(ctx context.Context, parentKey, entityId string) (PT, error) {
+	entityKey, err := es.EntityKey(entityId, "", parentKey)
+	if err != nil {
+		return nil, err
+	}
+	latest, err := es.Get(ctx, keyfactory.BuildRedisKey(entityKey, LatestVersionId))
+	if !errors.Is(err, datastore.ErrKeyNotFound) {
+		return latest, err
+	}
+	kb := es.NewKeyBuilder()
+	kb.WithKey(entityKey)
+	kb.WithWildcard(keyfactory.WildcardAnyString)
+	keyMatch, err := kb.BuildAndReset()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := es.dsClient.ScanKeys(ctx, keyMatch)
+	if err != nil {
+		return nil, err
+	}
+	var versions []string
+	for _, key := range keys {
+		version, ok := strings.CutPrefix(key.Key(), entityKey+":")
+		if ok && version != "" && version != LatestVersionId && !strings.Contains(version, ":") { // Skip keys of nested entities.
+			versions = append(versions, version)
+		}
+	}
+	slices.SortFunc(versions, func(a, b string) int { return compareVersions(b, a) }) // Newest first.
+	for _, version := range versions {
+		entity, err := es.Get(ctx, entityKey+":"+version)
+		if errors.Is(err, datastore.ErrKeyNotFound) {
+			continue
+		}
+		return entity, err
+	}
+	return nil, fmt.Errorf("%w: no versions of entity '%s'", datastore.ErrKeyNotFound, entityKey)
+}
+
+// LatestEntityKey returns the alias key of the latest version of the entity with the ID under
+// the parent key, see PublishVersion.
+func (es *EntityStore[T, PT]) LatestEntityKey(entityId, parentKey string) (string, error) {
+	return es.EntityKey(entityId, LatestVersionId, parentKey)
+}
+
+// PublishVersion adds a new version of an entity to the store, and atomically updates the alias
+// key of the entity's latest version to it, so readers have a stable key (see LatestEntityKey)
+// while writers add immutable versions.
+// The entity key must be a versioned key of the store's kind, e.g. from EntityKey with a version
+// ID other than LatestVersionId; its version ID is replaced with LatestVersionId to get the alias
+// key. The alias is updated to the published version even if a newer version exists, so versions
+// should be published in order.
+//
+// The OnAdded event is emitted with the version key and the alias key.
+//
+// NOTE: In Redis Cluster, the version and alias keys must have the same hash tag, e.g. entities
+// under a parent laid out by keyfactory.HashTaggedKeyStrategy, otherwise publishing fails.
+func (es *EntityStore[T, PT]) PublishVersion(ctx context.Context, entity T) error {
+	entityKey := entity.GetKey()
+	unversionedKey, _, ok := es.cutVersion(entityKey)
+	if !ok {
+		return fmt.Errorf("entitystore: %w: key '%s' isn't a versioned entity key", keyfactory.ErrInvalidKey, entityKey)
+	}
+	latestKey := keyfactory.BuildRedisKey(unversionedKey, LatestVersionId)
+	if err := es.checkParentKey(ctx, entityKey); err != nil {
+		return err
+	}
+	if err := es.authorize(ctx, AccessWrite, []string{entityKey, latestKey}); err != nil {
+		return err
+	}
+	kb := es.NewKeyBuilder()
+	keys := make([]*keyfactory.Key, 2)
+	for j, eKey := range []string{entityKey, latestKey} {
+		kb.WithKey(eKey)
+		key, err := kb.BuildAndReset()
+		if err != nil {
+			return err
+		}
+		keys[j] = key
+	}
+	data, err := es.encode(PT(&entity))
+	if err != nil {
+		return err
+	}
+	if err := es.firstCollision(ctx, keys[:1], []PT{&entity}); err != nil {
+		return err
+	}
+	// A single MSET, so readers of the alias never see a version that isn't stored.
+	put := es.dsClient.PutMultiAtomic
+	if es.opts.contentAddressing {
+		put = es.putMulti // Atomic script.
+	}
+	if err := put(ctx, keys, [][]byte{data, data}, 0); err != nil {
+		return err
+	}
+	if err := es.indexAdd(ctx, &entity); err != nil {
+		return err
+	}
+	es.observeSizes(ctx, []string{entityKey}, [][]byte{data})
+	es.onAdded.emit(ctx, []string{entityKey, latestKey})
+	return nil
+}
@@ -10,24 +10,32 @@
 //	token := e.AddListener("my-event", func(args ...any) { fmt.Println(args...) })
 //	e.Emit("my-event", 1, 2, 3) // Output: 1 2 3
 //	e.RemoveListener("my-event", token)
+//	e.Close()
 package eventemitter
 
 import (
-	"math/rand"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
 	"slices"
+	"strconv"
 	"sync"
 )
 
+// ErrClosed is returned when emitting an event on a closed emitter.
+var ErrClosed = errors.New("eventemitter: closed")
+
 // ListenerToken is the token returned when a listener is added.
+// Tokens are unique per emitter, and unpredictable across emitters.
 type ListenerToken string
 
-func generateToken() ListenerToken {
-	const letters = "abcdefghijklmnopqrstuvwxyz0123456789"
-	key := make([]byte, 6)
-	for i := range key {
-		key[i] = letters[rand.Intn(len(letters))]
-	}
-	return ListenerToken(key)
+// newTokenPrefix returns a random token prefix, so tokens of different emitters don't collide.
+func newTokenPrefix() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b) // Never returns an error.
+	return hex.EncodeToString(b)
 }
 
 // EventTarget instance represents an event target tied to a specific event name.
@@ -36,8 +44,8 @@ type EventTarget struct {
 	eventName    string
 }
 
-func NewEventTarget(eventName string) *EventTarget {
-	return &EventTarget{New(), eventName}
+func NewEventTarget(eventName string, opts ...Option) *EventTarget {
+	return &EventTarget{New(opts...), eventName}
 }
 
 func (et *EventTarget) EventName() string {
@@ -60,11 +68,38 @@ func (et *EventTarget) Emit(args ...any) bool {
 	return et.eventEmitter.Emit(et.eventName, args...)
 }
 
+func (et *EventTarget) EmitContext(ctx context.Context, args ...any) (EmitReport, error) {
+	return et.eventEmitter.EmitContext(ctx, et.eventName, args...)
+}
+
+func (et *EventTarget) ListenerCount() int {
+	return et.eventEmitter.ListenerCount(et.eventName)
+}
+
+func (et *EventTarget) Close() {
+	et.eventEmitter.Close()
+}
+
+// Option configures an EventEmitter.
+type Option func(*EventEmitter)
+
+// WithLeakLogging makes Close log the number of listeners of each event still registered,
+// to detect listeners that were never removed.
+func WithLeakLogging() Option {
+	return func(e *EventEmitter) {
+		e.logLeaks = true
+	}
+}
+
 // EventEmitter instance instance supports adding multiple named events
 // and is safe for concurrent use.
 type EventEmitter struct {
-	mu     sync.RWMutex
-	events map[string][]eventListener
+	mu          sync.RWMutex
+	events      map[string][]eventListener
+	tokenPrefix string
+	nextToken   uint64 // Counter guaranteeing unique tokens, guarded by mu.
+	closed      bool
+	logLeaks    bool
 }
 
 type eventListener struct {
@@ -73,18 +108,29 @@ type eventListener struct {
 }
 
 // New creates a new EventEmitter instance.
-func New() *EventEmitter {
-	return &EventEmitter{
-		events: make(map[string][]eventListener),
+func New(opts ...Option) *EventEmitter {
+	e := &EventEmitter{
+		events:      make(map[string][]eventListener),
+		tokenPrefix: newTokenPrefix(),
+	}
+	for _, opt := range opts {
+		opt(e)
 	}
+	return e
 }
 
 // AddListener adds a listener function to a specific event.
+// If the emitter is closed the listener isn't added and an empty token is returned.
 func (e *EventEmitter) AddListener(eventName string, listener func(args ...any)) ListenerToken {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	token := generateToken()
+	if e.closed {
+		return ""
+	}
+
+	e.nextToken++
+	token := ListenerToken(e.tokenPrefix + "-" + strconv.FormatUint(e.nextToken, 36))
 	e.events[eventName] = append(e.events[eventName], eventListener{
 		token:   token,
 		handler: listener,
@@ -123,6 +169,7 @@ func (e *EventEmitter) RemoveAllListeners(eventName string) bool {
 }
 
 // Emit calls each listener synchronously for the given event, passing any provided args.
+// It returns false if no listener was called, e.g. if the emitter is closed.
 func (e *EventEmitter) Emit(eventName string, args ...any) bool {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
@@ -136,3 +183,61 @@ func (e *EventEmitter) Emit(eventName string, args ...any) bool {
 	}
 	return true
 }
+
+// EmitReport reports the listeners called by EmitContext.
+type EmitReport struct {
+	Called  int // Number of called listeners.
+	Skipped int // Number of listeners skipped since the context was done.
+}
+
+// EmitContext is like Emit, but checks the context before calling each listener and skips the
+// remaining listeners once the context is done.
+// It returns the context error if any listener was skipped.
+func (e *EventEmitter) EmitContext(ctx context.Context, eventName string, args ...any) (EmitReport, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.closed {
+		return EmitReport{}, ErrClosed
+	}
+	listeners := e.events[eventName]
+	var report EmitReport
+	for i, listener := range listeners {
+		if err := ctx.Err(); err != nil {
+			report.Skipped = len(listeners) - i
+			return report, err
+		}
+		listener.handler(args...)
+		report.Called++
+	}
+	return report, nil
+}
+
+// ListenerCount returns the number of listeners of the event.
+func (e *EventEmitter) ListenerCount(eventName string) int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return len(e.events[eventName])
+}
+
+// Close removes all listeners and rejects further AddListener and Emit calls.
+// With WithLeakLogging, listeners still registered are logged.
+// It's a no-op if the emitter is already closed.
+func (e *EventEmitter) Close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return
+	}
+	e.closed = true
+	if e.logLeaks {
+		for eventName, listeners := range e.events {
+			if len(listeners) > 0 {
+				log.Printf("eventemitter: closed with %d listeners of event '%s' still registered", len(listeners), eventName)
+			}
+		}
+	}
+	clear(e.events)
+}
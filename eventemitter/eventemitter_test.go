@@ -1,6 +1,10 @@
 package eventemitter
 
 import (
+	"bytes"
+	"context"
+	"log"
+	"os"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -147,6 +151,99 @@ func TestEventEmitter(t *testing.T) {
 		testutil.WaitGroupWithTimeout(t, &wg, time.Second)
 		assert.Equal(t, numListeners, int(called.Load()), "should have called each asynchronous listener")
 	})
+
+	t.Run("Emit with context", func(t *testing.T) {
+		e := New()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		called := 0
+		e.AddListener("tick", func(args ...any) { called++ })
+		e.AddListener("tick", func(args ...any) {
+			called++
+			cancel()
+		})
+		e.AddListener("tick", func(args ...any) { called++ })
+		e.AddListener("tick", func(args ...any) { called++ })
+
+		report, err := e.EmitContext(ctx, "tick")
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, EmitReport{Called: 2, Skipped: 2}, report, "should skip listeners after cancellation")
+		assert.Equal(t, 2, called)
+
+		report, err = e.EmitContext(context.Background(), "tick")
+		assert.NoError(t, err)
+		assert.Equal(t, EmitReport{Called: 4}, report)
+		assert.Equal(t, 6, called)
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		var buf bytes.Buffer
+		log.SetOutput(&buf)
+		defer log.SetOutput(os.Stderr)
+
+		e := New(WithLeakLogging())
+		called := false
+		e.AddListener("tick", func(args ...any) { called = true })
+		e.AddListener("tick", func(args ...any) { called = true })
+		assert.Equal(t, 2, e.ListenerCount("tick"))
+		e.Close()
+		assert.Contains(t, buf.String(), "2 listeners of event 'tick'", "should log leaked listeners")
+		assert.Zero(t, e.ListenerCount("tick"), "should remove listeners")
+
+		assert.Zero(t, e.AddListener("tick", func(args ...any) { called = true }), "should reject listener")
+		assert.Zero(t, e.ListenerCount("tick"))
+		assert.False(t, e.Emit("tick"), "should not emit")
+		_, err := e.EmitContext(context.Background(), "tick")
+		assert.ErrorIs(t, err, ErrClosed)
+		assert.False(t, called)
+		e.Close() // No-op.
+	})
+
+	t.Run("Unique tokens", func(t *testing.T) {
+		e := New()
+		tokens := make(map[ListenerToken]struct{})
+		for i := 0; i < 10000; i++ {
+			token := e.AddListener("tick", func(args ...any) {})
+			_, ok := tokens[token]
+			assert.False(t, ok, "should not return duplicate token")
+			tokens[token] = struct{}{}
+		}
+		other := New().AddListener("tick", func(args ...any) {})
+		_, ok := tokens[other]
+		assert.False(t, ok, "should not collide with tokens of other emitters")
+		assert.False(t, e.RemoveListener("tick", other), "should not remove listener by token of other emitter")
+	})
+
+	t.Run("Remove listeners under registration churn", func(t *testing.T) {
+		e := New()
+		const numWorkers = 50
+		const numListeners = 200
+		var wg sync.WaitGroup
+		var kept atomic.Int32
+		var called atomic.Int32
+
+		for i := 0; i < numWorkers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				tokens := make([]ListenerToken, numListeners)
+				for j := range tokens {
+					tokens[j] = e.AddListener("tick", func(args ...any) { called.Add(1) })
+				}
+				for j, token := range tokens {
+					if j%2 == 0 {
+						kept.Add(1)
+						continue
+					}
+					assert.True(t, e.RemoveListener("tick", token), "should remove own listener")
+					assert.False(t, e.RemoveListener("tick", token), "should not remove listener twice")
+				}
+			}()
+		}
+		testutil.WaitGroupWithTimeout(t, &wg, 5*time.Second)
+		e.Emit("tick")
+		assert.Equal(t, kept.Load(), called.Load(), "should only call listeners that weren't removed")
+	})
 }
 
 func TestEventTarget(t *testing.T) {
@@ -156,6 +253,18 @@ func TestEventTarget(t *testing.T) {
 		assert.Equal(t, name, et.EventName(), "should return correct event name")
 	})
 
+	t.Run("Listener count and close", func(t *testing.T) {
+		et := NewEventTarget("test-event")
+		token := et.AddListener(func(args ...any) {})
+		et.AddListener(func(args ...any) {})
+		assert.Equal(t, 2, et.ListenerCount())
+		et.RemoveListener(token)
+		assert.Equal(t, 1, et.ListenerCount())
+		et.Close()
+		assert.Zero(t, et.ListenerCount())
+		assert.False(t, et.Emit())
+	})
+
 	t.Run("Add listener and emit event", func(t *testing.T) {
 		et := NewEventTarget("test-event")
 		called := false
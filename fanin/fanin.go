@@ -0,0 +1,82 @@
+// Package fanin merges the entity change events of many stores into one stream tagged with
+// the entity kind, so platform-level components, e.g. audit logs, cache buses, and webhooks,
+// subscribe once instead of per store instance.
+//
+//	agg := fanin.New()
+//	detachUsers := fanin.Attach(agg, userStore, "user")
+//	detachOrders := fanin.Attach(agg, orderStore, "order")
+//	agg.AddListener(func(ctx context.Context, event fanin.Event) {
+//		log.Printf("%s %s: %v", event.Kind, event.Type, event.Keys)
+//	})
+package fanin
+
+import (
+	"context"
+
+	"github.com/holmberd/go-entitystore/entitystore"
+	"github.com/holmberd/go-entitystore/eventemitter"
+)
+
+// Event is an entity change event of a store attached to an aggregator.
+type Event struct {
+	Kind string            // Entity kind the store was attached with.
+	Type entitystore.Event // Type of the event, e.g. entitystore.EntitiesAdded.
+	Keys []string          // Keys of the changed entities, empty for entitystore.EntitiesFlushed.
+}
+
+// Listener is called with each event of the attached stores.
+type Listener func(ctx context.Context, event Event)
+
+// Aggregator is an event target merging the events of the attached stores.
+// Listeners are called synchronously in the store event listeners, as store listeners are.
+type Aggregator struct {
+	t *eventemitter.EventTarget
+}
+
+// New creates a new instance of an Aggregator.
+func New() *Aggregator {
+	return &Aggregator{t: eventemitter.NewEventTarget("entitystore.fanin")}
+}
+
+// AddListener adds a listener called with the events of all attached stores.
+func (a *Aggregator) AddListener(listener Listener) eventemitter.ListenerToken {
+	return a.t.AddListener(func(args ...any) {
+		ctx, _ := args[0].(context.Context)
+		event, _ := args[1].(Event)
+		listener(ctx, event)
+	})
+}
+
+// RemoveListener removes the listener of the token. It returns whether the listener was found.
+func (a *Aggregator) RemoveListener(token eventemitter.ListenerToken) bool {
+	return a.t.RemoveListener(token)
+}
+
+// emit emits the event to the aggregator's listeners.
+func (a *Aggregator) emit(ctx context.Context, event Event) {
+	a.t.Emit(ctx, event)
+}
+
+// Attach forwards the added, updated, removed, and flushed events of the store to the aggregator,
+// tagged with the entity kind. It returns a function detaching the store from the aggregator.
+func Attach[T entitystore.Entity, PT entitystore.SerializableEntity[T]](
+	agg *Aggregator,
+	store entitystore.EntityStorer[T, PT],
+	kind string,
+) (detach func()) {
+	forward := func(eventType entitystore.Event) entitystore.EntityStoreListener {
+		return func(ctx context.Context, keys []string) {
+			agg.emit(ctx, Event{Kind: kind, Type: eventType, Keys: keys})
+		}
+	}
+	addedToken := store.OnAdded().AddListener(forward(entitystore.EntitiesAdded))
+	updatedToken := store.OnUpdated().AddListener(forward(entitystore.EntitiesUpdated))
+	removedToken := store.OnRemoved().AddListener(forward(entitystore.EntitiesRemoved))
+	flushedToken := store.OnFlushed().AddListener(forward(entitystore.EntitiesFlushed))
+	return func() {
+		store.OnAdded().RemoveListener(addedToken)
+		store.OnUpdated().RemoveListener(updatedToken)
+		store.OnRemoved().RemoveListener(removedToken)
+		store.OnFlushed().RemoveListener(flushedToken)
+	}
+}
@@ -0,0 +1,59 @@
+package fanin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/entitystore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/holmberd/go-entitystore/testutil/storetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregator(t *testing.T) {
+	ctx := context.Background()
+	rsClient, _ := testutil.NewRedisClientWithCleanup(t)
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	users := storetest.NewIsolatedStore[testutil.Entity](t, dsClient, string(keyfactory.EntityKindTest), entitystore.WithAllowFlush())
+	orders := storetest.NewIsolatedStore[testutil.Entity](t, dsClient, string(keyfactory.EntityKindTest), entitystore.WithAllowFlush())
+
+	agg := New()
+	detachUsers := Attach(agg, users, "user")
+	detachOrders := Attach(agg, orders, "order")
+	var events []Event
+	token := agg.AddListener(func(ctx context.Context, event Event) { events = append(events, event) })
+
+	e1 := testutil.NewEntity("e-1", "acme", 1)
+	_, err = users.Add(ctx, e1, 0)
+	require.NoError(t, err)
+	_, err = orders.Add(ctx, e1, 0)
+	require.NoError(t, err)
+	require.NoError(t, orders.Remove(ctx, e1.Key))
+	require.NoError(t, users.Flush(ctx))
+	assert.Equal(t, []Event{
+		{Kind: "user", Type: entitystore.EntitiesAdded, Keys: []string{e1.Key}},
+		{Kind: "order", Type: entitystore.EntitiesAdded, Keys: []string{e1.Key}},
+		{Kind: "order", Type: entitystore.EntitiesRemoved, Keys: []string{e1.Key}},
+		{Kind: "user", Type: entitystore.EntitiesFlushed, Keys: []string{}},
+	}, events)
+
+	events = nil
+	detachUsers()
+	_, err = users.Add(ctx, e1, 0)
+	require.NoError(t, err)
+	assert.Empty(t, events, "should not forward events of detached stores")
+	_, err = orders.Add(ctx, e1, 0)
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+
+	events = nil
+	assert.True(t, agg.RemoveListener(token))
+	_, err = orders.Add(ctx, e1, 0)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+	detachOrders()
+}
@@ -26,7 +26,7 @@ func validateEntityKind(k EntityKind) error {
 			return nil
 		}
 	}
-	return fmt.Errorf("keyfactory: invalid entity kind: %q", k)
+	return fmt.Errorf("keyfactory: %w: invalid entity kind: %q", ErrInvalidKey, k)
 }
 
 // NewTenantKey returns a new structured logical tenant key.
@@ -61,10 +61,10 @@ func NewEntityKey(
 		return "", err
 	}
 	if entityKind == "" {
-		return "", fmt.Errorf("keyfactory: entity kind must not be empty")
+		return "", fmt.Errorf("keyfactory: %w: entity kind must not be empty", ErrInvalidKey)
 	}
 	if entityId == "" {
-		return "", fmt.Errorf("keyfactory: entity ID must not be empty")
+		return "", fmt.Errorf("keyfactory: %w: entity ID must not be empty", ErrInvalidKey)
 	}
 	if err := validateKeyFragments(string(entityKind), entityId, entityVersionId, parentEntityKey); err != nil {
 		return "", fmt.Errorf("keyfactory: %w", err)
@@ -0,0 +1,33 @@
+package keyfactory
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+)
+
+// HashID returns the hex encoded SHA-1 hash of the ID.
+// The hash is a valid key fragment of fixed length for any ID, including IDs with arbitrary bytes
+// or pathological lengths, so it can be used as an entity ID in keys.
+func HashID(id string) string {
+	sum := sha1.Sum([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewHashedEntityKey is like NewEntityKey, but hashes the entity ID with HashID.
+//
+// The key doesn't contain the original entity ID, so entities must store it in their payload.
+//
+// Key structure:
+//
+//	<parentEntityKey>:<entityKind>:<sha1(entityId)>:<entityVersionId>
+func NewHashedEntityKey(
+	entityKind EntityKind,
+	entityId string,
+	entityVersionId string, // Optional entity state version ID.
+	parentEntityKey string, // Optional parent entity key.
+) (string, error) {
+	if entityId == "" {
+		return NewEntityKey(entityKind, entityId, entityVersionId, parentEntityKey) // Reports the empty ID.
+	}
+	return NewEntityKey(entityKind, HashID(entityId), entityVersionId, parentEntityKey)
+}
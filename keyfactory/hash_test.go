@@ -0,0 +1,59 @@
+package keyfactory
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNewHashedEntityKey(t *testing.T) {
+	tests := []struct {
+		name        string
+		entityId    string
+		parentKey   string
+		expectKey   string
+		expectError bool
+	}{
+		{
+			name:      "Plain ID",
+			entityId:  "123",
+			expectKey: "test_entity:40bd001563085fc35165329ea1ff5c5ecbdbbeef",
+		},
+		{
+			name:      "Binary ID with delimiters",
+			entityId:  "a:b\x00\xff*",
+			parentKey: "tenant:t1",
+			expectKey: "tenant:t1:test_entity:" + HashID("a:b\x00\xff*"),
+		},
+		{
+			name:      "Pathologically long ID",
+			entityId:  strings.Repeat("x", 10000),
+			expectKey: "test_entity:" + HashID(strings.Repeat("x", 10000)),
+		},
+		{
+			name:        "Empty ID",
+			entityId:    "",
+			expectError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := NewHashedEntityKey(EntityKindTest, tt.entityId, "", tt.parentKey)
+			if tt.expectError {
+				if !errors.Is(err, ErrInvalidKey) {
+					t.Fatalf("expected error wrapping ErrInvalidKey, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if key != tt.expectKey {
+				t.Errorf("expected key %q, got %q", tt.expectKey, key)
+			}
+		})
+	}
+	if HashID("a") == HashID("A") {
+		t.Error("expected hashes of IDs differing in case to differ")
+	}
+}
@@ -1,6 +1,7 @@
 package rediskey
 
 import (
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
@@ -15,12 +16,17 @@ const (
 	keyMaxLength                      = 1024 // Practical limit (avoid large keys).
 )
 
-var redisKeyRegex = regexp.MustCompile(`^[a-zA-Z0-9:_\-\*\?\[\]\(\),]+$`) // Allowed Redis key characters.
+var redisKeyRegex = regexp.MustCompile(`^[a-zA-Z0-9:_\-\*\?\[\]\(\),\{\}]+$`) // Allowed Redis key characters, including hash tag braces.
+
+// ErrInvalidKey is matched by every InvalidRedisKeyError using errors.Is.
+var ErrInvalidKey = errors.New("invalid key")
 
 type InvalidRedisKeyError string
 
 func (e InvalidRedisKeyError) Error() string { return "invalid redis key: " + string(e) }
 
+func (e InvalidRedisKeyError) Is(target error) bool { return target == ErrInvalidKey }
+
 // New constructs a valid Redis key string from the provided key fragments.
 //
 // Keys follow a structured format: <keyFragment1>:<keyFragment2>:...:<keyFragmentN>
@@ -13,11 +13,15 @@ import (
 )
 
 const (
-	WildcardAnyChar            = rediskey.WildcardAnyChar   // Matches exactly one character.
-	WildcardAnyString          = rediskey.WildcardAnyString // Matches zero or more characters.
-	ReservedNamespaceDelimiter = "__"                       // Delimiter placed before and after each namespace key.
+	WildcardAnyChar            = rediskey.WildcardAnyChar      // Matches exactly one character.
+	WildcardAnyString          = rediskey.WildcardAnyString    // Matches zero or more characters.
+	ReservedNamespaceDelimiter = "__"                          // Delimiter placed before and after each namespace key.
+	KeyFragmentDelimiter       = rediskey.KeyFragmentDelimiter // Delimiter between key fragments.
 )
 
+// ErrInvalidKey is returned (wrapped) by all key construction and validation failures.
+var ErrInvalidKey = rediskey.ErrInvalidKey
+
 func keyNamespace(ns string) string {
 	if ns == "" {
 		return ""
@@ -104,6 +108,7 @@ type KeyBuilder struct {
 	parentKey string                // Must be a valid Redis key.
 	wildcard  rediskey.GlobWildcard // For wildcard key matching.
 	namespace string                // Optional key namespace.
+	strategy  KeyStrategy           // Optional key strategy applied to the parent key.
 }
 
 func NewKeyBuilder() *KeyBuilder {
@@ -116,6 +121,7 @@ func (b *KeyBuilder) Clone() *KeyBuilder {
 		parentKey: b.parentKey,
 		wildcard:  b.wildcard,
 		namespace: b.namespace,
+		strategy:  b.strategy,
 	}
 }
 
@@ -135,11 +141,18 @@ func (b *KeyBuilder) WithNamespace(ns string) {
 	b.namespace = ns
 }
 
+// WithKeyStrategy sets the key strategy applied to the parent key, so key patterns match the
+// keys constructed by the strategy.
+func (b *KeyBuilder) WithKeyStrategy(s KeyStrategy) {
+	b.strategy = s
+}
+
 func (b *KeyBuilder) Reset() {
 	b.key = ""
 	b.parentKey = ""
 	b.wildcard = ""
 	b.namespace = ""
+	b.strategy = nil
 }
 
 // Build compiles the new key.
@@ -154,16 +167,23 @@ func (b *KeyBuilder) BuildAndReset() (*Key, error) {
 }
 
 func (b *KeyBuilder) build() (*Key, error) {
-	key := b.key
-	if err := validateOptionalKeys(key, b.parentKey, b.namespace); err != nil {
+	key, parentKey := b.key, b.parentKey
+	if b.strategy != nil && parentKey != "" {
+		parentKey = b.strategy.ParentKey(parentKey)
+	}
+	if err := validateOptionalKeys(key, parentKey, b.namespace); err != nil {
 		return nil, fmt.Errorf("keyfactory: %w", err)
 	}
-	key = rediskey.Build(b.parentKey, key)
+	key = rediskey.Build(parentKey, key)
 	if b.wildcard != "" {
-		key = rediskey.BuildMatchKeyPattern(key, b.wildcard)
+		if key == "" {
+			key = string(b.wildcard) // Match any key in the namespace.
+		} else {
+			key = rediskey.BuildMatchKeyPattern(key, b.wildcard)
+		}
 	}
 	if key == "" {
-		return nil, fmt.Errorf("keyfactory: key must not be empty")
+		return nil, fmt.Errorf("keyfactory: %w: key must not be empty", ErrInvalidKey)
 	}
 	return NewKey(key, b.namespace), nil
 }
@@ -184,6 +204,7 @@ func (b *KeyBuilderWithNamespace) Clone() *KeyBuilderWithNamespace {
 			parentKey: b.parentKey,
 			wildcard:  b.wildcard,
 			namespace: b.namespace,
+			strategy:  b.strategy,
 		},
 	}
 }
@@ -192,7 +213,7 @@ func (b *KeyBuilderWithNamespace) Reset() {
 	b.key = ""
 	b.parentKey = ""
 	b.wildcard = ""
-	// b.namespace is intentionally not reset.
+	// b.namespace and b.strategy are intentionally not reset.
 }
 
 func (b *KeyBuilderWithNamespace) BuildAndReset() (*Key, error) {
@@ -223,7 +244,8 @@ func validateKeyFragments(keyFragments ...string) error {
 		}
 		if strings.HasPrefix(keyFragment, ReservedNamespaceDelimiter) {
 			return fmt.Errorf(
-				"key fragment '%s' must not contain reserved namespace key prefix '%s'",
+				"%w: key fragment '%s' must not contain reserved namespace key prefix '%s'",
+				ErrInvalidKey,
 				keyFragment,
 				ReservedNamespaceDelimiter,
 			)
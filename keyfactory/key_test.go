@@ -1,6 +1,7 @@
 package keyfactory
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 
@@ -55,6 +56,12 @@ func TestRedisKeyBuilder(t *testing.T) {
 			wildcard:  WildcardAnyChar,
 			expectKey: fmt.Sprintf("tenant:tenant1:entity:%s", WildcardAnyChar),
 		},
+		{
+			name:         "Namespace with any string wildcard",
+			keyNamespace: "group1",
+			wildcard:     WildcardAnyString,
+			expectKey:    fmt.Sprintf("__group1__:%s", WildcardAnyString),
+		},
 		{
 			name:         "Key with invalid namespace",
 			keyNamespace: "__group",
@@ -91,6 +98,9 @@ func TestRedisKeyBuilder(t *testing.T) {
 			if tt.expectError && err == nil {
 				t.Errorf("expected an error but got nil")
 			}
+			if tt.expectError && err != nil && !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("expected error to wrap ErrInvalidKey, got: %v", err)
+			}
 			if !tt.expectError && err != nil {
 				t.Errorf("unexpected error: %v", err)
 			}
@@ -0,0 +1,138 @@
+package keyfactory
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/holmberd/go-entitystore/keyfactory/internal/rediskey"
+)
+
+// KeyStrategy is the layout of entity keys, e.g. how entity IDs are encoded into keys.
+type KeyStrategy interface {
+	// EntityKey returns the key of the entity, like NewEntityKey.
+	EntityKey(entityKind EntityKind, entityId, entityVersionId, parentEntityKey string) (string, error)
+
+	// ParentKey returns the parent key as it's laid out in entity keys, used to match the keys
+	// of the entities under the parent. It must return keys already in the layout unchanged.
+	ParentKey(parentEntityKey string) string
+}
+
+// PlainKeyStrategy lays out entity keys as NewEntityKey.
+// IDs must be valid key fragments and are lower-cased.
+type PlainKeyStrategy struct{}
+
+func (PlainKeyStrategy) EntityKey(entityKind EntityKind, entityId, entityVersionId, parentEntityKey string) (string, error) {
+	return NewEntityKey(entityKind, entityId, entityVersionId, parentEntityKey)
+}
+
+func (PlainKeyStrategy) ParentKey(parentEntityKey string) string {
+	return parentEntityKey
+}
+
+// EscapedKeyStrategy lays out entity keys as NewEntityKey, but escapes the entity ID with EscapeID,
+// so any ID is supported and IDs differing only in case have different keys.
+type EscapedKeyStrategy struct{}
+
+func (EscapedKeyStrategy) EntityKey(entityKind EntityKind, entityId, entityVersionId, parentEntityKey string) (string, error) {
+	if entityId == "" {
+		return NewEntityKey(entityKind, entityId, entityVersionId, parentEntityKey) // Reports the empty ID.
+	}
+	return NewEntityKey(entityKind, EscapeID(entityId), entityVersionId, parentEntityKey)
+}
+
+func (EscapedKeyStrategy) ParentKey(parentEntityKey string) string {
+	return parentEntityKey
+}
+
+// HashedKeyStrategy lays out entity keys as NewHashedEntityKey.
+// The key doesn't contain the original entity ID, so entities must store it in their payload.
+type HashedKeyStrategy struct{}
+
+func (HashedKeyStrategy) EntityKey(entityKind EntityKind, entityId, entityVersionId, parentEntityKey string) (string, error) {
+	return NewHashedEntityKey(entityKind, entityId, entityVersionId, parentEntityKey)
+}
+
+func (HashedKeyStrategy) ParentKey(parentEntityKey string) string {
+	return parentEntityKey
+}
+
+// HashTaggedKeyStrategy lays out entity keys as NewEntityKey, but wraps the top-level parent key in
+// a Redis Cluster hash tag, so all entities under a parent are stored in the same hash slot and
+// can be used together in multi-key commands.
+//
+// Key structure:
+//
+//	{<parentEntityKey>}:<entityKind>:<entityId>:<entityVersionId>
+type HashTaggedKeyStrategy struct{}
+
+func (HashTaggedKeyStrategy) EntityKey(entityKind EntityKind, entityId, entityVersionId, parentEntityKey string) (string, error) {
+	key, err := NewEntityKey(entityKind, entityId, entityVersionId, "")
+	if err != nil || parentEntityKey == "" {
+		return key, err
+	}
+	parentEntityKey = HashTaggedKeyStrategy{}.ParentKey(parentEntityKey)
+	if err := rediskey.Validate(parentEntityKey); err != nil {
+		return "", fmt.Errorf("keyfactory: %w", err)
+	}
+	return rediskey.Build(parentEntityKey, key), nil
+}
+
+func (HashTaggedKeyStrategy) ParentKey(parentEntityKey string) string {
+	if parentEntityKey == "" || strings.HasPrefix(parentEntityKey, "{") {
+		return parentEntityKey
+	}
+	return "{" + parentEntityKey + "}"
+}
+
+// HashTag returns the Redis Cluster hash tag of the key, i.e. the non-empty content of its first
+// '{' '}' pair, or an empty string if the key has none. Keys with the same hash tag are stored in
+// the same hash slot.
+func HashTag(key string) string {
+	start := strings.IndexByte(key, '{')
+	if start < 0 {
+		return ""
+	}
+	end := strings.IndexByte(key[start+1:], '}')
+	if end <= 0 {
+		return ""
+	}
+	return key[start+1 : start+1+end]
+}
+
+// EscapeID escapes the ID into a valid lower-case key fragment. Lower-case letters, digits, and
+// '-' are kept, and all other bytes are escaped as '_' followed by two hex digits.
+func EscapeID(id string) string {
+	var b strings.Builder
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-' {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('_')
+		b.WriteString(hex.EncodeToString([]byte{c}))
+	}
+	return b.String()
+}
+
+// UnescapeID returns the ID escaped by EscapeID.
+func UnescapeID(escaped string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(escaped); i++ {
+		if escaped[i] != '_' {
+			b.WriteByte(escaped[i])
+			continue
+		}
+		if i+2 >= len(escaped) {
+			return "", fmt.Errorf("keyfactory: %w: truncated escape in ID '%s'", ErrInvalidKey, escaped)
+		}
+		c, err := hex.DecodeString(escaped[i+1 : i+3])
+		if err != nil {
+			return "", fmt.Errorf("keyfactory: %w: invalid escape in ID '%s'", ErrInvalidKey, escaped)
+		}
+		b.WriteByte(c[0])
+		i += 2
+	}
+	return b.String(), nil
+}
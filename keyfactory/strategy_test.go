@@ -0,0 +1,141 @@
+package keyfactory
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestKeyStrategy(t *testing.T) {
+	tests := []struct {
+		name        string
+		strategy    KeyStrategy
+		entityId    string
+		parentKey   string
+		expectKey   string
+		expectError bool
+	}{
+		{
+			name:      "Plain",
+			strategy:  PlainKeyStrategy{},
+			entityId:  "ID1",
+			parentKey: "tenant:t1",
+			expectKey: "tenant:t1:test_entity:id1",
+		},
+		{
+			name:        "Plain with invalid ID",
+			strategy:    PlainKeyStrategy{},
+			entityId:    "a:b",
+			expectError: true,
+		},
+		{
+			name:      "Escaped",
+			strategy:  EscapedKeyStrategy{},
+			entityId:  "ID:1 *",
+			parentKey: "tenant:t1",
+			expectKey: "tenant:t1:test_entity:_49_44_3a1_20_2a",
+		},
+		{
+			name:      "Hashed",
+			strategy:  HashedKeyStrategy{},
+			entityId:  "123",
+			expectKey: "test_entity:40bd001563085fc35165329ea1ff5c5ecbdbbeef",
+		},
+		{
+			name:      "Hash tagged",
+			strategy:  HashTaggedKeyStrategy{},
+			entityId:  "1",
+			parentKey: "tenant:t1",
+			expectKey: "{tenant:t1}:test_entity:1",
+		},
+		{
+			name:      "Hash tagged with tagged parent",
+			strategy:  HashTaggedKeyStrategy{},
+			entityId:  "2",
+			parentKey: "{tenant:t1}:test_entity:1",
+			expectKey: "{tenant:t1}:test_entity:1:test_entity:2",
+		},
+		{
+			name:      "Hash tagged without parent",
+			strategy:  HashTaggedKeyStrategy{},
+			entityId:  "1",
+			expectKey: "test_entity:1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := tt.strategy.EntityKey(EntityKindTest, tt.entityId, "", tt.parentKey)
+			if tt.expectError {
+				if !errors.Is(err, ErrInvalidKey) {
+					t.Fatalf("expected error wrapping ErrInvalidKey, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if key != tt.expectKey {
+				t.Errorf("expected key %q, got %q", tt.expectKey, key)
+			}
+		})
+	}
+}
+
+func TestEscapeID(t *testing.T) {
+	for _, id := range []string{"", "abc-123", "ABC", "a:b_c", "\x00\xff{}*?"} {
+		escaped := EscapeID(id)
+		if err := ValidateKeyFragment(escaped); escaped != "" && err != nil {
+			t.Errorf("expected valid key fragment for %q, got %v", id, err)
+		}
+		unescaped, err := UnescapeID(escaped)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if unescaped != id {
+			t.Errorf("expected %q, got %q", id, unescaped)
+		}
+	}
+	for _, escaped := range []string{"_4", "_zz"} {
+		if _, err := UnescapeID(escaped); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("expected error wrapping ErrInvalidKey for %q, got %v", escaped, err)
+		}
+	}
+}
+
+func TestKeyBuilderWithKeyStrategy(t *testing.T) {
+	kb := NewKeyBuilderWithNamespace("ns")
+	kb.WithKeyStrategy(HashTaggedKeyStrategy{})
+	kb.WithParentKey("tenant:t1")
+	kb.WithKey(string(EntityKindTest))
+	kb.WithWildcard(WildcardAnyString)
+	key, err := kb.BuildAndReset()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if key.Key() != "{tenant:t1}:test_entity:*" {
+		t.Errorf("expected tagged parent key pattern, got %q", key.Key())
+	}
+	kb.WithParentKey("tenant:t1")
+	kb.WithKey(string(EntityKindTest))
+	key, err = kb.BuildAndReset()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if key.Key() != "{tenant:t1}:test_entity" {
+		t.Errorf("expected strategy to be kept across resets, got %q", key.Key())
+	}
+}
+
+func TestHashTag(t *testing.T) {
+	cases := map[string]string{
+		"ns:{tenant:t1}:test_entity:e1": "tenant:t1",
+		"{a}:{b}":                       "a",
+		"{}:{b}":                        "",
+		"tenant:t1":                     "",
+		"{tenant":                       "",
+	}
+	for key, expected := range cases {
+		if tag := HashTag(key); tag != expected {
+			t.Errorf("expected hash tag %q of %q, got %q", expected, key, tag)
+		}
+	}
+}
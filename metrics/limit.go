@@ -0,0 +1,63 @@
+package metrics
+
+import "sync"
+
+// OverflowLabelValue replaces label values exceeding the cardinality limit of LimitCardinality.
+const OverflowLabelValue = "_other"
+
+// cardinalityLimiter is a Recorder bounding the number of distinct values per label name.
+type cardinalityLimiter struct {
+	r         Recorder
+	maxValues int
+
+	mu     sync.Mutex
+	values map[string]map[string]struct{} // Seen values by label name.
+}
+
+// LimitCardinality returns a Recorder forwarding metrics to the recorder, where at most maxValues
+// distinct values are recorded per label name. Values seen after the limit is reached are
+// replaced by OverflowLabelValue, guarding the metrics backend against unbounded label values
+// such as per-tenant namespaces.
+func LimitCardinality(r Recorder, maxValues int) Recorder {
+	return &cardinalityLimiter{
+		r:         r,
+		maxValues: maxValues,
+		values:    make(map[string]map[string]struct{}),
+	}
+}
+
+func (l *cardinalityLimiter) Count(name string, delta int64, labels ...Label) {
+	l.r.Count(name, delta, l.limit(labels)...)
+}
+
+func (l *cardinalityLimiter) Observe(name string, value float64, labels ...Label) {
+	l.r.Observe(name, value, l.limit(labels)...)
+}
+
+// limit returns the labels with values exceeding the limit replaced.
+func (l *cardinalityLimiter) limit(labels []Label) []Label {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limited := labels
+	copied := false
+	for i, label := range labels {
+		seen, ok := l.values[label.Name]
+		if !ok {
+			seen = make(map[string]struct{})
+			l.values[label.Name] = seen
+		}
+		if _, ok := seen[label.Value]; ok {
+			continue
+		}
+		if len(seen) < l.maxValues {
+			seen[label.Value] = struct{}{}
+			continue
+		}
+		if !copied {
+			limited = append([]Label(nil), labels...) // Don't modify the caller's labels.
+			copied = true
+		}
+		limited[i].Value = OverflowLabelValue
+	}
+	return limited
+}
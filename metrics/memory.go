@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Summary is an aggregate of the values observed in a histogram.
+type Summary struct {
+	Count int64
+	Sum   float64
+	Min   float64
+	Max   float64
+}
+
+// MemoryRecorder is a Recorder that keeps metrics in memory, used in e.g. tests and debug endpoints.
+// Histograms are aggregated into a Summary.
+// The recorder is safe for concurrent use.
+type MemoryRecorder struct {
+	mu         sync.RWMutex
+	counters   map[string]int64
+	histograms map[string]Summary
+}
+
+// NewMemoryRecorder creates a new instance of a MemoryRecorder.
+func NewMemoryRecorder() *MemoryRecorder {
+	return &MemoryRecorder{
+		counters:   make(map[string]int64),
+		histograms: make(map[string]Summary),
+	}
+}
+
+func (r *MemoryRecorder) Count(name string, delta int64, labels ...Label) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counters[SeriesName(name, labels...)] += delta
+}
+
+func (r *MemoryRecorder) Observe(name string, value float64, labels ...Label) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	series := SeriesName(name, labels...)
+	s, ok := r.histograms[series]
+	if !ok || value < s.Min {
+		s.Min = value
+	}
+	if !ok || value > s.Max {
+		s.Max = value
+	}
+	s.Count++
+	s.Sum += value
+	r.histograms[series] = s
+}
+
+// Counter returns the value of the counter with the name and labels.
+func (r *MemoryRecorder) Counter(name string, labels ...Label) int64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.counters[SeriesName(name, labels...)]
+}
+
+// Histogram returns the summary of the histogram with the name and labels.
+func (r *MemoryRecorder) Histogram(name string, labels ...Label) Summary {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.histograms[SeriesName(name, labels...)]
+}
+
+// Counters returns a copy of all counters keyed by series name.
+func (r *MemoryRecorder) Counters() map[string]int64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	counters := make(map[string]int64, len(r.counters))
+	for k, v := range r.counters {
+		counters[k] = v
+	}
+	return counters
+}
+
+// Histograms returns a copy of all histogram summaries keyed by series name.
+func (r *MemoryRecorder) Histograms() map[string]Summary {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	histograms := make(map[string]Summary, len(r.histograms))
+	for k, v := range r.histograms {
+		histograms[k] = v
+	}
+	return histograms
+}
+
+// SeriesName returns the unique series name of a metric name and labels.
+//
+// Example:
+//
+//	SeriesName("size", Label{"kind", "user"}) // "size{kind=user}"
+func SeriesName(name string, labels ...Label) string {
+	if len(labels) == 0 {
+		return name
+	}
+	sorted := make([]Label, len(labels))
+	copy(sorted, labels)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, l := range sorted {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(l.Name)
+		b.WriteByte('=')
+		b.WriteString(l.Value)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
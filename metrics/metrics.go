@@ -0,0 +1,26 @@
+// Package metrics provides a minimal metrics abstraction used by the store packages.
+//
+// Implement Recorder to forward metrics to a metrics backend (e.g. Prometheus or OpenTelemetry),
+// where Count maps to a counter and Observe to a histogram.
+package metrics
+
+// Label is a metric dimension.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Recorder records metrics. Implementations must be safe for concurrent use.
+type Recorder interface {
+	// Count adds delta to the counter with the name and labels.
+	Count(name string, delta int64, labels ...Label)
+	// Observe records a value in the histogram with the name and labels.
+	Observe(name string, value float64, labels ...Label)
+}
+
+// NopRecorder is a Recorder that discards all metrics.
+type NopRecorder struct{}
+
+func (NopRecorder) Count(name string, delta int64, labels ...Label) {}
+
+func (NopRecorder) Observe(name string, value float64, labels ...Label) {}
@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryRecorder(t *testing.T) {
+	t.Run("Count", func(t *testing.T) {
+		r := NewMemoryRecorder()
+		r.Count("ops", 1, Label{"kind", "user"})
+		r.Count("ops", 2, Label{"kind", "user"})
+		r.Count("ops", 5, Label{"kind", "order"})
+		assert.Equal(t, int64(3), r.Counter("ops", Label{"kind", "user"}))
+		assert.Equal(t, int64(5), r.Counter("ops", Label{"kind", "order"}))
+		assert.Equal(t, int64(0), r.Counter("ops"))
+	})
+
+	t.Run("Observe", func(t *testing.T) {
+		r := NewMemoryRecorder()
+		for _, v := range []float64{10, 2, 30} {
+			r.Observe("size", v)
+		}
+		assert.Equal(t, Summary{Count: 3, Sum: 42, Min: 2, Max: 30}, r.Histogram("size"))
+	})
+
+	t.Run("Concurrent use", func(t *testing.T) {
+		r := NewMemoryRecorder()
+		var wg sync.WaitGroup
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r.Count("ops", 1)
+				r.Observe("size", 1)
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int64(10), r.Counter("ops"))
+		assert.Equal(t, int64(10), r.Histogram("size").Count)
+	})
+}
+
+func TestSeriesName(t *testing.T) {
+	assert.Equal(t, "size", SeriesName("size"))
+	assert.Equal(
+		t,
+		"size{kind=user,ns=app}",
+		SeriesName("size", Label{"ns", "app"}, Label{"kind", "user"}),
+		"should sort labels by name",
+	)
+}
+
+func TestLimitCardinality(t *testing.T) {
+	mem := NewMemoryRecorder()
+	r := LimitCardinality(mem, 2)
+	for _, ns := range []string{"a", "b", "c", "d", "a"} {
+		r.Count("ops", 1, Label{"kind", "user"}, Label{"namespace", ns})
+	}
+	r.Observe("size", 1, Label{"namespace", "e"})
+	assert.Equal(t, int64(2), mem.Counter("ops", Label{"kind", "user"}, Label{"namespace", "a"}))
+	assert.Equal(t, int64(1), mem.Counter("ops", Label{"kind", "user"}, Label{"namespace", "b"}))
+	assert.Equal(t, int64(2), mem.Counter("ops", Label{"kind", "user"}, Label{"namespace", OverflowLabelValue}))
+	assert.Equal(t, int64(1), mem.Histogram("size", Label{"namespace", OverflowLabelValue}).Count)
+}
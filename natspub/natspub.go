@@ -0,0 +1,217 @@
+// Package natspub publishes entity change events of a store to NATS subjects.
+//
+// Events are published to the subject "<prefix>.<kind>.<tenant>.<operation>", e.g.
+// "entitystore.user.acme.added", where the tenant is the ID of the tenant parent key of the
+// changed entities, or NoTenant for entities without one. A batch event spanning multiple
+// tenants is published as one message per tenant.
+//
+// The package doesn't depend on the NATS client. Publish with a core NATS connection using
+// FromConn, or with JetStream persistence by wrapping the JetStream publish call:
+//
+//	nc, _ := nats.Connect(nats.DefaultURL)
+//	detach := natspub.Attach(natspub.FromConn(nc), userStore, "user")
+//
+//	js, _ := jetstream.New(nc)
+//	detach := natspub.Attach(func(ctx context.Context, subject string, data []byte) error {
+//		_, err := js.Publish(ctx, subject, data)
+//		return err
+//	}, userStore, "user")
+package natspub
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/holmberd/go-entitystore/cloudevents"
+	"github.com/holmberd/go-entitystore/encoder"
+	"github.com/holmberd/go-entitystore/entitystore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+const (
+	DefaultSubjectPrefix = "entitystore" // Default subject prefix.
+	NoTenant             = "_"           // Subject tenant token of entities without a tenant parent key.
+)
+
+// Subject operation tokens.
+const (
+	OpAdded   = "added"
+	OpUpdated = "updated"
+	OpRemoved = "removed"
+)
+
+// PublishFunc publishes the data to the subject.
+type PublishFunc func(ctx context.Context, subject string, data []byte) error
+
+// Conn is the subset of a core NATS connection (*nats.Conn) used to publish messages.
+type Conn interface {
+	Publish(subject string, data []byte) error
+}
+
+// FromConn returns a PublishFunc publishing with the core NATS connection.
+func FromConn(conn Conn) PublishFunc {
+	return func(ctx context.Context, subject string, data []byte) error {
+		return conn.Publish(subject, data)
+	}
+}
+
+// Event is the message payload of a published entity change event.
+type Event struct {
+	Type   string    `json:"type"`   // Store event name, e.g. "EntitiesAdded".
+	Kind   string    `json:"kind"`   // Entity kind.
+	Tenant string    `json:"tenant"` // Tenant ID, or empty for entities without a tenant parent key.
+	Keys   []string  `json:"keys"`   // Keys of the changed entities.
+	Time   time.Time `json:"time"`   // Time the event was emitted.
+}
+
+// Option configures the publisher.
+type Option func(*options)
+
+type options struct {
+	subjectPrefix string
+	errorHandler  func(err error)
+	cloudEvents   *cloudevents.Encoder
+	codec         encoder.Codec
+}
+
+// WithSubjectPrefix sets the subject prefix. Defaults to DefaultSubjectPrefix.
+func WithSubjectPrefix(prefix string) Option {
+	return func(o *options) {
+		if prefix != "" {
+			o.subjectPrefix = prefix
+		}
+	}
+}
+
+// WithErrorHandler sets the handler called when an event fails to publish.
+// By default the error is logged.
+func WithErrorHandler(h func(err error)) Option {
+	return func(o *options) {
+		if h != nil {
+			o.errorHandler = h
+		}
+	}
+}
+
+// WithCloudEvents publishes events wrapped in CloudEvents envelopes encoded by the encoder,
+// instead of plain JSON events. The CloudEvents subject attribute is the NATS subject.
+// The codec of the event data is set by the encoder (see cloudevents.Encoder.WithDataCodec).
+func WithCloudEvents(enc *cloudevents.Encoder) Option {
+	return func(o *options) {
+		o.cloudEvents = enc
+	}
+}
+
+// WithCodec sets the codec of the published events, e.g. encoder.ProtoEncoder.
+// Defaults to encoder.JSONEncoder.
+//
+// NOTE: The codec is ignored with WithCloudEvents; set the codec of the event data on the
+// CloudEvents encoder instead (see cloudevents.Encoder.WithDataCodec).
+func WithCodec(c encoder.Codec) Option {
+	return func(o *options) {
+		if c != nil {
+			o.codec = c
+		}
+	}
+}
+
+// Attach publishes the added, updated, and removed events of the store with the publish function.
+// Events are published synchronously in the store event listeners.
+// It returns a function detaching the publisher from the store.
+func Attach[T entitystore.Entity, PT entitystore.SerializableEntity[T]](
+	publish PublishFunc,
+	store entitystore.EntityStorer[T, PT],
+	kind string,
+	opts ...Option,
+) (detach func()) {
+	o := options{
+		subjectPrefix: DefaultSubjectPrefix,
+		errorHandler: func(err error) {
+			log.Printf("natspub: %v", err)
+		},
+		codec: encoder.JSONEncoder{},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	listener := func(event entitystore.Event, op string) entitystore.EntityStoreListener {
+		return func(ctx context.Context, keys []string) {
+			now := time.Now()
+			for _, group := range groupByTenant(keys) {
+				subject := Subject(o.subjectPrefix, kind, group.tenant, op)
+				data, err := o.encode(subject, Event{
+					Type:   event.String(),
+					Kind:   kind,
+					Tenant: group.tenant,
+					Keys:   group.keys,
+					Time:   now,
+				})
+				if err != nil {
+					o.errorHandler(err)
+					continue
+				}
+				if err := publish(ctx, subject, data); err != nil {
+					o.errorHandler(err)
+				}
+			}
+		}
+	}
+	addedToken := store.OnAdded().AddListener(listener(entitystore.EntitiesAdded, OpAdded))
+	updatedToken := store.OnUpdated().AddListener(listener(entitystore.EntitiesUpdated, OpUpdated))
+	removedToken := store.OnRemoved().AddListener(listener(entitystore.EntitiesRemoved, OpRemoved))
+	return func() {
+		store.OnAdded().RemoveListener(addedToken)
+		store.OnUpdated().RemoveListener(updatedToken)
+		store.OnRemoved().RemoveListener(removedToken)
+	}
+}
+
+// encode encodes the event published to the subject.
+func (o *options) encode(subject string, event Event) ([]byte, error) {
+	if o.cloudEvents != nil {
+		data, _, err := o.cloudEvents.Encode(event.Type, subject, event.Time, event)
+		return data, err
+	}
+	return o.codec.Marshal(event)
+}
+
+// Subject returns the subject of an event. An empty tenant is replaced by NoTenant.
+func Subject(prefix string, kind string, tenant string, op string) string {
+	if tenant == "" {
+		tenant = NoTenant
+	}
+	return strings.Join([]string{prefix, kind, tenant, op}, ".")
+}
+
+type tenantKeys struct {
+	tenant string
+	keys   []string
+}
+
+// groupByTenant groups the entity keys by tenant ID, in order of first occurrence.
+func groupByTenant(keys []string) []tenantKeys {
+	var groups []tenantKeys
+	index := make(map[string]int)
+	for _, key := range keys {
+		tenant := tenantID(key)
+		i, ok := index[tenant]
+		if !ok {
+			i = len(groups)
+			index[tenant] = i
+			groups = append(groups, tenantKeys{tenant: tenant})
+		}
+		groups[i].keys = append(groups[i].keys, key)
+	}
+	return groups
+}
+
+// tenantID returns the tenant ID of the entity key's tenant parent key, or empty if none.
+func tenantID(key string) string {
+	fragments := strings.SplitN(key, keyfactory.KeyFragmentDelimiter, 3)
+	if len(fragments) < 2 || fragments[0] != string(keyfactory.EntityKindTenant) {
+		return ""
+	}
+	return fragments[1]
+}
@@ -0,0 +1,104 @@
+package natspub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/encoder"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/holmberd/go-entitystore/testutil/storetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type message struct {
+	subject string
+	data    []byte
+}
+
+// mockConn records published messages.
+type mockConn struct {
+	messages []message
+	err      error
+}
+
+func (c *mockConn) Publish(subject string, data []byte) error {
+	c.messages = append(c.messages, message{subject: subject, data: data})
+	return c.err
+}
+
+func TestAttach(t *testing.T) {
+	ctx := context.Background()
+	rsClient, _ := testutil.NewRedisClientWithCleanup(t)
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+
+	t.Run("Publishes per tenant", func(t *testing.T) {
+		store := storetest.NewIsolatedStore[testutil.Entity](t, dsClient, string(keyfactory.EntityKindTest))
+		conn := &mockConn{}
+		detach := Attach(FromConn(conn), store, "test")
+		defer detach()
+
+		e1, e2 := testutil.NewEntity("e-1", "acme", 1), testutil.NewEntity("e-2", "other", 1)
+		_, err := store.AddBatch(ctx, []testutil.Entity{e1, e2}, 0)
+		require.NoError(t, err)
+		require.NoError(t, store.Remove(ctx, e1.GetKey()))
+
+		require.Len(t, conn.messages, 3)
+		assert.Equal(t, "entitystore.test.acme.added", conn.messages[0].subject)
+		assert.Equal(t, "entitystore.test.other.added", conn.messages[1].subject)
+		assert.Equal(t, "entitystore.test.acme.removed", conn.messages[2].subject)
+		var event Event
+		require.NoError(t, json.Unmarshal(conn.messages[0].data, &event))
+		assert.Equal(t, "EntitiesAdded", event.Type)
+		assert.Equal(t, "acme", event.Tenant)
+		assert.Equal(t, []string{e1.GetKey()}, event.Keys)
+	})
+
+	t.Run("Publishes with codec", func(t *testing.T) {
+		store := storetest.NewIsolatedStore[testutil.Entity](t, dsClient, string(keyfactory.EntityKindTest))
+		conn := &mockConn{}
+		detach := Attach(FromConn(conn), store, "test", WithCodec(encoder.ProtoEncoder{}))
+		defer detach()
+
+		e1 := testutil.NewEntity("e-1", "acme", 1)
+		_, err := store.Add(ctx, e1, 0)
+		require.NoError(t, err)
+		require.Len(t, conn.messages, 1)
+		var event Event
+		require.NoError(t, encoder.ProtoEncoder{}.Unmarshal(conn.messages[0].data, &event))
+		assert.Equal(t, "EntitiesAdded", event.Type)
+		assert.Equal(t, "test", event.Kind)
+		assert.Equal(t, "acme", event.Tenant)
+		assert.Equal(t, []string{e1.GetKey()}, event.Keys)
+		assert.False(t, event.Time.IsZero())
+	})
+
+	t.Run("Publish errors", func(t *testing.T) {
+		store := storetest.NewIsolatedStore[testutil.Entity](t, dsClient, string(keyfactory.EntityKindTest))
+		conn := &mockConn{err: errors.New("nats: connection closed")}
+		var errs []error
+		detach := Attach(FromConn(conn), store, "test", WithSubjectPrefix("app"), WithErrorHandler(func(err error) {
+			errs = append(errs, err)
+		}))
+		_, err := store.Add(ctx, testutil.NewEntity("e-1", "acme", 1), 0)
+		require.NoError(t, err)
+		detach()
+		_, err = store.Add(ctx, testutil.NewEntity("e-1", "acme", 1), 0)
+		require.NoError(t, err)
+
+		require.Len(t, conn.messages, 1, "should not publish after detach")
+		assert.Equal(t, "app.test.acme.added", conn.messages[0].subject)
+		assert.Len(t, errs, 1)
+	})
+}
+
+func TestSubject(t *testing.T) {
+	assert.Equal(t, "entitystore.user._.removed", Subject(DefaultSubjectPrefix, "user", "", OpRemoved))
+	assert.Equal(t, "", tenantID("test_entity:e-1"))
+	assert.Equal(t, "acme", tenantID("tenant:acme:test_entity:e-1"))
+}
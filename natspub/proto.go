@@ -0,0 +1,81 @@
+package natspub
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/holmberd/go-entitystore/encoder"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers of the protobuf encoding of an Event:
+//
+//	message Event {
+//	  string type = 1;
+//	  string kind = 2;
+//	  string tenant = 3;
+//	  repeated string keys = 4;
+//	  google.protobuf.Timestamp time = 5;
+//	}
+const (
+	fieldType   = 1
+	fieldKind   = 2
+	fieldTenant = 3
+	fieldKeys   = 4
+	fieldTime   = 5
+)
+
+var errInvalidProto = errors.New("natspub: invalid protobuf event")
+
+// MarshalProto returns the protobuf encoding of the event, e.g. for encoder.ProtoEncoder.
+func (e Event) MarshalProto() ([]byte, error) {
+	var b []byte
+	for _, f := range []struct {
+		num protowire.Number
+		val string
+	}{{fieldType, e.Type}, {fieldKind, e.Kind}, {fieldTenant, e.Tenant}} {
+		if f.val != "" {
+			b = protowire.AppendTag(b, f.num, protowire.BytesType)
+			b = protowire.AppendString(b, f.val)
+		}
+	}
+	for _, key := range e.Keys {
+		b = protowire.AppendTag(b, fieldKeys, protowire.BytesType)
+		b = protowire.AppendString(b, key)
+	}
+	return encoder.AppendProtoTimestamp(b, fieldTime, e.Time), nil
+}
+
+// UnmarshalProto decodes the protobuf encoding of the event.
+func (e *Event) UnmarshalProto(data []byte) error {
+	*e = Event{}
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 || typ != protowire.BytesType {
+			return errInvalidProto
+		}
+		data = data[n:]
+		v, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return errInvalidProto
+		}
+		data = data[n:]
+		switch num {
+		case fieldType:
+			e.Type = string(v)
+		case fieldKind:
+			e.Kind = string(v)
+		case fieldTenant:
+			e.Tenant = string(v)
+		case fieldKeys:
+			e.Keys = append(e.Keys, string(v))
+		case fieldTime:
+			t, err := encoder.ConsumeProtoTimestamp(v)
+			if err != nil {
+				return fmt.Errorf("%w: %w", errInvalidProto, err)
+			}
+			e.Time = t
+		}
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+// Package projection provides materialized views, derived stores maintained from the change
+// events of a source store, e.g. a per-tenant count of active products or a denormalized lookup.
+//
+// The view entities are derived per group. A changed source entity maps to a group, e.g. its parent
+// key for a per-tenant aggregate or its own key for a lookup, and the view rebuilds the view entities
+// of each changed group from the current state of the source store. Since groups are rebuilt from
+// the source, applying a change twice or out of order converges to the same view.
+//
+// Example:
+//
+//	counts, err := projection.New(productStore, countStore, projection.Definition[ProductCount]{
+//		Group: func(productKey string) string { return tenantKeyOf(productKey) },
+//		Build: func(ctx context.Context, tenantKey string) ([]ProductCount, []string, error) {
+//			products, err := productStore.GetAll(ctx, tenantKey)
+//			...
+//			return []ProductCount{{TenantKey: tenantKey, Active: active}}, nil, nil
+//		},
+//	})
+//	if err := counts.Rebuild(ctx, tenantKey); err != nil { ... }
+//	counts.Start()
+//	defer counts.Stop()
+package projection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/holmberd/go-entitystore/entitystore"
+	"github.com/holmberd/go-entitystore/eventemitter"
+	"github.com/holmberd/go-entitystore/metrics"
+)
+
+const (
+	MetricLag     = "projection_lag_seconds"  // Histogram of the delay between a source change and its view update.
+	MetricApplied = "projection_groups_total" // Counter of rebuilt view groups.
+	MetricErrors  = "projection_errors_total" // Counter of failed view group rebuilds.
+
+	defaultQueueSize = 1024 // Default max number of queued source changes.
+	rebuildLimit     = 1000 // Page size used during rebuild.
+)
+
+// Definition defines how the view entities are derived from the source entities.
+type Definition[V entitystore.Entity] struct {
+	// Group returns the view group of a changed source entity.
+	Group func(entityKey string) string
+	// Build derives the view entities of the group from the source store, and returns the view
+	// entities to write and the keys of the view entities to remove, e.g. of a removed source entity.
+	Build func(ctx context.Context, group string) (views []V, removed []string, err error)
+}
+
+// Option configures a View.
+type Option func(*options)
+
+type options struct {
+	queueSize    int
+	metrics      metrics.Recorder
+	errorHandler func(err error)
+}
+
+// WithQueueSize sets the max number of queued source changes.
+// When the queue is full, source event listeners block until there is room.
+func WithQueueSize(size int) Option {
+	return func(o *options) {
+		if size > 0 {
+			o.queueSize = size
+		}
+	}
+}
+
+// WithMetrics sets the recorder for view metrics, e.g. lag. By default metrics are discarded.
+func WithMetrics(r metrics.Recorder) Option {
+	return func(o *options) {
+		if r != nil {
+			o.metrics = r
+		}
+	}
+}
+
+// WithErrorHandler sets the handler called when a view group fails to rebuild.
+// By default the error is logged.
+func WithErrorHandler(h func(err error)) Option {
+	return func(o *options) {
+		if h != nil {
+			o.errorHandler = h
+		}
+	}
+}
+
+type change struct {
+	keys      []string
+	createdAt time.Time
+}
+
+// View is a materialized view maintained in a target store from the changes of a source store.
+// The view is safe for concurrent use.
+type View[T entitystore.Entity, PT entitystore.SerializableEntity[T], V entitystore.Entity, PV entitystore.SerializableEntity[V]] struct {
+	source entitystore.EntityStorer[T, PT]
+	target entitystore.EntityStorer[V, PV]
+	def    Definition[V]
+	opts   options
+
+	mu          sync.Mutex
+	queue       chan change
+	done        chan struct{}
+	pending     []time.Time // Creation times of the queued and in-flight changes, oldest first.
+	addToken    eventemitter.ListenerToken
+	updateToken eventemitter.ListenerToken
+	removeToken eventemitter.ListenerToken
+	running     bool
+}
+
+// New creates a new instance of a View.
+func New[T entitystore.Entity, PT entitystore.SerializableEntity[T], V entitystore.Entity, PV entitystore.SerializableEntity[V]](
+	source entitystore.EntityStorer[T, PT],
+	target entitystore.EntityStorer[V, PV],
+	def Definition[V],
+	opts ...Option,
+) (*View[T, PT, V, PV], error) {
+	if def.Group == nil || def.Build == nil {
+		return nil, errors.New("projection: definition requires a group and build function")
+	}
+	o := options{
+		queueSize: defaultQueueSize,
+		metrics:   metrics.NopRecorder{},
+		errorHandler: func(err error) {
+			log.Printf("projection: %v", err)
+		},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &View[T, PT, V, PV]{
+		source: source,
+		target: target,
+		def:    def,
+		opts:   o,
+	}, nil
+}
+
+// Start starts tailing the source store change events and applying them to the view.
+// It's a no-op if the view is already running.
+func (v *View[T, PT, V, PV]) Start() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.running {
+		return
+	}
+	v.running = true
+	v.queue = make(chan change, v.opts.queueSize)
+	v.done = make(chan struct{})
+	queue := v.queue
+	listener := func(ctx context.Context, keys []string) {
+		now := time.Now()
+		v.mu.Lock()
+		v.pending = append(v.pending, now)
+		v.mu.Unlock()
+		queue <- change{keys: keys, createdAt: now}
+	}
+	v.addToken = v.source.OnAdded().AddListener(listener)
+	v.updateToken = v.source.OnUpdated().AddListener(listener)
+	v.removeToken = v.source.OnRemoved().AddListener(listener)
+	go v.run(queue, v.done)
+}
+
+// Stop stops tailing the source store and waits until all queued changes are applied.
+// It's a no-op if the view isn't running.
+func (v *View[T, PT, V, PV]) Stop() {
+	v.mu.Lock()
+	if !v.running {
+		v.mu.Unlock()
+		return
+	}
+	v.running = false
+	v.source.OnAdded().RemoveListener(v.addToken)
+	v.source.OnUpdated().RemoveListener(v.updateToken)
+	v.source.OnRemoved().RemoveListener(v.removeToken)
+	close(v.queue)
+	done := v.done
+	v.mu.Unlock()
+	<-done
+}
+
+// Lag returns the age of the oldest source change not yet applied to the view,
+// or zero if the view is up to date.
+func (v *View[T, PT, V, PV]) Lag() time.Duration {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if len(v.pending) == 0 {
+		return 0
+	}
+	return time.Since(v.pending[0])
+}
+
+// Pending returns the number of source changes not yet applied to the view.
+func (v *View[T, PT, V, PV]) Pending() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return len(v.pending)
+}
+
+func (v *View[T, PT, V, PV]) run(queue <-chan change, done chan<- struct{}) {
+	defer close(done)
+	ctx := context.Background()
+	for c := range queue {
+		var groups []string
+		seen := make(map[string]struct{})
+		for _, key := range c.keys {
+			group := v.def.Group(key)
+			if _, ok := seen[group]; !ok {
+				seen[group] = struct{}{}
+				groups = append(groups, group)
+			}
+		}
+		for _, group := range groups {
+			if err := v.apply(ctx, group); err != nil {
+				v.opts.metrics.Count(MetricErrors, 1)
+				v.opts.errorHandler(err)
+			}
+		}
+		v.opts.metrics.Observe(MetricLag, time.Since(c.createdAt).Seconds())
+		v.mu.Lock()
+		v.pending = v.pending[1:]
+		v.mu.Unlock()
+	}
+}
+
+// Rebuild removes the view entities under the parent key from the target store, and rebuilds the
+// view groups of all source entities under the parent key. Groups without source entities have no
+// view entities after the rebuild. Call Rebuild before or after Start for an initial build, or to
+// repair the view after failed group rebuilds.
+func (v *View[T, PT, V, PV]) Rebuild(ctx context.Context, parentKey string) error {
+	if err := v.target.RemoveAll(ctx, parentKey); err != nil {
+		return err
+	}
+	seen := make(map[string]struct{})
+	cursor := uint64(0)
+	for {
+		page, err := v.source.GetWithPagination(ctx, cursor, rebuildLimit, parentKey)
+		if err != nil {
+			return err
+		}
+		for _, e := range page.Entities {
+			group := v.def.Group(e.GetKey())
+			if _, ok := seen[group]; ok {
+				continue
+			}
+			seen[group] = struct{}{}
+			if err := v.apply(ctx, group); err != nil {
+				return err
+			}
+		}
+		if page.Cursor == 0 {
+			return nil
+		}
+		cursor = page.Cursor
+	}
+}
+
+// apply rebuilds the view entities of the group.
+func (v *View[T, PT, V, PV]) apply(ctx context.Context, group string) error {
+	views, removed, err := v.def.Build(ctx, group)
+	if err != nil {
+		return fmt.Errorf("projection: build group '%s': %w", group, err)
+	}
+	if len(views) > 0 {
+		if _, err := v.target.AddBatch(ctx, views, 0); err != nil {
+			return fmt.Errorf("projection: write group '%s': %w", group, err)
+		}
+	}
+	if len(removed) > 0 {
+		if err := v.target.RemoveByKeys(ctx, removed); err != nil {
+			return fmt.Errorf("projection: remove group '%s': %w", group, err)
+		}
+	}
+	v.opts.metrics.Count(MetricApplied, 1)
+	return nil
+}
@@ -0,0 +1,128 @@
+package projection
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/entitystore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/metrics"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/holmberd/go-entitystore/testutil/storetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const tenantID = "tenant1"
+
+var tenantKey, _ = keyfactory.NewTenantKey(tenantID)
+
+type store = entitystore.EntityStore[testutil.Entity, *testutil.Entity]
+
+// countDefinition defines a view of the number of source entities per tenant.
+func countDefinition(source *store) Definition[testutil.Entity] {
+	return Definition[testutil.Entity]{
+		Group: func(entityKey string) string {
+			return tenantKey // Single tenant.
+		},
+		Build: func(ctx context.Context, group string) ([]testutil.Entity, []string, error) {
+			entities, err := source.GetAll(ctx, group)
+			if err != nil {
+				return nil, nil, err
+			}
+			count := testutil.NewEntity("count", tenantID, 0)
+			count.Data = strconv.Itoa(len(entities))
+			return []testutil.Entity{count}, nil, nil
+		},
+	}
+}
+
+func viewCount(t *testing.T, target *store) string {
+	t.Helper()
+	count, err := target.Get(context.Background(), testutil.NewEntity("count", tenantID, 0).GetKey())
+	require.NoError(t, err)
+	if count == nil {
+		return ""
+	}
+	return count.Data
+}
+
+func TestView(t *testing.T) {
+	ctx := context.Background()
+	rsClient, _ := testutil.NewRedisClientWithCleanup(t)
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+
+	t.Run("Requires definition", func(t *testing.T) {
+		source, target := storetest.NewIsolatedStore[testutil.Entity](t, dsClient, string(keyfactory.EntityKindTest)), storetest.NewIsolatedStore[testutil.Entity](t, dsClient, string(keyfactory.EntityKindTest))
+		_, err := New(source, target, Definition[testutil.Entity]{})
+		assert.Error(t, err)
+	})
+
+	t.Run("Maintain from changes", func(t *testing.T) {
+		source, target := storetest.NewIsolatedStore[testutil.Entity](t, dsClient, string(keyfactory.EntityKindTest)), storetest.NewIsolatedStore[testutil.Entity](t, dsClient, string(keyfactory.EntityKindTest))
+		recorder := metrics.NewMemoryRecorder()
+		v, err := New(source, target, countDefinition(source), WithMetrics(recorder))
+		require.NoError(t, err)
+		v.Start()
+
+		e1, e2 := testutil.NewEntity("e-1", tenantID, 1), testutil.NewEntity("e-2", tenantID, 1)
+		_, err = source.AddBatch(ctx, []testutil.Entity{e1, e2}, 0)
+		require.NoError(t, err)
+		require.NoError(t, source.Remove(ctx, e1.GetKey()))
+		v.Stop() // Waits until all queued changes are applied.
+
+		assert.Equal(t, "1", viewCount(t, target))
+		assert.Equal(t, 0, v.Pending())
+		assert.Zero(t, v.Lag())
+		assert.Equal(t, int64(2), recorder.Histogram(MetricLag).Count, "should record lag per change")
+	})
+
+	t.Run("Rebuild", func(t *testing.T) {
+		source, target := storetest.NewIsolatedStore[testutil.Entity](t, dsClient, string(keyfactory.EntityKindTest)), storetest.NewIsolatedStore[testutil.Entity](t, dsClient, string(keyfactory.EntityKindTest))
+		_, err := source.AddBatch(ctx, []testutil.Entity{
+			testutil.NewEntity("e-1", tenantID, 1),
+			testutil.NewEntity("e-2", tenantID, 1),
+			testutil.NewEntity("e-3", tenantID, 1),
+		}, 0)
+		require.NoError(t, err)
+		stale := testutil.NewEntity("stale", tenantID, 0)
+		_, err = target.Add(ctx, stale, 0)
+		require.NoError(t, err)
+
+		v, err := New(source, target, countDefinition(source))
+		require.NoError(t, err)
+		require.NoError(t, v.Rebuild(ctx, tenantKey))
+		assert.Equal(t, "3", viewCount(t, target))
+		exists, err := target.Exists(ctx, stale.GetKey())
+		require.NoError(t, err)
+		assert.False(t, exists, "should remove stale view entities")
+	})
+
+	t.Run("Lag", func(t *testing.T) {
+		source, target := storetest.NewIsolatedStore[testutil.Entity](t, dsClient, string(keyfactory.EntityKindTest)), storetest.NewIsolatedStore[testutil.Entity](t, dsClient, string(keyfactory.EntityKindTest))
+		def := countDefinition(source)
+		block := make(chan struct{})
+		build := def.Build
+		def.Build = func(ctx context.Context, group string) ([]testutil.Entity, []string, error) {
+			<-block
+			return build(ctx, group)
+		}
+		v, err := New(source, target, def)
+		require.NoError(t, err)
+		v.Start()
+
+		_, err = source.Add(ctx, testutil.NewEntity("e-1", tenantID, 1), 0)
+		require.NoError(t, err)
+		time.Sleep(10 * time.Millisecond)
+		assert.Equal(t, 1, v.Pending())
+		assert.GreaterOrEqual(t, v.Lag(), 10*time.Millisecond)
+		close(block)
+		v.Stop()
+		assert.Zero(t, v.Lag())
+		assert.Equal(t, "1", viewCount(t, target))
+	})
+}
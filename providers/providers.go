@@ -0,0 +1,86 @@
+// Package providers provides constructor functions for the datastore client, entity stores,
+// and the store registry, shaped for dependency injection frameworks such as Uber fx and
+// Google wire, so service bootstrapping is the same across services.
+//
+// The package doesn't depend on any framework. With fx:
+//
+//	fx.New(
+//		fx.Supply(&redis.Options{Addr: "localhost:6379"}, providers.DatastoreOptions{}),
+//		fx.Provide(
+//			providers.RedisClient,
+//			providers.DatastoreClient,
+//			providers.Registry,
+//			providers.EntityStore[User]("user", "app"),
+//		),
+//		fx.Invoke(func(lc fx.Lifecycle, rsClient *redis.Client) {
+//			lc.Append(fx.StopHook(rsClient.Close))
+//		}),
+//	)
+//
+// With wire, which requires named provider functions, wrap the generic store provider:
+//
+//	func provideUserStore(ds *datastore.Client, r *registry.Registry) (*entitystore.EntityStore[User, *User], error) {
+//		return providers.EntityStore[User]("user", "app")(ds, r)
+//	}
+//
+//	var Set = wire.NewSet(providers.RedisClient, providers.DatastoreClient, providers.Registry, provideUserStore)
+package providers
+
+import (
+	"errors"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/entitystore"
+	"github.com/holmberd/go-entitystore/registry"
+)
+
+// DatastoreOptions are the options of the provided datastore client.
+// Supply an empty value for the default options.
+type DatastoreOptions []datastore.ClientOption
+
+// RedisClient provides a Redis client from the Redis options.
+// The client is owned by the caller, e.g. closed with an fx lifecycle hook.
+func RedisClient(opts *redis.Options) (*redis.Client, error) {
+	if opts == nil {
+		return nil, errors.New("providers: redis options must not be nil")
+	}
+	return redis.NewClient(opts), nil
+}
+
+// DatastoreClient provides a datastore client from the Redis client and client options.
+func DatastoreClient(rsClient *redis.Client, opts DatastoreOptions) (*datastore.Client, error) {
+	if rsClient == nil {
+		return nil, errors.New("providers: redis client must not be nil")
+	}
+	return datastore.NewClient(rsClient, opts...)
+}
+
+// Registry provides an empty store registry, populated by the store providers.
+func Registry() *registry.Registry {
+	return registry.New()
+}
+
+// EntityStore returns a provider of an entity store of the entity kind and namespace, which
+// also registers the store in the registry.
+func EntityStore[T entitystore.Entity, PT entitystore.SerializableEntity[T]](
+	entityKind string,
+	namespace string,
+	opts ...entitystore.Option,
+) func(ds *datastore.Client, r *registry.Registry) (*entitystore.EntityStore[T, PT], error) {
+	return func(ds *datastore.Client, r *registry.Registry) (*entitystore.EntityStore[T, PT], error) {
+		if ds == nil {
+			return nil, errors.New("providers: datastore client must not be nil")
+		}
+		store, err := entitystore.New[T, PT](entityKind, namespace, ds, opts...)
+		if err != nil {
+			return nil, err
+		}
+		if r != nil {
+			if err := registry.Register(r, store); err != nil {
+				return nil, err
+			}
+		}
+		return store, nil
+	}
+}
@@ -0,0 +1,39 @@
+package providers
+
+import (
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/holmberd/go-entitystore/entitystore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/registry"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testStore = entitystore.EntityStore[testutil.Entity, *testutil.Entity]
+
+func TestProviders(t *testing.T) {
+	_, server := testutil.NewRedisClientWithCleanup(t)
+	rsClient, err := RedisClient(&redis.Options{Addr: server.Addr()})
+	require.NoError(t, err)
+	defer rsClient.Close()
+	ds, err := DatastoreClient(rsClient, nil)
+	require.NoError(t, err)
+	r := Registry()
+
+	provide := EntityStore[testutil.Entity](string(keyfactory.EntityKindTest), "app")
+	store, err := provide(ds, r)
+	require.NoError(t, err)
+	got, err := registry.Get[*testStore](r, string(keyfactory.EntityKindTest))
+	require.NoError(t, err)
+	assert.Same(t, store, got, "should register store")
+
+	_, err = provide(ds, r)
+	assert.ErrorIs(t, err, registry.ErrAlreadyRegistered)
+	_, err = provide(nil, r)
+	assert.Error(t, err)
+	_, err = RedisClient(nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,102 @@
+// Package ratelimit provides a limiter of operations and bandwidth per second, shared by the
+// background jobs of the store packages, e.g. migrations, exports, and copies, so maintenance
+// work can run alongside foreground traffic without starving it.
+//
+// A single Limiter is typically shared by all background jobs against a Redis instance:
+//
+//	limiter := ratelimit.New(5000, 10<<20) // 5000 ops/s and 10 MiB/s.
+//	_, err := store.Export(ctx, parentKey, w, entitystore.WithLimiter(limiter))
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// burstWindow is the duration of the rate allowed as a burst.
+const burstWindow = 100 * time.Millisecond
+
+// bucket is a token bucket. Reservations beyond the available tokens are taken as debt,
+// which delays later reservations, so a reservation larger than the burst is still paced.
+type bucket struct {
+	rate   float64 // Tokens per second, or 0 for no limit.
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newBucket returns a bucket of the rate allowing bursts of the window, which starts full.
+// A window of 0 allows no bursts, so all reservations are paced.
+func newBucket(rate int, window time.Duration, now time.Time) bucket {
+	if rate <= 0 {
+		return bucket{}
+	}
+	burst := 0.0
+	if window > 0 {
+		burst = max(float64(rate)*window.Seconds(), 1)
+	}
+	return bucket{rate: float64(rate), burst: burst, tokens: burst, last: now}
+}
+
+// reserve takes n tokens and returns the duration to wait until they're available.
+func (b *bucket) reserve(n int, now time.Time) time.Duration {
+	if b.rate == 0 || n <= 0 {
+		return 0
+	}
+	b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*b.rate, b.burst)
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Limiter limits the rate of operations and bytes. It's safe for concurrent use, and a nil
+// Limiter doesn't limit.
+type Limiter struct {
+	mu    sync.Mutex
+	ops   bucket
+	bytes bucket
+}
+
+// New returns a limiter of operations and bytes per second, allowing bursts of a tenth of a
+// second of each rate. A rate of 0 doesn't limit.
+func New(opsPerSecond, bytesPerSecond int) *Limiter {
+	now := time.Now()
+	return &Limiter{
+		ops:   newBucket(opsPerSecond, burstWindow, now),
+		bytes: newBucket(bytesPerSecond, burstWindow, now),
+	}
+}
+
+// NewPaced is like New, but allows no bursts, so every reservation waits for its share of the
+// rate, e.g. a chunk of n operations waits n divided by the rate.
+func NewPaced(opsPerSecond, bytesPerSecond int) *Limiter {
+	now := time.Now()
+	return &Limiter{ops: newBucket(opsPerSecond, 0, now), bytes: newBucket(bytesPerSecond, 0, now)}
+}
+
+// Wait blocks until the operations and bytes conform to the limits, or the context is done.
+// The operations and bytes are taken from the limits even if the context is done while waiting.
+func (l *Limiter) Wait(ctx context.Context, ops, bytes int) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	wait := max(l.ops.reserve(ops, now), l.bytes.reserve(bytes, now))
+	l.mu.Unlock()
+	if wait <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Nil limiter doesn't limit", func(t *testing.T) {
+		var l *Limiter
+		assert.NoError(t, l.Wait(ctx, 1000, 1000))
+	})
+
+	t.Run("Zero rates don't limit", func(t *testing.T) {
+		l := New(0, 0)
+		start := time.Now()
+		require.NoError(t, l.Wait(ctx, 1_000_000, 1_000_000))
+		assert.Less(t, time.Since(start), 10*time.Millisecond)
+	})
+
+	t.Run("Limit operations", func(t *testing.T) {
+		l := New(100, 0) // Burst of 10 ops.
+		start := time.Now()
+		require.NoError(t, l.Wait(ctx, 10, 0))
+		assert.Less(t, time.Since(start), 10*time.Millisecond, "should allow the burst")
+		require.NoError(t, l.Wait(ctx, 5, 1<<30))
+		assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond, "should pace operations beyond the burst")
+	})
+
+	t.Run("Pace operations without burst", func(t *testing.T) {
+		l := NewPaced(40, 0)
+		start := time.Now()
+		require.NoError(t, l.Wait(ctx, 2, 0))
+		assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond, "should pace the first operations")
+		require.NoError(t, l.Wait(ctx, 2, 0))
+		assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+	})
+
+	t.Run("Limit bytes", func(t *testing.T) {
+		l := New(0, 1000) // Burst of 100 bytes.
+		start := time.Now()
+		require.NoError(t, l.Wait(ctx, 0, 150))
+		assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+	})
+
+	t.Run("Share the limit between callers", func(t *testing.T) {
+		l := New(200, 0) // Burst of 20 ops.
+		start := time.Now()
+		var wg sync.WaitGroup
+		for range 4 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, l.Wait(ctx, 10, 0))
+			}()
+		}
+		wg.Wait()
+		assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+	})
+
+	t.Run("Done context", func(t *testing.T) {
+		l := New(1, 0)
+		require.NoError(t, l.Wait(ctx, 1, 0))
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, l.Wait(ctx, 1, 0), context.DeadlineExceeded)
+	})
+}
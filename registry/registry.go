@@ -0,0 +1,113 @@
+// Package registry provides a registry of stores by entity kind, so applications can construct
+// their stores once and retrieve them where needed instead of threading every store through
+// constructors.
+//
+// Example:
+//
+//	r := registry.New()
+//	if err := registry.Register(r, productStore); err != nil { ... }
+//	...
+//	products, err := registry.Get[*ProductStore](r, "product")
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/holmberd/go-entitystore/entitystore"
+)
+
+var (
+	ErrNotRegistered     = errors.New("registry: store not registered")
+	ErrAlreadyRegistered = errors.New("registry: store already registered")
+	ErrTypeMismatch      = errors.New("registry: store type mismatch")
+)
+
+// Registry holds stores by entity kind.
+// The registry is safe for concurrent use.
+type Registry struct {
+	mu     sync.RWMutex
+	stores map[string]any
+}
+
+// New creates a new instance of a Registry.
+func New() *Registry {
+	return &Registry{stores: make(map[string]any)}
+}
+
+// Add adds the store with the entity kind. Any store type can be added, e.g. an application
+// specific store wrapping an entity store.
+// An error wrapping ErrAlreadyRegistered is returned if a store is already added with the kind.
+func (r *Registry) Add(kind string, store any) error {
+	if kind == "" {
+		return errors.New("registry: entity kind must not be empty")
+	}
+	if store == nil {
+		return errors.New("registry: store must not be nil")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.stores[kind]; ok {
+		return fmt.Errorf("%w: '%s'", ErrAlreadyRegistered, kind)
+	}
+	r.stores[kind] = store
+	return nil
+}
+
+// Lookup returns the store of the entity kind, and whether it's added.
+func (r *Registry) Lookup(kind string) (any, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	store, ok := r.stores[kind]
+	return store, ok
+}
+
+// Kinds returns the sorted entity kinds of the added stores.
+func (r *Registry) Kinds() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	kinds := make([]string, 0, len(r.stores))
+	for kind := range r.stores {
+		kinds = append(kinds, kind)
+	}
+	slices.Sort(kinds)
+	return kinds
+}
+
+// Register adds the entity store with its entity kind.
+func Register[T entitystore.Entity, PT entitystore.SerializableEntity[T]](
+	r *Registry,
+	store *entitystore.EntityStore[T, PT],
+) error {
+	if store == nil {
+		return errors.New("registry: store must not be nil")
+	}
+	return r.Add(store.EntityKind(), store)
+}
+
+// Get returns the store of the entity kind as type S.
+// An error wrapping ErrNotRegistered is returned if no store is added with the kind, and an error
+// wrapping ErrTypeMismatch if the store isn't of type S.
+func Get[S any](r *Registry, kind string) (S, error) {
+	var zero S
+	store, ok := r.Lookup(kind)
+	if !ok {
+		return zero, fmt.Errorf("%w: '%s'", ErrNotRegistered, kind)
+	}
+	s, ok := store.(S)
+	if !ok {
+		return zero, fmt.Errorf("%w: store '%s' is %T, not %T", ErrTypeMismatch, kind, store, zero)
+	}
+	return s, nil
+}
+
+// MustGet is like Get, but panics on error. Use during application startup.
+func MustGet[S any](r *Registry, kind string) S {
+	s, err := Get[S](r, kind)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
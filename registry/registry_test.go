@@ -0,0 +1,50 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/entitystore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testStore = entitystore.EntityStore[testutil.Entity, *testutil.Entity]
+
+// wrappedStore is an application specific store wrapping an entity store.
+type wrappedStore struct {
+	*testStore
+}
+
+func TestRegistry(t *testing.T) {
+	rsClient, _ := testutil.NewRedisClientWithCleanup(t)
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	store, err := entitystore.New[testutil.Entity](string(keyfactory.EntityKindTest), "registry", dsClient)
+	require.NoError(t, err)
+
+	r := New()
+	require.NoError(t, Register(r, store))
+	require.NoError(t, r.Add("wrapped", wrappedStore{store}))
+	assert.Equal(t, []string{string(keyfactory.EntityKindTest), "wrapped"}, r.Kinds())
+
+	t.Run("Get", func(t *testing.T) {
+		got, err := Get[*testStore](r, string(keyfactory.EntityKindTest))
+		require.NoError(t, err)
+		assert.Same(t, store, got)
+		wrapped := MustGet[wrappedStore](r, "wrapped")
+		assert.Same(t, store, wrapped.testStore)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		_, err := Get[*testStore](r, "missing")
+		assert.ErrorIs(t, err, ErrNotRegistered)
+		_, err = Get[wrappedStore](r, string(keyfactory.EntityKindTest))
+		assert.ErrorIs(t, err, ErrTypeMismatch)
+		assert.ErrorIs(t, Register(r, store), ErrAlreadyRegistered)
+		assert.Error(t, r.Add("nil", nil))
+		assert.Panics(t, func() { MustGet[*testStore](r, "missing") })
+	})
+}
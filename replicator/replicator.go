@@ -0,0 +1,259 @@
+// Package replicator provides active-passive replication of entities between two stores,
+// e.g. from a store in the primary region to a store in a passive region.
+//
+// The replicator tails the change events of the source store and applies the mutations to the
+// target store. Conflicts are resolved with last-write-wins on the entity update time, so a
+// replayed or delayed mutation never overwrites a newer entity in the target store.
+//
+// NOTE: Entity expirations are not replicated; replicated entities are written without expiration.
+//
+// Example:
+//
+//	r := replicator.New(primaryStore, passiveStore, func(e *User) int64 { return e.UpdatedAt })
+//	if err := r.Backfill(ctx, tenantKey); err != nil { ... }
+//	r.Start()
+//	defer r.Stop()
+package replicator
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/holmberd/go-entitystore/entitystore"
+	"github.com/holmberd/go-entitystore/eventemitter"
+	"github.com/holmberd/go-entitystore/metrics"
+)
+
+const (
+	MetricLag     = "replicator_lag_seconds"       // Histogram of the delay between a source mutation and its replication.
+	MetricApplied = "replicator_applied_total"     // Counter of entities written or removed in the target store.
+	MetricSkipped = "replicator_skipped_total"     // Counter of entities skipped since the target was newer.
+	MetricErrors  = "replicator_errors_total"      // Counter of failed replication batches.
+	MetricPending = "replicator_pending_mutations" // Histogram of the queue length when a batch is applied.
+
+	defaultQueueSize = 1024 // Default max number of queued mutations.
+	backfillLimit    = 1000 // Page size used during backfill.
+)
+
+const (
+	opAdd    = iota // Mutation adding or updating entities.
+	opRemove        // Mutation removing entities.
+)
+
+// UpdatedAtFunc returns the update time of an entity used for last-write-wins conflict handling.
+type UpdatedAtFunc[T entitystore.Entity, PT entitystore.SerializableEntity[T]] func(entity PT) int64
+
+// Option configures a Replicator.
+type Option func(*options)
+
+type options struct {
+	queueSize    int
+	metrics      metrics.Recorder
+	errorHandler func(err error)
+}
+
+// WithQueueSize sets the max number of queued source mutations.
+// When the queue is full, source event listeners block until there is room.
+func WithQueueSize(size int) Option {
+	return func(o *options) {
+		if size > 0 {
+			o.queueSize = size
+		}
+	}
+}
+
+// WithMetrics sets the recorder for replication metrics, e.g. lag. By default metrics are discarded.
+func WithMetrics(r metrics.Recorder) Option {
+	return func(o *options) {
+		if r != nil {
+			o.metrics = r
+		}
+	}
+}
+
+// WithErrorHandler sets the handler called when a mutation fails to replicate.
+// By default the error is logged.
+func WithErrorHandler(h func(err error)) Option {
+	return func(o *options) {
+		if h != nil {
+			o.errorHandler = h
+		}
+	}
+}
+
+type mutation struct {
+	op        int
+	keys      []string
+	createdAt time.Time
+}
+
+// Replicator replicates entity mutations from a source store to a target store.
+// The replicator is safe for concurrent use.
+type Replicator[T entitystore.Entity, PT entitystore.SerializableEntity[T]] struct {
+	source    entitystore.EntityStorer[T, PT]
+	target    entitystore.EntityStorer[T, PT]
+	updatedAt UpdatedAtFunc[T, PT]
+	opts      options
+
+	mu          sync.Mutex
+	queue       chan mutation
+	done        chan struct{}
+	addToken    eventemitter.ListenerToken
+	removeToken eventemitter.ListenerToken
+	running     bool
+}
+
+// New creates a new instance of a Replicator.
+func New[T entitystore.Entity, PT entitystore.SerializableEntity[T]](
+	source entitystore.EntityStorer[T, PT],
+	target entitystore.EntityStorer[T, PT],
+	updatedAt UpdatedAtFunc[T, PT],
+	opts ...Option,
+) *Replicator[T, PT] {
+	o := options{
+		queueSize: defaultQueueSize,
+		metrics:   metrics.NopRecorder{},
+		errorHandler: func(err error) {
+			log.Printf("replicator: %v", err)
+		},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Replicator[T, PT]{
+		source:    source,
+		target:    target,
+		updatedAt: updatedAt,
+		opts:      o,
+	}
+}
+
+// Start starts tailing the source store change events and applying them to the target store.
+// It's a no-op if the replicator is already running.
+func (r *Replicator[T, PT]) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.running {
+		return
+	}
+	r.running = true
+	r.queue = make(chan mutation, r.opts.queueSize)
+	r.done = make(chan struct{})
+	queue := r.queue
+	r.addToken = r.source.OnAdded().AddListener(func(ctx context.Context, keys []string) {
+		queue <- mutation{op: opAdd, keys: keys, createdAt: time.Now()}
+	})
+	r.removeToken = r.source.OnRemoved().AddListener(func(ctx context.Context, keys []string) {
+		queue <- mutation{op: opRemove, keys: keys, createdAt: time.Now()}
+	})
+	go r.run(queue, r.done)
+}
+
+// Stop stops tailing the source store and waits until all queued mutations are applied.
+// It's a no-op if the replicator isn't running.
+func (r *Replicator[T, PT]) Stop() {
+	r.mu.Lock()
+	if !r.running {
+		r.mu.Unlock()
+		return
+	}
+	r.running = false
+	r.source.OnAdded().RemoveListener(r.addToken)
+	r.source.OnRemoved().RemoveListener(r.removeToken)
+	close(r.queue)
+	done := r.done
+	r.mu.Unlock()
+	<-done
+}
+
+func (r *Replicator[T, PT]) run(queue <-chan mutation, done chan<- struct{}) {
+	defer close(done)
+	ctx := context.Background()
+	for m := range queue {
+		r.opts.metrics.Observe(MetricPending, float64(len(queue)))
+		var err error
+		switch m.op {
+		case opAdd:
+			err = r.apply(ctx, m.keys)
+		case opRemove:
+			err = r.target.RemoveByKeys(ctx, m.keys)
+			if err == nil {
+				r.opts.metrics.Count(MetricApplied, int64(len(m.keys)))
+			}
+		}
+		if err != nil {
+			r.opts.metrics.Count(MetricErrors, 1)
+			r.opts.errorHandler(err)
+			continue
+		}
+		r.opts.metrics.Observe(MetricLag, time.Since(m.createdAt).Seconds())
+	}
+}
+
+// Backfill copies all entities under the parent key from the source store to the target store,
+// using last-write-wins conflict handling. Call Backfill before or after Start for an initial sync.
+func (r *Replicator[T, PT]) Backfill(ctx context.Context, parentKey string) error {
+	cursor := uint64(0)
+	for {
+		page, err := r.source.GetWithPagination(ctx, cursor, backfillLimit, parentKey)
+		if err != nil {
+			return err
+		}
+		if err := r.write(ctx, page.Entities); err != nil {
+			return err
+		}
+		if page.Cursor == 0 {
+			return nil
+		}
+		cursor = page.Cursor
+	}
+}
+
+// apply reads the entities of the keys from the source store and writes them to the target store.
+func (r *Replicator[T, PT]) apply(ctx context.Context, keys []string) error {
+	entities, err := r.source.GetByKeys(ctx, keys)
+	if err != nil {
+		return err
+	}
+	return r.write(ctx, entities)
+}
+
+// write writes the entities to the target store, skipping entities that are older than the
+// entity already stored in the target store.
+func (r *Replicator[T, PT]) write(ctx context.Context, entities []PT) error {
+	if len(entities) == 0 {
+		return nil
+	}
+	keys := make([]string, len(entities))
+	for i, e := range entities {
+		keys[i] = e.GetKey()
+	}
+	existing, err := r.target.GetByKeys(ctx, keys)
+	if err != nil {
+		return err
+	}
+	existingUpdatedAt := make(map[string]int64, len(existing))
+	for _, e := range existing {
+		existingUpdatedAt[e.GetKey()] = r.updatedAt(e)
+	}
+	newer := make([]T, 0, len(entities))
+	for _, e := range entities {
+		if updatedAt, ok := existingUpdatedAt[e.GetKey()]; ok && updatedAt > r.updatedAt(e) {
+			continue // Last write wins.
+		}
+		newer = append(newer, *e)
+	}
+	if skipped := len(entities) - len(newer); skipped > 0 {
+		r.opts.metrics.Count(MetricSkipped, int64(skipped))
+	}
+	if len(newer) == 0 {
+		return nil
+	}
+	if _, err := r.target.AddBatch(ctx, newer, 0); err != nil {
+		return err
+	}
+	r.opts.metrics.Count(MetricApplied, int64(len(newer)))
+	return nil
+}
@@ -0,0 +1,90 @@
+package replicator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/metrics"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/holmberd/go-entitystore/testutil/storetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const tenantID = "tenant1"
+
+var tenantKey, _ = keyfactory.NewTenantKey(tenantID)
+
+func updatedAt(e *testutil.Entity) int64 {
+	return e.UpdatedAt
+}
+
+func TestReplicator(t *testing.T) {
+	ctx := context.Background()
+	// Each region is backed by its own in-memory Redis server.
+	sourceRS, _ := testutil.NewRedisClientWithCleanup(t)
+	sourceDS, err := datastore.NewClient(sourceRS)
+	require.NoError(t, err)
+	targetRS, _ := testutil.NewRedisClientWithCleanup(t)
+	targetDS, err := datastore.NewClient(targetRS)
+	require.NoError(t, err)
+
+	t.Run("Backfill", func(t *testing.T) {
+		source := storetest.NewIsolatedStore[testutil.Entity](t, sourceDS, string(keyfactory.EntityKindTest))
+		target := storetest.NewIsolatedStore[testutil.Entity](t, targetDS, string(keyfactory.EntityKindTest))
+		entities := []testutil.Entity{
+			testutil.NewEntity("e-1", tenantID, 1),
+			testutil.NewEntity("e-2", tenantID, 1),
+		}
+		_, err := source.AddBatch(ctx, entities, 0)
+		require.NoError(t, err)
+
+		r := New(source, target, updatedAt)
+		require.NoError(t, r.Backfill(ctx, tenantKey))
+		replicated, err := target.GetAll(ctx, tenantKey)
+		assert.NoError(t, err)
+		assert.Len(t, replicated, len(entities))
+	})
+
+	t.Run("Replicate mutations", func(t *testing.T) {
+		source := storetest.NewIsolatedStore[testutil.Entity](t, sourceDS, string(keyfactory.EntityKindTest))
+		target := storetest.NewIsolatedStore[testutil.Entity](t, targetDS, string(keyfactory.EntityKindTest))
+		recorder := metrics.NewMemoryRecorder()
+		r := New(source, target, updatedAt, WithMetrics(recorder))
+		r.Start()
+
+		e1, e2 := testutil.NewEntity("e-1", tenantID, 1), testutil.NewEntity("e-2", tenantID, 1)
+		_, err := source.AddBatch(ctx, []testutil.Entity{e1, e2}, 0)
+		require.NoError(t, err)
+		require.NoError(t, source.Remove(ctx, e2.GetKey()))
+		r.Stop() // Waits until all queued mutations are applied.
+
+		replicated, err := target.GetAll(ctx, tenantKey)
+		assert.NoError(t, err)
+		require.Len(t, replicated, 1)
+		assert.Equal(t, e1, *replicated[0])
+		assert.Equal(t, int64(2), recorder.Histogram(MetricLag).Count, "should record lag per mutation")
+	})
+
+	t.Run("Last write wins", func(t *testing.T) {
+		source := storetest.NewIsolatedStore[testutil.Entity](t, sourceDS, string(keyfactory.EntityKindTest))
+		target := storetest.NewIsolatedStore[testutil.Entity](t, targetDS, string(keyfactory.EntityKindTest))
+		newer := testutil.NewEntity("e-1", tenantID, 2)
+		newer.Data = "newer"
+		_, err := target.Add(ctx, newer, 0)
+		require.NoError(t, err)
+
+		r := New(source, target, updatedAt)
+		r.Start()
+		older := testutil.NewEntity("e-1", tenantID, 1)
+		older.Data = "older"
+		_, err = source.Add(ctx, older, 0)
+		require.NoError(t, err)
+		r.Stop()
+		got, err := target.Get(ctx, newer.GetKey())
+		require.NoError(t, err)
+		assert.Equal(t, "newer", got.Data, "should not overwrite a newer entity")
+	})
+}
@@ -0,0 +1,362 @@
+// Package searchindex keeps an external search index, e.g. Elasticsearch or OpenSearch, in sync
+// with the entities of a store.
+//
+// The syncer tails the change events of the store, and indexes the changed entities in batches
+// with the bulk API of the index, retrying failed batches. Entities are read from the store when
+// their batch is flushed, so a batch indexes the latest version of each entity, and entities
+// removed in the meantime are deleted from the index. Use Reindex for an initial sync, or to
+// repair the index after batches failed all retries.
+//
+// Example:
+//
+//	s := searchindex.New(userStore, openSearchIndex, func(u *User) (any, error) { return u, nil })
+//	if _, err := s.Reindex(ctx, tenantKey); err != nil { ... }
+//	s.Start()
+//	defer s.Stop()
+package searchindex
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/holmberd/go-entitystore/entitystore"
+	"github.com/holmberd/go-entitystore/eventemitter"
+	"github.com/holmberd/go-entitystore/metrics"
+)
+
+const (
+	MetricIndexed = "searchindex_indexed_total" // Counter of documents indexed.
+	MetricDeleted = "searchindex_deleted_total" // Counter of documents deleted.
+	MetricRetries = "searchindex_retries_total" // Counter of retried index requests.
+	MetricErrors  = "searchindex_errors_total"  // Counter of batches that failed all retries.
+
+	defaultBatchSize     = 500         // Default max number of entities per batch.
+	defaultFlushInterval = time.Second // Default max delay before a batch is flushed.
+	defaultRetries       = 3           // Default number of retries of a failed index request.
+	defaultRetryBackoff  = 100 * time.Millisecond
+	reindexLimit         = 1000 // Page size used during reindex.
+)
+
+// Document is a document of the search index.
+type Document struct {
+	ID   string // Document ID, i.e. the entity key.
+	Body any    // Document body, e.g. encoded as JSON by the index client.
+}
+
+// Index is the subset of a search index client used to keep the index in sync,
+// e.g. implemented with the bulk API of Elasticsearch or OpenSearch.
+type Index interface {
+	// Index creates or replaces the documents.
+	Index(ctx context.Context, docs []Document) error
+	// Delete deletes the documents with the IDs. Documents not in the index are ignored.
+	Delete(ctx context.Context, ids []string) error
+}
+
+// DocumentFunc returns the document body of an entity.
+type DocumentFunc[T entitystore.Entity, PT entitystore.SerializableEntity[T]] func(entity PT) (any, error)
+
+// Option configures a Syncer.
+type Option func(*options)
+
+type options struct {
+	batchSize     int
+	flushInterval time.Duration
+	retries       int
+	retryBackoff  time.Duration
+	metrics       metrics.Recorder
+	errorHandler  func(err error)
+}
+
+// WithBatchSize sets the max number of entities per batch. A batch is flushed when it's full.
+func WithBatchSize(size int) Option {
+	return func(o *options) {
+		if size > 0 {
+			o.batchSize = size
+		}
+	}
+}
+
+// WithFlushInterval sets the max delay before changed entities are flushed to the index.
+func WithFlushInterval(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.flushInterval = d
+		}
+	}
+}
+
+// WithRetries sets the number of retries of a failed index request, and the backoff before the
+// first retry, doubled for each further retry.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(o *options) {
+		if retries >= 0 {
+			o.retries = retries
+		}
+		if backoff > 0 {
+			o.retryBackoff = backoff
+		}
+	}
+}
+
+// WithMetrics sets the recorder for sync metrics. By default metrics are discarded.
+func WithMetrics(r metrics.Recorder) Option {
+	return func(o *options) {
+		if r != nil {
+			o.metrics = r
+		}
+	}
+}
+
+// WithErrorHandler sets the handler called when a batch fails all retries.
+// By default the error is logged.
+func WithErrorHandler(h func(err error)) Option {
+	return func(o *options) {
+		if h != nil {
+			o.errorHandler = h
+		}
+	}
+}
+
+// Syncer keeps a search index in sync with the entities of a store.
+// The syncer is safe for concurrent use.
+type Syncer[T entitystore.Entity, PT entitystore.SerializableEntity[T]] struct {
+	store    entitystore.EntityStorer[T, PT]
+	index    Index
+	document DocumentFunc[T, PT]
+	opts     options
+
+	mu      sync.Mutex
+	pending map[string]struct{} // Keys of changed entities.
+	full    chan struct{}       // Signals a full batch.
+	done    chan struct{}
+	stopped chan struct{}
+	tokens  []eventemitter.ListenerToken
+	running bool
+	flushMu sync.Mutex // Serializes flushes, so batches are indexed in order.
+}
+
+// New creates a new instance of a Syncer.
+func New[T entitystore.Entity, PT entitystore.SerializableEntity[T]](
+	store entitystore.EntityStorer[T, PT],
+	index Index,
+	document DocumentFunc[T, PT],
+	opts ...Option,
+) *Syncer[T, PT] {
+	o := options{
+		batchSize:     defaultBatchSize,
+		flushInterval: defaultFlushInterval,
+		retries:       defaultRetries,
+		retryBackoff:  defaultRetryBackoff,
+		metrics:       metrics.NopRecorder{},
+		errorHandler: func(err error) {
+			log.Printf("searchindex: %v", err)
+		},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Syncer[T, PT]{
+		store:    store,
+		index:    index,
+		document: document,
+		opts:     o,
+		pending:  make(map[string]struct{}),
+	}
+}
+
+// Start starts tailing the store change events and flushing the changed entities to the index.
+// It's a no-op if the syncer is already running.
+func (s *Syncer[T, PT]) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return
+	}
+	s.running = true
+	s.full = make(chan struct{}, 1)
+	s.done = make(chan struct{})
+	s.stopped = make(chan struct{})
+	listener := func(ctx context.Context, keys []string) {
+		s.enqueue(keys)
+	}
+	s.tokens = []eventemitter.ListenerToken{
+		s.store.OnAdded().AddListener(listener),
+		s.store.OnUpdated().AddListener(listener),
+		s.store.OnRemoved().AddListener(listener),
+	}
+	go s.run(s.full, s.done, s.stopped)
+}
+
+// Stop stops tailing the store and waits until the changed entities are flushed.
+// It's a no-op if the syncer isn't running.
+func (s *Syncer[T, PT]) Stop() {
+	s.mu.Lock()
+	if !s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.running = false
+	s.store.OnAdded().RemoveListener(s.tokens[0])
+	s.store.OnUpdated().RemoveListener(s.tokens[1])
+	s.store.OnRemoved().RemoveListener(s.tokens[2])
+	close(s.done)
+	stopped := s.stopped
+	s.mu.Unlock()
+	<-stopped
+}
+
+// enqueue adds the keys of changed entities to the pending batch.
+func (s *Syncer[T, PT]) enqueue(keys []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		s.pending[key] = struct{}{}
+	}
+	if len(s.pending) >= s.opts.batchSize {
+		select {
+		case s.full <- struct{}{}:
+		default: // Already signaled.
+		}
+	}
+}
+
+func (s *Syncer[T, PT]) run(full <-chan struct{}, done <-chan struct{}, stopped chan<- struct{}) {
+	defer close(stopped)
+	ctx := context.Background()
+	ticker := time.NewTicker(s.opts.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-full:
+		case <-ticker.C:
+		case <-done:
+			if err := s.Flush(ctx); err != nil {
+				s.opts.errorHandler(err)
+			}
+			return
+		}
+		if err := s.Flush(ctx); err != nil {
+			s.opts.errorHandler(err)
+		}
+	}
+}
+
+// Flush flushes the changed entities to the index in batches, without waiting for the flush interval.
+// Entities of batches that fail all retries are dropped and the error is returned.
+func (s *Syncer[T, PT]) Flush(ctx context.Context) error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+	s.mu.Lock()
+	keys := make([]string, 0, len(s.pending))
+	for key := range s.pending {
+		keys = append(keys, key)
+	}
+	clear(s.pending)
+	s.mu.Unlock()
+
+	var firstErr error
+	for start := 0; start < len(keys); start += s.opts.batchSize {
+		batch := keys[start:min(start+s.opts.batchSize, len(keys))]
+		if err := s.sync(ctx, batch); err != nil {
+			s.opts.metrics.Count(MetricErrors, 1)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// sync indexes the entities of the keys, and deletes the documents of entities not in the store.
+func (s *Syncer[T, PT]) sync(ctx context.Context, keys []string) error {
+	entities, err := s.store.GetByKeys(ctx, keys)
+	if err != nil {
+		return fmt.Errorf("searchindex: read entities: %w", err)
+	}
+	found := make(map[string]struct{}, len(entities))
+	for _, e := range entities {
+		found[e.GetKey()] = struct{}{}
+	}
+	var removed []string
+	for _, key := range keys {
+		if _, ok := found[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+	if err := s.indexEntities(ctx, entities); err != nil {
+		return err
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	if err := s.retry(ctx, func() error { return s.index.Delete(ctx, removed) }); err != nil {
+		return fmt.Errorf("searchindex: delete %d documents: %w", len(removed), err)
+	}
+	s.opts.metrics.Count(MetricDeleted, int64(len(removed)))
+	return nil
+}
+
+// indexEntities indexes the documents of the entities.
+func (s *Syncer[T, PT]) indexEntities(ctx context.Context, entities []PT) error {
+	if len(entities) == 0 {
+		return nil
+	}
+	docs := make([]Document, 0, len(entities))
+	for _, e := range entities {
+		body, err := s.document(e)
+		if err != nil {
+			return fmt.Errorf("searchindex: document of entity '%s': %w", e.GetKey(), err)
+		}
+		docs = append(docs, Document{ID: e.GetKey(), Body: body})
+	}
+	if err := s.retry(ctx, func() error { return s.index.Index(ctx, docs) }); err != nil {
+		return fmt.Errorf("searchindex: index %d documents: %w", len(docs), err)
+	}
+	s.opts.metrics.Count(MetricIndexed, int64(len(docs)))
+	return nil
+}
+
+// retry calls fn until it succeeds or the retries are exhausted, backing off exponentially.
+func (s *Syncer[T, PT]) retry(ctx context.Context, fn func() error) error {
+	backoff := s.opts.retryBackoff
+	err := fn()
+	for attempt := 0; err != nil && attempt < s.opts.retries; attempt++ {
+		s.opts.metrics.Count(MetricRetries, 1)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		err = fn()
+	}
+	return err
+}
+
+// Reindex indexes all entities under the parent key, paging through the store, and returns the
+// number of indexed entities. Documents of entities no longer in the store aren't deleted; recreate
+// the index to remove them.
+func (s *Syncer[T, PT]) Reindex(ctx context.Context, parentKey string) (int, error) {
+	n := 0
+	cursor := uint64(0)
+	for {
+		page, err := s.store.GetWithPagination(ctx, cursor, reindexLimit, parentKey)
+		if err != nil {
+			return n, err
+		}
+		for start := 0; start < len(page.Entities); start += s.opts.batchSize {
+			batch := page.Entities[start:min(start+s.opts.batchSize, len(page.Entities))]
+			if err := s.indexEntities(ctx, batch); err != nil {
+				return n, err
+			}
+			n += len(batch)
+		}
+		if page.Cursor == 0 {
+			return n, nil
+		}
+		cursor = page.Cursor
+	}
+}
@@ -0,0 +1,179 @@
+package searchindex
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/metrics"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/holmberd/go-entitystore/testutil/storetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const tenantID = "tenant1"
+
+var tenantKey, _ = keyfactory.NewTenantKey(tenantID)
+
+// memoryIndex is an in-memory Index failing the first failures requests.
+type memoryIndex struct {
+	mu       sync.Mutex
+	docs     map[string]any
+	requests int
+	failures int
+}
+
+func newMemoryIndex() *memoryIndex {
+	return &memoryIndex{docs: make(map[string]any)}
+}
+
+func (m *memoryIndex) fail() error {
+	m.requests++
+	if m.failures > 0 {
+		m.failures--
+		return errors.New("index unavailable")
+	}
+	return nil
+}
+
+func (m *memoryIndex) Index(ctx context.Context, docs []Document) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.fail(); err != nil {
+		return err
+	}
+	for _, d := range docs {
+		m.docs[d.ID] = d.Body
+	}
+	return nil
+}
+
+func (m *memoryIndex) Delete(ctx context.Context, ids []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.fail(); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		delete(m.docs, id)
+	}
+	return nil
+}
+
+func (m *memoryIndex) snapshot() map[string]any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	docs := make(map[string]any, len(m.docs))
+	for id, body := range m.docs {
+		docs[id] = body
+	}
+	return docs
+}
+
+func document(e *testutil.Entity) (any, error) {
+	return e.Data, nil
+}
+
+func TestSyncer(t *testing.T) {
+	ctx := context.Background()
+	rsClient, _ := testutil.NewRedisClientWithCleanup(t)
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+
+	t.Run("Sync changes", func(t *testing.T) {
+		store := storetest.NewIsolatedStore[testutil.Entity](t, dsClient, string(keyfactory.EntityKindTest))
+		index := newMemoryIndex()
+		recorder := metrics.NewMemoryRecorder()
+		s := New(store, index, document, WithFlushInterval(time.Hour), WithMetrics(recorder))
+		s.Start()
+
+		e1, e2 := testutil.NewEntity("e-1", tenantID, 1), testutil.NewEntity("e-2", tenantID, 1)
+		e1.Data, e2.Data = "one", "two"
+		_, err := store.AddBatch(ctx, []testutil.Entity{e1, e2}, 0)
+		require.NoError(t, err)
+		require.NoError(t, s.Flush(ctx))
+		assert.Equal(t, map[string]any{e1.GetKey(): "one", e2.GetKey(): "two"}, index.snapshot())
+
+		e1.Data = "uno"
+		_, err = store.Add(ctx, e1, 0)
+		require.NoError(t, err)
+		require.NoError(t, store.Remove(ctx, e2.GetKey()))
+		s.Stop() // Flushes the pending changes.
+
+		assert.Equal(t, map[string]any{e1.GetKey(): "uno"}, index.snapshot())
+		assert.Equal(t, int64(3), recorder.Counter(MetricIndexed))
+		assert.Equal(t, int64(1), recorder.Counter(MetricDeleted))
+	})
+
+	t.Run("Flush full batch", func(t *testing.T) {
+		store := storetest.NewIsolatedStore[testutil.Entity](t, dsClient, string(keyfactory.EntityKindTest))
+		index := newMemoryIndex()
+		s := New(store, index, document, WithBatchSize(2), WithFlushInterval(time.Hour))
+		s.Start()
+		defer s.Stop()
+
+		_, err := store.AddBatch(ctx, []testutil.Entity{
+			testutil.NewEntity("e-1", tenantID, 1),
+			testutil.NewEntity("e-2", tenantID, 1),
+		}, 0)
+		require.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			return len(index.snapshot()) == 2
+		}, time.Second, 10*time.Millisecond, "should flush without waiting for the interval")
+	})
+
+	t.Run("Retry failed batch", func(t *testing.T) {
+		store := storetest.NewIsolatedStore[testutil.Entity](t, dsClient, string(keyfactory.EntityKindTest))
+		index := newMemoryIndex()
+		index.failures = 2
+		recorder := metrics.NewMemoryRecorder()
+		s := New(store, index, document, WithRetries(2, time.Millisecond), WithMetrics(recorder))
+
+		e := testutil.NewEntity("e-1", tenantID, 1)
+		_, err := store.Add(ctx, e, 0)
+		require.NoError(t, err)
+		s.enqueue([]string{e.GetKey()})
+		require.NoError(t, s.Flush(ctx))
+		assert.Len(t, index.snapshot(), 1)
+		assert.Equal(t, int64(2), recorder.Counter(MetricRetries))
+	})
+
+	t.Run("Report failed batch", func(t *testing.T) {
+		store := storetest.NewIsolatedStore[testutil.Entity](t, dsClient, string(keyfactory.EntityKindTest))
+		index := newMemoryIndex()
+		index.failures = 3
+		recorder := metrics.NewMemoryRecorder()
+		s := New(store, index, document, WithRetries(2, time.Millisecond), WithMetrics(recorder))
+
+		e := testutil.NewEntity("e-1", tenantID, 1)
+		_, err := store.Add(ctx, e, 0)
+		require.NoError(t, err)
+		s.enqueue([]string{e.GetKey()})
+		assert.Error(t, s.Flush(ctx))
+		assert.Empty(t, index.snapshot())
+		assert.Equal(t, int64(1), recorder.Counter(MetricErrors))
+	})
+
+	t.Run("Reindex", func(t *testing.T) {
+		store := storetest.NewIsolatedStore[testutil.Entity](t, dsClient, string(keyfactory.EntityKindTest))
+		index := newMemoryIndex()
+		entities := make([]testutil.Entity, 25)
+		for i := range entities {
+			entities[i] = testutil.NewEntity("e-"+string(rune('a'+i)), tenantID, 1)
+		}
+		_, err := store.AddBatch(ctx, entities, 0)
+		require.NoError(t, err)
+
+		s := New(store, index, document, WithBatchSize(10))
+		n, err := s.Reindex(ctx, tenantKey)
+		require.NoError(t, err)
+		assert.Equal(t, len(entities), n)
+		assert.Len(t, index.snapshot(), len(entities))
+		assert.Equal(t, 3, index.requests, "should index in batches")
+	})
+}
@@ -0,0 +1,112 @@
+// Package storestats keeps live counters of the change events emitted by a store, and exposes
+// them through expvar, so operators can confirm at a glance whether a store receives traffic.
+//
+// The counters are served as JSON by the expvar HTTP handler at /debug/vars:
+//
+//	stats, detach := storestats.Publish("entitystore.user", userStore)
+//	defer detach()
+//	http.Handle("/debug/vars", expvar.Handler())
+package storestats
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"sync/atomic"
+	"time"
+
+	"github.com/holmberd/go-entitystore/entitystore"
+)
+
+// Snapshot is a point-in-time copy of the counters.
+type Snapshot struct {
+	Added         int64     `json:"added"`           // Number of added entities.
+	Updated       int64     `json:"updated"`         // Number of updated entities.
+	Removed       int64     `json:"removed"`         // Number of removed entities.
+	Flushed       int64     `json:"flushed"`         // Number of store flushes.
+	Events        int64     `json:"events"`          // Total number of events.
+	LastEventTime time.Time `json:"last_event_time"` // Time of the last event, or zero if none.
+}
+
+// Stats counts the change events of a store. It implements expvar.Var.
+// Stats is safe for concurrent use.
+type Stats struct {
+	added     atomic.Int64
+	updated   atomic.Int64
+	removed   atomic.Int64
+	flushed   atomic.Int64
+	events    atomic.Int64
+	lastEvent atomic.Int64 // Unix time in nanoseconds, or 0 if none.
+}
+
+// Snapshot returns a copy of the current counters.
+func (s *Stats) Snapshot() Snapshot {
+	snap := Snapshot{
+		Added:   s.added.Load(),
+		Updated: s.updated.Load(),
+		Removed: s.removed.Load(),
+		Flushed: s.flushed.Load(),
+		Events:  s.events.Load(),
+	}
+	if t := s.lastEvent.Load(); t != 0 {
+		snap.LastEventTime = time.Unix(0, t).UTC()
+	}
+	return snap
+}
+
+// String returns the counters as JSON.
+func (s *Stats) String() string {
+	b, err := json.Marshal(s.Snapshot())
+	if err != nil {
+		return "{}" // Never fails for the snapshot type.
+	}
+	return string(b)
+}
+
+// record counts an event.
+func (s *Stats) record(counter *atomic.Int64, delta int) {
+	counter.Add(int64(delta))
+	s.events.Add(1)
+	s.lastEvent.Store(time.Now().UnixNano())
+}
+
+// Attach counts the added, updated, removed, and flushed events of the store in the stats.
+// It returns a function detaching the stats from the store.
+func Attach[T entitystore.Entity, PT entitystore.SerializableEntity[T]](
+	stats *Stats,
+	store entitystore.EntityStorer[T, PT],
+) (detach func()) {
+	counter := func(c *atomic.Int64, perKey bool) entitystore.EntityStoreListener {
+		return func(ctx context.Context, keys []string) {
+			delta := 1
+			if perKey {
+				delta = len(keys)
+			}
+			stats.record(c, delta)
+		}
+	}
+	addedToken := store.OnAdded().AddListener(counter(&stats.added, true))
+	updatedToken := store.OnUpdated().AddListener(counter(&stats.updated, true))
+	removedToken := store.OnRemoved().AddListener(counter(&stats.removed, true))
+	flushedToken := store.OnFlushed().AddListener(counter(&stats.flushed, false))
+	return func() {
+		store.OnAdded().RemoveListener(addedToken)
+		store.OnUpdated().RemoveListener(updatedToken)
+		store.OnRemoved().RemoveListener(removedToken)
+		store.OnFlushed().RemoveListener(flushedToken)
+	}
+}
+
+// Publish attaches new stats to the store and publishes them as the expvar with the name.
+// It returns the stats and a function detaching them from the store; the expvar remains
+// published, since expvar doesn't support removing variables.
+//
+// NOTE: Like expvar.Publish, it panics if the name is already published.
+func Publish[T entitystore.Entity, PT entitystore.SerializableEntity[T]](
+	name string,
+	store entitystore.EntityStorer[T, PT],
+) (*Stats, func()) {
+	stats := &Stats{}
+	expvar.Publish(name, stats)
+	return stats, Attach(stats, store)
+}
@@ -0,0 +1,49 @@
+package storestats
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"testing"
+	"time"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/entitystore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/holmberd/go-entitystore/testutil/storetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublish(t *testing.T) {
+	ctx := context.Background()
+	rsClient, _ := testutil.NewRedisClientWithCleanup(t)
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	store := storetest.NewIsolatedStore[testutil.Entity](t, dsClient, string(keyfactory.EntityKindTest), entitystore.WithAllowFlush())
+	stats, detach := Publish("entitystore.test", store)
+
+	assert.Equal(t, Snapshot{}, stats.Snapshot())
+	e1, e2 := testutil.NewEntity("e-1", "acme", 1), testutil.NewEntity("e-2", "acme", 1)
+	_, err = store.AddBatch(ctx, []testutil.Entity{e1, e2}, 0)
+	require.NoError(t, err)
+	require.NoError(t, store.Remove(ctx, e1.GetKey()))
+	require.NoError(t, store.Flush(ctx))
+
+	snap := stats.Snapshot()
+	assert.Equal(t, int64(2), snap.Added)
+	assert.Equal(t, int64(1), snap.Removed)
+	assert.Equal(t, int64(1), snap.Flushed)
+	assert.Equal(t, int64(3), snap.Events)
+	assert.WithinDuration(t, time.Now(), snap.LastEventTime, time.Second)
+
+	var published Snapshot
+	require.NoError(t, json.Unmarshal([]byte(expvar.Get("entitystore.test").String()), &published))
+	assert.Equal(t, snap.Added, published.Added)
+
+	detach()
+	_, err = store.Add(ctx, e1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.Snapshot().Added, "should not count after detach")
+}
@@ -0,0 +1,117 @@
+package testutil
+
+import (
+	"fmt"
+
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers of the Entity message.
+const (
+	entityKey       = 1
+	entityID        = 2
+	entityTenantID  = 3
+	entityUpdatedAt = 4
+	entityData      = 5
+)
+
+// Entity is a minimal entity for testing stores, serialized in the protobuf wire format as the
+// message:
+//
+//	message Entity {
+//	  string key = 1;
+//	  string id = 2;
+//	  string tenant_id = 3;
+//	  int64 updated_at = 4;
+//	  string data = 5;
+//	}
+type Entity struct {
+	Key       string `json:"key"`
+	ID        string `json:"id"`
+	TenantID  string `json:"tenantId"`
+	UpdatedAt int64  `json:"updatedAt"`
+	Data      string `json:"data,omitempty"`
+}
+
+// NewEntity returns a new test entity keyed under the tenant.
+// It panics if the ID or tenant ID isn't a valid key fragment.
+func NewEntity(id string, tenantID string, updatedAt int64) Entity {
+	parentKey, err := keyfactory.NewTenantKey(tenantID)
+	if err != nil {
+		panic(err)
+	}
+	key, err := keyfactory.NewEntityKey(keyfactory.EntityKindTest, id, "", parentKey)
+	if err != nil {
+		panic(err)
+	}
+	return Entity{Key: key, ID: id, TenantID: tenantID, UpdatedAt: updatedAt}
+}
+
+func (e Entity) GetKey() string {
+	return e.Key
+}
+
+func (e Entity) GetID() string {
+	return e.ID
+}
+
+func (e Entity) MarshalProto() ([]byte, error) {
+	var b []byte
+	for _, f := range []struct {
+		num protowire.Number
+		val string
+	}{
+		{entityKey, e.Key},
+		{entityID, e.ID},
+		{entityTenantID, e.TenantID},
+		{entityData, e.Data},
+	} {
+		if f.val != "" { // Proto3 omits default values.
+			b = protowire.AppendTag(b, f.num, protowire.BytesType)
+			b = protowire.AppendString(b, f.val)
+		}
+	}
+	if e.UpdatedAt != 0 {
+		b = protowire.AppendTag(b, entityUpdatedAt, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(e.UpdatedAt))
+	}
+	return b, nil
+}
+
+func (e *Entity) UnmarshalProto(data []byte) error {
+	*e = Entity{}
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return fmt.Errorf("testutil: invalid entity: %w", protowire.ParseError(n))
+		}
+		data = data[n:]
+		var field *string
+		switch num {
+		case entityKey:
+			field = &e.Key
+		case entityID:
+			field = &e.ID
+		case entityTenantID:
+			field = &e.TenantID
+		case entityData:
+			field = &e.Data
+		}
+		switch {
+		case field != nil && typ == protowire.BytesType:
+			*field, n = protowire.ConsumeString(data)
+		case num == entityUpdatedAt && typ == protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(data)
+			e.UpdatedAt = int64(v)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data) // Skips unknown fields.
+		}
+		if n < 0 {
+			return fmt.Errorf("testutil: invalid entity field %d: %w", num, protowire.ParseError(n))
+		}
+		data = data[n:]
+	}
+	return nil
+}
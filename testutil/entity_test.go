@@ -0,0 +1,40 @@
+package testutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestEntityProto(t *testing.T) {
+	t.Run("Round trip", func(t *testing.T) {
+		e := NewEntity("e-1", "tenant1", -1)
+		e.Data = "data"
+		b, err := e.MarshalProto()
+		require.NoError(t, err)
+		var got Entity
+		require.NoError(t, got.UnmarshalProto(b))
+		assert.Equal(t, e, got)
+
+		b, err = Entity{}.MarshalProto()
+		require.NoError(t, err)
+		assert.Empty(t, b, "should omit default values")
+	})
+
+	t.Run("Wire format", func(t *testing.T) {
+		var b []byte
+		b = protowire.AppendTag(b, 9, protowire.VarintType) // Unknown field.
+		b = protowire.AppendVarint(b, 1)
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendString(b, "e-1")
+		b = protowire.AppendTag(b, 4, protowire.VarintType)
+		b = protowire.AppendVarint(b, 7)
+		var got Entity
+		require.NoError(t, got.UnmarshalProto(b))
+		assert.Equal(t, Entity{ID: "e-1", UpdatedAt: 7}, got, "should skip unknown fields")
+
+		assert.Error(t, got.UnmarshalProto([]byte{0x12, 0x05, 'e'}), "should reject truncated fields")
+	})
+}
@@ -0,0 +1,86 @@
+package testutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrInjectedFault is wrapped by the errors of commands failed by a FaultInjector.
+// The errors also wrap syscall.ECONNRESET, so the datastore reports them as unavailability.
+var ErrInjectedFault = errors.New("testutil: injected fault")
+
+// FaultInjector fails random Redis commands issued through a client, e.g. to test that failures
+// are surfaced and leave the store consistent. Failed commands, or pipelines, aren't sent.
+// It implements redis.Hook, and is safe for concurrent use.
+type FaultInjector struct {
+	mu     sync.Mutex
+	rng    *rand.Rand
+	rate   float64
+	faults int
+}
+
+// WithFaults returns a new Redis client with the same options as the Redis client, which fails
+// each command, or pipeline, with the probability rate, drawn from the seed so a run is
+// reproducible. The client is closed on test cleanup.
+//
+// Example:
+//
+//	faultyClient, faults := testutil.WithFaults(t, rsClient, seed, 0.1)
+//	...
+//	faults.SetRate(0) // Verify the state without faults.
+func WithFaults(t testing.TB, rsClient *redis.Client, seed int64, rate float64) (*redis.Client, *FaultInjector) {
+	f := &FaultInjector{rng: rand.New(rand.NewSource(seed)), rate: rate}
+	faultyClient := redis.NewClient(rsClient.Options())
+	faultyClient.AddHook(f)
+	t.Cleanup(func() {
+		faultyClient.Close()
+	})
+	return faultyClient, f
+}
+
+// SetRate sets the probability of failing a command.
+func (f *FaultInjector) SetRate(rate float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rate = rate
+}
+
+// Faults returns the number of failed commands and pipelines.
+func (f *FaultInjector) Faults() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.faults
+}
+
+func (f *FaultInjector) fault(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.rate <= 0 || f.rng.Float64() >= f.rate {
+		return nil
+	}
+	f.faults++
+	return fmt.Errorf("%w: %s: %w", ErrInjectedFault, name, syscall.ECONNRESET)
+}
+
+func (f *FaultInjector) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, f.fault(cmd.Name())
+}
+
+func (f *FaultInjector) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	return nil
+}
+
+func (f *FaultInjector) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, f.fault("pipeline")
+}
+
+func (f *FaultInjector) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
@@ -0,0 +1,32 @@
+package testutil
+
+import (
+	"context"
+	"syscall"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithFaults(t *testing.T) {
+	rsClient, _ := NewRedisClientWithCleanup(t)
+	faultyClient, faults := WithFaults(t, rsClient, 1, 1)
+	ctx := context.Background()
+
+	err := faultyClient.Set(ctx, "key", "value", 0).Err()
+	assert.ErrorIs(t, err, ErrInjectedFault)
+	assert.ErrorIs(t, err, syscall.ECONNRESET)
+	assert.Equal(t, int64(0), rsClient.Exists(ctx, "key").Val(), "should not send failed command")
+	_, err = faultyClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, "key", "value", 0)
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrInjectedFault)
+	assert.Equal(t, 2, faults.Faults())
+
+	faults.SetRate(0)
+	require.NoError(t, faultyClient.Set(ctx, "key", "value", 0).Err())
+	assert.Equal(t, 2, faults.Faults())
+}
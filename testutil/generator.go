@@ -0,0 +1,145 @@
+package testutil
+
+import (
+	"math/rand"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+// SeedEnv is the environment variable overriding the seed of generators created by NewTestGenerator.
+const SeedEnv = "ENTITYSTORE_TEST_SEED"
+
+const idLetters = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// GeneratorOption configures a Generator.
+type GeneratorOption func(*Generator)
+
+// WithValueBytes sets the size of the data of generated entities. Defaults to 0.
+func WithValueBytes(n int) GeneratorOption {
+	return func(g *Generator) {
+		if n >= 0 {
+			g.valueBytes = n
+		}
+	}
+}
+
+// WithIDLength sets the length of generated IDs. Defaults to 10.
+func WithIDLength(n int) GeneratorOption {
+	return func(g *Generator) {
+		if n > 0 {
+			g.idLength = n
+		}
+	}
+}
+
+// WithParentDepth sets the number of parent keys of generated entities, i.e. a tenant key
+// followed by depth-1 nested entity keys. Defaults to 1.
+func WithParentDepth(depth int) GeneratorOption {
+	return func(g *Generator) {
+		if depth > 0 {
+			g.parentDepth = depth
+		}
+	}
+}
+
+// Generator generates deterministic test entities from a seed, so a failing test is reproduced
+// exactly by generating with the same seed.
+// A generator isn't safe for concurrent use.
+type Generator struct {
+	seed        int64
+	rng         *rand.Rand
+	valueBytes  int
+	idLength    int
+	parentDepth int
+}
+
+// NewGenerator creates a new instance of a Generator with the seed.
+func NewGenerator(seed int64, opts ...GeneratorOption) *Generator {
+	g := &Generator{
+		seed:        seed,
+		rng:         rand.New(rand.NewSource(seed)),
+		idLength:    10,
+		parentDepth: 1,
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+// NewTestGenerator creates a new instance of a Generator with the seed set by SeedEnv, or a
+// time-based seed otherwise. The seed is logged so a failing test can be reproduced.
+func NewTestGenerator(t testing.TB, opts ...GeneratorOption) *Generator {
+	t.Helper()
+	seed := time.Now().UnixNano()
+	if v := os.Getenv(SeedEnv); v != "" {
+		var err error
+		if seed, err = strconv.ParseInt(v, 10, 64); err != nil {
+			t.Fatalf("testutil: invalid %s '%s': %v", SeedEnv, v, err)
+		}
+	}
+	t.Logf("testutil: generator seed %d (set %s to reproduce)", seed, SeedEnv)
+	return NewGenerator(seed, opts...)
+}
+
+// Seed returns the seed of the generator.
+func (g *Generator) Seed() int64 {
+	return g.seed
+}
+
+// ID returns a new random lower-case alphanumeric ID.
+func (g *Generator) ID() string {
+	id := make([]byte, g.idLength)
+	for i := range id {
+		id[i] = idLetters[g.rng.Intn(len(idLetters))]
+	}
+	return string(id)
+}
+
+// ParentKey returns a new random parent key with the configured depth.
+// It panics if the key exceeds the max key length.
+func (g *Generator) ParentKey() string {
+	key, err := keyfactory.NewTenantKey(g.ID())
+	if err != nil {
+		panic(err)
+	}
+	for i := 1; i < g.parentDepth; i++ {
+		if key, err = keyfactory.NewEntityKey(keyfactory.EntityKindTest, g.ID(), "", key); err != nil {
+			panic(err)
+		}
+	}
+	return key
+}
+
+// Entity returns a new random entity under the parent key.
+// It panics if the key exceeds the max key length.
+func (g *Generator) Entity(parentKey string) Entity {
+	id := g.ID()
+	key, err := keyfactory.NewEntityKey(keyfactory.EntityKindTest, id, "", parentKey)
+	if err != nil {
+		panic(err)
+	}
+	data := make([]byte, g.valueBytes)
+	for i := range data {
+		data[i] = idLetters[g.rng.Intn(len(idLetters))]
+	}
+	return Entity{
+		Key:       key,
+		ID:        id,
+		UpdatedAt: g.rng.Int63n(1 << 40),
+		Data:      string(data),
+	}
+}
+
+// Entities returns n new random entities under the parent key.
+func (g *Generator) Entities(parentKey string, n int) []Entity {
+	entities := make([]Entity, n)
+	for i := range entities {
+		entities[i] = g.Entity(parentKey)
+	}
+	return entities
+}
@@ -0,0 +1,34 @@
+package testutil
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerator(t *testing.T) {
+	t.Run("Deterministic", func(t *testing.T) {
+		g1 := NewGenerator(42, WithValueBytes(16))
+		g2 := NewGenerator(42, WithValueBytes(16))
+		assert.Equal(t, g1.Entities(g1.ParentKey(), 10), g2.Entities(g2.ParentKey(), 10))
+		g3 := NewGenerator(43, WithValueBytes(16))
+		assert.NotEqual(t, g1.Entities(g1.ParentKey(), 10), g3.Entities(g3.ParentKey(), 10))
+	})
+
+	t.Run("Sizes", func(t *testing.T) {
+		g := NewGenerator(1, WithValueBytes(1<<20), WithIDLength(64), WithParentDepth(4))
+		parentKey := g.ParentKey()
+		assert.Equal(t, 8, strings.Count(parentKey, ":")+1, "should nest 4 parent keys")
+		e := g.Entity(parentKey)
+		assert.Len(t, e.ID, 64)
+		assert.Len(t, e.Data, 1<<20)
+		assert.True(t, strings.HasPrefix(e.GetKey(), parentKey+":"))
+	})
+
+	t.Run("Seed from env", func(t *testing.T) {
+		t.Setenv(SeedEnv, "7")
+		g := NewTestGenerator(t)
+		assert.Equal(t, int64(7), g.Seed())
+	})
+}
@@ -0,0 +1,144 @@
+package testutil
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// LatencyFunc returns the artificial latency of a Redis command with the lower-case name, e.g.
+// "get", or "pipeline" for pipelines and transactions. It must be safe for concurrent use.
+type LatencyFunc func(name string) time.Duration
+
+// ConstantLatency returns a LatencyFunc delaying each command by the latency.
+func ConstantLatency(latency time.Duration) LatencyFunc {
+	return func(string) time.Duration {
+		return latency
+	}
+}
+
+// UniformLatency returns a LatencyFunc delaying each command by a latency uniformly distributed
+// in [min, max), drawn from the seed so a run is reproducible.
+func UniformLatency(seed int64, min, max time.Duration) LatencyFunc {
+	var mu sync.Mutex
+	rng := rand.New(rand.NewSource(seed))
+	return func(string) time.Duration {
+		if max <= min {
+			return min
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return min + time.Duration(rng.Int63n(int64(max-min)))
+	}
+}
+
+// SpikyLatency returns a LatencyFunc adding the spike to the latency of the base with the
+// probability p, drawn from the seed, e.g. to exhibit tail latency.
+func SpikyLatency(seed int64, base LatencyFunc, p float64, spike time.Duration) LatencyFunc {
+	var mu sync.Mutex
+	rng := rand.New(rand.NewSource(seed))
+	return func(name string) time.Duration {
+		mu.Lock()
+		spiked := rng.Float64() < p
+		mu.Unlock()
+		if spiked {
+			return base(name) + spike
+		}
+		return base(name)
+	}
+}
+
+// latencyHook delays Redis commands by their artificial latency. It implements redis.Hook.
+type latencyHook struct {
+	latency LatencyFunc
+}
+
+// WithLatency returns a new Redis client with the same options as the Redis client, which delays
+// each command, or pipeline, by its latency before sending it, e.g. to run load tests or race
+// investigations in-process with realistic timing. A delay is cut short if the command's context
+// is done. The client is closed on test cleanup.
+//
+// Example:
+//
+//	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+//	rsClient = testutil.WithLatency(t, rsClient, testutil.UniformLatency(1, time.Millisecond, 5*time.Millisecond))
+func WithLatency(t testing.TB, rsClient *redis.Client, latency LatencyFunc) *redis.Client {
+	latClient := redis.NewClient(rsClient.Options())
+	latClient.AddHook(&latencyHook{latency: latency})
+	t.Cleanup(func() {
+		latClient.Close()
+	})
+	return latClient
+}
+
+func (h *latencyHook) delay(ctx context.Context, name string) error {
+	d := h.latency(name)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (h *latencyHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, h.delay(ctx, cmd.Name())
+}
+
+func (h *latencyHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	return nil
+}
+
+func (h *latencyHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, h.delay(ctx, "pipeline")
+}
+
+func (h *latencyHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
+
+// RunClock advances the TTLs of the in-memory server with the wall clock until the test ends,
+// since the server doesn't expire keys unless fast-forwarded. The server clock runs at the rate
+// of the wall clock, e.g. 1.1 for a clock running 10% fast, and is ahead of it by the skew, e.g.
+// to exhibit keys expiring early or late compared to the client's clock.
+func RunClock(t testing.TB, server *miniredis.Miniredis, rate float64, skew time.Duration) {
+	if skew > 0 {
+		server.FastForward(skew)
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		last := time.Now()
+		carry := min(skew, 0) // Advance not applied yet; a negative skew holds the clock back.
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				carry += time.Duration(float64(now.Sub(last)) * rate)
+				last = now
+				if carry > 0 {
+					server.FastForward(carry)
+					carry = 0
+				}
+			}
+		}
+	}()
+	t.Cleanup(func() {
+		close(done)
+		<-stopped
+	})
+}
@@ -0,0 +1,56 @@
+package testutil
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithLatency(t *testing.T) {
+	rsClient, _ := NewRedisClientWithCleanup(t)
+	ctx := context.Background()
+
+	t.Run("Should delay commands", func(t *testing.T) {
+		latClient := WithLatency(t, rsClient, ConstantLatency(20*time.Millisecond))
+		start := time.Now()
+		require.NoError(t, latClient.Set(ctx, "key", "value", 0).Err())
+		assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	})
+
+	t.Run("Should cut delay short on done context", func(t *testing.T) {
+		latClient := WithLatency(t, rsClient, ConstantLatency(time.Minute))
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, latClient.Get(ctx, "key").Err(), context.DeadlineExceeded)
+	})
+
+	t.Run("Should draw reproducible latencies", func(t *testing.T) {
+		a := UniformLatency(1, time.Millisecond, 10*time.Millisecond)
+		b := UniformLatency(1, time.Millisecond, 10*time.Millisecond)
+		for range 10 {
+			d := a("get")
+			assert.Equal(t, d, b("get"))
+			assert.True(t, d >= time.Millisecond && d < 10*time.Millisecond)
+		}
+		spiky := SpikyLatency(1, ConstantLatency(0), 1, time.Second)
+		assert.Equal(t, time.Second, spiky("get"))
+	})
+}
+
+func TestRunClock(t *testing.T) {
+	rsClient, server := NewRedisClientWithCleanup(t)
+	ctx := context.Background()
+	require.NoError(t, rsClient.Set(ctx, "skewed", "value", time.Minute).Err())
+	require.NoError(t, rsClient.Set(ctx, "ticking", "value", 50*time.Millisecond).Err())
+
+	RunClock(t, server, 1, 30*time.Second)
+	ttl, err := rsClient.TTL(ctx, "skewed").Result()
+	require.NoError(t, err)
+	assert.LessOrEqual(t, ttl, 30*time.Second, "should apply skew")
+	assert.Eventually(t, func() bool {
+		return rsClient.Exists(ctx, "ticking").Val() == 0
+	}, time.Second, 10*time.Millisecond, "should expire keys with the wall clock")
+}
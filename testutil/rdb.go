@@ -11,7 +11,7 @@ import (
 
 // NewRedisClient returns a new redis client and in-memory server.
 // It registers a cleanup of redis data after each test.
-func NewRedisClientWithCleanup(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+func NewRedisClientWithCleanup(t testing.TB) (*redis.Client, *miniredis.Miniredis) {
 	server := miniredis.RunT(t)
 	rsClient := redis.NewClient(&redis.Options{
 		Addr: server.Addr(),
@@ -0,0 +1,177 @@
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Command is a Redis command issued through a recorded client.
+type Command struct {
+	Name         string        // Lower-case command name, e.g. "mset".
+	Keys         []string      // Keys of the command, or nil if unknown.
+	PayloadBytes int           // Total size of the values written by the command.
+	TTL          time.Duration // Expiration set by the command, or 0 if none.
+	Pipeline     int           // Sequence number of the pipeline or transaction, or 0 if sent alone.
+}
+
+// CommandRecorder records the Redis commands issued through a client, so tests can assert on
+// the exact commands issued by datastore operations rather than on the resulting Redis state.
+// It implements redis.Hook, and is safe for concurrent use.
+type CommandRecorder struct {
+	mu        sync.Mutex
+	commands  []Command
+	pipelines int
+}
+
+// RecordCommands returns a new Redis client with the same options as the Redis client, which
+// records all issued commands to the returned recorder. The client is closed on test cleanup.
+//
+// Example:
+//
+//	rsClient, rec := testutil.RecordCommands(t, rsClient)
+//	dsClient, _ := datastore.NewClient(rsClient)
+//	...
+//	msets := rec.Filter("mset")
+//	assert.Len(t, msets, 1)
+//	assert.Len(t, msets[0].Keys, 500)
+func RecordCommands(t testing.TB, rsClient *redis.Client) (*redis.Client, *CommandRecorder) {
+	rec := &CommandRecorder{}
+	recClient := redis.NewClient(rsClient.Options())
+	recClient.AddHook(rec)
+	t.Cleanup(func() {
+		recClient.Close()
+	})
+	return recClient, rec
+}
+
+// Commands returns the recorded commands in the order they were issued.
+func (r *CommandRecorder) Commands() []Command {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Command(nil), r.commands...)
+}
+
+// Filter returns the recorded commands with the name, in the order they were issued.
+func (r *CommandRecorder) Filter(name string) []Command {
+	name = strings.ToLower(name)
+	var cmds []Command
+	for _, cmd := range r.Commands() {
+		if cmd.Name == name {
+			cmds = append(cmds, cmd)
+		}
+	}
+	return cmds
+}
+
+// Reset discards the recorded commands.
+func (r *CommandRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands = nil
+}
+
+func (r *CommandRecorder) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record(cmd, 0)
+	return ctx, nil
+}
+
+func (r *CommandRecorder) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	return nil
+}
+
+func (r *CommandRecorder) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pipelines++
+	for _, cmd := range cmds {
+		r.record(cmd, r.pipelines)
+	}
+	return ctx, nil
+}
+
+func (r *CommandRecorder) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
+
+// record appends the command to the recorded commands. Transaction markers aren't recorded.
+func (r *CommandRecorder) record(cmd redis.Cmder, pipeline int) {
+	name := strings.ToLower(cmd.Name())
+	if name == "multi" || name == "exec" {
+		return
+	}
+	c := Command{Name: name, Pipeline: pipeline}
+	args := cmd.Args()
+	switch name {
+	case "set":
+		if len(args) >= 3 {
+			c.Keys = []string{argString(args[1])}
+			c.PayloadBytes = argSize(args[2])
+			for i := 3; i < len(args)-1; i++ {
+				switch strings.ToLower(argString(args[i])) {
+				case "ex":
+					c.TTL = time.Duration(argInt(args[i+1])) * time.Second
+				case "px":
+					c.TTL = time.Duration(argInt(args[i+1])) * time.Millisecond
+				}
+			}
+		}
+	case "mset", "msetnx":
+		for i := 1; i+1 < len(args); i += 2 {
+			c.Keys = append(c.Keys, argString(args[i]))
+			c.PayloadBytes += argSize(args[i+1])
+		}
+	case "expire", "pexpire":
+		if len(args) >= 3 {
+			c.Keys = []string{argString(args[1])}
+			c.TTL = time.Duration(argInt(args[2])) * time.Second
+			if name == "pexpire" {
+				c.TTL = time.Duration(argInt(args[2])) * time.Millisecond
+			}
+		}
+	case "eval", "evalsha":
+		if len(args) >= 3 {
+			n := int(argInt(args[2]))
+			for i := 3; i < len(args); i++ {
+				if i < 3+n {
+					c.Keys = append(c.Keys, argString(args[i]))
+				} else {
+					c.PayloadBytes += argSize(args[i])
+				}
+			}
+		}
+	case "get", "getdel", "mget", "del", "unlink", "exists", "ttl", "pttl", "type", "watch":
+		for _, arg := range args[1:] {
+			c.Keys = append(c.Keys, argString(arg))
+		}
+	}
+	r.commands = append(r.commands, c)
+}
+
+func argString(arg interface{}) string {
+	switch v := arg.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func argSize(arg interface{}) int {
+	return len(argString(arg))
+}
+
+func argInt(arg interface{}) int64 {
+	n, _ := strconv.ParseInt(argString(arg), 10, 64)
+	return n
+}
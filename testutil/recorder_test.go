@@ -0,0 +1,70 @@
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandRecorder(t *testing.T) {
+	rsClient, _ := NewRedisClientWithCleanup(t)
+	recClient, rec := RecordCommands(t, rsClient)
+	ds, err := datastore.NewClient(recClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	t.Run("Put", func(t *testing.T) {
+		rec.Reset()
+		key := keyfactory.NewKey("entity:1", "ns")
+		require.NoError(t, ds.Put(ctx, key, []byte("value"), time.Minute))
+		assert.Equal(t, []Command{{
+			Name:         "set",
+			Keys:         []string{key.RedisKey()},
+			PayloadBytes: 5,
+			TTL:          time.Minute,
+		}}, rec.Commands())
+	})
+
+	t.Run("PutMulti", func(t *testing.T) {
+		rec.Reset()
+		keys := make([]*keyfactory.Key, 500)
+		data := make([][]byte, 500)
+		for i := range keys {
+			keys[i] = keyfactory.NewKey(fmt.Sprintf("entity:%d", i), "ns")
+			data[i] = []byte("ab")
+		}
+		require.NoError(t, ds.PutMulti(ctx, keys, data, 10*time.Minute))
+
+		msets := rec.Filter("mset")
+		require.Len(t, msets, 1)
+		assert.Len(t, msets[0].Keys, 500)
+		assert.Equal(t, 1000, msets[0].PayloadBytes)
+		expires := rec.Filter("expire")
+		require.Len(t, expires, 500)
+		for _, cmd := range expires {
+			assert.Equal(t, 10*time.Minute, cmd.TTL)
+			assert.Equal(t, msets[0].Pipeline, cmd.Pipeline, "should be issued in the same pipeline")
+		}
+		assert.NotZero(t, msets[0].Pipeline)
+	})
+
+	t.Run("Reads", func(t *testing.T) {
+		rec.Reset()
+		key := keyfactory.NewKey("entity:1", "ns")
+		_, err := ds.Get(ctx, key)
+		require.NoError(t, err)
+		_, err = ds.Exists(ctx, key)
+		require.NoError(t, err)
+		cmds := rec.Commands()
+		require.Len(t, cmds, 2)
+		assert.Equal(t, "get", cmds[0].Name)
+		assert.Equal(t, "exists", cmds[1].Name)
+		assert.Equal(t, []string{key.RedisKey()}, cmds[1].Keys)
+	})
+}
@@ -0,0 +1,172 @@
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// SnapshotTTLTolerance is the max difference between TTLs considered equal by Snapshot.Assert,
+// since TTLs decrease between the snapshot and the assertion.
+const SnapshotTTLTolerance = time.Second
+
+// SnapshotEntry is the state of a Redis key captured by TakeSnapshot.
+type SnapshotEntry struct {
+	Type  string        // Redis type, i.e. "string", "zset", "hash", "set", or "list".
+	TTL   time.Duration // Remaining time to live, or 0 if the key doesn't expire.
+	Value any           // string, []redis.Z, map[string]string, or []string for sets (sorted) and lists.
+}
+
+// Snapshot is the state of the Redis keys matching a pattern, captured by TakeSnapshot.
+// Snapshots are compared by value, so they can be asserted equal to expected snapshots.
+type Snapshot struct {
+	Pattern string
+	Entries map[string]SnapshotEntry // By Redis key.
+}
+
+// TakeSnapshot captures the keys matching the Redis glob pattern, e.g. "*" or "<namespace>:*",
+// with their TTLs and values, e.g. to restore prepared fixtures between tests, or to assert that
+// an operation left the store unchanged. The test fails if a key has an unsupported type, e.g. a
+// stream.
+//
+// Example:
+//
+//	fixture := testutil.TakeSnapshot(t, rsClient, "*")
+//	...
+//	fixture.Restore(t, rsClient)
+func TakeSnapshot(t testing.TB, rsClient *redis.Client, pattern string) *Snapshot {
+	t.Helper()
+	ctx := context.Background()
+	snapshot := &Snapshot{Pattern: pattern, Entries: make(map[string]SnapshotEntry)}
+	iter := rsClient.Scan(ctx, 0, pattern, 0).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		if _, ok := snapshot.Entries[key]; ok {
+			continue // SCAN may return duplicates.
+		}
+		entry, err := snapshotEntry(ctx, rsClient, key)
+		if err == redis.Nil {
+			continue // Key removed since the scan.
+		}
+		if err != nil {
+			t.Fatalf("failed to snapshot key '%s': %v", key, err)
+		}
+		snapshot.Entries[key] = entry
+	}
+	if err := iter.Err(); err != nil {
+		t.Fatalf("failed to scan keys matching '%s': %v", pattern, err)
+	}
+	return snapshot
+}
+
+func snapshotEntry(ctx context.Context, rsClient *redis.Client, key string) (SnapshotEntry, error) {
+	var entry SnapshotEntry
+	var err error
+	if entry.Type, err = rsClient.Type(ctx, key).Result(); err != nil {
+		return entry, err
+	}
+	switch entry.Type {
+	case "none":
+		return entry, redis.Nil
+	case "string":
+		entry.Value, err = rsClient.Get(ctx, key).Result()
+	case "zset":
+		entry.Value, err = rsClient.ZRangeWithScores(ctx, key, 0, -1).Result()
+	case "hash":
+		entry.Value, err = rsClient.HGetAll(ctx, key).Result()
+	case "set":
+		var members []string
+		members, err = rsClient.SMembers(ctx, key).Result()
+		slices.Sort(members)
+		entry.Value = members
+	case "list":
+		entry.Value, err = rsClient.LRange(ctx, key, 0, -1).Result()
+	default:
+		return entry, fmt.Errorf("unsupported type '%s'", entry.Type)
+	}
+	if err != nil {
+		return entry, err
+	}
+	ttl, err := rsClient.PTTL(ctx, key).Result()
+	if err != nil {
+		return entry, err
+	}
+	if ttl > 0 {
+		entry.TTL = ttl
+	}
+	return entry, nil
+}
+
+// Assert fails the test if the keys matching the snapshot's pattern differ from the snapshot,
+// where TTLs are equal within SnapshotTTLTolerance.
+func (s *Snapshot) Assert(t testing.TB, rsClient *redis.Client) {
+	t.Helper()
+	current := TakeSnapshot(t, rsClient, s.Pattern)
+	for key, expected := range s.Entries {
+		actual, ok := current.Entries[key]
+		if !ok {
+			t.Errorf("snapshot key '%s' is missing", key)
+			continue
+		}
+		if actual.Type != expected.Type || !reflect.DeepEqual(actual.Value, expected.Value) {
+			t.Errorf("snapshot key '%s' differs: expected %s %v, got %s %v", key, expected.Type, expected.Value, actual.Type, actual.Value)
+		}
+		if (actual.TTL == 0) != (expected.TTL == 0) || (actual.TTL-expected.TTL).Abs() > SnapshotTTLTolerance {
+			t.Errorf("snapshot key '%s' TTL differs: expected %v, got %v", key, expected.TTL, actual.TTL)
+		}
+	}
+	for key := range current.Entries {
+		if _, ok := s.Entries[key]; !ok {
+			t.Errorf("unexpected key '%s' not in snapshot", key)
+		}
+	}
+}
+
+// Restore removes the keys matching the snapshot's pattern, and writes the keys of the snapshot
+// with their values and TTLs.
+func (s *Snapshot) Restore(t testing.TB, rsClient *redis.Client) {
+	t.Helper()
+	ctx := context.Background()
+	current := TakeSnapshot(t, rsClient, s.Pattern)
+	_, err := rsClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for key := range current.Entries {
+			pipe.Del(ctx, key)
+		}
+		for key, entry := range s.Entries {
+			switch value := entry.Value.(type) {
+			case string:
+				pipe.Set(ctx, key, value, 0)
+			case []redis.Z:
+				zs := make([]*redis.Z, len(value))
+				for i := range value {
+					zs[i] = &value[i]
+				}
+				pipe.ZAdd(ctx, key, zs...)
+			case map[string]string:
+				pipe.HSet(ctx, key, value)
+			case []string:
+				members := make([]interface{}, len(value))
+				for i, v := range value {
+					members[i] = v
+				}
+				if entry.Type == "set" {
+					pipe.SAdd(ctx, key, members...)
+				} else {
+					pipe.RPush(ctx, key, members...)
+				}
+			}
+			if entry.TTL > 0 {
+				pipe.PExpire(ctx, key, entry.TTL)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to restore snapshot: %v", err)
+	}
+}
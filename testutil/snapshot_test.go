@@ -0,0 +1,43 @@
+package testutil
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	rsClient, _ := NewRedisClientWithCleanup(t)
+	ctx := context.Background()
+	require.NoError(t, rsClient.Set(ctx, "ns:entity:1", "one", time.Minute).Err())
+	require.NoError(t, rsClient.Set(ctx, "ns:entity:2", "two", 0).Err())
+	require.NoError(t, rsClient.ZAdd(ctx, "ns:index", &redis.Z{Score: 1, Member: "entity:1"}).Err())
+	require.NoError(t, rsClient.Set(ctx, "other:entity:1", "other", 0).Err())
+
+	snapshot := TakeSnapshot(t, rsClient, "ns:*")
+	assert.Equal(t, map[string]SnapshotEntry{
+		"ns:entity:1": {Type: "string", TTL: time.Minute, Value: "one"},
+		"ns:entity:2": {Type: "string", Value: "two"},
+		"ns:index":    {Type: "zset", Value: []redis.Z{{Score: 1, Member: "entity:1"}}},
+	}, snapshot.Entries)
+	snapshot.Assert(t, rsClient)
+
+	t.Run("Should restore snapshot", func(t *testing.T) {
+		require.NoError(t, rsClient.Set(ctx, "ns:entity:1", "changed", 0).Err())
+		require.NoError(t, rsClient.Del(ctx, "ns:index").Err())
+		require.NoError(t, rsClient.Set(ctx, "ns:entity:3", "three", 0).Err())
+
+		snapshot.Restore(t, rsClient)
+		snapshot.Assert(t, rsClient)
+		ttl, err := rsClient.TTL(ctx, "ns:entity:1").Result()
+		require.NoError(t, err)
+		assert.Equal(t, time.Minute, ttl)
+		val, err := rsClient.Get(ctx, "other:entity:1").Result()
+		require.NoError(t, err)
+		assert.Equal(t, "other", val, "should keep keys not matching pattern")
+	})
+}
@@ -0,0 +1,49 @@
+// Package storetest provides helpers for testing code built on entity stores.
+//
+// It's separate from the testutil package since the entitystore tests depend on testutil.
+package storetest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/entitystore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+)
+
+// NewIsolatedStore creates a new store of the entity kind in a unique random key namespace,
+// isolating its data from other tests sharing the datastore.
+// It registers a cleanup deleting all keys in the namespace when the test completes,
+// including when it fails or panics.
+//
+// Example:
+//
+//	store := storetest.NewIsolatedStore[User](t, dsClient, "user")
+func NewIsolatedStore[T entitystore.Entity, PT entitystore.SerializableEntity[T]](
+	t testing.TB,
+	dsClient *datastore.Client,
+	entityKind string,
+	opts ...entitystore.Option,
+) *entitystore.EntityStore[T, PT] {
+	t.Helper()
+	namespace := "test" + keyfactory.GenerateRandomKey()
+	t.Cleanup(func() {
+		kb := keyfactory.NewKeyBuilderWithNamespace(namespace)
+		kb.WithWildcard(keyfactory.WildcardAnyString)
+		keyMatch, err := kb.BuildAndReset()
+		if err != nil {
+			t.Errorf("storetest: failed to build namespace key: %v", err)
+			return
+		}
+		// The test context is canceled before cleanups run.
+		if err := dsClient.DeleteMatch(context.Background(), keyMatch); err != nil {
+			t.Errorf("storetest: failed to delete namespace '%s': %v", namespace, err)
+		}
+	})
+	store, err := entitystore.New[T, PT](entityKind, namespace, dsClient, opts...)
+	if err != nil {
+		t.Fatalf("storetest: failed to create store: %v", err)
+	}
+	return store
+}
@@ -0,0 +1,37 @@
+package storetest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewIsolatedStore(t *testing.T) {
+	rsClient, server := testutil.NewRedisClientWithCleanup(t)
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	t.Run("Isolation and teardown", func(t *testing.T) {
+		t.Run("Store", func(t *testing.T) {
+			store1 := NewIsolatedStore[testutil.Entity](t, dsClient, "test")
+			store2 := NewIsolatedStore[testutil.Entity](t, dsClient, "test")
+			entity := testutil.NewEntity("1", "tenant", 1)
+			_, err := store1.Add(ctx, entity, 0)
+			require.NoError(t, err)
+
+			exists, err := store1.Exists(ctx, entity.GetKey())
+			require.NoError(t, err)
+			assert.True(t, exists)
+			exists, err = store2.Exists(ctx, entity.GetKey())
+			require.NoError(t, err)
+			assert.False(t, exists, "should not see entities of other store")
+			assert.NotEmpty(t, server.Keys())
+		})
+		assert.Empty(t, server.Keys(), "should delete namespace on teardown")
+	})
+}
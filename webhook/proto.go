@@ -0,0 +1,68 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/holmberd/go-entitystore/encoder"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers of the protobuf encoding of an Event:
+//
+//	message Event {
+//	  string type = 1;
+//	  repeated string keys = 2;
+//	  google.protobuf.Timestamp time = 3;
+//	}
+const (
+	fieldType = 1
+	fieldKeys = 2
+	fieldTime = 3
+)
+
+var errInvalidProto = errors.New("webhook: invalid protobuf event")
+
+// MarshalProto returns the protobuf encoding of the event, e.g. for encoder.ProtoEncoder.
+func (e Event) MarshalProto() ([]byte, error) {
+	var b []byte
+	if e.Type != "" {
+		b = protowire.AppendTag(b, fieldType, protowire.BytesType)
+		b = protowire.AppendString(b, e.Type)
+	}
+	for _, key := range e.Keys {
+		b = protowire.AppendTag(b, fieldKeys, protowire.BytesType)
+		b = protowire.AppendString(b, key)
+	}
+	return encoder.AppendProtoTimestamp(b, fieldTime, e.Time), nil
+}
+
+// UnmarshalProto decodes the protobuf encoding of the event.
+func (e *Event) UnmarshalProto(data []byte) error {
+	*e = Event{}
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 || typ != protowire.BytesType {
+			return errInvalidProto
+		}
+		data = data[n:]
+		v, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return errInvalidProto
+		}
+		data = data[n:]
+		switch num {
+		case fieldType:
+			e.Type = string(v)
+		case fieldKeys:
+			e.Keys = append(e.Keys, string(v))
+		case fieldTime:
+			t, err := encoder.ConsumeProtoTimestamp(v)
+			if err != nil {
+				return fmt.Errorf("%w: %w", errInvalidProto, err)
+			}
+			e.Time = t
+		}
+	}
+	return nil
+}
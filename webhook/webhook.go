@@ -0,0 +1,332 @@
+// Package webhook provides a dispatcher that forwards entity change events of a store to
+// HTTP endpoints.
+//
+// Each event is delivered as a POST request to every endpoint, encoded as JSON or by the codec
+// set by WithCodec, or wrapped in a CloudEvents envelope (see WithCloudEvents). Requests to
+// endpoints with a secret are signed with HMAC-SHA256 of the request body in the SignatureHeader,
+// formatted as "sha256=<hex>". Failed deliveries are retried with exponential backoff, and events
+// that can't be delivered are passed to the dead-letter handler.
+//
+// Example:
+//
+//	d := webhook.New([]webhook.Endpoint{{URL: "https://example.com/hook", Secret: secret}})
+//	d.Start()
+//	defer d.Stop()
+//	detach := webhook.Attach(d, userStore)
+//	defer detach()
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/holmberd/go-entitystore/cloudevents"
+	"github.com/holmberd/go-entitystore/encoder"
+	"github.com/holmberd/go-entitystore/entitystore"
+	"github.com/holmberd/go-entitystore/metrics"
+)
+
+const (
+	SignatureHeader = "X-Entitystore-Signature" // Header of the request body signature.
+	EventHeader     = "X-Entitystore-Event"     // Header of the event type.
+
+	MetricDelivered   = "webhook_delivered_total"    // Counter of events delivered to an endpoint.
+	MetricRetries     = "webhook_retries_total"      // Counter of retried deliveries.
+	MetricDeadLetters = "webhook_dead_letters_total" // Counter of events passed to the dead-letter handler.
+
+	defaultQueueSize    = 1024
+	defaultMaxRetries   = 3
+	defaultRetryBackoff = 100 * time.Millisecond
+	defaultTimeout      = 10 * time.Second
+)
+
+// Endpoint is an HTTP endpoint events are delivered to.
+type Endpoint struct {
+	URL    string
+	Secret string // Optional secret used to sign requests.
+}
+
+// Event is an entity change event delivered to the endpoints.
+type Event struct {
+	Type string    `json:"type"` // Store event name, e.g. "EntitiesAdded".
+	Keys []string  `json:"keys"` // Keys of the changed entities.
+	Time time.Time `json:"time"` // Time the event was emitted.
+}
+
+// DeadLetterHandler is called with an event that couldn't be delivered to the endpoint.
+type DeadLetterHandler func(endpoint Endpoint, event Event, err error)
+
+// Option configures a Dispatcher.
+type Option func(*options)
+
+type options struct {
+	httpClient   *http.Client
+	queueSize    int
+	maxRetries   int
+	retryBackoff time.Duration
+	deadLetter   DeadLetterHandler
+	metrics      metrics.Recorder
+	cloudEvents  *cloudevents.Encoder
+	codec        encoder.Codec
+}
+
+// WithHTTPClient sets the HTTP client used to deliver events.
+// By default a client with a 10 second timeout is used.
+func WithHTTPClient(c *http.Client) Option {
+	return func(o *options) {
+		if c != nil {
+			o.httpClient = c
+		}
+	}
+}
+
+// WithQueueSize sets the max number of queued events.
+// When the queue is full, store event listeners block until there is room.
+func WithQueueSize(size int) Option {
+	return func(o *options) {
+		if size > 0 {
+			o.queueSize = size
+		}
+	}
+}
+
+// WithRetries sets the max number of retries of a failed delivery, and the backoff before
+// the first retry. The backoff doubles for each retry.
+func WithRetries(maxRetries int, backoff time.Duration) Option {
+	return func(o *options) {
+		if maxRetries >= 0 {
+			o.maxRetries = maxRetries
+		}
+		if backoff > 0 {
+			o.retryBackoff = backoff
+		}
+	}
+}
+
+// WithDeadLetterHandler sets the handler called with events that couldn't be delivered.
+// By default the event is logged.
+func WithDeadLetterHandler(h DeadLetterHandler) Option {
+	return func(o *options) {
+		if h != nil {
+			o.deadLetter = h
+		}
+	}
+}
+
+// WithMetrics sets the recorder for delivery metrics. By default metrics are discarded.
+func WithMetrics(r metrics.Recorder) Option {
+	return func(o *options) {
+		if r != nil {
+			o.metrics = r
+		}
+	}
+}
+
+// WithCloudEvents delivers events wrapped in CloudEvents envelopes encoded by the encoder,
+// instead of plain JSON events. The codec of the event data is set by the encoder
+// (see cloudevents.Encoder.WithDataCodec).
+func WithCloudEvents(enc *cloudevents.Encoder) Option {
+	return func(o *options) {
+		o.cloudEvents = enc
+	}
+}
+
+// WithCodec sets the codec of the delivered events, e.g. encoder.ProtoEncoder, where the request
+// content type is the codec's content type (see encoder.ContentType). Defaults to encoder.JSONEncoder.
+// It doesn't apply with WithCloudEvents, whose encoder sets the codec of the event data.
+func WithCodec(c encoder.Codec) Option {
+	return func(o *options) {
+		if c != nil {
+			o.codec = c
+		}
+	}
+}
+
+// Dispatcher delivers events to HTTP endpoints.
+// The dispatcher is safe for concurrent use.
+type Dispatcher struct {
+	endpoints []Endpoint
+	opts      options
+
+	mu      sync.Mutex
+	queue   chan Event
+	done    chan struct{}
+	running bool
+}
+
+// New creates a new instance of a Dispatcher.
+func New(endpoints []Endpoint, opts ...Option) *Dispatcher {
+	o := options{
+		httpClient:   &http.Client{Timeout: defaultTimeout},
+		queueSize:    defaultQueueSize,
+		maxRetries:   defaultMaxRetries,
+		retryBackoff: defaultRetryBackoff,
+		deadLetter: func(endpoint Endpoint, event Event, err error) {
+			log.Printf("webhook: dropped %s event for '%s': %v", event.Type, endpoint.URL, err)
+		},
+		metrics: metrics.NopRecorder{},
+		codec:   encoder.JSONEncoder{},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Dispatcher{endpoints: endpoints, opts: o}
+}
+
+// Start starts delivering dispatched events.
+// It's a no-op if the dispatcher is already running.
+func (d *Dispatcher) Start() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.running {
+		return
+	}
+	d.running = true
+	d.queue = make(chan Event, d.opts.queueSize)
+	d.done = make(chan struct{})
+	go d.run(d.queue, d.done)
+}
+
+// Stop stops the dispatcher and waits until all queued events are delivered or dead-lettered.
+// It's a no-op if the dispatcher isn't running.
+func (d *Dispatcher) Stop() {
+	d.mu.Lock()
+	if !d.running {
+		d.mu.Unlock()
+		return
+	}
+	d.running = false
+	close(d.queue)
+	done := d.done
+	d.mu.Unlock()
+	<-done
+}
+
+// Dispatch queues the event for delivery.
+// Events dispatched while the dispatcher isn't running are dead-lettered.
+func (d *Dispatcher) Dispatch(event Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.running {
+		for _, endpoint := range d.endpoints {
+			d.deadLetter(endpoint, event, fmt.Errorf("webhook: dispatcher not running"))
+		}
+		return
+	}
+	d.queue <- event
+}
+
+func (d *Dispatcher) run(queue <-chan Event, done chan<- struct{}) {
+	defer close(done)
+	for event := range queue {
+		body, contentType, err := d.encode(event)
+		for _, endpoint := range d.endpoints {
+			if err != nil {
+				d.deadLetter(endpoint, event, err)
+				continue
+			}
+			if err := d.deliver(endpoint, event, body, contentType); err != nil {
+				d.deadLetter(endpoint, event, err)
+				continue
+			}
+			d.opts.metrics.Count(MetricDelivered, 1)
+		}
+	}
+}
+
+// encode encodes the event as the request body and returns it with its content type.
+func (d *Dispatcher) encode(event Event) ([]byte, string, error) {
+	if d.opts.cloudEvents != nil {
+		return d.opts.cloudEvents.Encode(event.Type, "", event.Time, event)
+	}
+	body, err := d.opts.codec.Marshal(event)
+	return body, encoder.ContentType(d.opts.codec), err
+}
+
+// deliver posts the event body to the endpoint, retrying failed requests with exponential backoff.
+func (d *Dispatcher) deliver(endpoint Endpoint, event Event, body []byte, contentType string) error {
+	backoff := d.opts.retryBackoff
+	var err error
+	for attempt := 0; attempt <= d.opts.maxRetries; attempt++ {
+		if attempt > 0 {
+			d.opts.metrics.Count(MetricRetries, 1)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		var retry bool
+		retry, err = d.post(endpoint, event, body, contentType)
+		if err == nil || !retry {
+			return err
+		}
+	}
+	return err
+}
+
+// post sends a single request to the endpoint and returns whether a failed request may be retried.
+func (d *Dispatcher) post(endpoint Endpoint, event Event, body []byte, contentType string) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set(EventHeader, event.Type)
+	if endpoint.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(endpoint.Secret, body))
+	}
+	resp, err := d.opts.httpClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body) // Drain body to reuse the connection.
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("webhook: unexpected status %d", resp.StatusCode)
+	default:
+		return false, fmt.Errorf("webhook: unexpected status %d", resp.StatusCode)
+	}
+}
+
+func (d *Dispatcher) deadLetter(endpoint Endpoint, event Event, err error) {
+	d.opts.metrics.Count(MetricDeadLetters, 1)
+	d.opts.deadLetter(endpoint, event, err)
+}
+
+// Sign returns the signature of the body with the secret, as sent in the SignatureHeader.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Attach dispatches the added, updated, and removed events of the store to the dispatcher.
+// It returns a function detaching the dispatcher from the store.
+func Attach[T entitystore.Entity, PT entitystore.SerializableEntity[T]](
+	d *Dispatcher,
+	store entitystore.EntityStorer[T, PT],
+) (detach func()) {
+	listener := func(event entitystore.Event) entitystore.EntityStoreListener {
+		return func(ctx context.Context, keys []string) {
+			d.Dispatch(Event{Type: event.String(), Keys: keys, Time: time.Now()})
+		}
+	}
+	addedToken := store.OnAdded().AddListener(listener(entitystore.EntitiesAdded))
+	updatedToken := store.OnUpdated().AddListener(listener(entitystore.EntitiesUpdated))
+	removedToken := store.OnRemoved().AddListener(listener(entitystore.EntitiesRemoved))
+	return func() {
+		store.OnAdded().RemoveListener(addedToken)
+		store.OnUpdated().RemoveListener(updatedToken)
+		store.OnRemoved().RemoveListener(removedToken)
+	}
+}
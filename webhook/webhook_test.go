@@ -0,0 +1,163 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/holmberd/go-entitystore/cloudevents"
+	"github.com/holmberd/go-entitystore/datastore"
+	"github.com/holmberd/go-entitystore/encoder"
+	"github.com/holmberd/go-entitystore/entitystore"
+	"github.com/holmberd/go-entitystore/keyfactory"
+	"github.com/holmberd/go-entitystore/testutil"
+	"github.com/holmberd/go-entitystore/testutil/storetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingServer returns a test server recording received requests and responding with the statuses in order.
+func recordingServer(t *testing.T, statuses ...int) (*httptest.Server, func() []*http.Request, func() [][]byte) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []*http.Request
+	var bodies [][]byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		body, _ := io.ReadAll(r.Body)
+		status := http.StatusOK
+		if len(requests) < len(statuses) {
+			status = statuses[len(requests)]
+		}
+		requests = append(requests, r)
+		bodies = append(bodies, body)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server,
+		func() []*http.Request { mu.Lock(); defer mu.Unlock(); return requests },
+		func() [][]byte { mu.Lock(); defer mu.Unlock(); return bodies }
+}
+
+func TestDispatcher(t *testing.T) {
+	t.Run("Delivers signed events", func(t *testing.T) {
+		server, requests, bodies := recordingServer(t)
+		d := New([]Endpoint{{URL: server.URL, Secret: "secret"}})
+		d.Start()
+		d.Dispatch(Event{Type: entitystore.EntitiesAdded.String(), Keys: []string{"key"}, Time: time.Now()})
+		d.Stop()
+
+		require.Len(t, requests(), 1)
+		req, body := requests()[0], bodies()[0]
+		assert.Equal(t, "EntitiesAdded", req.Header.Get(EventHeader))
+		assert.Equal(t, Sign("secret", body), req.Header.Get(SignatureHeader))
+		var event Event
+		require.NoError(t, json.Unmarshal(body, &event))
+		assert.Equal(t, []string{"key"}, event.Keys)
+	})
+
+	t.Run("CloudEvents", func(t *testing.T) {
+		server, requests, bodies := recordingServer(t)
+		enc, err := cloudevents.NewEncoder("/test", "", cloudevents.FormatJSON)
+		require.NoError(t, err)
+		d := New([]Endpoint{{URL: server.URL}}, WithCloudEvents(enc))
+		d.Start()
+		d.Dispatch(Event{Type: entitystore.EntitiesAdded.String(), Keys: []string{"key"}, Time: time.Now()})
+		d.Stop()
+
+		require.Len(t, requests(), 1)
+		assert.Equal(t, cloudevents.ContentTypeJSON, requests()[0].Header.Get("Content-Type"))
+		var env cloudevents.Envelope
+		require.NoError(t, json.Unmarshal(bodies()[0], &env))
+		assert.Equal(t, "entitystore.EntitiesAdded", env.Type)
+	})
+
+	t.Run("Codec", func(t *testing.T) {
+		server, requests, bodies := recordingServer(t)
+		d := New([]Endpoint{{URL: server.URL}}, WithCodec(encoder.ProtoEncoder{}))
+		d.Start()
+		now := time.Now().UTC()
+		d.Dispatch(Event{Type: entitystore.EntitiesAdded.String(), Keys: []string{"key"}, Time: now})
+		d.Stop()
+
+		require.Len(t, requests(), 1)
+		assert.Equal(t, "application/x-protobuf", requests()[0].Header.Get("Content-Type"))
+		var event Event
+		require.NoError(t, encoder.ProtoEncoder{}.Unmarshal(bodies()[0], &event))
+		assert.Equal(t, Event{Type: "EntitiesAdded", Keys: []string{"key"}, Time: now}, event)
+	})
+
+	t.Run("Retries and dead-letters", func(t *testing.T) {
+		server, requests, _ := recordingServer(t,
+			http.StatusServiceUnavailable, http.StatusOK, // First event succeeds on retry.
+			http.StatusBadRequest, // Second event isn't retried.
+		)
+		var deadLetters []Event
+		d := New(
+			[]Endpoint{{URL: server.URL}},
+			WithRetries(2, time.Millisecond),
+			WithDeadLetterHandler(func(endpoint Endpoint, event Event, err error) {
+				deadLetters = append(deadLetters, event)
+			}),
+		)
+		d.Start()
+		d.Dispatch(Event{Type: "first"})
+		d.Dispatch(Event{Type: "second"})
+		d.Stop()
+
+		assert.Len(t, requests(), 3)
+		require.Len(t, deadLetters, 1)
+		assert.Equal(t, "second", deadLetters[0].Type)
+	})
+
+	t.Run("Exhausted retries", func(t *testing.T) {
+		server, requests, _ := recordingServer(t, 500, 500, 500)
+		var deadLetters []Event
+		d := New(
+			[]Endpoint{{URL: server.URL}},
+			WithRetries(2, time.Millisecond),
+			WithDeadLetterHandler(func(endpoint Endpoint, event Event, err error) {
+				deadLetters = append(deadLetters, event)
+			}),
+		)
+		d.Start()
+		d.Dispatch(Event{Type: "event"})
+		d.Stop()
+
+		assert.Len(t, requests(), 3, "should retry twice")
+		assert.Len(t, deadLetters, 1)
+	})
+}
+
+func TestAttach(t *testing.T) {
+	server, requests, bodies := recordingServer(t)
+	rsClient, _ := testutil.NewRedisClientWithCleanup(t)
+	dsClient, err := datastore.NewClient(rsClient)
+	require.NoError(t, err)
+	store := storetest.NewIsolatedStore[testutil.Entity](t, dsClient, string(keyfactory.EntityKindTest))
+	ctx := context.Background()
+
+	d := New([]Endpoint{{URL: server.URL}})
+	d.Start()
+	detach := Attach(d, store)
+	e := testutil.NewEntity("e-1", "tenant1", 1)
+	_, err = store.Add(ctx, e, 0)
+	require.NoError(t, err)
+	require.NoError(t, store.Remove(ctx, e.GetKey()))
+	detach()
+	_, err = store.Add(ctx, e, 0)
+	require.NoError(t, err)
+	d.Stop()
+
+	require.Len(t, requests(), 2, "should not dispatch events after detach")
+	var event Event
+	require.NoError(t, json.Unmarshal(bodies()[1], &event))
+	assert.Equal(t, "EntitiesRemoved", event.Type)
+	assert.Equal(t, []string{e.GetKey()}, event.Keys)
+}